@@ -3,93 +3,1442 @@ package main
 import (
 	"context"
 	"fmt"
+	"net"
 	"net/http"
 	"os"
 	"os/signal"
+	"runtime"
+	"strings"
+	"sync"
 	"syscall"
+	"time"
 
+	"istio-test/internal/artifact"
+	"istio-test/internal/breaker"
+	"istio-test/internal/cache"
+	"istio-test/internal/catalog"
+	"istio-test/internal/certreload"
+	"istio-test/internal/compress"
 	"istio-test/internal/config"
+	"istio-test/internal/configdrift"
+	"istio-test/internal/configreload"
+	"istio-test/internal/coordination"
+	"istio-test/internal/dbping"
+	"istio-test/internal/deadline"
+	"istio-test/internal/drain"
+	"istio-test/internal/echo"
+	"istio-test/internal/expiry"
+	"istio-test/internal/fault"
+	"istio-test/internal/framing"
+	"istio-test/internal/gctune"
+	"istio-test/internal/goroutines"
+	"istio-test/internal/grpcserver"
+	"istio-test/internal/headers"
+	"istio-test/internal/healthnotify"
+	"istio-test/internal/heartbeat"
+	"istio-test/internal/httpclient"
+	"istio-test/internal/httperr"
+	"istio-test/internal/httpretry"
+	"istio-test/internal/identity"
+	"istio-test/internal/integrity"
+	"istio-test/internal/istioinfo"
 	"istio-test/internal/metadata"
 	"istio-test/internal/observability"
+	"istio-test/internal/payload"
+	"istio-test/internal/podinfo"
+	"istio-test/internal/profiling"
+	"istio-test/internal/proxy"
+	"istio-test/internal/respond"
+	"istio-test/internal/routes"
 	"istio-test/internal/security"
+	"istio-test/internal/sse"
+	"istio-test/internal/store"
+	"istio-test/internal/streams"
+	"istio-test/internal/support"
+	"istio-test/internal/tally"
+	"istio-test/internal/tcpecho"
+	"istio-test/internal/tenant"
+	"istio-test/internal/testrun"
+	"istio-test/internal/transform"
+	"istio-test/internal/tunables"
+	"istio-test/internal/version"
+	"istio-test/internal/watchdog"
+	"istio-test/internal/whoami"
 
-	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/tracer"
-	"gopkg.in/DataDog/dd-trace-go.v1/profiler"
-
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
 	httptrace "gopkg.in/DataDog/dd-trace-go.v1/contrib/net/http"
 )
 
 func main() {
 	ctx := context.Background()
 
-	// Load configuration
-	conf := config.Load()
-
-	// Validate configuration
-	if err := conf.Validate(); err != nil {
-		fmt.Fprintf(os.Stderr, "Configuration validation failed: %v\n", err)
+	// Load and validate configuration, reporting every problem at once
+	conf, errs := config.LoadWithErrors()
+	if len(errs) > 0 {
+		for _, err := range errs {
+			fmt.Fprintf(os.Stderr, "Configuration validation failed: %v\n", err)
+		}
 		os.Exit(1)
 	}
 
 	observability.Init(conf.Observability.LogLevel, observability.Config{
 		EnablePIIRedaction: conf.Observability.EnablePIIRedaction,
+		LogFormat:          conf.Observability.LogFormat,
+		LogBufferSize:      conf.Observability.LogBufferSize,
+		RecentRequests:     conf.Observability.RecentRequests,
+		LogExcludePaths:    conf.Observability.LogExcludePaths,
+
+		RedactAllowedParams:      conf.Observability.PIIAllowedQueryParams,
+		RedactIPMode:             conf.Observability.PIIIPRedaction,
+		RedactUserAgentMaxLength: conf.Observability.PIIUserAgentMaxLength,
 	})
+	observability.SetRequestLogSampleRate(conf.Observability.RequestLogSampleRate)
+	if conf.Observability.SlowRequestThreshold > 0 {
+		observability.SetSlowRequestThreshold(conf.Observability.SlowRequestThreshold)
+	}
 
-	observability.InfoWithContext(ctx, "Application is starting")
+	observability.InfoWithContext(ctx, "Application is starting: "+version.Get().String())
 
-	// Create security options once at startup for better performance
-	apiSecurityOptions := security.CustomSecurityOptions(
-		conf.Security.APICOEP,
-		conf.Security.APICOOP,
-		conf.Security.APICORP,
-	)
+	// Apply the soft memory limit, GC target and GOMAXPROCS before anything
+	// allocates heavily or starts goroutines
+	if err := gctune.Apply(gctune.Options{
+		MemoryLimit: conf.Runtime.MemoryLimit,
+		GCPercent:   conf.Runtime.GCPercent,
+		MaxProcs:    conf.Runtime.MaxProcs,
+	}); err != nil {
+		fmt.Fprintf(os.Stderr, "Runtime settings failed: %v\n", err)
+		os.Exit(1)
+	}
+	runtimeStatus := gctune.Current()
+	observability.InfoWithContext(ctx, fmt.Sprintf("Runtime memory limit %d bytes, GC percent %d, GOMAXPROCS %d (CPU quota %g, %d node CPUs)",
+		runtimeStatus.MemoryLimitBytes, runtimeStatus.GCPercent, runtimeStatus.GOMAXPROCS, runtimeStatus.CPUQuota, runtime.NumCPU()))
 
-	defaultSecurityOptions := security.CustomSecurityOptions(
-		conf.Security.DefaultCOEP,
-		conf.Security.DefaultCOOP,
-		conf.Security.DefaultCORP,
-	)
+	// Create security headers once at startup; configuration reloads update them in place
+	apiSecurityOptions, defaultSecurityOptions := securityOptions(conf)
+	apiSecurity, defaultSecurity := security.NewHeaders(apiSecurityOptions), security.NewHeaders(defaultSecurityOptions)
 
 	// Log security policy configuration for observability
 	observability.InfoWithContext(ctx, fmt.Sprintf("Security policies configured - API: COEP='%s' COOP='%s' CORP='%s', Default: COEP='%s' COOP='%s' CORP='%s'",
 		conf.Security.APICOEP, conf.Security.APICOOP, conf.Security.APICORP,
 		conf.Security.DefaultCOEP, conf.Security.DefaultCOOP, conf.Security.DefaultCORP))
 
+	// The tracer and profiler start in the background once their agent is
+	// reachable, so nothing sent before it is up is lost; invalid options
+	// still fail here
+	var exporters []*observability.Exporter
 	if conf.Observability.EnableTracing {
-		tracer.Start(tracer.WithRuntimeMetrics())
-		defer tracer.Stop()
+		tracingVersion := conf.Observability.TracingVersion
+		if tracingVersion == "" {
+			tracingVersion = version.Get().Version
+		}
+		tracerExporter, err := observability.NewTracerExporter(observability.TracerOptions{
+			Backend:       conf.Observability.TracingBackend,
+			Service:       conf.Observability.TracingService,
+			Env:           conf.Observability.TracingEnv,
+			Version:       tracingVersion,
+			AgentAddr:     conf.Observability.TracingAgentAddr,
+			OTLPEndpoint:  conf.Observability.TracingOTLPEndpoint,
+			SampleRate:    conf.Observability.TracingSampleRate,
+			SamplingRules: conf.Observability.TracingSamplingRules,
+			Tags:          conf.Observability.TracingTags,
+		})
+		if err != nil {
+			observability.ErrorWithContext(ctx, fmt.Sprintf("Warning: Failed to start tracer: %v", err))
+		} else {
+			exporters = append(exporters, tracerExporter)
+			defer observability.StopTracer()
+		}
 	}
 
 	if conf.Observability.EnableProfiler {
-		err := profiler.Start(
-			profiler.WithProfileTypes(
-				profiler.CPUProfile,
-				profiler.HeapProfile,
-			),
-		)
+		profilerExporter, err := observability.NewProfilerExporter(observability.ProfilerOptions{
+			ProfileTypes:         conf.Observability.ProfileTypes,
+			Period:               conf.Observability.ProfilePeriod,
+			UploadTimeout:        conf.Observability.ProfileUploadTimeout,
+			BlockProfileRate:     conf.Observability.ProfileBlockRate,
+			MutexProfileFraction: conf.Observability.ProfileMutexFraction,
+			AgentAddr:            conf.Observability.TracingAgentAddr,
+		})
 		if err != nil {
 			observability.ErrorWithContext(ctx, fmt.Sprintf("Warning: Failed to start profiler: %v", err))
+		} else {
+			exporters = append(exporters, profilerExporter)
+			defer observability.StopProfiler()
+		}
+	}
+
+	// Stop waiting for agents before the exporters are stopped
+	exporterCtx, stopExporters := context.WithCancel(ctx)
+	defer stopExporters()
+	for _, exporter := range exporters {
+		goroutines.Go(exporterCtx, "exporters", func(ctx context.Context) {
+			exporter.Run(ctx, observability.DefaultExporterBaseDelay, conf.Observability.ExporterRetryMaxDelay)
+		})
+	}
+
+	// Load outbound mTLS material up front so bad mounts fail at startup
+	outboundTLS := httpclient.TLSOptions{
+		CertFile:  conf.Outbound.TLSCertFile,
+		KeyFile:   conf.Outbound.TLSKeyFile,
+		CAFile:    conf.Outbound.TLSCAFile,
+		TargetCAs: conf.Outbound.TLSTargetCAs,
+	}
+	var tlsPolicy *httpclient.TLSPolicy
+	if outboundTLS.Enabled() {
+		var err error
+		tlsPolicy, err = httpclient.LoadTLSPolicy(outboundTLS)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Outbound TLS configuration failed: %v\n", err)
+			os.Exit(1)
 		}
-		defer profiler.Stop()
+		observability.InfoWithContext(ctx, fmt.Sprintf("Outbound mTLS configured - client certificate: %t, pinned targets: %d",
+			conf.Outbound.TLSCertFile != "", tlsPolicy.PinnedTargets()))
 	}
 
 	// Create metadata client with configuration
-	metadataClient := metadata.NewClient(
-		conf.Metadata.HTTPTimeout,
-		conf.Metadata.MaxRetries,
-		conf.Metadata.BaseRetryDelay,
-		conf.Metadata.MaxRetryDelay,
-		conf.Metadata.RetryMultiplier,
-	)
+	retryPolicy := httpretry.Policy{
+		MaxAttempts: conf.Metadata.MaxRetries,
+		BaseDelay:   conf.Metadata.BaseRetryDelay,
+		MaxDelay:    conf.Metadata.MaxRetryDelay,
+		Multiplier:  conf.Metadata.RetryMultiplier,
+		Jitter:      conf.Metadata.RetryJitter,
+	}
+	if conf.Metadata.RetryBudget > 0 {
+		retryPolicy.Budget = httpretry.NewBudget(conf.Metadata.RetryBudget, conf.Metadata.RetryBudgetMin, 10*time.Second)
+	}
+
+	// Every application-originated call goes through a named client
+	clients := httpclient.NewFactory(tlsPolicy, outboundClientOptions(conf, retryPolicy))
+	metadataHTTP := clients.Client(httpclient.ClientMetadata)
+	metadataProvider, err := metadata.NewProvider(conf.Metadata.Provider, metadataHTTP.HTTP)
+	if err != nil {
+		observability.ErrorWithContext(ctx, fmt.Sprintf("Failed to create metadata provider: %v", err))
+		os.Exit(1)
+	}
+	metadataClient := metadata.NewClientWithProvider(metadataHTTP.HTTP, metadataHTTP.Retry, metadataProvider)
+	var metadataBreaker *breaker.Breaker
+	if conf.Metadata.BreakerFailureThreshold > 0 {
+		metadataBreaker = breaker.New("metadata", breaker.Options{
+			FailureThreshold: conf.Metadata.BreakerFailureThreshold,
+			ResetTimeout:     conf.Metadata.BreakerResetTimeout,
+		})
+		metadataClient.SetBreaker(metadataBreaker)
+	}
+	observability.InfoWithContext(ctx, fmt.Sprintf("Reading instance metadata from %s", metadataProvider.Name()))
+
+	// Metadata served to callers may come from the cache; health checks and
+	// zone detection always reach the metadata server
+	var metadataFetcher metadata.MetadataFetcher = metadataClient
+	if conf.Metadata.CacheEnabled {
+		metadataFetcher = metadata.NewCache(metadataClient, metadata.CacheOptions{
+			TTL:  conf.Metadata.CacheTTL,
+			TTLs: metadata.DefaultCacheTTLs(),
+		})
+	}
+
+	// Counters shared by replicas when Redis is configured
+	counters, closeCounters := store.New(store.Options{
+		RedisAddr:      conf.Store.RedisAddr,
+		RedisPassword:  conf.Store.RedisPassword,
+		RedisDB:        conf.Store.RedisDB,
+		HealthInterval: conf.Store.HealthInterval,
+	})
+	defer closeCounters()
+	observability.InfoWithContext(ctx, fmt.Sprintf("Counter store backend: %s", counters.Backend()))
+
+	mux := http.NewServeMux()
+	registry := routes.NewRegistry(mux)
+	notFound := security.SecurityMiddlewareFuncWithHeaders(metadata.NotFoundHandler, defaultSecurity)
+
+	// Profiling, metrics and configuration endpoints move to the admin port
+	// when one is set, keeping them off the port Istio routes traffic to
+	adminRegistry := registry
+	var adminMux *http.ServeMux
+	if conf.Server.AdminPort != "" {
+		adminMux = http.NewServeMux()
+		adminRegistry = routes.NewRegistry(adminMux)
+	}
+
+	// Admin and debug routes require a static token on whichever listener
+	// serves them, once one is configured
+	var adminAuth *security.AdminAuth
+	if conf.AdminAuth.Token != "" || conf.AdminAuth.TokenFile != "" {
+		var err error
+		adminAuth, err = security.NewAdminAuth(security.AdminAuthOptions{
+			Token:     conf.AdminAuth.Token,
+			TokenFile: conf.AdminAuth.TokenFile,
+			Routes:    conf.AdminAuth.Routes,
+		})
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Admin token check failed: %v\n", err)
+			os.Exit(1)
+		}
+		observability.InfoWithContext(ctx, fmt.Sprintf("Admin token required for %v", conf.AdminAuth.Routes))
+	}
+
+	registry.HandleFunc(routes.Route{
+		Pattern: "/istio-test/metadata/",
+		Path:    "/istio-test/metadata/{type}",
+		Methods: []string{"GET"},
+		Summary: "Fetch a single metadata attribute of the node serving the request",
+		Tags:    []string{"metadata"},
+		Parameters: []routes.Parameter{
+			{Name: "type", In: "path", Enum: metadata.Types()},
+			{Name: metadata.CacheBypassParam, In: "query", Description: "Skip the metadata cache when true"},
+		},
+		Responses: map[int]routes.Response{
+			http.StatusOK:         {Description: "Metadata attribute keyed by type", Body: map[string]string{}},
+			http.StatusBadRequest: {Description: "Invalid request or unknown metadata type", ContentType: httperr.ContentType, Body: httperr.Problem{}},
+			http.StatusNotFound:   {Description: "Metadata type not available from the configured metadata provider", ContentType: httperr.ContentType, Body: httperr.Problem{}},
+			http.StatusBadGateway: {Description: "Metadata server could not be reached", ContentType: httperr.ContentType, Body: httperr.Problem{}},
+		},
+	}, security.SecureHandlerWithHeaders([]string{"GET"}, metadata.MetadataHandler(metadataFetcher.FetchMetadata), apiSecurity))
+
+	// Every attribute in one round trip, fetched concurrently
+	registry.HandleFunc(routes.Route{
+		Pattern: "/istio-test/metadata",
+		Methods: []string{"GET"},
+		Summary: "Fetch all metadata attributes of the node serving the request at once",
+		Tags:    []string{"metadata"},
+		Parameters: []routes.Parameter{
+			{Name: metadata.TypesParam, In: "query", Description: "Comma-separated metadata types to fetch instead of all of them"},
+			{Name: metadata.CacheBypassParam, In: "query", Description: "Skip the metadata cache when true"},
+		},
+		Responses: map[int]routes.Response{
+			http.StatusOK:         {Description: "Attributes keyed by type, with the error of each attribute that could not be fetched", Body: metadata.BatchResponse{}},
+			http.StatusBadRequest: {Description: "Unknown metadata type", ContentType: httperr.ContentType, Body: httperr.Problem{}},
+			http.StatusBadGateway: {Description: "No attribute could be fetched", Body: metadata.BatchResponse{}},
+		},
+	}, security.SecureHandlerWithHeaders([]string{"GET"}, metadata.BatchMetadataHandler(metadataFetcher.FetchMetadata), apiSecurity))
+
+	// Real GCP-issued tokens for exercising RequestAuthentication and JWT policies
+	if len(conf.Metadata.IdentityTokenAudiences) > 0 {
+		registry.HandleFunc(routes.Route{
+			Pattern: "/istio-test/metadata/identity-token",
+			Methods: []string{"GET"},
+			Summary: "Fetch an identity token of the service account, and optionally an access token",
+			Tags:    []string{"metadata"},
+			Parameters: []routes.Parameter{
+				{Name: metadata.AudienceParam, In: "query", Required: true, Enum: conf.Metadata.IdentityTokenAudiences},
+				{Name: metadata.AccessTokenParam, In: "query", Description: "Also return an access token when true"},
+			},
+			Responses: map[int]routes.Response{
+				http.StatusOK:         {Description: "Identity token with its decoded claims", Body: metadata.IdentityTokenResponse{}},
+				http.StatusBadRequest: {Description: "Missing audience or invalid access_token", ContentType: httperr.ContentType, Body: httperr.Problem{}},
+				http.StatusForbidden:  {Description: "Audience not allowed, or access tokens not enabled", ContentType: httperr.ContentType, Body: httperr.Problem{}},
+				http.StatusBadGateway: {Description: "Metadata server could not be reached", ContentType: httperr.ContentType, Body: httperr.Problem{}},
+			},
+		}, security.SecureHandlerWithHeaders([]string{"GET"}, metadata.IdentityTokenHandler(metadataClient.FetchMetadata, metadata.IdentityTokenOptions{
+			Audiences:   conf.Metadata.IdentityTokenAudiences,
+			AccessToken: conf.Metadata.AccessTokenEnabled,
+		}), apiSecurity))
+	}
+
+	// Checks reported by the health endpoint; dependencies only degrade health
+	metadataCheckOptions := metadata.MetadataCheckOptions{
+		Timeout:       conf.Health.CheckTimeouts["metadata_service"],
+		SlowThreshold: conf.Health.MetadataSlowThreshold,
+	}
+	healthRegistry := metadata.NewHealthRegistry(metadata.MetadataServiceCheckWithOptions(metadataClient, metadataCheckOptions))
+	healthRegistry.SetTimeouts(conf.Health.CheckTimeouts)
+	for _, exporter := range exporters {
+		healthRegistry.RegisterDependency(exporter)
+	}
+	if metadataBreaker != nil {
+		healthRegistry.RegisterDependency(metadataBreaker)
+	}
+	if conf.DBPing.Driver != "" {
+		dbCheck, err := dbping.New(dbping.Options{
+			Driver:  conf.DBPing.Driver,
+			DSNFile: conf.DBPing.DSNFile,
+			Query:   conf.DBPing.Query,
+			Timeout: conf.DBPing.Timeout,
+		})
+		if err != nil {
+			observability.ErrorWithContext(ctx, fmt.Sprintf("Database check disabled: %v", err))
+		} else {
+			defer dbCheck.Close()
+			healthRegistry.RegisterDependency(dbCheck)
+
+			registry.HandleFunc(routes.Route{
+				Pattern: "/istio-test/dbping",
+				Methods: []string{"GET"},
+				Summary: "Connect to the configured database and run the check query",
+				Tags:    []string{"health"},
+				Responses: map[int]routes.Response{
+					http.StatusOK:                 {Description: "Database answered", Body: dbping.Result{}},
+					http.StatusServiceUnavailable: {Description: "Database unreachable or query failed", Body: dbping.Result{}},
+				},
+			}, security.SecureHandlerWithHeaders([]string{"GET"}, dbCheck.Handler(), apiSecurity))
+		}
+	}
+
+	// Certificates and tokens close to expiry degrade health before rotation failures break mTLS
+	var expirySources []expiry.Source
+	if conf.Server.TLSCertFile != "" {
+		expirySources = append(expirySources, expiry.CertificateFile(conf.Server.TLSCertFile))
+	}
+	for _, file := range conf.Expiry.CertFiles {
+		expirySources = append(expirySources, expiry.CertificateFile(file))
+	}
+	for _, file := range conf.Expiry.TokenFiles {
+		expirySources = append(expirySources, expiry.TokenFile(file))
+	}
+	expiryWatcher := expiry.NewWatcher(conf.Expiry.Window, expirySources...)
+	if expiryWatcher.Len() > 0 {
+		healthRegistry.RegisterDependency(expiryWatcher)
+		expiryCtx, stopExpiryWatcher := context.WithCancel(ctx)
+		defer stopExpiryWatcher()
+		goroutines.Go(expiryCtx, "expiry", func(ctx context.Context) { expiryWatcher.Run(ctx, conf.Expiry.Interval) })
+
+		adminRegistry.HandleFunc(routes.Route{
+			Pattern: "/admin/expiry",
+			Methods: []string{"GET"},
+			Summary: "Expiry of the watched certificates and tokens",
+			Tags:    []string{"admin"},
+			Responses: map[int]routes.Response{
+				http.StatusOK: {Description: "Expiry and time remaining per credential", Body: expiry.Response{}},
+			},
+		}, security.SecureHandlerWithHeaders([]string{"GET"}, expiryWatcher.Handler(), defaultSecurity))
+	}
+
+	// Report subsystems whose goroutine count only grows
+	if conf.GoroutineLeak.Enabled {
+		leakDetector := goroutines.NewLeakDetector(goroutines.Options{
+			Interval:  conf.GoroutineLeak.Interval,
+			Window:    conf.GoroutineLeak.Window,
+			MinGrowth: conf.GoroutineLeak.MinGrowth,
+		})
+		healthRegistry.RegisterDependency(leakDetector)
+		leakCtx, stopLeakDetector := context.WithCancel(ctx)
+		defer stopLeakDetector()
+		goroutines.Go(leakCtx, "goroutines", leakDetector.Run)
+
+		adminRegistry.HandleFunc(routes.Route{
+			Pattern: "/admin/goroutines",
+			Methods: []string{"GET"},
+			Summary: "Goroutine count and suspected leaks per subsystem",
+			Tags:    []string{"admin"},
+			Responses: map[int]routes.Response{
+				http.StatusOK: {Description: "Goroutines per subsystem", Body: goroutines.Response{}},
+			},
+		}, security.SecureHandlerWithHeaders([]string{"GET"}, leakDetector.Handler(), defaultSecurity))
+	}
+
+	// Dependencies are checked in the background so probes never wait on them
+	healthChecker := metadata.NewHealthChecker(healthRegistry, metadata.CheckerOptions{
+		Interval:       conf.Health.CheckInterval,
+		StaleAfter:     conf.Health.StaleAfter,
+		UnhealthyAfter: conf.Health.UnhealthyAfter,
+	})
+	healthCtx, stopHealthChecker := context.WithCancel(ctx)
+	defer stopHealthChecker()
+	if conf.Health.WebhookURL != "" {
+		notifier := healthnotify.New(clients.Client(httpclient.ClientWebhook), healthnotify.Options{
+			URL:      conf.Health.WebhookURL,
+			Instance: os.Getenv("HOSTNAME"),
+		})
+		healthChecker.OnTransition(notifier.Notify)
+		goroutines.Go(healthCtx, "health-webhook", notifier.Run)
+		observability.InfoWithContext(ctx, "Health transitions are posted to the configured webhook")
+	}
+	goroutines.Go(healthCtx, "health", healthChecker.Run)
+
+	adminRegistry.HandleFunc(routes.Route{
+		Pattern: "/admin/health/transitions",
+		Methods: []string{"GET"},
+		Summary: "Latest changes of the overall health status, with the checks failing at the time",
+		Tags:    []string{"admin"},
+		Responses: map[int]routes.Response{
+			http.StatusOK: {Description: "Transitions, oldest first", Body: []metadata.HealthTransition{}},
+		},
+	}, security.SecureHandlerWithHeaders([]string{"GET"}, healthChecker.TransitionsHandler(), defaultSecurity))
+
+	registry.HandleFunc(routes.Route{
+		Pattern: "/istio-test/health",
+		Methods: []string{"GET", "HEAD"},
+		Summary: "Health of the application and its dependencies, from the latest background check",
+		Tags:    []string{"health"},
+		Responses: map[int]routes.Response{
+			http.StatusOK:                 {Description: "Healthy or degraded", Body: metadata.HealthResponse{}},
+			http.StatusServiceUnavailable: {Description: "Unhealthy", Body: metadata.HealthResponse{}},
+		},
+	}, security.SecureHandlerWithHeaders([]string{"GET", "HEAD"}, healthChecker.Handler(), apiSecurity))
+
+	// Liveness only reports that the process is up
+	registry.HandleFunc(routes.Route{
+		Pattern: "/istio-test/health/live",
+		Methods: []string{"GET", "HEAD"},
+		Summary: "Liveness check, independent of dependencies",
+		Tags:    []string{"health"},
+		Responses: map[int]routes.Response{
+			http.StatusOK: {Description: "OK", ContentType: "text/plain"},
+		},
+	}, security.SecureHandlerWithHeaders([]string{"GET", "HEAD"}, metadata.HealthCheckHandler, apiSecurity))
+
+	// Readiness fails while draining so traffic moves away before shutdown
+	readiness := metadata.NewReadinessWithOptions(metadataClient, metadataCheckOptions)
+	registry.HandleFunc(routes.Route{
+		Pattern: "/istio-test/health/ready",
+		Methods: []string{"GET", "HEAD"},
+		Summary: "Readiness check, failing while draining or when the metadata server is unreachable",
+		Tags:    []string{"health"},
+		Responses: map[int]routes.Response{
+			http.StatusOK:                 {Description: "Ready or degraded", Body: metadata.HealthResponse{}},
+			http.StatusServiceUnavailable: {Description: "Draining or unreachable metadata server", Body: metadata.HealthResponse{}},
+		},
+	}, security.SecureHandlerWithHeaders([]string{"GET", "HEAD"}, readiness.Handler(), apiSecurity))
+
+	// Keep basic health check for compatibility
+	registry.HandleFunc(routes.Route{
+		Pattern: "/istio-test/health/basic",
+		Methods: []string{"GET", "HEAD"},
+		Summary: "Basic liveness check",
+		Tags:    []string{"health"},
+		Responses: map[int]routes.Response{
+			http.StatusOK: {Description: "OK", ContentType: "text/plain"},
+		},
+	}, security.SecureHandlerWithHeaders([]string{"GET", "HEAD"}, metadata.HealthCheckHandler, apiSecurity))
+
+	registry.HandleFunc(routes.Route{
+		Pattern:     "/istio-test/respond",
+		Methods:     []string{"POST"},
+		Summary:     "Respond as described by a JSON spec (status, headers, body template, delay, repeat), with X-Content-SHA256 and X-Content-Length of the body",
+		Tags:        []string{"testing"},
+		RequestBody: respond.Spec{},
+		Responses: map[int]routes.Response{
+			http.StatusOK:         {Description: "Response shaped by the spec; status, headers and body are spec-defined", ContentType: "text/plain"},
+			http.StatusBadRequest: {Description: "Invalid spec or body template", ContentType: "text/plain"},
+		},
+	}, security.SecureHandlerWithHeaders([]string{"POST"}, integrity.Middleware(respond.Handler(respond.Options{
+		MaxDelay:      conf.Respond.MaxDelay,
+		FetchMetadata: metadataFetcher.FetchMetadata,
+	})).ServeHTTP, apiSecurity))
+
+	// Payload checksums prove whether proxies changed bodies in either direction
+	registry.HandleFunc(routes.Route{
+		Pattern: "/istio-test/verify",
+		Methods: []string{"POST", "PUT"},
+		Summary: "Check the request body against the SHA-256 and length announced by the caller",
+		Tags:    []string{"testing"},
+		Parameters: []routes.Parameter{
+			{Name: integrity.SHA256Param, In: "query", Description: "Expected hex SHA-256 of the body, when the " + integrity.SHA256Header + " header is not set"},
+			{Name: integrity.LengthParam, In: "query", Description: "Expected length of the body, when the " + integrity.LengthHeader + " header is not set"},
+		},
+		Responses: map[int]routes.Response{
+			http.StatusOK:                    {Description: "Body matches", Body: integrity.Result{}},
+			http.StatusBadRequest:            {Description: "Missing or invalid checksum", ContentType: "text/plain"},
+			http.StatusRequestEntityTooLarge: {Description: "Body too large", ContentType: "text/plain"},
+			http.StatusUnprocessableEntity:   {Description: "Body does not match", Body: integrity.Result{}},
+		},
+	}, security.SecureHandlerWithHeaders([]string{"POST", "PUT"}, integrity.VerifyHandler, apiSecurity))
+
+	registry.HandleFunc(routes.Route{
+		Pattern: "/istio-test/whoami",
+		Methods: []string{"GET"},
+		Summary: "Pod, zone and version that served the request",
+		Tags:    []string{"testing"},
+		Parameters: []routes.Parameter{
+			{Name: whoami.FormatParam, In: "query", Enum: []string{"json", "html"}, Description: "html renders a page colored by zone and version"},
+		},
+		Responses: map[int]routes.Response{
+			http.StatusOK:         {Description: "Serving pod as JSON, or as HTML with format=html", Body: whoami.Response{}},
+			http.StatusBadRequest: {Description: "Unknown format", ContentType: "text/plain"},
+		},
+	}, security.SecureHandlerWithHeaders([]string{"GET"}, whoami.Handler(metadataFetcher.FetchMetadata), apiSecurity))
+
+	// Counts aggregated across replicas through the counter store
+	registry.HandleFunc(routes.Route{
+		Pattern: "/istio-test/dedupe/",
+		Path:    "/istio-test/dedupe/{id}",
+		Methods: []string{"GET", "POST"},
+		Summary: "Count deliveries of a request ID to spot retried or mirrored duplicates",
+		Tags:    []string{"testing"},
+		Parameters: []routes.Parameter{
+			{Name: "id", In: "path", Description: "Request ID, letters, digits, '.', '_' or '-'"},
+			{Name: tally.WindowParam, In: "query", Description: "How long deliveries are remembered, 5m by default"},
+		},
+		Responses: map[int]routes.Response{
+			http.StatusOK:                 {Description: "Deliveries of the ID", Body: tally.DedupeResponse{}},
+			http.StatusBadRequest:         {Description: "Invalid ID or window", ContentType: "text/plain"},
+			http.StatusServiceUnavailable: {Description: "Counter store unavailable", ContentType: "text/plain"},
+		},
+	}, security.SecureHandlerWithHeaders([]string{"GET", "POST"}, tally.DedupeHandler("/istio-test/dedupe/", counters), apiSecurity))
+
+	registry.HandleFunc(routes.Route{
+		Pattern: "/istio-test/quota/",
+		Path:    "/istio-test/quota/{key}",
+		Methods: []string{"GET", "POST"},
+		Summary: "Admit a fixed number of requests per key and window, then answer 429",
+		Tags:    []string{"testing"},
+		Parameters: []routes.Parameter{
+			{Name: "key", In: "path", Description: "Quota key, letters, digits, '.', '_' or '-'"},
+			{Name: tally.LimitParam, In: "query", Description: "Requests admitted per window, 10 by default"},
+			{Name: tally.WindowParam, In: "query", Description: "Window length, 1m by default"},
+		},
+		Responses: map[int]routes.Response{
+			http.StatusOK:                 {Description: "Request admitted", Body: tally.QuotaResponse{}},
+			http.StatusBadRequest:         {Description: "Invalid key, limit or window", ContentType: "text/plain"},
+			http.StatusTooManyRequests:    {Description: "Quota used up, with Retry-After", Body: tally.QuotaResponse{}},
+			http.StatusServiceUnavailable: {Description: "Counter store unavailable", ContentType: "text/plain"},
+		},
+	}, security.SecureHandlerWithHeaders([]string{"GET", "POST"}, tally.QuotaHandler("/istio-test/quota/", counters), apiSecurity))
+
+	registry.HandleFunc(routes.Route{
+		Pattern: "/istio-test/distribution/",
+		Path:    "/istio-test/distribution/{key}",
+		Methods: []string{"GET"},
+		Summary: "Count the requests for a key this pod served next to the total over all pods",
+		Tags:    []string{"testing"},
+		Parameters: []routes.Parameter{
+			{Name: "key", In: "path", Description: "Sample key, letters, digits, '.', '_' or '-'"},
+			{Name: tally.WindowParam, In: "query", Description: "How long counts are kept, 1h by default"},
+		},
+		Responses: map[int]routes.Response{
+			http.StatusOK:                 {Description: "Share of requests served by this pod", Body: tally.DistributionResponse{}},
+			http.StatusBadRequest:         {Description: "Invalid key or window", ContentType: "text/plain"},
+			http.StatusServiceUnavailable: {Description: "Counter store unavailable", ContentType: "text/plain"},
+		},
+	}, security.SecureHandlerWithHeaders([]string{"GET"}, tally.DistributionHandler("/istio-test/distribution/", counters), apiSecurity))
+
+	// Where in the cluster the request landed, to pair with the cluster metadata
+	registry.HandleFunc(routes.Route{
+		Pattern: "/istio-test/podinfo",
+		Methods: []string{"GET"},
+		Summary: "Pod name, namespace, node, pod IP, service account and labels of the serving pod",
+		Tags:    []string{"testing"},
+		Responses: map[int]routes.Response{
+			http.StatusOK: {Description: "Pod information from the Downward API", Body: podinfo.Info{}},
+		},
+	}, security.SecureHandlerWithHeaders([]string{"GET"}, podinfo.Handler(podinfo.Options{
+		PodInfoDir:        conf.Istio.PodInfoDir,
+		ServiceAccountDir: podinfo.DefaultServiceAccountDir,
+	}), apiSecurity))
+
+	registry.HandleFunc(routes.Route{
+		Pattern: "/istio-test/echo",
+		Methods: echo.Methods,
+		Summary: "Reflect the method, path, query, headers and body of the request",
+		Tags:    []string{"testing"},
+		Responses: map[int]routes.Response{
+			http.StatusOK: {Description: "The request as received", Body: echo.Response{}},
+		},
+	}, security.SecureHandlerWithHeaders(echo.Methods, echo.Handler, apiSecurity))
+
+	// Inbound headers after the sidecar, to verify header manipulation and trace propagation
+	registry.HandleFunc(routes.Route{
+		Pattern: "/istio-test/headers",
+		Methods: []string{"GET"},
+		Summary: "Inbound request headers, optionally with the mesh headers in a dedicated section",
+		Tags:    []string{"testing"},
+		Parameters: []routes.Parameter{
+			{Name: headers.HighlightParam, In: "query", Description: "Repeat x-envoy-*, x-b3-*, traceparent and x-forwarded-* headers in a highlighted section when true"},
+		},
+		Responses: map[int]routes.Response{
+			http.StatusOK:         {Description: "The request headers as received", Body: headers.Response{}},
+			http.StatusBadRequest: {Description: "Invalid highlight parameter", ContentType: "text/plain"},
+		},
+	}, security.SecureHandlerWithHeaders([]string{"GET"}, headers.Handler, apiSecurity))
+
+	// Multi-hop call chains through allowlisted in-mesh services
+	if len(conf.Proxy.Allowlist) > 0 {
+		// Copies of proxied requests, to compare with Istio's mirror policy
+		var mirror *proxy.Mirror
+		if conf.Proxy.MirrorTarget != "" {
+			var err error
+			mirror, err = proxy.NewMirror(clients.Client(httpclient.ClientMirror), proxy.MirrorOptions{
+				Target:     conf.Proxy.MirrorTarget,
+				SampleRate: conf.Proxy.MirrorSampleRate,
+			})
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Proxy mirror configuration failed: %v\n", err)
+				os.Exit(1)
+			}
+			observability.InfoWithContext(ctx, fmt.Sprintf("Mirroring %.0f%% of proxied requests to %s", conf.Proxy.MirrorSampleRate*100, conf.Proxy.MirrorTarget))
+
+			adminRegistry.HandleFunc(routes.Route{
+				Pattern: "/admin/mirror",
+				Methods: []string{"GET"},
+				Summary: "Delivery statistics of mirrored proxy requests",
+				Tags:    []string{"admin"},
+				Responses: map[int]routes.Response{
+					http.StatusOK: {Description: "Mirrored, delivered, failed and dropped requests", Body: proxy.MirrorStats{}},
+				},
+			}, security.SecureHandlerWithHeaders([]string{"GET"}, mirror.Handler(), defaultSecurity))
+		}
+
+		registry.HandleFunc(routes.Route{
+			Pattern: "/istio-test/proxy",
+			Methods: []string{"GET"},
+			Summary: "Call another in-mesh service and return its response with timing",
+			Tags:    []string{"testing"},
+			Parameters: []routes.Parameter{
+				{Name: "url", In: "query", Description: "Absolute http or https URL of an allowlisted host"},
+				{Name: "host", In: "query", Description: "Host header sent instead of the URL host; must match the outbound override allowlist"},
+				{Name: "sni", In: "query", Description: "TLS server name sent instead of the URL host; must match the outbound override allowlist"},
+			},
+			Responses: map[int]routes.Response{
+				http.StatusOK:           {Description: "Downstream response; the status mirrors the downstream status", Body: proxy.Response{}},
+				http.StatusBadRequest:   {Description: "Missing or invalid url", ContentType: "text/plain"},
+				http.StatusForbidden:    {Description: "Host or override is not allowlisted", ContentType: "text/plain"},
+				http.StatusBadGateway:   {Description: "Downstream call failed without a response", Body: proxy.Response{}},
+				http.StatusLoopDetected: {Description: "Call chain is too long", ContentType: "text/plain"},
+			},
+		}, security.SecureHandlerWithHeaders([]string{"GET"}, proxy.HandlerWithOptions(clients.Client(httpclient.ClientFanout), proxy.Options{
+			Allowlist:         conf.Proxy.Allowlist,
+			OverrideAllowlist: conf.Outbound.OverrideAllowlist,
+			Mirror:            mirror,
+		}), apiSecurity))
+	}
+
+	registry.HandleFunc(routes.Route{
+		Pattern: "/istio-test/identity",
+		Methods: []string{"GET"},
+		Summary: "Show the mTLS peer identity from the X-Forwarded-Client-Cert header",
+		Tags:    []string{"testing"},
+		Responses: map[int]routes.Response{
+			http.StatusOK:         {Description: "Parsed client certificate details, mtls is false without the header", Body: identity.Response{}},
+			http.StatusBadRequest: {Description: "Malformed X-Forwarded-Client-Cert header", ContentType: "text/plain"},
+		},
+	}, security.SecureHandlerWithHeaders([]string{"GET"}, identity.Handler, apiSecurity))
+
+	// What the in-app JWT validation decided, to compare with RequestAuthentication
+	if conf.JWT.Mode != "" {
+		registry.HandleFunc(routes.Route{
+			Pattern: "/istio-test/jwt",
+			Methods: []string{"GET"},
+			Summary: "Result of the in-app JWT validation of the request token",
+			Tags:    []string{"testing"},
+			Responses: map[int]routes.Response{
+				http.StatusOK:           {Description: "Validation result with the principal and claims of a valid token", Body: security.JWTResult{}},
+				http.StatusUnauthorized: {Description: "Invalid token in enforce mode", ContentType: "text/plain"},
+			},
+		}, security.SecureHandlerWithHeaders([]string{"GET"}, security.JWTHandler, apiSecurity))
+	}
+
+	// Deterministic upstream failures for retry, outlier detection and timeout tests;
+	// /istio-test/status/{code} is the httpbin-style name of the same endpoint
+	for _, prefix := range []string{"/istio-test/status/", "/istio-test/fault/status/"} {
+		registry.HandleFunc(routes.Route{
+			Pattern: prefix,
+			Path:    prefix + "{code}",
+			Methods: fault.EndpointMethods,
+			Summary: "Respond with the requested status code, body and headers",
+			Tags:    []string{"fault"},
+			Parameters: []routes.Parameter{
+				{Name: "code", In: "path", Description: "Status code between 200 and 599, or codes picked at random such as 500,503 or 200:0.9,503:0.1"},
+				{Name: fault.StatusBodyParam, In: "query", Description: "Response body, sent as text/plain unless a Content-Type header is requested"},
+				{Name: fault.StatusHeaderParam, In: "query", Description: "Response header as Name:Value, may be repeated"},
+			},
+			Responses: map[int]routes.Response{
+				http.StatusOK:         {Description: "The requested status code and its text, or the requested body", Body: map[string]any{}},
+				http.StatusBadRequest: {Description: "Invalid status code or header", ContentType: "text/plain"},
+			},
+		}, security.SecureHandlerWithHeaders(fault.EndpointMethods, fault.StatusHandler(prefix), apiSecurity))
+	}
+
+	// Controllable body sizes and pacing for buffer limits, size policies and gateway streaming
+	if conf.Payload.MaxBytes > 0 {
+		registry.HandleFunc(routes.Route{
+			Pattern: "/istio-test/bytes/",
+			Path:    "/istio-test/bytes/{n}",
+			Methods: payload.Methods,
+			Summary: "Respond with n bytes, optionally streamed in delayed chunks, with X-Content-SHA256 and X-Content-Length of the body",
+			Tags:    []string{"testing"},
+			Parameters: []routes.Parameter{
+				{Name: "n", In: "path", Description: "Number of bytes in the response body"},
+				{Name: payload.ChunkSizeParam, In: "query", Description: "Bytes per chunk; chunks are flushed one by one without Content-Length"},
+				{Name: payload.DelayParam, In: "query", Description: "Delay between chunks, e.g. 100ms"},
+			},
+			Responses: map[int]routes.Response{
+				http.StatusOK:         {Description: "The requested bytes", ContentType: "application/octet-stream"},
+				http.StatusBadRequest: {Description: "Invalid size, chunk size or delay", ContentType: "text/plain"},
+			},
+		}, security.SecureHandlerWithHeaders(payload.Methods, payload.Handler("/istio-test/bytes/", payload.Options{
+			MaxBytes:    conf.Payload.MaxBytes,
+			MaxDuration: conf.Payload.MaxDuration,
+		}), apiSecurity))
+	}
+
+	// Long-lived event streams for idle timeouts, gateway buffering and flushing
+	if conf.SSE.MaxEvents > 0 {
+		registry.HandleFunc(routes.Route{
+			Pattern: "/istio-test/stream/sse",
+			Methods: []string{"GET"},
+			Summary: "Stream server-sent events at a fixed interval, ending with a done event",
+			Tags:    []string{"testing"},
+			Parameters: []routes.Parameter{
+				{Name: sse.CountParam, In: "query", Description: "Number of tick events, 10 by default"},
+				{Name: sse.IntervalParam, In: "query", Description: "Delay between events, e.g. 500ms; 1s by default"},
+				{Name: "Last-Event-ID", In: "header", Description: "Resume after the tick event with this ID"},
+			},
+			Responses: map[int]routes.Response{
+				http.StatusOK:         {Description: "Tick events followed by a done event", ContentType: "text/event-stream"},
+				http.StatusBadRequest: {Description: "Invalid count, interval or Last-Event-ID", ContentType: "text/plain"},
+			},
+		}, security.SecureHandlerWithHeaders([]string{"GET"}, sse.Handler(sse.Options{
+			MaxCount:    conf.SSE.MaxEvents,
+			MaxDuration: conf.SSE.MaxDuration,
+		}), apiSecurity))
+	}
+
+	registry.HandleFunc(routes.Route{
+		Pattern: "/istio-test/fault/delay/",
+		Path:    "/istio-test/fault/delay/{duration}",
+		Methods: fault.EndpointMethods,
+		Summary: "Respond after the requested delay",
+		Tags:    []string{"fault"},
+		Parameters: []routes.Parameter{
+			{Name: "duration", In: "path", Description: "Go duration such as 2s or 250ms, or a number of seconds"},
+		},
+		Responses: map[int]routes.Response{
+			http.StatusOK:         {Description: "The applied delay", Body: map[string]string{}},
+			http.StatusBadRequest: {Description: "Invalid or too long delay", ContentType: "text/plain"},
+		},
+	}, security.SecureHandlerWithHeaders(fault.EndpointMethods, fault.DelayHandler("/istio-test/fault/delay/", conf.Fault.MaxDelay), apiSecurity))
+
+	registry.HandleFunc(routes.Route{
+		Pattern: "/istio-test/fault/abort",
+		Methods: fault.EndpointMethods,
+		Summary: "Reset the connection without responding",
+		Tags:    []string{"fault"},
+	}, security.SecureHandlerWithHeaders(fault.EndpointMethods, fault.AbortHandler, apiSecurity))
+
+	registry.HandleFunc(routes.Route{
+		Pattern: "/istio-test/version",
+		Methods: []string{"GET"},
+		Summary: "Build information of the running binary",
+		Tags:    []string{"meta"},
+		Responses: map[int]routes.Response{
+			http.StatusOK: {Description: "Version, git commit, build date and Go version", Body: version.Info{}},
+		},
+	}, security.SecureHandlerWithHeaders([]string{"GET"}, version.Handler, apiSecurity))
+
+	registry.HandleFunc(routes.Route{
+		Pattern: "/istio-test/openapi.json",
+		Methods: []string{"GET", "HEAD"},
+		Summary: "OpenAPI description of the registered routes",
+		Tags:    []string{"meta"},
+		Responses: map[int]routes.Response{
+			http.StatusOK: {Description: "OpenAPI 3 document", ContentType: "application/json"},
+		},
+	}, security.SecureHandlerWithHeaders([]string{"GET", "HEAD"}, registry.OpenAPIHandler("istio-test", version.Get().Version), apiSecurity))
 
-	mux := httptrace.NewServeMux()
-	mux.HandleFunc("/istio-test/metadata/", metadata.SecureMetadataHandlerWithOptions(metadataClient.FetchMetadata, apiSecurityOptions))
-	mux.HandleFunc("/istio-test/health", metadata.SecureEnhancedHealthCheckHandlerWithOptions(metadataClient, apiSecurityOptions))
-	mux.HandleFunc("/istio-test/health/basic", metadata.SecureHealthCheckHandlerWithOptions(apiSecurityOptions)) // Keep basic health check for compatibility
-	mux.HandleFunc("/", metadata.SecureNotFoundHandlerWithOptions(defaultSecurityOptions))
+	adminRegistry.HandleFunc(routes.Route{
+		Pattern: "/admin/connections",
+		Methods: []string{"GET"},
+		Summary: "Connection reuse statistics of the outbound clients",
+		Tags:    []string{"admin"},
+		Responses: map[int]routes.Response{
+			http.StatusOK: {Description: "Connection counters per client", Body: map[string]httpclient.ConnStatsSnapshot{}},
+		},
+	}, security.SecureHandlerWithHeaders([]string{"GET"}, httpclient.ConnectionsHandler, defaultSecurity))
+
+	// Knobs that can be tuned mid-experiment; more are registered below as their middleware is built
+	tunableRegistry := tunables.NewRegistry()
+	tunables.Register(tunableRegistry, "log_sample_rate", observability.RequestLogSampleRate, tunables.ValidateRate, observability.SetRequestLogSampleRate)
+	tunables.Register(tunableRegistry, "slow_threshold",
+		func() tunables.Duration { return tunables.Duration(observability.SlowRequestThreshold()) },
+		tunables.ValidatePositive[tunables.Duration],
+		func(d tunables.Duration) { observability.SetSlowRequestThreshold(time.Duration(d)) })
+	adminRegistry.HandleFunc(routes.Route{
+		Pattern:     "/admin/runtime",
+		Methods:     []string{"GET", "PATCH"},
+		Summary:     "Inspect (GET) or change (PATCH) runtime tunables; GET also reports the memory limit and GC target",
+		Tags:        []string{"admin"},
+		RequestBody: map[string]any{},
+		Responses: map[int]routes.Response{
+			http.StatusOK:         {Description: "Runtime memory settings and tunables in effect", Body: tunables.Response{}},
+			http.StatusBadRequest: {Description: "Unknown tunable or invalid value, nothing was changed", ContentType: "text/plain"},
+		},
+	}, security.SecureHandlerWithHeaders([]string{"GET", "PATCH"}, tunableRegistry.Handler(), defaultSecurity))
+
+	// Revision, injection template and proxy version for auditing canary rollouts
+	adminRegistry.HandleFunc(routes.Route{
+		Pattern: "/admin/istio/info",
+		Methods: []string{"GET"},
+		Summary: "Istio revision, injection template and sidecar version of the pod",
+		Tags:    []string{"admin"},
+		Responses: map[int]routes.Response{
+			http.StatusOK: {Description: "Istio information collected from the Downward API and Envoy admin", Body: istioinfo.Info{}},
+		},
+	}, security.SecureHandlerWithHeaders([]string{"GET"}, istioinfo.Handler(clients.Client(httpclient.ClientSidecar), istioinfo.Options{
+		PodInfoDir:    conf.Istio.PodInfoDir,
+		EnvoyAdminURL: conf.Istio.EnvoyAdminURL,
+	}), defaultSecurity))
+
+	// Fault plans flip the pod into bad states on a timetable
+	faultExcludeRoutes := []string{"/admin/", "/debug/", "/metrics", "/istio-test/health/live"}
+	scheduler := fault.NewScheduler(faultExcludeRoutes)
+	adminRegistry.HandleFunc(routes.Route{
+		Pattern:     "/admin/plan",
+		Methods:     []string{"GET", "PUT", "DELETE"},
+		Summary:     "Upload (PUT), inspect (GET) or stop (DELETE) the fault plan",
+		Tags:        []string{"admin"},
+		RequestBody: fault.Plan{},
+		Responses: map[int]routes.Response{
+			http.StatusOK:         {Description: "State of the fault plan", Body: fault.PlanStatus{}},
+			http.StatusBadRequest: {Description: "Invalid plan", ContentType: "text/plain"},
+		},
+	}, security.SecureHandlerWithHeaders([]string{"GET", "PUT", "DELETE"}, scheduler.Handler(), defaultSecurity))
+
+	// Cacheability headers that can be swept at runtime
+	headerPolicy := cache.NewHeaderPolicy()
+	if conf.Cache.HeaderRulesFile != "" {
+		rules, err := cache.LoadHeaderRules(conf.Cache.HeaderRulesFile)
+		if err == nil {
+			err = headerPolicy.Set(rules)
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Cache-Control rules failed: %v\n", err)
+			os.Exit(1)
+		}
+		observability.InfoWithContext(ctx, fmt.Sprintf("Loaded %d Cache-Control rules from %s", len(rules), conf.Cache.HeaderRulesFile))
+	}
+	adminRegistry.HandleFunc(routes.Route{
+		Pattern:     "/admin/cache-control",
+		Methods:     []string{"GET", "PUT", "DELETE"},
+		Summary:     "Replace (PUT), inspect (GET) or remove (DELETE) the Cache-Control rules",
+		Tags:        []string{"admin"},
+		RequestBody: cache.HeaderRules{},
+		Responses: map[int]routes.Response{
+			http.StatusOK:         {Description: "Active Cache-Control rules", Body: cache.HeaderRules{}},
+			http.StatusBadRequest: {Description: "Invalid rules", ContentType: "text/plain"},
+		},
+	}, security.SecureHandlerWithHeaders([]string{"GET", "PUT", "DELETE"}, headerPolicy.Handler(), defaultSecurity))
+
+	// Origin-side response transformations, contrasted with sidecar filters in A/B runs
+	transforms := transform.NewPipeline()
+	if conf.Transform.RulesFile != "" {
+		rules, err := transform.LoadRules(conf.Transform.RulesFile)
+		if err == nil {
+			err = transforms.Set(rules)
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Response transform rules failed: %v\n", err)
+			os.Exit(1)
+		}
+		observability.InfoWithContext(ctx, fmt.Sprintf("Loaded %d response transform rules from %s", len(rules), conf.Transform.RulesFile))
+	}
+	adminRegistry.HandleFunc(routes.Route{
+		Pattern:     "/admin/transforms",
+		Methods:     []string{"GET", "PUT", "DELETE"},
+		Summary:     "Replace (PUT), inspect (GET) or remove (DELETE) the response transformation rules",
+		Tags:        []string{"admin"},
+		RequestBody: transform.Rules{},
+		Responses: map[int]routes.Response{
+			http.StatusOK:         {Description: "Active transformation rules", Body: transform.Rules{}},
+			http.StatusBadRequest: {Description: "Invalid rules", ContentType: "text/plain"},
+		},
+	}, security.SecureHandlerWithHeaders([]string{"GET", "PUT", "DELETE"}, transforms.Handler(), defaultSecurity))
+
+	// Profiling endpoints only accept short-lived tokens minted by /admin/pprof/token,
+	// which always requires the admin token
+	if conf.Pprof.Enabled {
+		if adminAuth == nil {
+			fmt.Fprintln(os.Stderr, "Profiling requires an admin token (ADMIN_AUTH_TOKEN or ADMIN_AUTH_TOKEN_FILE)")
+			os.Exit(1)
+		}
+		signer, err := security.NewTokenSigner([]byte(conf.Pprof.TokenSecret))
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Profiling token signer failed: %v\n", err)
+			os.Exit(1)
+		}
+
+		adminRegistry.HandleFunc(routes.Route{
+			Pattern:     "/admin/pprof/token",
+			Methods:     []string{"POST"},
+			Summary:     "Mint a short-lived token for a profiling endpoint",
+			Tags:        []string{"admin"},
+			RequestBody: profiling.TokenRequest{},
+			Responses: map[int]routes.Response{
+				http.StatusOK:           {Description: "Signed token and the URL it grants", Body: profiling.TokenResponse{}},
+				http.StatusBadRequest:   {Description: "Invalid scope or TTL", ContentType: "text/plain"},
+				http.StatusUnauthorized: {Description: "Missing or invalid admin token", ContentType: "text/plain"},
+			},
+		}, security.SecureHandlerWithHeaders([]string{"POST"}, adminAuth.Require(profiling.TokenHandler(signer, conf.Pprof.MaxTokenTTL)).ServeHTTP, defaultSecurity))
+
+		adminRegistry.HandleFunc(routes.Route{
+			Pattern: profiling.Prefix,
+			Path:    profiling.Prefix + "{profile}",
+			Methods: []string{"GET"},
+			Summary: "Go runtime profiles, requires a token for the profile",
+			Tags:    []string{"admin"},
+			Parameters: []routes.Parameter{
+				{Name: "profile", In: "path", Description: "Profile name such as heap, goroutine or profile, empty for the index"},
+				{Name: "token", In: "query", Description: "Token minted by /admin/pprof/token, alternatively sent as a bearer token"},
+			},
+			Responses: map[int]routes.Response{
+				http.StatusOK:           {Description: "Profile data", ContentType: "application/octet-stream"},
+				http.StatusUnauthorized: {Description: "Missing, invalid or expired token", ContentType: "text/plain"},
+				http.StatusForbidden:    {Description: "Token was minted for another profile", ContentType: "text/plain"},
+			},
+		}, security.SecureHandlerWithHeaders([]string{"GET"}, profiling.Handler(signer), defaultSecurity))
+		observability.InfoWithContext(ctx, "Profiling endpoints enabled at "+profiling.Prefix)
+	}
+
+	if conf.Observability.EnableMetrics {
+		adminRegistry.HandleFunc(routes.Route{
+			Pattern: "/metrics",
+			Methods: []string{"GET"},
+			Summary: "Prometheus metrics",
+			Tags:    []string{"meta"},
+			Responses: map[int]routes.Response{
+				http.StatusOK: {Description: "Metrics in the Prometheus text exposition format", ContentType: "text/plain"},
+			},
+		}, security.SecureHandlerWithHeaders([]string{"GET"}, observability.MetricsHandler().ServeHTTP, defaultSecurity))
+	}
+
+	adminRegistry.HandleFunc(routes.Route{
+		Pattern: "/admin/config",
+		Methods: []string{"GET"},
+		Summary: "Effective configuration with secrets left out",
+		Tags:    []string{"admin"},
+		Responses: map[int]routes.Response{
+			http.StatusOK: {Description: "Configuration loaded at startup", Body: config.Config{}},
+		},
+	}, security.SecureHandlerWithHeaders([]string{"GET"}, conf.Handler(), defaultSecurity))
+
+	// Report ConfigMap changes the pod has not been restarted to pick up
+	var configReloader *configreload.Reloader
+	if conf.Drift.Dir != "" {
+		driftDetector := configdrift.NewDetector(conf.Drift.Dir, conf.Drift.Interval)
+		driftCtx, stopDriftDetector := context.WithCancel(ctx)
+		defer stopDriftDetector()
+		goroutines.Go(driftCtx, "drift", driftDetector.Run)
+
+		// Apply the reload-safe keys on SIGHUP or when the ConfigMap changes;
+		// middleware enabled while serving registers its own keys below
+		if conf.Drift.Reload {
+			configReloader = configreload.New(conf.Drift.Dir, conf.Drift.Interval)
+			configReloader.OnApply(driftDetector.Applied)
+			configReloader.Register(func(c *config.Config) error {
+				return observability.SetLogLevel(c.Observability.LogLevel, 0)
+			}, "LOG_LEVEL")
+			configReloader.Register(func(c *config.Config) error {
+				observability.SetRequestLogSampleRate(c.Observability.RequestLogSampleRate)
+				if c.Observability.SlowRequestThreshold > 0 {
+					observability.SetSlowRequestThreshold(c.Observability.SlowRequestThreshold)
+				}
+				return nil
+			}, "REQUEST_LOG_SAMPLE_RATE", "SLOW_REQUEST_THRESHOLD")
+			configReloader.Register(func(c *config.Config) error {
+				api, def := securityOptions(c)
+				apiSecurity.Set(api)
+				defaultSecurity.Set(def)
+				return nil
+			}, "SECURITY_API_COEP", "SECURITY_API_COOP", "SECURITY_API_CORP",
+				"SECURITY_DEFAULT_COEP", "SECURITY_DEFAULT_COOP", "SECURITY_DEFAULT_CORP",
+				"SECURITY_HSTS_MAX_AGE", "SECURITY_HSTS_INCLUDE_SUBDOMAINS", "SECURITY_HSTS_PRELOAD",
+				"SECURITY_PERMISSIONS_POLICY")
+
+			adminRegistry.HandleFunc(routes.Route{
+				Pattern: "/admin/config/reload",
+				Methods: []string{"GET", "POST"},
+				Summary: "Latest configuration reload; POST reloads the mounted ConfigMap now",
+				Tags:    []string{"admin"},
+				Responses: map[int]routes.Response{
+					http.StatusOK:                  {Description: "Result of the reload", Body: configreload.Result{}},
+					http.StatusUnprocessableEntity: {Description: "Reloaded configuration rejected, nothing applied", Body: configreload.Result{}},
+				},
+			}, security.SecureHandlerWithHeaders([]string{"GET", "POST"}, configReloader.Handler(), defaultSecurity))
+		}
+
+		adminRegistry.HandleFunc(routes.Route{
+			Pattern: "/admin/config/drift",
+			Methods: []string{"GET"},
+			Summary: "Configuration keys whose mounted value differs from the value loaded at startup",
+			Tags:    []string{"admin"},
+			Responses: map[int]routes.Response{
+				http.StatusOK: {Description: "Latest drift check", Body: configdrift.Report{}},
+			},
+		}, security.SecureHandlerWithHeaders([]string{"GET"}, driftDetector.Handler(), defaultSecurity))
+	}
+
+	// Let CI drain or stop the pod the way it would Envoy, without touching liveness
+	lifecycle := drain.NewController(conf.Server.LifecycleToken)
+	if conf.Server.LifecycleEndpoints {
+		unauthorized := routes.Response{Description: "Lifecycle token missing or wrong", ContentType: "text/plain"}
+		adminRegistry.HandleFunc(routes.Route{
+			Pattern: "/drain",
+			Methods: []string{"POST"},
+			Summary: "Start draining: fail readiness and close connections after their request, while serving",
+			Tags:    []string{"admin"},
+			Responses: map[int]routes.Response{
+				http.StatusOK:           {Description: "Draining", ContentType: "text/plain"},
+				http.StatusUnauthorized: unauthorized,
+			},
+		}, security.SecureHandlerWithHeaders([]string{"POST"}, lifecycle.DrainHandler(), defaultSecurity))
+
+		adminRegistry.HandleFunc(routes.Route{
+			Pattern: "/quitquitquit",
+			Methods: []string{"POST"},
+			Summary: "Shut down gracefully now, skipping the drain delay",
+			Tags:    []string{"admin"},
+			Responses: map[int]routes.Response{
+				http.StatusOK:           {Description: "Shutting down", ContentType: "text/plain"},
+				http.StatusUnauthorized: unauthorized,
+			},
+		}, security.SecureHandlerWithHeaders([]string{"POST"}, lifecycle.QuitHandler(), defaultSecurity))
+	}
+
+	// Raw request framing is inspected on the plain HTTP listener, where the sidecar forwards traffic
+	var framingRecorder *framing.Recorder
+	if conf.Server.FramingDiagnostics {
+		framingRecorder = framing.NewRecorder()
+		adminRegistry.HandleFunc(routes.Route{
+			Pattern: "/admin/anomalies",
+			Methods: []string{"GET"},
+			Summary: "Framing anomalies observed in raw requests: bare CR/LF, duplicate Content-Length, Transfer-Encoding oddities",
+			Tags:    []string{"admin"},
+			Responses: map[int]routes.Response{
+				http.StatusOK: {Description: "Anomaly counts and latest anomalous requests", Body: framing.Report{}},
+			},
+		}, security.SecureHandlerWithHeaders([]string{"GET"}, framingRecorder.Handler(), defaultSecurity))
+	}
+
+	// Pods and load generators line up here before a coordinated test starts
+	coordinator := coordination.NewCoordinator(conf.Coordination.MaxWait)
+	adminRegistry.HandleFunc(routes.Route{
+		Pattern:      "/admin/coordination/barrier",
+		Methods:      []string{"GET", "POST", "DELETE"},
+		Summary:      "Wait (POST) until N participants registered at a barrier, list (GET) or abort (DELETE ?name=) barriers",
+		Tags:         []string{"admin"},
+		RequestBody:  coordination.Request{},
+		ContentTypes: []string{"application/json"},
+		Responses: map[int]routes.Response{
+			http.StatusOK:             {Description: "Barrier released, or the barriers on GET", Body: coordination.Status{}},
+			http.StatusBadRequest:     {Description: "Invalid registration", ContentType: "text/plain"},
+			http.StatusRequestTimeout: {Description: "Barrier not released within the timeout", ContentType: "text/plain"},
+			http.StatusConflict:       {Description: "Participant count differs from the barrier, or the barrier was released without the caller", ContentType: "text/plain"},
+			http.StatusGone:           {Description: "Barrier aborted", ContentType: "text/plain"},
+		},
+	}, security.SecureHandlerWithHeaders([]string{"GET", "POST", "DELETE"}, coordinator.Handler(), defaultSecurity))
+
+	// Debug logs can be enabled temporarily without a restart changing the behavior under observation
+	adminRegistry.HandleFunc(routes.Route{
+		Pattern:     "/admin/loglevel",
+		Methods:     []string{"GET", "PUT"},
+		Summary:     "Inspect (GET) or change (PUT) the log level, optionally for a limited time",
+		Tags:        []string{"admin"},
+		RequestBody: observability.LogLevelRequest{},
+		Responses: map[int]routes.Response{
+			http.StatusOK:         {Description: "Log level in effect and any pending restore", Body: observability.LogLevelResponse{}},
+			http.StatusBadRequest: {Description: "Invalid level or ttl", ContentType: "text/plain"},
+		},
+	}, security.SecureHandlerWithHeaders([]string{"GET", "PUT"}, observability.LogLevelHandler, defaultSecurity))
+
+	// Long-lived connections are listed and can be force-closed to observe
+	// Envoy idle timeouts and drain behavior
+	streamRegistry := streams.NewRegistry()
+	adminRegistry.HandleFunc(routes.Route{
+		Pattern: "/admin/streams",
+		Methods: []string{"GET", "DELETE"},
+		Summary: "List (GET) or force-close (DELETE ?id=, ?kind= or ?all=true) open WebSocket, SSE and streaming connections",
+		Tags:    []string{"admin"},
+		Parameters: []routes.Parameter{
+			{Name: "id", In: "query", Description: "ID of the stream to close"},
+			{Name: "kind", In: "query", Description: "Close every stream of this kind", Enum: []string{streams.KindWebSocket, streams.KindSSE, streams.KindStream}},
+			{Name: "all", In: "query", Description: "Close every stream"},
+		},
+		Responses: map[int]routes.Response{
+			http.StatusOK:         {Description: "Open streams, after closing any requested", Body: streams.Response{}},
+			http.StatusBadRequest: {Description: "Missing or invalid parameter", ContentType: "text/plain"},
+			http.StatusNotFound:   {Description: "No open stream with this ID", ContentType: "text/plain"},
+		},
+	}, security.SecureHandlerWithHeaders([]string{"GET", "DELETE"}, streamRegistry.Handler(), defaultSecurity))
+
+	// One download captures the state needed to debug a misbehaving pod
+	supportBundle := support.NewBundle(support.DefaultSourceTimeout)
+	supportBundle.Add("config.json", support.Value(func() *config.Config { return conf }))
+	supportBundle.Add("requests.json", support.Value(observability.RecentRequests))
+	supportBundle.Add("health.json", support.Value(func() any {
+		return map[string]any{"checks": healthChecker.Results(), "history": healthChecker.History(), "transitions": healthChecker.Transitions()}
+	}))
+	supportBundle.Add("runtime.json", support.Value(support.CurrentRuntimeStats))
+	supportBundle.Add("goroutines.txt", support.GoroutineDump)
+	supportBundle.Add("streams.json", support.Value(streamRegistry.List))
+	supportBundle.Add("istio.json", support.JSON(func(ctx context.Context) (istioinfo.Info, error) {
+		return istioinfo.Collect(ctx, clients.Client(httpclient.ClientSidecar), istioinfo.Options{
+			PodInfoDir:    conf.Istio.PodInfoDir,
+			EnvoyAdminURL: conf.Istio.EnvoyAdminURL,
+		}), nil
+	}))
+	if conf.Istio.EnvoyAdminURL != "" {
+		supportBundle.Add("sidecar-sync.json", support.JSON(func(ctx context.Context) (*istioinfo.SyncStatus, error) {
+			return istioinfo.FetchSyncStatus(ctx, clients.Client(httpclient.ClientSidecar), conf.Istio.EnvoyAdminURL)
+		}))
+	}
+	adminRegistry.HandleFunc(routes.Route{
+		Pattern: "/admin/support-bundle",
+		Methods: []string{"GET"},
+		Summary: "Gzip tarball of the configuration, recent requests, health history, runtime stats, goroutine dump and sidecar sync status",
+		Tags:    []string{"admin"},
+		Responses: map[int]routes.Response{
+			http.StatusOK:                  {Description: "Support bundle; manifest.json lists the files and any source that failed", ContentType: "application/gzip"},
+			http.StatusInternalServerError: {Description: "Bundle could not be assembled", ContentType: "text/plain"},
+		},
+	}, security.SecureHandlerWithHeaders([]string{"GET"}, supportBundle.Handler(), defaultSecurity))
+
+	mux.HandleFunc("/", notFound)
+
+	// Rewrite cacheability headers before responses reach the response cache;
+	// transformations run first so cached responses are already transformed
+	var handler http.Handler = headerPolicy.Middleware(transforms.Middleware(mux))
+	if conf.Cache.Enabled {
+		responseCache := cache.New(cache.Options{
+			Routes:     conf.Cache.Routes,
+			TTL:        conf.Cache.TTL,
+			MaxEntries: conf.Cache.MaxEntries,
+		})
+		handler = responseCache.Middleware(handler)
+		observability.InfoWithContext(ctx, fmt.Sprintf("Response cache enabled for %v with TTL %v", conf.Cache.Routes, conf.Cache.TTL))
+	}
+
+	// Compress outside the cache, so cached entries serve every Accept-Encoding
+	if conf.Compression.Enabled {
+		handler = compress.Middleware(handler, compress.Options{
+			MinSize:      conf.Compression.MinSize,
+			ContentTypes: conf.Compression.ContentTypes,
+		})
+		observability.InfoWithContext(ctx, fmt.Sprintf("Response compression enabled for bodies of at least %d bytes", conf.Compression.MinSize))
+	}
+
+	// Answer preflights before routes reject OPTIONS, and add CORS headers per origin outside the cache
+	if len(conf.CORS.AllowedOrigins) > 0 {
+		handler = security.CORSMiddleware(handler, security.CORSOptions{
+			AllowedOrigins:   conf.CORS.AllowedOrigins,
+			AllowedMethods:   conf.CORS.AllowedMethods,
+			AllowedHeaders:   conf.CORS.AllowedHeaders,
+			ExposedHeaders:   conf.CORS.ExposedHeaders,
+			AllowCredentials: conf.CORS.AllowCredentials,
+			MaxAge:           conf.CORS.MaxAge,
+		})
+		observability.InfoWithContext(ctx, fmt.Sprintf("CORS enabled for origins %v", conf.CORS.AllowedOrigins))
+	}
+
+	// Degrade requests when the pod runs in one of the configured zones
+	if len(conf.Fault.ZoneSkewZones) > 0 {
+		zone := conf.Fault.Zone
+		if zone == "" {
+			zone = detectZone(ctx, metadataClient)
+		}
+		if fault.MatchesZone(conf.Fault.ZoneSkewZones, zone) {
+			observability.InfoWithContext(ctx, fmt.Sprintf("Zone skew active in zone %s: latency %v, error rate %.2f (status %d)",
+				zone, conf.Fault.ZoneSkewLatency, conf.Fault.ZoneSkewErrorRate, conf.Fault.ZoneSkewErrorStatus))
+		}
+		zoneSkew := fault.NewZoneSkew(zone, fault.ZoneSkewOptions{
+			Zones: conf.Fault.ZoneSkewZones,
+			Fault: fault.Fault{
+				Latency:     conf.Fault.ZoneSkewLatency,
+				ErrorRate:   conf.Fault.ZoneSkewErrorRate,
+				ErrorStatus: conf.Fault.ZoneSkewErrorStatus,
+			},
+			Routes:        conf.Fault.ZoneSkewRoutes,
+			ExcludeRoutes: conf.Fault.ZoneSkewExcludeRoutes,
+		})
+		if zoneSkew.Active() {
+			tunables.Register(tunableRegistry, "fault_error_rate", zoneSkew.ErrorRate, tunables.ValidateRate, zoneSkew.SetErrorRate)
+			if configReloader != nil {
+				configReloader.Register(func(c *config.Config) error {
+					zoneSkew.SetFault(fault.Fault{
+						Latency:     c.Fault.ZoneSkewLatency,
+						ErrorRate:   c.Fault.ZoneSkewErrorRate,
+						ErrorStatus: c.Fault.ZoneSkewErrorStatus,
+					})
+					return nil
+				}, "FAULT_ZONE_SKEW_LATENCY", "FAULT_ZONE_SKEW_ERROR_RATE", "FAULT_ZONE_SKEW_ERROR_STATUS")
+			}
+		}
+		handler = zoneSkew.Middleware(handler)
+	}
+
+	// Make every pod a jittery upstream for retry budget and outlier detection experiments
+	if conf.Fault.ChaosEnabled {
+		chaos := fault.NewChaos(fault.ChaosOptions{
+			ErrorRate:     conf.Fault.ChaosErrorRate,
+			ErrorStatuses: conf.Fault.ChaosErrorStatuses,
+			LatencyRate:   conf.Fault.ChaosLatencyRate,
+			LatencyP50:    conf.Fault.ChaosLatencyP50,
+			LatencyP99:    conf.Fault.ChaosLatencyP99,
+			MaxLatency:    conf.Fault.MaxDelay,
+			Routes:        conf.Fault.ChaosRoutes,
+			ExcludeRoutes: conf.Fault.ChaosExcludeRoutes,
+		})
+		observability.WarnWithFields(ctx, fmt.Sprintf("Chaos mode enabled: error rate %.2f (statuses %v), latency p50 %v p99 %v on %.0f%% of requests",
+			conf.Fault.ChaosErrorRate, conf.Fault.ChaosErrorStatuses, conf.Fault.ChaosLatencyP50, conf.Fault.ChaosLatencyP99, conf.Fault.ChaosLatencyRate*100), map[string]any{
+			"type": "chaos_enabled",
+		})
+		tunables.Register(tunableRegistry, "chaos_error_rate", chaos.ErrorRate, tunables.ValidateRate, chaos.SetErrorRate)
+		if configReloader != nil {
+			configReloader.Register(func(c *config.Config) error {
+				chaos.SetErrorRate(c.Fault.ChaosErrorRate)
+				return nil
+			}, "CHAOS_ERROR_RATE")
+		}
+		handler = chaos.Middleware(handler)
+	}
+
+	handler = scheduler.Middleware(handler)
+
+	// Clients ask for latency per request with X-Istio-Test-Delay or ?delay=
+	if conf.Fault.RequestDelay {
+		handler = fault.NewRequestDelay(conf.Fault.MaxDelay, faultExcludeRoutes).Middleware(handler)
+	}
+
+	// Derive request deadlines from Envoy and gRPC timeout headers
+	handler = deadline.Middleware(handler)
+
+	if adminAuth != nil {
+		handler = adminAuth.Middleware(handler)
+	}
+
+	// In-app JWT validation, for comparison with Istio's RequestAuthentication
+	if conf.JWT.Mode != "" {
+		jwtValidator := security.NewJWTValidator(clients.Client(httpclient.ClientJWKS), security.JWTOptions{
+			Mode:          conf.JWT.Mode,
+			JWKSURL:       conf.JWT.JWKSURL,
+			Issuer:        conf.JWT.Issuer,
+			Audiences:     conf.JWT.Audiences,
+			JWKSRefresh:   conf.JWT.JWKSRefresh,
+			ExcludeRoutes: conf.JWT.ExcludeRoutes,
+		})
+		handler = jwtValidator.Middleware(handler)
+		observability.InfoWithContext(ctx, fmt.Sprintf("JWT validation enabled: %s, issuer %s, JWKS %s", conf.JWT.Mode, conf.JWT.Issuer, conf.JWT.JWKSURL))
+	}
+
+	// In-app rate limiting, for comparison with Istio's local rate limit filter
+	if conf.RateLimit.RPS > 0 {
+		limiter := security.NewRateLimiter(security.RateLimitOptions{
+			RPS:           conf.RateLimit.RPS,
+			Burst:         conf.RateLimit.Burst,
+			PerClientIP:   conf.RateLimit.PerClientIP,
+			TrustedHops:   conf.RateLimit.TrustedHops,
+			ExcludeRoutes: conf.RateLimit.ExcludeRoutes,
+		})
+		tunables.Register(tunableRegistry, "rate_limit_rps",
+			func() float64 { rps, _ := limiter.Limit(); return rps },
+			tunables.ValidatePositive[float64],
+			func(rps float64) { _, burst := limiter.Limit(); limiter.SetLimit(rps, burst) })
+		tunables.Register(tunableRegistry, "rate_limit_burst",
+			func() int { _, burst := limiter.Limit(); return burst },
+			tunables.ValidatePositive[int],
+			func(burst int) { rps, _ := limiter.Limit(); limiter.SetLimit(rps, burst) })
+		if configReloader != nil {
+			configReloader.Register(func(c *config.Config) error {
+				if c.RateLimit.RPS <= 0 {
+					return fmt.Errorf("rate limiting cannot be turned off while serving")
+				}
+				limiter.SetLimit(c.RateLimit.RPS, c.RateLimit.Burst)
+				return nil
+			}, "RATE_LIMIT_RPS", "RATE_LIMIT_BURST")
+		}
+		handler = limiter.Middleware(handler)
+		observability.InfoWithContext(ctx, fmt.Sprintf("Rate limiting enabled: %.2f RPS, burst %d, per client IP: %t",
+			conf.RateLimit.RPS, conf.RateLimit.Burst, conf.RateLimit.PerClientIP))
+	}
+
+	// In-app concurrency limiting, fixed or adaptive for comparison with Envoy's adaptive concurrency filter
+	if conf.ConcurrencyLimit.Mode != "" {
+		concurrencyLimiter := security.NewConcurrencyLimiter(security.ConcurrencyLimitOptions{
+			Mode:          conf.ConcurrencyLimit.Mode,
+			Limit:         conf.ConcurrencyLimit.Limit,
+			MinLimit:      conf.ConcurrencyLimit.MinLimit,
+			MaxLimit:      conf.ConcurrencyLimit.MaxLimit,
+			ExcludeRoutes: conf.ConcurrencyLimit.ExcludeRoutes,
+			QueueSize:     conf.ConcurrencyLimit.QueueSize,
+			QueueTimeout:  conf.ConcurrencyLimit.QueueTimeout,
+			RetryAfter:    conf.ConcurrencyLimit.RetryAfter,
+		})
+		tunables.Register(tunableRegistry, "concurrency_limit", concurrencyLimiter.Limit, tunables.ValidatePositive[int], concurrencyLimiter.SetLimit)
+		handler = concurrencyLimiter.Middleware(handler)
+		observability.InfoWithContext(ctx, fmt.Sprintf("Concurrency limiting enabled: %s, limit %d, queue %d for up to %v",
+			conf.ConcurrencyLimit.Mode, conf.ConcurrencyLimit.Limit, conf.ConcurrencyLimit.QueueSize, conf.ConcurrencyLimit.QueueTimeout))
+	}
+
+	// Metrics and spans are labeled by the matched route pattern to bound cardinality
+	routePattern := func(r *http.Request) string {
+		_, pattern := mux.Handler(r)
+		return pattern
+	}
+
+	// Record RED and request header metrics
+	if conf.Observability.EnableMetrics {
+		handler = observability.HeaderMetricsMiddleware(handler, routePattern, observability.HeaderThresholds{
+			Bytes: conf.Observability.HeaderBytesThreshold,
+			Count: conf.Observability.HeaderCountThreshold,
+		})
+		handler = observability.MetricsMiddleware(handler, routePattern)
+	}
+
+	// Attribute CPU time and allocations to routes to spot the ones that got expensive
+	if conf.Observability.EnableCostAccounting {
+		handler = observability.CostMiddleware(handler, routePattern)
+	}
+
+	// Watch for OOM risk, goroutine explosions and blocked writers; log panics with their stack
+	if conf.Watchdog.Enabled {
+		wd := watchdog.New(watchdog.Options{
+			Interval:            conf.Watchdog.Interval,
+			MemoryWarningRatio:  conf.Watchdog.MemoryWarningRatio,
+			MemoryCriticalRatio: conf.Watchdog.MemoryCriticalRatio,
+			HeapGrowthWarning:   conf.Watchdog.HeapGrowthWarning,
+			GoroutineWarning:    conf.Watchdog.GoroutineWarning,
+			GoroutineCritical:   conf.Watchdog.GoroutineCritical,
+			BlockedWriteWarning: conf.Watchdog.BlockedWriteWarning,
+			ProfileDir:          conf.Watchdog.ProfileDir,
+			ProfileCooldown:     conf.Watchdog.ProfileCooldown,
+		})
+		handler = wd.Middleware(handler)
+		goroutines.Go(ctx, "watchdog", wd.Run)
+		observability.InfoWithContext(ctx, fmt.Sprintf("Watchdog enabled, memory limit %d bytes", wd.MemoryLimit()))
+	}
+
+	// Every reload-safe setting is registered, start reloading
+	if configReloader != nil {
+		goroutines.Go(ctx, "configreload", configReloader.Run)
+		observability.InfoWithContext(ctx, fmt.Sprintf("Configuration reload enabled from %s on SIGHUP or change", conf.Drift.Dir))
+	}
 
 	// Wrap the entire mux with request logging middleware
-	loggedHandler := observability.RequestLoggingMiddleware(mux)
+	loggedHandler := observability.RequestLoggingMiddleware(handler)
+
+	// Start server spans outside request logging so its entries carry the
+	// trace, and name the trace in every response so clients go from a
+	// response straight to it. Server spans carry the test run ID as a tag.
+	traced := func(next http.Handler, pathLabel func(r *http.Request) string) http.Handler {
+		if !conf.Observability.EnableTracing {
+			return next
+		}
+		next = observability.TraceHeadersMiddleware(next.ServeHTTP)
+		if observability.OTelTracing() {
+			return observability.OTelMiddleware(next, pathLabel)
+		}
+		return httptrace.WrapHandler(next, "", "",
+			httptrace.WithHeaderTags([]string{
+				testrun.Header + ":" + observability.TestRunTag,
+				tenant.Header + ":" + observability.TenantTag,
+			}),
+			httptrace.WithResourceNamer(func(r *http.Request) string { return r.Method + " " + pathLabel(r) }))
+	}
+	loggedHandler = traced(loggedHandler, routePattern)
+
+	// Carry the test run ID through logs, metrics and outbound calls
+	loggedHandler = testrun.Middleware(loggedHandler)
+
+	// Attribute requests to the tenant found by the configured rule
+	if conf.Tenant.Source != "" {
+		loggedHandler = tenant.Middleware(tenant.Rule{Source: conf.Tenant.Source, Key: conf.Tenant.Key}, loggedHandler)
+		observability.InfoWithContext(ctx, fmt.Sprintf("Tenant attribution enabled: %s %s", conf.Tenant.Source, conf.Tenant.Key))
+	}
+
+	// Track WebSockets and event streams while they are open
+	loggedHandler = streamRegistry.Middleware(loggedHandler)
+
+	// Track in-flight requests so shutdown can report what it drained
+	inFlight := drain.NewTracker()
+	loggedHandler = inFlight.Middleware(loggedHandler)
 
 	server := &http.Server{
 		Addr:         ":" + conf.Server.Port,
@@ -99,23 +1448,349 @@ func main() {
 		Handler:      loggedHandler,
 	}
 
-	go func() {
+	// Speak cleartext HTTP/2 as well, for protocol sniffing and upstream HTTP/2 tests
+	if conf.Server.EnableH2C {
+		h2Server := &http2.Server{IdleTimeout: conf.Server.IdleTimeout}
+		// Registers the HTTP/2 server for shutdown: h2c connections are
+		// hijacked, so Shutdown only reaches them through a GOAWAY
+		if err := http2.ConfigureServer(server, h2Server); err != nil {
+			fmt.Fprintf(os.Stderr, "HTTP/2 configuration failed: %v\n", err)
+			os.Exit(1)
+		}
+		server.Handler = h2c.NewHandler(loggedHandler, h2Server)
+		observability.InfoWithContext(ctx, "h2c enabled: HTTP/2 is served without TLS next to HTTP/1.1")
+	}
+
+	// Connection goroutines inherit the label of the server that accepted them
+	goroutines.Go(ctx, "http", func(ctx context.Context) {
 		observability.InfoWithContext(ctx, fmt.Sprintf("Starting server on port %s...", conf.Server.Port))
-		if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+		lis, err := net.Listen("tcp", server.Addr)
+		if err != nil {
+			observability.ErrorWithContext(ctx, fmt.Sprintf("Failed to start server: %v", err))
+			return
+		}
+		if framingRecorder != nil {
+			lis = framingRecorder.Listener(lis)
+		}
+		if err := server.Serve(lis); err != nil && err != http.ErrServerClosed {
 			observability.ErrorWithContext(ctx, fmt.Sprintf("Failed to start server: %v", err))
 		}
-	}()
+	})
+
+	// Terminate TLS in the app as well, to compare with sidecar TLS termination
+	var tlsServer *http.Server
+	reloadCtx, stopReload := context.WithCancel(ctx)
+	defer stopReload()
+	if conf.Server.TLSCertFile != "" {
+		certs, err := certreload.New(conf.Server.TLSCertFile, conf.Server.TLSKeyFile)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Server TLS configuration failed: %v\n", err)
+			os.Exit(1)
+		}
+		goroutines.Go(reloadCtx, "certreload", func(ctx context.Context) { certs.Run(ctx, conf.Server.TLSReloadInterval) })
+
+		tlsServer = &http.Server{
+			Addr:         ":" + conf.Server.TLSPort,
+			ReadTimeout:  conf.Server.ReadTimeout,
+			WriteTimeout: conf.Server.WriteTimeout,
+			IdleTimeout:  conf.Server.IdleTimeout,
+			Handler:      loggedHandler,
+			TLSConfig:    certs.TLSConfig(),
+		}
+		goroutines.Go(ctx, "https", func(ctx context.Context) {
+			observability.InfoWithContext(ctx, fmt.Sprintf("Starting TLS server on port %s...", conf.Server.TLSPort))
+			if err := tlsServer.ListenAndServeTLS("", ""); err != nil && err != http.ErrServerClosed {
+				observability.ErrorWithContext(ctx, fmt.Sprintf("Failed to start TLS server: %v", err))
+			}
+		})
+	}
+
+	var adminServer *http.Server
+	if adminMux != nil {
+		adminMux.HandleFunc("/", security.SecurityMiddlewareFuncWithHeaders(metadata.NotFoundHandler, defaultSecurity))
+		var adminHandler http.Handler = adminMux
+		if adminAuth != nil {
+			adminHandler = adminAuth.Middleware(adminHandler)
+		}
+		adminPattern := func(r *http.Request) string {
+			_, pattern := adminMux.Handler(r)
+			return pattern
+		}
+		adminServer = &http.Server{
+			Addr:         ":" + conf.Server.AdminPort,
+			ReadTimeout:  conf.Server.ReadTimeout,
+			WriteTimeout: conf.Server.WriteTimeout,
+			IdleTimeout:  conf.Server.IdleTimeout,
+			Handler:      traced(observability.RequestLoggingMiddleware(adminHandler), adminPattern),
+		}
+		goroutines.Go(ctx, "admin", func(ctx context.Context) {
+			observability.InfoWithContext(ctx, fmt.Sprintf("Starting admin server on port %s...", conf.Server.AdminPort))
+			if err := adminServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+				observability.ErrorWithContext(ctx, fmt.Sprintf("Failed to start admin server: %v", err))
+			}
+		})
+	}
+
+	var grpcServer *grpcserver.Server
+	if conf.Server.GRPCPort != "" {
+		grpcServer = grpcserver.New(metadataFetcher.FetchMetadata)
+		goroutines.Go(ctx, "grpc", func(ctx context.Context) {
+			observability.InfoWithContext(ctx, fmt.Sprintf("Starting gRPC server on port %s...", conf.Server.GRPCPort))
+			lis, err := net.Listen("tcp", ":"+conf.Server.GRPCPort)
+			if err != nil {
+				observability.ErrorWithContext(ctx, fmt.Sprintf("Failed to listen for gRPC: %v", err))
+				return
+			}
+			if err := grpcServer.Serve(lis); err != nil {
+				observability.ErrorWithContext(ctx, fmt.Sprintf("Failed to start gRPC server: %v", err))
+			}
+		})
+	}
+
+	// Raw TCP echo for TCP routing and mTLS on ports the mesh treats as opaque
+	var tcpEchoServer *tcpecho.Server
+	if conf.Server.TCPEchoPort != "" {
+		tcpEchoServer = tcpecho.New(tcpecho.Options{IdleTimeout: conf.Server.TCPEchoIdleTimeout})
+		goroutines.Go(ctx, "tcpecho", func(ctx context.Context) {
+			observability.InfoWithContext(ctx, fmt.Sprintf("Starting TCP echo listener on port %s...", conf.Server.TCPEchoPort))
+			lis, err := net.Listen("tcp", ":"+conf.Server.TCPEchoPort)
+			if err != nil {
+				observability.ErrorWithContext(ctx, fmt.Sprintf("Failed to listen for TCP echo: %v", err))
+				return
+			}
+			if err := tcpEchoServer.Serve(lis); err != nil {
+				observability.ErrorWithContext(ctx, fmt.Sprintf("Failed to serve TCP echo: %v", err))
+			}
+		})
+	}
+
+	// Announce the pod to the service catalog once it serves traffic
+	var registrar *catalog.Registrar
+	podName := os.Getenv("HOSTNAME")
+	if conf.Catalog.URL != "" {
+		registrar = catalog.New(clients.Client(httpclient.ClientCatalog), conf.Catalog.URL, metadataFetcher.FetchMetadata)
+		registration := catalog.Registration{
+			ID:        podName,
+			Version:   version.Get().Version,
+			HTTPPort:  conf.Server.Port,
+			GRPCPort:  conf.Server.GRPCPort,
+			StartedAt: time.Now().UTC(),
+		}
+		for _, route := range registry.Routes() {
+			registration.Capabilities = append(registration.Capabilities, route.Pattern)
+		}
+		goroutines.Go(ctx, "catalog", func(ctx context.Context) {
+			if err := registrar.Register(ctx, registration); err != nil {
+				observability.WarnWithContext(ctx, err.Error())
+			}
+		})
+	}
+
+	// Keep a latency and error baseline with constant low-rate load
+	heartbeatCtx, stopHeartbeat := context.WithCancel(ctx)
+	defer stopHeartbeat()
+	var baseline *heartbeat.Heartbeat
+	if len(conf.Heartbeat.Targets) > 0 {
+		observability.InfoWithContext(ctx, fmt.Sprintf("Heartbeat to %v every %v", conf.Heartbeat.Targets, conf.Heartbeat.Interval))
+		baseline = heartbeat.New(clients.Client(httpclient.ClientHeartbeat), heartbeat.Options{
+			Targets:  conf.Heartbeat.Targets,
+			Interval: conf.Heartbeat.Interval,
+		})
+		goroutines.Go(heartbeatCtx, "heartbeat", baseline.Run)
+	}
+
+	// Persist result snapshots so they survive pod restarts
+	artifactsCtx, stopArtifacts := context.WithCancel(ctx)
+	defer stopArtifacts()
+	var artifactsDone chan struct{}
+	if conf.Artifacts.Dir != "" || conf.Artifacts.GCSBucket != "" {
+		var sink artifact.Sink = artifact.DirSink{Dir: conf.Artifacts.Dir}
+		destination := conf.Artifacts.Dir
+		if conf.Artifacts.GCSBucket != "" {
+			sink = artifact.GCSSink{
+				Bucket: conf.Artifacts.GCSBucket,
+				Client: clients.Client(httpclient.ClientArtifacts).HTTP,
+				Token:  artifact.MetadataToken(metadataClient.FetchMetadata),
+			}
+			destination = "gs://" + conf.Artifacts.GCSBucket
+		}
+		writer := artifact.NewWriter(sink, artifact.Options{
+			Interval: conf.Artifacts.Interval,
+			Keep:     conf.Artifacts.Keep,
+			Prefix:   conf.Artifacts.Prefix,
+			Instance: podName,
+		})
+		if baseline != nil {
+			writer.Register("heartbeat", func() any { return baseline.Snapshot() })
+		}
+		writer.Register("probes", func() any { return healthChecker.Results() })
+		writer.Register("health-transitions", func() any { return healthChecker.Transitions() })
+
+		observability.InfoWithContext(ctx, fmt.Sprintf("Writing result snapshots to %s every %v", destination, conf.Artifacts.Interval))
+		artifactsDone = make(chan struct{})
+		goroutines.Go(artifactsCtx, "artifacts", func(ctx context.Context) {
+			defer close(artifactsDone)
+			writer.Run(ctx, conf.Observability.ShutdownTimeout)
+		})
+	}
+
+	// Fail readiness and stop reusing connections, then give the mesh time to
+	// remove the pod from load balancing before connections are closed. This
+	// starts on shutdown or earlier through POST /drain.
+	var drainOnce sync.Once
+	startDraining := func() {
+		drainOnce.Do(func() {
+			readiness.StartDraining()
+			observability.InfoWithContext(ctx, fmt.Sprintf("Draining with %d requests in flight", inFlight.StartDraining()))
+			stopHeartbeat()
+			server.SetKeepAlivesEnabled(false)
+			if tlsServer != nil {
+				tlsServer.SetKeepAlivesEnabled(false)
+			}
+			if grpcServer != nil {
+				grpcServer.Drain()
+			}
+			if registrar != nil {
+				deregisterCtx, cancel := context.WithTimeout(ctx, conf.Observability.ShutdownTimeout)
+				if err := registrar.Deregister(deregisterCtx, podName); err != nil {
+					observability.WarnWithContext(ctx, err.Error())
+				}
+				cancel()
+			}
+		})
+	}
+	goroutines.Go(ctx, "lifecycle", func(ctx context.Context) {
+		select {
+		case <-lifecycle.Draining():
+			startDraining()
+		case <-ctx.Done():
+		}
+	})
 
 	quit := make(chan os.Signal, 1)
 	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
-	<-quit
+	drainDelay := conf.Server.DrainDelay
+	select {
+	case <-quit:
+	case <-lifecycle.Quitting():
+		// /quitquitquit asks for an immediate, still graceful, shutdown
+		drainDelay = 0
+	}
 	observability.InfoWithContext(ctx, "Shutting down server...")
 
+	startDraining()
+	if drainDelay > 0 {
+		observability.InfoWithContext(ctx, fmt.Sprintf("Draining for %v before closing connections", drainDelay))
+		time.Sleep(drainDelay)
+	}
+
 	shutdownCtx, cancel := context.WithTimeout(context.Background(), conf.Observability.ShutdownTimeout)
 	defer cancel()
 	if err := server.Shutdown(shutdownCtx); err != nil {
 		observability.ErrorWithContext(ctx, fmt.Sprintf("Server forced to shutdown: %v", err))
 	}
+	if tlsServer != nil {
+		if err := tlsServer.Shutdown(shutdownCtx); err != nil {
+			observability.ErrorWithContext(ctx, fmt.Sprintf("TLS server forced to shutdown: %v", err))
+		}
+	}
+	if grpcServer != nil {
+		grpcServer.Shutdown(shutdownCtx)
+	}
+	if tcpEchoServer != nil {
+		tcpEchoServer.Shutdown(shutdownCtx)
+	}
+	// The admin server stays up through the drain so it can be observed
+	if adminServer != nil {
+		if err := adminServer.Shutdown(shutdownCtx); err != nil {
+			observability.ErrorWithContext(ctx, fmt.Sprintf("Admin server forced to shutdown: %v", err))
+		}
+	}
+
+	drained := inFlight.Result()
+	message := fmt.Sprintf("Drained %d of %d requests in flight, served %d accepted during the drain", drained.Drained, drained.InFlight, drained.Accepted)
+	if drained.Aborted > 0 {
+		observability.WarnWithContext(ctx, fmt.Sprintf("%s, aborted %d still in flight", message, drained.Aborted))
+	} else {
+		observability.InfoWithContext(ctx, message)
+	}
+
+	// Write the final snapshots, which cover the drain
+	stopArtifacts()
+	if artifactsDone != nil {
+		<-artifactsDone
+	}
 
 	observability.InfoWithContext(ctx, "Server exiting")
+
+	// Write out buffered log entries before the process exits
+	flushCtx, cancelFlush := context.WithTimeout(context.Background(), conf.Observability.ShutdownTimeout)
+	defer cancelFlush()
+	if err := observability.FlushLogs(flushCtx); err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to flush buffered logs: %v\n", err)
+	}
+}
+
+// securityOptions builds the security header options of API and default
+// endpoints from configuration
+func securityOptions(conf *config.Config) (api, def security.SecurityHeadersOptions) {
+	api = security.CustomSecurityOptions(
+		conf.Security.APICOEP,
+		conf.Security.APICOOP,
+		conf.Security.APICORP,
+	)
+
+	def = security.CustomSecurityOptions(
+		conf.Security.DefaultCOEP,
+		conf.Security.DefaultCOOP,
+		conf.Security.DefaultCORP,
+	)
+
+	// Transport and feature policies apply to every endpoint
+	api.HSTS = conf.Security.HSTS()
+	api.PermissionsPolicy = conf.Security.PermissionsPolicy
+	def.HSTS = conf.Security.HSTS()
+	def.PermissionsPolicy = conf.Security.PermissionsPolicy
+	return api, def
+}
+
+// detectZone returns the zone of the node serving the pod, or an empty string
+// when the metadata server cannot be reached
+func detectZone(ctx context.Context, client *metadata.Client) string {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	zone, err := client.FetchMetadata(ctx, metadata.InstanceZoneURL)
+	if err != nil {
+		observability.ErrorWithContext(ctx, fmt.Sprintf("Warning: Failed to detect zone, zone skew disabled: %v", err))
+		return ""
+	}
+	return zone[strings.LastIndex(zone, "/")+1:]
+}
+
+// outboundClientOptions builds the options of every named outbound client from configuration
+func outboundClientOptions(conf *config.Config, metadataRetry httpretry.Policy) map[string]httpclient.ClientOptions {
+	base := httpclient.ClientOptions{
+		MaxIdleConnsPerHost: conf.Outbound.MaxIdleConnsPerHost,
+		IdleConnTimeout:     conf.Outbound.IdleConnTimeout,
+		Tracing:             conf.Outbound.Tracing,
+	}
+
+	options := make(map[string]httpclient.ClientOptions, len(conf.Outbound.Clients)+1)
+
+	metadataOptions := base
+	metadataOptions.Timeout = conf.Metadata.HTTPTimeout
+	metadataOptions.Retry = metadataRetry
+	options[httpclient.ClientMetadata] = metadataOptions
+
+	for name, client := range conf.Outbound.Clients {
+		clientOptions := base
+		clientOptions.Timeout = client.Timeout
+		clientOptions.Retry = httpretry.DefaultPolicy()
+		clientOptions.Retry.MaxAttempts = client.MaxAttempts
+		clientOptions.Retry.HedgeDelay = client.HedgeDelay
+		options[name] = clientOptions
+	}
+
+	return options
 }
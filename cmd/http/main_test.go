@@ -3,10 +3,15 @@ package main
 import (
 	"context"
 	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
 	"io"
 	"net/http"
 	"net/http/httptest"
 	"os"
+	"strconv"
+	"strings"
 	"testing"
 
 	"istio-test/internal/metadata"
@@ -33,7 +38,7 @@ func TestMain(t *testing.T) {
 		{ts.URL + "/istio-test/metadata/cluster-name", http.StatusOK, `{"cluster-name":"test-cluster-name"}`, true},
 		{ts.URL + "/istio-test/metadata/cluster-location", http.StatusOK, `{"cluster-location":"test-cluster-location"}`, true},
 		{ts.URL + "/istio-test/metadata/instance-zone", http.StatusOK, `{"instance-zone":"us-central1-a"}`, true},
-		{ts.URL + "/istio-test/metadata/unknown", http.StatusBadRequest, "Unknown metadata type\n", false},
+		{ts.URL + "/istio-test/metadata/unknown", http.StatusBadRequest, `{"type":"about:blank","title":"Bad Request","status":400,"detail":"Unknown metadata type","instance":"/istio-test/metadata/unknown"}`, true},
 	}
 
 	for _, test := range tests {
@@ -65,3 +70,50 @@ func mockFetchMetadata(ctx context.Context, url string) (string, error) {
 		return "", fmt.Errorf("unknown URL: %s", url)
 	}
 }
+
+// TestPublicRoutesExcludeAdmin checks every route main registers on the public
+// registry, so admin routes cannot slip past the admin listener and token
+func TestPublicRoutesExcludeAdmin(t *testing.T) {
+	file, err := parser.ParseFile(token.NewFileSet(), "main.go", nil, 0)
+	if err != nil {
+		t.Fatalf("parsing main.go: %v", err)
+	}
+
+	var public []string
+	ast.Inspect(file, func(node ast.Node) bool {
+		call, ok := node.(*ast.CallExpr)
+		if !ok || len(call.Args) == 0 {
+			return true
+		}
+		selector, ok := call.Fun.(*ast.SelectorExpr)
+		if !ok || selector.Sel.Name != "HandleFunc" {
+			return true
+		}
+		if receiver, ok := selector.X.(*ast.Ident); !ok || receiver.Name != "registry" {
+			return true
+		}
+		route, ok := call.Args[0].(*ast.CompositeLit)
+		if !ok {
+			return true
+		}
+		for _, element := range route.Elts {
+			field, ok := element.(*ast.KeyValueExpr)
+			if !ok || field.Key.(*ast.Ident).Name != "Pattern" {
+				continue
+			}
+			pattern := fmt.Sprintf("%T", field.Value)
+			if literal, ok := field.Value.(*ast.BasicLit); ok {
+				pattern, _ = strconv.Unquote(literal.Value)
+			}
+			public = append(public, pattern)
+		}
+		return true
+	})
+
+	assert.NotEmpty(t, public)
+	for _, pattern := range public {
+		for _, prefix := range []string{"/admin/", "/debug/"} {
+			assert.False(t, strings.HasPrefix(pattern, prefix), "%s is registered on the public registry instead of adminRegistry", pattern)
+		}
+	}
+}
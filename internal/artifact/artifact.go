@@ -0,0 +1,177 @@
+// Package artifact persists periodic JSON snapshots of test results.
+//
+// Experiments run for hours, while pods are rescheduled or restarted by the
+// very mesh changes under test, taking in-memory results with them. The
+// writer asks every registered source (heartbeat, health probes) for a
+// snapshot on an interval and once more on shutdown, and stores it in a
+// mounted volume or a GCS bucket, where the orchestration pipeline collects
+// it. Only the newest snapshots of every source are kept.
+package artifact
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"istio-test/internal/observability"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// timestampLayout sorts lexically in the order snapshots were taken
+const timestampLayout = "20060102T150405.000Z"
+
+var writes = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Namespace: "istio_test",
+	Name:      "artifact_writes_total",
+	Help:      "Total number of result snapshots written by source and result (success, error).",
+}, []string{"source", "result"})
+
+func init() {
+	observability.MetricsRegistry().MustRegister(writes)
+}
+
+// Sink stores artifacts by slash-separated name
+type Sink interface {
+	Put(ctx context.Context, name string, data []byte) error
+	List(ctx context.Context, prefix string) ([]string, error)
+	Delete(ctx context.Context, name string) error
+}
+
+// Options configures the writer
+type Options struct {
+	Interval time.Duration // Time between snapshots
+	Keep     int           // Snapshots kept per source, older ones are deleted
+	Prefix   string        // Directory of every artifact, e.g. an experiment ID
+	Instance string        // Identifies the pod, so replicas sharing a sink do not overwrite each other
+}
+
+// Snapshot is the content of an artifact
+type Snapshot struct {
+	Source    string    `json:"source"`
+	Instance  string    `json:"instance"`
+	Timestamp time.Time `json:"timestamp"`
+	Data      any       `json:"data"`
+}
+
+// source is a registered snapshot source
+type source struct {
+	name     string
+	snapshot func() any
+}
+
+// Writer writes snapshots of its sources to a sink
+type Writer struct {
+	sink    Sink
+	options Options
+	now     func() time.Time
+
+	mu      sync.Mutex
+	sources []source
+}
+
+// NewWriter creates a writer storing snapshots in sink; call Run to start writing
+func NewWriter(sink Sink, options Options) *Writer {
+	if options.Interval <= 0 {
+		options.Interval = time.Minute
+	}
+	if options.Keep < 1 {
+		options.Keep = 1
+	}
+	return &Writer{sink: sink, options: options, now: time.Now}
+}
+
+// Register adds a source whose snapshot is written under name
+func (w *Writer) Register(name string, snapshot func() any) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.sources = append(w.sources, source{name: name, snapshot: snapshot})
+}
+
+// namePrefix returns the common prefix of the artifacts of a source
+func (w *Writer) namePrefix(name string) string {
+	dir := path.Join(w.options.Prefix, w.options.Instance)
+	if dir == "." {
+		return name + "-"
+	}
+	return strings.TrimPrefix(dir, "/") + "/" + name + "-"
+}
+
+// WriteAll writes a snapshot of every source and deletes the snapshots
+// beyond Keep; a failing source does not stop the others
+func (w *Writer) WriteAll(ctx context.Context) error {
+	w.mu.Lock()
+	sources := append([]source(nil), w.sources...)
+	w.mu.Unlock()
+
+	var errs []error
+	for _, s := range sources {
+		if err := w.write(ctx, s); err != nil {
+			writes.WithLabelValues(s.name, "error").Inc()
+			errs = append(errs, fmt.Errorf("%s: %w", s.name, err))
+			continue
+		}
+		writes.WithLabelValues(s.name, "success").Inc()
+	}
+	return errors.Join(errs...)
+}
+
+// write stores one snapshot of s and rotates its older snapshots
+func (w *Writer) write(ctx context.Context, s source) error {
+	now := w.now().UTC()
+	data, err := json.MarshalIndent(Snapshot{
+		Source:    s.name,
+		Instance:  w.options.Instance,
+		Timestamp: now,
+		Data:      s.snapshot(),
+	}, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode snapshot: %w", err)
+	}
+
+	prefix := w.namePrefix(s.name)
+	if err := w.sink.Put(ctx, prefix+now.Format(timestampLayout)+".json", data); err != nil {
+		return fmt.Errorf("failed to write snapshot: %w", err)
+	}
+
+	names, err := w.sink.List(ctx, prefix)
+	if err != nil {
+		return fmt.Errorf("failed to list snapshots: %w", err)
+	}
+	sort.Strings(names)
+	for _, name := range names[:max(len(names)-w.options.Keep, 0)] {
+		if err := w.sink.Delete(ctx, name); err != nil {
+			return fmt.Errorf("failed to delete snapshot %s: %w", name, err)
+		}
+	}
+	return nil
+}
+
+// Run writes snapshots on every interval until ctx is done, then writes a
+// final one within timeout so results of the last interval are not lost
+func (w *Writer) Run(ctx context.Context, timeout time.Duration) {
+	ticker := time.NewTicker(w.options.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			finalCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), timeout)
+			defer cancel()
+			if err := w.WriteAll(finalCtx); err != nil {
+				observability.WarnWithContext(ctx, fmt.Sprintf("Failed to write final result snapshots: %v", err))
+			}
+			return
+		case <-ticker.C:
+			if err := w.WriteAll(ctx); err != nil {
+				observability.WarnWithContext(ctx, fmt.Sprintf("Failed to write result snapshots: %v", err))
+			}
+		}
+	}
+}
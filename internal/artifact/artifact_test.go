@@ -0,0 +1,77 @@
+package artifact
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWriterRotates(t *testing.T) {
+	dir := t.TempDir()
+	w := NewWriter(DirSink{Dir: dir}, Options{Keep: 2, Prefix: "experiment-1", Instance: "istio-test-abc"})
+	now := time.Date(2026, 10, 15, 12, 0, 0, 0, time.UTC)
+	w.now = func() time.Time { return now }
+
+	runs := 0
+	w.Register("heartbeat", func() any {
+		runs++
+		return map[string]int{"run": runs}
+	})
+
+	for range 3 {
+		require.NoError(t, w.WriteAll(context.Background()))
+		now = now.Add(time.Minute)
+	}
+
+	entries, err := os.ReadDir(filepath.Join(dir, "experiment-1", "istio-test-abc"))
+	require.NoError(t, err)
+	require.Len(t, entries, 2, "only the newest snapshots are kept")
+	assert.Equal(t, "heartbeat-20261015T120100.000Z.json", entries[0].Name())
+
+	data, err := os.ReadFile(filepath.Join(dir, "experiment-1", "istio-test-abc", entries[1].Name()))
+	require.NoError(t, err)
+	var snapshot Snapshot
+	require.NoError(t, json.Unmarshal(data, &snapshot))
+	assert.Equal(t, "heartbeat", snapshot.Source)
+	assert.Equal(t, "istio-test-abc", snapshot.Instance)
+	assert.Equal(t, map[string]any{"run": float64(3)}, snapshot.Data)
+}
+
+// failingSink fails every write
+type failingSink struct{ DirSink }
+
+func (failingSink) Put(ctx context.Context, name string, data []byte) error {
+	return errors.New("volume full")
+}
+
+func TestWriterReportsFailures(t *testing.T) {
+	w := NewWriter(failingSink{}, Options{})
+	w.Register("heartbeat", func() any { return nil })
+	w.Register("probes", func() any { return nil })
+
+	err := w.WriteAll(context.Background())
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "heartbeat: failed to write snapshot: volume full")
+	assert.Contains(t, err.Error(), "probes:")
+}
+
+func TestWriterRunWritesFinalSnapshot(t *testing.T) {
+	dir := t.TempDir()
+	w := NewWriter(DirSink{Dir: dir}, Options{Interval: time.Hour, Keep: 5})
+	w.Register("probes", func() any { return "done" })
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	w.Run(ctx, time.Second)
+
+	names, err := DirSink{Dir: dir}.List(context.Background(), "probes-")
+	require.NoError(t, err)
+	assert.Len(t, names, 1)
+}
@@ -0,0 +1,221 @@
+package artifact
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DirSink stores artifacts as files below a directory, typically a mounted
+// volume. Files are written to a temporary name and renamed, so collectors
+// never read a partial snapshot.
+type DirSink struct {
+	Dir string
+}
+
+// Put writes data to the file name below the directory
+func (s DirSink) Put(ctx context.Context, name string, data []byte) error {
+	target := filepath.Join(s.Dir, filepath.FromSlash(name))
+	if err := os.MkdirAll(filepath.Dir(target), 0o755); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(target), ".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), target)
+}
+
+// List returns the names of the files starting with prefix
+func (s DirSink) List(ctx context.Context, prefix string) ([]string, error) {
+	dir := path.Dir(prefix)
+	entries, err := os.ReadDir(filepath.Join(s.Dir, filepath.FromSlash(dir)))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var names []string
+	for _, entry := range entries {
+		name := path.Join(dir, entry.Name())
+		if !entry.IsDir() && strings.HasPrefix(name, prefix) {
+			names = append(names, name)
+		}
+	}
+	return names, nil
+}
+
+// Delete removes the file name
+func (s DirSink) Delete(ctx context.Context, name string) error {
+	err := os.Remove(filepath.Join(s.Dir, filepath.FromSlash(name)))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	return err
+}
+
+// DefaultGCSEndpoint is the Cloud Storage JSON API
+const DefaultGCSEndpoint = "https://storage.googleapis.com"
+
+// GCSSink stores artifacts as objects of a Cloud Storage bucket through the
+// JSON API
+type GCSSink struct {
+	Bucket   string
+	Client   *http.Client
+	Token    func(ctx context.Context) (string, error) // Returns an OAuth2 access token
+	Endpoint string                                    // Defaults to DefaultGCSEndpoint
+}
+
+// do sends an authorized request and fails on statuses other than ok
+func (s GCSSink) do(ctx context.Context, method, rawURL string, body []byte, ok ...int) (*http.Response, error) {
+	token, err := s.Token(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get access token: %w", err)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, rawURL, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := s.Client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	for _, code := range ok {
+		if resp.StatusCode == code {
+			return resp, nil
+		}
+	}
+	defer resp.Body.Close()
+	detail, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+	return nil, fmt.Errorf("%s %s: status code %d: %s", method, req.URL.Path, resp.StatusCode, strings.TrimSpace(string(detail)))
+}
+
+func (s GCSSink) endpoint() string {
+	if s.Endpoint != "" {
+		return s.Endpoint
+	}
+	return DefaultGCSEndpoint
+}
+
+// Put uploads data as the object name
+func (s GCSSink) Put(ctx context.Context, name string, data []byte) error {
+	rawURL := fmt.Sprintf("%s/upload/storage/v1/b/%s/o?uploadType=media&name=%s", s.endpoint(), url.PathEscape(s.Bucket), url.QueryEscape(name))
+	resp, err := s.do(ctx, http.MethodPost, rawURL, data, http.StatusOK)
+	if err != nil {
+		return err
+	}
+	_, _ = io.Copy(io.Discard, resp.Body)
+	return resp.Body.Close()
+}
+
+// List returns the names of the objects starting with prefix
+func (s GCSSink) List(ctx context.Context, prefix string) ([]string, error) {
+	var names []string
+	pageToken := ""
+	for {
+		query := url.Values{"prefix": {prefix}, "fields": {"items(name),nextPageToken"}}
+		if pageToken != "" {
+			query.Set("pageToken", pageToken)
+		}
+		resp, err := s.do(ctx, http.MethodGet, fmt.Sprintf("%s/storage/v1/b/%s/o?%s", s.endpoint(), url.PathEscape(s.Bucket), query.Encode()), nil, http.StatusOK)
+		if err != nil {
+			return nil, err
+		}
+		var page struct {
+			Items []struct {
+				Name string `json:"name"`
+			} `json:"items"`
+			NextPageToken string `json:"nextPageToken"`
+		}
+		err = json.NewDecoder(resp.Body).Decode(&page)
+		resp.Body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("invalid object listing: %w", err)
+		}
+		for _, item := range page.Items {
+			names = append(names, item.Name)
+		}
+		if page.NextPageToken == "" {
+			return names, nil
+		}
+		pageToken = page.NextPageToken
+	}
+}
+
+// Delete removes the object name
+func (s GCSSink) Delete(ctx context.Context, name string) error {
+	rawURL := fmt.Sprintf("%s/storage/v1/b/%s/o/%s", s.endpoint(), url.PathEscape(s.Bucket), url.PathEscape(name))
+	resp, err := s.do(ctx, http.MethodDelete, rawURL, nil, http.StatusNoContent, http.StatusOK, http.StatusNotFound)
+	if err != nil {
+		return err
+	}
+	return resp.Body.Close()
+}
+
+// ServiceAccountTokenURL returns an access token of the workload's Google
+// service account from the GKE metadata server
+const ServiceAccountTokenURL = "http://metadata.google.internal/computeMetadata/v1/instance/service-accounts/default/token"
+
+// MetadataToken returns a token function for GCSSink that reads access
+// tokens with fetch, typically a metadata client, and reuses them until
+// shortly before they expire
+func MetadataToken(fetch func(ctx context.Context, url string) (string, error)) func(ctx context.Context) (string, error) {
+	var (
+		mu      sync.Mutex
+		token   string
+		expires time.Time
+	)
+	return func(ctx context.Context) (string, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		if token != "" && time.Now().Before(expires) {
+			return token, nil
+		}
+
+		body, err := fetch(ctx, ServiceAccountTokenURL)
+		if err != nil {
+			return "", err
+		}
+		var response struct {
+			AccessToken string `json:"access_token"`
+			ExpiresIn   int    `json:"expires_in"`
+		}
+		if err := json.Unmarshal([]byte(body), &response); err != nil {
+			return "", fmt.Errorf("invalid token response: %w", err)
+		}
+		if response.AccessToken == "" {
+			return "", errors.New("token response has no access token")
+		}
+		token = response.AccessToken
+		// Renew a minute ahead so a token never expires mid-upload
+		expires = time.Now().Add(time.Duration(response.ExpiresIn)*time.Second - time.Minute)
+		return token, nil
+	}
+}
@@ -0,0 +1,123 @@
+package artifact
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDirSink(t *testing.T) {
+	sink := DirSink{Dir: t.TempDir()}
+	ctx := context.Background()
+
+	require.NoError(t, sink.Put(ctx, "run/pod/heartbeat-1.json", []byte("{}")))
+	require.NoError(t, sink.Put(ctx, "run/pod/heartbeat-2.json", []byte("{}")))
+	require.NoError(t, sink.Put(ctx, "run/pod/probes-1.json", []byte("{}")))
+
+	names, err := sink.List(ctx, "run/pod/heartbeat-")
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []string{"run/pod/heartbeat-1.json", "run/pod/heartbeat-2.json"}, names)
+
+	require.NoError(t, sink.Delete(ctx, "run/pod/heartbeat-1.json"))
+	require.NoError(t, sink.Delete(ctx, "run/pod/heartbeat-1.json"), "deleting twice is not an error")
+	names, err = sink.List(ctx, "run/pod/heartbeat-")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"run/pod/heartbeat-2.json"}, names)
+
+	names, err = sink.List(ctx, "missing/heartbeat-")
+	require.NoError(t, err)
+	assert.Empty(t, names)
+}
+
+// fakeGCS emulates the object upload, list and delete calls of the Cloud
+// Storage JSON API for one bucket
+type fakeGCS struct {
+	mu      sync.Mutex
+	objects map[string]string
+}
+
+func (f *fakeGCS) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Header.Get("Authorization") != "Bearer test-token" {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	switch {
+	case r.Method == http.MethodPost && r.URL.Path == "/upload/storage/v1/b/results/o":
+		body, _ := io.ReadAll(r.Body)
+		f.objects[r.URL.Query().Get("name")] = string(body)
+		_, _ = w.Write([]byte(`{}`))
+	case r.Method == http.MethodGet && r.URL.Path == "/storage/v1/b/results/o":
+		var names []string
+		for name := range f.objects {
+			if strings.HasPrefix(name, r.URL.Query().Get("prefix")) {
+				names = append(names, `{"name":"`+name+`"}`)
+			}
+		}
+		sort.Strings(names)
+		_, _ = w.Write([]byte(`{"items":[` + strings.Join(names, ",") + `]}`))
+	case r.Method == http.MethodDelete && strings.HasPrefix(r.URL.Path, "/storage/v1/b/results/o/"):
+		name := strings.TrimPrefix(r.URL.Path, "/storage/v1/b/results/o/")
+		if _, ok := f.objects[name]; !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		delete(f.objects, name)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		w.WriteHeader(http.StatusBadRequest)
+	}
+}
+
+func TestGCSSink(t *testing.T) {
+	gcs := &fakeGCS{objects: make(map[string]string)}
+	ts := httptest.NewServer(gcs)
+	defer ts.Close()
+
+	sink := GCSSink{
+		Bucket:   "results",
+		Client:   ts.Client(),
+		Token:    func(ctx context.Context) (string, error) { return "test-token", nil },
+		Endpoint: ts.URL,
+	}
+	w := NewWriter(sink, Options{Keep: 1, Instance: "istio-test-abc"})
+	w.Register("heartbeat", func() any { return "ok" })
+
+	require.NoError(t, w.WriteAll(context.Background()))
+	require.NoError(t, w.WriteAll(context.Background()))
+
+	require.Len(t, gcs.objects, 1)
+	for name, body := range gcs.objects {
+		assert.True(t, strings.HasPrefix(name, "istio-test-abc/heartbeat-"), name)
+		assert.Contains(t, body, `"data": "ok"`)
+	}
+
+	sink.Token = func(ctx context.Context) (string, error) { return "expired", nil }
+	assert.ErrorContains(t, sink.Put(context.Background(), "x.json", []byte("{}")), "status code 401")
+}
+
+func TestMetadataToken(t *testing.T) {
+	fetches := 0
+	token := MetadataToken(func(ctx context.Context, url string) (string, error) {
+		fetches++
+		assert.Equal(t, ServiceAccountTokenURL, url)
+		return `{"access_token":"ya29.token","expires_in":3599,"token_type":"Bearer"}`, nil
+	})
+
+	for range 2 {
+		value, err := token(context.Background())
+		require.NoError(t, err)
+		assert.Equal(t, "ya29.token", value)
+	}
+	assert.Equal(t, 1, fetches, "the token is reused until it is about to expire")
+}
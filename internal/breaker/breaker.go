@@ -0,0 +1,218 @@
+// Package breaker provides a circuit breaker for calls to a dependency.
+//
+// While the dependency keeps failing the breaker opens and calls fail fast
+// with ErrOpen instead of each spending a timeout and its retries. After the
+// reset timeout a single trial call is let through: its success closes the
+// breaker again, its failure keeps it open for another reset timeout. Each
+// state change starts a new generation; outcomes of calls let through in an
+// earlier generation are ignored, so a slow call admitted while closed cannot
+// decide the trial of a half-open breaker.
+package breaker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"istio-test/internal/observability"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// ErrOpen is returned for calls rejected while the breaker is open
+var ErrOpen = errors.New("circuit breaker is open")
+
+// Defaults used when Options leave a field unset
+const (
+	DefaultFailureThreshold = 5
+	DefaultResetTimeout     = 30 * time.Second
+)
+
+// State is the state of a breaker
+type State string
+
+// Breaker states
+const (
+	StateClosed   State = "closed"    // Calls go through
+	StateOpen     State = "open"      // Calls fail fast
+	StateHalfOpen State = "half_open" // A single trial call goes through
+)
+
+// stateValue is the value of the state gauge for each state
+var stateValue = map[State]float64{StateClosed: 0, StateHalfOpen: 1, StateOpen: 2}
+
+var (
+	breakerState = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: "istio_test",
+		Name:      "circuit_breaker_state",
+		Help:      "State of each circuit breaker: 0 closed, 1 half-open, 2 open.",
+	}, []string{"name"})
+	breakerRejected = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "istio_test",
+		Name:      "circuit_breaker_rejected_total",
+		Help:      "Total number of calls failed fast by an open circuit breaker.",
+	}, []string{"name"})
+	breakerTransitions = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "istio_test",
+		Name:      "circuit_breaker_transitions_total",
+		Help:      "Total number of circuit breaker state changes, by the state entered.",
+	}, []string{"name", "state"})
+)
+
+func init() {
+	observability.MetricsRegistry().MustRegister(breakerState, breakerRejected, breakerTransitions)
+}
+
+// Options configures a breaker
+type Options struct {
+	FailureThreshold int           // Consecutive failures that open the breaker, defaults to DefaultFailureThreshold
+	ResetTimeout     time.Duration // Time the breaker stays open before a trial call, defaults to DefaultResetTimeout
+}
+
+// Status describes the state of a breaker
+type Status struct {
+	State    State     `json:"state"`
+	Failures int       `json:"consecutive_failures"`
+	OpenedAt time.Time `json:"opened_at,omitzero"` // When the breaker last opened, set while it is not closed
+	RetryAt  time.Time `json:"retry_at,omitzero"`  // When the next trial call is let through, set while open
+}
+
+// Generation identifies the state a call was let through in
+type Generation uint64
+
+// Breaker is a consecutive-failure circuit breaker
+type Breaker struct {
+	name    string
+	options Options
+	now     func() time.Time
+
+	mu         sync.Mutex
+	state      State
+	generation Generation // Incremented on every state change
+	failures   int
+	openedAt   time.Time
+	trial      bool // A half-open trial call is in flight
+}
+
+// New creates a closed breaker; name labels its metrics, logs and health check
+func New(name string, options Options) *Breaker {
+	if options.FailureThreshold <= 0 {
+		options.FailureThreshold = DefaultFailureThreshold
+	}
+	if options.ResetTimeout <= 0 {
+		options.ResetTimeout = DefaultResetTimeout
+	}
+	breakerState.WithLabelValues(name).Set(stateValue[StateClosed])
+	return &Breaker{name: name, options: options, now: time.Now, state: StateClosed}
+}
+
+// setState changes the state and reports the transition; callers must hold mu
+func (b *Breaker) setState(ctx context.Context, state State) {
+	if b.state == state {
+		return
+	}
+	previous := b.state
+	b.state = state
+	b.generation++
+	breakerState.WithLabelValues(b.name).Set(stateValue[state])
+	breakerTransitions.WithLabelValues(b.name, string(state)).Inc()
+
+	fields := map[string]any{
+		"type":     "circuit_breaker",
+		"breaker":  b.name,
+		"from":     string(previous),
+		"to":       string(state),
+		"failures": b.failures,
+	}
+	message := fmt.Sprintf("Circuit breaker %s %s after %d consecutive failures", b.name, state, b.failures)
+	switch state {
+	case StateOpen:
+		fields["reset_timeout_ms"] = observability.Milliseconds(b.options.ResetTimeout)
+		observability.WarnWithFields(ctx, message, fields)
+	case StateClosed:
+		observability.InfoWithFields(ctx, fmt.Sprintf("Circuit breaker %s closed", b.name), fields)
+	default:
+		observability.InfoWithFields(ctx, fmt.Sprintf("Circuit breaker %s half-open, letting a trial call through", b.name), fields)
+	}
+}
+
+// Allow reports whether a call may proceed, returning ErrOpen when it may
+// not. Every allowed call must be followed by Record with the returned
+// generation and its outcome.
+func (b *Breaker) Allow(ctx context.Context) (Generation, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.state == StateOpen && b.now().Sub(b.openedAt) >= b.options.ResetTimeout {
+		b.setState(ctx, StateHalfOpen)
+	}
+	switch {
+	case b.state == StateClosed:
+		return b.generation, nil
+	case b.state == StateHalfOpen && !b.trial:
+		b.trial = true
+		return b.generation, nil
+	}
+	breakerRejected.WithLabelValues(b.name).Inc()
+	return b.generation, ErrOpen
+}
+
+// Record records the outcome of a call let through by Allow in generation.
+// Outcomes from an earlier generation are ignored.
+func (b *Breaker) Record(ctx context.Context, generation Generation, failed bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if generation != b.generation {
+		return
+	}
+	trial := b.trial
+	b.trial = false
+	if !failed {
+		b.failures = 0
+		b.setState(ctx, StateClosed)
+		return
+	}
+
+	// A failed trial reopens the breaker for another reset timeout
+	b.failures++
+	if trial || (b.state == StateClosed && b.failures >= b.options.FailureThreshold) {
+		b.openedAt = b.now()
+		b.setState(ctx, StateOpen)
+	}
+}
+
+// Status returns the current state of the breaker
+func (b *Breaker) Status() Status {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	status := Status{State: b.state, Failures: b.failures}
+	if b.state != StateClosed {
+		status.OpenedAt = b.openedAt.UTC()
+	}
+	if b.state == StateOpen {
+		status.RetryAt = b.openedAt.Add(b.options.ResetTimeout).UTC()
+	}
+	return status
+}
+
+// Name returns the name of the health check of the breaker
+func (b *Breaker) Name() string {
+	return "circuit_breaker_" + b.name
+}
+
+// Check reports an error while the breaker is not closed, so health checks
+// show that calls to the dependency are failing fast
+func (b *Breaker) Check(ctx context.Context) error {
+	status := b.Status()
+	switch status.State {
+	case StateOpen:
+		return fmt.Errorf("open after %d consecutive failures, next trial at %s", status.Failures, status.RetryAt.Format(time.RFC3339))
+	case StateHalfOpen:
+		return fmt.Errorf("half-open after %d consecutive failures, a trial call decides whether it closes", status.Failures)
+	}
+	return nil
+}
@@ -0,0 +1,110 @@
+package breaker
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestBreaker(name string, options Options) (*Breaker, *time.Time) {
+	b := New(name, options)
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	b.now = func() time.Time { return now }
+	return b, &now
+}
+
+// call lets a call through b and records its outcome
+func call(t *testing.T, b *Breaker, failed bool) error {
+	t.Helper()
+	generation, err := b.Allow(context.Background())
+	if err != nil {
+		return err
+	}
+	b.Record(context.Background(), generation, failed)
+	return nil
+}
+
+func TestBreakerOpensAfterConsecutiveFailures(t *testing.T) {
+	b, _ := newTestBreaker("test-open", Options{FailureThreshold: 3, ResetTimeout: time.Second})
+
+	require.NoError(t, call(t, b, true))
+	require.NoError(t, call(t, b, true))
+	require.NoError(t, call(t, b, false), "a success resets the failure count")
+	for range 3 {
+		require.NoError(t, call(t, b, true))
+	}
+
+	assert.Equal(t, StateOpen, b.Status().State)
+	assert.ErrorIs(t, call(t, b, false), ErrOpen)
+	assert.Equal(t, 1.0, testutil.ToFloat64(breakerRejected.WithLabelValues("test-open")))
+	assert.Equal(t, 2.0, testutil.ToFloat64(breakerState.WithLabelValues("test-open")))
+}
+
+func TestBreakerHalfOpen(t *testing.T) {
+	b, now := newTestBreaker("test-half-open", Options{FailureThreshold: 1, ResetTimeout: time.Second})
+	require.NoError(t, call(t, b, true))
+	assert.Equal(t, StateOpen, b.Status().State)
+	assert.Equal(t, now.Add(time.Second), b.Status().RetryAt)
+
+	*now = now.Add(time.Second)
+	trial, err := b.Allow(context.Background())
+	require.NoError(t, err, "a trial call goes through after the reset timeout")
+	_, err = b.Allow(context.Background())
+	assert.ErrorIs(t, err, ErrOpen, "only one trial call at a time")
+	assert.Equal(t, StateHalfOpen, b.Status().State)
+	assert.Error(t, b.Check(context.Background()))
+
+	b.Record(context.Background(), trial, true)
+	assert.Equal(t, StateOpen, b.Status().State, "a failed trial reopens the breaker")
+	_, err = b.Allow(context.Background())
+	assert.ErrorIs(t, err, ErrOpen)
+
+	*now = now.Add(time.Second)
+	require.NoError(t, call(t, b, false))
+	status := b.Status()
+	assert.Equal(t, StateClosed, status.State, "a successful trial closes the breaker")
+	assert.Zero(t, status.Failures)
+	assert.True(t, status.OpenedAt.IsZero())
+	assert.NoError(t, b.Check(context.Background()))
+	assert.Equal(t, 2.0, testutil.ToFloat64(breakerTransitions.WithLabelValues("test-half-open", string(StateOpen))))
+}
+
+func TestBreakerIgnoresStaleGenerations(t *testing.T) {
+	b, now := newTestBreaker("test-stale", Options{FailureThreshold: 1, ResetTimeout: time.Second})
+
+	// A slow call is let through while closed, then the breaker opens
+	slow, err := b.Allow(context.Background())
+	require.NoError(t, err)
+	require.NoError(t, call(t, b, true))
+	assert.Equal(t, StateOpen, b.Status().State)
+
+	b.Record(context.Background(), slow, false)
+	assert.Equal(t, StateOpen, b.Status().State, "a success admitted before the breaker opened does not close it")
+
+	*now = now.Add(time.Second)
+	trial, err := b.Allow(context.Background())
+	require.NoError(t, err)
+	b.Record(context.Background(), slow, false)
+	assert.Equal(t, StateHalfOpen, b.Status().State, "a stale success does not decide the trial")
+	_, err = b.Allow(context.Background())
+	assert.ErrorIs(t, err, ErrOpen, "the trial is still in flight")
+
+	b.Record(context.Background(), trial, false)
+	assert.Equal(t, StateClosed, b.Status().State)
+
+	// Failures admitted before the breaker closed do not count against it
+	b.Record(context.Background(), trial, true)
+	assert.Equal(t, StateClosed, b.Status().State)
+	assert.Zero(t, b.Status().Failures)
+}
+
+func TestBreakerDefaults(t *testing.T) {
+	b := New("test-defaults", Options{})
+	assert.Equal(t, DefaultFailureThreshold, b.options.FailureThreshold)
+	assert.Equal(t, DefaultResetTimeout, b.options.ResetTimeout)
+	assert.Equal(t, "circuit_breaker_test-defaults", b.Name())
+}
@@ -0,0 +1,311 @@
+// Package cache provides an opt-in, in-memory response cache for GET routes.
+//
+// The cache models an origin-side cache so CDN and gateway caching interactions
+// can be exercised against this service. Entries expire after a fixed TTL and
+// respect the Vary header of the cached response. Request Cache-Control
+// directives are honored:
+//   - no-store: the cache is bypassed entirely
+//   - no-cache (or Pragma: no-cache): the response is refetched and stored
+//   - max-age=N: cached entries older than N seconds are refetched
+//   - only-if-cached: 504 Gateway Timeout is returned on a miss
+//
+// Every response of a cached route carries an X-Cache header (HIT, MISS or
+// BYPASS); hits also carry an Age header.
+//
+// HeaderPolicy sets the Cache-Control and Surrogate-Control headers of routes
+// from rules that can be replaced at runtime, so downstream caches can be
+// tested with different TTLs.
+package cache
+
+import (
+	"bytes"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Options configures the response cache
+type Options struct {
+	Routes       []string      // Path prefixes whose GET responses are cached
+	TTL          time.Duration // Lifetime of a cached response
+	MaxEntries   int           // Maximum number of cached responses, oldest are evicted first
+	MaxBodyBytes int           // Responses larger than this are not cached
+}
+
+// entry is a cached response variant
+type entry struct {
+	status     int
+	header     http.Header
+	body       []byte
+	storedAt   time.Time
+	varyValues map[string]string // Request header values the response varies on
+}
+
+// Cache is an in-memory response cache
+type Cache struct {
+	mu      sync.Mutex
+	options Options
+	entries map[string][]*entry // Variants keyed by request URL
+	count   int
+	now     func() time.Time
+}
+
+// New creates a response cache
+func New(options Options) *Cache {
+	if options.MaxBodyBytes <= 0 {
+		options.MaxBodyBytes = 1 << 20
+	}
+	return &Cache{
+		options: options,
+		entries: make(map[string][]*entry),
+		now:     time.Now,
+	}
+}
+
+// cacheable reports whether the request targets a configured route
+func (c *Cache) cacheable(r *http.Request) bool {
+	if r.Method != http.MethodGet {
+		return false
+	}
+	for _, prefix := range c.options.Routes {
+		if strings.HasPrefix(r.URL.Path, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// requestDirectives holds the request Cache-Control directives the cache honors
+type requestDirectives struct {
+	noStore      bool
+	noCache      bool
+	onlyIfCached bool
+	maxAge       time.Duration // Negative when not set
+}
+
+// parseRequestDirectives reads Cache-Control and Pragma request headers
+func parseRequestDirectives(r *http.Request) requestDirectives {
+	d := requestDirectives{maxAge: -1}
+	for _, directive := range strings.Split(r.Header.Get("Cache-Control"), ",") {
+		name, value, _ := strings.Cut(strings.TrimSpace(strings.ToLower(directive)), "=")
+		switch name {
+		case "no-store":
+			d.noStore = true
+		case "no-cache":
+			d.noCache = true
+		case "only-if-cached":
+			d.onlyIfCached = true
+		case "max-age":
+			if seconds, err := strconv.Atoi(strings.Trim(value, `"`)); err == nil && seconds >= 0 {
+				d.maxAge = time.Duration(seconds) * time.Second
+			}
+		}
+	}
+	if strings.EqualFold(r.Header.Get("Pragma"), "no-cache") {
+		d.noCache = true
+	}
+	return d
+}
+
+// lookup returns a fresh variant matching the request, if any
+func (c *Cache) lookup(key string, r *http.Request, maxAge time.Duration) (*entry, time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := c.now()
+	for _, e := range c.entries[key] {
+		age := now.Sub(e.storedAt)
+		if age >= c.options.TTL || (maxAge >= 0 && age > maxAge) {
+			continue
+		}
+		if matchesVary(e, r) {
+			return e, age
+		}
+	}
+	return nil, 0
+}
+
+// matchesVary reports whether the request has the header values the variant was stored with
+func matchesVary(e *entry, r *http.Request) bool {
+	for name, value := range e.varyValues {
+		if r.Header.Get(name) != value {
+			return false
+		}
+	}
+	return true
+}
+
+// store saves a response variant, replacing stale or equivalent variants
+func (c *Cache) store(key string, r *http.Request, status int, header http.Header, body []byte) {
+	varyValues := map[string]string{}
+	for _, vary := range header.Values("Vary") {
+		for _, name := range strings.Split(vary, ",") {
+			if name = strings.TrimSpace(name); name == "*" {
+				return // Vary: * is never cacheable
+			} else if name != "" {
+				varyValues[http.CanonicalHeaderKey(name)] = r.Header.Get(name)
+			}
+		}
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := c.now()
+	variants := c.entries[key][:0]
+	for _, e := range c.entries[key] {
+		if now.Sub(e.storedAt) < c.options.TTL && !sameVary(e.varyValues, varyValues) {
+			variants = append(variants, e)
+		} else {
+			c.count--
+		}
+	}
+
+	c.entries[key] = variants
+
+	if c.options.MaxEntries > 0 && c.count >= c.options.MaxEntries {
+		c.evictOldest()
+	}
+
+	c.entries[key] = append(c.entries[key], &entry{
+		status:     status,
+		header:     header.Clone(),
+		body:       body,
+		storedAt:   now,
+		varyValues: varyValues,
+	})
+	c.count++
+}
+
+// sameVary reports whether two variants were stored for the same header values
+func sameVary(a, b map[string]string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for k, v := range a {
+		if bv, ok := b[k]; !ok || bv != v {
+			return false
+		}
+	}
+	return true
+}
+
+// evictOldest removes the oldest variant; callers must hold mu
+func (c *Cache) evictOldest() {
+	var (
+		oldestKey   string
+		oldestIndex = -1
+		oldestTime  time.Time
+	)
+	for key, variants := range c.entries {
+		for i, e := range variants {
+			if oldestIndex < 0 || e.storedAt.Before(oldestTime) {
+				oldestKey, oldestIndex, oldestTime = key, i, e.storedAt
+			}
+		}
+	}
+	if oldestIndex < 0 {
+		return
+	}
+
+	variants := c.entries[oldestKey]
+	variants = append(variants[:oldestIndex], variants[oldestIndex+1:]...)
+	if len(variants) == 0 {
+		delete(c.entries, oldestKey)
+	} else {
+		c.entries[oldestKey] = variants
+	}
+	c.count--
+}
+
+// Len returns the number of cached response variants
+func (c *Cache) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.count
+}
+
+// recorder writes through to the client while keeping a copy of the response
+type recorder struct {
+	http.ResponseWriter
+	status   int
+	body     bytes.Buffer
+	overflow bool
+	limit    int
+}
+
+func (rec *recorder) WriteHeader(code int) {
+	rec.status = code
+	rec.ResponseWriter.WriteHeader(code)
+}
+
+func (rec *recorder) Write(data []byte) (int, error) {
+	if !rec.overflow {
+		if rec.body.Len()+len(data) > rec.limit {
+			rec.overflow = true
+			rec.body.Reset()
+		} else {
+			rec.body.Write(data)
+		}
+	}
+	return rec.ResponseWriter.Write(data)
+}
+
+// Flush sends what was written so far to the client; the copy is kept
+func (rec *recorder) Flush() {
+	_ = http.NewResponseController(rec.ResponseWriter).Flush()
+}
+
+// Unwrap allows http.ResponseController to reach the underlying writer
+func (rec *recorder) Unwrap() http.ResponseWriter {
+	return rec.ResponseWriter
+}
+
+// Middleware serves cached responses for configured GET routes
+func (c *Cache) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !c.cacheable(r) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		directives := parseRequestDirectives(r)
+		if directives.noStore {
+			w.Header().Set("X-Cache", "BYPASS")
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		key := r.URL.RequestURI()
+		if !directives.noCache {
+			if e, age := c.lookup(key, r, directives.maxAge); e != nil {
+				for name, values := range e.header {
+					w.Header()[name] = values
+				}
+				w.Header().Set("Age", strconv.Itoa(int(age.Seconds())))
+				w.Header().Set("X-Cache", "HIT")
+				w.WriteHeader(e.status)
+				_, _ = w.Write(e.body)
+				return
+			}
+		}
+
+		if directives.onlyIfCached {
+			w.Header().Set("X-Cache", "MISS")
+			http.Error(w, "Not cached", http.StatusGatewayTimeout)
+			return
+		}
+
+		w.Header().Set("X-Cache", "MISS")
+		rec := &recorder{ResponseWriter: w, status: http.StatusOK, limit: c.options.MaxBodyBytes}
+		next.ServeHTTP(rec, r)
+
+		if rec.status == http.StatusOK && !rec.overflow {
+			header := w.Header().Clone()
+			header.Del("X-Cache")
+			c.store(key, r, rec.status, header, bytes.Clone(rec.body.Bytes()))
+		}
+	})
+}
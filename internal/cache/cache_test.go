@@ -0,0 +1,186 @@
+package cache
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// newTestCache returns a cache with a controllable clock and a counting handler
+func newTestCache(options Options) (*Cache, *time.Time, http.Handler, *int32) {
+	c := New(options)
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	c.now = func() time.Time { return now }
+
+	var calls int32
+	handler := c.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := atomic.AddInt32(&calls, 1)
+		if r.URL.Path == "/cached/vary" {
+			w.Header().Set("Vary", "Accept-Language")
+		}
+		if r.URL.Path == "/cached/error" {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "text/plain")
+		fmt.Fprintf(w, "response %d", n)
+	}))
+	return c, &now, handler, &calls
+}
+
+func serve(handler http.Handler, path string, headers map[string]string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest("GET", path, nil)
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	return w
+}
+
+func TestMiddleware(t *testing.T) {
+	t.Run("miss then hit with age", func(t *testing.T) {
+		_, now, handler, calls := newTestCache(Options{Routes: []string{"/cached"}, TTL: time.Minute})
+
+		first := serve(handler, "/cached/a", nil)
+		assert.Equal(t, "MISS", first.Header().Get("X-Cache"))
+		assert.Equal(t, "response 1", first.Body.String())
+
+		*now = now.Add(5 * time.Second)
+		second := serve(handler, "/cached/a", nil)
+		assert.Equal(t, "HIT", second.Header().Get("X-Cache"))
+		assert.Equal(t, "5", second.Header().Get("Age"))
+		assert.Equal(t, "text/plain", second.Header().Get("Content-Type"))
+		assert.Equal(t, "response 1", second.Body.String())
+		assert.Equal(t, int32(1), atomic.LoadInt32(calls))
+	})
+
+	t.Run("entries expire after TTL", func(t *testing.T) {
+		_, now, handler, calls := newTestCache(Options{Routes: []string{"/cached"}, TTL: time.Minute})
+
+		serve(handler, "/cached/a", nil)
+		*now = now.Add(time.Minute)
+		w := serve(handler, "/cached/a", nil)
+		assert.Equal(t, "MISS", w.Header().Get("X-Cache"))
+		assert.Equal(t, int32(2), atomic.LoadInt32(calls))
+	})
+
+	t.Run("unconfigured routes and other methods are not cached", func(t *testing.T) {
+		_, _, handler, calls := newTestCache(Options{Routes: []string{"/cached"}, TTL: time.Minute})
+
+		w := serve(handler, "/other", nil)
+		assert.Empty(t, w.Header().Get("X-Cache"))
+
+		req := httptest.NewRequest("POST", "/cached/a", nil)
+		handler.ServeHTTP(httptest.NewRecorder(), req)
+		handler.ServeHTTP(httptest.NewRecorder(), req)
+		assert.Equal(t, int32(3), atomic.LoadInt32(calls))
+	})
+
+	t.Run("non-200 responses are not stored", func(t *testing.T) {
+		c, _, handler, _ := newTestCache(Options{Routes: []string{"/cached"}, TTL: time.Minute})
+
+		serve(handler, "/cached/error", nil)
+		assert.Equal(t, 0, c.Len())
+	})
+
+	t.Run("request cache-control directives", func(t *testing.T) {
+		_, now, handler, calls := newTestCache(Options{Routes: []string{"/cached"}, TTL: time.Minute})
+		serve(handler, "/cached/a", nil)
+
+		w := serve(handler, "/cached/a", map[string]string{"Cache-Control": "no-store"})
+		assert.Equal(t, "BYPASS", w.Header().Get("X-Cache"))
+		assert.Equal(t, int32(2), atomic.LoadInt32(calls))
+
+		w = serve(handler, "/cached/a", map[string]string{"Cache-Control": "no-cache"})
+		assert.Equal(t, "MISS", w.Header().Get("X-Cache"))
+		assert.Equal(t, "response 3", w.Body.String())
+
+		// The refetched response replaced the cached variant
+		w = serve(handler, "/cached/a", nil)
+		assert.Equal(t, "response 3", w.Body.String())
+
+		*now = now.Add(10 * time.Second)
+		w = serve(handler, "/cached/a", map[string]string{"Cache-Control": "max-age=5"})
+		assert.Equal(t, "MISS", w.Header().Get("X-Cache"))
+		assert.Equal(t, int32(4), atomic.LoadInt32(calls))
+
+		w = serve(handler, "/cached/missing", map[string]string{"Cache-Control": "only-if-cached"})
+		assert.Equal(t, http.StatusGatewayTimeout, w.Code)
+		assert.Equal(t, int32(4), atomic.LoadInt32(calls))
+	})
+
+	t.Run("vary header keeps separate variants", func(t *testing.T) {
+		c, _, handler, calls := newTestCache(Options{Routes: []string{"/cached"}, TTL: time.Minute})
+
+		en := serve(handler, "/cached/vary", map[string]string{"Accept-Language": "en"})
+		de := serve(handler, "/cached/vary", map[string]string{"Accept-Language": "de"})
+		assert.Equal(t, "response 1", en.Body.String())
+		assert.Equal(t, "response 2", de.Body.String())
+		assert.Equal(t, 2, c.Len())
+
+		w := serve(handler, "/cached/vary", map[string]string{"Accept-Language": "de"})
+		assert.Equal(t, "HIT", w.Header().Get("X-Cache"))
+		assert.Equal(t, "response 2", w.Body.String())
+		assert.Equal(t, int32(2), atomic.LoadInt32(calls))
+	})
+
+	t.Run("oldest entries are evicted", func(t *testing.T) {
+		c, now, handler, _ := newTestCache(Options{Routes: []string{"/cached"}, TTL: time.Minute, MaxEntries: 2})
+
+		serve(handler, "/cached/a", nil)
+		*now = now.Add(time.Second)
+		serve(handler, "/cached/b", nil)
+		*now = now.Add(time.Second)
+		serve(handler, "/cached/c", nil)
+		assert.Equal(t, 2, c.Len())
+
+		w := serve(handler, "/cached/a", nil)
+		assert.Equal(t, "MISS", w.Header().Get("X-Cache"))
+	})
+
+	t.Run("large responses are not stored", func(t *testing.T) {
+		c, _, handler, _ := newTestCache(Options{Routes: []string{"/cached"}, TTL: time.Minute, MaxBodyBytes: 4})
+
+		serve(handler, "/cached/a", nil)
+		assert.Equal(t, 0, c.Len())
+	})
+}
+
+func TestMiddlewareFlush(t *testing.T) {
+	c := New(Options{Routes: []string{"/cached"}, TTL: time.Minute})
+	var flushErr error
+	var unwrapped bool
+	handler := c.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("streamed"))
+		flushErr = http.NewResponseController(w).Flush()
+		_, unwrapped = w.(interface{ Unwrap() http.ResponseWriter })
+	}))
+
+	w := serve(handler, "/cached/stream", nil)
+	assert.NoError(t, flushErr)
+	assert.True(t, unwrapped)
+	assert.True(t, w.Flushed, "flushes reach the client")
+	assert.Equal(t, 1, c.Len(), "flushed responses are still cached")
+}
+
+func TestParseRequestDirectives(t *testing.T) {
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set("Cache-Control", "No-Cache, max-age=\"30\", only-if-cached")
+	d := parseRequestDirectives(req)
+	assert.True(t, d.noCache)
+	assert.True(t, d.onlyIfCached)
+	assert.False(t, d.noStore)
+	assert.Equal(t, 30*time.Second, d.maxAge)
+
+	req = httptest.NewRequest("GET", "/", nil)
+	req.Header.Set("Pragma", "no-cache")
+	d = parseRequestDirectives(req)
+	assert.True(t, d.noCache)
+	assert.Equal(t, time.Duration(-1), d.maxAge)
+}
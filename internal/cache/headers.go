@@ -0,0 +1,241 @@
+package cache
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+const (
+	maxHeaderRules     = 100
+	maxHeaderRuleBytes = 64 << 10
+)
+
+// HeaderRule sets the cacheability headers of GET and HEAD responses of a
+// route. Directives left nil are omitted; Cache-Control is only replaced when
+// at least one of its directives is set.
+type HeaderRule struct {
+	Route                string `json:"route" schema:"required"`                             // Path prefix, the longest matching prefix wins
+	MaxAge               *int   `json:"max_age,omitempty" schema:"minimum=0"`                // Cache-Control max-age in seconds
+	SMaxAge              *int   `json:"s_maxage,omitempty" schema:"minimum=0"`               // Cache-Control s-maxage in seconds
+	StaleWhileRevalidate *int   `json:"stale_while_revalidate,omitempty" schema:"minimum=0"` // Cache-Control stale-while-revalidate in seconds
+	SurrogateMaxAge      *int   `json:"surrogate_max_age,omitempty" schema:"minimum=0"`      // Surrogate-Control max-age in seconds
+}
+
+// HeaderRules is the body accepted by HeaderPolicy.Handler and LoadHeaderRules
+type HeaderRules struct {
+	Rules []HeaderRule `json:"rules"`
+}
+
+// cacheControl renders the Cache-Control value of the rule
+func (hr HeaderRule) cacheControl() string {
+	var directives []string
+	for _, d := range []struct {
+		name  string
+		value *int
+	}{
+		{"max-age", hr.MaxAge},
+		{"s-maxage", hr.SMaxAge},
+		{"stale-while-revalidate", hr.StaleWhileRevalidate},
+	} {
+		if d.value != nil {
+			directives = append(directives, d.name+"="+strconv.Itoa(*d.value))
+		}
+	}
+	if len(directives) == 0 {
+		return ""
+	}
+	return strings.Join(append([]string{"public"}, directives...), ", ")
+}
+
+// validate checks the route and directive values of the rule
+func (hr HeaderRule) validate() error {
+	if !strings.HasPrefix(hr.Route, "/") {
+		return fmt.Errorf("route '%s' must start with /", hr.Route)
+	}
+	for _, value := range []*int{hr.MaxAge, hr.SMaxAge, hr.StaleWhileRevalidate, hr.SurrogateMaxAge} {
+		if value != nil && *value < 0 {
+			return fmt.Errorf("route '%s': directive values must not be negative", hr.Route)
+		}
+	}
+	return nil
+}
+
+// HeaderPolicy rewrites the cacheability headers of responses based on rules
+// that can be replaced at runtime, so CDN and gateway caching can be swept
+// across TTL values without a redeploy
+type HeaderPolicy struct {
+	mu    sync.RWMutex
+	rules []HeaderRule
+}
+
+// NewHeaderPolicy creates a policy without rules
+func NewHeaderPolicy() *HeaderPolicy {
+	return &HeaderPolicy{}
+}
+
+// Set validates and replaces the rules of the policy
+func (p *HeaderPolicy) Set(rules []HeaderRule) error {
+	if len(rules) > maxHeaderRules {
+		return fmt.Errorf("at most %d rules are allowed", maxHeaderRules)
+	}
+	for _, rule := range rules {
+		if err := rule.validate(); err != nil {
+			return err
+		}
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.rules = append([]HeaderRule(nil), rules...)
+	return nil
+}
+
+// Rules returns a copy of the current rules
+func (p *HeaderPolicy) Rules() []HeaderRule {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return append([]HeaderRule{}, p.rules...)
+}
+
+// match returns the rule with the longest route prefix of path
+func (p *HeaderPolicy) match(path string) (HeaderRule, bool) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	var best HeaderRule
+	found := false
+	for _, rule := range p.rules {
+		if strings.HasPrefix(path, rule.Route) && (!found || len(rule.Route) > len(best.Route)) {
+			best, found = rule, true
+		}
+	}
+	return best, found
+}
+
+// headerWriter applies a rule to the response headers before they are sent
+type headerWriter struct {
+	http.ResponseWriter
+	rule        HeaderRule
+	wroteHeader bool
+}
+
+func (w *headerWriter) apply(code int) {
+	if w.wroteHeader {
+		return
+	}
+	w.wroteHeader = true
+
+	// Errors keep the no-store default of the handlers
+	if code >= http.StatusBadRequest {
+		return
+	}
+	h := w.ResponseWriter.Header()
+	if value := w.rule.cacheControl(); value != "" {
+		h.Set("Cache-Control", value)
+		h.Del("Pragma")
+		h.Del("Expires")
+	}
+	if w.rule.SurrogateMaxAge != nil {
+		h.Set("Surrogate-Control", "max-age="+strconv.Itoa(*w.rule.SurrogateMaxAge))
+	}
+}
+
+func (w *headerWriter) WriteHeader(code int) {
+	w.apply(code)
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *headerWriter) Write(b []byte) (int, error) {
+	w.apply(http.StatusOK)
+	return w.ResponseWriter.Write(b)
+}
+
+// Unwrap allows http.ResponseController to reach the underlying writer
+func (w *headerWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// Middleware sets the cacheability headers of successful GET and HEAD
+// responses of routes matching a rule
+func (p *HeaderPolicy) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			next.ServeHTTP(w, r)
+			return
+		}
+		rule, ok := p.match(r.URL.Path)
+		if !ok {
+			next.ServeHTTP(w, r)
+			return
+		}
+		next.ServeHTTP(&headerWriter{ResponseWriter: w, rule: rule}, r)
+	})
+}
+
+// decodeHeaderRules strictly decodes a HeaderRules document
+func decodeHeaderRules(decoder *json.Decoder) ([]HeaderRule, error) {
+	decoder.DisallowUnknownFields()
+	var rules HeaderRules
+	if err := decoder.Decode(&rules); err != nil {
+		return nil, err
+	}
+	if decoder.More() {
+		return nil, errors.New("unexpected data after JSON object")
+	}
+	return rules.Rules, nil
+}
+
+// LoadHeaderRules reads a HeaderRules document from a file, e.g. a mounted ConfigMap
+func LoadHeaderRules(path string) ([]HeaderRule, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open header rules: %w", err)
+	}
+	defer file.Close()
+
+	rules, err := decodeHeaderRules(json.NewDecoder(file))
+	if err != nil {
+		return nil, fmt.Errorf("invalid header rules in %s: %w", path, err)
+	}
+	return rules, nil
+}
+
+// Handler serves the rules on GET, replaces them on PUT and removes them on DELETE
+func (p *HeaderPolicy) Handler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodPut:
+			rules, err := decodeHeaderRules(json.NewDecoder(http.MaxBytesReader(w, r.Body, maxHeaderRuleBytes)))
+			if err != nil {
+				var maxBytesErr *http.MaxBytesError
+				if errors.As(err, &maxBytesErr) {
+					http.Error(w, fmt.Sprintf("Rules exceed %d bytes", maxHeaderRuleBytes), http.StatusRequestEntityTooLarge)
+					return
+				}
+				http.Error(w, fmt.Sprintf("Invalid rules: %v", err), http.StatusBadRequest)
+				return
+			}
+			if err := p.Set(rules); err != nil {
+				http.Error(w, fmt.Sprintf("Invalid rules: %v", err), http.StatusBadRequest)
+				return
+			}
+		case http.MethodDelete:
+			_ = p.Set(nil)
+		}
+
+		jsonData, err := json.Marshal(HeaderRules{Rules: p.Rules()})
+		if err != nil {
+			http.Error(w, "Failed to encode rules", http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		_, _ = w.Write(jsonData)
+	}
+}
@@ -0,0 +1,112 @@
+package cache
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"istio-test/internal/security"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func seconds(n int) *int { return &n }
+
+// newHeaderTestHandler returns the policy middleware around a handler that sets
+// the default no-store headers like every secured route
+func newHeaderTestHandler(p *HeaderPolicy) http.Handler {
+	return p.Middleware(security.SecureHandler([]string{"GET", "HEAD", "POST"}, func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/metadata/error" {
+			http.Error(w, "failed", http.StatusBadGateway)
+			return
+		}
+		_, _ = w.Write([]byte("ok"))
+	}))
+}
+
+func TestHeaderPolicyMiddleware(t *testing.T) {
+	p := NewHeaderPolicy()
+	require.NoError(t, p.Set([]HeaderRule{
+		{Route: "/metadata/", MaxAge: seconds(60), SMaxAge: seconds(300), StaleWhileRevalidate: seconds(30)},
+		{Route: "/metadata/zone", MaxAge: seconds(0), SurrogateMaxAge: seconds(3600)},
+		{Route: "/surrogate/", SurrogateMaxAge: seconds(10)},
+	}))
+	handler := newHeaderTestHandler(p)
+
+	w := serve(handler, "/metadata/cluster-name", nil)
+	assert.Equal(t, "public, max-age=60, s-maxage=300, stale-while-revalidate=30", w.Header().Get("Cache-Control"))
+	assert.Empty(t, w.Header().Get("Pragma"))
+	assert.Empty(t, w.Header().Get("Expires"))
+	assert.Empty(t, w.Header().Get("Surrogate-Control"))
+
+	// The longest prefix wins
+	w = serve(handler, "/metadata/zone", nil)
+	assert.Equal(t, "public, max-age=0", w.Header().Get("Cache-Control"))
+	assert.Equal(t, "max-age=3600", w.Header().Get("Surrogate-Control"))
+
+	// Surrogate-Control alone keeps the default Cache-Control
+	w = serve(handler, "/surrogate/x", nil)
+	assert.Equal(t, "no-cache, no-store, must-revalidate, private", w.Header().Get("Cache-Control"))
+	assert.Equal(t, "max-age=10", w.Header().Get("Surrogate-Control"))
+
+	// Errors, other methods and unmatched routes are untouched
+	w = serve(handler, "/metadata/error", nil)
+	assert.Equal(t, "no-cache, no-store, must-revalidate, private", w.Header().Get("Cache-Control"))
+
+	req := httptest.NewRequest(http.MethodPost, "/metadata/cluster-name", nil)
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	assert.Equal(t, "no-cache, no-store, must-revalidate, private", w.Header().Get("Cache-Control"))
+
+	w = serve(handler, "/other", nil)
+	assert.Equal(t, "no-cache, no-store, must-revalidate, private", w.Header().Get("Cache-Control"))
+}
+
+func TestHeaderPolicySetRejectsInvalidRules(t *testing.T) {
+	p := NewHeaderPolicy()
+	assert.Error(t, p.Set([]HeaderRule{{Route: "metadata"}}))
+	assert.Error(t, p.Set([]HeaderRule{{Route: "/metadata/", MaxAge: seconds(-1)}}))
+	assert.Empty(t, p.Rules())
+}
+
+func TestHeaderPolicyHandler(t *testing.T) {
+	p := NewHeaderPolicy()
+	handler := p.Handler()
+
+	put := func(body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		handler(w, httptest.NewRequest(http.MethodPut, "/admin/cache-control", strings.NewReader(body)))
+		return w
+	}
+
+	w := put(`{"rules":[{"route":"/istio-test/metadata/","max_age":60}]}`)
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `{"rules":[{"route":"/istio-test/metadata/","max_age":60}]}`, w.Body.String())
+
+	assert.Equal(t, http.StatusBadRequest, put(`{"rules":[{"route":"/","ttl":60}]}`).Code)
+	assert.Equal(t, http.StatusBadRequest, put(`{"rules":[{"route":"/","max_age":-5}]}`).Code)
+	assert.Len(t, p.Rules(), 1)
+
+	w = httptest.NewRecorder()
+	handler(w, httptest.NewRequest(http.MethodDelete, "/admin/cache-control", nil))
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `{"rules":[]}`, w.Body.String())
+}
+
+func TestLoadHeaderRules(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "rules.json")
+	require.NoError(t, os.WriteFile(path, []byte(`{"rules":[{"route":"/","s_maxage":120}]}`), 0o600))
+
+	rules, err := LoadHeaderRules(path)
+	require.NoError(t, err)
+	require.Len(t, rules, 1)
+	assert.Equal(t, 120, *rules[0].SMaxAge)
+
+	_, err = LoadHeaderRules(filepath.Join(dir, "missing.json"))
+	assert.Error(t, err)
+}
@@ -0,0 +1,121 @@
+// Package catalog registers the pod in an external service catalog.
+//
+// On startup the pod's identity, version and capabilities are POSTed to the
+// configured registry URL; on shutdown the registration is removed with a
+// DELETE to {url}/{id}. Fleets of istio-test instances across clusters can
+// then be discovered by a test orchestrator without static inventories.
+package catalog
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"istio-test/internal/httpclient"
+	"istio-test/internal/metadata"
+	"istio-test/internal/observability"
+)
+
+// Registration describes the pod to the catalog
+type Registration struct {
+	ID           string    `json:"id"` // Pod name, unique within the fleet together with Cluster
+	Version      string    `json:"version"`
+	Cluster      string    `json:"cluster,omitempty"`
+	Zone         string    `json:"zone,omitempty"`
+	HTTPPort     string    `json:"http_port"`
+	GRPCPort     string    `json:"grpc_port,omitempty"`
+	Capabilities []string  `json:"capabilities"` // Route patterns served by the pod
+	StartedAt    time.Time `json:"started_at"`
+}
+
+// Registrar registers and deregisters the pod
+type Registrar struct {
+	client *httpclient.Client
+	url    string
+	fetch  func(ctx context.Context, url string) (string, error)
+}
+
+// New creates a registrar for the catalog at registryURL; fetch retrieves the
+// cluster name and zone from the metadata server and may be nil
+func New(client *httpclient.Client, registryURL string, fetch func(ctx context.Context, url string) (string, error)) *Registrar {
+	return &Registrar{
+		client: client,
+		url:    strings.TrimSuffix(registryURL, "/"),
+		fetch:  fetch,
+	}
+}
+
+// locate fills in the cluster and zone of the registration when known
+func (r *Registrar) locate(ctx context.Context, registration *Registration) {
+	if r.fetch == nil {
+		return
+	}
+	if registration.Cluster == "" {
+		if cluster, err := r.fetch(ctx, metadata.ClusterNameURL); err == nil {
+			registration.Cluster = cluster
+		}
+	}
+	if registration.Zone == "" {
+		if zone, err := r.fetch(ctx, metadata.InstanceZoneURL); err == nil {
+			registration.Zone = zone[strings.LastIndex(zone, "/")+1:]
+		}
+	}
+}
+
+// Register announces the pod to the catalog
+func (r *Registrar) Register(ctx context.Context, registration Registration) error {
+	r.locate(ctx, &registration)
+
+	body, err := json.Marshal(registration)
+	if err != nil {
+		return fmt.Errorf("failed to encode registration: %w", err)
+	}
+
+	err = r.send(ctx, func(ctx context.Context) (*http.Request, error) {
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, r.url, bytes.NewReader(body))
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Content-Type", "application/json")
+		return req, nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to register with catalog: %w", err)
+	}
+	observability.InfoWithContext(ctx, fmt.Sprintf("Registered %s with catalog %s", registration.ID, r.url))
+	return nil
+}
+
+// Deregister removes the registration of the pod with the given ID
+func (r *Registrar) Deregister(ctx context.Context, id string) error {
+	err := r.send(ctx, func(ctx context.Context) (*http.Request, error) {
+		return http.NewRequestWithContext(ctx, http.MethodDelete, r.url+"/"+url.PathEscape(id), nil)
+	})
+	if err != nil {
+		return fmt.Errorf("failed to deregister from catalog: %w", err)
+	}
+	observability.InfoWithContext(ctx, fmt.Sprintf("Deregistered %s from catalog %s", id, r.url))
+	return nil
+}
+
+// send issues the request and treats any non-2xx response as an error
+func (r *Registrar) send(ctx context.Context, newRequest func(ctx context.Context) (*http.Request, error)) error {
+	resp, err := r.client.Do(ctx, newRequest)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("catalog responded with status %d: %s", resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+	_, _ = io.Copy(io.Discard, resp.Body)
+	return nil
+}
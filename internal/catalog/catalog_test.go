@@ -0,0 +1,85 @@
+package catalog
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"istio-test/internal/httpclient"
+	"istio-test/internal/metadata"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func mockFetch(ctx context.Context, url string) (string, error) {
+	switch url {
+	case metadata.ClusterNameURL:
+		return "test-cluster", nil
+	case metadata.InstanceZoneURL:
+		return "projects/123/zones/us-east1-b", nil
+	}
+	return "", errors.New("unknown URL")
+}
+
+func newClient() *httpclient.Client {
+	return httpclient.NewFactory(nil, nil).Client("catalog-test")
+}
+
+func TestRegisterAndDeregister(t *testing.T) {
+	type received struct {
+		method string
+		path   string
+		body   []byte
+	}
+	requests := make(chan received, 2)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		requests <- received{method: r.Method, path: r.URL.Path, body: body}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer ts.Close()
+
+	registrar := New(newClient(), ts.URL+"/instances/", mockFetch)
+	startedAt := time.Now().UTC().Truncate(time.Second)
+	require.NoError(t, registrar.Register(context.Background(), Registration{
+		ID:           "pod-1",
+		Version:      "v1",
+		HTTPPort:     "8080",
+		Capabilities: []string{"/istio-test/echo"},
+		StartedAt:    startedAt,
+	}))
+
+	req := <-requests
+	assert.Equal(t, http.MethodPost, req.method)
+	assert.Equal(t, "/instances", req.path)
+	var registration Registration
+	require.NoError(t, json.Unmarshal(req.body, &registration))
+	assert.Equal(t, "pod-1", registration.ID)
+	assert.Equal(t, "test-cluster", registration.Cluster)
+	assert.Equal(t, "us-east1-b", registration.Zone)
+	assert.Equal(t, []string{"/istio-test/echo"}, registration.Capabilities)
+	assert.Equal(t, startedAt, registration.StartedAt)
+
+	require.NoError(t, registrar.Deregister(context.Background(), "pod-1"))
+	req = <-requests
+	assert.Equal(t, http.MethodDelete, req.method)
+	assert.Equal(t, "/instances/pod-1", req.path)
+}
+
+func TestRegisterRejected(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "duplicate instance", http.StatusConflict)
+	}))
+	defer ts.Close()
+
+	err := New(newClient(), ts.URL, nil).Register(context.Background(), Registration{ID: "pod-1"})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "409")
+	assert.Contains(t, err.Error(), "duplicate instance")
+}
@@ -0,0 +1,170 @@
+// Package certreload serves a TLS certificate from files that may change
+// while the process runs.
+//
+// The server can terminate TLS itself so it can be compared with sidecar TLS
+// termination. Certificates mounted from Kubernetes secrets or written by
+// cert-manager are rotated in place; the Reloader polls the files and swaps
+// the served certificate without dropping the listener. A failed reload keeps
+// serving the previous certificate.
+package certreload
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"istio-test/internal/observability"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// DefaultInterval is the polling interval used when Run is given none
+const DefaultInterval = 30 * time.Second
+
+var (
+	reloads = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "istio_test",
+		Name:      "tls_certificate_reloads_total",
+		Help:      "Total number of serving certificate reloads by result.",
+	}, []string{"result"})
+
+	expiry = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: "istio_test",
+		Name:      "tls_certificate_expiry_timestamp_seconds",
+		Help:      "Expiry of the serving certificate as a Unix timestamp.",
+	})
+)
+
+func init() {
+	observability.MetricsRegistry().MustRegister(reloads, expiry)
+}
+
+// fileVersion identifies the content of a file without reading it
+type fileVersion struct {
+	modTime time.Time
+	size    int64
+}
+
+// Reloader holds the serving certificate loaded from a cert and key file
+type Reloader struct {
+	certFile string
+	keyFile  string
+
+	mu       sync.RWMutex
+	cert     *tls.Certificate
+	versions [2]fileVersion
+}
+
+// New loads the certificate and key, so bad mounts fail at startup
+func New(certFile, keyFile string) (*Reloader, error) {
+	r := &Reloader{certFile: certFile, keyFile: keyFile}
+	if err := r.Reload(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// Reload reads the certificate and key files and serves them if they are valid
+func (r *Reloader) Reload() error {
+	versions, err := r.stat()
+	if err != nil {
+		reloads.WithLabelValues("error").Inc()
+		return err
+	}
+
+	cert, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+	if err != nil {
+		reloads.WithLabelValues("error").Inc()
+		return fmt.Errorf("error loading serving certificate: %w", err)
+	}
+	leaf, err := x509.ParseCertificate(cert.Certificate[0])
+	if err != nil {
+		reloads.WithLabelValues("error").Inc()
+		return fmt.Errorf("error parsing serving certificate: %w", err)
+	}
+	cert.Leaf = leaf
+
+	r.mu.Lock()
+	r.cert = &cert
+	r.versions = versions
+	r.mu.Unlock()
+
+	reloads.WithLabelValues("success").Inc()
+	expiry.Set(float64(leaf.NotAfter.Unix()))
+	return nil
+}
+
+// stat returns the current versions of the certificate and key files
+func (r *Reloader) stat() ([2]fileVersion, error) {
+	var versions [2]fileVersion
+	for i, path := range []string{r.certFile, r.keyFile} {
+		// Stat follows the symlinks Kubernetes swaps when a secret is updated
+		info, err := os.Stat(path)
+		if err != nil {
+			return versions, fmt.Errorf("error reading serving certificate: %w", err)
+		}
+		versions[i] = fileVersion{modTime: info.ModTime(), size: info.Size()}
+	}
+	return versions, nil
+}
+
+// changed reports whether either file differs from the loaded version
+func (r *Reloader) changed() bool {
+	versions, err := r.stat()
+	if err != nil {
+		// Files are often briefly missing mid-rotation; retry next interval
+		return false
+	}
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return versions != r.versions
+}
+
+// Certificate returns the certificate currently served
+func (r *Reloader) Certificate() *tls.Certificate {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.cert
+}
+
+// GetCertificate implements tls.Config.GetCertificate
+func (r *Reloader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	return r.Certificate(), nil
+}
+
+// TLSConfig returns a server TLS configuration serving the reloaded certificate
+func (r *Reloader) TLSConfig() *tls.Config {
+	return &tls.Config{
+		MinVersion:     tls.VersionTLS12,
+		GetCertificate: r.GetCertificate,
+	}
+}
+
+// Run reloads the certificate whenever the files change until ctx is done
+func (r *Reloader) Run(ctx context.Context, interval time.Duration) {
+	if interval <= 0 {
+		interval = DefaultInterval
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if !r.changed() {
+				continue
+			}
+			if err := r.Reload(); err != nil {
+				observability.WarnWithContext(ctx, fmt.Sprintf("Serving certificate reload failed, keeping the previous certificate: %v", err))
+				continue
+			}
+			observability.InfoWithContext(ctx, fmt.Sprintf("Serving certificate reloaded, expires %s", r.Certificate().Leaf.NotAfter.Format(time.RFC3339)))
+		}
+	}
+}
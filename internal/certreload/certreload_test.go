@@ -0,0 +1,120 @@
+package certreload
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// writeCert writes a self-signed certificate and key for commonName into dir
+func writeCert(t *testing.T, dir, commonName string) (string, string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: commonName},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	require.NoError(t, err)
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	require.NoError(t, err)
+
+	certFile := filepath.Join(dir, "tls.crt")
+	keyFile := filepath.Join(dir, "tls.key")
+	require.NoError(t, os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600))
+	require.NoError(t, os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0600))
+	return certFile, keyFile
+}
+
+func TestNew(t *testing.T) {
+	dir := t.TempDir()
+
+	_, err := New(filepath.Join(dir, "missing.crt"), filepath.Join(dir, "missing.key"))
+	assert.Error(t, err)
+
+	certFile, keyFile := writeCert(t, dir, "first")
+	r, err := New(certFile, keyFile)
+	require.NoError(t, err)
+	assert.Equal(t, "first", r.Certificate().Leaf.Subject.CommonName)
+	assert.Equal(t, float64(r.Certificate().Leaf.NotAfter.Unix()), testutil.ToFloat64(expiry))
+}
+
+func TestRunReloadsChangedFiles(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile := writeCert(t, dir, "first")
+	r, err := New(certFile, keyFile)
+	require.NoError(t, err)
+	assert.False(t, r.changed())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go r.Run(ctx, 10*time.Millisecond)
+
+	// A broken key keeps the previous certificate
+	failures := testutil.ToFloat64(reloads.WithLabelValues("error"))
+	require.NoError(t, os.WriteFile(keyFile, []byte("not a key"), 0600))
+	assert.Eventually(t, func() bool {
+		return testutil.ToFloat64(reloads.WithLabelValues("error")) > failures
+	}, time.Second, 5*time.Millisecond)
+	assert.Equal(t, "first", r.Certificate().Leaf.Subject.CommonName)
+
+	writeCert(t, dir, "second")
+	assert.Eventually(t, func() bool {
+		return r.Certificate().Leaf.Subject.CommonName == "second"
+	}, time.Second, 5*time.Millisecond)
+}
+
+func TestTLSConfig(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile := writeCert(t, dir, "first")
+	r, err := New(certFile, keyFile)
+	require.NoError(t, err)
+
+	ts := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Write([]byte("ok"))
+	}))
+	ts.TLS = r.TLSConfig()
+	ts.StartTLS()
+	defer ts.Close()
+
+	// httptest adds its own certificate, which is only served without SNI
+	serverName := func() string {
+		client := &http.Client{Transport: &http.Transport{
+			TLSClientConfig:   &tls.Config{ServerName: "istio-test", InsecureSkipVerify: true},
+			DisableKeepAlives: true,
+		}}
+		resp, err := client.Get(ts.URL)
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		_, _ = io.Copy(io.Discard, resp.Body)
+		return resp.TLS.PeerCertificates[0].Subject.CommonName
+	}
+	assert.Equal(t, "first", serverName())
+
+	// New connections are served the reloaded certificate
+	writeCert(t, dir, "second")
+	require.NoError(t, r.Reload())
+	assert.Equal(t, "second", serverName())
+}
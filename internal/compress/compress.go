@@ -0,0 +1,260 @@
+// Package compress compresses responses negotiated through Accept-Encoding.
+//
+// The service is used as the origin behind Envoy's compression filter, so it
+// can serve both variants itself: responses are compressed with gzip or
+// deflate only when the client asks for it, the body is large enough and its
+// content type is compressible. Responses that already carry a
+// Content-Encoding, ranges and upgrades pass through unchanged.
+package compress
+
+import (
+	"compress/flate"
+	"compress/gzip"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+
+	"istio-test/internal/observability"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Supported content codings in order of preference
+const (
+	EncodingGzip    = "gzip"
+	EncodingDeflate = "deflate"
+)
+
+// DefaultContentTypes are compressed when Options.ContentTypes is empty
+var DefaultContentTypes = []string{"text/", "application/json", "application/problem+json", "application/javascript", "application/xml", "image/svg+xml"}
+
+var compressedResponses = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Namespace: "istio_test",
+	Name:      "compressed_responses_total",
+	Help:      "Total number of responses compressed by the application, by content coding.",
+}, []string{"encoding"})
+
+func init() {
+	observability.MetricsRegistry().MustRegister(compressedResponses)
+}
+
+// Options configures the compression middleware
+type Options struct {
+	MinSize      int      // Bodies smaller than this are sent uncompressed
+	ContentTypes []string // Media types to compress; entries ending in "/" match a whole type
+}
+
+var (
+	gzipWriters  = sync.Pool{New: func() any { return gzip.NewWriter(io.Discard) }}
+	flateWriters = sync.Pool{New: func() any {
+		w, _ := flate.NewWriter(io.Discard, flate.DefaultCompression)
+		return w
+	}}
+)
+
+// compressor is implemented by the pooled gzip and flate writers
+type compressor interface {
+	io.WriteCloser
+	Flush() error
+	Reset(io.Writer)
+}
+
+// Negotiate returns the preferred supported coding of an Accept-Encoding
+// header, or an empty string when the response must not be compressed
+func Negotiate(acceptEncoding string) string {
+	qualities := make(map[string]float64)
+	for _, part := range strings.Split(acceptEncoding, ",") {
+		coding, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		coding = strings.ToLower(strings.TrimSpace(coding))
+		if coding == "" {
+			continue
+		}
+		q := 1.0
+		if name, value, ok := strings.Cut(strings.TrimSpace(params), "="); ok && strings.TrimSpace(name) == "q" {
+			if parsed, err := strconv.ParseFloat(strings.TrimSpace(value), 64); err == nil {
+				q = parsed
+			}
+		}
+		qualities[coding] = q
+	}
+
+	best, bestQ := "", 0.0
+	for _, coding := range []string{EncodingGzip, EncodingDeflate} {
+		q, ok := qualities[coding]
+		if !ok {
+			q, ok = qualities["*"]
+		}
+		if ok && q > bestQ {
+			best, bestQ = coding, q
+		}
+	}
+	return best
+}
+
+// compressible reports whether contentType matches one of types
+func compressible(contentType string, types []string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+	for _, t := range types {
+		if strings.HasSuffix(t, "/") && strings.HasPrefix(mediaType, t) || mediaType == t {
+			return true
+		}
+	}
+	return false
+}
+
+// compressWriter holds back the start of a response until it knows whether to
+// compress it
+type compressWriter struct {
+	http.ResponseWriter
+	options  Options
+	encoding string
+
+	status     int
+	buf        []byte
+	decided    bool
+	compressor compressor
+}
+
+func (w *compressWriter) WriteHeader(code int) {
+	// Informational responses are sent as they are
+	if w.decided || code < http.StatusOK {
+		w.ResponseWriter.WriteHeader(code)
+		return
+	}
+	if w.status == 0 {
+		w.status = code
+	}
+}
+
+func (w *compressWriter) Write(b []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	if w.decided {
+		if w.compressor != nil {
+			return w.compressor.Write(b)
+		}
+		return w.ResponseWriter.Write(b)
+	}
+
+	w.buf = append(w.buf, b...)
+	if len(w.buf) >= w.options.MinSize {
+		if err := w.decide(true); err != nil {
+			return 0, err
+		}
+	}
+	return len(b), nil
+}
+
+// decide sends the headers, compressed when the response qualifies, and the
+// buffered start of the body. large reports whether the body reached the
+// minimum size.
+func (w *compressWriter) decide(large bool) error {
+	w.decided = true
+	h := w.ResponseWriter.Header()
+	if h.Get("Content-Type") == "" && len(w.buf) > 0 {
+		h.Set("Content-Type", http.DetectContentType(w.buf))
+	}
+
+	eligible := h.Get("Content-Encoding") == "" && h.Get("Content-Range") == "" &&
+		w.status != http.StatusNoContent && w.status != http.StatusNotModified && w.status != http.StatusPartialContent &&
+		compressible(h.Get("Content-Type"), w.options.ContentTypes)
+	if eligible {
+		h.Add("Vary", "Accept-Encoding")
+	}
+
+	if eligible && large && w.encoding != "" {
+		h.Set("Content-Encoding", w.encoding)
+		h.Del("Content-Length")
+		if etag := h.Get("ETag"); etag != "" && !strings.HasPrefix(etag, "W/") {
+			// The compressed body is a different representation
+			h.Set("ETag", "W/"+etag)
+		}
+		if w.encoding == EncodingGzip {
+			w.compressor = gzipWriters.Get().(*gzip.Writer)
+		} else {
+			w.compressor = flateWriters.Get().(*flate.Writer)
+		}
+		w.compressor.Reset(w.ResponseWriter)
+		compressedResponses.WithLabelValues(w.encoding).Inc()
+	}
+
+	w.ResponseWriter.WriteHeader(w.status)
+	buf := w.buf
+	w.buf = nil
+	if len(buf) == 0 {
+		return nil
+	}
+	if w.compressor != nil {
+		_, err := w.compressor.Write(buf)
+		return err
+	}
+	_, err := w.ResponseWriter.Write(buf)
+	return err
+}
+
+// Flush sends what was written so far; a flushed response is compressed
+// whatever its size, as streaming responses cannot be held back
+func (w *compressWriter) Flush() {
+	if !w.decided {
+		if w.status == 0 {
+			w.status = http.StatusOK
+		}
+		_ = w.decide(true)
+	}
+	if w.compressor != nil {
+		_ = w.compressor.Flush()
+	}
+	_ = http.NewResponseController(w.ResponseWriter).Flush()
+}
+
+// Unwrap allows http.ResponseController to reach the underlying writer
+func (w *compressWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// close sends a response that stayed below the minimum size and finishes the
+// compressed stream
+func (w *compressWriter) close() {
+	if !w.decided {
+		if w.status == 0 {
+			// Nothing was written, net/http sends the default response
+			return
+		}
+		_ = w.decide(false)
+	}
+	if w.compressor == nil {
+		return
+	}
+	_ = w.compressor.Close()
+	switch c := w.compressor.(type) {
+	case *gzip.Writer:
+		gzipWriters.Put(c)
+	case *flate.Writer:
+		flateWriters.Put(c)
+	}
+}
+
+// Middleware compresses the responses of next as negotiated by the
+// Accept-Encoding request header
+func Middleware(next http.Handler, options Options) http.Handler {
+	if len(options.ContentTypes) == 0 {
+		options.ContentTypes = DefaultContentTypes
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodHead || r.Header.Get("Range") != "" || r.Header.Get("Upgrade") != "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		cw := &compressWriter{ResponseWriter: w, options: options, encoding: Negotiate(r.Header.Get("Accept-Encoding"))}
+		defer cw.close()
+		next.ServeHTTP(cw, r)
+	})
+}
@@ -0,0 +1,157 @@
+package compress
+
+import (
+	"compress/flate"
+	"compress/gzip"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNegotiate(t *testing.T) {
+	tests := []struct {
+		acceptEncoding string
+		expected       string
+	}{
+		{"", ""},
+		{"identity", ""},
+		{"gzip", EncodingGzip},
+		{"deflate", EncodingDeflate},
+		{"deflate, gzip", EncodingGzip},
+		{"gzip;q=0.5, deflate", EncodingDeflate},
+		{"gzip;q=0, deflate;q=0", ""},
+		{"br, *", EncodingGzip},
+		{"*;q=0.1, gzip;q=0", EncodingDeflate},
+		{"GZIP ; q=0.8", EncodingGzip},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.expected, Negotiate(tt.acceptEncoding), tt.acceptEncoding)
+	}
+}
+
+// serve runs a request with Accept-Encoding through the middleware around handler
+func serve(handler http.HandlerFunc, acceptEncoding string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodGet, "/istio-test/echo", nil)
+	if acceptEncoding != "" {
+		req.Header.Set("Accept-Encoding", acceptEncoding)
+	}
+	w := httptest.NewRecorder()
+	Middleware(handler, Options{MinSize: 64}).ServeHTTP(w, req)
+	return w
+}
+
+func TestMiddleware(t *testing.T) {
+	body := strings.Repeat(`{"message":"hello mesh"}`, 20)
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Content-Length", "480")
+		w.Header().Set("ETag", `"v1"`)
+		w.WriteHeader(http.StatusCreated)
+		_, _ = w.Write([]byte(body[:10]))
+		_, _ = w.Write([]byte(body[10:]))
+	}
+
+	t.Run("gzip", func(t *testing.T) {
+		w := serve(handler, "gzip, deflate")
+		assert.Equal(t, http.StatusCreated, w.Code)
+		assert.Equal(t, EncodingGzip, w.Header().Get("Content-Encoding"))
+		assert.Equal(t, "Accept-Encoding", w.Header().Get("Vary"))
+		assert.Empty(t, w.Header().Get("Content-Length"))
+		assert.Equal(t, `W/"v1"`, w.Header().Get("ETag"))
+
+		reader, err := gzip.NewReader(w.Body)
+		require.NoError(t, err)
+		decoded, err := io.ReadAll(reader)
+		require.NoError(t, err)
+		assert.Equal(t, body, string(decoded))
+	})
+
+	t.Run("deflate", func(t *testing.T) {
+		w := serve(handler, "deflate")
+		assert.Equal(t, EncodingDeflate, w.Header().Get("Content-Encoding"))
+		decoded, err := io.ReadAll(flate.NewReader(w.Body))
+		require.NoError(t, err)
+		assert.Equal(t, body, string(decoded))
+	})
+
+	t.Run("not accepted", func(t *testing.T) {
+		w := serve(handler, "")
+		assert.Empty(t, w.Header().Get("Content-Encoding"))
+		assert.Equal(t, "Accept-Encoding", w.Header().Get("Vary"))
+		assert.Equal(t, `"v1"`, w.Header().Get("ETag"))
+		assert.Equal(t, body, w.Body.String())
+	})
+}
+
+func TestMiddlewarePassesThrough(t *testing.T) {
+	tests := []struct {
+		name    string
+		handler http.HandlerFunc
+		vary    bool
+	}{
+		{
+			name: "below minimum size",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "text/plain")
+				_, _ = w.Write([]byte("small"))
+			},
+			vary: true,
+		},
+		{
+			name: "content type not compressible",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "image/png")
+				_, _ = w.Write([]byte(strings.Repeat("x", 128)))
+			},
+		},
+		{
+			name: "already encoded",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "text/plain")
+				w.Header().Set("Content-Encoding", "br")
+				_, _ = w.Write([]byte(strings.Repeat("x", 128)))
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := serve(tt.handler, "gzip")
+			assert.NotEqual(t, EncodingGzip, w.Header().Get("Content-Encoding"))
+			assert.Equal(t, tt.vary, w.Header().Get("Vary") != "")
+			assert.NotEmpty(t, w.Body.String())
+			assert.NotContains(t, w.Body.String(), "\x1f\x8b")
+		})
+	}
+}
+
+func TestMiddlewareFlush(t *testing.T) {
+	w := serve(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain")
+		_, _ = w.Write([]byte("first "))
+		require.NoError(t, http.NewResponseController(w).Flush())
+		_, _ = w.Write([]byte("second"))
+	}, "gzip")
+
+	assert.True(t, w.Flushed)
+	assert.Equal(t, EncodingGzip, w.Header().Get("Content-Encoding"))
+	reader, err := gzip.NewReader(w.Body)
+	require.NoError(t, err)
+	decoded, err := io.ReadAll(reader)
+	require.NoError(t, err)
+	assert.Equal(t, "first second", string(decoded))
+}
+
+func TestMiddlewareDetectsContentType(t *testing.T) {
+	w := serve(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(strings.Repeat("plain text ", 10)))
+	}, "gzip")
+
+	assert.Equal(t, "text/plain; charset=utf-8", w.Header().Get("Content-Type"))
+	assert.Equal(t, EncodingGzip, w.Header().Get("Content-Encoding"))
+}
@@ -1,11 +1,23 @@
 package config
 
 import (
+	"encoding/json"
 	"fmt"
+	"net"
+	"net/http"
+	"net/url"
 	"os"
+	"path/filepath"
+	"slices"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
+
+	"istio-test/internal/gctune"
+	"istio-test/internal/observability"
+	"istio-test/internal/security"
+	"istio-test/internal/tenant"
 )
 
 // Config holds all configuration for the istio-test application
@@ -21,6 +33,93 @@ type Config struct {
 
 	// Security configuration
 	Security SecurityConfig
+
+	// Outbound (application-originated) call configuration
+	Outbound OutboundConfig
+
+	// Response cache configuration
+	Cache CacheConfig
+
+	// Response shaping endpoint configuration
+	Respond RespondConfig
+
+	// Fault injection configuration
+	Fault FaultConfig
+
+	// Shared counter store configuration
+	Store StoreConfig
+
+	// Database connectivity check configuration
+	DBPing DBPingConfig
+
+	// Service catalog registration configuration
+	Catalog CatalogConfig
+
+	// Background baseline load configuration
+	Heartbeat HeartbeatConfig
+
+	// Profiling endpoint configuration
+	Pprof PprofConfig
+
+	// Call-chain endpoint configuration
+	Proxy ProxyConfig
+
+	// In-app rate limiting configuration
+	RateLimit RateLimitConfig
+
+	// In-app concurrency limiting configuration
+	ConcurrencyLimit ConcurrencyLimitConfig
+
+	// In-app JWT validation configuration
+	JWT JWTConfig
+
+	// OOM-risk and panic watchdog configuration
+	Watchdog WatchdogConfig
+
+	// Istio revision and sidecar reporting configuration
+	Istio IstioConfig
+
+	// Background health check configuration
+	Health HealthConfig
+
+	// Go runtime memory configuration
+	Runtime RuntimeConfig
+
+	// Tenant attribution configuration
+	Tenant TenantConfig
+
+	// Configuration drift detection
+	Drift DriftConfig
+
+	// Cross-Origin Resource Sharing
+	CORS CORSConfig
+
+	// Response transformations
+	Transform TransformConfig
+
+	// Barriers for coordinated multi-pod tests
+	Coordination CoordinationConfig
+
+	// Certificate and token expiry watchdog
+	Expiry ExpiryConfig
+
+	// Response compression
+	Compression CompressionConfig
+
+	// Persistent result snapshots
+	Artifacts ArtifactConfig
+
+	// Goroutine leak detection per subsystem
+	GoroutineLeak GoroutineLeakConfig
+
+	// Payload generator endpoint
+	Payload PayloadConfig
+
+	// Server-sent events streaming endpoint
+	SSE SSEConfig
+
+	// Static token required by admin and debug endpoints
+	AdminAuth AdminAuthConfig
 }
 
 // ServerConfig holds HTTP server related configuration
@@ -29,24 +128,105 @@ type ServerConfig struct {
 	ReadTimeout  time.Duration `json:"read_timeout"`
 	WriteTimeout time.Duration `json:"write_timeout"`
 	IdleTimeout  time.Duration `json:"idle_timeout"`
+	GRPCPort     string        `json:"grpc_port"`   // Port of the gRPC echo server, empty disables it
+	DrainDelay   time.Duration `json:"drain_delay"` // Time readiness fails before the server stops accepting requests on shutdown
+
+	// TLS listener served next to the plain HTTP listener when a certificate is set
+	TLSPort           string        `json:"tls_port"`
+	TLSCertFile       string        `json:"tls_cert_file"`       // Serving certificate (PEM)
+	TLSKeyFile        string        `json:"tls_key_file"`        // Private key for TLSCertFile (PEM)
+	TLSReloadInterval time.Duration `json:"tls_reload_interval"` // Interval between checks of the files for rotation
+
+	// Separate listener for profiling, metrics and configuration endpoints, empty serves them on Port
+	AdminPort string `json:"admin_port"`
+
+	// Inspect the raw framing of requests on Port and report anomalies on /admin/anomalies
+	FramingDiagnostics bool `json:"framing_diagnostics"`
+
+	// Serve HTTP/2 without TLS (h2c) on Port next to HTTP/1.1, with prior knowledge or through an Upgrade
+	EnableH2C bool `json:"enable_h2c"`
+
+	// Raw TCP echo listener for TCP routing and mTLS on opaque ports, empty disables it
+	TCPEchoPort        string        `json:"tcp_echo_port"`
+	TCPEchoIdleTimeout time.Duration `json:"tcp_echo_idle_timeout"` // Connections sending nothing for this long are closed
+
+	// Envoy-style POST /drain and /quitquitquit on the admin listener, for orchestrating drain tests
+	LifecycleEndpoints bool   `json:"lifecycle_endpoints"`
+	LifecycleToken     string `json:"-"` // Bearer token the lifecycle endpoints require, empty requires none
 }
 
 // MetadataConfig holds metadata service related configuration
 type MetadataConfig struct {
+	Provider        string        `json:"provider"` // Instance metadata service to read: gce, aws or azure
 	HTTPTimeout     time.Duration `json:"http_timeout"`
 	MaxRetries      int           `json:"max_retries"`
 	BaseRetryDelay  time.Duration `json:"base_retry_delay"`
 	MaxRetryDelay   time.Duration `json:"max_retry_delay"`
 	RetryMultiplier float64       `json:"retry_multiplier"`
+	RetryJitter     float64       `json:"retry_jitter"`     // Fraction (0-1) of each retry delay that is randomized
+	RetryBudget     float64       `json:"retry_budget"`     // Max retries per request in a 10s window, 0 disables the budget
+	RetryBudgetMin  int           `json:"retry_budget_min"` // Retries always allowed per window regardless of traffic
+	CacheEnabled    bool          `json:"cache_enabled"`    // Cache metadata values in memory
+	CacheTTL        time.Duration `json:"cache_ttl"`        // Lifetime of cached values that may change; cluster name and location never expire
+
+	// Circuit breaker failing fetches fast while the metadata server keeps failing
+	BreakerFailureThreshold int           `json:"breaker_failure_threshold"` // Consecutive failed fetches that open the breaker, zero disables it
+	BreakerResetTimeout     time.Duration `json:"breaker_reset_timeout"`     // Time the breaker stays open before a trial fetch
+	// Workload identity tokens served on /istio-test/metadata/identity-token
+	IdentityTokenAudiences []string `json:"identity_token_audiences"` // Audiences tokens may be requested for, empty disables the endpoint
+	AccessTokenEnabled     bool     `json:"access_token_enabled"`     // Also serve OAuth access tokens of the service account when asked
 }
 
 // ObservabilityConfig holds observability related configuration
 type ObservabilityConfig struct {
 	LogLevel           string        `json:"log_level"`
+	LogFormat          string        `json:"log_format"` // "json" or "text"
 	EnableProfiler     bool          `json:"enable_profiler"`
 	EnableTracing      bool          `json:"enable_tracing"`
+	EnableMetrics      bool          `json:"enable_metrics"`
 	EnablePIIRedaction bool          `json:"enable_pii_redaction"`
 	ShutdownTimeout    time.Duration `json:"shutdown_timeout"`
+
+	// Continuous profiler settings
+	ProfileTypes         []string      `json:"profile_types"`          // cpu, heap, block, mutex, goroutine; empty collects cpu and heap
+	ProfilePeriod        time.Duration `json:"profile_period"`         // Collection and upload period
+	ProfileUploadTimeout time.Duration `json:"profile_upload_timeout"` // Profile upload timeout
+	ProfileBlockRate     int           `json:"profile_block_rate"`     // Nanoseconds blocked per sampled block event
+	ProfileMutexFraction int           `json:"profile_mutex_fraction"` // 1/n mutex contention events are sampled
+
+	// Tracer settings; empty values fall back to the tracer's DD_* or OTEL_* environment variables
+	TracingBackend       string            `json:"tracing_backend"` // "datadog" or "otel"
+	TracingService       string            `json:"tracing_service"`
+	TracingEnv           string            `json:"tracing_env"`
+	TracingVersion       string            `json:"tracing_version"` // Defaults to the build version
+	TracingAgentAddr     string            `json:"tracing_agent_addr"`
+	TracingOTLPEndpoint  string            `json:"tracing_otlp_endpoint"`  // OTLP/HTTP collector URL for the otel backend
+	TracingSampleRate    float64           `json:"tracing_sample_rate"`    // Rate for traces matching no rule, zero leaves sampling to the agent
+	TracingSamplingRules map[string]string `json:"tracing_sampling_rules"` // Rates keyed by "service" or "service:operation"
+	TracingTags          map[string]string `json:"tracing_tags"`           // Global span tags
+
+	// The tracer and profiler start once their agent or collector accepts
+	// connections, retrying with backoff up to this delay; zero uses 30s
+	ExporterRetryMaxDelay time.Duration `json:"exporter_retry_max_delay"`
+
+	// Request header thresholds; requests above either are counted and logged, zero disables
+	HeaderBytesThreshold int `json:"header_bytes_threshold"`
+	HeaderCountThreshold int `json:"header_count_threshold"`
+
+	// Request logging; both can be tuned while serving through /admin/runtime
+	RequestLogSampleRate float64       `json:"request_log_sample_rate"` // Share of successful requests logged, slow and failed requests are always logged
+	SlowRequestThreshold time.Duration `json:"slow_request_threshold"`  // Requests slower than this are logged as warnings, zero uses 1s
+	LogBufferSize        int           `json:"log_buffer_size"`         // Entries buffered before the oldest is dropped, zero writes logs synchronously
+	RecentRequests       int           `json:"recent_requests"`         // Completed requests kept for the support bundle, zero keeps none
+	LogExcludePaths      []string      `json:"log_exclude_paths"`       // Path prefixes whose successful requests are not logged, e.g. health probes
+
+	// PII redaction rules of request logs, applied when EnablePIIRedaction is set
+	PIIAllowedQueryParams []string `json:"pii_allowed_query_params"`  // Query parameters logged as they are, others are redacted
+	PIIIPRedaction        string   `json:"pii_ip_redaction"`          // "none", "truncate" or "hash"; empty truncates
+	PIIUserAgentMaxLength int      `json:"pii_user_agent_max_length"` // Longer user agents are truncated, zero uses 100
+
+	// Measure the CPU time and allocations of each request into histograms and request logs
+	EnableCostAccounting bool `json:"enable_cost_accounting"`
 }
 
 // SecurityConfig holds security-related configuration
@@ -60,6 +240,287 @@ type SecurityConfig struct {
 	APICOEP string `json:"api_coep"`
 	APICOOP string `json:"api_coop"`
 	APICORP string `json:"api_corp"`
+
+	// Transport and feature policies for every endpoint, unset by default;
+	// enable when the service is exposed over TLS through the ingress gateway
+	HSTSMaxAge            time.Duration `json:"hsts_max_age"` // Strict-Transport-Security max-age, zero leaves the header unset
+	HSTSIncludeSubDomains bool          `json:"hsts_include_subdomains"`
+	HSTSPreload           bool          `json:"hsts_preload"`       // Requires includeSubDomains and a max-age of at least one year
+	PermissionsPolicy     string        `json:"permissions_policy"` // e.g. "camera=(), microphone=(), geolocation=()"
+}
+
+// OutboundConfig holds configuration for application-originated outbound calls
+type OutboundConfig struct {
+	TLSCertFile  string            `json:"tls_cert_file"`  // Client certificate presented to targets
+	TLSKeyFile   string            `json:"tls_key_file"`   // Private key for the client certificate
+	TLSCAFile    string            `json:"tls_ca_file"`    // Default CA bundle, empty uses the system pool
+	TLSTargetCAs map[string]string `json:"tls_target_cas"` // CA bundle pinned per target host
+
+	// Hosts allowed as Host header or SNI overrides in the host and sni query
+	// parameters of /istio-test/proxy ("*.example.com" matches subdomains)
+	OverrideAllowlist []string `json:"override_allowlist"`
+
+	// Connection pool and tracing settings shared by all outbound clients
+	Tracing             bool          `json:"tracing"`
+	MaxIdleConnsPerHost int           `json:"max_idle_conns_per_host"` // Zero uses the transport default
+	IdleConnTimeout     time.Duration `json:"idle_conn_timeout"`
+
+	// Per-target client settings keyed by client name (fanout, egress, probes);
+	// the metadata client is configured by MetadataConfig
+	Clients map[string]OutboundClientConfig `json:"clients"`
+}
+
+// OutboundClientConfig holds settings of a named outbound client
+type OutboundClientConfig struct {
+	Timeout     time.Duration `json:"timeout"`
+	MaxAttempts int           `json:"max_attempts"` // Total attempts including the first one
+	HedgeDelay  time.Duration `json:"hedge_delay"`  // Time before another attempt is sent concurrently, zero disables hedging
+}
+
+// OutboundClientNames lists the named outbound clients configured from the environment
+var OutboundClientNames = []string{"fanout", "egress", "probes", "catalog", "heartbeat", "mirror", "jwks", "webhook"}
+
+// CacheConfig holds configuration for the opt-in response cache
+type CacheConfig struct {
+	Enabled    bool          `json:"enabled"`
+	Routes     []string      `json:"routes"` // Path prefixes whose GET responses are cached
+	TTL        time.Duration `json:"ttl"`
+	MaxEntries int           `json:"max_entries"`
+
+	// Cache-Control and Surrogate-Control rules applied at startup; they can be
+	// replaced at runtime through /admin/cache-control
+	HeaderRulesFile string `json:"header_rules_file"`
+}
+
+// FaultConfig holds configuration for artificial degradation
+type FaultConfig struct {
+	Zone         string        `json:"zone"`          // Zone of the pod, detected from the metadata server when empty
+	MaxDelay     time.Duration `json:"max_delay"`     // Upper bound for /istio-test/fault/delay and requested delays
+	RequestDelay bool          `json:"request_delay"` // Honor X-Istio-Test-Delay and ?delay= on every endpoint
+
+	// Zone skew degrades requests only when the pod runs in one of ZoneSkewZones
+	ZoneSkewZones         []string      `json:"zone_skew_zones"` // Zones or regions
+	ZoneSkewLatency       time.Duration `json:"zone_skew_latency"`
+	ZoneSkewErrorRate     float64       `json:"zone_skew_error_rate"`
+	ZoneSkewErrorStatus   int           `json:"zone_skew_error_status"`
+	ZoneSkewRoutes        []string      `json:"zone_skew_routes"`         // Path prefixes that are degraded
+	ZoneSkewExcludeRoutes []string      `json:"zone_skew_exclude_routes"` // Path prefixes never degraded
+
+	// Chaos injects random errors and log-normally distributed latency on every pod
+	ChaosEnabled       bool          `json:"chaos_enabled"`
+	ChaosErrorRate     float64       `json:"chaos_error_rate"`
+	ChaosErrorStatuses []int         `json:"chaos_error_statuses"` // Picked uniformly for each injected error
+	ChaosLatencyRate   float64       `json:"chaos_latency_rate"`   // Share of requests that get latency
+	ChaosLatencyP50    time.Duration `json:"chaos_latency_p50"`
+	ChaosLatencyP99    time.Duration `json:"chaos_latency_p99"`
+	ChaosRoutes        []string      `json:"chaos_routes"`         // Path prefixes that are degraded
+	ChaosExcludeRoutes []string      `json:"chaos_exclude_routes"` // Path prefixes never degraded
+}
+
+// StoreConfig holds configuration for the counter store shared by replicas
+type StoreConfig struct {
+	RedisAddr      string        `json:"redis_addr"` // Redis host:port, empty keeps counters in memory
+	RedisPassword  string        `json:"-"`
+	RedisDB        int           `json:"redis_db"`
+	HealthInterval time.Duration `json:"health_interval"` // Interval between Redis health checks
+}
+
+// DBPingConfig holds configuration for the database connectivity check
+type DBPingConfig struct {
+	Driver  string        `json:"driver"`   // postgres or mysql, empty disables the check
+	DSNFile string        `json:"dsn_file"` // File holding the data source name, e.g. a mounted secret
+	Query   string        `json:"query"`    // Query run by the check
+	Timeout time.Duration `json:"timeout"`  // Upper bound for connecting and running the query
+}
+
+// CatalogConfig holds configuration for self-registration in a service catalog
+type CatalogConfig struct {
+	URL string `json:"url"` // Registry URL the pod registers with, empty disables registration
+}
+
+// HeartbeatConfig holds configuration for the background baseline load
+type HeartbeatConfig struct {
+	Targets  []string      `json:"targets"`  // URLs requested continuously, empty disables the heartbeat
+	Interval time.Duration `json:"interval"` // Time between requests to each target
+}
+
+// PprofConfig holds configuration for the token protected profiling endpoints
+type PprofConfig struct {
+	Enabled     bool          `json:"enabled"`       // Serve /debug/pprof and /admin/pprof/token
+	TokenSecret string        `json:"-"`             // HMAC key for access tokens, random per pod when empty
+	MaxTokenTTL time.Duration `json:"max_token_ttl"` // Upper bound for the lifetime of a minted token
+}
+
+// ProxyConfig holds configuration for the call-chain endpoint
+type ProxyConfig struct {
+	Allowlist []string `json:"allowlist"` // Hosts /istio-test/proxy may call ("*.svc.cluster.local" matches subdomains), empty disables it
+
+	MirrorTarget     string  `json:"mirror_target"`      // Base URL receiving copies of proxied requests, empty disables mirroring
+	MirrorSampleRate float64 `json:"mirror_sample_rate"` // Fraction of proxied requests that are mirrored
+}
+
+// RateLimitConfig holds configuration for the in-app token bucket rate limiter
+type RateLimitConfig struct {
+	RPS           float64  `json:"rps"`            // Sustained requests per second, zero disables the limiter
+	Burst         int      `json:"burst"`          // Requests allowed at once, zero uses RPS rounded up
+	PerClientIP   bool     `json:"per_client_ip"`  // Limit each client IP separately instead of all requests together
+	TrustedHops   int      `json:"trusted_hops"`   // Proxies appending to X-Forwarded-For, zero keys clients on the peer address
+	ExcludeRoutes []string `json:"exclude_routes"` // Path prefixes that are never limited
+}
+
+// ConcurrencyLimitConfig holds configuration for the in-app concurrency limiter
+type ConcurrencyLimitConfig struct {
+	Mode          string   `json:"mode"`           // "fixed" or "gradient", empty disables the limiter
+	Limit         int      `json:"limit"`          // Fixed limit, or the initial limit in gradient mode
+	MinLimit      int      `json:"min_limit"`      // Lower bound of the gradient limit
+	MaxLimit      int      `json:"max_limit"`      // Upper bound of the gradient limit
+	ExcludeRoutes []string `json:"exclude_routes"` // Path prefixes that are never limited
+
+	// Requests over the limit wait briefly for a slot before being shed with 503
+	QueueSize    int           `json:"queue_size"`    // Requests waiting at once, zero sheds right away
+	QueueTimeout time.Duration `json:"queue_timeout"` // Longest wait for a slot
+	RetryAfter   time.Duration `json:"retry_after"`   // Retry-After of shed requests, rounded up to seconds
+}
+
+// JWTConfig holds configuration for the in-app JWT validation, mirroring a
+// RequestAuthentication jwtRules entry
+type JWTConfig struct {
+	Mode          string        `json:"mode"`           // "enforce" or "observe", empty disables validation
+	JWKSURL       string        `json:"jwks_url"`       // Where the signing keys are fetched from
+	Issuer        string        `json:"issuer"`         // Required iss claim
+	Audiences     []string      `json:"audiences"`      // Accepted aud claims, empty accepts any
+	JWKSRefresh   time.Duration `json:"jwks_refresh"`   // How long fetched keys are used
+	ExcludeRoutes []string      `json:"exclude_routes"` // Path prefixes that are never validated
+}
+
+// WatchdogConfig holds configuration for the OOM-risk and panic watchdog
+type WatchdogConfig struct {
+	Enabled             bool          `json:"enabled"`
+	Interval            time.Duration `json:"interval"`
+	MemoryWarningRatio  float64       `json:"memory_warning_ratio"`  // Fraction of the container memory limit that warns
+	MemoryCriticalRatio float64       `json:"memory_critical_ratio"` // Fraction of the container memory limit that is critical
+	HeapGrowthWarning   float64       `json:"heap_growth_warning"`   // Heap growth in bytes per second that warns
+	GoroutineWarning    int           `json:"goroutine_warning"`
+	GoroutineCritical   int           `json:"goroutine_critical"`
+	BlockedWriteWarning time.Duration `json:"blocked_write_warning"` // Time a response write may block on a slow client before it warns
+	ProfileDir          string        `json:"profile_dir"`           // Heap profiles are written here when memory is critical, empty disables them
+	ProfileCooldown     time.Duration `json:"profile_cooldown"`
+}
+
+// IstioConfig holds configuration for the Istio revision and sidecar info endpoint
+type IstioConfig struct {
+	PodInfoDir    string `json:"pod_info_dir"`    // Directory of the Downward API labels and annotations files
+	EnvoyAdminURL string `json:"envoy_admin_url"` // Envoy admin of the sidecar, empty skips the proxy version
+}
+
+// RuntimeConfig holds the Go runtime memory settings applied at startup
+type RuntimeConfig struct {
+	MemoryLimit string `json:"memory_limit"` // Soft memory limit in GOMEMLIMIT syntax, empty keeps the runtime's
+	GCPercent   string `json:"gc_percent"`   // GC target in GOGC syntax, empty keeps the runtime's
+	MaxProcs    string `json:"max_procs"`    // GOMAXPROCS, "auto" follows the container CPU limit, empty keeps the runtime's
+}
+
+// TenantConfig holds the rule attributing requests to tenants
+type TenantConfig struct {
+	Source string `json:"source"` // header, jwt or path; empty disables tenant attribution
+	Key    string `json:"key"`    // Header name, JWT claim or path prefix such as "/tenants/"
+}
+
+// DriftConfig holds the settings of configuration drift detection and reload
+type DriftConfig struct {
+	Dir      string        `json:"dir"`      // Mounted ConfigMap compared with the environment, empty disables detection
+	Interval time.Duration `json:"interval"` // Interval between checks
+	Reload   bool          `json:"reload"`   // Apply reload-safe keys of Dir on SIGHUP or when they change
+}
+
+// CORSConfig holds the Cross-Origin Resource Sharing policy
+type CORSConfig struct {
+	AllowedOrigins   []string      `json:"allowed_origins"` // "*", exact origins or "https://*.example.com"; empty disables CORS
+	AllowedMethods   []string      `json:"allowed_methods"`
+	AllowedHeaders   []string      `json:"allowed_headers"` // "*" allows any request header
+	ExposedHeaders   []string      `json:"exposed_headers"`
+	AllowCredentials bool          `json:"allow_credentials"`
+	MaxAge           time.Duration `json:"max_age"` // Preflight cache lifetime
+}
+
+// TransformConfig holds the response transformations applied at startup; they
+// can be replaced at runtime through /admin/transforms
+type TransformConfig struct {
+	RulesFile string `json:"rules_file"` // Rules document, e.g. a mounted ConfigMap; empty starts without rules
+}
+
+// CoordinationConfig holds the settings of the coordination barriers
+type CoordinationConfig struct {
+	MaxWait time.Duration `json:"max_wait"` // Upper bound for the wait of a barrier registration
+}
+
+// CompressionConfig holds the settings of the response compression
+type CompressionConfig struct {
+	Enabled      bool     `json:"enabled"`
+	MinSize      int      `json:"min_size"`      // Bodies smaller than this many bytes are sent uncompressed
+	ContentTypes []string `json:"content_types"` // Media types to compress ("text/" matches all text types), empty uses text, JSON, JavaScript, XML and SVG
+}
+
+// ArtifactConfig holds the settings of the result snapshot writer; it is
+// disabled unless a directory or bucket is set
+type ArtifactConfig struct {
+	Dir       string        `json:"dir"`        // Mounted volume receiving the snapshots
+	GCSBucket string        `json:"gcs_bucket"` // Cloud Storage bucket receiving the snapshots, written with the workload identity
+	Prefix    string        `json:"prefix"`     // Directory of the snapshots within Dir or GCSBucket, e.g. an experiment ID
+	Interval  time.Duration `json:"interval"`   // Time between snapshots
+	Keep      int           `json:"keep"`       // Snapshots kept per source and pod
+}
+
+// GoroutineLeakConfig holds the settings of the goroutine leak detector
+type GoroutineLeakConfig struct {
+	Enabled   bool          `json:"enabled"`
+	Interval  time.Duration `json:"interval"`   // Time between goroutine counts
+	Window    time.Duration `json:"window"`     // Time a subsystem's count must only grow to be reported as leaking
+	MinGrowth int           `json:"min_growth"` // Growth over the window below which a subsystem is not reported
+}
+
+// PayloadConfig holds configuration for the payload generator endpoint
+type PayloadConfig struct {
+	MaxBytes    int           `json:"max_bytes"`    // Largest payload /istio-test/bytes/{n} generates, zero disables the endpoint
+	MaxDuration time.Duration `json:"max_duration"` // Upper bound for the delays between the chunks of a payload
+}
+
+// SSEConfig holds configuration for the server-sent events endpoint
+type SSEConfig struct {
+	MaxEvents   int           `json:"max_events"`   // Most events /istio-test/stream/sse sends per stream, zero disables the endpoint
+	MaxDuration time.Duration `json:"max_duration"` // Upper bound for the duration of a stream
+}
+
+// AdminAuthConfig holds configuration for the admin token check
+type AdminAuthConfig struct {
+	Token     string   `json:"-"`          // Token admin routes require, empty with no TokenFile leaves them open
+	TokenFile string   `json:"token_file"` // File holding the token, e.g. a mounted secret
+	Routes    []string `json:"routes"`     // Path prefixes that require the token
+}
+
+// ExpiryConfig holds the settings of the certificate and token expiry watchdog
+type ExpiryConfig struct {
+	CertFiles  []string      `json:"cert_files"`  // PEM certificate files, e.g. Istio output certs; the TLS serving certificate is always watched
+	TokenFiles []string      `json:"token_files"` // Projected service account tokens
+	Window     time.Duration `json:"window"`      // Time to expiry below which health is degraded
+	Interval   time.Duration `json:"interval"`    // Interval between checks
+}
+
+// HealthConfig holds configuration for the background health checker
+type HealthConfig struct {
+	CheckInterval  time.Duration `json:"check_interval"`  // Interval between dependency check runs
+	StaleAfter     time.Duration `json:"stale_after"`     // Age after which a cached result degrades
+	UnhealthyAfter time.Duration `json:"unhealthy_after"` // Age after which a cached result fails, zero never fails on age
+	WebhookURL     string        `json:"-"`               // Receives a JSON POST on every change of the overall status, empty sends none; usually embeds a secret
+
+	// Per-check budgets; GKE metadata latency varies by machine type and probe budgets differ per cluster
+	CheckTimeouts         map[string]time.Duration `json:"check_timeouts"`          // Timeouts by check name, e.g. metadata_service or dbping; others keep their own
+	MetadataSlowThreshold time.Duration            `json:"metadata_slow_threshold"` // Response time above which the metadata service degrades health
+}
+
+// RespondConfig holds configuration for the response shaping endpoint
+type RespondConfig struct {
+	MaxDelay time.Duration `json:"max_delay"` // Upper bound for the delay a spec may request
 }
 
 // Validate validates the SecurityConfig values
@@ -86,10 +547,27 @@ func (sc SecurityConfig) Validate() error {
 	if err := validatePolicy("APICORP", sc.APICORP, validCORP); err != nil {
 		return err
 	}
+	if err := sc.HSTS().Validate(); err != nil {
+		return err
+	}
+	if sc.PermissionsPolicy != "" {
+		if err := security.ValidatePermissionsPolicy(sc.PermissionsPolicy); err != nil {
+			return err
+		}
+	}
 
 	return nil
 }
 
+// HSTS returns the Strict-Transport-Security options
+func (sc SecurityConfig) HSTS() security.HSTSOptions {
+	return security.HSTSOptions{
+		MaxAge:            sc.HSTSMaxAge,
+		IncludeSubDomains: sc.HSTSIncludeSubDomains,
+		Preload:           sc.HSTSPreload,
+	}
+}
+
 // validatePolicy validates a single policy value against allowed values
 func validatePolicy(name, value string, allowed []string) error {
 	for _, a := range allowed {
@@ -100,18 +578,108 @@ func validatePolicy(name, value string, allowed []string) error {
 	return fmt.Errorf("invalid %s value '%s', allowed values: %s", name, value, strings.Join(allowed, ", "))
 }
 
-// Validate validates the entire configuration
+// Validate validates the entire configuration and returns the first problem
 func (c *Config) Validate() error {
-	if err := validateServerConfig(c.Server); err != nil {
-		return err
+	if errs := c.ValidateAll(); len(errs) > 0 {
+		return errs[0]
 	}
-	if err := validateMetadataConfig(c.Metadata); err != nil {
-		return err
+	return nil
+}
+
+// ValidateAll validates every section of the configuration and returns all
+// problems, so they can be fixed in one go
+func (c *Config) ValidateAll() []error {
+	var errs []error
+	for _, err := range []error{
+		validateServerConfig(c.Server),
+		validateMetadataConfig(c.Metadata),
+		validateObservabilityConfig(c.Observability),
+		validateOutboundConfig(c.Outbound),
+		validateCacheConfig(c.Cache),
+		validateRespondConfig(c.Respond),
+		validateFaultConfig(c.Fault),
+		validateStoreConfig(c.Store),
+		validateDBPingConfig(c.DBPing),
+		validateCatalogConfig(c.Catalog),
+		validateHeartbeatConfig(c.Heartbeat),
+		validatePprofConfig(c.Pprof, c.AdminAuth),
+		validateProxyConfig(c.Proxy),
+		validateRateLimitConfig(c.RateLimit),
+		validateConcurrencyLimitConfig(c.ConcurrencyLimit),
+		validateJWTConfig(c.JWT),
+		validateWatchdogConfig(c.Watchdog),
+		validateIstioConfig(c.Istio),
+		validateHealthConfig(c.Health),
+		validateRuntimeConfig(c.Runtime),
+		validateTenantConfig(c.Tenant),
+		validateDriftConfig(c.Drift),
+		validateCORSConfig(c.CORS),
+		validateCoordinationConfig(c.Coordination),
+		validateExpiryConfig(c.Expiry),
+		validateCompressionConfig(c.Compression),
+		validateArtifactConfig(c.Artifacts),
+		validateGoroutineLeakConfig(c.GoroutineLeak),
+		validatePayloadConfig(c.Payload),
+		validateSSEConfig(c.SSE),
+		validateAdminAuthConfig(c.AdminAuth),
+		c.Security.Validate(),
+	} {
+		if err != nil {
+			errs = append(errs, err)
+		}
 	}
-	if err := validateObservabilityConfig(c.Observability); err != nil {
-		return err
+	return errs
+}
+
+// loadMu serializes LoadWithErrors, which collects the invalid values
+// reported by the get helpers into invalidValues, and LoadWithOverrides,
+// whose values the helpers read through overrides
+var (
+	loadMu        sync.Mutex
+	invalidValues *[]error
+	overrides     map[string]string
+)
+
+// lookupEnv returns the value of a configuration variable, taken from the
+// overrides of LoadWithOverrides before the environment
+func lookupEnv(key string) string {
+	if value, ok := overrides[key]; ok {
+		return value
+	}
+	return os.Getenv(key)
+}
+
+// reportInvalid records an environment variable whose value could not be
+// used; outside of LoadWithErrors the helpers fall back to their defaults
+func reportInvalid(key, value, reason string) {
+	if invalidValues != nil {
+		*invalidValues = append(*invalidValues, fmt.Errorf("invalid %s value '%s': %s", key, value, reason))
 	}
-	return c.Security.Validate()
+}
+
+// LoadWithErrors loads the configuration like Load and returns every
+// environment variable that could not be parsed along with every validation
+// problem, instead of silently falling back to defaults
+func LoadWithErrors() (*Config, []error) {
+	return LoadWithOverrides(nil)
+}
+
+// LoadWithOverrides loads the configuration like LoadWithErrors, with values
+// taking precedence over the environment, such as the keys of a mounted
+// ConfigMap reloaded while serving
+func LoadWithOverrides(values map[string]string) (*Config, []error) {
+	loadMu.Lock()
+	defer loadMu.Unlock()
+
+	overrides = values
+	defer func() { overrides = nil }()
+
+	var errs []error
+	invalidValues = &errs
+	defer func() { invalidValues = nil }()
+
+	c := Load()
+	return c, append(errs, c.ValidateAll()...)
 }
 
 // Load creates a new Config instance with values from environment variables
@@ -120,23 +688,88 @@ func Load() *Config {
 	return &Config{
 		Server: ServerConfig{
 			Port:         getEnv("PORT", "8080"),
+			GRPCPort:     getEnv("GRPC_PORT", ""),
 			ReadTimeout:  getDuration("SERVER_READ_TIMEOUT", 5*time.Second),
 			WriteTimeout: getDuration("SERVER_WRITE_TIMEOUT", 10*time.Second),
 			IdleTimeout:  getDuration("SERVER_IDLE_TIMEOUT", 60*time.Second),
+			DrainDelay:   getNonNegativeDuration("PRE_SHUTDOWN_DELAY", getNonNegativeDuration("SERVER_DRAIN_DELAY", 5*time.Second)),
+
+			TLSPort:           getEnv("TLS_PORT", "8443"),
+			TLSCertFile:       getEnv("TLS_CERT_FILE", ""),
+			TLSKeyFile:        getEnv("TLS_KEY_FILE", ""),
+			TLSReloadInterval: getDuration("TLS_RELOAD_INTERVAL", 30*time.Second),
+
+			AdminPort: getEnv("ADMIN_PORT", ""),
+
+			FramingDiagnostics: getBool("FRAMING_DIAGNOSTICS", false),
+			EnableH2C:          getBool("ENABLE_H2C", false),
+
+			TCPEchoPort:        getEnv("TCP_ECHO_PORT", ""),
+			TCPEchoIdleTimeout: getDuration("TCP_ECHO_IDLE_TIMEOUT", 5*time.Minute),
+
+			LifecycleEndpoints: getBool("ENABLE_LIFECYCLE_ENDPOINTS", false),
+			LifecycleToken:     getEnv("LIFECYCLE_TOKEN", ""),
 		},
 		Metadata: MetadataConfig{
+			Provider:        getEnv("METADATA_PROVIDER", "gce"),
 			HTTPTimeout:     getDuration("METADATA_HTTP_TIMEOUT", 10*time.Second),
 			MaxRetries:      getInt("METADATA_MAX_RETRIES", 3),
 			BaseRetryDelay:  getDuration("METADATA_BASE_RETRY_DELAY", 100*time.Millisecond),
 			MaxRetryDelay:   getDuration("METADATA_MAX_RETRY_DELAY", 2*time.Second),
 			RetryMultiplier: getFloat("METADATA_RETRY_MULTIPLIER", 2.0),
+			RetryJitter:     getNonNegativeFloat("METADATA_RETRY_JITTER", 0.2),
+			RetryBudget:     getNonNegativeFloat("METADATA_RETRY_BUDGET", 0),
+			RetryBudgetMin:  getInt("METADATA_RETRY_BUDGET_MIN", 10),
+			CacheEnabled:    getBool("METADATA_CACHE_ENABLED", true),
+			CacheTTL:        getDuration("METADATA_CACHE_TTL", 5*time.Minute),
+
+			BreakerFailureThreshold: getInt("METADATA_BREAKER_FAILURE_THRESHOLD", 5),
+			BreakerResetTimeout:     getDuration("METADATA_BREAKER_RESET_TIMEOUT", 30*time.Second),
+
+			IdentityTokenAudiences: getStringSlice("METADATA_IDENTITY_TOKEN_AUDIENCES"),
+			AccessTokenEnabled:     getBool("METADATA_ACCESS_TOKEN_ENABLED", false),
 		},
 		Observability: ObservabilityConfig{
 			LogLevel:           getEnv("LOG_LEVEL", "info"),
+			LogFormat:          getEnv("LOG_FORMAT", "json"),
 			EnableProfiler:     getBool("ENABLE_PROFILER", true),
 			EnableTracing:      getBool("ENABLE_TRACING", true),
+			EnableMetrics:      getBool("ENABLE_METRICS", true),
 			EnablePIIRedaction: getBool("ENABLE_PII_REDACTION", true),
 			ShutdownTimeout:    getDuration("SHUTDOWN_TIMEOUT", 5*time.Second),
+
+			ProfileTypes:         getStringSlice("PROFILER_TYPES"),
+			ProfilePeriod:        getNonNegativeDuration("PROFILER_PERIOD", 60*time.Second),
+			ProfileUploadTimeout: getNonNegativeDuration("PROFILER_UPLOAD_TIMEOUT", 10*time.Second),
+			ProfileBlockRate:     getInt("PROFILER_BLOCK_RATE", 10000),
+			ProfileMutexFraction: getInt("PROFILER_MUTEX_FRACTION", 10),
+
+			TracingBackend:       getEnv("TRACING_BACKEND", observability.TracingBackendDatadog),
+			TracingService:       getEnv("TRACING_SERVICE_NAME", ""),
+			TracingEnv:           getEnv("TRACING_ENV", ""),
+			TracingVersion:       getEnv("TRACING_VERSION", ""),
+			TracingAgentAddr:     getEnv("TRACING_AGENT_ADDR", ""),
+			TracingOTLPEndpoint:  getEnv("TRACING_OTLP_ENDPOINT", ""),
+			TracingSampleRate:    getNonNegativeFloat("TRACING_SAMPLE_RATE", 0),
+			TracingSamplingRules: getStringMap("TRACING_SAMPLING_RULES"),
+			TracingTags:          getStringMap("TRACING_TAGS"),
+
+			ExporterRetryMaxDelay: getNonNegativeDuration("EXPORTER_RETRY_MAX_DELAY", 30*time.Second),
+
+			HeaderBytesThreshold: getInt("METRICS_HEADER_BYTES_THRESHOLD", 32768),
+			HeaderCountThreshold: getInt("METRICS_HEADER_COUNT_THRESHOLD", 100),
+
+			RequestLogSampleRate: getNonNegativeFloat("REQUEST_LOG_SAMPLE_RATE", 1),
+			SlowRequestThreshold: getNonNegativeDuration("SLOW_REQUEST_THRESHOLD", time.Second),
+			LogBufferSize:        getInt("LOG_BUFFER_SIZE", 0),
+			RecentRequests:       getInt("RECENT_REQUESTS", 200),
+			LogExcludePaths:      getStringSlice("LOG_EXCLUDE_PATHS"),
+
+			PIIAllowedQueryParams: getStringSliceWithDefault("PII_ALLOWED_QUERY_PARAMS", observability.DefaultRedactAllowedParams),
+			PIIIPRedaction:        getEnv("PII_IP_REDACTION", observability.IPRedactionTruncate),
+			PIIUserAgentMaxLength: getInt("PII_USER_AGENT_MAX_LENGTH", observability.DefaultRedactUserAgentMaxLength),
+
+			EnableCostAccounting: getBool("ENABLE_COST_ACCOUNTING", false),
 		},
 		Security: SecurityConfig{
 			// Default strict policies for sensitive endpoints
@@ -148,13 +781,222 @@ func Load() *Config {
 			APICOEP: getEnv("SECURITY_API_COEP", ""), // Empty means header won't be set
 			APICOOP: getEnv("SECURITY_API_COOP", "same-origin-allow-popups"),
 			APICORP: getEnv("SECURITY_API_CORP", "cross-origin"),
+
+			// Opt-in transport and feature policies
+			HSTSMaxAge:            getNonNegativeDuration("SECURITY_HSTS_MAX_AGE", 0),
+			HSTSIncludeSubDomains: getBool("SECURITY_HSTS_INCLUDE_SUBDOMAINS", false),
+			HSTSPreload:           getBool("SECURITY_HSTS_PRELOAD", false),
+			PermissionsPolicy:     getEnv("SECURITY_PERMISSIONS_POLICY", ""),
+		},
+		Outbound: OutboundConfig{
+			TLSCertFile:  getEnv("OUTBOUND_TLS_CERT_FILE", ""),
+			TLSKeyFile:   getEnv("OUTBOUND_TLS_KEY_FILE", ""),
+			TLSCAFile:    getEnv("OUTBOUND_TLS_CA_FILE", ""),
+			TLSTargetCAs: getStringMap("OUTBOUND_TLS_TARGET_CAS"),
+
+			OverrideAllowlist: getStringSlice("OUTBOUND_OVERRIDE_ALLOWLIST"),
+
+			Tracing:             getBool("OUTBOUND_TRACING", true),
+			MaxIdleConnsPerHost: getInt("OUTBOUND_MAX_IDLE_CONNS_PER_HOST", 0),
+			IdleConnTimeout:     getNonNegativeDuration("OUTBOUND_IDLE_CONN_TIMEOUT", 90*time.Second),
+			Clients:             loadOutboundClients(),
+		},
+		Cache: CacheConfig{
+			Enabled:    getBool("RESPONSE_CACHE_ENABLED", false),
+			Routes:     getStringSlice("RESPONSE_CACHE_ROUTES"),
+			TTL:        getDuration("RESPONSE_CACHE_TTL", 30*time.Second),
+			MaxEntries: getInt("RESPONSE_CACHE_MAX_ENTRIES", 1000),
+
+			HeaderRulesFile: getEnv("CACHE_CONTROL_RULES_FILE", ""),
+		},
+		Fault: FaultConfig{
+			Zone:         getEnv("POD_ZONE", ""),
+			MaxDelay:     getNonNegativeDuration("FAULT_MAX_DELAY", 60*time.Second),
+			RequestDelay: getBool("FAULT_REQUEST_DELAY", true),
+
+			ZoneSkewZones:         getStringSlice("FAULT_ZONE_SKEW_ZONES"),
+			ZoneSkewLatency:       getNonNegativeDuration("FAULT_ZONE_SKEW_LATENCY", 0),
+			ZoneSkewErrorRate:     getNonNegativeFloat("FAULT_ZONE_SKEW_ERROR_RATE", 0),
+			ZoneSkewErrorStatus:   getInt("FAULT_ZONE_SKEW_ERROR_STATUS", http.StatusServiceUnavailable),
+			ZoneSkewRoutes:        getStringSliceWithDefault("FAULT_ZONE_SKEW_ROUTES", []string{"/istio-test/"}),
+			ZoneSkewExcludeRoutes: getStringSliceWithDefault("FAULT_ZONE_SKEW_EXCLUDE_ROUTES", []string{"/istio-test/health"}),
+
+			ChaosEnabled:       getBool("CHAOS_ENABLED", false),
+			ChaosErrorRate:     getNonNegativeFloat("CHAOS_ERROR_RATE", 0),
+			ChaosErrorStatuses: getIntSliceWithDefault("CHAOS_ERROR_STATUSES", []int{http.StatusInternalServerError, http.StatusBadGateway, http.StatusServiceUnavailable}),
+			ChaosLatencyRate:   getNonNegativeFloat("CHAOS_LATENCY_RATE", 1),
+			ChaosLatencyP50:    getNonNegativeDuration("CHAOS_LATENCY_P50", 0),
+			ChaosLatencyP99:    getNonNegativeDuration("CHAOS_LATENCY_P99", 0),
+			ChaosRoutes:        getStringSliceWithDefault("CHAOS_ROUTES", []string{"/istio-test/"}),
+			ChaosExcludeRoutes: getStringSliceWithDefault("CHAOS_EXCLUDE_ROUTES", []string{"/istio-test/health"}),
+		},
+		Respond: RespondConfig{
+			MaxDelay: getNonNegativeDuration("RESPOND_MAX_DELAY", 10*time.Second),
+		},
+		DBPing: DBPingConfig{
+			Driver:  getEnv("DBPING_DRIVER", ""),
+			DSNFile: getEnv("DBPING_DSN_FILE", ""),
+			Query:   getEnv("DBPING_QUERY", "SELECT 1"),
+			Timeout: getDuration("DBPING_TIMEOUT", 3*time.Second),
+		},
+		Catalog: CatalogConfig{
+			URL: getEnv("CATALOG_URL", ""),
+		},
+		Heartbeat: HeartbeatConfig{
+			Targets:  getStringSlice("HEARTBEAT_TARGETS"),
+			Interval: getDuration("HEARTBEAT_INTERVAL", time.Second),
+		},
+		Pprof: PprofConfig{
+			Enabled:     getBool("ENABLE_PPROF", false),
+			TokenSecret: getEnv("PPROF_TOKEN_SECRET", ""),
+			MaxTokenTTL: getDuration("PPROF_MAX_TOKEN_TTL", time.Hour),
+		},
+		Proxy: ProxyConfig{
+			Allowlist:        getStringSlice("PROXY_ALLOWLIST"),
+			MirrorTarget:     getEnv("PROXY_MIRROR_TARGET", ""),
+			MirrorSampleRate: getNonNegativeFloat("PROXY_MIRROR_SAMPLE_RATE", 1.0),
+		},
+		RateLimit: RateLimitConfig{
+			RPS:           getNonNegativeFloat("RATE_LIMIT_RPS", 0),
+			Burst:         getInt("RATE_LIMIT_BURST", 0),
+			PerClientIP:   getBool("RATE_LIMIT_PER_CLIENT_IP", true),
+			TrustedHops:   getInt("RATE_LIMIT_TRUSTED_HOPS", 0),
+			ExcludeRoutes: getStringSliceWithDefault("RATE_LIMIT_EXCLUDE_ROUTES", []string{"/istio-test/health", "/metrics", "/admin/"}),
+		},
+		ConcurrencyLimit: ConcurrencyLimitConfig{
+			Mode:          getEnv("CONCURRENCY_LIMIT_MODE", ""),
+			Limit:         getInt("CONCURRENCY_LIMIT", 100),
+			MinLimit:      getInt("CONCURRENCY_MIN_LIMIT", 10),
+			MaxLimit:      getInt("CONCURRENCY_MAX_LIMIT", 1000),
+			ExcludeRoutes: getStringSliceWithDefault("CONCURRENCY_LIMIT_EXCLUDE_ROUTES", []string{"/istio-test/health", "/metrics", "/admin/"}),
+			QueueSize:     getInt("CONCURRENCY_QUEUE_SIZE", 0),
+			QueueTimeout:  getDuration("CONCURRENCY_QUEUE_TIMEOUT", 100*time.Millisecond),
+			RetryAfter:    getNonNegativeDuration("CONCURRENCY_RETRY_AFTER", time.Second),
+		},
+		JWT: JWTConfig{
+			Mode:          getEnv("JWT_MODE", ""),
+			JWKSURL:       getEnv("JWT_JWKS_URL", ""),
+			Issuer:        getEnv("JWT_ISSUER", ""),
+			Audiences:     getStringSlice("JWT_AUDIENCES"),
+			JWKSRefresh:   getDuration("JWT_JWKS_REFRESH", 20*time.Minute),
+			ExcludeRoutes: getStringSliceWithDefault("JWT_EXCLUDE_ROUTES", []string{"/istio-test/health", "/metrics", "/admin/"}),
+		},
+		Watchdog: WatchdogConfig{
+			Enabled:             getBool("WATCHDOG_ENABLED", true),
+			Interval:            getDuration("WATCHDOG_INTERVAL", 5*time.Second),
+			MemoryWarningRatio:  getFloat("WATCHDOG_MEMORY_WARNING_RATIO", 0.8),
+			MemoryCriticalRatio: getFloat("WATCHDOG_MEMORY_CRITICAL_RATIO", 0.9),
+			HeapGrowthWarning:   getNonNegativeFloat("WATCHDOG_HEAP_GROWTH_WARNING", 64<<20),
+			GoroutineWarning:    getInt("WATCHDOG_GOROUTINE_WARNING", 10000),
+			GoroutineCritical:   getInt("WATCHDOG_GOROUTINE_CRITICAL", 50000),
+			BlockedWriteWarning: getNonNegativeDuration("WATCHDOG_BLOCKED_WRITE_WARNING", 30*time.Second),
+			ProfileDir:          getEnv("WATCHDOG_PROFILE_DIR", ""),
+			ProfileCooldown:     getDuration("WATCHDOG_PROFILE_COOLDOWN", 10*time.Minute),
+		},
+		Istio: IstioConfig{
+			PodInfoDir:    getEnv("PODINFO_DIR", "/etc/podinfo"),
+			EnvoyAdminURL: getEnv("ENVOY_ADMIN_URL", "http://localhost:15000"),
+		},
+		Health: HealthConfig{
+			CheckInterval:         getNonNegativeDuration("HEALTH_CHECK_INTERVAL", 10*time.Second),
+			StaleAfter:            getNonNegativeDuration("HEALTH_STALE_AFTER", 30*time.Second),
+			UnhealthyAfter:        getNonNegativeDuration("HEALTH_UNHEALTHY_AFTER", 0),
+			WebhookURL:            getEnv("HEALTH_WEBHOOK_URL", ""),
+			CheckTimeouts:         getDurationMap("HEALTH_CHECK_TIMEOUTS"),
+			MetadataSlowThreshold: getNonNegativeDuration("HEALTH_METADATA_SLOW_THRESHOLD", time.Second),
+		},
+		Runtime: RuntimeConfig{
+			MemoryLimit: getEnv("RUNTIME_MEMORY_LIMIT", ""),
+			GCPercent:   getEnv("RUNTIME_GC_PERCENT", ""),
+			MaxProcs:    getEnv("RUNTIME_MAX_PROCS", "auto"),
+		},
+		Tenant: TenantConfig{
+			Source: getEnv("TENANT_SOURCE", ""),
+			Key:    getEnv("TENANT_KEY", ""),
+		},
+		Drift: DriftConfig{
+			Dir:      getEnv("CONFIG_DRIFT_DIR", ""),
+			Interval: getNonNegativeDuration("CONFIG_DRIFT_INTERVAL", time.Minute),
+			Reload:   getBool("CONFIG_RELOAD", false),
+		},
+		CORS: CORSConfig{
+			AllowedOrigins:   getStringSlice("CORS_ALLOWED_ORIGINS"),
+			AllowedMethods:   getStringSliceWithDefault("CORS_ALLOWED_METHODS", []string{"GET", "HEAD", "POST"}),
+			AllowedHeaders:   getStringSlice("CORS_ALLOWED_HEADERS"),
+			ExposedHeaders:   getStringSlice("CORS_EXPOSED_HEADERS"),
+			AllowCredentials: getBool("CORS_ALLOW_CREDENTIALS", false),
+			MaxAge:           getNonNegativeDuration("CORS_MAX_AGE", 10*time.Minute),
+		},
+		Transform: TransformConfig{
+			RulesFile: getEnv("TRANSFORM_RULES_FILE", ""),
+		},
+		Coordination: CoordinationConfig{
+			MaxWait: getNonNegativeDuration("COORDINATION_MAX_WAIT", 5*time.Minute),
+		},
+		Expiry: ExpiryConfig{
+			CertFiles:  getStringSlice("EXPIRY_CERT_FILES"),
+			TokenFiles: getStringSlice("EXPIRY_TOKEN_FILES"),
+			Window:     getNonNegativeDuration("EXPIRY_WINDOW", 10*time.Minute),
+			Interval:   getNonNegativeDuration("EXPIRY_CHECK_INTERVAL", time.Minute),
+		},
+		Compression: CompressionConfig{
+			Enabled:      getBool("COMPRESSION_ENABLED", false),
+			MinSize:      getInt("COMPRESSION_MIN_SIZE", 1024),
+			ContentTypes: getStringSlice("COMPRESSION_CONTENT_TYPES"),
+		},
+		Artifacts: ArtifactConfig{
+			Dir:       getEnv("ARTIFACT_DIR", ""),
+			GCSBucket: getEnv("ARTIFACT_GCS_BUCKET", ""),
+			Prefix:    getEnv("ARTIFACT_PREFIX", ""),
+			Interval:  getNonNegativeDuration("ARTIFACT_INTERVAL", time.Minute),
+			Keep:      getInt("ARTIFACT_KEEP", 10),
+		},
+		GoroutineLeak: GoroutineLeakConfig{
+			Enabled:   getBool("GOROUTINE_LEAK_ENABLED", false),
+			Interval:  getDuration("GOROUTINE_LEAK_INTERVAL", 30*time.Second),
+			Window:    getDuration("GOROUTINE_LEAK_WINDOW", 15*time.Minute),
+			MinGrowth: getInt("GOROUTINE_LEAK_MIN_GROWTH", 10),
+		},
+		Payload: PayloadConfig{
+			MaxBytes:    getInt("PAYLOAD_MAX_BYTES", 100<<20),
+			MaxDuration: getNonNegativeDuration("PAYLOAD_MAX_DURATION", time.Minute),
+		},
+		SSE: SSEConfig{
+			MaxEvents:   getInt("SSE_MAX_EVENTS", 10000),
+			MaxDuration: getNonNegativeDuration("SSE_MAX_DURATION", 10*time.Minute),
+		},
+		AdminAuth: AdminAuthConfig{
+			Token:     getEnv("ADMIN_AUTH_TOKEN", ""),
+			TokenFile: getEnv("ADMIN_AUTH_TOKEN_FILE", ""),
+			Routes:    getStringSliceWithDefault("ADMIN_AUTH_ROUTES", []string{"/admin/", "/debug/", "/drain", "/quitquitquit"}),
 		},
+		Store: StoreConfig{
+			RedisAddr:      getEnv("REDIS_ADDR", ""),
+			RedisPassword:  getEnv("REDIS_PASSWORD", ""),
+			RedisDB:        getInt("REDIS_DB", 0),
+			HealthInterval: getDuration("STORE_HEALTH_INTERVAL", 10*time.Second),
+		},
+	}
+}
+
+// loadOutboundClients reads OUTBOUND_<NAME>_TIMEOUT, OUTBOUND_<NAME>_MAX_ATTEMPTS
+// and OUTBOUND_<NAME>_HEDGE_DELAY for every named outbound client
+func loadOutboundClients() map[string]OutboundClientConfig {
+	clients := make(map[string]OutboundClientConfig, len(OutboundClientNames))
+	for _, name := range OutboundClientNames {
+		prefix := "OUTBOUND_" + strings.ToUpper(name) + "_"
+		clients[name] = OutboundClientConfig{
+			Timeout:     getDuration(prefix+"TIMEOUT", 10*time.Second),
+			MaxAttempts: getInt(prefix+"MAX_ATTEMPTS", 1),
+			HedgeDelay:  getNonNegativeDuration(prefix+"HEDGE_DELAY", 0),
+		}
 	}
+	return clients
 }
 
 // getEnv returns the value of an environment variable or a default value
 func getEnv(key, defaultValue string) string {
-	if value := os.Getenv(key); value != "" {
+	if value := lookupEnv(key); value != "" {
 		return value
 	}
 	return defaultValue
@@ -162,50 +1004,149 @@ func getEnv(key, defaultValue string) string {
 
 // getDuration parses a duration from an environment variable or returns a default value
 func getDuration(key string, defaultValue time.Duration) time.Duration {
-	if value := os.Getenv(key); value != "" {
-		if duration, err := time.ParseDuration(value); err == nil {
-			if duration > 0 {
-				return duration
-			}
+	if value := lookupEnv(key); value != "" {
+		duration, err := time.ParseDuration(value)
+		if err == nil && duration > 0 {
+			return duration
+		}
+		reportInvalid(key, value, "must be a positive duration such as 30s")
+	}
+	return defaultValue
+}
+
+// getNonNegativeDuration parses a duration from an environment variable,
+// accepting zero for settings where it disables a feature, or returns a default value
+func getNonNegativeDuration(key string, defaultValue time.Duration) time.Duration {
+	if value := lookupEnv(key); value != "" {
+		duration, err := time.ParseDuration(value)
+		if err == nil && duration >= 0 {
+			return duration
 		}
+		reportInvalid(key, value, "must be a non-negative duration such as 30s or 0s")
 	}
 	return defaultValue
 }
 
+// getDurationMap parses comma-separated key=duration pairs from an
+// environment variable, skipping malformed entries
+func getDurationMap(key string) map[string]time.Duration {
+	result := map[string]time.Duration{}
+	for k, v := range getStringMap(key) {
+		duration, err := time.ParseDuration(v)
+		if err != nil || duration <= 0 {
+			reportInvalid(key, k+"="+v, "durations must be positive such as 5s")
+			continue
+		}
+		result[k] = duration
+	}
+	return result
+}
+
 // getInt parses an integer from an environment variable or returns a default value
 func getInt(key string, defaultValue int) int {
-	if value := os.Getenv(key); value != "" {
-		if intValue, err := strconv.Atoi(value); err == nil {
-			if intValue >= 0 {
-				return intValue
-			}
+	if value := lookupEnv(key); value != "" {
+		intValue, err := strconv.Atoi(value)
+		if err == nil && intValue >= 0 {
+			return intValue
 		}
+		reportInvalid(key, value, "must be a non-negative integer")
 	}
 	return defaultValue
 }
 
 // getFloat parses a float from an environment variable or returns a default value
 func getFloat(key string, defaultValue float64) float64 {
-	if value := os.Getenv(key); value != "" {
-		if floatValue, err := strconv.ParseFloat(value, 64); err == nil {
-			if floatValue > 0 {
-				return floatValue
-			}
+	if value := lookupEnv(key); value != "" {
+		floatValue, err := strconv.ParseFloat(value, 64)
+		if err == nil && floatValue > 0 {
+			return floatValue
+		}
+		reportInvalid(key, value, "must be a positive number")
+	}
+	return defaultValue
+}
+
+// getNonNegativeFloat parses a float from an environment variable, accepting
+// zero for rates and limits where it disables a feature, or returns a default value
+func getNonNegativeFloat(key string, defaultValue float64) float64 {
+	if value := lookupEnv(key); value != "" {
+		floatValue, err := strconv.ParseFloat(value, 64)
+		if err == nil && floatValue >= 0 {
+			return floatValue
 		}
+		reportInvalid(key, value, "must be a non-negative number")
 	}
 	return defaultValue
 }
 
 // getBool parses a boolean from an environment variable or returns a default value
 func getBool(key string, defaultValue bool) bool {
-	if value := os.Getenv(key); value != "" {
+	if value := lookupEnv(key); value != "" {
 		if boolValue, err := strconv.ParseBool(value); err == nil {
 			return boolValue
 		}
+		reportInvalid(key, value, "must be true or false")
+	}
+	return defaultValue
+}
+
+// getStringSlice parses a comma-separated list from an environment variable,
+// dropping empty entries
+func getStringSlice(key string) []string {
+	var result []string
+	for _, item := range strings.Split(lookupEnv(key), ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			result = append(result, item)
+		}
+	}
+	return result
+}
+
+// getStringSliceWithDefault parses a comma-separated list from an environment
+// variable, returning defaultValue when it is unset or empty
+func getStringSliceWithDefault(key string, defaultValue []string) []string {
+	if result := getStringSlice(key); len(result) > 0 {
+		return result
 	}
 	return defaultValue
 }
 
+// getIntSliceWithDefault parses a comma-separated list of integers from an
+// environment variable, returning defaultValue when it is unset or invalid
+func getIntSliceWithDefault(key string, defaultValue []int) []int {
+	items := getStringSlice(key)
+	if len(items) == 0 {
+		return defaultValue
+	}
+	result := make([]int, 0, len(items))
+	for _, item := range items {
+		value, err := strconv.Atoi(item)
+		if err != nil {
+			reportInvalid(key, lookupEnv(key), "must be a comma-separated list of integers")
+			return defaultValue
+		}
+		result = append(result, value)
+	}
+	return result
+}
+
+// getStringMap parses comma-separated key=value pairs from an environment variable,
+// skipping malformed entries
+func getStringMap(key string) map[string]string {
+	result := map[string]string{}
+	for _, pair := range strings.Split(lookupEnv(key), ",") {
+		k, v, ok := strings.Cut(strings.TrimSpace(pair), "=")
+		if !ok || strings.TrimSpace(k) == "" || strings.TrimSpace(v) == "" {
+			if pair = strings.TrimSpace(pair); pair != "" {
+				reportInvalid(key, pair, "entries must be key=value")
+			}
+			continue
+		}
+		result[strings.TrimSpace(k)] = strings.TrimSpace(v)
+	}
+	return result
+}
+
 // validateServerConfig validates ServerConfig fields
 func validateServerConfig(sc ServerConfig) error {
 	// Validate port is a valid port number
@@ -226,11 +1167,78 @@ func validateServerConfig(sc ServerConfig) error {
 		return fmt.Errorf("invalid server idle timeout: must be positive")
 	}
 
+	if sc.DrainDelay < 0 || sc.DrainDelay > 5*time.Minute {
+		return fmt.Errorf("invalid server drain delay: %v (must be between 0 and 5m)", sc.DrainDelay)
+	}
+
+	if sc.GRPCPort != "" {
+		if port, err := strconv.Atoi(sc.GRPCPort); err != nil {
+			return fmt.Errorf("invalid gRPC port '%s': must be a number", sc.GRPCPort)
+		} else if port < 1 || port > 65535 {
+			return fmt.Errorf("invalid gRPC port %d: must be between 1 and 65535", port)
+		}
+		if sc.GRPCPort == sc.Port {
+			return fmt.Errorf("invalid gRPC port %s: must differ from the HTTP port", sc.GRPCPort)
+		}
+	}
+
+	// A serving certificate requires its key and vice versa
+	if (sc.TLSCertFile == "") != (sc.TLSKeyFile == "") {
+		return fmt.Errorf("invalid server TLS config: cert file and key file must be set together")
+	}
+	if sc.TLSCertFile != "" {
+		if port, err := strconv.Atoi(sc.TLSPort); err != nil {
+			return fmt.Errorf("invalid TLS port '%s': must be a number", sc.TLSPort)
+		} else if port < 1 || port > 65535 {
+			return fmt.Errorf("invalid TLS port %d: must be between 1 and 65535", port)
+		}
+		if sc.TLSPort == sc.Port || sc.TLSPort == sc.GRPCPort {
+			return fmt.Errorf("invalid TLS port %s: must differ from the HTTP and gRPC ports", sc.TLSPort)
+		}
+	}
+
+	if sc.AdminPort != "" {
+		if port, err := strconv.Atoi(sc.AdminPort); err != nil {
+			return fmt.Errorf("invalid admin port '%s': must be a number", sc.AdminPort)
+		} else if port < 1 || port > 65535 {
+			return fmt.Errorf("invalid admin port %d: must be between 1 and 65535", port)
+		}
+		if sc.AdminPort == sc.Port || sc.AdminPort == sc.GRPCPort || (sc.TLSCertFile != "" && sc.AdminPort == sc.TLSPort) {
+			return fmt.Errorf("invalid admin port %s: must differ from the HTTP, gRPC and TLS ports", sc.AdminPort)
+		}
+	}
+
+	if sc.TCPEchoPort != "" {
+		if port, err := strconv.Atoi(sc.TCPEchoPort); err != nil {
+			return fmt.Errorf("invalid TCP echo port '%s': must be a number", sc.TCPEchoPort)
+		} else if port < 1 || port > 65535 {
+			return fmt.Errorf("invalid TCP echo port %d: must be between 1 and 65535", port)
+		}
+		if sc.TCPEchoPort == sc.Port || sc.TCPEchoPort == sc.GRPCPort || sc.TCPEchoPort == sc.AdminPort || (sc.TLSCertFile != "" && sc.TCPEchoPort == sc.TLSPort) {
+			return fmt.Errorf("invalid TCP echo port %s: must differ from the HTTP, gRPC, TLS and admin ports", sc.TCPEchoPort)
+		}
+		if sc.TCPEchoIdleTimeout <= 0 {
+			return fmt.Errorf("invalid TCP echo idle timeout: must be positive")
+		}
+	}
+
+	// The token is sent as a bearer token in an Authorization header
+	if strings.ContainsAny(sc.LifecycleToken, " \t\r\n") {
+		return fmt.Errorf("invalid lifecycle token: must not contain whitespace")
+	}
+
 	return nil
 }
 
 // validateMetadataConfig validates MetadataConfig fields
 func validateMetadataConfig(mc MetadataConfig) error {
+	// Validate provider is supported, empty reads the GCE metadata server
+	switch mc.Provider {
+	case "", "gce", "aws", "azure":
+	default:
+		return fmt.Errorf("invalid metadata provider %q: must be gce, aws or azure", mc.Provider)
+	}
+
 	// Validate HTTP timeout is positive
 	if mc.HTTPTimeout <= 0 {
 		return fmt.Errorf("invalid metadata HTTP timeout: must be positive")
@@ -259,6 +1267,42 @@ func validateMetadataConfig(mc MetadataConfig) error {
 		return fmt.Errorf("invalid metadata retry multiplier: must be greater than 1.0")
 	}
 
+	// Validate jitter is a fraction of the delay
+	if mc.RetryJitter < 0 || mc.RetryJitter > 1 {
+		return fmt.Errorf("invalid metadata retry jitter: must be between 0 and 1")
+	}
+
+	// Validate retry budget is non-negative
+	if mc.RetryBudget < 0 {
+		return fmt.Errorf("invalid metadata retry budget: must be non-negative")
+	}
+
+	// Validate cache TTL is positive when the cache is enabled
+	if mc.CacheEnabled && mc.CacheTTL <= 0 {
+		return fmt.Errorf("invalid metadata cache TTL: must be positive")
+	}
+
+	// Validate the circuit breaker when it is enabled
+	if mc.BreakerFailureThreshold < 0 {
+		return fmt.Errorf("invalid metadata breaker failure threshold: must not be negative")
+	}
+	if mc.BreakerFailureThreshold > 0 && mc.BreakerResetTimeout <= 0 {
+		return fmt.Errorf("invalid metadata breaker reset timeout: must be positive when the breaker is enabled")
+	}
+
+	// Identity tokens are requested from the GCE metadata server only
+	for _, audience := range mc.IdentityTokenAudiences {
+		if audience == "" || strings.ContainsAny(audience, " \t\r\n") {
+			return fmt.Errorf("invalid identity token audience '%s': must be non-empty without whitespace", audience)
+		}
+	}
+	if len(mc.IdentityTokenAudiences) > 0 && mc.Provider != "" && mc.Provider != "gce" {
+		return fmt.Errorf("invalid identity token audiences: only the gce metadata provider issues identity tokens")
+	}
+	if mc.AccessTokenEnabled && len(mc.IdentityTokenAudiences) == 0 {
+		return fmt.Errorf("invalid metadata access token: requires METADATA_IDENTITY_TOKEN_AUDIENCES, which enables the endpoint")
+	}
+
 	return nil
 }
 
@@ -276,10 +1320,700 @@ func validateObservabilityConfig(oc ObservabilityConfig) error {
 	if !found {
 		return fmt.Errorf("invalid log level '%s': must be one of %s", oc.LogLevel, strings.Join(validLogLevels, ", "))
 	}
+	// Empty keeps the default JSON format
+	if oc.LogFormat != "" && oc.LogFormat != "json" && oc.LogFormat != "text" {
+		return fmt.Errorf("invalid log format '%s': must be json or text", oc.LogFormat)
+	}
 	// Validate shutdown timeout is positive
 	if oc.ShutdownTimeout <= 0 {
 		return fmt.Errorf("invalid shutdown timeout: must be positive")
 	}
 
+	// Validate profiler settings
+	validProfileTypes := []string{"cpu", "heap", "block", "mutex", "goroutine"}
+	for _, profileType := range oc.ProfileTypes {
+		if !slices.Contains(validProfileTypes, strings.ToLower(profileType)) {
+			return fmt.Errorf("invalid profile type '%s': must be one of %s", profileType, strings.Join(validProfileTypes, ", "))
+		}
+	}
+	if oc.ProfilePeriod < 0 {
+		return fmt.Errorf("invalid profile period: must not be negative")
+	}
+	if oc.ProfileUploadTimeout < 0 {
+		return fmt.Errorf("invalid profile upload timeout: must not be negative")
+	}
+	if oc.ProfileBlockRate < 0 {
+		return fmt.Errorf("invalid profile block rate: must not be negative")
+	}
+	if oc.ProfileMutexFraction < 0 {
+		return fmt.Errorf("invalid profile mutex fraction: must not be negative")
+	}
+
+	// Validate tracer backend settings
+	switch oc.TracingBackend {
+	case "", observability.TracingBackendDatadog, observability.TracingBackendOTel:
+	default:
+		return fmt.Errorf("invalid tracing backend '%s': must be %s or %s",
+			oc.TracingBackend, observability.TracingBackendDatadog, observability.TracingBackendOTel)
+	}
+	if oc.TracingOTLPEndpoint != "" {
+		if u, err := url.Parse(oc.TracingOTLPEndpoint); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("invalid tracing OTLP endpoint '%s': must be an http or https URL", oc.TracingOTLPEndpoint)
+		}
+	}
+
+	// Validate tracer sampling settings
+	if oc.TracingSampleRate < 0 || oc.TracingSampleRate > 1 {
+		return fmt.Errorf("invalid tracing sample rate %f: must be between 0 and 1", oc.TracingSampleRate)
+	}
+	for key, rate := range oc.TracingSamplingRules {
+		if _, _, _, err := observability.ParseSamplingRule(key, rate); err != nil {
+			return fmt.Errorf("invalid tracing sampling rules: %w", err)
+		}
+	}
+	if oc.TracingAgentAddr != "" {
+		if _, _, err := net.SplitHostPort(oc.TracingAgentAddr); err != nil {
+			return fmt.Errorf("invalid tracing agent address '%s': must be host:port", oc.TracingAgentAddr)
+		}
+	}
+	if oc.ExporterRetryMaxDelay < 0 {
+		return fmt.Errorf("invalid exporter retry max delay: must not be negative")
+	}
+
+	// Validate header thresholds
+	if oc.HeaderBytesThreshold < 0 {
+		return fmt.Errorf("invalid header bytes threshold: must not be negative")
+	}
+	if oc.HeaderCountThreshold < 0 {
+		return fmt.Errorf("invalid header count threshold: must not be negative")
+	}
+
+	// Validate request logging settings
+	if oc.RequestLogSampleRate < 0 || oc.RequestLogSampleRate > 1 {
+		return fmt.Errorf("invalid request log sample rate %f: must be between 0 and 1", oc.RequestLogSampleRate)
+	}
+	if oc.SlowRequestThreshold < 0 {
+		return fmt.Errorf("invalid slow request threshold: must not be negative")
+	}
+	if oc.LogBufferSize < 0 {
+		return fmt.Errorf("invalid log buffer size: must not be negative")
+	}
+	if oc.RecentRequests < 0 {
+		return fmt.Errorf("invalid recent requests: must not be negative")
+	}
+	for _, path := range oc.LogExcludePaths {
+		if !strings.HasPrefix(path, "/") {
+			return fmt.Errorf("invalid log exclude path '%s': must start with /", path)
+		}
+	}
+
+	// Validate PII redaction rules
+	if oc.PIIIPRedaction != "" && !slices.Contains(observability.IPRedactionModes, oc.PIIIPRedaction) {
+		return fmt.Errorf("invalid PII IP redaction '%s': must be one of %s", oc.PIIIPRedaction, strings.Join(observability.IPRedactionModes, ", "))
+	}
+	if oc.PIIUserAgentMaxLength < 0 {
+		return fmt.Errorf("invalid PII user agent max length: must not be negative")
+	}
+
+	return nil
+}
+
+// validateOutboundConfig validates OutboundConfig fields
+func validateOutboundConfig(oc OutboundConfig) error {
+	// A client certificate requires its key and vice versa
+	if (oc.TLSCertFile == "") != (oc.TLSKeyFile == "") {
+		return fmt.Errorf("invalid outbound TLS config: cert file and key file must be set together")
+	}
+
+	// Allowlist entries must be hosts, not URLs
+	for _, host := range oc.OverrideAllowlist {
+		if strings.Contains(host, "/") {
+			return fmt.Errorf("invalid outbound override allowlist entry '%s': must be a host name", host)
+		}
+	}
+
+	if oc.MaxIdleConnsPerHost < 0 {
+		return fmt.Errorf("invalid outbound max idle connections per host: must not be negative")
+	}
+	if oc.IdleConnTimeout < 0 {
+		return fmt.Errorf("invalid outbound idle connection timeout: must not be negative")
+	}
+	for name, client := range oc.Clients {
+		if client.Timeout <= 0 {
+			return fmt.Errorf("invalid outbound %s client timeout: must be positive", name)
+		}
+		if client.MaxAttempts < 1 || client.MaxAttempts > 10 {
+			return fmt.Errorf("invalid outbound %s client max attempts %d: must be between 1 and 10", name, client.MaxAttempts)
+		}
+		if client.HedgeDelay < 0 || (client.HedgeDelay > 0 && client.HedgeDelay >= client.Timeout) {
+			return fmt.Errorf("invalid outbound %s client hedge delay %v: must be zero or below the timeout %v", name, client.HedgeDelay, client.Timeout)
+		}
+	}
+
+	return nil
+}
+
+// validateCacheConfig validates CacheConfig fields
+func validateCacheConfig(cc CacheConfig) error {
+	if !cc.Enabled {
+		return nil
+	}
+
+	// Caching must be scoped to explicit routes
+	if len(cc.Routes) == 0 {
+		return fmt.Errorf("invalid response cache config: at least one route is required when enabled")
+	}
+	for _, route := range cc.Routes {
+		if !strings.HasPrefix(route, "/") {
+			return fmt.Errorf("invalid response cache route '%s': must start with /", route)
+		}
+	}
+
+	if cc.TTL <= 0 {
+		return fmt.Errorf("invalid response cache TTL: must be positive")
+	}
+
+	return nil
+}
+
+// validateRespondConfig validates RespondConfig fields
+func validateRespondConfig(rc RespondConfig) error {
+	if rc.MaxDelay < 0 || rc.MaxDelay > 5*time.Minute {
+		return fmt.Errorf("invalid respond max delay: %v (must be between 0 and 5m)", rc.MaxDelay)
+	}
+	return nil
+}
+
+// validateStoreConfig validates StoreConfig fields
+func validateStoreConfig(sc StoreConfig) error {
+	if sc.RedisAddr == "" {
+		return nil
+	}
+
+	if _, _, err := net.SplitHostPort(sc.RedisAddr); err != nil {
+		return fmt.Errorf("invalid redis address '%s': must be host:port", sc.RedisAddr)
+	}
+	if sc.RedisDB < 0 {
+		return fmt.Errorf("invalid redis database %d: must be non-negative", sc.RedisDB)
+	}
+	if sc.HealthInterval <= 0 {
+		return fmt.Errorf("invalid store health interval: must be positive")
+	}
+
+	return nil
+}
+
+// validateDBPingConfig validates DBPingConfig fields
+func validateDBPingConfig(dc DBPingConfig) error {
+	if dc.Driver == "" {
+		return nil
+	}
+
+	if !slices.Contains([]string{"postgres", "mysql"}, dc.Driver) {
+		return fmt.Errorf("invalid dbping driver '%s', allowed values: postgres, mysql", dc.Driver)
+	}
+	if dc.DSNFile == "" {
+		return fmt.Errorf("dbping DSN file is required when a driver is set")
+	}
+	if dc.Timeout <= 0 {
+		return fmt.Errorf("invalid dbping timeout: must be positive")
+	}
+
 	return nil
 }
+
+// validateCatalogConfig validates CatalogConfig fields
+func validateCatalogConfig(cc CatalogConfig) error {
+	if cc.URL == "" {
+		return nil
+	}
+
+	u, err := url.Parse(cc.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("invalid catalog URL '%s': must be an absolute http or https URL", cc.URL)
+	}
+
+	return nil
+}
+
+// validateHeartbeatConfig validates HeartbeatConfig fields
+func validateHeartbeatConfig(hc HeartbeatConfig) error {
+	if len(hc.Targets) == 0 {
+		return nil
+	}
+
+	for _, target := range hc.Targets {
+		u, err := url.Parse(target)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("invalid heartbeat target '%s': must be an absolute http or https URL", target)
+		}
+	}
+	if hc.Interval < 100*time.Millisecond {
+		return fmt.Errorf("invalid heartbeat interval: %v (must be at least 100ms)", hc.Interval)
+	}
+
+	return nil
+}
+
+// validateProxyConfig validates ProxyConfig fields
+func validateProxyConfig(pc ProxyConfig) error {
+	// Allowlist entries must be hosts, not URLs
+	for _, host := range pc.Allowlist {
+		if host == "" || strings.Contains(host, "/") {
+			return fmt.Errorf("invalid proxy allowlist entry '%s': must be a host name", host)
+		}
+	}
+
+	// The mirror target must be a base URL, its path is replaced by the proxied one
+	if pc.MirrorTarget != "" {
+		u, err := url.Parse(pc.MirrorTarget)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("invalid proxy mirror target '%s': must be an absolute http or https URL", pc.MirrorTarget)
+		}
+	}
+	if pc.MirrorSampleRate < 0 || pc.MirrorSampleRate > 1 {
+		return fmt.Errorf("invalid proxy mirror sample rate: %v (must be between 0 and 1)", pc.MirrorSampleRate)
+	}
+
+	return nil
+}
+
+// validateRateLimitConfig validates RateLimitConfig fields
+func validateRateLimitConfig(rc RateLimitConfig) error {
+	if rc.RPS < 0 {
+		return fmt.Errorf("invalid rate limit RPS: %v (must not be negative)", rc.RPS)
+	}
+	if rc.RPS == 0 {
+		return nil
+	}
+
+	if rc.Burst < 0 {
+		return fmt.Errorf("invalid rate limit burst: %d (must not be negative)", rc.Burst)
+	}
+	if rc.TrustedHops < 0 || rc.TrustedHops > 10 {
+		return fmt.Errorf("invalid rate limit trusted hops: %d (must be between 0 and 10)", rc.TrustedHops)
+	}
+	for _, route := range rc.ExcludeRoutes {
+		if !strings.HasPrefix(route, "/") {
+			return fmt.Errorf("invalid rate limit exclude route '%s': must start with /", route)
+		}
+	}
+
+	return nil
+}
+
+// validateConcurrencyLimitConfig validates ConcurrencyLimitConfig fields
+func validateConcurrencyLimitConfig(cc ConcurrencyLimitConfig) error {
+	switch cc.Mode {
+	case "":
+		return nil
+	case "fixed", "gradient":
+	default:
+		return fmt.Errorf("invalid concurrency limit mode: %s (must be fixed or gradient)", cc.Mode)
+	}
+
+	if cc.Limit < 1 {
+		return fmt.Errorf("invalid concurrency limit: %d (must be positive)", cc.Limit)
+	}
+	if cc.Mode == "gradient" && (cc.MinLimit < 1 || cc.MinLimit > cc.Limit || cc.Limit > cc.MaxLimit) {
+		return fmt.Errorf("invalid gradient concurrency limits: min %d, initial %d, max %d (must be positive and ordered)", cc.MinLimit, cc.Limit, cc.MaxLimit)
+	}
+	for _, route := range cc.ExcludeRoutes {
+		if !strings.HasPrefix(route, "/") {
+			return fmt.Errorf("invalid concurrency limit exclude route '%s': must start with /", route)
+		}
+	}
+	if cc.QueueSize < 0 {
+		return fmt.Errorf("invalid concurrency queue size: %d (must not be negative)", cc.QueueSize)
+	}
+	if cc.QueueSize > 0 && cc.QueueTimeout <= 0 {
+		return fmt.Errorf("invalid concurrency queue timeout: must be positive when requests are queued")
+	}
+	if cc.RetryAfter < 0 {
+		return fmt.Errorf("invalid concurrency retry after: must not be negative")
+	}
+
+	return nil
+}
+
+// validateJWTConfig validates JWTConfig fields
+func validateJWTConfig(jc JWTConfig) error {
+	switch jc.Mode {
+	case "":
+		return nil
+	case "enforce", "observe":
+	default:
+		return fmt.Errorf("invalid JWT mode: %s (must be enforce or observe)", jc.Mode)
+	}
+
+	u, err := url.Parse(jc.JWKSURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("invalid JWT JWKS URL '%s': must be an absolute http or https URL", jc.JWKSURL)
+	}
+	if jc.Issuer == "" {
+		return fmt.Errorf("invalid JWT configuration: issuer is required")
+	}
+	if jc.JWKSRefresh < time.Minute {
+		return fmt.Errorf("invalid JWT JWKS refresh: %v (must be at least 1m)", jc.JWKSRefresh)
+	}
+	for _, route := range jc.ExcludeRoutes {
+		if !strings.HasPrefix(route, "/") {
+			return fmt.Errorf("invalid JWT exclude route '%s': must start with /", route)
+		}
+	}
+
+	return nil
+}
+
+// validateWatchdogConfig validates WatchdogConfig fields
+func validateWatchdogConfig(wc WatchdogConfig) error {
+	if !wc.Enabled {
+		return nil
+	}
+
+	if wc.Interval < 100*time.Millisecond {
+		return fmt.Errorf("invalid watchdog interval: %v (must be at least 100ms)", wc.Interval)
+	}
+	if wc.MemoryWarningRatio <= 0 || wc.MemoryWarningRatio >= wc.MemoryCriticalRatio || wc.MemoryCriticalRatio > 1 {
+		return fmt.Errorf("invalid watchdog memory ratios: warning %v, critical %v (must satisfy 0 < warning < critical <= 1)",
+			wc.MemoryWarningRatio, wc.MemoryCriticalRatio)
+	}
+	if wc.HeapGrowthWarning < 0 {
+		return fmt.Errorf("invalid watchdog heap growth warning: %v (must not be negative)", wc.HeapGrowthWarning)
+	}
+	if wc.GoroutineCritical > 0 && wc.GoroutineCritical < wc.GoroutineWarning {
+		return fmt.Errorf("invalid watchdog goroutine thresholds: critical %d is below warning %d", wc.GoroutineCritical, wc.GoroutineWarning)
+	}
+	if wc.BlockedWriteWarning < 0 {
+		return fmt.Errorf("invalid watchdog blocked write warning: %v (must not be negative)", wc.BlockedWriteWarning)
+	}
+
+	return nil
+}
+
+// validateIstioConfig validates IstioConfig fields
+func validateIstioConfig(ic IstioConfig) error {
+	if ic.EnvoyAdminURL == "" {
+		return nil
+	}
+
+	u, err := url.Parse(ic.EnvoyAdminURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("invalid Envoy admin URL '%s': must be an absolute http or https URL", ic.EnvoyAdminURL)
+	}
+
+	return nil
+}
+
+// validateHealthConfig validates HealthConfig fields
+func validateHealthConfig(hc HealthConfig) error {
+	// Zero values fall back to the checker defaults
+	if hc.CheckInterval < 0 || (hc.CheckInterval > 0 && hc.CheckInterval < 100*time.Millisecond) {
+		return fmt.Errorf("invalid health check interval: %v (must be at least 100ms)", hc.CheckInterval)
+	}
+	if hc.StaleAfter < 0 || (hc.StaleAfter > 0 && hc.StaleAfter < hc.CheckInterval) {
+		return fmt.Errorf("invalid health stale after: %v (must be at least the check interval %v)", hc.StaleAfter, hc.CheckInterval)
+	}
+	if hc.UnhealthyAfter < 0 || (hc.UnhealthyAfter > 0 && hc.UnhealthyAfter < hc.StaleAfter) {
+		return fmt.Errorf("invalid health unhealthy after: %v (must be zero or at least stale after %v)", hc.UnhealthyAfter, hc.StaleAfter)
+	}
+	if hc.WebhookURL != "" {
+		// The URL is left out of the error, it usually embeds a secret
+		if u, err := url.Parse(hc.WebhookURL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("invalid health webhook URL: must be an http or https URL")
+		}
+	}
+	for name, timeout := range hc.CheckTimeouts {
+		if timeout <= 0 || timeout > time.Minute {
+			return fmt.Errorf("invalid health check timeout for %s: %v (must be between 0 and 1m)", name, timeout)
+		}
+	}
+	if hc.MetadataSlowThreshold < 0 {
+		return fmt.Errorf("invalid health metadata slow threshold: %v (must not be negative)", hc.MetadataSlowThreshold)
+	}
+	if timeout, ok := hc.CheckTimeouts["metadata_service"]; ok && hc.MetadataSlowThreshold >= timeout {
+		return fmt.Errorf("invalid health metadata slow threshold: %v (must be below the metadata_service timeout %v)", hc.MetadataSlowThreshold, timeout)
+	}
+
+	return nil
+}
+
+// validateFaultConfig validates FaultConfig fields
+// validatePprofConfig validates PprofConfig fields. Profiling tokens are
+// minted by an admin endpoint, which needs the admin token to be configured.
+func validatePprofConfig(pc PprofConfig, ac AdminAuthConfig) error {
+	if !pc.Enabled {
+		return nil
+	}
+
+	if ac.Token == "" && ac.TokenFile == "" {
+		return fmt.Errorf("pprof requires an admin token: set ADMIN_AUTH_TOKEN or ADMIN_AUTH_TOKEN_FILE so profiling tokens cannot be minted anonymously")
+	}
+
+	if pc.MaxTokenTTL <= 0 || pc.MaxTokenTTL > 24*time.Hour {
+		return fmt.Errorf("invalid pprof max token TTL: %v (must be between 0 and 24h)", pc.MaxTokenTTL)
+	}
+	if pc.TokenSecret != "" && len(pc.TokenSecret) < 32 {
+		return fmt.Errorf("invalid pprof token secret: must be at least 32 bytes")
+	}
+
+	return nil
+}
+
+func validateFaultConfig(fc FaultConfig) error {
+	if fc.MaxDelay < 0 || fc.MaxDelay > 5*time.Minute {
+		return fmt.Errorf("invalid fault max delay: %v (must be between 0 and 5m)", fc.MaxDelay)
+	}
+
+	if len(fc.ZoneSkewZones) == 0 {
+		return validateChaos(fc)
+	}
+
+	if fc.ZoneSkewLatency < 0 || fc.ZoneSkewLatency > 5*time.Minute {
+		return fmt.Errorf("invalid zone skew latency: %v (must be between 0 and 5m)", fc.ZoneSkewLatency)
+	}
+	if fc.ZoneSkewErrorRate < 0 || fc.ZoneSkewErrorRate > 1 {
+		return fmt.Errorf("invalid zone skew error rate %f: must be between 0 and 1", fc.ZoneSkewErrorRate)
+	}
+	if fc.ZoneSkewErrorRate > 0 && (fc.ZoneSkewErrorStatus < 400 || fc.ZoneSkewErrorStatus > 599) {
+		return fmt.Errorf("invalid zone skew error status %d: must be between 400 and 599", fc.ZoneSkewErrorStatus)
+	}
+	for _, route := range slices.Concat(fc.ZoneSkewRoutes, fc.ZoneSkewExcludeRoutes) {
+		if !strings.HasPrefix(route, "/") {
+			return fmt.Errorf("invalid zone skew route '%s': must start with /", route)
+		}
+	}
+
+	return validateChaos(fc)
+}
+
+// validateChaos validates the chaos fields of FaultConfig
+func validateChaos(fc FaultConfig) error {
+	if !fc.ChaosEnabled {
+		return nil
+	}
+
+	if fc.ChaosErrorRate < 0 || fc.ChaosErrorRate > 1 {
+		return fmt.Errorf("invalid chaos error rate %f: must be between 0 and 1", fc.ChaosErrorRate)
+	}
+	if fc.ChaosLatencyRate < 0 || fc.ChaosLatencyRate > 1 {
+		return fmt.Errorf("invalid chaos latency rate %f: must be between 0 and 1", fc.ChaosLatencyRate)
+	}
+	if fc.ChaosErrorRate > 0 && len(fc.ChaosErrorStatuses) == 0 {
+		return fmt.Errorf("chaos error statuses are required when the chaos error rate is set")
+	}
+	for _, status := range fc.ChaosErrorStatuses {
+		if status < 500 || status > 599 {
+			return fmt.Errorf("invalid chaos error status %d: must be between 500 and 599", status)
+		}
+	}
+	if fc.ChaosLatencyP50 < 0 || fc.ChaosLatencyP50 > fc.MaxDelay {
+		return fmt.Errorf("invalid chaos latency p50: %v (must be between 0 and the fault max delay %v)", fc.ChaosLatencyP50, fc.MaxDelay)
+	}
+	if fc.ChaosLatencyP99 != 0 && (fc.ChaosLatencyP99 < fc.ChaosLatencyP50 || fc.ChaosLatencyP99 > fc.MaxDelay) {
+		return fmt.Errorf("invalid chaos latency p99: %v (must be between the p50 %v and the fault max delay %v)", fc.ChaosLatencyP99, fc.ChaosLatencyP50, fc.MaxDelay)
+	}
+	for _, route := range slices.Concat(fc.ChaosRoutes, fc.ChaosExcludeRoutes) {
+		if !strings.HasPrefix(route, "/") {
+			return fmt.Errorf("invalid chaos route '%s': must start with /", route)
+		}
+	}
+
+	return nil
+}
+
+// validateRuntimeConfig validates RuntimeConfig fields
+func validateRuntimeConfig(rc RuntimeConfig) error {
+	if rc.MemoryLimit != "" {
+		if _, err := gctune.ParseMemoryLimit(rc.MemoryLimit); err != nil {
+			return err
+		}
+	}
+	if rc.GCPercent != "" {
+		if _, err := gctune.ParseGCPercent(rc.GCPercent); err != nil {
+			return err
+		}
+	}
+	if rc.MaxProcs != "" {
+		if _, err := gctune.ParseMaxProcs(rc.MaxProcs); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// validateTenantConfig validates TenantConfig fields
+func validateTenantConfig(tc TenantConfig) error {
+	if tc.Source == "" {
+		return nil
+	}
+
+	return tenant.Rule{Source: tc.Source, Key: tc.Key}.Validate()
+}
+
+// validateDriftConfig validates DriftConfig fields
+func validateDriftConfig(dc DriftConfig) error {
+	if dc.Interval < 0 {
+		return fmt.Errorf("invalid config drift interval: must not be negative")
+	}
+	if dc.Dir != "" && !filepath.IsAbs(dc.Dir) {
+		return fmt.Errorf("invalid config drift dir '%s': must be an absolute path", dc.Dir)
+	}
+	if dc.Reload && dc.Dir == "" {
+		return fmt.Errorf("invalid config reload: requires CONFIG_DRIFT_DIR, the mounted ConfigMap reloaded")
+	}
+
+	return nil
+}
+
+// validateCORSConfig validates CORSConfig fields
+func validateCORSConfig(cc CORSConfig) error {
+	for _, origin := range cc.AllowedOrigins {
+		if err := security.ValidateOrigin(origin); err != nil {
+			return err
+		}
+	}
+	// Browsers reject credentialed responses allowing any origin
+	if cc.AllowCredentials && slices.Contains(cc.AllowedOrigins, "*") {
+		return fmt.Errorf("invalid CORS config: credentials cannot be allowed for origin \"*\"")
+	}
+	for _, method := range cc.AllowedMethods {
+		if method == "" || strings.ToUpper(method) != method {
+			return fmt.Errorf("invalid CORS method '%s': must be an upper case HTTP method", method)
+		}
+	}
+	if cc.MaxAge < 0 {
+		return fmt.Errorf("invalid CORS max age: must not be negative")
+	}
+
+	return nil
+}
+
+// validateCoordinationConfig validates CoordinationConfig fields
+func validateCoordinationConfig(cc CoordinationConfig) error {
+	if cc.MaxWait < 0 || cc.MaxWait > time.Hour {
+		return fmt.Errorf("invalid coordination max wait: %v (must be between 0 and 1h)", cc.MaxWait)
+	}
+	return nil
+}
+
+// validateExpiryConfig validates ExpiryConfig fields
+func validateExpiryConfig(ec ExpiryConfig) error {
+	if ec.Window < 0 {
+		return fmt.Errorf("invalid expiry window: %v (must not be negative)", ec.Window)
+	}
+	if ec.Interval != 0 && ec.Interval < time.Second {
+		return fmt.Errorf("invalid expiry check interval: %v (must be at least 1s)", ec.Interval)
+	}
+	for _, file := range append(append([]string{}, ec.CertFiles...), ec.TokenFiles...) {
+		if file == "" {
+			return fmt.Errorf("invalid expiry file: path must not be empty")
+		}
+	}
+	return nil
+}
+
+// validateCompressionConfig validates CompressionConfig fields
+func validateCompressionConfig(cc CompressionConfig) error {
+	if cc.MinSize < 0 {
+		return fmt.Errorf("invalid compression min size: %d (must not be negative)", cc.MinSize)
+	}
+	for _, contentType := range cc.ContentTypes {
+		if !strings.Contains(contentType, "/") || strings.ContainsAny(contentType, " ;") {
+			return fmt.Errorf("invalid compression content type '%s': must be a media type such as application/json or text/", contentType)
+		}
+	}
+	return nil
+}
+
+// validateArtifactConfig validates ArtifactConfig fields
+func validateArtifactConfig(ac ArtifactConfig) error {
+	if ac.Dir != "" && ac.GCSBucket != "" {
+		return fmt.Errorf("invalid artifact configuration: set either a directory or a GCS bucket, not both")
+	}
+	if ac.Interval != 0 && ac.Interval < time.Second {
+		return fmt.Errorf("invalid artifact interval: %v (must be at least 1s)", ac.Interval)
+	}
+	if ac.Keep < 0 {
+		return fmt.Errorf("invalid artifact keep: %d (must not be negative)", ac.Keep)
+	}
+	if strings.Contains(ac.GCSBucket, "/") {
+		return fmt.Errorf("invalid artifact GCS bucket '%s': must be a bucket name without gs:// or a path", ac.GCSBucket)
+	}
+	return nil
+}
+
+// validatePayloadConfig validates PayloadConfig fields
+func validatePayloadConfig(pc PayloadConfig) error {
+	if pc.MaxBytes < 0 {
+		return fmt.Errorf("invalid payload max bytes: %d (must not be negative)", pc.MaxBytes)
+	}
+	if pc.MaxDuration < 0 || pc.MaxDuration > 10*time.Minute {
+		return fmt.Errorf("invalid payload max duration: %v (must be between 0 and 10m)", pc.MaxDuration)
+	}
+	return nil
+}
+
+// validateSSEConfig validates SSEConfig fields
+func validateSSEConfig(sc SSEConfig) error {
+	if sc.MaxEvents < 0 {
+		return fmt.Errorf("invalid SSE max events: %d (must not be negative)", sc.MaxEvents)
+	}
+	// Streams outlive the idle timeouts under test, Envoy's default of 1h included
+	if sc.MaxDuration < 0 || sc.MaxDuration > 2*time.Hour {
+		return fmt.Errorf("invalid SSE max duration: %v (must be between 0 and 2h)", sc.MaxDuration)
+	}
+	return nil
+}
+
+// validateAdminAuthConfig validates AdminAuthConfig fields
+func validateAdminAuthConfig(ac AdminAuthConfig) error {
+	if ac.Token != "" && ac.TokenFile != "" {
+		return fmt.Errorf("invalid admin auth configuration: set either a token or a token file, not both")
+	}
+	// The token is sent as a bearer token in an Authorization header
+	if strings.ContainsAny(ac.Token, " \t\r\n") {
+		return fmt.Errorf("invalid admin auth token: must not contain whitespace")
+	}
+	for _, route := range ac.Routes {
+		if !strings.HasPrefix(route, "/") {
+			return fmt.Errorf("invalid admin auth route '%s': must start with /", route)
+		}
+	}
+	return nil
+}
+
+// validateGoroutineLeakConfig validates GoroutineLeakConfig fields
+func validateGoroutineLeakConfig(gc GoroutineLeakConfig) error {
+	if !gc.Enabled {
+		return nil
+	}
+	if gc.Interval < time.Second {
+		return fmt.Errorf("invalid goroutine leak interval: %v (must be at least 1s)", gc.Interval)
+	}
+	// A leak is only reported from three counts on
+	if gc.Window < 2*gc.Interval {
+		return fmt.Errorf("invalid goroutine leak window: %v (must be at least twice the interval %v)", gc.Window, gc.Interval)
+	}
+	if gc.MinGrowth < 1 {
+		return fmt.Errorf("invalid goroutine leak min growth: %d (must be at least 1)", gc.MinGrowth)
+	}
+	return nil
+}
+
+// Handler serves the configuration as JSON; secrets are never encoded
+func (c *Config) Handler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		jsonData, err := json.Marshal(c)
+		if err != nil {
+			observability.ErrorWithContext(r.Context(), fmt.Sprintf("Error encoding configuration: %v", err))
+			http.Error(w, "Failed to encode configuration", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		_, _ = w.Write(jsonData)
+	}
+}
@@ -1,7 +1,12 @@
 package config
 
 import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
 	"os"
+	"slices"
+	"strings"
 	"testing"
 	"time"
 )
@@ -14,6 +19,7 @@ func TestLoad(t *testing.T) {
 		"METADATA_HTTP_TIMEOUT", "METADATA_MAX_RETRIES", "METADATA_BASE_RETRY_DELAY",
 		"METADATA_MAX_RETRY_DELAY", "METADATA_RETRY_MULTIPLIER",
 		"LOG_LEVEL", "ENABLE_PROFILER", "ENABLE_TRACING", "SHUTDOWN_TIMEOUT",
+		"PRE_SHUTDOWN_DELAY", "SERVER_DRAIN_DELAY",
 	}
 
 	for _, env := range envVars {
@@ -47,6 +53,36 @@ func TestLoad(t *testing.T) {
 		if conf.Server.IdleTimeout != 60*time.Second {
 			t.Errorf("Expected default idle timeout 60s, got %v", conf.Server.IdleTimeout)
 		}
+		if conf.Server.DrainDelay != 5*time.Second {
+			t.Errorf("Expected default drain delay 5s, got %v", conf.Server.DrainDelay)
+		}
+		if conf.Server.TLSCertFile != "" {
+			t.Errorf("Expected TLS listener disabled by default, got cert file %q", conf.Server.TLSCertFile)
+		}
+		if !conf.Fault.RequestDelay {
+			t.Error("Expected requested delays to be honored by default")
+		}
+		if conf.Fault.ChaosEnabled {
+			t.Error("Expected chaos disabled by default")
+		}
+		if conf.Server.TLSPort != "8443" {
+			t.Errorf("Expected default TLS port 8443, got %s", conf.Server.TLSPort)
+		}
+		if conf.Server.AdminPort != "" {
+			t.Errorf("Expected admin listener disabled by default, got port %s", conf.Server.AdminPort)
+		}
+		if conf.Server.FramingDiagnostics {
+			t.Errorf("Expected framing diagnostics disabled by default")
+		}
+		if conf.Server.EnableH2C {
+			t.Errorf("Expected h2c disabled by default")
+		}
+		if conf.Server.LifecycleEndpoints || conf.Server.LifecycleToken != "" {
+			t.Errorf("Expected lifecycle endpoints disabled by default")
+		}
+		if conf.Server.TLSReloadInterval != 30*time.Second {
+			t.Errorf("Expected default TLS reload interval 30s, got %v", conf.Server.TLSReloadInterval)
+		}
 
 		// Test metadata defaults
 		if conf.Metadata.HTTPTimeout != 10*time.Second {
@@ -64,20 +100,261 @@ func TestLoad(t *testing.T) {
 		if conf.Metadata.RetryMultiplier != 2.0 {
 			t.Errorf("Expected default retry multiplier 2.0, got %f", conf.Metadata.RetryMultiplier)
 		}
+		if conf.Metadata.RetryJitter != 0.2 {
+			t.Errorf("Expected default retry jitter 0.2, got %f", conf.Metadata.RetryJitter)
+		}
+		if !conf.Metadata.CacheEnabled {
+			t.Error("Expected metadata cache to be enabled by default")
+		}
+		if conf.Metadata.CacheTTL != 5*time.Minute {
+			t.Errorf("Expected default metadata cache TTL 5m, got %v", conf.Metadata.CacheTTL)
+		}
+		if conf.Metadata.BreakerFailureThreshold != 5 || conf.Metadata.BreakerResetTimeout != 30*time.Second {
+			t.Errorf("Expected metadata breaker opening after 5 failures for 30s, got %d for %v",
+				conf.Metadata.BreakerFailureThreshold, conf.Metadata.BreakerResetTimeout)
+		}
+		if conf.Metadata.Provider != "gce" {
+			t.Errorf("Expected default metadata provider gce, got %s", conf.Metadata.Provider)
+		}
+		if len(conf.Metadata.IdentityTokenAudiences) != 0 || conf.Metadata.AccessTokenEnabled {
+			t.Errorf("Expected identity tokens disabled by default")
+		}
 
 		// Test observability defaults
 		if conf.Observability.LogLevel != "info" {
 			t.Errorf("Expected default log level 'info', got %s", conf.Observability.LogLevel)
 		}
+		if conf.Observability.LogFormat != "json" {
+			t.Errorf("Expected default log format 'json', got %s", conf.Observability.LogFormat)
+		}
 		if !conf.Observability.EnableProfiler {
 			t.Errorf("Expected default enable profiler true, got %t", conf.Observability.EnableProfiler)
 		}
 		if !conf.Observability.EnableTracing {
 			t.Errorf("Expected default enable tracing true, got %t", conf.Observability.EnableTracing)
 		}
+		if !conf.Observability.EnableMetrics {
+			t.Errorf("Expected default enable metrics true, got %t", conf.Observability.EnableMetrics)
+		}
+		if conf.Observability.HeaderBytesThreshold != 32768 {
+			t.Errorf("Expected default header bytes threshold 32768, got %d", conf.Observability.HeaderBytesThreshold)
+		}
+		if conf.Observability.HeaderCountThreshold != 100 {
+			t.Errorf("Expected default header count threshold 100, got %d", conf.Observability.HeaderCountThreshold)
+		}
+		if conf.Observability.RequestLogSampleRate != 1 {
+			t.Errorf("Expected every request logged by default, got sample rate %v", conf.Observability.RequestLogSampleRate)
+		}
+		if conf.Observability.SlowRequestThreshold != time.Second {
+			t.Errorf("Expected default slow request threshold 1s, got %v", conf.Observability.SlowRequestThreshold)
+		}
+		if conf.Observability.LogBufferSize != 0 {
+			t.Errorf("Expected synchronous logging by default, got buffer size %d", conf.Observability.LogBufferSize)
+		}
+		if conf.Observability.RecentRequests != 200 {
+			t.Errorf("Expected 200 recent requests kept by default, got %d", conf.Observability.RecentRequests)
+		}
+		if !slices.Equal(conf.Observability.PIIAllowedQueryParams, []string{"page", "limit"}) {
+			t.Errorf("Expected page and limit query params logged by default, got %v", conf.Observability.PIIAllowedQueryParams)
+		}
+		if conf.Observability.PIIIPRedaction != "truncate" {
+			t.Errorf("Expected client IPs truncated by default, got %s", conf.Observability.PIIIPRedaction)
+		}
+		if conf.Observability.PIIUserAgentMaxLength != 100 {
+			t.Errorf("Expected default user agent max length 100, got %d", conf.Observability.PIIUserAgentMaxLength)
+		}
+		if conf.Observability.EnableCostAccounting {
+			t.Errorf("Expected cost accounting disabled by default")
+		}
 		if conf.Observability.ShutdownTimeout != 5*time.Second {
 			t.Errorf("Expected default shutdown timeout 5s, got %v", conf.Observability.ShutdownTimeout)
 		}
+		if len(conf.Observability.ProfileTypes) != 0 {
+			t.Errorf("Expected no default profile types, got %v", conf.Observability.ProfileTypes)
+		}
+		if conf.Observability.ProfilePeriod != 60*time.Second {
+			t.Errorf("Expected default profile period 60s, got %v", conf.Observability.ProfilePeriod)
+		}
+
+		// Test rate limit defaults
+		if conf.RateLimit.RPS != 0 {
+			t.Errorf("Expected rate limiting disabled by default, got %v RPS", conf.RateLimit.RPS)
+		}
+		if !conf.RateLimit.PerClientIP {
+			t.Errorf("Expected per client IP rate limiting by default, got %t", conf.RateLimit.PerClientIP)
+		}
+
+		// Test concurrency limit defaults
+		if conf.ConcurrencyLimit.Mode != "" {
+			t.Errorf("Expected concurrency limiting disabled by default, got mode %s", conf.ConcurrencyLimit.Mode)
+		}
+		if conf.ConcurrencyLimit.Limit != 100 || conf.ConcurrencyLimit.MinLimit != 10 || conf.ConcurrencyLimit.MaxLimit != 1000 {
+			t.Errorf("Expected default concurrency limits 10/100/1000, got %d/%d/%d",
+				conf.ConcurrencyLimit.MinLimit, conf.ConcurrencyLimit.Limit, conf.ConcurrencyLimit.MaxLimit)
+		}
+
+		// Test JWT defaults
+		if conf.JWT.Mode != "" {
+			t.Errorf("Expected JWT validation disabled by default, got mode %s", conf.JWT.Mode)
+		}
+		if conf.JWT.JWKSRefresh != 20*time.Minute {
+			t.Errorf("Expected JWKS refresh 20m, got %v", conf.JWT.JWKSRefresh)
+		}
+
+		// Test watchdog defaults
+		if !conf.Watchdog.Enabled {
+			t.Errorf("Expected watchdog enabled by default, got %t", conf.Watchdog.Enabled)
+		}
+		if conf.Watchdog.MemoryWarningRatio != 0.8 || conf.Watchdog.MemoryCriticalRatio != 0.9 {
+			t.Errorf("Expected default watchdog memory ratios 0.8 and 0.9, got %v and %v",
+				conf.Watchdog.MemoryWarningRatio, conf.Watchdog.MemoryCriticalRatio)
+		}
+
+		// Test Istio info defaults
+		if conf.Istio.PodInfoDir != "/etc/podinfo" {
+			t.Errorf("Expected default pod info dir /etc/podinfo, got %s", conf.Istio.PodInfoDir)
+		}
+		if conf.Istio.EnvoyAdminURL != "http://localhost:15000" {
+			t.Errorf("Expected default Envoy admin URL http://localhost:15000, got %s", conf.Istio.EnvoyAdminURL)
+		}
+
+		// Test health checker defaults
+		if conf.Health.CheckInterval != 10*time.Second || conf.Health.StaleAfter != 30*time.Second {
+			t.Errorf("Expected default health check interval 10s and stale after 30s, got %v and %v",
+				conf.Health.CheckInterval, conf.Health.StaleAfter)
+		}
+		if conf.Health.UnhealthyAfter != 0 {
+			t.Errorf("Expected stale health results never to fail by default, got %v", conf.Health.UnhealthyAfter)
+		}
+		if conf.Health.WebhookURL != "" {
+			t.Errorf("Expected no health webhook by default, got %s", conf.Health.WebhookURL)
+		}
+		if len(conf.Health.CheckTimeouts) != 0 {
+			t.Errorf("Expected checks to keep their own timeouts by default, got %v", conf.Health.CheckTimeouts)
+		}
+		if conf.Health.MetadataSlowThreshold != time.Second {
+			t.Errorf("Expected default metadata slow threshold 1s, got %v", conf.Health.MetadataSlowThreshold)
+		}
+
+		// Test tracing backend defaults
+		if conf.Observability.TracingBackend != "datadog" {
+			t.Errorf("Expected default tracing backend datadog, got %s", conf.Observability.TracingBackend)
+		}
+		if conf.Observability.ExporterRetryMaxDelay != 30*time.Second {
+			t.Errorf("Expected default exporter retry max delay 30s, got %v", conf.Observability.ExporterRetryMaxDelay)
+		}
+		if conf.Observability.TracingOTLPEndpoint != "" {
+			t.Errorf("Expected no default OTLP endpoint, got %s", conf.Observability.TracingOTLPEndpoint)
+		}
+
+		// Test runtime defaults
+		if conf.Runtime.MemoryLimit != "" || conf.Runtime.GCPercent != "" {
+			t.Errorf("Expected runtime memory settings left to the runtime by default, got %q and %q",
+				conf.Runtime.MemoryLimit, conf.Runtime.GCPercent)
+		}
+		if conf.Runtime.MaxProcs != "auto" {
+			t.Errorf("Expected GOMAXPROCS to follow the CPU limit by default, got %q", conf.Runtime.MaxProcs)
+		}
+
+		// Test tenant defaults
+		if conf.Tenant.Source != "" {
+			t.Errorf("Expected tenant attribution disabled by default, got source %q", conf.Tenant.Source)
+		}
+
+		// Test config drift defaults
+		if conf.Drift.Dir != "" {
+			t.Errorf("Expected config drift detection disabled by default, got dir %q", conf.Drift.Dir)
+		}
+		if conf.Drift.Interval != time.Minute {
+			t.Errorf("Expected default config drift interval 1m, got %v", conf.Drift.Interval)
+		}
+		if conf.Drift.Reload {
+			t.Error("Expected config reload disabled by default")
+		}
+
+		// Test CORS defaults
+		if len(conf.CORS.AllowedOrigins) != 0 {
+			t.Errorf("Expected CORS disabled by default, got origins %v", conf.CORS.AllowedOrigins)
+		}
+		if len(conf.CORS.AllowedMethods) != 3 || conf.CORS.AllowedMethods[0] != "GET" {
+			t.Errorf("Expected default CORS methods [GET HEAD POST], got %v", conf.CORS.AllowedMethods)
+		}
+		if conf.CORS.MaxAge != 10*time.Minute {
+			t.Errorf("Expected default CORS max age 10m, got %v", conf.CORS.MaxAge)
+		}
+
+		// Test response transform defaults
+		if conf.Transform.RulesFile != "" {
+			t.Errorf("Expected no response transform rules by default, got %q", conf.Transform.RulesFile)
+		}
+
+		// Test coordination defaults
+		if conf.Coordination.MaxWait != 5*time.Minute {
+			t.Errorf("Expected default coordination max wait 5m, got %v", conf.Coordination.MaxWait)
+		}
+
+		// Test compression defaults
+		if conf.Compression.Enabled {
+			t.Error("Expected compression disabled by default")
+		}
+		if conf.Compression.MinSize != 1024 {
+			t.Errorf("Expected default compression min size 1024, got %d", conf.Compression.MinSize)
+		}
+
+		// Test artifact writer defaults
+		if conf.Artifacts.Dir != "" || conf.Artifacts.GCSBucket != "" {
+			t.Error("Expected artifact writer disabled by default")
+		}
+		if conf.Artifacts.Interval != time.Minute {
+			t.Errorf("Expected default artifact interval 1m, got %v", conf.Artifacts.Interval)
+		}
+		if conf.Artifacts.Keep != 10 {
+			t.Errorf("Expected default artifact keep 10, got %d", conf.Artifacts.Keep)
+		}
+
+		// Test goroutine leak detector defaults
+		if conf.GoroutineLeak.Enabled {
+			t.Error("Expected goroutine leak detection disabled by default")
+		}
+		if conf.GoroutineLeak.Window != 15*time.Minute {
+			t.Errorf("Expected default goroutine leak window 15m, got %v", conf.GoroutineLeak.Window)
+		}
+
+		// Test payload generator defaults
+		if conf.Payload.MaxBytes != 100<<20 {
+			t.Errorf("Expected default payload max bytes 100MiB, got %d", conf.Payload.MaxBytes)
+		}
+		if conf.Payload.MaxDuration != time.Minute {
+			t.Errorf("Expected default payload max duration 1m, got %v", conf.Payload.MaxDuration)
+		}
+		if conf.SSE.MaxEvents != 10000 {
+			t.Errorf("Expected default SSE max events 10000, got %d", conf.SSE.MaxEvents)
+		}
+		if conf.SSE.MaxDuration != 10*time.Minute {
+			t.Errorf("Expected default SSE max duration 10m, got %v", conf.SSE.MaxDuration)
+		}
+		if conf.AdminAuth.Token != "" || conf.AdminAuth.TokenFile != "" {
+			t.Errorf("Expected admin routes to be open by default")
+		}
+		if len(conf.AdminAuth.Routes) != 4 || conf.AdminAuth.Routes[0] != "/admin/" {
+			t.Errorf("Expected default admin auth routes to cover /admin/, got %v", conf.AdminAuth.Routes)
+		}
+
+		// Test expiry watchdog defaults
+		if conf.Expiry.Window != 10*time.Minute {
+			t.Errorf("Expected default expiry window 10m, got %v", conf.Expiry.Window)
+		}
+		if conf.Expiry.Interval != time.Minute {
+			t.Errorf("Expected default expiry check interval 1m, got %v", conf.Expiry.Interval)
+		}
+
+		// Test pprof defaults
+		if conf.Pprof.Enabled {
+			t.Errorf("Expected pprof disabled by default, got %t", conf.Pprof.Enabled)
+		}
+		if conf.Pprof.MaxTokenTTL != time.Hour {
+			t.Errorf("Expected default pprof max token TTL 1h, got %v", conf.Pprof.MaxTokenTTL)
+		}
 	})
 
 	t.Run("environment variable overrides", func(t *testing.T) {
@@ -86,6 +363,8 @@ func TestLoad(t *testing.T) {
 		os.Setenv("SERVER_READ_TIMEOUT", "30s")
 		os.Setenv("SERVER_WRITE_TIMEOUT", "45s")
 		os.Setenv("SERVER_IDLE_TIMEOUT", "120s")
+		os.Setenv("SERVER_DRAIN_DELAY", "10s")
+		os.Setenv("PRE_SHUTDOWN_DELAY", "20s")
 		os.Setenv("METADATA_HTTP_TIMEOUT", "15s")
 		os.Setenv("METADATA_MAX_RETRIES", "5")
 		os.Setenv("METADATA_BASE_RETRY_DELAY", "200ms")
@@ -111,6 +390,9 @@ func TestLoad(t *testing.T) {
 		if conf.Server.IdleTimeout != 120*time.Second {
 			t.Errorf("Expected idle timeout 120s, got %v", conf.Server.IdleTimeout)
 		}
+		if conf.Server.DrainDelay != 20*time.Second {
+			t.Errorf("Expected PRE_SHUTDOWN_DELAY to take precedence with drain delay 20s, got %v", conf.Server.DrainDelay)
+		}
 
 		// Test metadata overrides
 		if conf.Metadata.HTTPTimeout != 15*time.Second {
@@ -287,6 +569,18 @@ func TestGetDuration(t *testing.T) {
 	}
 }
 
+func TestGetNonNegativeDuration(t *testing.T) {
+	t.Setenv("TEST_DURATION", "0s")
+	if got := getNonNegativeDuration("TEST_DURATION", 5*time.Second); got != 0 {
+		t.Errorf("Expected 0, got %v", got)
+	}
+
+	t.Setenv("TEST_DURATION", "-1s")
+	if got := getNonNegativeDuration("TEST_DURATION", 5*time.Second); got != 5*time.Second {
+		t.Errorf("Expected the default for a negative duration, got %v", got)
+	}
+}
+
 func TestGetInt(t *testing.T) {
 	tests := []struct {
 		name         string
@@ -401,6 +695,18 @@ func TestGetFloat(t *testing.T) {
 	}
 }
 
+func TestGetNonNegativeFloat(t *testing.T) {
+	t.Setenv("TEST_FLOAT", "0")
+	if got := getNonNegativeFloat("TEST_FLOAT", 1.5); got != 0 {
+		t.Errorf("Expected 0, got %f", got)
+	}
+
+	t.Setenv("TEST_FLOAT", "-0.5")
+	if got := getNonNegativeFloat("TEST_FLOAT", 1.5); got != 1.5 {
+		t.Errorf("Expected the default for a negative number, got %f", got)
+	}
+}
+
 func TestGetBool(t *testing.T) {
 	tests := []struct {
 		name         string
@@ -536,6 +842,39 @@ func TestSecurityConfigValidate(t *testing.T) {
 			},
 			expectError: false,
 		},
+		{
+			name: "HSTS and Permissions-Policy",
+			config: SecurityConfig{
+				HSTSMaxAge:            365 * 24 * time.Hour,
+				HSTSIncludeSubDomains: true,
+				HSTSPreload:           true,
+				PermissionsPolicy:     "camera=(), geolocation=(self \"https://maps.example.com\")",
+			},
+			expectError: false,
+		},
+		{
+			name: "negative HSTS max-age",
+			config: SecurityConfig{
+				HSTSMaxAge: -time.Hour,
+			},
+			expectError: true,
+		},
+		{
+			name: "HSTS preload with short max-age",
+			config: SecurityConfig{
+				HSTSMaxAge:            24 * time.Hour,
+				HSTSIncludeSubDomains: true,
+				HSTSPreload:           true,
+			},
+			expectError: true,
+		},
+		{
+			name: "malformed Permissions-Policy",
+			config: SecurityConfig{
+				PermissionsPolicy: "camera 'none'",
+			},
+			expectError: true,
+		},
 	}
 
 	for _, tt := range tests {
@@ -762,6 +1101,171 @@ func TestValidateServerConfig(t *testing.T) {
 			},
 			expectError: true,
 		},
+		{
+			name: "invalid drain delay",
+			config: ServerConfig{
+				Port:         "8080",
+				ReadTimeout:  5 * time.Second,
+				WriteTimeout: 10 * time.Second,
+				IdleTimeout:  60 * time.Second,
+				DrainDelay:   -time.Second,
+			},
+			expectError: true,
+		},
+		{
+			name: "valid gRPC port",
+			config: ServerConfig{
+				Port:         "8080",
+				GRPCPort:     "9090",
+				ReadTimeout:  5 * time.Second,
+				WriteTimeout: 10 * time.Second,
+				IdleTimeout:  60 * time.Second,
+			},
+			expectError: false,
+		},
+		{
+			name: "invalid gRPC port - not a number",
+			config: ServerConfig{
+				Port:         "8080",
+				GRPCPort:     "grpc",
+				ReadTimeout:  5 * time.Second,
+				WriteTimeout: 10 * time.Second,
+				IdleTimeout:  60 * time.Second,
+			},
+			expectError: true,
+		},
+		{
+			name: "valid TLS listener",
+			config: ServerConfig{
+				Port:         "8080",
+				ReadTimeout:  5 * time.Second,
+				WriteTimeout: 10 * time.Second,
+				IdleTimeout:  60 * time.Second,
+				TLSPort:      "8443",
+				TLSCertFile:  "/etc/tls/tls.crt",
+				TLSKeyFile:   "/etc/tls/tls.key",
+			},
+			expectError: false,
+		},
+		{
+			name: "TLS cert without key",
+			config: ServerConfig{
+				Port:         "8080",
+				ReadTimeout:  5 * time.Second,
+				WriteTimeout: 10 * time.Second,
+				IdleTimeout:  60 * time.Second,
+				TLSPort:      "8443",
+				TLSCertFile:  "/etc/tls/tls.crt",
+			},
+			expectError: true,
+		},
+		{
+			name: "invalid TLS port - same as HTTP port",
+			config: ServerConfig{
+				Port:         "8080",
+				ReadTimeout:  5 * time.Second,
+				WriteTimeout: 10 * time.Second,
+				IdleTimeout:  60 * time.Second,
+				TLSPort:      "8080",
+				TLSCertFile:  "/etc/tls/tls.crt",
+				TLSKeyFile:   "/etc/tls/tls.key",
+			},
+			expectError: true,
+		},
+		{
+			name: "valid admin port",
+			config: ServerConfig{
+				Port:         "8080",
+				ReadTimeout:  5 * time.Second,
+				WriteTimeout: 10 * time.Second,
+				IdleTimeout:  60 * time.Second,
+				AdminPort:    "9090",
+			},
+			expectError: false,
+		},
+		{
+			name: "invalid admin port - same as gRPC port",
+			config: ServerConfig{
+				Port:         "8080",
+				GRPCPort:     "9090",
+				ReadTimeout:  5 * time.Second,
+				WriteTimeout: 10 * time.Second,
+				IdleTimeout:  60 * time.Second,
+				AdminPort:    "9090",
+			},
+			expectError: true,
+		},
+		{
+			name: "invalid admin port - not a number",
+			config: ServerConfig{
+				Port:         "8080",
+				ReadTimeout:  5 * time.Second,
+				WriteTimeout: 10 * time.Second,
+				IdleTimeout:  60 * time.Second,
+				AdminPort:    "admin",
+			},
+			expectError: true,
+		},
+		{
+			name: "valid TCP echo port",
+			config: ServerConfig{
+				Port:               "8080",
+				ReadTimeout:        5 * time.Second,
+				WriteTimeout:       10 * time.Second,
+				IdleTimeout:        60 * time.Second,
+				TCPEchoPort:        "9000",
+				TCPEchoIdleTimeout: 5 * time.Minute,
+			},
+			expectError: false,
+		},
+		{
+			name: "invalid TCP echo port - same as admin port",
+			config: ServerConfig{
+				Port:               "8080",
+				ReadTimeout:        5 * time.Second,
+				WriteTimeout:       10 * time.Second,
+				IdleTimeout:        60 * time.Second,
+				AdminPort:          "9090",
+				TCPEchoPort:        "9090",
+				TCPEchoIdleTimeout: 5 * time.Minute,
+			},
+			expectError: true,
+		},
+		{
+			name: "valid lifecycle token",
+			config: ServerConfig{
+				Port:               "8080",
+				ReadTimeout:        5 * time.Second,
+				WriteTimeout:       10 * time.Second,
+				IdleTimeout:        60 * time.Second,
+				LifecycleEndpoints: true,
+				LifecycleToken:     "ci-drain-token",
+			},
+			expectError: false,
+		},
+		{
+			name: "invalid lifecycle token - whitespace",
+			config: ServerConfig{
+				Port:               "8080",
+				ReadTimeout:        5 * time.Second,
+				WriteTimeout:       10 * time.Second,
+				IdleTimeout:        60 * time.Second,
+				LifecycleEndpoints: true,
+				LifecycleToken:     "ci drain token",
+			},
+			expectError: true,
+		},
+		{
+			name: "invalid gRPC port - same as HTTP port",
+			config: ServerConfig{
+				Port:         "8080",
+				GRPCPort:     "8080",
+				ReadTimeout:  5 * time.Second,
+				WriteTimeout: 10 * time.Second,
+				IdleTimeout:  60 * time.Second,
+			},
+			expectError: true,
+		},
 		{
 			name: "invalid read timeout",
 			config: ServerConfig{
@@ -825,35 +1329,171 @@ func TestValidateMetadataConfig(t *testing.T) {
 			expectError: false,
 		},
 		{
-			name: "invalid HTTP timeout",
+			name: "valid breaker config",
 			config: MetadataConfig{
-				HTTPTimeout:     0,
-				MaxRetries:      3,
-				BaseRetryDelay:  100 * time.Millisecond,
-				MaxRetryDelay:   2 * time.Second,
-				RetryMultiplier: 2.0,
+				HTTPTimeout:             10 * time.Second,
+				MaxRetries:              3,
+				BaseRetryDelay:          100 * time.Millisecond,
+				MaxRetryDelay:           2 * time.Second,
+				RetryMultiplier:         2.0,
+				BreakerFailureThreshold: 5,
+				BreakerResetTimeout:     30 * time.Second,
 			},
-			expectError: true,
+			expectError: false,
 		},
 		{
-			name: "invalid max retries",
+			name: "negative breaker failure threshold",
 			config: MetadataConfig{
-				HTTPTimeout:     10 * time.Second,
-				MaxRetries:      -1,
-				BaseRetryDelay:  100 * time.Millisecond,
-				MaxRetryDelay:   2 * time.Second,
-				RetryMultiplier: 2.0,
+				HTTPTimeout:             10 * time.Second,
+				MaxRetries:              3,
+				BaseRetryDelay:          100 * time.Millisecond,
+				MaxRetryDelay:           2 * time.Second,
+				RetryMultiplier:         2.0,
+				BreakerFailureThreshold: -1,
 			},
 			expectError: true,
 		},
 		{
-			name: "invalid base retry delay",
+			name: "breaker without reset timeout",
 			config: MetadataConfig{
-				HTTPTimeout:     10 * time.Second,
-				MaxRetries:      3,
-				BaseRetryDelay:  0,
-				MaxRetryDelay:   2 * time.Second,
-				RetryMultiplier: 2.0,
+				HTTPTimeout:             10 * time.Second,
+				MaxRetries:              3,
+				BaseRetryDelay:          100 * time.Millisecond,
+				MaxRetryDelay:           2 * time.Second,
+				RetryMultiplier:         2.0,
+				BreakerFailureThreshold: 5,
+			},
+			expectError: true,
+		},
+		{
+			name: "valid identity token audiences",
+			config: MetadataConfig{
+				HTTPTimeout:            10 * time.Second,
+				MaxRetries:             3,
+				BaseRetryDelay:         100 * time.Millisecond,
+				MaxRetryDelay:          2 * time.Second,
+				RetryMultiplier:        2.0,
+				IdentityTokenAudiences: []string{"https://istio-test.example.com", "istio-test"},
+				AccessTokenEnabled:     true,
+			},
+			expectError: false,
+		},
+		{
+			name: "identity token audience with whitespace",
+			config: MetadataConfig{
+				HTTPTimeout:            10 * time.Second,
+				MaxRetries:             3,
+				BaseRetryDelay:         100 * time.Millisecond,
+				MaxRetryDelay:          2 * time.Second,
+				RetryMultiplier:        2.0,
+				IdentityTokenAudiences: []string{"istio test"},
+			},
+			expectError: true,
+		},
+		{
+			name: "identity token audiences with aws provider",
+			config: MetadataConfig{
+				Provider:               "aws",
+				HTTPTimeout:            10 * time.Second,
+				MaxRetries:             3,
+				BaseRetryDelay:         100 * time.Millisecond,
+				MaxRetryDelay:          2 * time.Second,
+				RetryMultiplier:        2.0,
+				IdentityTokenAudiences: []string{"istio-test"},
+			},
+			expectError: true,
+		},
+		{
+			name: "access token without identity token audiences",
+			config: MetadataConfig{
+				HTTPTimeout:        10 * time.Second,
+				MaxRetries:         3,
+				BaseRetryDelay:     100 * time.Millisecond,
+				MaxRetryDelay:      2 * time.Second,
+				RetryMultiplier:    2.0,
+				AccessTokenEnabled: true,
+			},
+			expectError: true,
+		},
+		{
+			name: "valid cache config",
+			config: MetadataConfig{
+				HTTPTimeout:     10 * time.Second,
+				MaxRetries:      3,
+				BaseRetryDelay:  100 * time.Millisecond,
+				MaxRetryDelay:   2 * time.Second,
+				RetryMultiplier: 2.0,
+				CacheEnabled:    true,
+				CacheTTL:        5 * time.Minute,
+			},
+			expectError: false,
+		},
+		{
+			name: "valid aws provider",
+			config: MetadataConfig{
+				Provider:        "aws",
+				HTTPTimeout:     10 * time.Second,
+				MaxRetries:      3,
+				BaseRetryDelay:  100 * time.Millisecond,
+				MaxRetryDelay:   2 * time.Second,
+				RetryMultiplier: 2.0,
+			},
+			expectError: false,
+		},
+		{
+			name: "unknown provider",
+			config: MetadataConfig{
+				Provider:        "openstack",
+				HTTPTimeout:     10 * time.Second,
+				MaxRetries:      3,
+				BaseRetryDelay:  100 * time.Millisecond,
+				MaxRetryDelay:   2 * time.Second,
+				RetryMultiplier: 2.0,
+			},
+			expectError: true,
+		},
+		{
+			name: "invalid cache TTL",
+			config: MetadataConfig{
+				HTTPTimeout:     10 * time.Second,
+				MaxRetries:      3,
+				BaseRetryDelay:  100 * time.Millisecond,
+				MaxRetryDelay:   2 * time.Second,
+				RetryMultiplier: 2.0,
+				CacheEnabled:    true,
+			},
+			expectError: true,
+		},
+		{
+			name: "invalid HTTP timeout",
+			config: MetadataConfig{
+				HTTPTimeout:     0,
+				MaxRetries:      3,
+				BaseRetryDelay:  100 * time.Millisecond,
+				MaxRetryDelay:   2 * time.Second,
+				RetryMultiplier: 2.0,
+			},
+			expectError: true,
+		},
+		{
+			name: "invalid max retries",
+			config: MetadataConfig{
+				HTTPTimeout:     10 * time.Second,
+				MaxRetries:      -1,
+				BaseRetryDelay:  100 * time.Millisecond,
+				MaxRetryDelay:   2 * time.Second,
+				RetryMultiplier: 2.0,
+			},
+			expectError: true,
+		},
+		{
+			name: "invalid base retry delay",
+			config: MetadataConfig{
+				HTTPTimeout:     10 * time.Second,
+				MaxRetries:      3,
+				BaseRetryDelay:  0,
+				MaxRetryDelay:   2 * time.Second,
+				RetryMultiplier: 2.0,
 			},
 			expectError: true,
 		},
@@ -890,6 +1530,30 @@ func TestValidateMetadataConfig(t *testing.T) {
 			},
 			expectError: true,
 		},
+		{
+			name: "invalid retry jitter",
+			config: MetadataConfig{
+				HTTPTimeout:     10 * time.Second,
+				MaxRetries:      3,
+				BaseRetryDelay:  100 * time.Millisecond,
+				MaxRetryDelay:   2 * time.Second,
+				RetryMultiplier: 2.0,
+				RetryJitter:     1.5,
+			},
+			expectError: true,
+		},
+		{
+			name: "negative retry budget",
+			config: MetadataConfig{
+				HTTPTimeout:     10 * time.Second,
+				MaxRetries:      3,
+				BaseRetryDelay:  100 * time.Millisecond,
+				MaxRetryDelay:   2 * time.Second,
+				RetryMultiplier: 2.0,
+				RetryBudget:     -0.1,
+			},
+			expectError: true,
+		},
 		{
 			name: "zero max retries is valid",
 			config: MetadataConfig{
@@ -962,17 +1626,2100 @@ func TestValidateObservabilityConfig(t *testing.T) {
 			},
 			expectError: true,
 		},
-	}
-
-	for _, tt := range tests {
-		t.Run(tt.name, func(t *testing.T) {
-			err := validateObservabilityConfig(tt.config)
-			if tt.expectError && err == nil {
-				t.Error("expected error but got none")
-			}
-			if !tt.expectError && err != nil {
-				t.Errorf("unexpected error: %v", err)
-			}
-		})
+		{
+			name: "valid profiler settings",
+			config: ObservabilityConfig{
+				LogLevel:             "info",
+				ShutdownTimeout:      5 * time.Second,
+				ProfileTypes:         []string{"cpu", "Heap", "block", "mutex", "goroutine"},
+				ProfilePeriod:        30 * time.Second,
+				ProfileUploadTimeout: 5 * time.Second,
+				ProfileBlockRate:     10000,
+				ProfileMutexFraction: 10,
+			},
+			expectError: false,
+		},
+		{
+			name: "unknown profile type",
+			config: ObservabilityConfig{
+				LogLevel:        "info",
+				ShutdownTimeout: 5 * time.Second,
+				ProfileTypes:    []string{"threads"},
+			},
+			expectError: true,
+		},
+		{
+			name: "negative profile period",
+			config: ObservabilityConfig{
+				LogLevel:        "info",
+				ShutdownTimeout: 5 * time.Second,
+				ProfilePeriod:   -time.Second,
+			},
+			expectError: true,
+		},
+		{
+			name: "valid tracer settings",
+			config: ObservabilityConfig{
+				LogLevel:             "info",
+				ShutdownTimeout:      5 * time.Second,
+				TracingAgentAddr:     "datadog-agent:8126",
+				TracingSampleRate:    0.5,
+				TracingSamplingRules: map[string]string{"istio-test": "0.1", "istio-test:metadata.fetch": "1"},
+			},
+			expectError: false,
+		},
+		{
+			name: "tracing sample rate above 1",
+			config: ObservabilityConfig{
+				LogLevel:          "info",
+				ShutdownTimeout:   5 * time.Second,
+				TracingSampleRate: 1.5,
+			},
+			expectError: true,
+		},
+		{
+			name: "invalid tracing sampling rule",
+			config: ObservabilityConfig{
+				LogLevel:             "info",
+				ShutdownTimeout:      5 * time.Second,
+				TracingSamplingRules: map[string]string{"istio-test": "all"},
+			},
+			expectError: true,
+		},
+		{
+			name: "tracing agent address without port",
+			config: ObservabilityConfig{
+				LogLevel:         "info",
+				ShutdownTimeout:  5 * time.Second,
+				TracingAgentAddr: "datadog-agent",
+			},
+			expectError: true,
+		},
+		{
+			name: "negative exporter retry max delay",
+			config: ObservabilityConfig{
+				LogLevel:              "info",
+				ShutdownTimeout:       5 * time.Second,
+				ExporterRetryMaxDelay: -time.Second,
+			},
+			expectError: true,
+		},
+		{
+			name: "valid otel backend",
+			config: ObservabilityConfig{
+				LogLevel:            "info",
+				ShutdownTimeout:     5 * time.Second,
+				TracingBackend:      "otel",
+				TracingOTLPEndpoint: "http://otel-collector:4318/v1/traces",
+			},
+			expectError: false,
+		},
+		{
+			name: "unknown tracing backend",
+			config: ObservabilityConfig{
+				LogLevel:        "info",
+				ShutdownTimeout: 5 * time.Second,
+				TracingBackend:  "jaeger",
+			},
+			expectError: true,
+		},
+		{
+			name: "OTLP endpoint without scheme",
+			config: ObservabilityConfig{
+				LogLevel:            "info",
+				ShutdownTimeout:     5 * time.Second,
+				TracingBackend:      "otel",
+				TracingOTLPEndpoint: "otel-collector:4318",
+			},
+			expectError: true,
+		},
+		{
+			name: "negative mutex fraction",
+			config: ObservabilityConfig{
+				LogLevel:             "info",
+				ShutdownTimeout:      5 * time.Second,
+				ProfileMutexFraction: -1,
+			},
+			expectError: true,
+		},
+		{
+			name: "disabled header thresholds",
+			config: ObservabilityConfig{
+				LogLevel:        "info",
+				ShutdownTimeout: 5 * time.Second,
+			},
+			expectError: false,
+		},
+		{
+			name: "negative header bytes threshold",
+			config: ObservabilityConfig{
+				LogLevel:             "info",
+				ShutdownTimeout:      5 * time.Second,
+				HeaderBytesThreshold: -1,
+			},
+			expectError: true,
+		},
+		{
+			name: "negative header count threshold",
+			config: ObservabilityConfig{
+				LogLevel:             "info",
+				ShutdownTimeout:      5 * time.Second,
+				HeaderCountThreshold: -1,
+			},
+			expectError: true,
+		},
+		{
+			name: "request log sample rate above 1",
+			config: ObservabilityConfig{
+				LogLevel:             "info",
+				ShutdownTimeout:      5 * time.Second,
+				RequestLogSampleRate: 1.5,
+			},
+			expectError: true,
+		},
+		{
+			name: "negative slow request threshold",
+			config: ObservabilityConfig{
+				LogLevel:             "info",
+				ShutdownTimeout:      5 * time.Second,
+				SlowRequestThreshold: -time.Second,
+			},
+			expectError: true,
+		},
+		{
+			name: "negative log buffer size",
+			config: ObservabilityConfig{
+				LogLevel:        "info",
+				ShutdownTimeout: 5 * time.Second,
+				LogBufferSize:   -1,
+			},
+			expectError: true,
+		},
+		{
+			name: "negative recent requests",
+			config: ObservabilityConfig{
+				LogLevel:        "info",
+				ShutdownTimeout: 5 * time.Second,
+				RecentRequests:  -1,
+			},
+			expectError: true,
+		},
+		{
+			name: "relative log exclude path",
+			config: ObservabilityConfig{
+				LogLevel:        "info",
+				ShutdownTimeout: 5 * time.Second,
+				LogExcludePaths: []string{"istio-test/health"},
+			},
+			expectError: true,
+		},
+		{
+			name: "hashed client IPs",
+			config: ObservabilityConfig{
+				LogLevel:              "info",
+				ShutdownTimeout:       5 * time.Second,
+				PIIAllowedQueryParams: []string{"page", "limit", "sort"},
+				PIIIPRedaction:        "hash",
+				PIIUserAgentMaxLength: 40,
+			},
+			expectError: false,
+		},
+		{
+			name: "invalid PII IP redaction",
+			config: ObservabilityConfig{
+				LogLevel:        "info",
+				ShutdownTimeout: 5 * time.Second,
+				PIIIPRedaction:  "mask",
+			},
+			expectError: true,
+		},
+		{
+			name: "negative PII user agent max length",
+			config: ObservabilityConfig{
+				LogLevel:              "info",
+				ShutdownTimeout:       5 * time.Second,
+				PIIUserAgentMaxLength: -1,
+			},
+			expectError: true,
+		},
+		{
+			name: "text log format",
+			config: ObservabilityConfig{
+				LogLevel:        "info",
+				LogFormat:       "text",
+				ShutdownTimeout: 5 * time.Second,
+			},
+			expectError: false,
+		},
+		{
+			name: "invalid log format",
+			config: ObservabilityConfig{
+				LogLevel:        "info",
+				LogFormat:       "logfmt",
+				ShutdownTimeout: 5 * time.Second,
+			},
+			expectError: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateObservabilityConfig(tt.config)
+			if tt.expectError && err == nil {
+				t.Error("expected error but got none")
+			}
+			if !tt.expectError && err != nil {
+				t.Errorf("unexpected error: %v", err)
+			}
+		})
+	}
+}
+
+func TestGetStringMap(t *testing.T) {
+	tests := []struct {
+		name     string
+		envValue string
+		expected map[string]string
+	}{
+		{
+			name:     "single pair",
+			envValue: "svc-b=/etc/certs/b.pem",
+			expected: map[string]string{"svc-b": "/etc/certs/b.pem"},
+		},
+		{
+			name:     "multiple pairs with spaces",
+			envValue: " svc-b = /b.pem , svc-c=/c.pem",
+			expected: map[string]string{"svc-b": "/b.pem", "svc-c": "/c.pem"},
+		},
+		{
+			name:     "malformed entries are skipped",
+			envValue: "svc-b,=/x.pem,svc-c=,svc-d=/d.pem",
+			expected: map[string]string{"svc-d": "/d.pem"},
+		},
+		{
+			name:     "empty value",
+			envValue: "",
+			expected: map[string]string{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("TEST_STRING_MAP", tt.envValue)
+
+			result := getStringMap("TEST_STRING_MAP")
+			if len(result) != len(tt.expected) {
+				t.Fatalf("Expected %v, got %v", tt.expected, result)
+			}
+			for k, v := range tt.expected {
+				if result[k] != v {
+					t.Errorf("Expected %s=%s, got %s", k, v, result[k])
+				}
+			}
+		})
+	}
+}
+
+func TestLoadOutboundClients(t *testing.T) {
+	os.Setenv("OUTBOUND_FANOUT_TIMEOUT", "3s")
+	os.Setenv("OUTBOUND_FANOUT_MAX_ATTEMPTS", "2")
+	os.Setenv("OUTBOUND_FANOUT_HEDGE_DELAY", "50ms")
+	defer os.Unsetenv("OUTBOUND_FANOUT_TIMEOUT")
+	defer os.Unsetenv("OUTBOUND_FANOUT_MAX_ATTEMPTS")
+	defer os.Unsetenv("OUTBOUND_FANOUT_HEDGE_DELAY")
+
+	clients := loadOutboundClients()
+	if len(clients) != len(OutboundClientNames) {
+		t.Fatalf("Expected %d clients, got %d", len(OutboundClientNames), len(clients))
+	}
+	if clients["fanout"].Timeout != 3*time.Second || clients["fanout"].MaxAttempts != 2 || clients["fanout"].HedgeDelay != 50*time.Millisecond {
+		t.Errorf("Expected fanout client 3s/2 attempts hedged after 50ms, got %+v", clients["fanout"])
+	}
+	if clients["probes"].Timeout != 10*time.Second || clients["probes"].MaxAttempts != 1 || clients["probes"].HedgeDelay != 0 {
+		t.Errorf("Expected default probes client 10s/1 attempt without hedging, got %+v", clients["probes"])
+	}
+}
+
+func TestGetStringSlice(t *testing.T) {
+	t.Setenv("TEST_STRING_SLICE", " a.example.com, ,*.svc.cluster.local,")
+
+	result := getStringSlice("TEST_STRING_SLICE")
+	if len(result) != 2 || result[0] != "a.example.com" || result[1] != "*.svc.cluster.local" {
+		t.Errorf("Expected [a.example.com *.svc.cluster.local], got %v", result)
+	}
+
+	t.Setenv("TEST_STRING_SLICE", "")
+	if result := getStringSlice("TEST_STRING_SLICE"); len(result) != 0 {
+		t.Errorf("Expected empty slice, got %v", result)
+	}
+}
+
+func TestGetIntSliceWithDefault(t *testing.T) {
+	t.Setenv("TEST_INT_SLICE", "500, 503,")
+	if result := getIntSliceWithDefault("TEST_INT_SLICE", []int{502}); !slices.Equal(result, []int{500, 503}) {
+		t.Errorf("Expected [500 503], got %v", result)
+	}
+
+	t.Setenv("TEST_INT_SLICE", "500,oops")
+	if result := getIntSliceWithDefault("TEST_INT_SLICE", []int{502}); !slices.Equal(result, []int{502}) {
+		t.Errorf("Expected the default for an invalid list, got %v", result)
+	}
+}
+
+func TestValidateOutboundConfig(t *testing.T) {
+	tests := []struct {
+		name        string
+		config      OutboundConfig
+		expectError bool
+	}{
+		{
+			name:        "empty config is valid",
+			config:      OutboundConfig{},
+			expectError: false,
+		},
+		{
+			name: "cert and key together",
+			config: OutboundConfig{
+				TLSCertFile: "/etc/certs/tls.crt",
+				TLSKeyFile:  "/etc/certs/tls.key",
+			},
+			expectError: false,
+		},
+		{
+			name: "cert without key",
+			config: OutboundConfig{
+				TLSCertFile: "/etc/certs/tls.crt",
+			},
+			expectError: true,
+		},
+		{
+			name: "key without cert",
+			config: OutboundConfig{
+				TLSKeyFile: "/etc/certs/tls.key",
+			},
+			expectError: true,
+		},
+		{
+			name: "valid override allowlist",
+			config: OutboundConfig{
+				OverrideAllowlist: []string{"api.example.com", "*.svc.cluster.local"},
+			},
+			expectError: false,
+		},
+		{
+			name: "URL in override allowlist",
+			config: OutboundConfig{
+				OverrideAllowlist: []string{"https://api.example.com/"},
+			},
+			expectError: true,
+		},
+		{
+			name: "valid client settings",
+			config: OutboundConfig{
+				MaxIdleConnsPerHost: 10,
+				IdleConnTimeout:     90 * time.Second,
+				Clients: map[string]OutboundClientConfig{
+					"fanout": {Timeout: 5 * time.Second, MaxAttempts: 3},
+				},
+			},
+			expectError: false,
+		},
+		{
+			name: "negative max idle connections",
+			config: OutboundConfig{
+				MaxIdleConnsPerHost: -1,
+			},
+			expectError: true,
+		},
+		{
+			name: "client without timeout",
+			config: OutboundConfig{
+				Clients: map[string]OutboundClientConfig{
+					"probes": {MaxAttempts: 1},
+				},
+			},
+			expectError: true,
+		},
+		{
+			name: "client with too many attempts",
+			config: OutboundConfig{
+				Clients: map[string]OutboundClientConfig{
+					"egress": {Timeout: time.Second, MaxAttempts: 11},
+				},
+			},
+			expectError: true,
+		},
+		{
+			name: "client hedge delay below the timeout",
+			config: OutboundConfig{
+				Clients: map[string]OutboundClientConfig{
+					"fanout": {Timeout: time.Second, MaxAttempts: 2, HedgeDelay: 100 * time.Millisecond},
+				},
+			},
+			expectError: false,
+		},
+		{
+			name: "client hedge delay not below the timeout",
+			config: OutboundConfig{
+				Clients: map[string]OutboundClientConfig{
+					"fanout": {Timeout: time.Second, MaxAttempts: 2, HedgeDelay: time.Second},
+				},
+			},
+			expectError: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateOutboundConfig(tt.config)
+			if tt.expectError && err == nil {
+				t.Error("expected error but got none")
+			}
+			if !tt.expectError && err != nil {
+				t.Errorf("unexpected error: %v", err)
+			}
+		})
+	}
+}
+
+func TestValidateCacheConfig(t *testing.T) {
+	tests := []struct {
+		name        string
+		config      CacheConfig
+		expectError bool
+	}{
+		{
+			name:        "disabled cache is valid",
+			config:      CacheConfig{},
+			expectError: false,
+		},
+		{
+			name: "valid config",
+			config: CacheConfig{
+				Enabled: true,
+				Routes:  []string{"/istio-test/metadata/"},
+				TTL:     30 * time.Second,
+			},
+			expectError: false,
+		},
+		{
+			name: "enabled without routes",
+			config: CacheConfig{
+				Enabled: true,
+				TTL:     30 * time.Second,
+			},
+			expectError: true,
+		},
+		{
+			name: "relative route",
+			config: CacheConfig{
+				Enabled: true,
+				Routes:  []string{"istio-test"},
+				TTL:     30 * time.Second,
+			},
+			expectError: true,
+		},
+		{
+			name: "invalid TTL",
+			config: CacheConfig{
+				Enabled: true,
+				Routes:  []string{"/istio-test/metadata/"},
+			},
+			expectError: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateCacheConfig(tt.config)
+			if tt.expectError && err == nil {
+				t.Error("expected error but got none")
+			}
+			if !tt.expectError && err != nil {
+				t.Errorf("unexpected error: %v", err)
+			}
+		})
+	}
+}
+
+func TestValidateRespondConfig(t *testing.T) {
+	tests := []struct {
+		name        string
+		config      RespondConfig
+		expectError bool
+	}{
+		{
+			name:        "zero delay is valid",
+			config:      RespondConfig{},
+			expectError: false,
+		},
+		{
+			name:        "valid delay",
+			config:      RespondConfig{MaxDelay: 10 * time.Second},
+			expectError: false,
+		},
+		{
+			name:        "negative delay",
+			config:      RespondConfig{MaxDelay: -time.Second},
+			expectError: true,
+		},
+		{
+			name:        "delay too long",
+			config:      RespondConfig{MaxDelay: 10 * time.Minute},
+			expectError: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateRespondConfig(tt.config)
+			if tt.expectError && err == nil {
+				t.Error("expected error but got none")
+			}
+			if !tt.expectError && err != nil {
+				t.Errorf("unexpected error: %v", err)
+			}
+		})
+	}
+}
+
+func TestValidateFaultConfig(t *testing.T) {
+	tests := []struct {
+		name        string
+		config      FaultConfig
+		expectError bool
+	}{
+		{
+			name:        "no zone skew is valid",
+			config:      FaultConfig{},
+			expectError: false,
+		},
+		{
+			name:        "max delay too long",
+			config:      FaultConfig{MaxDelay: 10 * time.Minute},
+			expectError: true,
+		},
+		{
+			name: "valid zone skew",
+			config: FaultConfig{
+				ZoneSkewZones:       []string{"us-east1-b", "europe-west1"},
+				ZoneSkewLatency:     200 * time.Millisecond,
+				ZoneSkewErrorRate:   0.1,
+				ZoneSkewErrorStatus: 503,
+				ZoneSkewRoutes:      []string{"/istio-test/"},
+			},
+			expectError: false,
+		},
+		{
+			name: "error rate above 1",
+			config: FaultConfig{
+				ZoneSkewZones:       []string{"us-east1-b"},
+				ZoneSkewErrorRate:   1.5,
+				ZoneSkewErrorStatus: 503,
+			},
+			expectError: true,
+		},
+		{
+			name: "non-error status",
+			config: FaultConfig{
+				ZoneSkewZones:       []string{"us-east1-b"},
+				ZoneSkewErrorRate:   0.5,
+				ZoneSkewErrorStatus: 200,
+			},
+			expectError: true,
+		},
+		{
+			name: "relative exclude route",
+			config: FaultConfig{
+				ZoneSkewZones:         []string{"us-east1-b"},
+				ZoneSkewLatency:       time.Second,
+				ZoneSkewExcludeRoutes: []string{"health"},
+			},
+			expectError: true,
+		},
+		{
+			name: "valid chaos",
+			config: FaultConfig{
+				MaxDelay:           time.Minute,
+				ChaosEnabled:       true,
+				ChaosErrorRate:     0.05,
+				ChaosErrorStatuses: []int{500, 503},
+				ChaosLatencyRate:   1,
+				ChaosLatencyP50:    20 * time.Millisecond,
+				ChaosLatencyP99:    500 * time.Millisecond,
+				ChaosRoutes:        []string{"/istio-test/"},
+			},
+			expectError: false,
+		},
+		{
+			name: "disabled chaos is not validated",
+			config: FaultConfig{
+				ChaosErrorRate:  2,
+				ChaosLatencyP50: time.Second,
+			},
+			expectError: false,
+		},
+		{
+			name: "chaos error status not 5xx",
+			config: FaultConfig{
+				ChaosEnabled:       true,
+				ChaosErrorRate:     0.1,
+				ChaosErrorStatuses: []int{503, 429},
+			},
+			expectError: true,
+		},
+		{
+			name: "chaos p99 below p50",
+			config: FaultConfig{
+				MaxDelay:        time.Minute,
+				ChaosEnabled:    true,
+				ChaosLatencyP50: time.Second,
+				ChaosLatencyP99: 100 * time.Millisecond,
+			},
+			expectError: true,
+		},
+		{
+			name: "chaos p99 above max delay",
+			config: FaultConfig{
+				MaxDelay:        time.Second,
+				ChaosEnabled:    true,
+				ChaosLatencyP50: 100 * time.Millisecond,
+				ChaosLatencyP99: 2 * time.Second,
+			},
+			expectError: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateFaultConfig(tt.config)
+			if tt.expectError && err == nil {
+				t.Error("expected error but got none")
+			}
+			if !tt.expectError && err != nil {
+				t.Errorf("unexpected error: %v", err)
+			}
+		})
+	}
+}
+
+func TestValidateStoreConfig(t *testing.T) {
+	tests := []struct {
+		name        string
+		config      StoreConfig
+		expectError bool
+	}{
+		{
+			name:        "memory store is valid",
+			config:      StoreConfig{},
+			expectError: false,
+		},
+		{
+			name:        "valid redis config",
+			config:      StoreConfig{RedisAddr: "redis:6379", HealthInterval: 10 * time.Second},
+			expectError: false,
+		},
+		{
+			name:        "redis address without port",
+			config:      StoreConfig{RedisAddr: "redis", HealthInterval: 10 * time.Second},
+			expectError: true,
+		},
+		{
+			name:        "negative redis database",
+			config:      StoreConfig{RedisAddr: "redis:6379", RedisDB: -1, HealthInterval: 10 * time.Second},
+			expectError: true,
+		},
+		{
+			name:        "missing health interval",
+			config:      StoreConfig{RedisAddr: "redis:6379"},
+			expectError: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateStoreConfig(tt.config)
+			if tt.expectError && err == nil {
+				t.Error("expected error but got none")
+			}
+			if !tt.expectError && err != nil {
+				t.Errorf("unexpected error: %v", err)
+			}
+		})
+	}
+}
+
+func TestValidateDBPingConfig(t *testing.T) {
+	tests := []struct {
+		name        string
+		config      DBPingConfig
+		expectError bool
+	}{
+		{
+			name:        "disabled check is valid",
+			config:      DBPingConfig{},
+			expectError: false,
+		},
+		{
+			name:        "valid postgres config",
+			config:      DBPingConfig{Driver: "postgres", DSNFile: "/secrets/dsn", Timeout: 3 * time.Second},
+			expectError: false,
+		},
+		{
+			name:        "unknown driver",
+			config:      DBPingConfig{Driver: "oracle", DSNFile: "/secrets/dsn", Timeout: 3 * time.Second},
+			expectError: true,
+		},
+		{
+			name:        "missing DSN file",
+			config:      DBPingConfig{Driver: "mysql", Timeout: 3 * time.Second},
+			expectError: true,
+		},
+		{
+			name:        "missing timeout",
+			config:      DBPingConfig{Driver: "mysql", DSNFile: "/secrets/dsn"},
+			expectError: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateDBPingConfig(tt.config)
+			if tt.expectError && err == nil {
+				t.Error("expected error but got none")
+			}
+			if !tt.expectError && err != nil {
+				t.Errorf("unexpected error: %v", err)
+			}
+		})
+	}
+}
+
+func TestValidateCatalogConfig(t *testing.T) {
+	tests := []struct {
+		name        string
+		config      CatalogConfig
+		expectError bool
+	}{
+		{
+			name:        "disabled registration is valid",
+			config:      CatalogConfig{},
+			expectError: false,
+		},
+		{
+			name:        "valid URL",
+			config:      CatalogConfig{URL: "https://catalog.example.com/instances"},
+			expectError: false,
+		},
+		{
+			name:        "relative URL",
+			config:      CatalogConfig{URL: "/instances"},
+			expectError: true,
+		},
+		{
+			name:        "unsupported scheme",
+			config:      CatalogConfig{URL: "ftp://catalog.example.com"},
+			expectError: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateCatalogConfig(tt.config)
+			if tt.expectError && err == nil {
+				t.Error("expected error but got none")
+			}
+			if !tt.expectError && err != nil {
+				t.Errorf("unexpected error: %v", err)
+			}
+		})
+	}
+}
+
+func TestValidateHeartbeatConfig(t *testing.T) {
+	tests := []struct {
+		name        string
+		config      HeartbeatConfig
+		expectError bool
+	}{
+		{
+			name:        "disabled heartbeat is valid",
+			config:      HeartbeatConfig{},
+			expectError: false,
+		},
+		{
+			name:        "valid targets",
+			config:      HeartbeatConfig{Targets: []string{"http://istio-test.istio-test:8080/istio-test/echo"}, Interval: time.Second},
+			expectError: false,
+		},
+		{
+			name:        "relative target",
+			config:      HeartbeatConfig{Targets: []string{"/istio-test/echo"}, Interval: time.Second},
+			expectError: true,
+		},
+		{
+			name:        "interval too short",
+			config:      HeartbeatConfig{Targets: []string{"http://localhost:8080/"}, Interval: time.Millisecond},
+			expectError: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateHeartbeatConfig(tt.config)
+			if tt.expectError && err == nil {
+				t.Error("expected error but got none")
+			}
+			if !tt.expectError && err != nil {
+				t.Errorf("unexpected error: %v", err)
+			}
+		})
+	}
+}
+
+func TestValidatePprofConfig(t *testing.T) {
+	tests := []struct {
+		name        string
+		config      PprofConfig
+		adminAuth   AdminAuthConfig
+		expectError bool
+	}{
+		{
+			name:        "disabled pprof is valid",
+			config:      PprofConfig{},
+			expectError: false,
+		},
+		{
+			name:        "enabled with random secret",
+			config:      PprofConfig{Enabled: true, MaxTokenTTL: time.Hour},
+			adminAuth:   AdminAuthConfig{Token: "admin-token"},
+			expectError: false,
+		},
+		{
+			name:        "enabled with configured secret",
+			config:      PprofConfig{Enabled: true, TokenSecret: strings.Repeat("s", 32), MaxTokenTTL: time.Hour},
+			adminAuth:   AdminAuthConfig{Token: "admin-token"},
+			expectError: false,
+		},
+		{
+			name:        "enabled without an admin token",
+			config:      PprofConfig{Enabled: true, MaxTokenTTL: time.Hour},
+			expectError: true,
+		},
+		{
+			name:        "enabled with an admin token file",
+			config:      PprofConfig{Enabled: true, MaxTokenTTL: time.Hour},
+			adminAuth:   AdminAuthConfig{TokenFile: "/var/run/secrets/admin/token"},
+			expectError: false,
+		},
+		{
+			name:        "short secret",
+			config:      PprofConfig{Enabled: true, TokenSecret: "secret", MaxTokenTTL: time.Hour},
+			adminAuth:   AdminAuthConfig{Token: "admin-token"},
+			expectError: true,
+		},
+		{
+			name:        "zero max token TTL",
+			config:      PprofConfig{Enabled: true},
+			adminAuth:   AdminAuthConfig{Token: "admin-token"},
+			expectError: true,
+		},
+		{
+			name:        "max token TTL too long",
+			config:      PprofConfig{Enabled: true, MaxTokenTTL: 48 * time.Hour},
+			adminAuth:   AdminAuthConfig{Token: "admin-token"},
+			expectError: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validatePprofConfig(tt.config, tt.adminAuth)
+			if tt.expectError && err == nil {
+				t.Error("expected error but got none")
+			}
+			if !tt.expectError && err != nil {
+				t.Errorf("unexpected error: %v", err)
+			}
+		})
+	}
+}
+
+func TestValidateProxyConfig(t *testing.T) {
+	tests := []struct {
+		name        string
+		config      ProxyConfig
+		expectError bool
+	}{
+		{
+			name:        "disabled proxy is valid",
+			config:      ProxyConfig{},
+			expectError: false,
+		},
+		{
+			name:        "hosts and wildcards",
+			config:      ProxyConfig{Allowlist: []string{"istio-test.istio-test", "*.svc.cluster.local"}},
+			expectError: false,
+		},
+		{
+			name:        "URL instead of host",
+			config:      ProxyConfig{Allowlist: []string{"http://istio-test.istio-test/"}},
+			expectError: true,
+		},
+		{
+			name:        "mirror",
+			config:      ProxyConfig{Allowlist: []string{"*.svc.cluster.local"}, MirrorTarget: "http://istio-test-shadow.istio-test:8080", MirrorSampleRate: 0.1},
+			expectError: false,
+		},
+		{
+			name:        "mirror target without scheme",
+			config:      ProxyConfig{MirrorTarget: "istio-test-shadow.istio-test:8080", MirrorSampleRate: 1},
+			expectError: true,
+		},
+		{
+			name:        "mirror sample rate above 1",
+			config:      ProxyConfig{MirrorTarget: "http://istio-test-shadow.istio-test", MirrorSampleRate: 1.5},
+			expectError: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateProxyConfig(tt.config)
+			if tt.expectError && err == nil {
+				t.Error("expected error but got none")
+			}
+			if !tt.expectError && err != nil {
+				t.Errorf("unexpected error: %v", err)
+			}
+		})
+	}
+}
+
+func TestValidateRateLimitConfig(t *testing.T) {
+	tests := []struct {
+		name        string
+		config      RateLimitConfig
+		expectError bool
+	}{
+		{
+			name:        "disabled rate limit is valid",
+			config:      RateLimitConfig{},
+			expectError: false,
+		},
+		{
+			name:        "valid limit",
+			config:      RateLimitConfig{RPS: 100, Burst: 200, PerClientIP: true, ExcludeRoutes: []string{"/metrics"}},
+			expectError: false,
+		},
+		{
+			name:        "negative RPS",
+			config:      RateLimitConfig{RPS: -1},
+			expectError: true,
+		},
+		{
+			name:        "negative burst",
+			config:      RateLimitConfig{RPS: 10, Burst: -1},
+			expectError: true,
+		},
+		{
+			name:        "relative exclude route",
+			config:      RateLimitConfig{RPS: 10, ExcludeRoutes: []string{"metrics"}},
+			expectError: true,
+		},
+		{
+			name:        "too many trusted hops",
+			config:      RateLimitConfig{RPS: 10, TrustedHops: 11},
+			expectError: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateRateLimitConfig(tt.config)
+			if tt.expectError && err == nil {
+				t.Error("expected error but got none")
+			}
+			if !tt.expectError && err != nil {
+				t.Errorf("unexpected error: %v", err)
+			}
+		})
+	}
+}
+
+func TestValidateConcurrencyLimitConfig(t *testing.T) {
+	tests := []struct {
+		name        string
+		config      ConcurrencyLimitConfig
+		expectError bool
+	}{
+		{
+			name:        "disabled concurrency limit is valid",
+			config:      ConcurrencyLimitConfig{},
+			expectError: false,
+		},
+		{
+			name:        "valid fixed limit",
+			config:      ConcurrencyLimitConfig{Mode: "fixed", Limit: 50},
+			expectError: false,
+		},
+		{
+			name:        "valid gradient limits",
+			config:      ConcurrencyLimitConfig{Mode: "gradient", Limit: 100, MinLimit: 10, MaxLimit: 1000, ExcludeRoutes: []string{"/metrics"}},
+			expectError: false,
+		},
+		{
+			name:        "unknown mode",
+			config:      ConcurrencyLimitConfig{Mode: "vegas", Limit: 100},
+			expectError: true,
+		},
+		{
+			name:        "zero fixed limit",
+			config:      ConcurrencyLimitConfig{Mode: "fixed"},
+			expectError: true,
+		},
+		{
+			name:        "initial limit above max",
+			config:      ConcurrencyLimitConfig{Mode: "gradient", Limit: 2000, MinLimit: 10, MaxLimit: 1000},
+			expectError: true,
+		},
+		{
+			name:        "relative exclude route",
+			config:      ConcurrencyLimitConfig{Mode: "fixed", Limit: 10, ExcludeRoutes: []string{"metrics"}},
+			expectError: true,
+		},
+		{
+			name:        "valid queue",
+			config:      ConcurrencyLimitConfig{Mode: "fixed", Limit: 10, QueueSize: 20, QueueTimeout: 100 * time.Millisecond, RetryAfter: time.Second},
+			expectError: false,
+		},
+		{
+			name:        "negative queue size",
+			config:      ConcurrencyLimitConfig{Mode: "fixed", Limit: 10, QueueSize: -1},
+			expectError: true,
+		},
+		{
+			name:        "queue without timeout",
+			config:      ConcurrencyLimitConfig{Mode: "fixed", Limit: 10, QueueSize: 20},
+			expectError: true,
+		},
+		{
+			name:        "negative retry after",
+			config:      ConcurrencyLimitConfig{Mode: "fixed", Limit: 10, RetryAfter: -time.Second},
+			expectError: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateConcurrencyLimitConfig(tt.config)
+			if tt.expectError && err == nil {
+				t.Error("expected error but got none")
+			}
+			if !tt.expectError && err != nil {
+				t.Errorf("unexpected error: %v", err)
+			}
+		})
+	}
+}
+
+func TestValidateJWTConfig(t *testing.T) {
+	valid := JWTConfig{
+		Mode:          "enforce",
+		JWKSURL:       "https://issuer.example.com/.well-known/jwks.json",
+		Issuer:        "https://issuer.example.com",
+		Audiences:     []string{"istio-test"},
+		JWKSRefresh:   20 * time.Minute,
+		ExcludeRoutes: []string{"/metrics"},
+	}
+
+	tests := []struct {
+		name        string
+		modify      func(*JWTConfig)
+		expectError bool
+	}{
+		{name: "valid enforce mode", modify: func(jc *JWTConfig) {}},
+		{name: "valid observe mode", modify: func(jc *JWTConfig) { jc.Mode = "observe" }},
+		{name: "disabled ignores other fields", modify: func(jc *JWTConfig) { *jc = JWTConfig{JWKSURL: "not a url"} }},
+		{name: "unknown mode", modify: func(jc *JWTConfig) { jc.Mode = "audit" }, expectError: true},
+		{name: "missing JWKS URL", modify: func(jc *JWTConfig) { jc.JWKSURL = "" }, expectError: true},
+		{name: "relative JWKS URL", modify: func(jc *JWTConfig) { jc.JWKSURL = "/jwks.json" }, expectError: true},
+		{name: "missing issuer", modify: func(jc *JWTConfig) { jc.Issuer = "" }, expectError: true},
+		{name: "refresh too short", modify: func(jc *JWTConfig) { jc.JWKSRefresh = time.Second }, expectError: true},
+		{name: "relative exclude route", modify: func(jc *JWTConfig) { jc.ExcludeRoutes = []string{"metrics"} }, expectError: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := valid
+			tt.modify(&config)
+			err := validateJWTConfig(config)
+			if tt.expectError && err == nil {
+				t.Error("expected error but got none")
+			}
+			if !tt.expectError && err != nil {
+				t.Errorf("unexpected error: %v", err)
+			}
+		})
+	}
+}
+
+func TestValidateWatchdogConfig(t *testing.T) {
+	valid := WatchdogConfig{
+		Enabled:             true,
+		Interval:            5 * time.Second,
+		MemoryWarningRatio:  0.8,
+		MemoryCriticalRatio: 0.9,
+		GoroutineWarning:    10000,
+		GoroutineCritical:   50000,
+	}
+
+	tests := []struct {
+		name        string
+		modify      func(*WatchdogConfig)
+		expectError bool
+	}{
+		{
+			name:        "valid config",
+			modify:      func(*WatchdogConfig) {},
+			expectError: false,
+		},
+		{
+			name:        "disabled watchdog is valid",
+			modify:      func(wc *WatchdogConfig) { *wc = WatchdogConfig{} },
+			expectError: false,
+		},
+		{
+			name:        "interval too short",
+			modify:      func(wc *WatchdogConfig) { wc.Interval = time.Millisecond },
+			expectError: true,
+		},
+		{
+			name:        "warning ratio above critical ratio",
+			modify:      func(wc *WatchdogConfig) { wc.MemoryWarningRatio = 0.95 },
+			expectError: true,
+		},
+		{
+			name:        "critical ratio above one",
+			modify:      func(wc *WatchdogConfig) { wc.MemoryCriticalRatio = 1.5 },
+			expectError: true,
+		},
+		{
+			name:        "goroutine critical below warning",
+			modify:      func(wc *WatchdogConfig) { wc.GoroutineCritical = 100 },
+			expectError: true,
+		},
+		{
+			name:        "negative heap growth warning",
+			modify:      func(wc *WatchdogConfig) { wc.HeapGrowthWarning = -1 },
+			expectError: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := valid
+			tt.modify(&config)
+			err := validateWatchdogConfig(config)
+			if tt.expectError && err == nil {
+				t.Error("expected error but got none")
+			}
+			if !tt.expectError && err != nil {
+				t.Errorf("unexpected error: %v", err)
+			}
+		})
+	}
+}
+
+func TestValidateIstioConfig(t *testing.T) {
+	tests := []struct {
+		name        string
+		config      IstioConfig
+		expectError bool
+	}{
+		{
+			name:        "empty admin URL is valid",
+			config:      IstioConfig{PodInfoDir: "/etc/podinfo"},
+			expectError: false,
+		},
+		{
+			name:        "valid admin URL",
+			config:      IstioConfig{EnvoyAdminURL: "http://localhost:15000"},
+			expectError: false,
+		},
+		{
+			name:        "admin URL without scheme",
+			config:      IstioConfig{EnvoyAdminURL: "localhost:15000"},
+			expectError: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateIstioConfig(tt.config)
+			if tt.expectError && err == nil {
+				t.Error("expected error but got none")
+			}
+			if !tt.expectError && err != nil {
+				t.Errorf("unexpected error: %v", err)
+			}
+		})
+	}
+}
+
+func TestValidateHealthConfig(t *testing.T) {
+	tests := []struct {
+		name        string
+		config      HealthConfig
+		expectError bool
+	}{
+		{
+			name:        "valid config",
+			config:      HealthConfig{CheckInterval: 10 * time.Second, StaleAfter: 30 * time.Second},
+			expectError: false,
+		},
+		{
+			name:        "zero values use checker defaults",
+			config:      HealthConfig{},
+			expectError: false,
+		},
+		{
+			name:        "valid unhealthy after",
+			config:      HealthConfig{CheckInterval: 10 * time.Second, StaleAfter: 30 * time.Second, UnhealthyAfter: time.Minute},
+			expectError: false,
+		},
+		{
+			name:        "interval too short",
+			config:      HealthConfig{CheckInterval: time.Millisecond, StaleAfter: 30 * time.Second},
+			expectError: true,
+		},
+		{
+			name:        "stale before the next check",
+			config:      HealthConfig{CheckInterval: 10 * time.Second, StaleAfter: 5 * time.Second},
+			expectError: true,
+		},
+		{
+			name:        "unhealthy before stale",
+			config:      HealthConfig{CheckInterval: 10 * time.Second, StaleAfter: 30 * time.Second, UnhealthyAfter: 20 * time.Second},
+			expectError: true,
+		},
+		{
+			name:        "webhook",
+			config:      HealthConfig{CheckInterval: 10 * time.Second, StaleAfter: 30 * time.Second, WebhookURL: "https://hooks.slack.com/services/T000/B000/XXXX"},
+			expectError: false,
+		},
+		{
+			name:        "webhook without scheme",
+			config:      HealthConfig{CheckInterval: 10 * time.Second, StaleAfter: 30 * time.Second, WebhookURL: "hooks.slack.com/services/T000"},
+			expectError: true,
+		},
+		{
+			name: "check timeouts",
+			config: HealthConfig{CheckInterval: 10 * time.Second, StaleAfter: 30 * time.Second,
+				CheckTimeouts: map[string]time.Duration{"metadata_service": 5 * time.Second}, MetadataSlowThreshold: 2 * time.Second},
+			expectError: false,
+		},
+		{
+			name:        "check timeout too long",
+			config:      HealthConfig{CheckInterval: 10 * time.Second, StaleAfter: 30 * time.Second, CheckTimeouts: map[string]time.Duration{"dbping": 2 * time.Minute}},
+			expectError: true,
+		},
+		{
+			name: "slow threshold above metadata timeout",
+			config: HealthConfig{CheckInterval: 10 * time.Second, StaleAfter: 30 * time.Second,
+				CheckTimeouts: map[string]time.Duration{"metadata_service": time.Second}, MetadataSlowThreshold: 2 * time.Second},
+			expectError: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateHealthConfig(tt.config)
+			if tt.expectError && err == nil {
+				t.Error("expected error but got none")
+			}
+			if !tt.expectError && err != nil {
+				t.Errorf("unexpected error: %v", err)
+			}
+		})
+	}
+}
+
+func TestRuntimeConfigValidation(t *testing.T) {
+	tests := []struct {
+		name        string
+		config      RuntimeConfig
+		expectError bool
+	}{
+		{
+			name:        "runtime defaults",
+			config:      RuntimeConfig{},
+			expectError: false,
+		},
+		{
+			name:        "valid memory limit and GC percent",
+			config:      RuntimeConfig{MemoryLimit: "384MiB", GCPercent: "50"},
+			expectError: false,
+		},
+		{
+			name:        "GC off",
+			config:      RuntimeConfig{MemoryLimit: "1GiB", GCPercent: "off"},
+			expectError: false,
+		},
+		{
+			name:        "memory limit with unknown unit",
+			config:      RuntimeConfig{MemoryLimit: "512MB"},
+			expectError: true,
+		},
+		{
+			name:        "negative GC percent",
+			config:      RuntimeConfig{GCPercent: "-1"},
+			expectError: true,
+		},
+		{
+			name:        "fixed GOMAXPROCS",
+			config:      RuntimeConfig{MaxProcs: "2"},
+			expectError: false,
+		},
+		{
+			name:        "zero GOMAXPROCS",
+			config:      RuntimeConfig{MaxProcs: "0"},
+			expectError: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateRuntimeConfig(tt.config)
+			if tt.expectError && err == nil {
+				t.Error("expected error but got none")
+			}
+			if !tt.expectError && err != nil {
+				t.Errorf("unexpected error: %v", err)
+			}
+		})
+	}
+}
+
+func TestTenantConfigValidation(t *testing.T) {
+	tests := []struct {
+		name        string
+		config      TenantConfig
+		expectError bool
+	}{
+		{
+			name:        "disabled",
+			config:      TenantConfig{},
+			expectError: false,
+		},
+		{
+			name:        "header rule",
+			config:      TenantConfig{Source: "header", Key: "X-Team"},
+			expectError: false,
+		},
+		{
+			name:        "JWT claim rule",
+			config:      TenantConfig{Source: "jwt", Key: "team"},
+			expectError: false,
+		},
+		{
+			name:        "path rule",
+			config:      TenantConfig{Source: "path", Key: "/tenants/"},
+			expectError: false,
+		},
+		{
+			name:        "rule without key",
+			config:      TenantConfig{Source: "header"},
+			expectError: true,
+		},
+		{
+			name:        "path prefix without trailing slash",
+			config:      TenantConfig{Source: "path", Key: "/tenants"},
+			expectError: true,
+		},
+		{
+			name:        "unknown source",
+			config:      TenantConfig{Source: "cookie", Key: "team"},
+			expectError: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateTenantConfig(tt.config)
+			if tt.expectError && err == nil {
+				t.Error("expected error but got none")
+			}
+			if !tt.expectError && err != nil {
+				t.Errorf("unexpected error: %v", err)
+			}
+		})
+	}
+}
+
+func TestDriftConfigValidation(t *testing.T) {
+	tests := []struct {
+		name        string
+		config      DriftConfig
+		expectError bool
+	}{
+		{
+			name:        "disabled",
+			config:      DriftConfig{},
+			expectError: false,
+		},
+		{
+			name:        "mounted ConfigMap",
+			config:      DriftConfig{Dir: "/etc/istio-test/config", Interval: time.Minute},
+			expectError: false,
+		},
+		{
+			name:        "relative dir",
+			config:      DriftConfig{Dir: "config"},
+			expectError: true,
+		},
+		{
+			name:        "negative interval",
+			config:      DriftConfig{Interval: -time.Second},
+			expectError: true,
+		},
+		{
+			name:        "reload of the mounted ConfigMap",
+			config:      DriftConfig{Dir: "/etc/istio-test/config", Interval: time.Minute, Reload: true},
+			expectError: false,
+		},
+		{
+			name:        "reload without a mounted ConfigMap",
+			config:      DriftConfig{Reload: true},
+			expectError: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateDriftConfig(tt.config)
+			if tt.expectError && err == nil {
+				t.Error("expected error but got none")
+			}
+			if !tt.expectError && err != nil {
+				t.Errorf("unexpected error: %v", err)
+			}
+		})
+	}
+}
+
+func TestCORSConfigValidation(t *testing.T) {
+	tests := []struct {
+		name        string
+		config      CORSConfig
+		expectError bool
+	}{
+		{
+			name:        "disabled",
+			config:      CORSConfig{},
+			expectError: false,
+		},
+		{
+			name: "exact and wildcard subdomain origins",
+			config: CORSConfig{
+				AllowedOrigins:   []string{"https://app.example.com", "https://*.example.org", "http://localhost:3000"},
+				AllowedMethods:   []string{"GET", "POST"},
+				AllowCredentials: true,
+				MaxAge:           time.Minute,
+			},
+			expectError: false,
+		},
+		{
+			name:        "any origin",
+			config:      CORSConfig{AllowedOrigins: []string{"*"}},
+			expectError: false,
+		},
+		{
+			name:        "any origin with credentials",
+			config:      CORSConfig{AllowedOrigins: []string{"*"}, AllowCredentials: true},
+			expectError: true,
+		},
+		{
+			name:        "origin with path",
+			config:      CORSConfig{AllowedOrigins: []string{"https://app.example.com/ui"}},
+			expectError: true,
+		},
+		{
+			name:        "origin without scheme",
+			config:      CORSConfig{AllowedOrigins: []string{"app.example.com"}},
+			expectError: true,
+		},
+		{
+			name:        "wildcard inside host",
+			config:      CORSConfig{AllowedOrigins: []string{"https://app.*.example.com"}},
+			expectError: true,
+		},
+		{
+			name:        "lower case method",
+			config:      CORSConfig{AllowedMethods: []string{"get"}},
+			expectError: true,
+		},
+		{
+			name:        "negative max age",
+			config:      CORSConfig{MaxAge: -time.Second},
+			expectError: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateCORSConfig(tt.config)
+			if tt.expectError && err == nil {
+				t.Error("expected error but got none")
+			}
+			if !tt.expectError && err != nil {
+				t.Errorf("unexpected error: %v", err)
+			}
+		})
+	}
+}
+
+func TestCoordinationConfigValidation(t *testing.T) {
+	tests := []struct {
+		name        string
+		config      CoordinationConfig
+		expectError bool
+	}{
+		{
+			name:        "zero",
+			config:      CoordinationConfig{},
+			expectError: false,
+		},
+		{
+			name:        "default",
+			config:      CoordinationConfig{MaxWait: 5 * time.Minute},
+			expectError: false,
+		},
+		{
+			name:        "negative",
+			config:      CoordinationConfig{MaxWait: -time.Second},
+			expectError: true,
+		},
+		{
+			name:        "above one hour",
+			config:      CoordinationConfig{MaxWait: 2 * time.Hour},
+			expectError: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateCoordinationConfig(tt.config)
+			if tt.expectError && err == nil {
+				t.Error("expected error but got none")
+			}
+			if !tt.expectError && err != nil {
+				t.Errorf("unexpected error: %v", err)
+			}
+		})
+	}
+}
+
+func TestExpiryConfigValidation(t *testing.T) {
+	tests := []struct {
+		name        string
+		config      ExpiryConfig
+		expectError bool
+	}{
+		{
+			name:        "zero",
+			config:      ExpiryConfig{},
+			expectError: false,
+		},
+		{
+			name:        "default",
+			config:      ExpiryConfig{Window: 10 * time.Minute, Interval: time.Minute},
+			expectError: false,
+		},
+		{
+			name:        "with files",
+			config:      ExpiryConfig{CertFiles: []string{"/etc/istio-output-certs/cert-chain.pem"}, TokenFiles: []string{"/var/run/secrets/tokens/token"}, Interval: time.Minute},
+			expectError: false,
+		},
+		{
+			name:        "negative window",
+			config:      ExpiryConfig{Window: -time.Second, Interval: time.Minute},
+			expectError: true,
+		},
+		{
+			name:        "interval below one second",
+			config:      ExpiryConfig{Window: time.Minute, Interval: time.Millisecond},
+			expectError: true,
+		},
+		{
+			name:        "empty token file",
+			config:      ExpiryConfig{TokenFiles: []string{""}, Interval: time.Minute},
+			expectError: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateExpiryConfig(tt.config)
+			if tt.expectError && err == nil {
+				t.Error("expected error but got none")
+			}
+			if !tt.expectError && err != nil {
+				t.Errorf("unexpected error: %v", err)
+			}
+		})
+	}
+}
+
+func TestCompressionConfigValidation(t *testing.T) {
+	tests := []struct {
+		name        string
+		config      CompressionConfig
+		expectError bool
+	}{
+		{
+			name:        "disabled",
+			config:      CompressionConfig{},
+			expectError: false,
+		},
+		{
+			name:        "content types",
+			config:      CompressionConfig{Enabled: true, MinSize: 1024, ContentTypes: []string{"text/", "application/json"}},
+			expectError: false,
+		},
+		{
+			name:        "negative min size",
+			config:      CompressionConfig{Enabled: true, MinSize: -1},
+			expectError: true,
+		},
+		{
+			name:        "content type without slash",
+			config:      CompressionConfig{Enabled: true, ContentTypes: []string{"json"}},
+			expectError: true,
+		},
+		{
+			name:        "content type with parameters",
+			config:      CompressionConfig{Enabled: true, ContentTypes: []string{"text/plain; charset=utf-8"}},
+			expectError: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateCompressionConfig(tt.config)
+			if tt.expectError && err == nil {
+				t.Error("expected error but got none")
+			}
+			if !tt.expectError && err != nil {
+				t.Errorf("unexpected error: %v", err)
+			}
+		})
+	}
+}
+
+func TestArtifactConfigValidation(t *testing.T) {
+	tests := []struct {
+		name        string
+		config      ArtifactConfig
+		expectError bool
+	}{
+		{
+			name:        "disabled",
+			config:      ArtifactConfig{},
+			expectError: false,
+		},
+		{
+			name:        "directory",
+			config:      ArtifactConfig{Dir: "/results", Interval: time.Minute, Keep: 10},
+			expectError: false,
+		},
+		{
+			name:        "bucket",
+			config:      ArtifactConfig{GCSBucket: "istio-test-results", Prefix: "experiment-1", Interval: time.Minute, Keep: 10},
+			expectError: false,
+		},
+		{
+			name:        "directory and bucket",
+			config:      ArtifactConfig{Dir: "/results", GCSBucket: "istio-test-results"},
+			expectError: true,
+		},
+		{
+			name:        "bucket URL",
+			config:      ArtifactConfig{GCSBucket: "gs://istio-test-results"},
+			expectError: true,
+		},
+		{
+			name:        "interval too short",
+			config:      ArtifactConfig{Dir: "/results", Interval: 100 * time.Millisecond},
+			expectError: true,
+		},
+		{
+			name:        "negative keep",
+			config:      ArtifactConfig{Dir: "/results", Keep: -1},
+			expectError: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateArtifactConfig(tt.config)
+			if tt.expectError && err == nil {
+				t.Error("expected error but got none")
+			}
+			if !tt.expectError && err != nil {
+				t.Errorf("unexpected error: %v", err)
+			}
+		})
+	}
+}
+
+func TestGoroutineLeakConfigValidation(t *testing.T) {
+	tests := []struct {
+		name        string
+		config      GoroutineLeakConfig
+		expectError bool
+	}{
+		{
+			name:        "disabled",
+			config:      GoroutineLeakConfig{},
+			expectError: false,
+		},
+		{
+			name:        "enabled",
+			config:      GoroutineLeakConfig{Enabled: true, Interval: 30 * time.Second, Window: 15 * time.Minute, MinGrowth: 10},
+			expectError: false,
+		},
+		{
+			name:        "interval too short",
+			config:      GoroutineLeakConfig{Enabled: true, Interval: 100 * time.Millisecond, Window: time.Minute, MinGrowth: 10},
+			expectError: true,
+		},
+		{
+			name:        "window shorter than two intervals",
+			config:      GoroutineLeakConfig{Enabled: true, Interval: time.Minute, Window: time.Minute, MinGrowth: 10},
+			expectError: true,
+		},
+		{
+			name:        "no growth",
+			config:      GoroutineLeakConfig{Enabled: true, Interval: 30 * time.Second, Window: 15 * time.Minute},
+			expectError: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateGoroutineLeakConfig(tt.config)
+			if tt.expectError && err == nil {
+				t.Error("expected error but got none")
+			}
+			if !tt.expectError && err != nil {
+				t.Errorf("unexpected error: %v", err)
+			}
+		})
+	}
+}
+
+func TestPayloadConfigValidation(t *testing.T) {
+	tests := []struct {
+		name        string
+		config      PayloadConfig
+		expectError bool
+	}{
+		{
+			name:        "disabled",
+			config:      PayloadConfig{},
+			expectError: false,
+		},
+		{
+			name:        "enabled",
+			config:      PayloadConfig{MaxBytes: 100 << 20, MaxDuration: time.Minute},
+			expectError: false,
+		},
+		{
+			name:        "negative max bytes",
+			config:      PayloadConfig{MaxBytes: -1},
+			expectError: true,
+		},
+		{
+			name:        "max duration too long",
+			config:      PayloadConfig{MaxBytes: 1024, MaxDuration: time.Hour},
+			expectError: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validatePayloadConfig(tt.config)
+			if tt.expectError && err == nil {
+				t.Error("expected error but got none")
+			}
+			if !tt.expectError && err != nil {
+				t.Errorf("unexpected error: %v", err)
+			}
+		})
+	}
+}
+
+func TestSSEConfigValidation(t *testing.T) {
+	tests := []struct {
+		name        string
+		config      SSEConfig
+		expectError bool
+	}{
+		{
+			name:        "disabled",
+			config:      SSEConfig{},
+			expectError: false,
+		},
+		{
+			name:        "enabled",
+			config:      SSEConfig{MaxEvents: 10000, MaxDuration: time.Hour},
+			expectError: false,
+		},
+		{
+			name:        "negative max events",
+			config:      SSEConfig{MaxEvents: -1},
+			expectError: true,
+		},
+		{
+			name:        "max duration too long",
+			config:      SSEConfig{MaxEvents: 10, MaxDuration: 3 * time.Hour},
+			expectError: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateSSEConfig(tt.config)
+			if tt.expectError && err == nil {
+				t.Error("expected error but got none")
+			}
+			if !tt.expectError && err != nil {
+				t.Errorf("unexpected error: %v", err)
+			}
+		})
+	}
+}
+
+func TestAdminAuthConfigValidation(t *testing.T) {
+	tests := []struct {
+		name        string
+		config      AdminAuthConfig
+		expectError bool
+	}{
+		{
+			name:        "open",
+			config:      AdminAuthConfig{Routes: []string{"/admin/"}},
+			expectError: false,
+		},
+		{
+			name:        "token",
+			config:      AdminAuthConfig{Token: "s3cret", Routes: []string{"/admin/", "/drain"}},
+			expectError: false,
+		},
+		{
+			name:        "token and token file",
+			config:      AdminAuthConfig{Token: "s3cret", TokenFile: "/var/run/secrets/admin/token"},
+			expectError: true,
+		},
+		{
+			name:        "token with whitespace",
+			config:      AdminAuthConfig{Token: "s3 cret"},
+			expectError: true,
+		},
+		{
+			name:        "relative route",
+			config:      AdminAuthConfig{Token: "s3cret", Routes: []string{"admin/"}},
+			expectError: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateAdminAuthConfig(tt.config)
+			if tt.expectError && err == nil {
+				t.Error("expected error but got none")
+			}
+			if !tt.expectError && err != nil {
+				t.Errorf("unexpected error: %v", err)
+			}
+		})
+	}
+}
+
+func TestLoadWithErrors(t *testing.T) {
+	t.Run("default values", func(t *testing.T) {
+		if _, errs := LoadWithErrors(); len(errs) != 0 {
+			t.Errorf("unexpected errors: %v", errs)
+		}
+	})
+
+	t.Run("reports every invalid value", func(t *testing.T) {
+		t.Setenv("SERVER_READ_TIMEOUT", "5")
+		t.Setenv("REDIS_DB", "-1")
+		t.Setenv("ENABLE_TRACING", "yes")
+		t.Setenv("PORT", "70000")
+
+		conf, errs := LoadWithErrors()
+		if len(errs) != 4 {
+			t.Fatalf("expected 4 errors, got %d: %v", len(errs), errs)
+		}
+		for i, key := range []string{"SERVER_READ_TIMEOUT", "ENABLE_TRACING", "REDIS_DB"} {
+			if !strings.Contains(errs[i].Error(), key) {
+				t.Errorf("expected error %d to name %s, got %v", i, key, errs[i])
+			}
+		}
+		if conf.Server.ReadTimeout != 5*time.Second {
+			t.Errorf("expected invalid value to fall back to the default, got %v", conf.Server.ReadTimeout)
+		}
+	})
+
+	t.Run("explicit zero disables a setting", func(t *testing.T) {
+		for _, key := range []string{
+			"PRE_SHUTDOWN_DELAY",
+			"METADATA_RETRY_JITTER",
+			"METADATA_RETRY_BUDGET",
+			"REQUEST_LOG_SAMPLE_RATE",
+			"TRACING_SAMPLE_RATE",
+			"RATE_LIMIT_RPS",
+			"CHAOS_ERROR_RATE",
+			"CHAOS_LATENCY_RATE",
+			"FAULT_ZONE_SKEW_ERROR_RATE",
+			"FAULT_ZONE_SKEW_LATENCY",
+			"PROXY_MIRROR_SAMPLE_RATE",
+			"SECURITY_HSTS_MAX_AGE",
+			"HEALTH_UNHEALTHY_AFTER",
+			"SLOW_REQUEST_THRESHOLD",
+			"CONCURRENCY_RETRY_AFTER",
+			"CORS_MAX_AGE",
+			"PAYLOAD_MAX_DURATION",
+		} {
+			t.Setenv(key, "0")
+		}
+
+		conf, errs := LoadWithErrors()
+		if len(errs) != 0 {
+			t.Fatalf("unexpected errors: %v", errs)
+		}
+		if err := conf.Validate(); err != nil {
+			t.Fatalf("unexpected validation error: %v", err)
+		}
+		if conf.Server.DrainDelay != 0 || conf.Metadata.RetryJitter != 0 || conf.Observability.RequestLogSampleRate != 0 ||
+			conf.Observability.TracingSampleRate != 0 || conf.RateLimit.RPS != 0 || conf.Fault.ChaosLatencyRate != 0 ||
+			conf.Proxy.MirrorSampleRate != 0 || conf.Security.HSTSMaxAge != 0 || conf.Health.UnhealthyAfter != 0 {
+			t.Errorf("expected explicit zeros to be kept, got %+v", conf)
+		}
+	})
+
+	t.Run("duration maps skip invalid entries", func(t *testing.T) {
+		t.Setenv("HEALTH_CHECK_TIMEOUTS", "metadata_service=5s,dbping=soon")
+
+		conf, errs := LoadWithErrors()
+		if len(errs) != 1 || !strings.Contains(errs[0].Error(), "dbping=soon") {
+			t.Errorf("expected the invalid entry to be reported, got %v", errs)
+		}
+		if len(conf.Health.CheckTimeouts) != 1 || conf.Health.CheckTimeouts["metadata_service"] != 5*time.Second {
+			t.Errorf("expected only the valid timeout, got %v", conf.Health.CheckTimeouts)
+		}
+	})
+
+	t.Run("overrides take precedence over the environment", func(t *testing.T) {
+		t.Setenv("LOG_LEVEL", "info")
+		t.Setenv("RATE_LIMIT_RPS", "10")
+
+		conf, errs := LoadWithOverrides(map[string]string{"LOG_LEVEL": "debug", "SERVER_READ_TIMEOUT": "5"})
+		if len(errs) != 1 || !strings.Contains(errs[0].Error(), "SERVER_READ_TIMEOUT") {
+			t.Errorf("expected the invalid override to be reported, got %v", errs)
+		}
+		if conf.Observability.LogLevel != "debug" {
+			t.Errorf("expected the overridden log level, got %q", conf.Observability.LogLevel)
+		}
+		if conf.RateLimit.RPS != 10 {
+			t.Errorf("expected the environment for keys not overridden, got %v", conf.RateLimit.RPS)
+		}
+		if Load().Observability.LogLevel != "info" {
+			t.Error("expected overrides to apply only to the load they were given to")
+		}
+	})
+
+	t.Run("drain delay can be turned off", func(t *testing.T) {
+		t.Setenv("SERVER_DRAIN_DELAY", "10s")
+		t.Setenv("PRE_SHUTDOWN_DELAY", "0s")
+
+		conf, errs := LoadWithErrors()
+		if len(errs) != 0 {
+			t.Fatalf("unexpected errors: %v", errs)
+		}
+		if conf.Server.DrainDelay != 0 {
+			t.Errorf("expected PRE_SHUTDOWN_DELAY=0s to take precedence, got %v", conf.Server.DrainDelay)
+		}
+		if err := validateServerConfig(conf.Server); err != nil {
+			t.Errorf("unexpected validation error: %v", err)
+		}
+
+		t.Setenv("PRE_SHUTDOWN_DELAY", "")
+		t.Setenv("SERVER_DRAIN_DELAY", "0")
+		if conf, errs = LoadWithErrors(); len(errs) != 0 || conf.Server.DrainDelay != 0 {
+			t.Errorf("expected SERVER_DRAIN_DELAY=0 to disable the delay, got %v with %v", conf.Server.DrainDelay, errs)
+		}
+	})
+
+	t.Run("request log sampling can be turned off on reload", func(t *testing.T) {
+		conf, errs := LoadWithOverrides(map[string]string{"REQUEST_LOG_SAMPLE_RATE": "0"})
+		if len(errs) != 0 {
+			t.Fatalf("unexpected errors: %v", errs)
+		}
+		if conf.Observability.RequestLogSampleRate != 0 {
+			t.Errorf("expected a sample rate of 0, got %v", conf.Observability.RequestLogSampleRate)
+		}
+	})
+
+	t.Run("helpers do not report outside of a load", func(t *testing.T) {
+		t.Setenv("TEST_INVALID_INT", "abc")
+		if got := getInt("TEST_INVALID_INT", 3); got != 3 {
+			t.Errorf("expected default 3, got %d", got)
+		}
+	})
+}
+
+func TestConfigValidateAll(t *testing.T) {
+	config := Load()
+	config.Server.Port = "0"
+	config.Outbound.MaxIdleConnsPerHost = -1
+
+	errs := config.ValidateAll()
+	if len(errs) < 2 {
+		t.Fatalf("expected an error per invalid section, got %v", errs)
+	}
+	if err := config.Validate(); err == nil || err.Error() != errs[0].Error() {
+		t.Errorf("expected Validate to return the first problem %v, got %v", errs[0], err)
+	}
+}
+
+func TestConfigHandler(t *testing.T) {
+	conf := Load()
+	conf.Pprof.TokenSecret = "do-not-leak-this-secret-in-a-dump"
+	conf.Store.RedisPassword = "do-not-leak-this-password"
+
+	w := httptest.NewRecorder()
+	conf.Handler()(w, httptest.NewRequest(http.MethodGet, "/admin/config", nil))
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d", w.Code)
+	}
+	if got := w.Header().Get("Content-Type"); got != "application/json" {
+		t.Errorf("Expected JSON content type, got %s", got)
+	}
+	body := w.Body.String()
+	if strings.Contains(body, "do-not-leak") {
+		t.Errorf("Expected secrets to be left out of the dump, got %s", body)
+	}
+
+	var dumped Config
+	if err := json.Unmarshal(w.Body.Bytes(), &dumped); err != nil {
+		t.Fatalf("Expected the dump to decode as a Config: %v", err)
+	}
+	if dumped.Server.Port != conf.Server.Port {
+		t.Errorf("Expected port %s in the dump, got %s", conf.Server.Port, dumped.Server.Port)
 	}
 }
@@ -0,0 +1,245 @@
+// Package configdrift detects configuration that changed after the process
+// started.
+//
+// Configuration is read from the environment once at startup, so a ConfigMap
+// edited without restarting the pods silently leaves them on the old values.
+// When the ConfigMap is also mounted as a volume, the detector periodically
+// compares its keys with the environment the process was started with and
+// reports every difference. Nothing is applied here; keys applied by a config
+// reload are reported to the detector with Applied and stop counting as drift.
+package configdrift
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"istio-test/internal/observability"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// redacted replaces the values of keys that look like secrets
+const redacted = "[REDACTED]"
+
+// secretMarkers identify keys whose values are never reported
+var secretMarkers = []string{"SECRET", "PASSWORD", "TOKEN", "CREDENTIAL"}
+
+var driftedKeys = prometheus.NewGauge(prometheus.GaugeOpts{
+	Namespace: "istio_test",
+	Name:      "config_drifted_keys",
+	Help:      "Number of configuration keys whose mounted value differs from the value loaded at startup.",
+})
+
+func init() {
+	observability.MetricsRegistry().MustRegister(driftedKeys)
+}
+
+// Drift is a key whose mounted value differs from the loaded one
+type Drift struct {
+	Key     string `json:"key"`
+	Loaded  string `json:"loaded"`  // Value in the environment at startup or last reloaded, empty when unset
+	Current string `json:"current"` // Value currently mounted
+}
+
+// Report is the result of the latest check
+type Report struct {
+	Dir       string     `json:"dir"`
+	CheckedAt *time.Time `json:"checked_at,omitempty"`
+	Drift     []Drift    `json:"drift"`
+	Error     string     `json:"error,omitempty"`
+}
+
+// Detector compares a mounted ConfigMap directory with the environment
+type Detector struct {
+	dir      string
+	interval time.Duration
+	env      func(key string) (string, bool)
+	now      func() time.Time
+
+	mu      sync.RWMutex
+	report  Report
+	applied map[string]string // Values reloaded since startup, by key
+}
+
+// NewDetector creates a detector of drift between the keys mounted in dir and
+// the environment; call Run to start checking
+func NewDetector(dir string, interval time.Duration) *Detector {
+	if interval <= 0 {
+		interval = time.Minute
+	}
+	return &Detector{
+		dir:      dir,
+		interval: interval,
+		env:      os.LookupEnv,
+		now:      time.Now,
+		report:   Report{Dir: dir, Drift: []Drift{}},
+	}
+}
+
+// Run checks immediately and then on every interval until ctx is done
+func (d *Detector) Run(ctx context.Context) {
+	ticker := time.NewTicker(d.interval)
+	defer ticker.Stop()
+
+	for {
+		d.check(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// check compares the mounted keys with the environment and stores the report,
+// logging when the set of drifted keys changes
+func (d *Detector) check(ctx context.Context) {
+	checkedAt := d.now().UTC()
+	report := Report{Dir: d.dir, CheckedAt: &checkedAt, Drift: []Drift{}}
+
+	mounted, err := ReadDir(d.dir)
+	if err != nil {
+		report.Error = err.Error()
+		observability.ErrorWithContext(ctx, fmt.Sprintf("Failed to read mounted configuration: %v", err))
+	}
+	d.mu.RLock()
+	applied := d.applied
+	d.mu.RUnlock()
+	for _, key := range sortedKeys(mounted) {
+		loaded, ok := applied[key]
+		if !ok {
+			loaded, _ = d.env(key)
+		}
+		if mounted[key] == loaded {
+			continue
+		}
+		drift := Drift{Key: key, Loaded: loaded, Current: mounted[key]}
+		if isSecret(key) {
+			drift.Loaded, drift.Current = redacted, redacted
+		}
+		report.Drift = append(report.Drift, drift)
+	}
+
+	d.mu.Lock()
+	previous := d.report
+	d.report = report
+	d.mu.Unlock()
+
+	driftedKeys.Set(float64(len(report.Drift)))
+	if err == nil && !slices.Equal(keys(previous.Drift), keys(report.Drift)) {
+		if len(report.Drift) == 0 {
+			observability.InfoWithContext(ctx, "Mounted configuration matches the loaded configuration")
+			return
+		}
+		observability.WarnWithFields(ctx, fmt.Sprintf("Configuration drifted from the values loaded at startup: %s; restart to apply",
+			strings.Join(keys(report.Drift), ", ")), map[string]any{
+			"type": "config_drift",
+			"keys": keys(report.Drift),
+		})
+	}
+}
+
+// Applied records values reloaded while serving, so that they are compared
+// with the mounted keys instead of the environment of the process
+func (d *Detector) Applied(values map[string]string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	// check reads the map without holding the lock, so it is never modified
+	applied := maps.Clone(d.applied)
+	if applied == nil {
+		applied = make(map[string]string, len(values))
+	}
+	maps.Copy(applied, values)
+	d.applied = applied
+}
+
+// Report returns the result of the latest check
+func (d *Detector) Report() Report {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	return d.report
+}
+
+// Handler serves the latest report
+func (d *Detector) Handler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		jsonData, err := json.Marshal(d.Report())
+		if err != nil {
+			observability.ErrorWithContext(r.Context(), fmt.Sprintf("Error encoding drift report: %v", err))
+			http.Error(w, "Failed to encode drift report", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		_, _ = w.Write(jsonData)
+	}
+}
+
+// ReadDir returns the keys of a mounted ConfigMap: one file per key, named
+// after it. The hidden entries the kubelet uses for atomic updates are skipped.
+func ReadDir(dir string) (map[string]string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	values := make(map[string]string, len(entries))
+	for _, entry := range entries {
+		if strings.HasPrefix(entry.Name(), ".") {
+			continue
+		}
+		path := filepath.Join(dir, entry.Name())
+		// Keys are symlinks into the current data directory
+		info, err := os.Stat(path)
+		if err != nil {
+			return nil, err
+		}
+		if info.IsDir() {
+			continue
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		values[entry.Name()] = strings.TrimSpace(string(data))
+	}
+	return values, nil
+}
+
+// isSecret reports whether the value of key must not be reported
+func isSecret(key string) bool {
+	upper := strings.ToUpper(key)
+	for _, marker := range secretMarkers {
+		if strings.Contains(upper, marker) {
+			return true
+		}
+	}
+	return false
+}
+
+func sortedKeys(values map[string]string) []string {
+	result := make([]string, 0, len(values))
+	for key := range values {
+		result = append(result, key)
+	}
+	slices.Sort(result)
+	return result
+}
+
+func keys(drift []Drift) []string {
+	result := make([]string, len(drift))
+	for i, d := range drift {
+		result[i] = d.Key
+	}
+	return result
+}
@@ -0,0 +1,102 @@
+package configdrift
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newTestDetector returns a detector of dir against env
+func newTestDetector(dir string, env map[string]string) *Detector {
+	d := NewDetector(dir, time.Minute)
+	d.env = func(key string) (string, bool) {
+		value, ok := env[key]
+		return value, ok
+	}
+	return d
+}
+
+func writeKey(t *testing.T, dir, key, value string) {
+	t.Helper()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, key), []byte(value), 0o600))
+}
+
+func TestDetectorCheck(t *testing.T) {
+	dir := t.TempDir()
+	writeKey(t, dir, "LOG_LEVEL", "info\n")
+	writeKey(t, dir, "RATE_LIMIT_RPS", "100")
+	require.NoError(t, os.Mkdir(filepath.Join(dir, "..data"), 0o700))
+
+	d := newTestDetector(dir, map[string]string{"LOG_LEVEL": "info", "RATE_LIMIT_RPS": "100"})
+	d.check(context.Background())
+	report := d.Report()
+	assert.Empty(t, report.Drift)
+	assert.Empty(t, report.Error)
+	require.NotNil(t, report.CheckedAt)
+
+	// The ConfigMap changed but the pod was not restarted
+	writeKey(t, dir, "LOG_LEVEL", "debug")
+	writeKey(t, dir, "TRACING_ENV", "staging")
+	d.check(context.Background())
+	assert.Equal(t, []Drift{
+		{Key: "LOG_LEVEL", Loaded: "info", Current: "debug"},
+		{Key: "TRACING_ENV", Loaded: "", Current: "staging"},
+	}, d.Report().Drift)
+}
+
+func TestDetectorApplied(t *testing.T) {
+	dir := t.TempDir()
+	writeKey(t, dir, "LOG_LEVEL", "debug")
+	writeKey(t, dir, "TRACING_ENV", "staging")
+
+	d := newTestDetector(dir, map[string]string{"LOG_LEVEL": "info", "TRACING_ENV": "prod"})
+	d.Applied(map[string]string{"LOG_LEVEL": "debug"})
+	d.check(context.Background())
+	assert.Equal(t, []Drift{{Key: "TRACING_ENV", Loaded: "prod", Current: "staging"}}, d.Report().Drift,
+		"reloaded keys no longer drift")
+
+	writeKey(t, dir, "LOG_LEVEL", "warn")
+	d.check(context.Background())
+	assert.Equal(t, Drift{Key: "LOG_LEVEL", Loaded: "debug", Current: "warn"}, d.Report().Drift[0])
+}
+
+func TestDetectorRedactsSecrets(t *testing.T) {
+	dir := t.TempDir()
+	writeKey(t, dir, "REDIS_PASSWORD", "new-password")
+
+	d := newTestDetector(dir, map[string]string{"REDIS_PASSWORD": "old-password"})
+	d.check(context.Background())
+	assert.Equal(t, []Drift{{Key: "REDIS_PASSWORD", Loaded: redacted, Current: redacted}}, d.Report().Drift)
+}
+
+func TestDetectorMissingDir(t *testing.T) {
+	d := newTestDetector(filepath.Join(t.TempDir(), "missing"), nil)
+	d.check(context.Background())
+	assert.NotEmpty(t, d.Report().Error)
+	assert.Empty(t, d.Report().Drift)
+}
+
+func TestDetectorHandler(t *testing.T) {
+	dir := t.TempDir()
+	writeKey(t, dir, "LOG_LEVEL", "debug")
+	d := newTestDetector(dir, map[string]string{"LOG_LEVEL": "info"})
+	d.check(context.Background())
+
+	w := httptest.NewRecorder()
+	d.Handler()(w, httptest.NewRequest(http.MethodGet, "/admin/config/drift", nil))
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "application/json", w.Header().Get("Content-Type"))
+
+	var report Report
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &report))
+	assert.Equal(t, dir, report.Dir)
+	assert.Equal(t, []Drift{{Key: "LOG_LEVEL", Loaded: "info", Current: "debug"}}, report.Drift)
+}
@@ -0,0 +1,291 @@
+// Package configreload applies configuration changes without a restart.
+//
+// Restarting a pod perturbs the Istio routing state under observation: its
+// endpoint leaves and rejoins the load balancing pool and every connection
+// to it is re-established. When the ConfigMap is mounted as a volume, the
+// reloader re-reads it on SIGHUP or when its keys change, loads the
+// configuration with the mounted values over the environment and applies the
+// settings registered as safe to change while serving. Other changed keys
+// are reported as requiring a restart. An invalid configuration is rejected
+// as a whole and nothing is applied.
+package configreload
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"net/http"
+	"os"
+	"os/signal"
+	"slices"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"istio-test/internal/config"
+	"istio-test/internal/configdrift"
+	"istio-test/internal/observability"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// What triggered a reload
+const (
+	TriggerSignal  = "signal"  // SIGHUP
+	TriggerChange  = "change"  // The mounted keys changed
+	TriggerRequest = "request" // POST /admin/config/reload
+)
+
+var reloads = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Namespace: "istio_test",
+	Name:      "config_reloads_total",
+	Help:      "Total number of configuration reloads by result: applied, restart_required, unchanged, invalid or error.",
+}, []string{"result"})
+
+func init() {
+	observability.MetricsRegistry().MustRegister(reloads)
+}
+
+// Result describes a reload
+type Result struct {
+	At              time.Time `json:"at"`
+	Trigger         string    `json:"trigger"`
+	Applied         []string  `json:"applied"`          // Changed keys applied while serving
+	RestartRequired []string  `json:"restart_required"` // Changed keys only a restart applies
+	Errors          []string  `json:"errors,omitempty"` // Invalid values, or settings that failed to apply
+}
+
+// setting applies the values of some keys to the running process
+type setting struct {
+	keys  []string
+	apply func(conf *config.Config) error
+}
+
+// Reloader reloads a mounted ConfigMap directory
+type Reloader struct {
+	dir      string
+	interval time.Duration
+	env      func(key string) (string, bool)
+	now      func() time.Time
+
+	mu       sync.Mutex // Serializes reloads and guards the fields below
+	settings []setting
+	onApply  []func(values map[string]string)
+	current  map[string]string // Values applied since startup, by key
+	seen     map[string]string // Keys mounted at the last reload
+
+	resultMu sync.RWMutex
+	result   Result
+}
+
+// New creates a reloader of the keys mounted in dir, checked for changes on
+// every interval once Run is called
+func New(dir string, interval time.Duration) *Reloader {
+	if interval <= 0 {
+		interval = time.Minute
+	}
+	return &Reloader{
+		dir:      dir,
+		interval: interval,
+		env:      os.LookupEnv,
+		now:      time.Now,
+		current:  map[string]string{},
+		result:   Result{Applied: []string{}, RestartRequired: []string{}},
+	}
+}
+
+// Register makes the keys reload-safe: when any of them changes, apply is
+// called with the reloaded configuration. A failing apply leaves its keys
+// requiring a restart.
+func (r *Reloader) Register(apply func(conf *config.Config) error, keys ...string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.settings = append(r.settings, setting{keys: keys, apply: apply})
+}
+
+// OnApply registers fn to be called with the values of the keys applied by
+// each reload, e.g. so that drift detection stops reporting them
+func (r *Reloader) OnApply(fn func(values map[string]string)) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.onApply = append(r.onApply, fn)
+}
+
+// effective returns the value of key the process runs with; callers must hold mu
+func (r *Reloader) effective(key string) string {
+	if value, ok := r.current[key]; ok {
+		return value
+	}
+	value, _ := r.env(key)
+	return value
+}
+
+// Reload reads the mounted keys and applies the reload-safe ones that changed
+func (r *Reloader) Reload(ctx context.Context, trigger string) Result {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	result := Result{At: r.now().UTC(), Trigger: trigger, Applied: []string{}, RestartRequired: []string{}}
+	mounted, err := configdrift.ReadDir(r.dir)
+	if err != nil {
+		result.Errors = []string{err.Error()}
+		observability.ErrorWithContext(ctx, fmt.Sprintf("Failed to read mounted configuration for reload: %v", err))
+		return r.finish("error", result)
+	}
+	r.seen = mounted
+
+	// Keys removed from the ConfigMap return to their environment value
+	targets := make(map[string]string, len(mounted)+len(r.current))
+	for key := range r.current {
+		targets[key], _ = r.env(key)
+	}
+	maps.Copy(targets, mounted)
+	var changed []string
+	for _, key := range slices.Sorted(maps.Keys(targets)) {
+		if targets[key] != r.effective(key) {
+			changed = append(changed, key)
+		}
+	}
+	if len(changed) == 0 {
+		return r.finish("unchanged", result)
+	}
+
+	conf, errs := config.LoadWithOverrides(mounted)
+	if len(errs) > 0 {
+		for _, err := range errs {
+			result.Errors = append(result.Errors, err.Error())
+		}
+		observability.WarnWithFields(ctx, fmt.Sprintf("Reloaded configuration is invalid, keeping the current one: %s",
+			strings.Join(result.Errors, "; ")), map[string]any{
+			"type": "config_reload",
+			"keys": changed,
+		})
+		return r.finish("invalid", result)
+	}
+
+	applied := map[string]string{}
+	for _, s := range r.settings {
+		if !slices.ContainsFunc(s.keys, func(key string) bool { return slices.Contains(changed, key) }) {
+			continue
+		}
+		if err := s.apply(conf); err != nil {
+			result.Errors = append(result.Errors, fmt.Sprintf("%s: %v", strings.Join(s.keys, ", "), err))
+			continue
+		}
+		for _, key := range s.keys {
+			if slices.Contains(changed, key) {
+				applied[key] = targets[key]
+			}
+		}
+	}
+	for _, key := range changed {
+		if _, ok := applied[key]; ok {
+			result.Applied = append(result.Applied, key)
+		} else {
+			result.RestartRequired = append(result.RestartRequired, key)
+		}
+	}
+
+	maps.Copy(r.current, applied)
+	if len(applied) > 0 {
+		for _, fn := range r.onApply {
+			fn(maps.Clone(applied))
+		}
+		observability.InfoWithFields(ctx, fmt.Sprintf("Configuration reloaded on %s: %s", trigger, strings.Join(result.Applied, ", ")), map[string]any{
+			"type": "config_reload",
+			"keys": result.Applied,
+		})
+	}
+	if len(result.RestartRequired) > 0 {
+		fields := map[string]any{"type": "config_reload", "keys": result.RestartRequired}
+		if len(result.Errors) > 0 {
+			fields["errors"] = result.Errors
+		}
+		observability.WarnWithFields(ctx, fmt.Sprintf("Configuration changed but cannot be applied while serving: %s; restart to apply",
+			strings.Join(result.RestartRequired, ", ")), fields)
+	}
+
+	if len(applied) == 0 {
+		return r.finish("restart_required", result)
+	}
+	return r.finish("applied", result)
+}
+
+// finish records the result of a reload
+func (r *Reloader) finish(outcome string, result Result) Result {
+	reloads.WithLabelValues(outcome).Inc()
+	r.resultMu.Lock()
+	r.result = result
+	r.resultMu.Unlock()
+	return result
+}
+
+// changed reports whether the mounted keys differ from the ones last reloaded
+func (r *Reloader) changed() bool {
+	mounted, err := configdrift.ReadDir(r.dir)
+	if err != nil {
+		// The kubelet briefly removes the keys while swapping them; retry next interval
+		return false
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.seen == nil || !maps.Equal(mounted, r.seen)
+}
+
+// Run reloads on SIGHUP and whenever the mounted keys change until ctx is done
+func (r *Reloader) Run(ctx context.Context) {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGHUP)
+	defer signal.Stop(signals)
+
+	ticker := time.NewTicker(r.interval)
+	defer ticker.Stop()
+
+	for {
+		if r.changed() {
+			r.Reload(ctx, TriggerChange)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-signals:
+			r.Reload(ctx, TriggerSignal)
+		case <-ticker.C:
+		}
+	}
+}
+
+// Result returns the result of the latest reload
+func (r *Reloader) Result() Result {
+	r.resultMu.RLock()
+	defer r.resultMu.RUnlock()
+	return r.result
+}
+
+// Handler serves the latest reload on GET and reloads on POST. A rejected
+// reload is answered with 422 Unprocessable Entity.
+func (r *Reloader) Handler() http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		status := http.StatusOK
+		result := r.Result()
+		if req.Method == http.MethodPost {
+			result = r.Reload(req.Context(), TriggerRequest)
+			if len(result.Errors) > 0 && len(result.Applied) == 0 {
+				status = http.StatusUnprocessableEntity
+			}
+		}
+
+		jsonData, err := json.Marshal(result)
+		if err != nil {
+			observability.ErrorWithContext(req.Context(), fmt.Sprintf("Error encoding reload result: %v", err))
+			http.Error(w, "Failed to encode reload result", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		_, _ = w.Write(jsonData)
+	}
+}
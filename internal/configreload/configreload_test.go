@@ -0,0 +1,160 @@
+package configreload
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+
+	"istio-test/internal/config"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func writeKey(t *testing.T, dir, key, value string) {
+	t.Helper()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, key), []byte(value), 0o600))
+}
+
+// newTestReloader returns a reloader of dir applying LOG_LEVEL into level
+func newTestReloader(t *testing.T, dir string) (*Reloader, *string) {
+	t.Setenv("LOG_LEVEL", "info")
+	t.Setenv("RATE_LIMIT_RPS", "10")
+	level := "info"
+	r := New(dir, time.Minute)
+	r.Register(func(conf *config.Config) error {
+		level = conf.Observability.LogLevel
+		return nil
+	}, "LOG_LEVEL")
+	return r, &level
+}
+
+func TestReload(t *testing.T) {
+	dir := t.TempDir()
+	writeKey(t, dir, "LOG_LEVEL", "debug\n")
+	writeKey(t, dir, "RATE_LIMIT_RPS", "10")
+	writeKey(t, dir, "TRACING_ENV", "staging")
+
+	r, level := newTestReloader(t, dir)
+	rateLimitApplied := false
+	r.Register(func(conf *config.Config) error {
+		rateLimitApplied = true
+		return nil
+	}, "RATE_LIMIT_RPS", "RATE_LIMIT_BURST")
+	var reported map[string]string
+	r.OnApply(func(values map[string]string) { reported = values })
+
+	result := r.Reload(context.Background(), TriggerSignal)
+	assert.Equal(t, TriggerSignal, result.Trigger)
+	assert.Equal(t, []string{"LOG_LEVEL"}, result.Applied)
+	assert.Equal(t, []string{"TRACING_ENV"}, result.RestartRequired)
+	assert.Empty(t, result.Errors)
+	assert.Equal(t, "debug", *level)
+	assert.False(t, rateLimitApplied, "settings whose keys did not change are left alone")
+	assert.Equal(t, map[string]string{"LOG_LEVEL": "debug"}, reported)
+	assert.Equal(t, result, r.Result())
+
+	restartRequired := testutil.ToFloat64(reloads.WithLabelValues("restart_required"))
+	writeKey(t, dir, "LOG_LEVEL", "debug")
+	result = r.Reload(context.Background(), TriggerChange)
+	assert.Empty(t, result.Applied, "applied values are no longer changes")
+	assert.Equal(t, []string{"TRACING_ENV"}, result.RestartRequired, "keys not applied still require a restart")
+	assert.Equal(t, restartRequired+1, testutil.ToFloat64(reloads.WithLabelValues("restart_required")))
+
+	// A key removed from the ConfigMap returns to its environment value
+	require.NoError(t, os.Remove(filepath.Join(dir, "LOG_LEVEL")))
+	result = r.Reload(context.Background(), TriggerChange)
+	assert.Equal(t, []string{"LOG_LEVEL"}, result.Applied)
+	assert.Equal(t, "info", *level)
+}
+
+func TestReloadInvalid(t *testing.T) {
+	dir := t.TempDir()
+	writeKey(t, dir, "LOG_LEVEL", "debug")
+	writeKey(t, dir, "SERVER_READ_TIMEOUT", "5")
+
+	r, level := newTestReloader(t, dir)
+	result := r.Reload(context.Background(), TriggerChange)
+	require.Len(t, result.Errors, 1)
+	assert.Contains(t, result.Errors[0], "SERVER_READ_TIMEOUT")
+	assert.Empty(t, result.Applied)
+	assert.Equal(t, "info", *level, "nothing is applied from an invalid configuration")
+
+	// Fixing the value applies the pending change
+	writeKey(t, dir, "SERVER_READ_TIMEOUT", "5s")
+	result = r.Reload(context.Background(), TriggerChange)
+	assert.Equal(t, []string{"LOG_LEVEL"}, result.Applied)
+	assert.Equal(t, []string{"SERVER_READ_TIMEOUT"}, result.RestartRequired)
+}
+
+func TestReloadApplyError(t *testing.T) {
+	dir := t.TempDir()
+	writeKey(t, dir, "RATE_LIMIT_RPS", "20")
+
+	r, _ := newTestReloader(t, dir)
+	r.Register(func(conf *config.Config) error {
+		return errors.New("rate limiting is not enabled")
+	}, "RATE_LIMIT_RPS")
+
+	result := r.Reload(context.Background(), TriggerChange)
+	assert.Empty(t, result.Applied)
+	assert.Equal(t, []string{"RATE_LIMIT_RPS"}, result.RestartRequired)
+	assert.Equal(t, []string{"RATE_LIMIT_RPS: rate limiting is not enabled"}, result.Errors)
+}
+
+func TestReloadMissingDir(t *testing.T) {
+	r, _ := newTestReloader(t, filepath.Join(t.TempDir(), "missing"))
+	result := r.Reload(context.Background(), TriggerSignal)
+	assert.NotEmpty(t, result.Errors)
+	assert.False(t, r.changed())
+}
+
+func TestReloaderRun(t *testing.T) {
+	dir := t.TempDir()
+	writeKey(t, dir, "LOG_LEVEL", "info")
+
+	r, level := newTestReloader(t, dir)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go r.Run(ctx)
+	require.Eventually(t, func() bool { return r.Result().Trigger == TriggerChange }, time.Second, 10*time.Millisecond)
+
+	writeKey(t, dir, "LOG_LEVEL", "warn")
+	require.NoError(t, syscall.Kill(os.Getpid(), syscall.SIGHUP))
+	require.Eventually(t, func() bool { return r.Result().Trigger == TriggerSignal }, time.Second, 10*time.Millisecond)
+	assert.Equal(t, []string{"LOG_LEVEL"}, r.Result().Applied)
+	assert.Equal(t, "warn", *level)
+}
+
+func TestReloaderHandler(t *testing.T) {
+	dir := t.TempDir()
+	writeKey(t, dir, "LOG_LEVEL", "debug")
+	r, _ := newTestReloader(t, dir)
+
+	w := httptest.NewRecorder()
+	r.Handler()(w, httptest.NewRequest(http.MethodPost, "/admin/config/reload", nil))
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "application/json", w.Header().Get("Content-Type"))
+	var result Result
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &result))
+	assert.Equal(t, TriggerRequest, result.Trigger)
+	assert.Equal(t, []string{"LOG_LEVEL"}, result.Applied)
+
+	w = httptest.NewRecorder()
+	r.Handler()(w, httptest.NewRequest(http.MethodGet, "/admin/config/reload", nil))
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `{"at":"`+result.At.Format(time.RFC3339Nano)+`","trigger":"request","applied":["LOG_LEVEL"],"restart_required":[]}`, w.Body.String())
+
+	writeKey(t, dir, "PORT", "70000")
+	w = httptest.NewRecorder()
+	r.Handler()(w, httptest.NewRequest(http.MethodPost, "/admin/config/reload", nil))
+	assert.Equal(t, http.StatusUnprocessableEntity, w.Code)
+}
@@ -0,0 +1,370 @@
+// Package coordination provides named barriers for multi-pod experiments.
+//
+// Load generators and istio-test pods register at a barrier and block until
+// the expected number of participants is waiting, so a coordinated test
+// starts at the same moment everywhere without an external coordination
+// service. A participant only counts while its request is waiting: callers
+// that time out or disconnect are withdrawn, so pods that stopped being
+// ready do not release the barrier for the others.
+package coordination
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"istio-test/internal/observability"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const (
+	// DefaultTimeout is the wait of a request without timeout
+	DefaultTimeout = 30 * time.Second
+
+	maxParticipants = 1000
+	maxBarriers     = 100
+	maxNameLength   = 128
+	maxRequestBytes = 4 << 10
+
+	// writeSlack is added to the wait when extending the write deadline
+	writeSlack = 5 * time.Second
+)
+
+var barrierWaits = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Namespace: "istio_test",
+	Name:      "barrier_waits_total",
+	Help:      "Barrier registrations by outcome: released, timeout, aborted or canceled.",
+}, []string{"result"})
+
+func init() {
+	observability.MetricsRegistry().MustRegister(barrierWaits)
+}
+
+var (
+	// ErrTimeout is returned when the barrier was not released in time
+	ErrTimeout = errors.New("barrier was not released in time")
+	// ErrAborted is returned to waiters of a barrier that was deleted
+	ErrAborted = errors.New("barrier was aborted")
+	// ErrConflict is returned when a registration does not match the barrier
+	ErrConflict = errors.New("registration conflicts with the barrier")
+)
+
+// Request registers a participant at a barrier
+type Request struct {
+	Name         string `json:"name" schema:"required,maxLength=128"`                  // Barrier name, e.g. the test run ID
+	Participants int    `json:"participants" schema:"required,minimum=1,maximum=1000"` // Number of participants to wait for
+	Participant  string `json:"participant" schema:"required,maxLength=128"`           // ID of the caller, e.g. its pod name; registering again is idempotent
+	Timeout      string `json:"timeout,omitempty" schema:"format=duration"`            // How long to wait, e.g. "2m"; defaults to 30s
+}
+
+// Status describes a barrier
+type Status struct {
+	Name         string     `json:"name"`
+	Participants int        `json:"participants"`
+	Waiting      []string   `json:"waiting"`               // Participants waiting, or released together
+	CreatedAt    time.Time  `json:"created_at"`            // First registration
+	ReleasedAt   *time.Time `json:"released_at,omitempty"` // Moment the last participant arrived
+}
+
+// Barriers is returned by the handler on GET
+type Barriers struct {
+	Barriers []Status `json:"barriers"`
+}
+
+// barrier is the state of one named barrier
+type barrier struct {
+	participants int
+	waiting      map[string]int // Participant to its waiting requests
+	createdAt    time.Time
+	releasedAt   time.Time
+	released     chan struct{}
+	aborted      chan struct{}
+	members      []string // Participants released together
+}
+
+func (b *barrier) status(name string) Status {
+	status := Status{Name: name, Participants: b.participants, CreatedAt: b.createdAt}
+	if b.releasedAt.IsZero() {
+		for participant := range b.waiting {
+			status.Waiting = append(status.Waiting, participant)
+		}
+		slices.Sort(status.Waiting)
+	} else {
+		releasedAt := b.releasedAt
+		status.ReleasedAt = &releasedAt
+		status.Waiting = append([]string(nil), b.members...)
+	}
+	if status.Waiting == nil {
+		status.Waiting = []string{}
+	}
+	return status
+}
+
+// Coordinator holds the barriers
+type Coordinator struct {
+	mu        sync.Mutex
+	barriers  map[string]*barrier
+	maxWait   time.Duration
+	retention time.Duration // How long released barriers answer late registrations
+}
+
+// NewCoordinator creates a coordinator whose requests wait at most maxWait
+func NewCoordinator(maxWait time.Duration) *Coordinator {
+	return &Coordinator{
+		barriers:  make(map[string]*barrier),
+		maxWait:   maxWait,
+		retention: maxWait,
+	}
+}
+
+// validate checks a request and returns its wait
+func (c *Coordinator) validate(req Request) (time.Duration, error) {
+	if req.Name == "" || len(req.Name) > maxNameLength {
+		return 0, fmt.Errorf("name must be between 1 and %d characters", maxNameLength)
+	}
+	if req.Participant == "" || len(req.Participant) > maxNameLength {
+		return 0, fmt.Errorf("participant must be between 1 and %d characters", maxNameLength)
+	}
+	if req.Participants < 1 || req.Participants > maxParticipants {
+		return 0, fmt.Errorf("participants must be between 1 and %d", maxParticipants)
+	}
+
+	timeout := DefaultTimeout
+	if req.Timeout != "" {
+		var err error
+		timeout, err = time.ParseDuration(req.Timeout)
+		if err != nil {
+			return 0, fmt.Errorf("invalid timeout: %v", err)
+		}
+	}
+	if timeout <= 0 || timeout > c.maxWait {
+		return 0, fmt.Errorf("timeout must be between 0 and %v", c.maxWait)
+	}
+	return timeout, nil
+}
+
+// expire removes released barriers past their retention; c.mu must be held
+func (c *Coordinator) expire(now time.Time) {
+	for name, b := range c.barriers {
+		if !b.releasedAt.IsZero() && now.Sub(b.releasedAt) > c.retention {
+			delete(c.barriers, name)
+		}
+	}
+}
+
+// register adds the participant to the barrier, releasing it when the last
+// participant arrives. Participants of an already released barrier get it
+// back, so their retries succeed.
+func (c *Coordinator) register(req Request) (*barrier, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := time.Now()
+	c.expire(now)
+
+	b, ok := c.barriers[req.Name]
+	if !ok {
+		if len(c.barriers) >= maxBarriers {
+			return nil, fmt.Errorf("%w: at most %d barriers are allowed", ErrConflict, maxBarriers)
+		}
+		b = &barrier{
+			participants: req.Participants,
+			waiting:      make(map[string]int),
+			createdAt:    now,
+			released:     make(chan struct{}),
+			aborted:      make(chan struct{}),
+		}
+		c.barriers[req.Name] = b
+	}
+	if b.participants != req.Participants {
+		return nil, fmt.Errorf("%w: barrier %s waits for %d participants", ErrConflict, req.Name, b.participants)
+	}
+	if !b.releasedAt.IsZero() {
+		// A participant retrying after the release is let through
+		if slices.Contains(b.members, req.Participant) {
+			return b, nil
+		}
+		return nil, fmt.Errorf("%w: barrier %s was already released", ErrConflict, req.Name)
+	}
+
+	b.waiting[req.Participant]++
+	if len(b.waiting) >= b.participants {
+		b.releasedAt = now
+		for participant := range b.waiting {
+			b.members = append(b.members, participant)
+		}
+		slices.Sort(b.members)
+		close(b.released)
+	}
+	return b, nil
+}
+
+// withdraw removes a waiting request of the participant unless the barrier
+// was released in the meantime, and reports whether it was released
+func (c *Coordinator) withdraw(name string, b *barrier, participant string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if !b.releasedAt.IsZero() {
+		return true
+	}
+	if b.waiting[participant]--; b.waiting[participant] <= 0 {
+		delete(b.waiting, participant)
+	}
+	if len(b.waiting) == 0 && c.barriers[name] == b {
+		delete(c.barriers, name)
+	}
+	return false
+}
+
+// Wait registers the participant and blocks until the barrier is released,
+// the timeout passes, the barrier is aborted or ctx is done
+func (c *Coordinator) Wait(ctx context.Context, req Request) (Status, error) {
+	timeout, err := c.validate(req)
+	if err != nil {
+		return Status{}, err
+	}
+	b, err := c.register(req)
+	if err != nil {
+		return Status{}, err
+	}
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	var result error
+	select {
+	case <-b.released:
+	case <-b.aborted:
+		result = ErrAborted
+	case <-timer.C:
+		result = ErrTimeout
+	case <-ctx.Done():
+		result = ctx.Err()
+	}
+	if result != nil && !errors.Is(result, ErrAborted) && c.withdraw(req.Name, b, req.Participant) {
+		// Released while timing out
+		result = nil
+	}
+
+	switch {
+	case result == nil:
+		barrierWaits.WithLabelValues("released").Inc()
+	case errors.Is(result, ErrAborted):
+		barrierWaits.WithLabelValues("aborted").Inc()
+	case errors.Is(result, ErrTimeout):
+		barrierWaits.WithLabelValues("timeout").Inc()
+	default:
+		barrierWaits.WithLabelValues("canceled").Inc()
+	}
+	if result != nil {
+		return Status{}, result
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return b.status(req.Name), nil
+}
+
+// Abort deletes a barrier, failing its waiting requests
+func (c *Coordinator) Abort(name string) (Status, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	b, ok := c.barriers[name]
+	if !ok {
+		return Status{}, false
+	}
+	delete(c.barriers, name)
+	if b.releasedAt.IsZero() {
+		close(b.aborted)
+	}
+	return b.status(name), true
+}
+
+// Barriers returns the status of every barrier, sorted by name
+func (c *Coordinator) Barriers() []Status {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.expire(time.Now())
+	statuses := make([]Status, 0, len(c.barriers))
+	for name, b := range c.barriers {
+		statuses = append(statuses, b.status(name))
+	}
+	slices.SortFunc(statuses, func(a, b Status) int { return strings.Compare(a.Name, b.Name) })
+	return statuses
+}
+
+// writeJSON writes v as a JSON response with status
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	jsonData, err := json.Marshal(v)
+	if err != nil {
+		http.Error(w, "Failed to encode barrier", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_, _ = w.Write(jsonData)
+}
+
+// Handler lists the barriers on GET, waits at a barrier on POST and aborts
+// the barrier named by the name query parameter on DELETE. A POST answers 200
+// once the barrier is released, 408 when it times out, 409 when the
+// registration conflicts with the barrier and 410 when the barrier is aborted.
+func (c *Coordinator) Handler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodPost:
+			decoder := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxRequestBytes))
+			decoder.DisallowUnknownFields()
+			var req Request
+			if err := decoder.Decode(&req); err != nil {
+				http.Error(w, fmt.Sprintf("Invalid barrier request: %v", err), http.StatusBadRequest)
+				return
+			}
+			timeout, err := c.validate(req)
+			if err != nil {
+				http.Error(w, fmt.Sprintf("Invalid barrier request: %v", err), http.StatusBadRequest)
+				return
+			}
+
+			// The wait may outlast the server write timeout
+			_ = http.NewResponseController(w).SetWriteDeadline(time.Now().Add(timeout + writeSlack))
+
+			status, err := c.Wait(r.Context(), req)
+			switch {
+			case err == nil:
+				writeJSON(w, http.StatusOK, status)
+			case errors.Is(err, ErrTimeout):
+				http.Error(w, fmt.Sprintf("Barrier %s was not released within %s", req.Name, timeout), http.StatusRequestTimeout)
+			case errors.Is(err, ErrAborted):
+				http.Error(w, fmt.Sprintf("Barrier %s was aborted", req.Name), http.StatusGone)
+			case errors.Is(err, ErrConflict):
+				http.Error(w, err.Error(), http.StatusConflict)
+			default:
+				// The caller went away, nobody reads the response
+				observability.InfoWithContext(r.Context(), fmt.Sprintf("Participant %s left barrier %s: %v", req.Participant, req.Name, err))
+			}
+
+		case http.MethodDelete:
+			name := r.URL.Query().Get("name")
+			status, ok := c.Abort(name)
+			if !ok {
+				http.Error(w, fmt.Sprintf("Unknown barrier %q", name), http.StatusNotFound)
+				return
+			}
+			writeJSON(w, http.StatusOK, status)
+
+		default:
+			writeJSON(w, http.StatusOK, Barriers{Barriers: c.Barriers()})
+		}
+	}
+}
@@ -0,0 +1,141 @@
+package coordination
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWaitReleasesAllParticipants(t *testing.T) {
+	c := NewCoordinator(time.Minute)
+
+	var wg sync.WaitGroup
+	statuses := make([]Status, 3)
+	errs := make([]error, 3)
+	for i, participant := range []string{"pod-c", "pod-a", "pod-b"} {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			statuses[i], errs[i] = c.Wait(context.Background(), Request{Name: "run-1", Participants: 3, Participant: participant, Timeout: "5s"})
+		}()
+	}
+	wg.Wait()
+
+	for i := range statuses {
+		require.NoError(t, errs[i])
+		assert.Equal(t, []string{"pod-a", "pod-b", "pod-c"}, statuses[i].Waiting)
+		assert.NotNil(t, statuses[i].ReleasedAt)
+	}
+
+	// A participant retrying after the release is let through, others are not
+	_, err := c.Wait(context.Background(), Request{Name: "run-1", Participants: 3, Participant: "pod-a"})
+	assert.NoError(t, err)
+	_, err = c.Wait(context.Background(), Request{Name: "run-1", Participants: 3, Participant: "pod-d"})
+	assert.ErrorIs(t, err, ErrConflict)
+}
+
+func TestWaitTimeoutWithdrawsParticipant(t *testing.T) {
+	c := NewCoordinator(time.Minute)
+
+	_, err := c.Wait(context.Background(), Request{Name: "run-2", Participants: 2, Participant: "pod-a", Timeout: "20ms"})
+	assert.ErrorIs(t, err, ErrTimeout)
+
+	// The timed out participant no longer counts
+	_, err = c.Wait(context.Background(), Request{Name: "run-2", Participants: 2, Participant: "pod-b", Timeout: "20ms"})
+	assert.ErrorIs(t, err, ErrTimeout)
+	assert.Empty(t, c.Barriers())
+}
+
+func TestWaitCanceled(t *testing.T) {
+	c := NewCoordinator(time.Minute)
+	ctx, cancel := context.WithCancel(context.Background())
+
+	done := make(chan error)
+	go func() {
+		_, err := c.Wait(ctx, Request{Name: "run-3", Participants: 2, Participant: "pod-a"})
+		done <- err
+	}()
+	require.Eventually(t, func() bool { return len(c.Barriers()) == 1 }, time.Second, 5*time.Millisecond)
+	cancel()
+
+	assert.ErrorIs(t, <-done, context.Canceled)
+	assert.Empty(t, c.Barriers())
+}
+
+func TestWaitRejectsConflictsAndInvalidRequests(t *testing.T) {
+	c := NewCoordinator(time.Minute)
+
+	go func() {
+		_, _ = c.Wait(context.Background(), Request{Name: "run-4", Participants: 2, Participant: "pod-a", Timeout: "1s"})
+	}()
+	require.Eventually(t, func() bool { return len(c.Barriers()) == 1 }, time.Second, 5*time.Millisecond)
+
+	_, err := c.Wait(context.Background(), Request{Name: "run-4", Participants: 3, Participant: "pod-b"})
+	assert.ErrorIs(t, err, ErrConflict)
+
+	for _, req := range []Request{
+		{Participants: 2, Participant: "pod-a"},
+		{Name: "run-5", Participant: "pod-a"},
+		{Name: "run-5", Participants: 2},
+		{Name: "run-5", Participants: 2, Participant: "pod-a", Timeout: "2m"},
+		{Name: "run-5", Participants: 2, Participant: "pod-a", Timeout: "soon"},
+	} {
+		_, err := c.Wait(context.Background(), req)
+		assert.Error(t, err)
+		assert.NotErrorIs(t, err, ErrConflict)
+	}
+}
+
+func TestHandler(t *testing.T) {
+	c := NewCoordinator(time.Minute)
+	handler := c.Handler()
+
+	post := func(body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		handler(w, httptest.NewRequest(http.MethodPost, "/admin/coordination/barrier", strings.NewReader(body)))
+		return w
+	}
+
+	// An aborted barrier fails its waiters with 410
+	aborted := make(chan *httptest.ResponseRecorder)
+	go func() {
+		aborted <- post(`{"name":"run-6","participants":2,"participant":"pod-a","timeout":"5s"}`)
+	}()
+	require.Eventually(t, func() bool { return len(c.Barriers()) == 1 }, time.Second, 5*time.Millisecond)
+
+	w := httptest.NewRecorder()
+	handler(w, httptest.NewRequest(http.MethodGet, "/admin/coordination/barrier", nil))
+	var barriers Barriers
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &barriers))
+	require.Len(t, barriers.Barriers, 1)
+	assert.Equal(t, []string{"pod-a"}, barriers.Barriers[0].Waiting)
+
+	w = httptest.NewRecorder()
+	handler(w, httptest.NewRequest(http.MethodDelete, "/admin/coordination/barrier?name=run-6", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, http.StatusGone, (<-aborted).Code)
+
+	w = httptest.NewRecorder()
+	handler(w, httptest.NewRequest(http.MethodDelete, "/admin/coordination/barrier?name=run-6", nil))
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	// A single participant barrier is released at once
+	w = post(`{"name":"run-7","participants":1,"participant":"harness"}`)
+	assert.Equal(t, http.StatusOK, w.Code)
+	var status Status
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &status))
+	assert.Equal(t, []string{"harness"}, status.Waiting)
+
+	assert.Equal(t, http.StatusRequestTimeout, post(`{"name":"run-8","participants":2,"participant":"pod-a","timeout":"10ms"}`).Code)
+	assert.Equal(t, http.StatusConflict, post(`{"name":"run-7","participants":2,"participant":"pod-a"}`).Code)
+	assert.Equal(t, http.StatusBadRequest, post(`{"name":"run-9","participants":0,"participant":"pod-a"}`).Code)
+	assert.Equal(t, http.StatusBadRequest, post(`{"name":"run-9","unknown":true}`).Code)
+}
@@ -0,0 +1,127 @@
+// Package dbping checks connectivity to an external database.
+//
+// The check opens a connection with the configured driver and runs a query, so
+// mesh egress policies (ServiceEntries, egress gateways, Cloud SQL proxies)
+// for databases can be verified by the same canary workload that tests HTTP
+// traffic. The DSN is read from a file, typically a mounted secret, so
+// credentials never appear in the environment.
+package dbping
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"istio-test/internal/observability"
+
+	_ "github.com/go-sql-driver/mysql" // Registers the "mysql" driver
+	_ "github.com/lib/pq"              // Registers the "postgres" driver
+)
+
+// Drivers are the supported database drivers
+var Drivers = []string{"postgres", "mysql"}
+
+// Options configures the database check
+type Options struct {
+	Driver  string        // Database driver, one of Drivers
+	DSNFile string        // File holding the data source name
+	Query   string        // Query run by the check, defaults to "SELECT 1"
+	Timeout time.Duration // Upper bound for connecting and running the query
+}
+
+// Check is a database connectivity check
+type Check struct {
+	options Options
+	db      *sql.DB
+}
+
+// New creates a database check. Connections are opened lazily, so an
+// unreachable database does not prevent startup.
+func New(options Options) (*Check, error) {
+	dsn, err := os.ReadFile(options.DSNFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read DSN file: %w", err)
+	}
+
+	db, err := sql.Open(options.Driver, strings.TrimSpace(string(dsn)))
+	if err != nil {
+		return nil, fmt.Errorf("failed to open %s database: %w", options.Driver, err)
+	}
+	// A ping check needs a single connection; closing it when idle makes every
+	// check exercise the egress path again
+	db.SetMaxOpenConns(1)
+	db.SetMaxIdleConns(0)
+
+	if options.Query == "" {
+		options.Query = "SELECT 1"
+	}
+	if options.Timeout <= 0 {
+		options.Timeout = 3 * time.Second
+	}
+	return &Check{options: options, db: db}, nil
+}
+
+// Name identifies the check in health responses
+func (c *Check) Name() string {
+	return "database"
+}
+
+// Check connects to the database and runs the configured query
+func (c *Check) Check(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, c.options.Timeout)
+	defer cancel()
+
+	rows, err := c.db.QueryContext(ctx, c.options.Query)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+	}
+	return rows.Err()
+}
+
+// Close releases the database connections
+func (c *Check) Close() error {
+	return c.db.Close()
+}
+
+// Result is the response of the dbping endpoint
+type Result struct {
+	Driver   string `json:"driver"`
+	Status   string `json:"status"` // ok or error
+	Error    string `json:"error,omitempty"`
+	Duration string `json:"duration"`
+}
+
+// Handler runs the check and responds 200 when the database answered and
+// 503 otherwise
+func (c *Check) Handler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		err := c.Check(r.Context())
+
+		result := Result{Driver: c.options.Driver, Status: "ok", Duration: time.Since(start).String()}
+		status := http.StatusOK
+		if err != nil {
+			observability.WarnWithContext(r.Context(), fmt.Sprintf("Database ping failed: %v", err))
+			result.Status = "error"
+			result.Error = err.Error()
+			status = http.StatusServiceUnavailable
+		}
+
+		jsonData, err := json.Marshal(result)
+		if err != nil {
+			http.Error(w, "Failed to encode database ping result", http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		_, _ = w.Write(jsonData)
+	}
+}
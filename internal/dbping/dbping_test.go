@@ -0,0 +1,124 @@
+package dbping
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeDriver answers every query with a single row, or fails when the DSN is "down"
+type fakeDriver struct{}
+
+type fakeConn struct{ dsn string }
+
+type fakeStmt struct{ conn *fakeConn }
+
+type fakeRows struct{ done bool }
+
+func (fakeDriver) Open(dsn string) (driver.Conn, error) {
+	if dsn == "down" {
+		return nil, errors.New("connection refused")
+	}
+	return &fakeConn{dsn: dsn}, nil
+}
+
+func (c *fakeConn) Prepare(query string) (driver.Stmt, error) { return &fakeStmt{conn: c}, nil }
+func (c *fakeConn) Close() error                              { return nil }
+func (c *fakeConn) Begin() (driver.Tx, error)                 { return nil, errors.New("not supported") }
+
+func (s *fakeStmt) Close() error  { return nil }
+func (s *fakeStmt) NumInput() int { return -1 }
+func (s *fakeStmt) Exec(args []driver.Value) (driver.Result, error) {
+	return nil, errors.New("not supported")
+}
+func (s *fakeStmt) Query(args []driver.Value) (driver.Rows, error) { return &fakeRows{}, nil }
+
+func (r *fakeRows) Columns() []string { return []string{"?column?"} }
+func (r *fakeRows) Close() error      { return nil }
+func (r *fakeRows) Next(dest []driver.Value) error {
+	if r.done {
+		return io.EOF
+	}
+	r.done = true
+	dest[0] = int64(1)
+	return nil
+}
+
+func init() {
+	sql.Register("dbping-test", fakeDriver{})
+}
+
+// writeDSN writes dsn to a temporary file and returns its path
+func writeDSN(t *testing.T, dsn string) string {
+	path := filepath.Join(t.TempDir(), "dsn")
+	require.NoError(t, os.WriteFile(path, []byte(dsn+"\n"), 0o600))
+	return path
+}
+
+func TestNew(t *testing.T) {
+	_, err := New(Options{Driver: "dbping-test", DSNFile: filepath.Join(t.TempDir(), "missing")})
+	assert.Error(t, err)
+
+	_, err = New(Options{Driver: "unknown", DSNFile: writeDSN(t, "up")})
+	assert.Error(t, err)
+
+	c, err := New(Options{Driver: "dbping-test", DSNFile: writeDSN(t, "up")})
+	require.NoError(t, err)
+	defer c.Close()
+	assert.Equal(t, "SELECT 1", c.options.Query)
+	assert.Equal(t, 3*time.Second, c.options.Timeout)
+	assert.Equal(t, "database", c.Name())
+}
+
+func TestCheck(t *testing.T) {
+	up, err := New(Options{Driver: "dbping-test", DSNFile: writeDSN(t, "up")})
+	require.NoError(t, err)
+	defer up.Close()
+	assert.NoError(t, up.Check(context.Background()))
+
+	down, err := New(Options{Driver: "dbping-test", DSNFile: writeDSN(t, "down")})
+	require.NoError(t, err)
+	defer down.Close()
+	assert.Error(t, down.Check(context.Background()))
+}
+
+func TestHandler(t *testing.T) {
+	tests := []struct {
+		name     string
+		dsn      string
+		status   int
+		expected string
+	}{
+		{name: "reachable", dsn: "up", status: http.StatusOK, expected: "ok"},
+		{name: "unreachable", dsn: "down", status: http.StatusServiceUnavailable, expected: "error"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, err := New(Options{Driver: "dbping-test", DSNFile: writeDSN(t, tt.dsn)})
+			require.NoError(t, err)
+			defer c.Close()
+
+			w := httptest.NewRecorder()
+			c.Handler()(w, httptest.NewRequest("GET", "/istio-test/dbping", nil))
+			assert.Equal(t, tt.status, w.Code)
+
+			var result Result
+			require.NoError(t, json.Unmarshal(w.Body.Bytes(), &result))
+			assert.Equal(t, tt.expected, result.Status)
+			assert.Equal(t, "dbping-test", result.Driver)
+		})
+	}
+}
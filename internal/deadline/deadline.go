@@ -0,0 +1,155 @@
+// Package deadline derives request deadlines from mesh timeout headers.
+//
+// Envoy announces the route timeout it applies to a request in
+// x-envoy-expected-rq-timeout-ms, and gRPC clients send grpc-timeout. The
+// middleware turns either into a context deadline so handlers and outbound
+// calls stop when the caller has given up, and reports on the response whether
+// the deadline was respected. Outbound requests carry the remaining budget in
+// x-envoy-upstream-rq-timeout-ms so the deadline shrinks hop by hop.
+package deadline
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const (
+	// EnvoyExpectedTimeoutHeader is set by Envoy to the timeout of the route
+	EnvoyExpectedTimeoutHeader = "X-Envoy-Expected-Rq-Timeout-Ms"
+	// EnvoyUpstreamTimeoutHeader asks the outbound sidecar to apply a timeout
+	EnvoyUpstreamTimeoutHeader = "X-Envoy-Upstream-Rq-Timeout-Ms"
+	// GRPCTimeoutHeader is the gRPC deadline header
+	GRPCTimeoutHeader = "Grpc-Timeout"
+)
+
+// Parse returns the timeout announced by the request headers and the header it
+// was read from. Envoy's header takes precedence over grpc-timeout.
+func Parse(r *http.Request) (time.Duration, string, bool) {
+	if value := r.Header.Get(EnvoyExpectedTimeoutHeader); value != "" {
+		if ms, err := strconv.ParseInt(value, 10, 64); err == nil && ms > 0 {
+			return time.Duration(ms) * time.Millisecond, EnvoyExpectedTimeoutHeader, true
+		}
+	}
+	if value := r.Header.Get(GRPCTimeoutHeader); value != "" {
+		if timeout, ok := parseGRPCTimeout(value); ok {
+			return timeout, GRPCTimeoutHeader, true
+		}
+	}
+	return 0, "", false
+}
+
+// grpcTimeoutUnits maps grpc-timeout unit suffixes to durations
+var grpcTimeoutUnits = map[byte]time.Duration{
+	'H': time.Hour,
+	'M': time.Minute,
+	'S': time.Second,
+	'm': time.Millisecond,
+	'u': time.Microsecond,
+	'n': time.Nanosecond,
+}
+
+// parseGRPCTimeout parses a grpc-timeout value: up to 8 digits followed by a unit
+func parseGRPCTimeout(value string) (time.Duration, bool) {
+	if len(value) < 2 || len(value) > 9 {
+		return 0, false
+	}
+	unit, ok := grpcTimeoutUnits[value[len(value)-1]]
+	if !ok {
+		return 0, false
+	}
+	n, err := strconv.ParseInt(value[:len(value)-1], 10, 64)
+	if err != nil || n <= 0 {
+		return 0, false
+	}
+	return time.Duration(n) * unit, true
+}
+
+// reportingWriter adds the deadline report headers before the response header is written
+type reportingWriter struct {
+	http.ResponseWriter
+	source      string
+	budget      time.Duration
+	deadline    time.Time
+	wroteHeader bool
+}
+
+func (w *reportingWriter) report() {
+	if w.wroteHeader {
+		return
+	}
+	w.wroteHeader = true
+
+	remaining := time.Until(w.deadline)
+	h := w.ResponseWriter.Header()
+	h.Set("X-Deadline-Source", w.source)
+	h.Set("X-Deadline-Budget-Ms", strconv.FormatInt(w.budget.Milliseconds(), 10))
+	h.Set("X-Deadline-Remaining-Ms", strconv.FormatInt(max(remaining.Milliseconds(), 0), 10))
+	h.Set("X-Deadline-Respected", strconv.FormatBool(remaining > 0))
+}
+
+func (w *reportingWriter) WriteHeader(code int) {
+	w.report()
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *reportingWriter) Write(b []byte) (int, error) {
+	w.report()
+	return w.ResponseWriter.Write(b)
+}
+
+// Unwrap allows http.ResponseController to reach the underlying writer
+func (w *reportingWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// Middleware applies the deadline announced by the request headers to the
+// request context and reports on the response whether it was respected
+func Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		timeout, source, ok := Parse(r)
+		if !ok {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(r.Context(), timeout)
+		defer cancel()
+		deadline, _ := ctx.Deadline()
+
+		rw := &reportingWriter{ResponseWriter: w, source: source, budget: timeout, deadline: deadline}
+		next.ServeHTTP(rw, r.WithContext(ctx))
+		rw.report()
+	})
+}
+
+// propagatingTransport forwards the remaining budget of the request context
+type propagatingTransport struct {
+	next http.RoundTripper
+}
+
+func (t *propagatingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	deadline, ok := req.Context().Deadline()
+	if !ok || req.Header.Get(EnvoyUpstreamTimeoutHeader) != "" {
+		return t.next.RoundTrip(req)
+	}
+
+	remaining := time.Until(deadline).Milliseconds()
+	if remaining < 1 {
+		remaining = 1
+	}
+	req = req.Clone(req.Context())
+	req.Header.Set(EnvoyUpstreamTimeoutHeader, strconv.FormatInt(remaining, 10))
+	return t.next.RoundTrip(req)
+}
+
+// Unwrap returns the wrapped transport
+func (t *propagatingTransport) Unwrap() http.RoundTripper {
+	return t.next
+}
+
+// Transport wraps next so outbound requests carry the remaining deadline budget
+func Transport(next http.RoundTripper) http.RoundTripper {
+	return &propagatingTransport{next: next}
+}
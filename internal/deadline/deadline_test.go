@@ -0,0 +1,122 @@
+package deadline
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name    string
+		headers map[string]string
+		timeout time.Duration
+		source  string
+		ok      bool
+	}{
+		{name: "no headers"},
+		{name: "envoy header", headers: map[string]string{EnvoyExpectedTimeoutHeader: "1500"}, timeout: 1500 * time.Millisecond, source: EnvoyExpectedTimeoutHeader, ok: true},
+		{name: "grpc seconds", headers: map[string]string{GRPCTimeoutHeader: "2S"}, timeout: 2 * time.Second, source: GRPCTimeoutHeader, ok: true},
+		{name: "grpc milliseconds", headers: map[string]string{GRPCTimeoutHeader: "250m"}, timeout: 250 * time.Millisecond, source: GRPCTimeoutHeader, ok: true},
+		{name: "envoy header wins", headers: map[string]string{EnvoyExpectedTimeoutHeader: "100", GRPCTimeoutHeader: "5S"}, timeout: 100 * time.Millisecond, source: EnvoyExpectedTimeoutHeader, ok: true},
+		{name: "invalid envoy header falls back", headers: map[string]string{EnvoyExpectedTimeoutHeader: "soon", GRPCTimeoutHeader: "1M"}, timeout: time.Minute, source: GRPCTimeoutHeader, ok: true},
+		{name: "zero envoy timeout", headers: map[string]string{EnvoyExpectedTimeoutHeader: "0"}},
+		{name: "grpc unknown unit", headers: map[string]string{GRPCTimeoutHeader: "5d"}},
+		{name: "grpc too many digits", headers: map[string]string{GRPCTimeoutHeader: "123456789S"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/", nil)
+			for k, v := range tt.headers {
+				req.Header.Set(k, v)
+			}
+			timeout, source, ok := Parse(req)
+			assert.Equal(t, tt.ok, ok)
+			assert.Equal(t, tt.timeout, timeout)
+			assert.Equal(t, tt.source, source)
+		})
+	}
+}
+
+func TestMiddleware(t *testing.T) {
+	t.Run("no deadline headers", func(t *testing.T) {
+		handler := Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			_, ok := r.Context().Deadline()
+			assert.False(t, ok)
+		}))
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+		assert.Empty(t, w.Header().Get("X-Deadline-Respected"))
+	})
+
+	t.Run("deadline respected", func(t *testing.T) {
+		handler := Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			deadline, ok := r.Context().Deadline()
+			assert.True(t, ok)
+			assert.WithinDuration(t, time.Now().Add(time.Second), deadline, 100*time.Millisecond)
+			w.Write([]byte("ok"))
+		}))
+		req := httptest.NewRequest("GET", "/", nil)
+		req.Header.Set(EnvoyExpectedTimeoutHeader, "1000")
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+
+		assert.Equal(t, "true", w.Header().Get("X-Deadline-Respected"))
+		assert.Equal(t, "1000", w.Header().Get("X-Deadline-Budget-Ms"))
+		assert.Equal(t, EnvoyExpectedTimeoutHeader, w.Header().Get("X-Deadline-Source"))
+		remaining, err := strconv.Atoi(w.Header().Get("X-Deadline-Remaining-Ms"))
+		require.NoError(t, err)
+		assert.Greater(t, remaining, 0)
+	})
+
+	t.Run("deadline exceeded without writing", func(t *testing.T) {
+		handler := Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			<-r.Context().Done()
+		}))
+		req := httptest.NewRequest("GET", "/", nil)
+		req.Header.Set(GRPCTimeoutHeader, "10m")
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+
+		assert.Equal(t, "false", w.Header().Get("X-Deadline-Respected"))
+		assert.Equal(t, "0", w.Header().Get("X-Deadline-Remaining-Ms"))
+	})
+}
+
+func TestTransport(t *testing.T) {
+	received := make(chan string, 1)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received <- r.Header.Get(EnvoyUpstreamTimeoutHeader)
+	}))
+	defer ts.Close()
+
+	client := &http.Client{Transport: Transport(http.DefaultTransport)}
+
+	t.Run("without deadline", func(t *testing.T) {
+		resp, err := client.Get(ts.URL)
+		require.NoError(t, err)
+		resp.Body.Close()
+		assert.Empty(t, <-received)
+	})
+
+	t.Run("with deadline", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+		defer cancel()
+		req, err := http.NewRequestWithContext(ctx, "GET", ts.URL, nil)
+		require.NoError(t, err)
+		resp, err := client.Do(req)
+		require.NoError(t, err)
+		resp.Body.Close()
+
+		budget, err := strconv.Atoi(<-received)
+		require.NoError(t, err)
+		assert.InDelta(t, 2000, budget, 200)
+	})
+}
@@ -0,0 +1,89 @@
+package drain
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"strings"
+	"sync"
+
+	"istio-test/internal/observability"
+)
+
+// Controller serves the Envoy-style lifecycle endpoints: POST /drain starts
+// draining while the server keeps serving, POST /quitquitquit shuts it down
+// gracefully. Both only signal; the server acts on Draining and Quitting.
+// Neither affects liveness, so a draining pod is not restarted by its probe.
+type Controller struct {
+	token string
+
+	drainOnce sync.Once
+	draining  chan struct{}
+	quitOnce  sync.Once
+	quitting  chan struct{}
+}
+
+// NewController creates a controller whose endpoints require token as a
+// bearer token, or no token when it is empty
+func NewController(token string) *Controller {
+	return &Controller{token: token, draining: make(chan struct{}), quitting: make(chan struct{})}
+}
+
+// Drain starts draining; later calls have no effect
+func (c *Controller) Drain() {
+	c.drainOnce.Do(func() { close(c.draining) })
+}
+
+// Quit requests a graceful shutdown; later calls have no effect
+func (c *Controller) Quit() {
+	c.quitOnce.Do(func() { close(c.quitting) })
+}
+
+// Draining is closed once draining was requested
+func (c *Controller) Draining() <-chan struct{} {
+	return c.draining
+}
+
+// Quitting is closed once a shutdown was requested
+func (c *Controller) Quitting() <-chan struct{} {
+	return c.quitting
+}
+
+// authorized reports whether r carries the token, if one is required
+func (c *Controller) authorized(r *http.Request) bool {
+	if c.token == "" {
+		return true
+	}
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	return ok && subtle.ConstantTimeCompare([]byte(token), []byte(c.token)) == 1
+}
+
+// handler calls action for authorized requests and answers "OK" as Envoy does
+func (c *Controller) handler(action func(), message string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !c.authorized(r) {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="istio-test"`)
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		observability.WarnWithFields(r.Context(), message, map[string]any{
+			"type":      "lifecycle",
+			"path":      r.URL.Path,
+			"client_ip": r.RemoteAddr,
+		})
+		action()
+
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		w.WriteHeader(http.StatusOK)
+		_, _ = w.Write([]byte("OK\n"))
+	}
+}
+
+// DrainHandler starts draining
+func (c *Controller) DrainHandler() http.HandlerFunc {
+	return c.handler(c.Drain, "Drain requested, failing readiness while serving")
+}
+
+// QuitHandler requests a graceful shutdown
+func (c *Controller) QuitHandler() http.HandlerFunc {
+	return c.handler(c.Quit, "Shutdown requested through /quitquitquit")
+}
@@ -0,0 +1,63 @@
+package drain
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// closed reports whether ch is closed
+func closed(ch <-chan struct{}) bool {
+	select {
+	case <-ch:
+		return true
+	default:
+		return false
+	}
+}
+
+func TestController(t *testing.T) {
+	c := NewController("")
+	assert.False(t, closed(c.Draining()))
+	assert.False(t, closed(c.Quitting()))
+
+	w := httptest.NewRecorder()
+	c.DrainHandler()(w, httptest.NewRequest(http.MethodPost, "/drain", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "OK\n", w.Body.String())
+	assert.True(t, closed(c.Draining()))
+	assert.False(t, closed(c.Quitting()), "draining keeps serving")
+
+	// Repeated requests are harmless
+	c.DrainHandler()(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/drain", nil))
+	for range 2 {
+		w = httptest.NewRecorder()
+		c.QuitHandler()(w, httptest.NewRequest(http.MethodPost, "/quitquitquit", nil))
+		assert.Equal(t, http.StatusOK, w.Code)
+	}
+	assert.True(t, closed(c.Quitting()))
+}
+
+func TestControllerToken(t *testing.T) {
+	c := NewController("ci-drain-token")
+	for _, authorization := range []string{"", "Bearer wrong", "ci-drain-token", "Basic ci-drain-token"} {
+		r := httptest.NewRequest(http.MethodPost, "/quitquitquit", nil)
+		if authorization != "" {
+			r.Header.Set("Authorization", authorization)
+		}
+		w := httptest.NewRecorder()
+		c.QuitHandler()(w, r)
+		assert.Equal(t, http.StatusUnauthorized, w.Code, authorization)
+		assert.NotEmpty(t, w.Header().Get("WWW-Authenticate"))
+	}
+	assert.False(t, closed(c.Quitting()))
+
+	r := httptest.NewRequest(http.MethodPost, "/quitquitquit", nil)
+	r.Header.Set("Authorization", "Bearer ci-drain-token")
+	w := httptest.NewRecorder()
+	c.QuitHandler()(w, r)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.True(t, closed(c.Quitting()))
+}
@@ -0,0 +1,78 @@
+// Package drain tracks in-flight requests so shutdown can report how many
+// requests in flight when draining started finished, how many were accepted
+// during the drain delay, and how many were cut off by the shutdown timeout. Its Controller lets draining and shutdown be requested
+// over HTTP, as Envoy's admin interface does.
+package drain
+
+import (
+	"net/http"
+	"sync/atomic"
+)
+
+// Result counts the requests of a drain
+type Result struct {
+	InFlight int64 // Requests in flight when draining started
+	Drained  int64 // Requests in flight when draining started that completed since
+	Accepted int64 // Requests accepted after draining started that completed
+	Aborted  int64 // Requests still in flight when the result was taken
+}
+
+// Tracker counts the requests passing through its middleware
+type Tracker struct {
+	inFlight atomic.Int64
+	draining atomic.Bool
+	atStart  atomic.Int64
+	drained  atomic.Int64
+	accepted atomic.Int64
+}
+
+// NewTracker creates a tracker
+func NewTracker() *Tracker {
+	return &Tracker{}
+}
+
+// Middleware tracks the requests handled by next, including hijacked
+// connections such as WebSockets until their handler returns
+func (t *Tracker) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.inFlight.Add(1)
+		lateArrival := t.draining.Load()
+		defer func() {
+			switch {
+			case lateArrival:
+				t.accepted.Add(1)
+			case t.draining.Load():
+				t.drained.Add(1)
+			}
+			t.inFlight.Add(-1)
+		}()
+		next.ServeHTTP(w, r)
+	})
+}
+
+// InFlight returns the number of requests being handled
+func (t *Tracker) InFlight() int64 {
+	return t.inFlight.Load()
+}
+
+// StartDraining counts the requests in flight from now on as drained and
+// those arriving later as accepted during the drain, and returns the number of
+// requests in flight
+func (t *Tracker) StartDraining() int64 {
+	t.draining.Store(true)
+	inFlight := t.inFlight.Load()
+	t.atStart.Store(inFlight)
+	return inFlight
+}
+
+// Result returns the requests completed since StartDraining, split by whether
+// they were in flight when it was called, and those still in flight, which are
+// aborted when the process exits
+func (t *Tracker) Result() Result {
+	return Result{
+		InFlight: t.atStart.Load(),
+		Drained:  t.drained.Load(),
+		Accepted: t.accepted.Load(),
+		Aborted:  t.inFlight.Load(),
+	}
+}
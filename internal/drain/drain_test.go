@@ -0,0 +1,57 @@
+package drain
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTracker(t *testing.T) {
+	tracker := NewTracker()
+	release := make(chan struct{})
+	started := make(chan struct{})
+	handler := tracker.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/slow" {
+			started <- struct{}{}
+			<-release
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	serve := func(path string) {
+		handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, path, nil))
+	}
+
+	// Requests completed before the drain are not counted
+	serve("/fast")
+	assert.Equal(t, int64(0), tracker.InFlight())
+
+	var wg sync.WaitGroup
+	for range 3 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			serve("/slow")
+		}()
+		<-started
+	}
+	require.Equal(t, int64(3), tracker.InFlight())
+	assert.Equal(t, int64(3), tracker.StartDraining())
+
+	release <- struct{}{}
+	release <- struct{}{}
+	require.Eventually(t, func() bool { return tracker.InFlight() == 1 }, time.Second, 5*time.Millisecond)
+	assert.Equal(t, Result{InFlight: 3, Drained: 2, Aborted: 1}, tracker.Result())
+
+	// Requests accepted during the drain are not counted as drained
+	serve("/fast")
+	assert.Equal(t, Result{InFlight: 3, Drained: 2, Accepted: 1, Aborted: 1}, tracker.Result())
+
+	close(release)
+	wg.Wait()
+	assert.Equal(t, Result{InFlight: 3, Drained: 3, Accepted: 1, Aborted: 0}, tracker.Result())
+}
@@ -0,0 +1,86 @@
+// Package echo implements an endpoint that reflects the request it receives.
+//
+// The response shows the request as it arrived after every proxy on the way,
+// which makes header manipulation, rewrites and mirroring of VirtualServices
+// visible without deploying a separate httpbin.
+package echo
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"unicode/utf8"
+
+	"istio-test/internal/observability"
+)
+
+// maxBodyBytes is the largest request body that is reflected
+const maxBodyBytes = 1 << 20
+
+// Methods are the request methods the echo endpoint accepts
+var Methods = []string{"GET", "POST", "PUT", "PATCH", "DELETE"}
+
+// Response is the reflected request
+type Response struct {
+	Method     string              `json:"method"`
+	Path       string              `json:"path"`
+	RawQuery   string              `json:"raw_query,omitempty"`
+	Query      map[string][]string `json:"query"`
+	Host       string              `json:"host"`
+	Protocol   string              `json:"protocol"`
+	RemoteAddr string              `json:"remote_addr"`
+	Headers    map[string][]string `json:"headers"`
+	Body       string              `json:"body,omitempty"`
+	BodyBase64 string              `json:"body_base64,omitempty"` // Set instead of Body when the body is not valid UTF-8
+	Hostname   string              `json:"hostname"`              // Pod that served the request
+}
+
+// Handler reflects the method, path, query, headers and body of the request as JSON
+func Handler(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxBodyBytes))
+	if err != nil {
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			http.Error(w, fmt.Sprintf("Request body exceeds %d bytes", maxBodyBytes), http.StatusRequestEntityTooLarge)
+			return
+		}
+		http.Error(w, "Failed to read request body", http.StatusBadRequest)
+		return
+	}
+
+	// Host is removed from the header map by net/http, keep it in Headers too
+	headers := r.Header.Clone()
+	headers.Set("Host", r.Host)
+
+	response := Response{
+		Method:     r.Method,
+		Path:       r.URL.Path,
+		RawQuery:   r.URL.RawQuery,
+		Query:      r.URL.Query(),
+		Host:       r.Host,
+		Protocol:   r.Proto,
+		RemoteAddr: r.RemoteAddr,
+		Headers:    headers,
+		Hostname:   os.Getenv("HOSTNAME"),
+	}
+	if utf8.Valid(body) {
+		response.Body = string(body)
+	} else {
+		response.BodyBase64 = base64.StdEncoding.EncodeToString(body)
+	}
+
+	jsonData, err := json.Marshal(response)
+	if err != nil {
+		observability.ErrorWithContext(r.Context(), fmt.Sprintf("Error encoding echo response: %v", err))
+		http.Error(w, "Failed to encode echo response", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write(jsonData)
+}
@@ -0,0 +1,59 @@
+package echo
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHandler(t *testing.T) {
+	t.Setenv("HOSTNAME", "pod-1")
+
+	req := httptest.NewRequest("POST", "/istio-test/echo/a?x=1&x=2&y=3", strings.NewReader(`{"hello":"world"}`))
+	req.Header.Set("X-Custom", "value")
+	req.Header.Add("X-Multi", "one")
+	req.Header.Add("X-Multi", "two")
+	w := httptest.NewRecorder()
+	Handler(w, req)
+
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "application/json", w.Header().Get("Content-Type"))
+
+	var response Response
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	assert.Equal(t, "POST", response.Method)
+	assert.Equal(t, "/istio-test/echo/a", response.Path)
+	assert.Equal(t, "x=1&x=2&y=3", response.RawQuery)
+	assert.Equal(t, []string{"1", "2"}, response.Query["x"])
+	assert.Equal(t, "example.com", response.Host)
+	assert.Equal(t, []string{"example.com"}, response.Headers["Host"])
+	assert.Equal(t, []string{"value"}, response.Headers["X-Custom"])
+	assert.Equal(t, []string{"one", "two"}, response.Headers["X-Multi"])
+	assert.Equal(t, `{"hello":"world"}`, response.Body)
+	assert.Empty(t, response.BodyBase64)
+	assert.Equal(t, "pod-1", response.Hostname)
+}
+
+func TestHandlerBinaryBody(t *testing.T) {
+	body := []byte{0xff, 0xfe, 0x00}
+	w := httptest.NewRecorder()
+	Handler(w, httptest.NewRequest("PUT", "/istio-test/echo", bytes.NewReader(body)))
+
+	var response Response
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	assert.Empty(t, response.Body)
+	assert.Equal(t, base64.StdEncoding.EncodeToString(body), response.BodyBase64)
+}
+
+func TestHandlerBodyTooLarge(t *testing.T) {
+	w := httptest.NewRecorder()
+	Handler(w, httptest.NewRequest("POST", "/istio-test/echo", bytes.NewReader(make([]byte, maxBodyBytes+1))))
+	assert.Equal(t, http.StatusRequestEntityTooLarge, w.Code)
+}
@@ -0,0 +1,268 @@
+// Package expiry watches mounted credentials for upcoming expiry.
+//
+// Certificates and projected service account tokens are rotated by the
+// kubelet, istio-agent or cert-manager long before they expire. When rotation
+// breaks, nothing fails until the old credential runs out, which then breaks
+// mTLS or API calls all at once. The watcher reads the expiry of every
+// configured credential in the background, exports the time left as a metric
+// and degrades health once a credential gets within the warning window, so
+// rotation failures show up while there is still time to look at them.
+package expiry
+
+import (
+	"context"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"istio-test/internal/observability"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Kinds of watched credentials
+const (
+	KindCertificate = "certificate"
+	KindToken       = "token"
+)
+
+var (
+	expirySeconds = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: "istio_test",
+		Name:      "credential_expiry_seconds",
+		Help:      "Seconds until a watched certificate or token expires, negative once expired.",
+	}, []string{"kind", "name"})
+	readErrors = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "istio_test",
+		Name:      "credential_expiry_read_errors_total",
+		Help:      "Total number of failures to read the expiry of a watched certificate or token.",
+	}, []string{"kind", "name"})
+)
+
+func init() {
+	observability.MetricsRegistry().MustRegister(expirySeconds, readErrors)
+}
+
+// Source is a watched credential
+type Source struct {
+	Kind   string                    // KindCertificate, KindToken or the kind of a custom source
+	Name   string                    // Identifies the credential, e.g. its path
+	Expiry func() (time.Time, error) // Returns the moment the credential expires
+}
+
+// CertificateFile watches the PEM certificates in path; a chain expires with
+// its first certificate
+func CertificateFile(path string) Source {
+	return Source{Kind: KindCertificate, Name: path, Expiry: func() (time.Time, error) {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return time.Time{}, err
+		}
+
+		var notAfter time.Time
+		for block, rest := pem.Decode(data); block != nil; block, rest = pem.Decode(rest) {
+			if block.Type != "CERTIFICATE" {
+				continue
+			}
+			cert, err := x509.ParseCertificate(block.Bytes)
+			if err != nil {
+				return time.Time{}, fmt.Errorf("invalid certificate: %w", err)
+			}
+			if notAfter.IsZero() || cert.NotAfter.Before(notAfter) {
+				notAfter = cert.NotAfter
+			}
+		}
+		if notAfter.IsZero() {
+			return time.Time{}, errors.New("no PEM certificate found")
+		}
+		return notAfter, nil
+	}}
+}
+
+// TokenFile watches the JWT in path, such as a projected service account
+// token. Only the exp claim is read; the signature is not verified.
+func TokenFile(path string) Source {
+	return Source{Kind: KindToken, Name: path, Expiry: func() (time.Time, error) {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return time.Time{}, err
+		}
+		parts := strings.Split(strings.TrimSpace(string(data)), ".")
+		if len(parts) != 3 {
+			return time.Time{}, errors.New("not a JWT")
+		}
+		payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+		if err != nil {
+			return time.Time{}, fmt.Errorf("invalid JWT payload: %w", err)
+		}
+		var claims struct {
+			Exp *float64 `json:"exp"`
+		}
+		if err := json.Unmarshal(payload, &claims); err != nil {
+			return time.Time{}, fmt.Errorf("invalid JWT claims: %w", err)
+		}
+		if claims.Exp == nil {
+			return time.Time{}, errors.New("JWT has no exp claim")
+		}
+		return time.Unix(int64(*claims.Exp), 0), nil
+	}}
+}
+
+// Item is the last known expiry of a source
+type Item struct {
+	Kind      string     `json:"kind"`
+	Name      string     `json:"name"`
+	NotAfter  *time.Time `json:"not_after,omitempty"`
+	Remaining string     `json:"remaining,omitempty"`
+	Error     string     `json:"error,omitempty"` // Why the expiry could not be read
+}
+
+// Watcher reads the expiry of its sources in the background
+type Watcher struct {
+	window time.Duration
+	now    func() time.Time
+
+	mu      sync.Mutex
+	sources []Source
+	items   []Item
+}
+
+// NewWatcher creates a watcher that degrades health when a source expires
+// within window; call Run to start watching
+func NewWatcher(window time.Duration, sources ...Source) *Watcher {
+	return &Watcher{window: window, sources: sources, now: time.Now}
+}
+
+// Add watches another source, such as a key cache, from the next refresh on
+func (w *Watcher) Add(source Source) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.sources = append(w.sources, source)
+	w.items = nil
+}
+
+// Len returns the number of sources
+func (w *Watcher) Len() int {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return len(w.sources)
+}
+
+// Refresh reads the expiry of every source and updates the metrics
+func (w *Watcher) Refresh(ctx context.Context) {
+	w.mu.Lock()
+	sources := append([]Source(nil), w.sources...)
+	w.mu.Unlock()
+
+	items := make([]Item, 0, len(sources))
+	for _, source := range sources {
+		item := Item{Kind: source.Kind, Name: source.Name}
+		notAfter, err := source.Expiry()
+		if err != nil {
+			item.Error = err.Error()
+			readErrors.WithLabelValues(source.Kind, source.Name).Inc()
+			observability.WarnWithContext(ctx, fmt.Sprintf("Failed to read expiry of %s %s: %v", source.Kind, source.Name, err))
+		} else {
+			item.NotAfter = &notAfter
+		}
+		items = append(items, item)
+	}
+
+	w.mu.Lock()
+	w.items = items
+	w.mu.Unlock()
+	w.Items()
+}
+
+// Items returns the last known expiry of every source with the time
+// remaining from now, which is also exported as the metric
+func (w *Watcher) Items() []Item {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	now := w.now()
+	items := make([]Item, len(w.items))
+	for i, item := range w.items {
+		if item.NotAfter != nil {
+			remaining := item.NotAfter.Sub(now)
+			item.Remaining = remaining.Round(time.Second).String()
+			expirySeconds.WithLabelValues(item.Kind, item.Name).Set(remaining.Seconds())
+		}
+		items[i] = item
+	}
+	return items
+}
+
+// Run refreshes immediately and then on every interval until ctx is done
+func (w *Watcher) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		w.Refresh(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Name identifies the watcher in health responses
+func (w *Watcher) Name() string {
+	return "credential_expiry"
+}
+
+// Check fails when a source expires within the window or its expiry cannot
+// be read, which degrades health
+func (w *Watcher) Check(ctx context.Context) error {
+	w.mu.Lock()
+	refreshed := w.items != nil
+	w.mu.Unlock()
+	if !refreshed {
+		w.Refresh(ctx)
+	}
+
+	var problems []string
+	for _, item := range w.Items() {
+		switch {
+		case item.Error != "":
+			problems = append(problems, fmt.Sprintf("%s %s unreadable: %s", item.Kind, item.Name, item.Error))
+		case item.NotAfter.Sub(w.now()) <= w.window:
+			problems = append(problems, fmt.Sprintf("%s %s expires in %s", item.Kind, item.Name, item.Remaining))
+		}
+	}
+	if len(problems) > 0 {
+		return errors.New(strings.Join(problems, "; "))
+	}
+	return nil
+}
+
+// Response is returned by Handler
+type Response struct {
+	Window string `json:"window"`
+	Items  []Item `json:"items"`
+}
+
+// Handler reports the last known expiry of every source
+func (w *Watcher) Handler() http.HandlerFunc {
+	return func(rw http.ResponseWriter, r *http.Request) {
+		jsonData, err := json.Marshal(Response{Window: w.window.String(), Items: w.Items()})
+		if err != nil {
+			observability.ErrorWithContext(r.Context(), fmt.Sprintf("Error encoding expiry: %v", err))
+			http.Error(rw, "Failed to encode expiry", http.StatusInternalServerError)
+			return
+		}
+		rw.Header().Set("Content-Type", "application/json")
+		rw.WriteHeader(http.StatusOK)
+		_, _ = rw.Write(jsonData)
+	}
+}
@@ -0,0 +1,131 @@
+package expiry
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// writeCerts writes a PEM chain of self-signed certificates expiring at notAfters
+func writeCerts(t *testing.T, notAfters ...time.Time) string {
+	var data []byte
+	for i, notAfter := range notAfters {
+		key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		require.NoError(t, err)
+		template := &x509.Certificate{
+			SerialNumber: big.NewInt(int64(i + 1)),
+			Subject:      pkix.Name{CommonName: "istio-test"},
+			NotBefore:    time.Now().Add(-time.Hour),
+			NotAfter:     notAfter,
+		}
+		der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+		require.NoError(t, err)
+		data = append(data, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})...)
+	}
+	path := filepath.Join(t.TempDir(), "cert-chain.pem")
+	require.NoError(t, os.WriteFile(path, data, 0600))
+	return path
+}
+
+// writeToken writes an unsigned JWT with claims
+func writeToken(t *testing.T, claims string) string {
+	encode := base64.RawURLEncoding.EncodeToString
+	token := encode([]byte(`{"alg":"RS256"}`)) + "." + encode([]byte(claims)) + ".c2lnbmF0dXJl\n"
+	path := filepath.Join(t.TempDir(), "token")
+	require.NoError(t, os.WriteFile(path, []byte(token), 0600))
+	return path
+}
+
+func TestCertificateFile(t *testing.T) {
+	soon := time.Now().Add(time.Hour).Truncate(time.Second)
+	path := writeCerts(t, time.Now().Add(24*time.Hour), soon)
+
+	notAfter, err := CertificateFile(path).Expiry()
+	require.NoError(t, err)
+	assert.True(t, soon.Equal(notAfter), "the chain expires with its first certificate")
+
+	_, err = CertificateFile(writeToken(t, `{}`)).Expiry()
+	assert.Error(t, err)
+}
+
+func TestTokenFile(t *testing.T) {
+	notAfter, err := TokenFile(writeToken(t, `{"exp":1767225600,"sub":"system:serviceaccount:istio-test:istio-test"}`)).Expiry()
+	require.NoError(t, err)
+	assert.Equal(t, int64(1767225600), notAfter.Unix())
+
+	_, err = TokenFile(writeToken(t, `{"sub":"no-exp"}`)).Expiry()
+	assert.Error(t, err)
+	_, err = TokenFile(filepath.Join(t.TempDir(), "missing")).Expiry()
+	assert.Error(t, err)
+}
+
+func TestWatcherCheck(t *testing.T) {
+	healthy := CertificateFile(writeCerts(t, time.Now().Add(24*time.Hour)))
+	w := NewWatcher(10*time.Minute, healthy)
+	require.NoError(t, w.Check(context.Background()))
+
+	// A token close to expiry degrades health
+	w.Add(TokenFile(writeToken(t, `{"exp":`+jsonTime(time.Now().Add(5*time.Minute))+`}`)))
+	err := w.Check(context.Background())
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "token")
+	assert.Contains(t, err.Error(), "expires in")
+
+	// So does a credential that cannot be read
+	w = NewWatcher(10*time.Minute, healthy, TokenFile(filepath.Join(t.TempDir(), "missing")))
+	err = w.Check(context.Background())
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "unreadable")
+}
+
+func TestWatcherRemainingFollowsClock(t *testing.T) {
+	w := NewWatcher(10*time.Minute, CertificateFile(writeCerts(t, time.Now().Add(time.Hour))))
+	w.Refresh(context.Background())
+	require.NoError(t, w.Check(context.Background()))
+
+	// Time passes without a refresh
+	now := time.Now().Add(55 * time.Minute)
+	w.now = func() time.Time { return now }
+	assert.Error(t, w.Check(context.Background()))
+}
+
+func TestHandler(t *testing.T) {
+	path := writeCerts(t, time.Now().Add(time.Hour))
+	w := NewWatcher(10*time.Minute, CertificateFile(path))
+	w.Refresh(context.Background())
+
+	rec := httptest.NewRecorder()
+	w.Handler()(rec, httptest.NewRequest(http.MethodGet, "/admin/expiry", nil))
+
+	assert.Equal(t, http.StatusOK, rec.Code)
+	var response Response
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &response))
+	assert.Equal(t, "10m0s", response.Window)
+	require.Len(t, response.Items, 1)
+	assert.Equal(t, KindCertificate, response.Items[0].Kind)
+	assert.Equal(t, path, response.Items[0].Name)
+	assert.True(t, strings.HasPrefix(response.Items[0].Remaining, "59m") || strings.HasPrefix(response.Items[0].Remaining, "1h"))
+}
+
+// jsonTime encodes t as a JWT NumericDate
+func jsonTime(t time.Time) string {
+	data, _ := json.Marshal(t.Unix())
+	return string(data)
+}
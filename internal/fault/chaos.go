@@ -0,0 +1,108 @@
+package fault
+
+import (
+	"math"
+	"math/rand/v2"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// z99 is the 99th percentile of the standard normal distribution
+const z99 = 2.3263478740408408
+
+// randNorm returns a standard normally distributed number; replaced in tests
+var randNorm = rand.NormFloat64
+
+// ChaosOptions configures random errors and latency injected into every
+// matching request, to make the pod a statistically jittery upstream
+type ChaosOptions struct {
+	ErrorRate     float64       // Probability (0-1) of answering with an injected error
+	ErrorStatuses []int         // Statuses of injected errors, picked uniformly, defaults to 503
+	LatencyRate   float64       // Probability (0-1) of adding latency to a request
+	LatencyP50    time.Duration // Median of the added latency
+	LatencyP99    time.Duration // 99th percentile of the added latency, LatencyP50 when lower
+	MaxLatency    time.Duration // Upper bound of a single added latency, unbounded when zero
+	Routes        []string      // Path prefixes chaos applies to, all paths when empty
+	ExcludeRoutes []string      // Path prefixes never degraded, e.g. health probes
+}
+
+// Active reports whether the options change request handling at all
+func (o ChaosOptions) Active() bool {
+	return o.ErrorRate > 0 || (o.LatencyRate > 0 && o.LatencyP50 > 0)
+}
+
+// Chaos injects random errors and latency. Latency follows a log-normal
+// distribution fitted to LatencyP50 and LatencyP99, which gives the long right
+// tail of a real upstream. The error rate can be changed while serving.
+type Chaos struct {
+	mu      sync.Mutex // Serializes changes to options
+	options atomic.Pointer[ChaosOptions]
+}
+
+// NewChaos creates a chaos injector
+func NewChaos(options ChaosOptions) *Chaos {
+	c := &Chaos{}
+	c.options.Store(&options)
+	return c
+}
+
+// Options returns the options currently applied
+func (c *Chaos) Options() ChaosOptions {
+	return *c.options.Load()
+}
+
+// ErrorRate returns the probability (0-1) of answering with an injected error
+func (c *Chaos) ErrorRate() float64 {
+	return c.options.Load().ErrorRate
+}
+
+// SetErrorRate changes the probability (0-1) of answering with an injected error
+func (c *Chaos) SetErrorRate(rate float64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	o := *c.options.Load()
+	o.ErrorRate = rate
+	c.options.Store(&o)
+}
+
+// Fault draws the degradation applied to a single request
+func (c *Chaos) Fault() Fault {
+	o := c.Options()
+	f := Fault{ErrorRate: o.ErrorRate, ErrorStatus: http.StatusServiceUnavailable}
+	if len(o.ErrorStatuses) > 0 {
+		f.ErrorStatus = o.ErrorStatuses[min(int(randFloat()*float64(len(o.ErrorStatuses))), len(o.ErrorStatuses)-1)]
+	}
+	if o.LatencyP50 > 0 && o.LatencyRate > 0 && randFloat() < o.LatencyRate {
+		f.Latency = sampleLatency(o.LatencyP50, o.LatencyP99, o.MaxLatency)
+	}
+	return f
+}
+
+// sampleLatency draws a latency from the log-normal distribution with median
+// p50 and 99th percentile p99, capped at limit when set
+func sampleLatency(p50, p99, limit time.Duration) time.Duration {
+	sigma := 0.0
+	if p99 > p50 {
+		sigma = math.Log(float64(p99)/float64(p50)) / z99
+	}
+	latency := time.Duration(float64(p50) * math.Exp(sigma*randNorm()))
+	if limit > 0 && latency > limit {
+		return limit
+	}
+	return latency
+}
+
+// Middleware applies chaos to matching requests
+func (c *Chaos) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		o := c.options.Load()
+		if o.Active() && matchesRoute(r.URL.Path, o.Routes, o.ExcludeRoutes) {
+			if f := c.Fault(); f.Active() && apply(w, r, f, "chaos") {
+				return
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
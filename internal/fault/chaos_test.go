@@ -0,0 +1,92 @@
+package fault
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSampleLatency(t *testing.T) {
+	original := randNorm
+	t.Cleanup(func() { randNorm = original })
+
+	randNorm = func() float64 { return 0 }
+	assert.Equal(t, 100*time.Millisecond, sampleLatency(100*time.Millisecond, time.Second, 0))
+
+	randNorm = func() float64 { return z99 }
+	assert.InDelta(t, float64(time.Second), float64(sampleLatency(100*time.Millisecond, time.Second, 0)), float64(time.Microsecond))
+	assert.Equal(t, 100*time.Millisecond, sampleLatency(100*time.Millisecond, 0, 0), "a missing p99 gives a constant latency")
+	assert.Equal(t, 500*time.Millisecond, sampleLatency(100*time.Millisecond, time.Second, 500*time.Millisecond))
+}
+
+func TestSampleLatencyPercentiles(t *testing.T) {
+	samples := make([]time.Duration, 20000)
+	for i := range samples {
+		samples[i] = sampleLatency(50*time.Millisecond, 400*time.Millisecond, 0)
+	}
+	slices.Sort(samples)
+
+	assert.InEpsilon(t, float64(50*time.Millisecond), float64(samples[len(samples)/2]), 0.1)
+	assert.InEpsilon(t, float64(400*time.Millisecond), float64(samples[len(samples)*99/100]), 0.2)
+}
+
+func TestChaosMiddleware(t *testing.T) {
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	})
+
+	t.Run("random error status", func(t *testing.T) {
+		withRand(t, 0.6)
+		chaos := NewChaos(ChaosOptions{
+			ErrorRate:     1,
+			ErrorStatuses: []int{500, 502, 503, 504},
+			ExcludeRoutes: []string{"/istio-test/health"},
+		})
+		handler := chaos.Middleware(next)
+
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest("GET", "/istio-test/echo", nil))
+		assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+		assert.Equal(t, "chaos-error", w.Header().Get("X-Fault-Injected"))
+
+		w = httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest("GET", "/istio-test/health", nil))
+		assert.Equal(t, http.StatusOK, w.Code)
+	})
+
+	t.Run("latency rate", func(t *testing.T) {
+		withRand(t, 0.5)
+		options := ChaosOptions{LatencyRate: 0.4, LatencyP50: time.Millisecond, LatencyP99: 2 * time.Millisecond}
+
+		w := httptest.NewRecorder()
+		NewChaos(options).Middleware(next).ServeHTTP(w, httptest.NewRequest("GET", "/istio-test/echo", nil))
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Empty(t, w.Header().Get("X-Fault-Injected"))
+
+		options.LatencyRate = 1
+		w = httptest.NewRecorder()
+		NewChaos(options).Middleware(next).ServeHTTP(w, httptest.NewRequest("GET", "/istio-test/echo", nil))
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, "chaos-latency", w.Header().Get("X-Fault-Injected"))
+	})
+
+	t.Run("error rate changed while serving", func(t *testing.T) {
+		withRand(t, 0.5)
+		chaos := NewChaos(ChaosOptions{})
+		handler := chaos.Middleware(next)
+
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest("GET", "/istio-test/echo", nil))
+		assert.Equal(t, http.StatusOK, w.Code)
+
+		chaos.SetErrorRate(0.75)
+		assert.Equal(t, 0.75, chaos.ErrorRate())
+		w = httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest("GET", "/istio-test/echo", nil))
+		assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+	})
+}
@@ -0,0 +1,224 @@
+package fault
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"istio-test/internal/observability"
+)
+
+// EndpointMethods are the request methods the fault endpoints accept
+var EndpointMethods = []string{"GET", "HEAD", "POST"}
+
+// lastSegment returns the path segment following prefix, or false when the
+// path has no single segment after it
+func lastSegment(path, prefix string) (string, bool) {
+	value := strings.TrimSuffix(strings.TrimPrefix(path, prefix), "/")
+	if value == "" || strings.Contains(value, "/") {
+		return "", false
+	}
+	return value, true
+}
+
+// writeJSON writes a small JSON response
+func writeJSON(w http.ResponseWriter, r *http.Request, status int, response any) {
+	jsonData, err := json.Marshal(response)
+	if err != nil {
+		observability.ErrorWithContext(r.Context(), fmt.Sprintf("Error encoding fault response: %v", err))
+		http.Error(w, "Failed to encode response", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_, _ = w.Write(jsonData)
+}
+
+// parseDelay parses a delay between 0 and maxDelay; a bare number is taken
+// as seconds
+func parseDelay(value string, maxDelay time.Duration) (time.Duration, error) {
+	if _, err := strconv.ParseFloat(value, 64); err == nil {
+		value += "s"
+	}
+	delay, err := time.ParseDuration(value)
+	if err != nil || delay < 0 || delay > maxDelay {
+		return 0, fmt.Errorf("must be a duration between 0 and %v", maxDelay)
+	}
+	return delay, nil
+}
+
+// Query parameters of the status endpoint
+const (
+	StatusBodyParam   = "body"   // Literal response body, sent as text/plain unless a Content-Type header is requested
+	StatusHeaderParam = "header" // Response header as Name:Value, may be repeated
+)
+
+// forbiddenStatusHeaders are headers the status endpoint does not let
+// clients set, as they describe the framing of the response
+var forbiddenStatusHeaders = map[string]bool{
+	"Connection":        true,
+	"Content-Length":    true,
+	"Keep-Alive":        true,
+	"Trailer":           true,
+	"Transfer-Encoding": true,
+	"Upgrade":           true,
+}
+
+// weightedStatus is a status code and its share of the responses
+type weightedStatus struct {
+	code   int
+	weight float64
+}
+
+// parseStatusCodes parses a status code, a comma-separated list of codes
+// picked from at random, or weighted codes such as 200:0.9,503:0.1
+func parseStatusCodes(value string) ([]weightedStatus, error) {
+	var codes []weightedStatus
+	for _, part := range strings.Split(value, ",") {
+		codeValue, weightValue, weighted := strings.Cut(part, ":")
+		code, err := strconv.Atoi(codeValue)
+		if err != nil || code < 200 || code > 599 {
+			return nil, fmt.Errorf("status codes must be between 200 and 599")
+		}
+		weight := 1.0
+		if weighted {
+			weight, err = strconv.ParseFloat(weightValue, 64)
+			if err != nil || weight < 0 || math.IsInf(weight, 0) {
+				return nil, fmt.Errorf("weight of %d must be a non-negative number", code)
+			}
+		}
+		codes = append(codes, weightedStatus{code: code, weight: weight})
+	}
+	return codes, nil
+}
+
+// pickStatus picks one of codes with a probability proportional to its weight
+func pickStatus(codes []weightedStatus) int {
+	var total float64
+	for _, c := range codes {
+		total += c.weight
+	}
+	if total == 0 {
+		return codes[0].code
+	}
+	point := randFloat() * total
+	for _, c := range codes {
+		if point < c.weight {
+			return c.code
+		}
+		point -= c.weight
+	}
+	return codes[len(codes)-1].code
+}
+
+// parseStatusHeaders parses the header query parameters
+func parseStatusHeaders(values []string) (http.Header, error) {
+	headers := make(http.Header, len(values))
+	for _, value := range values {
+		name, headerValue, ok := strings.Cut(value, ":")
+		name = strings.TrimSpace(name)
+		if !ok || name == "" || strings.ContainsAny(name, " \t\r\n") || strings.ContainsAny(headerValue, "\r\n") {
+			return nil, fmt.Errorf("invalid header %q: expected Name:Value", value)
+		}
+		name = http.CanonicalHeaderKey(name)
+		if forbiddenStatusHeaders[name] {
+			return nil, fmt.Errorf("header %s cannot be set", name)
+		}
+		headers.Add(name, strings.TrimSpace(headerValue))
+	}
+	return headers, nil
+}
+
+// StatusHandler responds with the status code in the last path segment, e.g.
+// /istio-test/status/503, httpbin style. The segment may list several codes
+// to pick from at random, optionally weighted: 200:0.9,503:0.1. The body and
+// header query parameters set the response body and headers, to drive retryOn
+// conditions, outlier ejection and gateway error pages.
+func StatusHandler(prefix string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		value, ok := lastSegment(r.URL.Path, prefix)
+		if !ok {
+			http.Error(w, "Invalid request: expected "+prefix+"{code}", http.StatusBadRequest)
+			return
+		}
+		codes, err := parseStatusCodes(value)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Invalid status code: %v", err), http.StatusBadRequest)
+			return
+		}
+		headers, err := parseStatusHeaders(r.URL.Query()[StatusHeaderParam])
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Invalid request: %v", err), http.StatusBadRequest)
+			return
+		}
+		status := pickStatus(codes)
+
+		injections.WithLabelValues("endpoint", "error").Inc()
+		for name, values := range headers {
+			w.Header()[name] = values
+		}
+		w.Header().Set("X-Fault-Injected", "endpoint-status")
+
+		if !r.URL.Query().Has(StatusBodyParam) {
+			writeJSON(w, r, status, map[string]any{"status": status, "text": http.StatusText(status)})
+			return
+		}
+		if w.Header().Get("Content-Type") == "" {
+			w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		}
+		w.WriteHeader(status)
+		_, _ = w.Write([]byte(r.URL.Query().Get(StatusBodyParam)))
+	}
+}
+
+// DelayHandler responds 200 after the delay in the last path segment, e.g.
+// /istio-test/fault/delay/2s; a bare number is taken as seconds
+func DelayHandler(prefix string, maxDelay time.Duration) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		value, ok := lastSegment(r.URL.Path, prefix)
+		if !ok {
+			http.Error(w, "Invalid request: expected "+prefix+"{duration}", http.StatusBadRequest)
+			return
+		}
+		delay, err := parseDelay(value, maxDelay)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Invalid delay: %v", err), http.StatusBadRequest)
+			return
+		}
+
+		injections.WithLabelValues("endpoint", "latency").Inc()
+		timer := time.NewTimer(delay)
+		select {
+		case <-r.Context().Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+
+		w.Header().Set("X-Fault-Injected", "endpoint-delay")
+		writeJSON(w, r, http.StatusOK, map[string]any{"delay": delay.String()})
+	}
+}
+
+// AbortHandler drops the connection without a response. HTTP/1 connections
+// are reset; HTTP/2 streams are reset by the server.
+func AbortHandler(w http.ResponseWriter, r *http.Request) {
+	injections.WithLabelValues("endpoint", "abort").Inc()
+
+	// The response controller reaches the connection through middleware
+	// writers that implement Unwrap
+	if conn, _, err := http.NewResponseController(w).Hijack(); err == nil {
+		// Discard unsent data and send RST instead of FIN
+		if tcpConn, ok := conn.(*net.TCPConn); ok {
+			_ = tcpConn.SetLinger(0)
+		}
+		_ = conn.Close()
+		return
+	}
+	panic(http.ErrAbortHandler)
+}
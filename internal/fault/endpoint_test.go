@@ -0,0 +1,174 @@
+package fault
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"istio-test/internal/cache"
+	"istio-test/internal/compress"
+	"istio-test/internal/deadline"
+	"istio-test/internal/observability"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStatusHandler(t *testing.T) {
+	handler := StatusHandler("/istio-test/fault/status/")
+
+	tests := []struct {
+		path     string
+		expected int
+	}{
+		{path: "/istio-test/fault/status/503", expected: http.StatusServiceUnavailable},
+		{path: "/istio-test/fault/status/429/", expected: http.StatusTooManyRequests},
+		{path: "/istio-test/fault/status/200", expected: http.StatusOK},
+		{path: "/istio-test/fault/status/", expected: http.StatusBadRequest},
+		{path: "/istio-test/fault/status/abc", expected: http.StatusBadRequest},
+		{path: "/istio-test/fault/status/700", expected: http.StatusBadRequest},
+		{path: "/istio-test/fault/status/503/extra", expected: http.StatusBadRequest},
+		{path: "/istio-test/fault/status/200,700", expected: http.StatusBadRequest},
+		{path: "/istio-test/fault/status/503:-1", expected: http.StatusBadRequest},
+		{path: "/istio-test/fault/status/503?header=Retry-After", expected: http.StatusBadRequest},
+		{path: "/istio-test/fault/status/503?header=Content-Length:0", expected: http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			handler(w, httptest.NewRequest("GET", tt.path, nil))
+			assert.Equal(t, tt.expected, w.Code)
+		})
+	}
+}
+
+func TestStatusHandlerBodyAndHeaders(t *testing.T) {
+	handler := StatusHandler("/istio-test/status/")
+
+	w := httptest.NewRecorder()
+	handler(w, httptest.NewRequest("GET", "/istio-test/status/503?body=upstream+down&header=Retry-After:5&header=x-custom:a&header=X-Custom:b", nil))
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+	assert.Equal(t, "upstream down", w.Body.String())
+	assert.Equal(t, "text/plain; charset=utf-8", w.Header().Get("Content-Type"))
+	assert.Equal(t, "5", w.Header().Get("Retry-After"))
+	assert.Equal(t, []string{"a", "b"}, w.Header().Values("X-Custom"))
+
+	w = httptest.NewRecorder()
+	handler(w, httptest.NewRequest("GET", "/istio-test/status/404?body=%3Ch1%3EGone%3C%2Fh1%3E&header=Content-Type:text/html", nil))
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	assert.Equal(t, "<h1>Gone</h1>", w.Body.String())
+	assert.Equal(t, "text/html", w.Header().Get("Content-Type"))
+
+	w = httptest.NewRecorder()
+	handler(w, httptest.NewRequest("GET", "/istio-test/status/502", nil))
+	assert.Equal(t, http.StatusBadGateway, w.Code)
+	assert.JSONEq(t, `{"status": 502, "text": "Bad Gateway"}`, w.Body.String())
+}
+
+func TestStatusHandlerWeightedCodes(t *testing.T) {
+	handler := StatusHandler("/istio-test/status/")
+
+	tests := []struct {
+		path     string
+		rand     float64
+		expected int
+	}{
+		{path: "/istio-test/status/200:0.9,503:0.1", rand: 0.5, expected: http.StatusOK},
+		{path: "/istio-test/status/200:0.9,503:0.1", rand: 0.95, expected: http.StatusServiceUnavailable},
+		{path: "/istio-test/status/500,502,503", rand: 0.5, expected: http.StatusBadGateway},
+		{path: "/istio-test/status/500:0,503:0", rand: 0.5, expected: http.StatusInternalServerError},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			withRand(t, tt.rand)
+			w := httptest.NewRecorder()
+			handler(w, httptest.NewRequest("GET", tt.path, nil))
+			assert.Equal(t, tt.expected, w.Code)
+		})
+	}
+}
+
+func TestDelayHandler(t *testing.T) {
+	handler := DelayHandler("/istio-test/fault/delay/", time.Second)
+
+	tests := []struct {
+		path     string
+		expected int
+	}{
+		{path: "/istio-test/fault/delay/10ms", expected: http.StatusOK},
+		{path: "/istio-test/fault/delay/0.01", expected: http.StatusOK},
+		{path: "/istio-test/fault/delay/2s", expected: http.StatusBadRequest},
+		{path: "/istio-test/fault/delay/-1s", expected: http.StatusBadRequest},
+		{path: "/istio-test/fault/delay/soon", expected: http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			handler(w, httptest.NewRequest("GET", tt.path, nil))
+			assert.Equal(t, tt.expected, w.Code)
+		})
+	}
+
+	t.Run("waits for the delay", func(t *testing.T) {
+		start := time.Now()
+		w := httptest.NewRecorder()
+		handler(w, httptest.NewRequest("GET", "/istio-test/fault/delay/50ms", nil))
+		assert.GreaterOrEqual(t, time.Since(start), 50*time.Millisecond)
+		assert.Equal(t, "endpoint-delay", w.Header().Get("X-Fault-Injected"))
+	})
+}
+
+func TestAbortHandler(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(AbortHandler))
+	defer ts.Close()
+
+	resp, err := http.Get(ts.URL)
+	if resp != nil {
+		resp.Body.Close()
+	}
+	require.Error(t, err)
+}
+
+func TestAbortHandlerThroughMiddleware(t *testing.T) {
+	// The writers of the server's middleware chain wrap the connection's writer
+	var handler http.Handler = http.HandlerFunc(AbortHandler)
+	handler = cache.NewHeaderPolicy().Middleware(handler)
+	handler = compress.Middleware(handler, compress.Options{})
+	handler = deadline.Middleware(handler)
+	handler = observability.MetricsMiddleware(handler, func(r *http.Request) string { return r.URL.Path })
+	handler = observability.RequestLoggingMiddleware(handler)
+
+	panicked := make(chan bool, 1)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		defer func() {
+			recovered := recover()
+			panicked <- recovered != nil
+			if recovered != nil {
+				panic(recovered)
+			}
+		}()
+		handler.ServeHTTP(w, r)
+	}))
+	defer ts.Close()
+
+	req, err := http.NewRequest(http.MethodGet, ts.URL+"/istio-test/fault/abort", nil)
+	require.NoError(t, err)
+	req.Header.Set("Accept-Encoding", "gzip")
+	req.Header.Set(deadline.EnvoyExpectedTimeoutHeader, "5000")
+	resp, err := http.DefaultClient.Do(req)
+	if resp != nil {
+		resp.Body.Close()
+	}
+	require.Error(t, err)
+	assert.False(t, <-panicked, "the connection is hijacked instead of aborting the handler")
+}
+
+func TestAbortHandlerWithoutHijacker(t *testing.T) {
+	assert.PanicsWithValue(t, http.ErrAbortHandler, func() {
+		AbortHandler(httptest.NewRecorder(), httptest.NewRequest("GET", "/istio-test/fault/abort", nil))
+	})
+}
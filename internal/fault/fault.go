@@ -0,0 +1,96 @@
+// Package fault injects artificial latency and errors into served requests.
+//
+// Faults are used to create deterministic or statistical upstream degradation
+// for locality failover, outlier detection, retry and timeout experiments. They
+// are applied per zone, at random in chaos mode, on the timetable of a plan, on
+// demand through the status, delay and abort endpoints, or per request through
+// the X-Istio-Test-Delay header.
+// Every injected fault is counted in the istio_test_fault_injections_total
+// metric and marked on the response with an X-Fault-Injected header.
+package fault
+
+import (
+	"math/rand/v2"
+	"net/http"
+	"strings"
+	"time"
+
+	"istio-test/internal/observability"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Fault describes the degradation applied to a request
+type Fault struct {
+	Latency     time.Duration `json:"latency"`      // Added before the request is served
+	ErrorRate   float64       `json:"error_rate"`   // Probability (0-1) of answering with ErrorStatus
+	ErrorStatus int           `json:"error_status"` // Status of injected errors, defaults to 503
+}
+
+// Active reports whether the fault changes request handling at all
+func (f Fault) Active() bool {
+	return f.Latency > 0 || f.ErrorRate > 0
+}
+
+var injections = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Namespace: "istio_test",
+	Name:      "fault_injections_total",
+	Help:      "Total number of injected faults by source and type.",
+}, []string{"source", "type"})
+
+func init() {
+	observability.MetricsRegistry().MustRegister(injections)
+}
+
+// randFloat returns a pseudo-random number in [0, 1); replaced in tests
+var randFloat = rand.Float64
+
+// apply injects f into the request. It returns true when the response has been
+// written, either with an injected error or because the client went away while
+// the latency was applied.
+func apply(w http.ResponseWriter, r *http.Request, f Fault, source string) bool {
+	if f.Latency > 0 {
+		injections.WithLabelValues(source, "latency").Inc()
+		w.Header().Add("X-Fault-Injected", source+"-latency")
+
+		timer := time.NewTimer(f.Latency)
+		select {
+		case <-r.Context().Done():
+			timer.Stop()
+			return true
+		case <-timer.C:
+		}
+	}
+
+	if f.ErrorRate > 0 && randFloat() < f.ErrorRate {
+		status := f.ErrorStatus
+		if status == 0 {
+			status = http.StatusServiceUnavailable
+		}
+		injections.WithLabelValues(source, "error").Inc()
+		w.Header().Add("X-Fault-Injected", source+"-error")
+		http.Error(w, "Injected fault: "+http.StatusText(status), status)
+		return true
+	}
+
+	return false
+}
+
+// matchesRoute reports whether path is covered by routes (all paths when empty)
+// and not covered by exclude
+func matchesRoute(path string, routes, exclude []string) bool {
+	for _, prefix := range exclude {
+		if strings.HasPrefix(path, prefix) {
+			return false
+		}
+	}
+	if len(routes) == 0 {
+		return true
+	}
+	for _, prefix := range routes {
+		if strings.HasPrefix(path, prefix) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,80 @@
+package fault
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+// withRand makes randFloat return value for the duration of the test
+func withRand(t *testing.T, value float64) {
+	original := randFloat
+	randFloat = func() float64 { return value }
+	t.Cleanup(func() { randFloat = original })
+}
+
+func TestFaultActive(t *testing.T) {
+	assert.False(t, Fault{}.Active())
+	assert.False(t, Fault{ErrorStatus: 500}.Active())
+	assert.True(t, Fault{Latency: time.Millisecond}.Active())
+	assert.True(t, Fault{ErrorRate: 0.1}.Active())
+}
+
+func TestApply(t *testing.T) {
+	t.Run("error below rate", func(t *testing.T) {
+		withRand(t, 0.2)
+		before := testutil.ToFloat64(injections.WithLabelValues("test", "error"))
+
+		w := httptest.NewRecorder()
+		written := apply(w, httptest.NewRequest("GET", "/", nil), Fault{ErrorRate: 0.5}, "test")
+
+		assert.True(t, written)
+		assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+		assert.Equal(t, "test-error", w.Header().Get("X-Fault-Injected"))
+		assert.Equal(t, before+1, testutil.ToFloat64(injections.WithLabelValues("test", "error")))
+	})
+
+	t.Run("no error above rate", func(t *testing.T) {
+		withRand(t, 0.8)
+		w := httptest.NewRecorder()
+		assert.False(t, apply(w, httptest.NewRequest("GET", "/", nil), Fault{ErrorRate: 0.5, ErrorStatus: 500}, "test"))
+		assert.Empty(t, w.Header().Get("X-Fault-Injected"))
+	})
+
+	t.Run("custom error status", func(t *testing.T) {
+		withRand(t, 0)
+		w := httptest.NewRecorder()
+		apply(w, httptest.NewRequest("GET", "/", nil), Fault{ErrorRate: 1, ErrorStatus: http.StatusTooManyRequests}, "test")
+		assert.Equal(t, http.StatusTooManyRequests, w.Code)
+	})
+
+	t.Run("latency", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		start := time.Now()
+		assert.False(t, apply(w, httptest.NewRequest("GET", "/", nil), Fault{Latency: 20 * time.Millisecond}, "test"))
+		assert.GreaterOrEqual(t, time.Since(start), 20*time.Millisecond)
+		assert.Equal(t, "test-latency", w.Header().Get("X-Fault-Injected"))
+	})
+
+	t.Run("latency stops when the client goes away", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		req := httptest.NewRequest("GET", "/", nil).WithContext(ctx)
+
+		start := time.Now()
+		assert.True(t, apply(httptest.NewRecorder(), req, Fault{Latency: time.Minute}, "test"))
+		assert.Less(t, time.Since(start), time.Second)
+	})
+}
+
+func TestMatchesRoute(t *testing.T) {
+	assert.True(t, matchesRoute("/anything", nil, nil))
+	assert.True(t, matchesRoute("/istio-test/metadata/cluster-name", []string{"/istio-test/"}, []string{"/istio-test/health"}))
+	assert.False(t, matchesRoute("/istio-test/health/basic", []string{"/istio-test/"}, []string{"/istio-test/health"}))
+	assert.False(t, matchesRoute("/metrics", []string{"/istio-test/"}, nil))
+}
@@ -0,0 +1,56 @@
+package fault
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// DelayHeader asks for latency on any endpoint, e.g. "500ms"; a bare number
+// is taken as seconds
+const DelayHeader = "X-Istio-Test-Delay"
+
+// DelayParam is the query parameter equivalent of DelayHeader. Endpoints
+// taking a delay of their own name it differently, such as the chunk_delay
+// of /istio-test/bytes, so the two never collide.
+const DelayParam = "delay"
+
+// RequestDelay lets clients add latency to any request through DelayHeader or
+// DelayParam, so upstream latency can be shaped per request when validating
+// timeout and retry budgets without a dedicated endpoint per scenario
+type RequestDelay struct {
+	maxDelay      time.Duration
+	excludeRoutes []string
+}
+
+// NewRequestDelay creates a request delay accepting delays up to maxDelay on
+// every path except those under excludeRoutes
+func NewRequestDelay(maxDelay time.Duration, excludeRoutes []string) *RequestDelay {
+	return &RequestDelay{maxDelay: maxDelay, excludeRoutes: excludeRoutes}
+}
+
+// Middleware sleeps for the requested delay before next serves the request.
+// The header takes precedence over the query parameter; an invalid or too
+// long delay is rejected with 400.
+func (d *RequestDelay) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		value := r.Header.Get(DelayHeader)
+		if value == "" {
+			value = r.URL.Query().Get(DelayParam)
+		}
+		if value == "" || !matchesRoute(r.URL.Path, nil, d.excludeRoutes) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		delay, err := parseDelay(value, d.maxDelay)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Invalid %s: %v", DelayHeader, err), http.StatusBadRequest)
+			return
+		}
+		if apply(w, r, Fault{Latency: delay}, "request") {
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,51 @@
+package fault
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRequestDelay(t *testing.T) {
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+	handler := NewRequestDelay(time.Second, []string{"/admin/"}).Middleware(next)
+
+	tests := []struct {
+		name     string
+		target   string
+		header   string
+		status   int
+		minDelay time.Duration
+		injected string
+	}{
+		{name: "no delay", target: "/", status: http.StatusOK},
+		{name: "header", target: "/", header: "50ms", status: http.StatusOK, minDelay: 50 * time.Millisecond, injected: "request-latency"},
+		{name: "query parameter", target: "/?delay=0.05", status: http.StatusOK, minDelay: 50 * time.Millisecond, injected: "request-latency"},
+		{name: "header wins over query", target: "/?delay=10s", header: "1ms", status: http.StatusOK, injected: "request-latency"},
+		{name: "endpoint chunk delay is left alone", target: "/istio-test/bytes/100?chunk_delay=10s", status: http.StatusOK},
+		{name: "above maximum", target: "/", header: "2s", status: http.StatusBadRequest},
+		{name: "invalid", target: "/", header: "soon", status: http.StatusBadRequest},
+		{name: "excluded route", target: "/admin/plan", header: "soon", status: http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, tt.target, nil)
+			if tt.header != "" {
+				req.Header.Set(DelayHeader, tt.header)
+			}
+			w := httptest.NewRecorder()
+
+			start := time.Now()
+			handler.ServeHTTP(w, req)
+			assert.Equal(t, tt.status, w.Code)
+			assert.GreaterOrEqual(t, time.Since(start), tt.minDelay)
+			assert.Equal(t, tt.injected, w.Header().Get("X-Fault-Injected"))
+		})
+	}
+}
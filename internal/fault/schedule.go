@@ -0,0 +1,259 @@
+package fault
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"istio-test/internal/observability"
+)
+
+const (
+	maxPlanBytes   = 64 << 10        // Maximum size of an uploaded plan
+	maxPlanSteps   = 100             // Maximum number of steps in a plan
+	maxPlanOffset  = 24 * time.Hour  // Latest step start relative to the plan start
+	maxStepLatency = 5 * time.Minute // Upper bound for the latency of a step
+)
+
+// Step is a bad state the pod is flipped into for part of a plan
+type Step struct {
+	At          string  `json:"at" schema:"required,format=duration"`    // Offset from the plan start, e.g. "5m"
+	For         string  `json:"for" schema:"format=duration"`            // How long the state lasts, defaults to "1m"
+	Latency     string  `json:"latency" schema:"format=duration"`        // Latency added to each request, e.g. "2s"
+	ErrorRate   float64 `json:"error_rate" schema:"minimum=0,maximum=1"` // Probability (0-1) of answering with ErrorStatus
+	ErrorStatus int     `json:"error_status" schema:"maximum=599"`       // Status of injected errors, defaults to 503
+}
+
+// Plan is a timetable of bad states, e.g. 50% 503s from minute 5 to 7 and 2s
+// latency in minute 10. Overlapping steps are resolved in plan order.
+type Plan struct {
+	Steps         []Step   `json:"steps" schema:"required,maxItems=100"`
+	Loop          bool     `json:"loop"`           // Restart the timetable once the last step ends
+	Routes        []string `json:"routes"`         // Path prefixes the plan applies to, all paths when empty
+	ExcludeRoutes []string `json:"exclude_routes"` // Path prefixes never degraded
+}
+
+// scheduledStep is a validated step
+type scheduledStep struct {
+	start time.Duration
+	end   time.Duration
+	fault Fault
+}
+
+// compile validates the plan and returns its steps and total length
+func (p Plan) compile() ([]scheduledStep, time.Duration, error) {
+	if len(p.Steps) == 0 {
+		return nil, 0, errors.New("plan has no steps")
+	}
+	if len(p.Steps) > maxPlanSteps {
+		return nil, 0, fmt.Errorf("at most %d steps are allowed", maxPlanSteps)
+	}
+	for _, route := range slices.Concat(p.Routes, p.ExcludeRoutes) {
+		if !strings.HasPrefix(route, "/") {
+			return nil, 0, fmt.Errorf("invalid route %q: must start with /", route)
+		}
+	}
+
+	steps := make([]scheduledStep, 0, len(p.Steps))
+	var length time.Duration
+	for i, step := range p.Steps {
+		start, err := time.ParseDuration(step.At)
+		if err != nil || start < 0 || start > maxPlanOffset {
+			return nil, 0, fmt.Errorf("step %d: at must be a duration between 0 and %v", i, maxPlanOffset)
+		}
+
+		duration := time.Minute
+		if step.For != "" {
+			duration, err = time.ParseDuration(step.For)
+			if err != nil || duration <= 0 || duration > maxPlanOffset {
+				return nil, 0, fmt.Errorf("step %d: for must be a duration between 0 and %v", i, maxPlanOffset)
+			}
+		}
+
+		var latency time.Duration
+		if step.Latency != "" {
+			latency, err = time.ParseDuration(step.Latency)
+			if err != nil || latency < 0 || latency > maxStepLatency {
+				return nil, 0, fmt.Errorf("step %d: latency must be a duration between 0 and %v", i, maxStepLatency)
+			}
+		}
+		if step.ErrorRate < 0 || step.ErrorRate > 1 {
+			return nil, 0, fmt.Errorf("step %d: error_rate must be between 0 and 1", i)
+		}
+		if step.ErrorStatus != 0 && (step.ErrorStatus < 400 || step.ErrorStatus > 599) {
+			return nil, 0, fmt.Errorf("step %d: error_status must be between 400 and 599", i)
+		}
+
+		f := Fault{Latency: latency, ErrorRate: step.ErrorRate, ErrorStatus: step.ErrorStatus}
+		if !f.Active() {
+			return nil, 0, fmt.Errorf("step %d: latency or error_rate must be set", i)
+		}
+
+		steps = append(steps, scheduledStep{start: start, end: start + duration, fault: f})
+		length = max(length, start+duration)
+	}
+
+	return steps, length, nil
+}
+
+// Scheduler flips the pod into the bad states of a plan on its timetable
+type Scheduler struct {
+	mu            sync.RWMutex
+	plan          *Plan
+	steps         []scheduledStep
+	length        time.Duration
+	startedAt     time.Time
+	excludeRoutes []string
+	now           func() time.Time
+}
+
+// NewScheduler creates an idle scheduler. excludeRoutes are never degraded by
+// any plan, so the plan endpoint itself stays reachable.
+func NewScheduler(excludeRoutes []string) *Scheduler {
+	return &Scheduler{excludeRoutes: excludeRoutes, now: time.Now}
+}
+
+// Load validates plan and starts its timetable now, replacing any running plan
+func (s *Scheduler) Load(plan Plan) error {
+	steps, length, err := plan.compile()
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.plan = &plan
+	s.steps = steps
+	s.length = length
+	s.startedAt = s.now()
+	return nil
+}
+
+// Clear stops the running plan
+func (s *Scheduler) Clear() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.plan = nil
+	s.steps = nil
+}
+
+// snapshot is the state of the scheduler at one point in time
+type snapshot struct {
+	plan      *Plan
+	startedAt time.Time
+	elapsed   time.Duration // Time into the current pass of the timetable
+	finished  bool
+	index     int // Index of the active step, -1 when none
+	fault     Fault
+}
+
+// current returns the state of the scheduler now
+func (s *Scheduler) current() snapshot {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	state := snapshot{plan: s.plan, startedAt: s.startedAt, index: -1}
+	if s.plan == nil {
+		return state
+	}
+	state.elapsed = s.now().Sub(s.startedAt)
+	if s.plan.Loop {
+		state.elapsed %= s.length
+	}
+	state.finished = state.elapsed >= s.length
+	for i, step := range s.steps {
+		if state.elapsed >= step.start && state.elapsed < step.end {
+			state.index = i
+			state.fault = step.fault
+			break
+		}
+	}
+	return state
+}
+
+// Middleware applies the fault of the active step to matching requests
+func (s *Scheduler) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		state := s.current()
+		if state.index >= 0 && matchesRoute(r.URL.Path, state.plan.Routes, slices.Concat(s.excludeRoutes, state.plan.ExcludeRoutes)) &&
+			apply(w, r, state.fault, "schedule") {
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// PlanStatus is the state of the scheduler reported by the plan endpoint
+type PlanStatus struct {
+	State      string     `json:"state"` // idle, running or finished
+	Plan       *Plan      `json:"plan,omitempty"`
+	StartedAt  *time.Time `json:"started_at,omitempty"`
+	Elapsed    string     `json:"elapsed,omitempty"`     // Time into the current pass of the timetable
+	ActiveStep *int       `json:"active_step,omitempty"` // Index of the step currently applied
+}
+
+// Status returns the state of the scheduler
+func (s *Scheduler) Status() PlanStatus {
+	state := s.current()
+	if state.plan == nil {
+		return PlanStatus{State: "idle"}
+	}
+
+	startedAt := state.startedAt.UTC()
+	status := PlanStatus{State: "running", Plan: state.plan, StartedAt: &startedAt, Elapsed: state.elapsed.Round(time.Millisecond).String()}
+	if state.finished {
+		status.State = "finished"
+	}
+	if state.index >= 0 {
+		status.ActiveStep = &state.index
+	}
+	return status
+}
+
+// Handler serves the plan endpoint: GET reports the status, PUT uploads and
+// starts a plan and DELETE stops it
+func (s *Scheduler) Handler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodPut:
+			var plan Plan
+			decoder := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxPlanBytes))
+			decoder.DisallowUnknownFields()
+			if err := decoder.Decode(&plan); err != nil {
+				var maxBytesErr *http.MaxBytesError
+				if errors.As(err, &maxBytesErr) {
+					http.Error(w, fmt.Sprintf("Plan exceeds %d bytes", maxPlanBytes), http.StatusRequestEntityTooLarge)
+					return
+				}
+				http.Error(w, fmt.Sprintf("Invalid plan: %v", err), http.StatusBadRequest)
+				return
+			}
+			if decoder.More() {
+				http.Error(w, "Invalid plan: unexpected data after JSON object", http.StatusBadRequest)
+				return
+			}
+			if err := s.Load(plan); err != nil {
+				http.Error(w, fmt.Sprintf("Invalid plan: %v", err), http.StatusBadRequest)
+				return
+			}
+			observability.InfoWithContext(r.Context(), fmt.Sprintf("Fault plan with %d steps started", len(plan.Steps)))
+		case http.MethodDelete:
+			s.Clear()
+			observability.InfoWithContext(r.Context(), "Fault plan cleared")
+		}
+
+		jsonData, err := json.Marshal(s.Status())
+		if err != nil {
+			http.Error(w, "Failed to encode plan status", http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		_, _ = w.Write(jsonData)
+	}
+}
@@ -0,0 +1,143 @@
+package fault
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newTestScheduler returns a scheduler whose clock is advanced by the returned function
+func newTestScheduler(excludeRoutes []string) (*Scheduler, func(time.Duration)) {
+	s := NewScheduler(excludeRoutes)
+	now := time.Now()
+	s.now = func() time.Time { return now }
+	return s, func(d time.Duration) { now = now.Add(d) }
+}
+
+func TestPlanCompile(t *testing.T) {
+	tests := []struct {
+		name        string
+		plan        Plan
+		expectError bool
+	}{
+		{name: "valid", plan: Plan{Steps: []Step{{At: "5m", For: "2m", ErrorRate: 0.5}, {At: "10m", Latency: "2s"}}}},
+		{name: "no steps", plan: Plan{}, expectError: true},
+		{name: "missing at", plan: Plan{Steps: []Step{{ErrorRate: 0.5}}}, expectError: true},
+		{name: "negative for", plan: Plan{Steps: []Step{{At: "0s", For: "-1m", ErrorRate: 0.5}}}, expectError: true},
+		{name: "latency too high", plan: Plan{Steps: []Step{{At: "0s", Latency: "10m"}}}, expectError: true},
+		{name: "invalid error rate", plan: Plan{Steps: []Step{{At: "0s", ErrorRate: 2}}}, expectError: true},
+		{name: "invalid error status", plan: Plan{Steps: []Step{{At: "0s", ErrorRate: 1, ErrorStatus: 200}}}, expectError: true},
+		{name: "inactive step", plan: Plan{Steps: []Step{{At: "0s"}}}, expectError: true},
+		{name: "invalid route", plan: Plan{Steps: []Step{{At: "0s", ErrorRate: 1}}, Routes: []string{"api"}}, expectError: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, _, err := tt.plan.compile()
+			if tt.expectError {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestSchedulerTimetable(t *testing.T) {
+	withRand(t, 0)
+	s, advance := newTestScheduler(nil)
+	require.NoError(t, s.Load(Plan{Steps: []Step{
+		{At: "5m", For: "2m", ErrorRate: 0.5, ErrorStatus: 503},
+		{At: "10m", Latency: "1ms"},
+	}}))
+
+	serve := func() *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		s.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusOK)
+		})).ServeHTTP(w, httptest.NewRequest("GET", "/istio-test/metadata/cluster-name", nil))
+		return w
+	}
+
+	assert.Equal(t, http.StatusOK, serve().Code)
+	assert.Equal(t, "running", s.Status().State)
+	assert.Nil(t, s.Status().ActiveStep)
+
+	advance(6 * time.Minute)
+	assert.Equal(t, http.StatusServiceUnavailable, serve().Code)
+	assert.Equal(t, 0, *s.Status().ActiveStep)
+
+	advance(4*time.Minute + 30*time.Second)
+	w := serve()
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "schedule-latency", w.Header().Get("X-Fault-Injected"))
+
+	advance(time.Minute)
+	assert.Equal(t, http.StatusOK, serve().Code)
+	assert.Equal(t, "finished", s.Status().State)
+
+	s.Clear()
+	assert.Equal(t, "idle", s.Status().State)
+}
+
+func TestSchedulerLoop(t *testing.T) {
+	s, advance := newTestScheduler(nil)
+	require.NoError(t, s.Load(Plan{Loop: true, Steps: []Step{{At: "1m", ErrorRate: 1}}}))
+
+	advance(2*time.Minute + 90*time.Second)
+	status := s.Status()
+	assert.Equal(t, "running", status.State)
+	require.NotNil(t, status.ActiveStep)
+	assert.Equal(t, 0, *status.ActiveStep)
+}
+
+func TestSchedulerExcludeRoutes(t *testing.T) {
+	s, _ := newTestScheduler([]string{"/admin/"})
+	require.NoError(t, s.Load(Plan{Steps: []Step{{At: "0s", ErrorRate: 1}}, ExcludeRoutes: []string{"/istio-test/health"}}))
+
+	handler := s.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	for path, expected := range map[string]int{
+		"/admin/plan":          http.StatusOK,
+		"/istio-test/health":   http.StatusOK,
+		"/istio-test/metadata": http.StatusServiceUnavailable,
+	} {
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest("GET", path, nil))
+		assert.Equal(t, expected, w.Code, path)
+	}
+}
+
+func TestSchedulerHandler(t *testing.T) {
+	s, _ := newTestScheduler(nil)
+	handler := s.Handler()
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest("PUT", "/admin/plan", strings.NewReader(`{"steps":[{"at":"0s","for":"1m","error_rate":0.5}]}`)))
+	require.Equal(t, http.StatusOK, w.Code)
+
+	var status PlanStatus
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &status))
+	assert.Equal(t, "running", status.State)
+	require.NotNil(t, status.ActiveStep)
+	assert.Equal(t, 0, *status.ActiveStep)
+
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest("PUT", "/admin/plan", strings.NewReader(`{"steps":[{"at":"0s","error_rate":0.5}],"unknown":1}`)))
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest("PUT", "/admin/plan", strings.NewReader(`{"steps":[]}`)))
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Equal(t, "running", s.Status().State, "an invalid plan must not replace the running one")
+
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest("DELETE", "/admin/plan", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"state":"idle"`)
+}
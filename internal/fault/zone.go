@@ -0,0 +1,102 @@
+package fault
+
+import (
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// ZoneSkewOptions configures degradation applied only in selected zones, so a
+// single deployment spec produces asymmetric behavior across localities
+type ZoneSkewOptions struct {
+	Zones         []string // Zones ("us-east1-b") or regions ("us-east1") that are degraded
+	Fault         Fault    // Degradation applied in those zones
+	Routes        []string // Path prefixes the fault applies to, all paths when empty
+	ExcludeRoutes []string // Path prefixes never degraded, e.g. health probes
+}
+
+// MatchesZone reports whether zone is listed in zones, either directly or
+// through its region
+func MatchesZone(zones []string, zone string) bool {
+	zone = strings.ToLower(zone)
+	if zone == "" {
+		return false
+	}
+	for _, entry := range zones {
+		entry = strings.ToLower(entry)
+		if zone == entry || strings.HasPrefix(zone, entry+"-") {
+			return true
+		}
+	}
+	return false
+}
+
+// ZoneSkew applies ZoneSkewOptions to the pod serving in zone. The fault can
+// be changed while serving so experiments can be adjusted mid-run.
+type ZoneSkew struct {
+	options ZoneSkewOptions
+	active  bool
+	mu      sync.Mutex // Serializes changes to fault
+	fault   atomic.Pointer[Fault]
+}
+
+// NewZoneSkew creates the zone skew of the pod serving in zone
+func NewZoneSkew(zone string, options ZoneSkewOptions) *ZoneSkew {
+	s := &ZoneSkew{options: options, active: MatchesZone(options.Zones, zone)}
+	f := options.Fault
+	s.fault.Store(&f)
+	return s
+}
+
+// Active reports whether the serving pod runs in one of the degraded zones
+func (s *ZoneSkew) Active() bool {
+	return s.active
+}
+
+// Fault returns the degradation currently applied in the degraded zones
+func (s *ZoneSkew) Fault() Fault {
+	return *s.fault.Load()
+}
+
+// SetFault replaces the degradation applied in the degraded zones
+func (s *ZoneSkew) SetFault(f Fault) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.fault.Store(&f)
+}
+
+// ErrorRate returns the probability (0-1) of answering with an injected error
+func (s *ZoneSkew) ErrorRate() float64 {
+	return s.fault.Load().ErrorRate
+}
+
+// SetErrorRate changes the probability (0-1) of answering with an injected error
+func (s *ZoneSkew) SetErrorRate(rate float64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	f := *s.fault.Load()
+	f.ErrorRate = rate
+	s.fault.Store(&f)
+}
+
+// Middleware applies the fault when the serving pod runs in one of the
+// degraded zones; otherwise next is returned unchanged
+func (s *ZoneSkew) Middleware(next http.Handler) http.Handler {
+	if !s.active {
+		return next
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if f := s.Fault(); f.Active() && matchesRoute(r.URL.Path, s.options.Routes, s.options.ExcludeRoutes) && apply(w, r, f, "zone") {
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// ZoneSkewMiddleware applies the configured fault when the serving pod runs in
+// one of the degraded zones; otherwise next is returned unchanged
+func ZoneSkewMiddleware(zone string, options ZoneSkewOptions, next http.Handler) http.Handler {
+	return NewZoneSkew(zone, options).Middleware(next)
+}
@@ -0,0 +1,105 @@
+package fault
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMatchesZone(t *testing.T) {
+	zones := []string{"us-east1-b", "europe-west1"}
+
+	assert.True(t, MatchesZone(zones, "us-east1-b"))
+	assert.True(t, MatchesZone(zones, "US-EAST1-B"))
+	assert.True(t, MatchesZone(zones, "europe-west1-c"))
+	assert.False(t, MatchesZone(zones, "us-east1-c"))
+	assert.False(t, MatchesZone(zones, "europe-west12-a"))
+	assert.False(t, MatchesZone(zones, ""))
+	assert.False(t, MatchesZone(nil, "us-east1-b"))
+}
+
+func TestZoneSkewMiddleware(t *testing.T) {
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	})
+	options := ZoneSkewOptions{
+		Zones:         []string{"us-east1"},
+		Fault:         Fault{ErrorRate: 1},
+		Routes:        []string{"/istio-test/"},
+		ExcludeRoutes: []string{"/istio-test/health"},
+	}
+
+	t.Run("other zones are untouched", func(t *testing.T) {
+		handler := ZoneSkewMiddleware("us-west1-a", options, next)
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest("GET", "/istio-test/metadata/cluster-name", nil))
+		assert.Equal(t, http.StatusOK, w.Code)
+	})
+
+	t.Run("degraded zone", func(t *testing.T) {
+		withRand(t, 0.5)
+		handler := ZoneSkewMiddleware("us-east1-b", options, next)
+
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest("GET", "/istio-test/metadata/cluster-name", nil))
+		assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+		assert.Equal(t, "zone-error", w.Header().Get("X-Fault-Injected"))
+
+		w = httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest("GET", "/istio-test/health", nil))
+		assert.Equal(t, http.StatusOK, w.Code)
+	})
+
+	t.Run("inactive fault", func(t *testing.T) {
+		handler := ZoneSkewMiddleware("us-east1-b", ZoneSkewOptions{Zones: []string{"us-east1"}}, next)
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest("GET", "/istio-test/metadata/cluster-name", nil))
+		assert.Equal(t, http.StatusOK, w.Code)
+	})
+}
+
+func TestZoneSkewSetErrorRate(t *testing.T) {
+	withRand(t, 0.5)
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	})
+	skew := NewZoneSkew("us-east1-b", ZoneSkewOptions{Zones: []string{"us-east1"}})
+	assert.True(t, skew.Active())
+	handler := skew.Middleware(next)
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest("GET", "/istio-test/echo", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	skew.SetErrorRate(0.9)
+	assert.Equal(t, 0.9, skew.ErrorRate())
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest("GET", "/istio-test/echo", nil))
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+
+	assert.False(t, NewZoneSkew("us-west1-a", ZoneSkewOptions{Zones: []string{"us-east1"}}).Active())
+}
+
+func TestZoneSkewSetFault(t *testing.T) {
+	withRand(t, 0.5)
+	skew := NewZoneSkew("us-east1-b", ZoneSkewOptions{Zones: []string{"us-east1"}, Fault: Fault{ErrorRate: 0.9, ErrorStatus: http.StatusBadGateway}})
+	handler := skew.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest("GET", "/istio-test/echo", nil))
+	assert.Equal(t, http.StatusBadGateway, w.Code)
+
+	skew.SetFault(Fault{ErrorRate: 0.9, ErrorStatus: http.StatusGatewayTimeout})
+	skew.SetErrorRate(0.8)
+	assert.Equal(t, Fault{ErrorRate: 0.8, ErrorStatus: http.StatusGatewayTimeout}, skew.Fault())
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest("GET", "/istio-test/echo", nil))
+	assert.Equal(t, http.StatusGatewayTimeout, w.Code)
+
+	skew.SetFault(Fault{})
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest("GET", "/istio-test/echo", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+}
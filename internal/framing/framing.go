@@ -0,0 +1,440 @@
+// Package framing observes how HTTP/1 requests are framed on the wire.
+//
+// net/http normalizes or rejects ambiguous framing before handlers run, so a
+// handler cannot tell whether Envoy forwarded a duplicate Content-Length, a
+// bare LF or an odd Transfer-Encoding. The Listener wraps accepted
+// connections and inspects the raw request heads as they are read, recording
+// anomalies so smuggling hardening in the mesh can be validated against what
+// the origin actually received. Inspection of a connection stops once it
+// leaves HTTP/1: after a CONNECT request or a 101 Switching Protocols
+// response, the bytes that follow belong to the tunnel or upgraded protocol.
+package framing
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"istio-test/internal/observability"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Anomalies recorded in request heads and bodies
+const (
+	KindBareLF                    = "bare_lf"                     // Line terminated by LF without CR
+	KindBareCR                    = "bare_cr"                     // CR not followed by LF inside a line
+	KindObsFold                   = "obs_fold"                    // Header continued on the next line
+	KindSpaceBeforeColon          = "space_before_colon"          // Whitespace between header name and colon
+	KindDuplicateContentLength    = "duplicate_content_length"    // Content-Length repeated with the same value
+	KindConflictingContentLength  = "conflicting_content_length"  // Content-Length repeated with different values
+	KindInvalidContentLength      = "invalid_content_length"      // Content-Length that is not a decimal number
+	KindDuplicateTransferEncoding = "duplicate_transfer_encoding" // Transfer-Encoding repeated
+	KindUnusualTransferEncoding   = "unusual_transfer_encoding"   // Transfer-Encoding other than exactly "chunked"
+	KindTransferEncodingAndLength = "te_and_cl"                   // Both Transfer-Encoding and Content-Length
+	KindMalformedChunk            = "malformed_chunk"             // Chunk size line that cannot be parsed
+)
+
+const (
+	maxHeadBytes        = 64 << 10 // Heads above this stop inspection of the connection
+	maxChunkLineBytes   = 4 << 10
+	maxRecentEvents     = 100
+	maxRequestLineBytes = 256
+)
+
+var framingAnomalies = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Namespace: "istio_test",
+	Name:      "http_framing_anomalies_total",
+	Help:      "Total number of framing anomalies observed in raw HTTP/1 requests, by kind.",
+}, []string{"kind"})
+
+func init() {
+	observability.MetricsRegistry().MustRegister(framingAnomalies)
+}
+
+// Event is a request whose framing had anomalies
+type Event struct {
+	Time        time.Time `json:"time"`
+	RemoteAddr  string    `json:"remote_addr"`
+	RequestLine string    `json:"request_line"` // Truncated to 256 bytes
+	Kinds       []string  `json:"kinds"`
+}
+
+// Report summarizes the anomalies observed since startup
+type Report struct {
+	Counts map[string]uint64 `json:"counts"`
+	Recent []Event           `json:"recent"` // Latest events, oldest first
+}
+
+// Recorder keeps the anomalies observed by its listeners
+type Recorder struct {
+	mu     sync.Mutex
+	counts map[string]uint64
+	recent []Event
+	now    func() time.Time
+}
+
+// NewRecorder creates an empty recorder
+func NewRecorder() *Recorder {
+	return &Recorder{counts: map[string]uint64{}, now: time.Now}
+}
+
+// record stores an event, counts its kinds and logs it
+func (rec *Recorder) record(remoteAddr, requestLine string, kinds []string) {
+	if len(requestLine) > maxRequestLineBytes {
+		requestLine = requestLine[:maxRequestLineBytes]
+	}
+	event := Event{Time: rec.now().UTC(), RemoteAddr: remoteAddr, RequestLine: requestLine, Kinds: kinds}
+
+	rec.mu.Lock()
+	for _, kind := range kinds {
+		rec.counts[kind]++
+		framingAnomalies.WithLabelValues(kind).Inc()
+	}
+	if len(rec.recent) == maxRecentEvents {
+		rec.recent = rec.recent[1:]
+	}
+	rec.recent = append(rec.recent, event)
+	rec.mu.Unlock()
+
+	observability.WarnWithFields(context.Background(), fmt.Sprintf("Request framing anomalies from %s: %s", remoteAddr, strings.Join(kinds, ", ")), map[string]any{
+		"type":         "framing_anomaly",
+		"kinds":        kinds,
+		"remote_addr":  remoteAddr,
+		"request_line": requestLine,
+	})
+}
+
+// Report returns the anomaly counts and the latest events
+func (rec *Recorder) Report() Report {
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+
+	report := Report{Counts: make(map[string]uint64, len(rec.counts)), Recent: make([]Event, len(rec.recent))}
+	for kind, count := range rec.counts {
+		report.Counts[kind] = count
+	}
+	copy(report.Recent, rec.recent)
+	return report
+}
+
+// Handler serves the report
+func (rec *Recorder) Handler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		jsonData, err := json.Marshal(rec.Report())
+		if err != nil {
+			http.Error(w, "Failed to encode anomaly report", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		_, _ = w.Write(jsonData)
+	}
+}
+
+// Listener returns a listener whose connections report framing anomalies to rec
+func (rec *Recorder) Listener(l net.Listener) net.Listener {
+	return &listener{Listener: l, recorder: rec}
+}
+
+type listener struct {
+	net.Listener
+	recorder *Recorder
+}
+
+func (l *listener) Accept() (net.Conn, error) {
+	c, err := l.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+	return &conn{Conn: c, scanner: scanner{recorder: l.recorder, remoteAddr: c.RemoteAddr().String()}}, nil
+}
+
+// conn inspects the bytes read by the server, and the responses it writes to
+// notice protocol upgrades. The server reads in the background while a
+// handler writes, so the scanner is guarded by mu.
+type conn struct {
+	net.Conn
+	mu      sync.Mutex
+	scanner scanner
+}
+
+func (c *conn) Read(p []byte) (int, error) {
+	n, err := c.Conn.Read(p)
+	if n > 0 {
+		c.mu.Lock()
+		c.scanner.feed(p[:n])
+		c.mu.Unlock()
+	}
+	return n, err
+}
+
+func (c *conn) Write(p []byte) (int, error) {
+	c.mu.Lock()
+	c.scanner.wrote(p)
+	c.mu.Unlock()
+	return c.Conn.Write(p)
+}
+
+// scanner states
+const (
+	stateHead = iota
+	stateBody
+	stateChunkSize
+	stateChunkData
+	stateChunkEnd
+	stateTrailers
+	stateDone // Framing is lost or unsupported; stop inspecting
+)
+
+// scanner follows the framing of the requests on one connection, the way
+// net/http delimits them, so every request head is inspected
+type scanner struct {
+	recorder   *Recorder
+	remoteAddr string
+
+	state     int
+	buf       []byte // Partial head or chunk line
+	remaining int64  // Bytes left in the body or chunk
+	upgrading bool   // An upgrade was requested and the response is not written yet
+}
+
+// wrote looks at the start of a response written to the connection. A 101
+// answering an upgrade request switches the connection to another protocol;
+// any other final status keeps it on HTTP/1.
+func (s *scanner) wrote(data []byte) {
+	if !s.upgrading || len(data) < len("HTTP/1.1 101") || !strings.HasPrefix(string(data[:5]), "HTTP/") {
+		return
+	}
+	switch status := string(data[9:12]); {
+	case status == "101":
+		s.state, s.buf, s.upgrading = stateDone, nil, false
+	case status[0] != '1':
+		s.upgrading = false
+	}
+}
+
+// feed inspects the next bytes read from the connection
+func (s *scanner) feed(data []byte) {
+	for len(data) > 0 && s.state != stateDone {
+		switch s.state {
+		case stateHead:
+			data = s.feedHead(data)
+		case stateBody, stateChunkData:
+			n := min(int64(len(data)), s.remaining)
+			data, s.remaining = data[n:], s.remaining-n
+			if s.remaining == 0 {
+				if s.state == stateBody {
+					s.state = stateHead
+				} else {
+					s.state = stateChunkEnd
+				}
+			}
+		case stateChunkEnd:
+			// The CRLF closing chunk data; a bare LF is tolerated
+			if data[0] == '\r' {
+				data = data[1:]
+				continue
+			}
+			if data[0] != '\n' {
+				s.recorder.record(s.remoteAddr, "", []string{KindMalformedChunk})
+				s.state = stateDone
+				return
+			}
+			data, s.state = data[1:], stateChunkSize
+		case stateChunkSize, stateTrailers:
+			data = s.feedChunkLine(data)
+		}
+	}
+}
+
+// feedHead buffers a request head until it is complete, inspects it and
+// returns the bytes following it
+func (s *scanner) feedHead(data []byte) []byte {
+	s.buf = append(s.buf, data...)
+	end := headEnd(s.buf)
+	if end < 0 {
+		if len(s.buf) > maxHeadBytes {
+			s.state, s.buf = stateDone, nil
+		}
+		return nil
+	}
+
+	head := string(s.buf[:end])
+	rest := append([]byte(nil), s.buf[end:]...)
+	s.buf = s.buf[:0]
+	if strings.HasPrefix(head, "PRI * HTTP/2") {
+		s.state = stateDone
+		return nil
+	}
+	s.inspectHead(head)
+	return rest
+}
+
+// headEnd returns the length of the head at the start of buf including its
+// terminating empty line, or -1 when it is incomplete
+func headEnd(buf []byte) int {
+	for i := 0; i < len(buf); i++ {
+		if buf[i] != '\n' || i == 0 {
+			continue
+		}
+		if buf[i-1] == '\n' {
+			return i + 1
+		}
+		if buf[i-1] == '\r' && i >= 2 && buf[i-2] == '\n' {
+			return i + 1
+		}
+	}
+	return -1
+}
+
+// inspectHead records the anomalies of a request head and sets up the framing
+// of its body
+func (s *scanner) inspectHead(head string) {
+	kinds := map[string]bool{}
+	lines := strings.Split(strings.TrimSuffix(head, "\n"), "\n")
+
+	var requestLine string
+	var contentLengths, transferEncodings []string
+	upgrade := false
+	for i, line := range lines {
+		if !strings.HasSuffix(line, "\r") {
+			kinds[KindBareLF] = true
+		}
+		line = strings.TrimSuffix(line, "\r")
+		if strings.Contains(line, "\r") {
+			kinds[KindBareCR] = true
+		}
+		if i == 0 {
+			requestLine = line
+			continue
+		}
+		if line == "" {
+			continue
+		}
+		if line[0] == ' ' || line[0] == '\t' {
+			kinds[KindObsFold] = true
+			continue
+		}
+		name, value, _ := strings.Cut(line, ":")
+		if strings.TrimRight(name, " \t") != name {
+			kinds[KindSpaceBeforeColon] = true
+		}
+		switch strings.ToLower(strings.TrimSpace(name)) {
+		case "content-length":
+			contentLengths = append(contentLengths, strings.TrimSpace(value))
+		case "transfer-encoding":
+			transferEncodings = append(transferEncodings, strings.TrimSpace(value))
+		case "upgrade":
+			upgrade = strings.TrimSpace(value) != ""
+		}
+	}
+
+	length := int64(0)
+	validLength := true
+	for i, value := range contentLengths {
+		n, err := strconv.ParseUint(value, 10, 63)
+		if err != nil {
+			kinds[KindInvalidContentLength] = true
+			validLength = false
+			continue
+		}
+		length = int64(n)
+		if i > 0 {
+			if value == contentLengths[0] {
+				kinds[KindDuplicateContentLength] = true
+			} else {
+				kinds[KindConflictingContentLength] = true
+				validLength = false
+			}
+		}
+	}
+
+	chunked := false
+	if len(transferEncodings) > 0 {
+		if len(transferEncodings) > 1 {
+			kinds[KindDuplicateTransferEncoding] = true
+		}
+		if transferEncodings[0] != "chunked" || len(transferEncodings) > 1 {
+			kinds[KindUnusualTransferEncoding] = true
+		}
+		if len(contentLengths) > 0 {
+			kinds[KindTransferEncodingAndLength] = true
+		}
+		chunked = strings.EqualFold(transferEncodings[0], "chunked")
+	}
+
+	if len(kinds) > 0 {
+		sorted := make([]string, 0, len(kinds))
+		for kind := range kinds {
+			sorted = append(sorted, kind)
+		}
+		slices.Sort(sorted)
+		s.recorder.record(s.remoteAddr, requestLine, sorted)
+	}
+
+	// A CONNECT turns the connection into a tunnel once it is answered
+	if method, _, _ := strings.Cut(requestLine, " "); method == http.MethodConnect {
+		s.state = stateDone
+		return
+	}
+	s.upgrading = upgrade
+
+	// Follow the body the way net/http delimits it; requests it rejects end
+	// the connection
+	switch {
+	case chunked:
+		s.state = stateChunkSize
+	case len(transferEncodings) > 0 || !validLength:
+		s.state = stateDone
+	case length > 0:
+		s.state, s.remaining = stateBody, length
+	default:
+		s.state = stateHead
+	}
+}
+
+// feedChunkLine buffers a chunk size or trailer line until it is complete and
+// returns the bytes following it
+func (s *scanner) feedChunkLine(data []byte) []byte {
+	i := strings.IndexByte(string(data), '\n')
+	if i < 0 {
+		s.buf = append(s.buf, data...)
+		if len(s.buf) > maxChunkLineBytes {
+			s.state, s.buf = stateDone, nil
+		}
+		return nil
+	}
+	line := strings.TrimSuffix(string(append(s.buf, data[:i]...)), "\r")
+	s.buf = s.buf[:0]
+	data = data[i+1:]
+
+	if s.state == stateTrailers {
+		if line == "" {
+			s.state = stateHead
+		}
+		return data
+	}
+
+	sizeField, _, _ := strings.Cut(line, ";")
+	size, err := strconv.ParseUint(strings.TrimSpace(sizeField), 16, 63)
+	if err != nil {
+		s.recorder.record(s.remoteAddr, "", []string{KindMalformedChunk})
+		s.state = stateDone
+		return nil
+	}
+	if size == 0 {
+		s.state = stateTrailers
+	} else {
+		s.state, s.remaining = stateChunkData, int64(size)
+	}
+	return data
+}
@@ -0,0 +1,216 @@
+package framing
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// scan feeds raw bytes in chunks of size and returns the recorded events
+func scan(raw string, size int) []Event {
+	rec := NewRecorder()
+	s := scanner{recorder: rec, remoteAddr: "10.0.0.1:1234"}
+	for len(raw) > 0 {
+		n := min(size, len(raw))
+		s.feed([]byte(raw[:n]))
+		raw = raw[n:]
+	}
+	return rec.Report().Recent
+}
+
+func TestScannerAnomalies(t *testing.T) {
+	tests := []struct {
+		name     string
+		raw      string
+		expected [][]string
+	}{
+		{
+			name: "well formed requests",
+			raw: "GET / HTTP/1.1\r\nHost: a\r\n\r\n" +
+				"POST /items HTTP/1.1\r\nHost: a\r\nContent-Length: 5\r\n\r\nhello" +
+				"POST /items HTTP/1.1\r\nHost: a\r\nTransfer-Encoding: chunked\r\n\r\n5;ext=1\r\nhello\r\n0\r\nX-Trailer: 1\r\n\r\n" +
+				"GET /next HTTP/1.1\r\nHost: a\r\n\r\n",
+		},
+		{
+			name:     "bare LF",
+			raw:      "GET / HTTP/1.1\nHost: a\n\n",
+			expected: [][]string{{KindBareLF}},
+		},
+		{
+			name:     "bare CR",
+			raw:      "GET / HTTP/1.1\r\nX-Test: a\rb\r\n\r\n",
+			expected: [][]string{{KindBareCR}},
+		},
+		{
+			name:     "obs-fold and space before colon",
+			raw:      "GET / HTTP/1.1\r\nX-Test: a\r\n b\r\nHost : a\r\n\r\n",
+			expected: [][]string{{KindObsFold, KindSpaceBeforeColon}},
+		},
+		{
+			name:     "duplicate Content-Length",
+			raw:      "POST / HTTP/1.1\r\nContent-Length: 2\r\nContent-Length: 2\r\n\r\nhi" + "GET /next HTTP/1.1\nHost: a\n\n",
+			expected: [][]string{{KindDuplicateContentLength}, {KindBareLF}},
+		},
+		{
+			name:     "conflicting Content-Length",
+			raw:      "POST / HTTP/1.1\r\nContent-Length: 2\r\nContent-Length: 20\r\n\r\nhi",
+			expected: [][]string{{KindConflictingContentLength}},
+		},
+		{
+			name:     "invalid Content-Length",
+			raw:      "POST / HTTP/1.1\r\nContent-Length: +2\r\n\r\nhi",
+			expected: [][]string{{KindInvalidContentLength}},
+		},
+		{
+			name: "Transfer-Encoding with Content-Length",
+			raw: "POST / HTTP/1.1\r\nContent-Length: 4\r\nTransfer-Encoding: chunked\r\n\r\n0\r\n\r\n" +
+				"GET /smuggled HTTP/1.1\nHost: a\n\n",
+			expected: [][]string{{KindTransferEncodingAndLength}, {KindBareLF}},
+		},
+		{
+			name:     "unusual Transfer-Encoding",
+			raw:      "POST / HTTP/1.1\r\nTransfer-Encoding: Chunked\r\nTransfer-Encoding: identity\r\n\r\n0\r\n\r\n",
+			expected: [][]string{{KindDuplicateTransferEncoding, KindUnusualTransferEncoding}},
+		},
+		{
+			name:     "malformed chunk size",
+			raw:      "POST / HTTP/1.1\r\nTransfer-Encoding: chunked\r\n\r\nzz\r\n",
+			expected: [][]string{{KindMalformedChunk}},
+		},
+	}
+
+	for _, tt := range tests {
+		for _, size := range []int{1, 7, 1 << 16} {
+			events := scan(tt.raw, size)
+			kinds := make([][]string, len(events))
+			for i, event := range events {
+				kinds[i] = event.Kinds
+			}
+			if tt.expected == nil {
+				assert.Empty(t, kinds, "%s, %d byte reads", tt.name, size)
+				continue
+			}
+			assert.Equal(t, tt.expected, kinds, "%s, %d byte reads", tt.name, size)
+		}
+	}
+}
+
+func TestScannerStopsOnHTTP2(t *testing.T) {
+	assert.Empty(t, scan("PRI * HTTP/2.0\r\n\r\nSM\r\n\r\n"+"GET / HTTP/1.1\nHost: a\n\n", 1<<16))
+}
+
+func TestScannerStopsOnConnect(t *testing.T) {
+	assert.Empty(t, scan("CONNECT db:5432 HTTP/1.1\r\nHost: db:5432\r\n\r\n"+"GET / HTTP/1.1\nHost: a\n\n", 1<<16))
+}
+
+func TestScannerStopsOnUpgrade(t *testing.T) {
+	upgrade := "GET /ws HTTP/1.1\r\nHost: a\r\nConnection: Upgrade\r\nUpgrade: websocket\r\n\r\n"
+	anomalous := "GET / HTTP/1.1\nHost: a\n\n"
+
+	rec := NewRecorder()
+	s := scanner{recorder: rec, remoteAddr: "10.0.0.1:1234"}
+	s.feed([]byte(upgrade))
+	s.wrote([]byte("HTTP/1.1 101 Switching Protocols\r\nUpgrade: websocket\r\n\r\n"))
+	s.feed([]byte(anomalous))
+	assert.Empty(t, rec.Report().Recent, "bytes after a 101 are not HTTP/1")
+
+	// A declined upgrade keeps the connection on HTTP/1
+	rec = NewRecorder()
+	s = scanner{recorder: rec, remoteAddr: "10.0.0.1:1234"}
+	s.feed([]byte(upgrade))
+	s.wrote([]byte("HTTP/1.1 100 Continue\r\n\r\n"))
+	s.wrote([]byte("HTTP/1.1 400 Bad Request\r\n\r\n"))
+	s.feed([]byte(anomalous))
+	assert.Len(t, rec.Report().Recent, 1)
+}
+
+func TestRecorderKeepsLatestEvents(t *testing.T) {
+	rec := NewRecorder()
+	for range maxRecentEvents + 5 {
+		rec.record("10.0.0.1:1234", "GET / HTTP/1.1", []string{KindBareLF})
+	}
+	report := rec.Report()
+	assert.Len(t, report.Recent, maxRecentEvents)
+	assert.Equal(t, uint64(maxRecentEvents+5), report.Counts[KindBareLF])
+}
+
+func TestListener(t *testing.T) {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	rec := NewRecorder()
+	server := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.Copy(io.Discard, r.Body)
+		w.Write([]byte("ok"))
+	})}
+	go server.Serve(rec.Listener(lis))
+	t.Cleanup(func() { server.Close() })
+
+	c, err := net.Dial("tcp", lis.Addr().String())
+	require.NoError(t, err)
+	defer c.Close()
+
+	// Two requests on one connection; only the second is anomalous
+	_, err = io.WriteString(c, "POST /a HTTP/1.1\r\nHost: a\r\nContent-Length: 2\r\n\r\nhi"+
+		"GET /b HTTP/1.1\r\nHost: a\r\nX-Folded: a\r\n b\r\n\r\n")
+	require.NoError(t, err)
+	reader := bufio.NewReader(c)
+	resp, err := http.ReadResponse(reader, nil)
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	resp, err = http.ReadResponse(reader, nil)
+	require.NoError(t, err)
+	resp.Body.Close()
+
+	w := httptest.NewRecorder()
+	rec.Handler()(w, httptest.NewRequest(http.MethodGet, "/admin/anomalies", nil))
+	var report Report
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &report))
+	require.Len(t, report.Recent, 1)
+	assert.Equal(t, "GET /b HTTP/1.1", report.Recent[0].RequestLine)
+	assert.Equal(t, []string{KindObsFold}, report.Recent[0].Kinds)
+	assert.Equal(t, uint64(1), report.Counts[KindObsFold])
+}
+
+func TestListenerUpgrade(t *testing.T) {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	rec := NewRecorder()
+	received := make(chan string, 1)
+	server := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, brw, err := http.NewResponseController(w).Hijack()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		_, _ = brw.WriteString("HTTP/1.1 101 Switching Protocols\r\nConnection: Upgrade\r\nUpgrade: test\r\n\r\n")
+		_ = brw.Flush()
+		line, _ := brw.ReadString('\n')
+		received <- line
+	})}
+	go server.Serve(rec.Listener(lis))
+	t.Cleanup(func() { server.Close() })
+
+	c, err := net.Dial("tcp", lis.Addr().String())
+	require.NoError(t, err)
+	defer c.Close()
+
+	_, err = io.WriteString(c, "GET /upgrade HTTP/1.1\r\nHost: a\r\nConnection: Upgrade\r\nUpgrade: test\r\n\r\n")
+	require.NoError(t, err)
+	resp, err := http.ReadResponse(bufio.NewReader(c), nil)
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusSwitchingProtocols, resp.StatusCode)
+
+	// The upgraded protocol may look like a malformed request head
+	_, err = io.WriteString(c, "GET / HTTP/1.1\nHost: a\n\n")
+	require.NoError(t, err)
+	assert.Equal(t, "GET / HTTP/1.1\n", <-received)
+	assert.Empty(t, rec.Report().Recent)
+}
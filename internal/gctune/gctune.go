@@ -0,0 +1,224 @@
+// Package gctune applies the soft memory limit, GC target and GOMAXPROCS from
+// config and reports the values in effect.
+//
+// The runtime already reads GOMEMLIMIT, GOGC and GOMAXPROCS from the
+// environment; making them config settings lets experiments tune memory
+// behavior under a sidecar-constrained pod alongside the rest of the
+// configuration, and the runtime endpoint shows what is actually in effect,
+// whichever way it was set.
+//
+// The runtime sizes GOMAXPROCS from the CPUs of the node rather than the CPU
+// limit of the container, so a pod limited to 2 CPUs on a 32 CPU node runs 32
+// threads that are throttled by the CFS quota and skew latency measurements.
+// With MaxProcs set to Auto, GOMAXPROCS follows the cgroup CPU quota instead,
+// like go.uber.org/automaxprocs.
+package gctune
+
+import (
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"runtime"
+	"runtime/debug"
+	"runtime/metrics"
+	"strconv"
+	"strings"
+)
+
+// Off disables the garbage collector target when used as the GC percent
+const Off = "off"
+
+// Auto sizes GOMAXPROCS from the CPU quota when used as MaxProcs
+const Auto = "auto"
+
+// cgroupRoot is where the cgroup filesystem of the container is mounted
+var cgroupRoot = "/sys/fs/cgroup"
+
+// Options holds the settings to apply; empty values keep the runtime's own
+type Options struct {
+	MemoryLimit string // Soft memory limit in GOMEMLIMIT syntax, e.g. "512MiB"
+	GCPercent   string // GC target percentage in GOGC syntax, e.g. "100" or "off"
+	MaxProcs    string // GOMAXPROCS as a positive integer, or "auto" for the CPU quota rounded down
+}
+
+// Status reports the runtime memory settings in effect
+type Status struct {
+	MemoryLimitBytes int64   `json:"memory_limit_bytes"` // math.MaxInt64 when unlimited
+	GCPercent        int     `json:"gc_percent"`         // -1 when the GC target is off
+	GOMAXPROCS       int     `json:"gomaxprocs"`
+	CPUQuota         float64 `json:"cpu_quota,omitempty"` // CPUs allowed by the cgroup, zero when unlimited
+	Goroutines       int     `json:"goroutines"`
+	HeapAllocBytes   uint64  `json:"heap_alloc_bytes"`
+	HeapGoalBytes    uint64  `json:"heap_goal_bytes"`
+	NumGC            uint32  `json:"num_gc"`
+}
+
+// byteUnits are the GOMEMLIMIT suffixes, longest first so "MiB" is not read as "B"
+var byteUnits = []struct {
+	suffix     string
+	multiplier int64
+}{
+	{"KiB", 1 << 10},
+	{"MiB", 1 << 20},
+	{"GiB", 1 << 30},
+	{"TiB", 1 << 40},
+	{"B", 1},
+}
+
+// ParseMemoryLimit parses a limit in GOMEMLIMIT syntax: a byte count with an
+// optional B, KiB, MiB, GiB or TiB suffix, or "off" for no limit
+func ParseMemoryLimit(value string) (int64, error) {
+	if value == Off {
+		return math.MaxInt64, nil
+	}
+	number, multiplier := value, int64(1)
+	for _, unit := range byteUnits {
+		if strings.HasSuffix(value, unit.suffix) {
+			number, multiplier = strings.TrimSuffix(value, unit.suffix), unit.multiplier
+			break
+		}
+	}
+	n, err := strconv.ParseInt(number, 10, 64)
+	if err != nil || n <= 0 || n > math.MaxInt64/multiplier {
+		return 0, fmt.Errorf("invalid memory limit '%s': must be a positive byte count with an optional B, KiB, MiB, GiB or TiB suffix, or off", value)
+	}
+	return n * multiplier, nil
+}
+
+// ParseGCPercent parses a GC target in GOGC syntax, returning -1 for "off"
+func ParseGCPercent(value string) (int, error) {
+	if value == Off {
+		return -1, nil
+	}
+	percent, err := strconv.Atoi(value)
+	if err != nil || percent < 0 {
+		return 0, fmt.Errorf("invalid GC percent '%s': must be a non-negative integer or off", value)
+	}
+	return percent, nil
+}
+
+// ParseMaxProcs parses a GOMAXPROCS setting, returning 0 for "auto"
+func ParseMaxProcs(value string) (int, error) {
+	if value == Auto {
+		return 0, nil
+	}
+	procs, err := strconv.Atoi(value)
+	if err != nil || procs <= 0 {
+		return 0, fmt.Errorf("invalid GOMAXPROCS '%s': must be a positive integer or auto", value)
+	}
+	return procs, nil
+}
+
+// readCgroupFile returns the trimmed content of a file below cgroupRoot
+func readCgroupFile(name string) (string, bool) {
+	data, err := os.ReadFile(filepath.Join(cgroupRoot, name))
+	if err != nil {
+		return "", false
+	}
+	return strings.TrimSpace(string(data)), true
+}
+
+// CPUQuota returns the CPUs the container may use according to the cgroup v2
+// cpu.max or the cgroup v1 CFS quota, and false when it is unlimited or unknown
+func CPUQuota() (float64, bool) {
+	var quota, period string
+	if cpuMax, ok := readCgroupFile("cpu.max"); ok {
+		quota, period, _ = strings.Cut(cpuMax, " ")
+	} else {
+		for _, dir := range []string{"cpu", "cpu,cpuacct"} {
+			var ok bool
+			if quota, ok = readCgroupFile(filepath.Join(dir, "cpu.cfs_quota_us")); ok {
+				period, _ = readCgroupFile(filepath.Join(dir, "cpu.cfs_period_us"))
+				break
+			}
+		}
+	}
+
+	q, err := strconv.ParseInt(quota, 10, 64)
+	if err != nil || q <= 0 {
+		return 0, false
+	}
+	p, err := strconv.ParseInt(period, 10, 64)
+	if err != nil || p <= 0 {
+		return 0, false
+	}
+	return float64(q) / float64(p), true
+}
+
+// autoMaxProcs returns GOMAXPROCS for the CPU quota, rounded down to at least
+// one and at most the CPUs of the node, and false without a quota
+func autoMaxProcs() (int, bool) {
+	quota, ok := CPUQuota()
+	if !ok {
+		return 0, false
+	}
+	return min(max(int(quota), 1), runtime.NumCPU()), true
+}
+
+// Apply sets the configured memory limit, GC target and GOMAXPROCS. A
+// GOMAXPROCS environment variable wins over "auto", as with automaxprocs.
+func Apply(options Options) error {
+	if options.MemoryLimit != "" {
+		limit, err := ParseMemoryLimit(options.MemoryLimit)
+		if err != nil {
+			return err
+		}
+		debug.SetMemoryLimit(limit)
+	}
+	if options.GCPercent != "" {
+		percent, err := ParseGCPercent(options.GCPercent)
+		if err != nil {
+			return err
+		}
+		debug.SetGCPercent(percent)
+	}
+	if options.MaxProcs != "" {
+		procs, err := ParseMaxProcs(options.MaxProcs)
+		if err != nil {
+			return err
+		}
+		if procs == 0 && os.Getenv("GOMAXPROCS") == "" {
+			procs, _ = autoMaxProcs()
+		}
+		if procs > 0 {
+			runtime.GOMAXPROCS(procs)
+		}
+	}
+	return nil
+}
+
+// runtimeMetrics are read for the settings that cannot be queried without changing them
+var runtimeMetrics = []string{"/gc/gogc:percent", "/gc/heap/goal:bytes"}
+
+// Current returns the runtime memory settings in effect
+func Current() Status {
+	samples := make([]metrics.Sample, len(runtimeMetrics))
+	for i, name := range runtimeMetrics {
+		samples[i].Name = name
+	}
+	metrics.Read(samples)
+
+	var memStats runtime.MemStats
+	runtime.ReadMemStats(&memStats)
+
+	status := Status{
+		MemoryLimitBytes: debug.SetMemoryLimit(-1),
+		GCPercent:        -1,
+		GOMAXPROCS:       runtime.GOMAXPROCS(0),
+		Goroutines:       runtime.NumGoroutine(),
+		HeapAllocBytes:   memStats.HeapAlloc,
+		NumGC:            memStats.NumGC,
+	}
+	// An off GC target is reported as -1 converted to uint64
+	if samples[0].Value.Kind() == metrics.KindUint64 && samples[0].Value.Uint64() <= math.MaxInt32 {
+		status.GCPercent = int(samples[0].Value.Uint64())
+	}
+	if samples[1].Value.Kind() == metrics.KindUint64 {
+		status.HeapGoalBytes = samples[1].Value.Uint64()
+	}
+	if quota, ok := CPUQuota(); ok {
+		status.CPUQuota = quota
+	}
+	return status
+}
@@ -0,0 +1,141 @@
+package gctune
+
+import (
+	"math"
+	"os"
+	"path/filepath"
+	"runtime"
+	"runtime/debug"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseMemoryLimit(t *testing.T) {
+	tests := map[string]int64{
+		"1048576": 1 << 20,
+		"512B":    512,
+		"64KiB":   64 << 10,
+		"512MiB":  512 << 20,
+		"2GiB":    2 << 30,
+		"1TiB":    1 << 40,
+		"off":     math.MaxInt64,
+	}
+	for value, expected := range tests {
+		limit, err := ParseMemoryLimit(value)
+		require.NoError(t, err, value)
+		assert.Equal(t, expected, limit, value)
+	}
+
+	for _, value := range []string{"", "0", "-1MiB", "512MB", "lots", "9999999TiB"} {
+		_, err := ParseMemoryLimit(value)
+		assert.Error(t, err, value)
+	}
+}
+
+func TestParseGCPercent(t *testing.T) {
+	percent, err := ParseGCPercent("50")
+	require.NoError(t, err)
+	assert.Equal(t, 50, percent)
+
+	percent, err = ParseGCPercent("off")
+	require.NoError(t, err)
+	assert.Equal(t, -1, percent)
+
+	_, err = ParseGCPercent("-5")
+	assert.Error(t, err)
+	_, err = ParseGCPercent("half")
+	assert.Error(t, err)
+}
+
+func TestApply(t *testing.T) {
+	previousLimit, previousPercent := debug.SetMemoryLimit(-1), debug.SetGCPercent(-1)
+	debug.SetGCPercent(previousPercent)
+	t.Cleanup(func() {
+		debug.SetMemoryLimit(previousLimit)
+		debug.SetGCPercent(previousPercent)
+	})
+
+	require.NoError(t, Apply(Options{MemoryLimit: "256MiB", GCPercent: "75"}))
+	status := Current()
+	assert.Equal(t, int64(256<<20), status.MemoryLimitBytes)
+	assert.Equal(t, 75, status.GCPercent)
+
+	require.NoError(t, Apply(Options{GCPercent: "off"}))
+	status = Current()
+	assert.Equal(t, -1, status.GCPercent)
+	assert.Equal(t, int64(256<<20), status.MemoryLimitBytes, "empty settings are left alone")
+
+	assert.Error(t, Apply(Options{MemoryLimit: "lots"}))
+}
+
+func TestParseMaxProcs(t *testing.T) {
+	procs, err := ParseMaxProcs("4")
+	require.NoError(t, err)
+	assert.Equal(t, 4, procs)
+
+	procs, err = ParseMaxProcs("auto")
+	require.NoError(t, err)
+	assert.Equal(t, 0, procs)
+
+	for _, value := range []string{"0", "-1", "two"} {
+		_, err := ParseMaxProcs(value)
+		assert.Error(t, err, value)
+	}
+}
+
+// withCgroup points cgroupRoot at a directory holding files
+func withCgroup(t *testing.T, files map[string]string) {
+	root := t.TempDir()
+	for name, content := range files {
+		path := filepath.Join(root, name)
+		require.NoError(t, os.MkdirAll(filepath.Dir(path), 0o755))
+		require.NoError(t, os.WriteFile(path, []byte(content+"\n"), 0o644))
+	}
+	previous := cgroupRoot
+	cgroupRoot = root
+	t.Cleanup(func() { cgroupRoot = previous })
+}
+
+func TestCPUQuota(t *testing.T) {
+	tests := []struct {
+		name     string
+		files    map[string]string
+		expected float64
+		ok       bool
+	}{
+		{name: "cgroup v2", files: map[string]string{"cpu.max": "250000 100000"}, expected: 2.5, ok: true},
+		{name: "cgroup v2 unlimited", files: map[string]string{"cpu.max": "max 100000"}},
+		{name: "cgroup v1", files: map[string]string{"cpu/cpu.cfs_quota_us": "50000", "cpu/cpu.cfs_period_us": "100000"}, expected: 0.5, ok: true},
+		{name: "cgroup v1 unlimited", files: map[string]string{"cpu,cpuacct/cpu.cfs_quota_us": "-1", "cpu,cpuacct/cpu.cfs_period_us": "100000"}},
+		{name: "no cgroup"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			withCgroup(t, tt.files)
+			quota, ok := CPUQuota()
+			assert.Equal(t, tt.ok, ok)
+			assert.Equal(t, tt.expected, quota)
+		})
+	}
+}
+
+func TestApplyMaxProcs(t *testing.T) {
+	t.Setenv("GOMAXPROCS", "")
+	previous := runtime.GOMAXPROCS(0)
+	t.Cleanup(func() { runtime.GOMAXPROCS(previous) })
+
+	require.NoError(t, Apply(Options{MaxProcs: "1"}))
+	assert.Equal(t, 1, Current().GOMAXPROCS)
+
+	withCgroup(t, map[string]string{"cpu.max": "50000 100000"})
+	runtime.GOMAXPROCS(previous)
+	require.NoError(t, Apply(Options{MaxProcs: "auto"}))
+	status := Current()
+	assert.Equal(t, 1, status.GOMAXPROCS, "fractional quotas round down to at least one")
+	assert.Equal(t, 0.5, status.CPUQuota)
+
+	assert.Error(t, Apply(Options{MaxProcs: "all"}))
+}
@@ -0,0 +1,273 @@
+// Package goroutines counts goroutines per subsystem and reports the
+// subsystems that leak them.
+//
+// Long-running goroutines are started with Go, which labels them (and every
+// goroutine they start) with their subsystem through runtime/pprof labels.
+// The leak detector counts the goroutines of every subsystem from the
+// goroutine profile on an interval, exports the counts, and degrades health
+// when a subsystem's count has only grown over the whole window. Soak tests
+// have leaked goroutines in retry paths unnoticed before: a leak grows
+// steadily, while the count of a busy but healthy subsystem goes up and down
+// with its load.
+package goroutines
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"runtime/pprof"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"istio-test/internal/observability"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// LabelKey is the profiler label carrying the subsystem of a goroutine
+const LabelKey = "subsystem"
+
+// Unlabeled counts the goroutines started outside of Go, e.g. by the runtime
+const Unlabeled = "unlabeled"
+
+var (
+	goroutineCount = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: "istio_test",
+		Name:      "goroutines",
+		Help:      "Number of goroutines by subsystem.",
+	}, []string{"subsystem"})
+	leakSuspected = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: "istio_test",
+		Name:      "goroutine_leak_suspected",
+		Help:      "1 while the goroutine count of a subsystem has grown monotonically over the leak window, 0 otherwise.",
+	}, []string{"subsystem"})
+)
+
+func init() {
+	observability.MetricsRegistry().MustRegister(goroutineCount, leakSuspected)
+}
+
+// Go runs fn in a new goroutine labeled with subsystem; goroutines started
+// by fn inherit the label
+func Go(ctx context.Context, subsystem string, fn func(ctx context.Context)) {
+	go pprof.Do(ctx, pprof.Labels(LabelKey, subsystem), fn)
+}
+
+// Count returns the number of goroutines of every subsystem
+func Count() (map[string]int, error) {
+	var buf bytes.Buffer
+	if err := pprof.Lookup("goroutine").WriteTo(&buf, 1); err != nil {
+		return nil, err
+	}
+	return parseProfile(&buf)
+}
+
+// parseProfile counts the goroutines of a goroutine profile in the debug=1
+// text format, where every stack starts with "<count> @ <pcs>", optionally
+// followed by a "# labels: {...}" line
+func parseProfile(buf *bytes.Buffer) (map[string]int, error) {
+	counts := make(map[string]int)
+	pending, subsystem := 0, Unlabeled
+	flush := func() {
+		if pending > 0 {
+			counts[subsystem] += pending
+		}
+		pending, subsystem = 0, Unlabeled
+	}
+
+	scanner := bufio.NewScanner(buf)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if count, _, ok := strings.Cut(line, " @ "); ok && !strings.HasPrefix(line, "#") {
+			flush()
+			n, err := strconv.Atoi(count)
+			if err != nil {
+				return nil, fmt.Errorf("invalid goroutine profile line %q", line)
+			}
+			pending = n
+			continue
+		}
+		if labels, ok := strings.CutPrefix(line, "# labels: "); ok {
+			var values map[string]string
+			if err := json.Unmarshal([]byte(labels), &values); err == nil && values[LabelKey] != "" {
+				subsystem = values[LabelKey]
+			}
+		}
+	}
+	flush()
+	return counts, scanner.Err()
+}
+
+// Options configures the leak detector
+type Options struct {
+	Interval  time.Duration // Time between counts
+	Window    time.Duration // Time a subsystem's count must grow without ever dropping to be reported
+	MinGrowth int           // Growth over the window below which a subsystem is not reported
+}
+
+// point is the count of a subsystem at a moment
+type point struct {
+	at    time.Time
+	count int
+}
+
+// Subsystem is the state of a subsystem reported by Handler
+type Subsystem struct {
+	Goroutines int  `json:"goroutines"`
+	Growth     int  `json:"growth"` // Change over the samples within the window
+	Leaking    bool `json:"leaking"`
+}
+
+// LeakDetector counts goroutines per subsystem in the background
+type LeakDetector struct {
+	options Options
+	count   func() (map[string]int, error)
+
+	mu      sync.Mutex
+	history map[string][]point
+}
+
+// NewLeakDetector creates a leak detector; call Run to start counting
+func NewLeakDetector(options Options) *LeakDetector {
+	if options.Interval <= 0 {
+		options.Interval = 30 * time.Second
+	}
+	if options.Window < options.Interval {
+		options.Window = 20 * options.Interval
+	}
+	if options.MinGrowth < 1 {
+		options.MinGrowth = 1
+	}
+	return &LeakDetector{options: options, count: Count, history: make(map[string][]point)}
+}
+
+// Sample counts the goroutines of every subsystem and updates the metrics
+func (d *LeakDetector) Sample(ctx context.Context, now time.Time) {
+	counts, err := d.count()
+	if err != nil {
+		observability.WarnWithContext(ctx, fmt.Sprintf("Failed to count goroutines: %v", err))
+		return
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	// Subsystems that are gone count as zero, which ends a suspected leak
+	for subsystem := range d.history {
+		if _, ok := counts[subsystem]; !ok {
+			counts[subsystem] = 0
+		}
+	}
+	for subsystem, count := range counts {
+		// Keep the newest sample that is older than the window, so the
+		// retained samples always span the whole window
+		history := append(d.history[subsystem], point{at: now, count: count})
+		for len(history) > 1 && now.Sub(history[1].at) >= d.options.Window {
+			history = history[1:]
+		}
+		d.history[subsystem] = history
+
+		goroutineCount.WithLabelValues(subsystem).Set(float64(count))
+		leaking := d.leaking(history, now)
+		if leaking {
+			leakSuspected.WithLabelValues(subsystem).Set(1)
+		} else {
+			leakSuspected.WithLabelValues(subsystem).Set(0)
+		}
+	}
+}
+
+// leaking reports whether history covers the window and only grew by at
+// least MinGrowth across it
+func (d *LeakDetector) leaking(history []point, now time.Time) bool {
+	if len(history) < 3 || now.Sub(history[0].at) < d.options.Window {
+		return false
+	}
+	for i := 1; i < len(history); i++ {
+		if history[i].count < history[i-1].count {
+			return false
+		}
+	}
+	return history[len(history)-1].count-history[0].count >= d.options.MinGrowth
+}
+
+// Subsystems returns the last count of every subsystem
+func (d *LeakDetector) Subsystems() map[string]Subsystem {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	subsystems := make(map[string]Subsystem, len(d.history))
+	for name, history := range d.history {
+		last := history[len(history)-1]
+		subsystems[name] = Subsystem{
+			Goroutines: last.count,
+			Growth:     last.count - history[0].count,
+			Leaking:    d.leaking(history, last.at),
+		}
+	}
+	return subsystems
+}
+
+// Run counts immediately and then on every interval until ctx is done
+func (d *LeakDetector) Run(ctx context.Context) {
+	ticker := time.NewTicker(d.options.Interval)
+	defer ticker.Stop()
+
+	for {
+		d.Sample(ctx, time.Now())
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Name identifies the detector in health responses
+func (d *LeakDetector) Name() string {
+	return "goroutine_leaks"
+}
+
+// Check fails while a subsystem is suspected of leaking goroutines, which
+// degrades health
+func (d *LeakDetector) Check(ctx context.Context) error {
+	var leaks []string
+	for name, subsystem := range d.Subsystems() {
+		if subsystem.Leaking {
+			leaks = append(leaks, fmt.Sprintf("%s grew by %d to %d goroutines within %v", name, subsystem.Growth, subsystem.Goroutines, d.options.Window))
+		}
+	}
+	if len(leaks) > 0 {
+		sort.Strings(leaks)
+		return errors.New(strings.Join(leaks, "; "))
+	}
+	return nil
+}
+
+// Response is returned by Handler
+type Response struct {
+	Window     string               `json:"window"`
+	Subsystems map[string]Subsystem `json:"subsystems"`
+}
+
+// Handler reports the goroutine count of every subsystem
+func (d *LeakDetector) Handler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		jsonData, err := json.Marshal(Response{Window: d.options.Window.String(), Subsystems: d.Subsystems()})
+		if err != nil {
+			observability.ErrorWithContext(r.Context(), fmt.Sprintf("Error encoding goroutine counts: %v", err))
+			http.Error(w, "Failed to encode goroutine counts", http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		_, _ = w.Write(jsonData)
+	}
+}
@@ -0,0 +1,118 @@
+package goroutines
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCountLabelsSubsystems(t *testing.T) {
+	release := make(chan struct{})
+	defer close(release)
+	started := make(chan struct{})
+	Go(context.Background(), "test-leaker", func(ctx context.Context) {
+		for range 3 {
+			go func() { <-release }()
+		}
+		close(started)
+		<-release
+	})
+	<-started
+
+	counts, err := Count()
+	require.NoError(t, err)
+	assert.Equal(t, 4, counts["test-leaker"], "goroutines inherit the label of their parent")
+	assert.Positive(t, counts[Unlabeled])
+}
+
+func TestParseProfile(t *testing.T) {
+	profile := `goroutine profile: total 6
+3 @ 0x47d82a 0x480985
+# labels: {"subsystem":"heartbeat", "other":"x"}
+#	0x480984	time.Sleep+0x164	/usr/local/go/src/runtime/time.go:368
+
+2 @ 0x47d82a 0x480985
+# labels: {"subsystem":"heartbeat"}
+#	0x480984	time.Sleep+0x164	/usr/local/go/src/runtime/time.go:368
+
+1 @ 0x440e11 0x47cb9d
+#	0x4ce010	runtime/pprof.writeRuntimeProfile+0xb0	/usr/local/go/src/runtime/pprof/pprof.go:848
+`
+	counts, err := parseProfile(bytes.NewBufferString(profile))
+	require.NoError(t, err)
+	assert.Equal(t, map[string]int{"heartbeat": 5, Unlabeled: 1}, counts)
+}
+
+// fakeCounts returns each of counts in turn
+func fakeCounts(counts ...map[string]int) func() (map[string]int, error) {
+	return func() (map[string]int, error) {
+		next := counts[0]
+		counts = counts[1:]
+		copied := make(map[string]int, len(next))
+		for k, v := range next {
+			copied[k] = v
+		}
+		return copied, nil
+	}
+}
+
+func TestLeakDetector(t *testing.T) {
+	d := NewLeakDetector(Options{Interval: time.Minute, Window: 3 * time.Minute, MinGrowth: 5})
+	d.count = fakeCounts(
+		map[string]int{"proxy": 10, "health": 2},
+		map[string]int{"proxy": 14, "health": 1},
+		map[string]int{"proxy": 14, "health": 2},
+		map[string]int{"proxy": 20, "health": 4},
+		map[string]int{"proxy": 25, "health": 9},
+		map[string]int{"proxy": 12, "health": 9},
+	)
+	start := time.Now()
+	ctx := context.Background()
+
+	// Growth is only reported once it spans the whole window
+	for i := range 3 {
+		d.Sample(ctx, start.Add(time.Duration(i)*time.Minute))
+		require.NoError(t, d.Check(ctx))
+	}
+
+	// proxy only grew, health went down in between
+	d.Sample(ctx, start.Add(3*time.Minute))
+	err := d.Check(ctx)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "proxy grew by 10 to 20 goroutines")
+	assert.NotContains(t, err.Error(), "health")
+
+	// The window moves on; health's drop is no longer within it
+	d.Sample(ctx, start.Add(4*time.Minute))
+	err = d.Check(ctx)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "health grew by 8 to 9")
+
+	// A drop ends the suspected leak
+	d.Sample(ctx, start.Add(5*time.Minute))
+	err = d.Check(ctx)
+	require.Error(t, err)
+	assert.NotContains(t, err.Error(), "proxy")
+}
+
+func TestHandler(t *testing.T) {
+	d := NewLeakDetector(Options{Interval: time.Minute, Window: 3 * time.Minute})
+	d.count = fakeCounts(map[string]int{"http": 7})
+	d.Sample(context.Background(), time.Now())
+
+	w := httptest.NewRecorder()
+	d.Handler()(w, httptest.NewRequest(http.MethodGet, "/admin/goroutines", nil))
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	var response Response
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	assert.Equal(t, "3m0s", response.Window)
+	assert.Equal(t, Subsystem{Goroutines: 7}, response.Subsystems["http"])
+}
@@ -0,0 +1,189 @@
+// Package grpcserver serves a gRPC echo and metadata service alongside the
+// HTTP server, so mesh routing, retries and load balancing can be exercised
+// for gRPC as well as HTTP.
+//
+// The istiotest.v1.Echo service is built from well-known protobuf types, so
+// clients need no generated code:
+//
+//	rpc Echo(google.protobuf.Struct) returns (google.protobuf.Struct)
+//	rpc Metadata(google.protobuf.StringValue) returns (google.protobuf.StringValue)
+//
+// The standard grpc.health.v1.Health service reports SERVING until shutdown.
+package grpcserver
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"sort"
+	"strings"
+
+	"istio-test/internal/metadata"
+	"istio-test/internal/observability"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	grpcmetadata "google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/structpb"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+// ServiceName is the fully qualified name of the echo service
+const ServiceName = "istiotest.v1.Echo"
+
+// EchoServer is the server API of the echo service
+type EchoServer interface {
+	Echo(ctx context.Context, req *structpb.Struct) (*structpb.Struct, error)
+	Metadata(ctx context.Context, req *wrapperspb.StringValue) (*wrapperspb.StringValue, error)
+}
+
+// echoService implements EchoServer
+type echoService struct {
+	fetch func(ctx context.Context, url string) (string, error)
+}
+
+// Echo returns the request together with the serving pod, the caller's
+// address and the request metadata (headers) as seen after the sidecar
+func (s *echoService) Echo(ctx context.Context, req *structpb.Struct) (*structpb.Struct, error) {
+	headers := map[string]any{}
+	if md, ok := grpcmetadata.FromIncomingContext(ctx); ok {
+		keys := make([]string, 0, len(md))
+		for k := range md {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			headers[k] = strings.Join(md[k], ",")
+		}
+	}
+
+	peerAddr := ""
+	if p, ok := peer.FromContext(ctx); ok {
+		peerAddr = p.Addr.String()
+	}
+
+	response, err := structpb.NewStruct(map[string]any{
+		"hostname": os.Getenv("HOSTNAME"),
+		"peer":     peerAddr,
+		"metadata": headers,
+	})
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "failed to build response: %v", err)
+	}
+	response.Fields["request"] = structpb.NewStructValue(req)
+	return response, nil
+}
+
+// Metadata returns a single metadata attribute, accepting the same types as
+// /istio-test/metadata/{type}
+func (s *echoService) Metadata(ctx context.Context, req *wrapperspb.StringValue) (*wrapperspb.StringValue, error) {
+	url, ok := metadata.URLFor(req.GetValue())
+	if !ok {
+		return nil, status.Errorf(codes.InvalidArgument, "unknown metadata type %q, expected one of %s", req.GetValue(), strings.Join(metadata.Types(), ", "))
+	}
+
+	value, err := s.fetch(ctx, url)
+	if err != nil {
+		observability.ErrorWithContext(ctx, fmt.Sprintf("Failed to fetch metadata over gRPC: %v", err))
+		return nil, status.Error(codes.Unavailable, "failed to fetch metadata")
+	}
+	return wrapperspb.String(metadata.FormatValue(req.GetValue(), value)), nil
+}
+
+func echoHandler(srv any, ctx context.Context, dec func(any) error, interceptor grpc.UnaryServerInterceptor) (any, error) {
+	in := new(structpb.Struct)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(EchoServer).Echo(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{Server: srv, FullMethod: "/" + ServiceName + "/Echo"}
+	return interceptor(ctx, in, info, func(ctx context.Context, req any) (any, error) {
+		return srv.(EchoServer).Echo(ctx, req.(*structpb.Struct))
+	})
+}
+
+func metadataHandler(srv any, ctx context.Context, dec func(any) error, interceptor grpc.UnaryServerInterceptor) (any, error) {
+	in := new(wrapperspb.StringValue)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(EchoServer).Metadata(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{Server: srv, FullMethod: "/" + ServiceName + "/Metadata"}
+	return interceptor(ctx, in, info, func(ctx context.Context, req any) (any, error) {
+		return srv.(EchoServer).Metadata(ctx, req.(*wrapperspb.StringValue))
+	})
+}
+
+// serviceDesc describes the echo service without generated code
+var serviceDesc = grpc.ServiceDesc{
+	ServiceName: ServiceName,
+	HandlerType: (*EchoServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{MethodName: "Echo", Handler: echoHandler},
+		{MethodName: "Metadata", Handler: metadataHandler},
+	},
+}
+
+// loggingInterceptor logs failed calls
+func loggingInterceptor(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+	resp, err := handler(ctx, req)
+	if err != nil {
+		observability.WarnWithContext(ctx, fmt.Sprintf("gRPC %s failed: %v", info.FullMethod, err))
+	}
+	return resp, err
+}
+
+// Server is the gRPC server with the echo and health services
+type Server struct {
+	server *grpc.Server
+	health *health.Server
+}
+
+// New creates a gRPC server; fetch retrieves metadata server values
+func New(fetch func(ctx context.Context, url string) (string, error)) *Server {
+	s := &Server{
+		server: grpc.NewServer(grpc.UnaryInterceptor(loggingInterceptor)),
+		health: health.NewServer(),
+	}
+	s.server.RegisterService(&serviceDesc, &echoService{fetch: fetch})
+	healthpb.RegisterHealthServer(s.server, s.health)
+	s.health.SetServingStatus(ServiceName, healthpb.HealthCheckResponse_SERVING)
+	return s
+}
+
+// Serve accepts connections on lis until the server is stopped
+func (s *Server) Serve(lis net.Listener) error {
+	return s.server.Serve(lis)
+}
+
+// Drain reports NOT_SERVING to health checks while calls are still served
+func (s *Server) Drain() {
+	s.health.Shutdown()
+}
+
+// Shutdown reports NOT_SERVING to health checks and stops the server,
+// waiting for in-flight calls until ctx is done
+func (s *Server) Shutdown(ctx context.Context) {
+	s.health.Shutdown()
+
+	stopped := make(chan struct{})
+	go func() {
+		s.server.GracefulStop()
+		close(stopped)
+	}()
+
+	select {
+	case <-stopped:
+	case <-ctx.Done():
+		s.server.Stop()
+	}
+}
@@ -0,0 +1,132 @@
+package grpcserver
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	"istio-test/internal/metadata"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	grpcmetadata "google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+	"google.golang.org/protobuf/types/known/structpb"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+func mockFetch(ctx context.Context, url string) (string, error) {
+	switch url {
+	case metadata.InstanceZoneURL:
+		return "projects/123/zones/us-east1-b", nil
+	case metadata.ClusterNameURL:
+		return "test-cluster", nil
+	}
+	return "", errors.New("metadata server unavailable")
+}
+
+// startServer serves s on an in-memory listener and returns a connected client
+func startServer(t *testing.T, s *Server) *grpc.ClientConn {
+	lis := bufconn.Listen(1 << 20)
+	go s.Serve(lis)
+	t.Cleanup(func() { s.server.Stop() })
+
+	conn, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return lis.DialContext(ctx)
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	require.NoError(t, err)
+	t.Cleanup(func() { conn.Close() })
+	return conn
+}
+
+func TestEcho(t *testing.T) {
+	t.Setenv("HOSTNAME", "pod-1")
+	conn := startServer(t, New(mockFetch))
+
+	req, err := structpb.NewStruct(map[string]any{"message": "hello"})
+	require.NoError(t, err)
+	ctx := grpcmetadata.AppendToOutgoingContext(context.Background(), "x-test-run-id", "run-1")
+
+	resp := new(structpb.Struct)
+	require.NoError(t, conn.Invoke(ctx, "/"+ServiceName+"/Echo", req, resp))
+
+	fields := resp.AsMap()
+	assert.Equal(t, "pod-1", fields["hostname"])
+	assert.Equal(t, "hello", fields["request"].(map[string]any)["message"])
+	assert.Equal(t, "run-1", fields["metadata"].(map[string]any)["x-test-run-id"])
+	assert.NotEmpty(t, fields["peer"])
+}
+
+func TestMetadata(t *testing.T) {
+	conn := startServer(t, New(mockFetch))
+
+	tests := []struct {
+		name     string
+		request  string
+		expected string
+		code     codes.Code
+	}{
+		{name: "cluster name", request: "cluster-name", expected: "test-cluster", code: codes.OK},
+		{name: "zone is trimmed", request: "instance-zone", expected: "us-east1-b", code: codes.OK},
+		{name: "unknown type", request: "secrets", code: codes.InvalidArgument},
+		{name: "fetch failure", request: "cluster-location", code: codes.Unavailable},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp := new(wrapperspb.StringValue)
+			err := conn.Invoke(context.Background(), "/"+ServiceName+"/Metadata", wrapperspb.String(tt.request), resp)
+			assert.Equal(t, tt.code, status.Code(err))
+			if tt.code == codes.OK {
+				assert.Equal(t, tt.expected, resp.GetValue())
+			}
+		})
+	}
+}
+
+func TestHealth(t *testing.T) {
+	s := New(mockFetch)
+	conn := startServer(t, s)
+	client := healthpb.NewHealthClient(conn)
+
+	for _, service := range []string{"", ServiceName} {
+		resp, err := client.Check(context.Background(), &healthpb.HealthCheckRequest{Service: service})
+		require.NoError(t, err)
+		assert.Equal(t, healthpb.HealthCheckResponse_SERVING, resp.GetStatus())
+	}
+
+	s.Drain()
+	resp, err := client.Check(context.Background(), &healthpb.HealthCheckRequest{Service: ServiceName})
+	require.NoError(t, err)
+	assert.Equal(t, healthpb.HealthCheckResponse_NOT_SERVING, resp.GetStatus())
+}
+
+func TestShutdown(t *testing.T) {
+	s := New(mockFetch)
+	startServer(t, s)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	done := make(chan struct{})
+	go func() {
+		s.Shutdown(ctx)
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("shutdown did not complete")
+	}
+}
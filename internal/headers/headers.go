@@ -0,0 +1,91 @@
+// Package headers implements an endpoint that returns the inbound request
+// headers.
+//
+// It shows the headers as they arrived after the sidecar, so Istio header
+// manipulation and the propagation of tracing headers can be verified with a
+// curl instead of a packet capture. On request, the headers set by Envoy,
+// B3 and W3C tracing and X-Forwarded-* are repeated in a dedicated section.
+package headers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"istio-test/internal/observability"
+)
+
+// HighlightParam adds the highlighted section to the response when true
+const HighlightParam = "highlight"
+
+// Response holds the inbound request headers
+type Response struct {
+	Headers     map[string][]string `json:"headers"`
+	Highlighted *Highlighted        `json:"highlighted,omitempty"`
+}
+
+// Highlighted holds the headers set or propagated by the mesh
+type Highlighted struct {
+	Envoy        map[string][]string `json:"envoy"`         // x-envoy-*
+	B3           map[string][]string `json:"b3"`            // x-b3-*
+	TraceContext map[string][]string `json:"trace_context"` // traceparent
+	Forwarded    map[string][]string `json:"forwarded"`     // x-forwarded-*
+}
+
+// add adds a header to the section of Highlighted it belongs to
+func (h *Highlighted) add(name string, values []string) {
+	lower := strings.ToLower(name)
+	switch {
+	case strings.HasPrefix(lower, "x-envoy-"):
+		h.Envoy[name] = values
+	case strings.HasPrefix(lower, "x-b3-"):
+		h.B3[name] = values
+	case lower == "traceparent":
+		h.TraceContext[name] = values
+	case strings.HasPrefix(lower, "x-forwarded-"):
+		h.Forwarded[name] = values
+	}
+}
+
+// Handler returns the request headers as JSON, with the highlighted section
+// when the highlight query parameter is true
+func Handler(w http.ResponseWriter, r *http.Request) {
+	highlight := false
+	if value := r.URL.Query().Get(HighlightParam); value != "" {
+		var err error
+		if highlight, err = strconv.ParseBool(value); err != nil {
+			http.Error(w, fmt.Sprintf("Invalid %s parameter: must be true or false", HighlightParam), http.StatusBadRequest)
+			return
+		}
+	}
+
+	// Host is removed from the header map by net/http, keep it in Headers too
+	headers := r.Header.Clone()
+	headers.Set("Host", r.Host)
+
+	response := Response{Headers: headers}
+	if highlight {
+		response.Highlighted = &Highlighted{
+			Envoy:        map[string][]string{},
+			B3:           map[string][]string{},
+			TraceContext: map[string][]string{},
+			Forwarded:    map[string][]string{},
+		}
+		for name, values := range headers {
+			response.Highlighted.add(name, values)
+		}
+	}
+
+	jsonData, err := json.Marshal(response)
+	if err != nil {
+		observability.ErrorWithContext(r.Context(), fmt.Sprintf("Error encoding headers response: %v", err))
+		http.Error(w, "Failed to encode headers response", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write(jsonData)
+}
@@ -0,0 +1,59 @@
+package headers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newMeshRequest returns a request carrying the headers a sidecar adds
+func newMeshRequest(target string) *http.Request {
+	req := httptest.NewRequest(http.MethodGet, target, nil)
+	req.Header.Set("X-Envoy-Attempt-Count", "1")
+	req.Header.Set("X-B3-Traceid", "80f198ee56343ba864fe8b2a57d3eff7")
+	req.Header.Set("X-B3-Sampled", "1")
+	req.Header.Set("Traceparent", "00-80f198ee56343ba864fe8b2a57d3eff7-e457b5a2e4d86bd1-01")
+	req.Header.Set("X-Forwarded-Proto", "https")
+	req.Header.Set("X-Custom", "value")
+	return req
+}
+
+func TestHandler(t *testing.T) {
+	w := httptest.NewRecorder()
+	Handler(w, newMeshRequest("/istio-test/headers"))
+
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "application/json", w.Header().Get("Content-Type"))
+
+	var response Response
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	assert.Equal(t, []string{"example.com"}, response.Headers["Host"])
+	assert.Equal(t, []string{"value"}, response.Headers["X-Custom"])
+	assert.Equal(t, []string{"1"}, response.Headers["X-Envoy-Attempt-Count"])
+	assert.Nil(t, response.Highlighted)
+}
+
+func TestHandlerHighlight(t *testing.T) {
+	w := httptest.NewRecorder()
+	Handler(w, newMeshRequest("/istio-test/headers?highlight=true"))
+
+	require.Equal(t, http.StatusOK, w.Code)
+	var response Response
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	require.NotNil(t, response.Highlighted)
+	assert.Equal(t, map[string][]string{"X-Envoy-Attempt-Count": {"1"}}, response.Highlighted.Envoy)
+	assert.Len(t, response.Highlighted.B3, 2)
+	assert.Contains(t, response.Highlighted.TraceContext, "Traceparent")
+	assert.Equal(t, map[string][]string{"X-Forwarded-Proto": {"https"}}, response.Highlighted.Forwarded)
+	assert.Contains(t, response.Headers, "X-Custom", "highlighted headers are also in the full list")
+}
+
+func TestHandlerInvalidHighlight(t *testing.T) {
+	w := httptest.NewRecorder()
+	Handler(w, httptest.NewRequest(http.MethodGet, "/istio-test/headers?highlight=maybe", nil))
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
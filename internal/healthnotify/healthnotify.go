@@ -0,0 +1,163 @@
+// Package healthnotify posts changes of the overall health status to a
+// webhook.
+//
+// A pod whose checks reach the metadata server, DNS and its dependencies
+// through the mesh is a canary for the mesh itself: when its health degrades,
+// something between the pod and its dependencies changed. The notifier sends
+// every transition of the health checker, with the checks failing at the
+// time, to a webhook such as a Slack incoming webhook or an alerting relay.
+package healthnotify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"maps"
+	"net/http"
+	"slices"
+	"strings"
+
+	"istio-test/internal/httpclient"
+	"istio-test/internal/metadata"
+	"istio-test/internal/observability"
+	"istio-test/internal/version"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// DefaultQueueSize is the number of notifications waiting to be sent before
+// new ones are dropped
+const DefaultQueueSize = 16
+
+var notifications = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Namespace: "istio_test",
+	Name:      "health_webhook_notifications_total",
+	Help:      "Total number of health transition notifications by result: sent, failed or dropped.",
+}, []string{"result"})
+
+func init() {
+	observability.MetricsRegistry().MustRegister(notifications)
+}
+
+// Notification is the JSON body posted to the webhook
+type Notification struct {
+	Text     string `json:"text"`     // One-line summary, displayed by Slack incoming webhooks
+	Instance string `json:"instance"` // Pod name
+	Version  string `json:"version"`
+	metadata.HealthTransition
+}
+
+// Options configures the notifier
+type Options struct {
+	URL       string // Webhook receiving the notifications
+	Instance  string // Identifies the pod in notifications
+	QueueSize int    // Notifications waiting to be sent, zero uses DefaultQueueSize
+}
+
+// Notifier posts health transitions to a webhook in the background, so slow
+// or failing webhooks never delay the health checks
+type Notifier struct {
+	client  *httpclient.Client
+	options Options
+	queue   chan Notification
+}
+
+// New creates a notifier sending through client; call Run to start sending
+func New(client *httpclient.Client, options Options) *Notifier {
+	if options.QueueSize <= 0 {
+		options.QueueSize = DefaultQueueSize
+	}
+	return &Notifier{client: client, options: options, queue: make(chan Notification, options.QueueSize)}
+}
+
+// summary returns the one-line text of a notification
+func summary(instance string, transition metadata.HealthTransition) string {
+	from := string(transition.From)
+	if from == "" {
+		from = "starting"
+	}
+	name := "istio-test"
+	if instance != "" {
+		name += " " + instance
+	}
+	text := fmt.Sprintf("%s: health %s → %s", name, from, transition.To)
+	if len(transition.Failing) > 0 {
+		text += fmt.Sprintf(" (failing: %s)", strings.Join(slices.Sorted(maps.Keys(transition.Failing)), ", "))
+	}
+	return text
+}
+
+// Notify queues a notification of transition, dropping it when the queue is
+// full; it never blocks
+func (n *Notifier) Notify(ctx context.Context, transition metadata.HealthTransition) {
+	notification := Notification{
+		Text:             summary(n.options.Instance, transition),
+		Instance:         n.options.Instance,
+		Version:          version.Get().Version,
+		HealthTransition: transition,
+	}
+	select {
+	case n.queue <- notification:
+	default:
+		notifications.WithLabelValues("dropped").Inc()
+		observability.WarnWithContext(ctx, fmt.Sprintf("Health webhook queue is full, dropping notification: %s", notification.Text))
+	}
+}
+
+// Run sends queued notifications until ctx is done
+func (n *Notifier) Run(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case notification := <-n.queue:
+			if err := n.send(ctx, notification); err != nil {
+				notifications.WithLabelValues("failed").Inc()
+				// The URL is left out, webhook URLs usually embed a secret
+				observability.WarnWithFields(ctx, fmt.Sprintf("Failed to send health notification: %v", err), map[string]any{
+					"type": "health_webhook",
+					"to":   notification.To,
+				})
+				continue
+			}
+			notifications.WithLabelValues("sent").Inc()
+		}
+	}
+}
+
+// send posts one notification, retried by the client's retry policy
+func (n *Notifier) send(ctx context.Context, notification Notification) error {
+	body, err := json.Marshal(notification)
+	if err != nil {
+		return fmt.Errorf("error encoding notification: %w", err)
+	}
+	resp, err := n.client.Do(ctx, func(ctx context.Context) (*http.Request, error) {
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, n.options.URL, bytes.NewReader(body))
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Content-Type", "application/json")
+		return req, nil
+	})
+	if err != nil {
+		// Transport errors can quote the URL
+		return fmt.Errorf("webhook request failed: %w", redactURL(err, n.options.URL))
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, resp.Body)
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook responded with status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// redactURL replaces url in the message of err
+func redactURL(err error, url string) error {
+	if url == "" || !strings.Contains(err.Error(), url) {
+		return err
+	}
+	return fmt.Errorf("%s", strings.ReplaceAll(err.Error(), url, "<webhook>"))
+}
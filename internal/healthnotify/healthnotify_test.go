@@ -0,0 +1,103 @@
+package healthnotify
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"istio-test/internal/httpclient"
+	"istio-test/internal/httpretry"
+	"istio-test/internal/metadata"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var testTransition = metadata.HealthTransition{
+	Time: time.Date(2026, 10, 15, 12, 0, 0, 0, time.UTC),
+	From: metadata.HealthStatusHealthy,
+	To:   metadata.HealthStatusUnhealthy,
+	Failing: map[string]metadata.HealthCheck{
+		"metadata_service": {Status: metadata.HealthStatusUnhealthy, Message: "connection refused"},
+		"dns":              {Status: metadata.HealthStatusUnhealthy, Message: "no such host"},
+	},
+}
+
+func testClient(server *httptest.Server) *httpclient.Client {
+	return &httpclient.Client{Name: httpclient.ClientWebhook, HTTP: server.Client(), Retry: httpretry.Policy{MaxAttempts: 1}}
+}
+
+func TestSummary(t *testing.T) {
+	assert.Equal(t, "istio-test pod-a: health healthy → unhealthy (failing: dns, metadata_service)", summary("pod-a", testTransition))
+	assert.Equal(t, "istio-test: health starting → degraded", summary("", metadata.HealthTransition{To: metadata.HealthStatusDegraded}))
+}
+
+func TestNotifier(t *testing.T) {
+	received := make(chan Notification, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, http.MethodPost, r.Method)
+		assert.Equal(t, "application/json", r.Header.Get("Content-Type"))
+		var notification Notification
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&notification))
+		received <- notification
+	}))
+	defer server.Close()
+
+	notifier := New(testClient(server), Options{URL: server.URL, Instance: "pod-a"})
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go notifier.Run(ctx)
+
+	sent := testutil.ToFloat64(notifications.WithLabelValues("sent"))
+	notifier.Notify(ctx, testTransition)
+
+	select {
+	case notification := <-received:
+		assert.Equal(t, "pod-a", notification.Instance)
+		assert.Contains(t, notification.Text, "healthy → unhealthy")
+		assert.Equal(t, testTransition.To, notification.To)
+		assert.Equal(t, "no such host", notification.Failing["dns"].Message)
+	case <-time.After(time.Second):
+		t.Fatal("notification not sent")
+	}
+	assert.Eventually(t, func() bool {
+		return testutil.ToFloat64(notifications.WithLabelValues("sent")) == sent+1
+	}, time.Second, 5*time.Millisecond)
+}
+
+func TestNotifierDropsWhenFull(t *testing.T) {
+	notifier := New(nil, Options{QueueSize: 1})
+	dropped := testutil.ToFloat64(notifications.WithLabelValues("dropped"))
+
+	// Nothing runs, so the second notification finds the queue full
+	notifier.Notify(context.Background(), testTransition)
+	notifier.Notify(context.Background(), testTransition)
+	assert.Equal(t, dropped+1, testutil.ToFloat64(notifications.WithLabelValues("dropped")))
+}
+
+func TestSendErrors(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusForbidden)
+	}))
+	defer server.Close()
+
+	notifier := New(testClient(server), Options{URL: server.URL + "/services/secret"})
+	err := notifier.send(context.Background(), Notification{})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "status 403")
+
+	server.Close()
+	err = notifier.send(context.Background(), Notification{})
+	require.Error(t, err)
+	assert.NotContains(t, err.Error(), "secret", "webhook URLs are not quoted in errors")
+}
+
+func TestRedactURL(t *testing.T) {
+	err := redactURL(errors.New(`Post "https://hooks.example.com/T0/B0": dial tcp: connection refused`), "https://hooks.example.com/T0/B0")
+	assert.Equal(t, `Post "<webhook>": dial tcp: connection refused`, err.Error())
+}
@@ -0,0 +1,189 @@
+// Package heartbeat sends a low, constant request rate to fixed targets.
+//
+// The heartbeat provides an always-on latency and error baseline, so
+// regressions introduced by mesh configuration changes show up even when no
+// external load test is running. Targets are typically the pod itself through
+// its service name, or a peer service. Heartbeat requests carry the test run
+// ID "heartbeat" and are recorded in the istio_test_heartbeat_* metrics.
+package heartbeat
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	"istio-test/internal/httpclient"
+	"istio-test/internal/observability"
+	"istio-test/internal/testrun"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// TestRunID marks heartbeat requests in logs, metrics and traces
+const TestRunID = "heartbeat"
+
+var (
+	requestDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: "istio_test",
+		Name:      "heartbeat_request_duration_seconds",
+		Help:      "Duration of heartbeat requests in seconds by target and status class.",
+		Buckets:   []float64{.001, .0025, .005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10},
+	}, []string{"target", "status_class"})
+
+	requestErrors = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "istio_test",
+		Name:      "heartbeat_request_errors_total",
+		Help:      "Total number of heartbeat requests that failed without a response.",
+	}, []string{"target"})
+)
+
+func init() {
+	observability.MetricsRegistry().MustRegister(requestDuration, requestErrors)
+}
+
+// Options configures the heartbeat
+type Options struct {
+	Targets  []string      // URLs requested on every tick
+	Interval time.Duration // Time between requests to each target
+}
+
+// TargetStats summarizes the heartbeat requests to a target
+type TargetStats struct {
+	Requests     int64            `json:"requests"`
+	Errors       int64            `json:"errors"`       // Requests that failed without a response
+	StatusClass  map[string]int64 `json:"status_class"` // Responses by status class, e.g. success
+	MeanLatency  float64          `json:"mean_latency_ms"`
+	MaxLatency   float64          `json:"max_latency_ms"`
+	LastLatency  float64          `json:"last_latency_ms"`
+	LastError    string           `json:"last_error,omitempty"`
+	LastResponse *time.Time       `json:"last_response,omitempty"`
+}
+
+// Snapshot is the state of the heartbeat since it started
+type Snapshot struct {
+	Interval string                  `json:"interval"`
+	Targets  map[string]*TargetStats `json:"targets"`
+}
+
+// Heartbeat periodically requests its targets
+type Heartbeat struct {
+	client  *httpclient.Client
+	options Options
+
+	mu    sync.Mutex
+	stats map[string]*TargetStats
+}
+
+// New creates a heartbeat sending requests through client
+func New(client *httpclient.Client, options Options) *Heartbeat {
+	if options.Interval <= 0 {
+		options.Interval = time.Second
+	}
+	return &Heartbeat{client: client, options: options, stats: make(map[string]*TargetStats)}
+}
+
+// Snapshot returns the request statistics of every target
+func (h *Heartbeat) Snapshot() Snapshot {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	snapshot := Snapshot{Interval: h.options.Interval.String(), Targets: make(map[string]*TargetStats, len(h.stats))}
+	for target, stats := range h.stats {
+		copied := *stats
+		copied.StatusClass = make(map[string]int64, len(stats.StatusClass))
+		for class, count := range stats.StatusClass {
+			copied.StatusClass[class] = count
+		}
+		snapshot.Targets[target] = &copied
+	}
+	return snapshot
+}
+
+// record adds the outcome of a request to the statistics of target
+func (h *Heartbeat) record(target string, statusClass string, latency time.Duration, err error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	stats, ok := h.stats[target]
+	if !ok {
+		stats = &TargetStats{StatusClass: make(map[string]int64)}
+		h.stats[target] = stats
+	}
+	stats.Requests++
+	if err != nil {
+		stats.Errors++
+		stats.LastError = err.Error()
+		return
+	}
+
+	ms := float64(latency) / float64(time.Millisecond)
+	responses := stats.Requests - stats.Errors
+	stats.MeanLatency += (ms - stats.MeanLatency) / float64(responses)
+	stats.MaxLatency = max(stats.MaxLatency, ms)
+	stats.LastLatency = ms
+	stats.StatusClass[statusClass]++
+	now := time.Now().UTC()
+	stats.LastResponse = &now
+}
+
+// Run requests every target once per interval until ctx is done. Each target
+// is probed on its own ticker, so a slow target does not delay the others.
+func (h *Heartbeat) Run(ctx context.Context) {
+	ctx = testrun.WithID(ctx, TestRunID)
+
+	var wg sync.WaitGroup
+	for _, target := range h.options.Targets {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			h.run(ctx, target)
+		}()
+	}
+	wg.Wait()
+}
+
+// run requests target once per interval until ctx is done
+func (h *Heartbeat) run(ctx context.Context, target string) {
+	ticker := time.NewTicker(h.options.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			h.probe(ctx, target)
+		}
+	}
+}
+
+// probe requests target once and records the outcome; the request times out
+// after one interval so the next tick of the target is not missed
+func (h *Heartbeat) probe(ctx context.Context, target string) {
+	ctx, cancel := context.WithTimeout(ctx, h.options.Interval)
+	defer cancel()
+
+	start := time.Now()
+	resp, err := h.client.Do(ctx, func(ctx context.Context) (*http.Request, error) {
+		return http.NewRequestWithContext(ctx, http.MethodGet, target, nil)
+	})
+	if err != nil {
+		if ctx.Err() == context.Canceled {
+			return
+		}
+		requestErrors.WithLabelValues(target).Inc()
+		h.record(target, "", 0, err)
+		observability.WarnWithContext(ctx, fmt.Sprintf("Heartbeat to %s failed: %v", target, err))
+		return
+	}
+	_, _ = io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+
+	latency := time.Since(start)
+	statusClass := observability.StatusClass(resp.StatusCode)
+	requestDuration.WithLabelValues(target, statusClass).Observe(latency.Seconds())
+	h.record(target, statusClass, latency, nil)
+}
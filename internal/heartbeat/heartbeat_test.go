@@ -0,0 +1,123 @@
+package heartbeat
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"istio-test/internal/httpclient"
+	"istio-test/internal/testrun"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRun(t *testing.T) {
+	runIDs := make(chan string, 100)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case runIDs <- r.Header.Get(testrun.Header):
+		default:
+		}
+	}))
+	defer ts.Close()
+
+	// The second target refuses connections
+	unreachable := httptest.NewServer(http.NotFoundHandler())
+	unreachableURL := unreachable.URL
+	unreachable.Close()
+
+	client := httpclient.NewFactory(nil, nil).Client("heartbeat-test")
+	h := New(client, Options{Targets: []string{ts.URL, unreachableURL}, Interval: 10 * time.Millisecond})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		h.Run(ctx)
+		close(done)
+	}()
+
+	select {
+	case id := <-runIDs:
+		assert.Equal(t, TestRunID, id)
+	case <-time.After(5 * time.Second):
+		t.Fatal("no heartbeat received")
+	}
+	assert.Eventually(t, func() bool {
+		return testutil.ToFloat64(requestErrors.WithLabelValues(unreachableURL)) > 0
+	}, 5*time.Second, 10*time.Millisecond)
+	assert.Eventually(t, func() bool {
+		stats := h.Snapshot().Targets[ts.URL]
+		return stats != nil && stats.Requests > 0
+	}, 5*time.Second, 10*time.Millisecond)
+
+	cancel()
+	<-done
+	assert.Positive(t, testutil.CollectAndCount(requestDuration, "istio_test_heartbeat_request_duration_seconds"))
+
+	snapshot := h.Snapshot()
+	assert.Equal(t, "10ms", snapshot.Interval)
+	reached := snapshot.Targets[ts.URL]
+	assert.Equal(t, reached.Requests, reached.StatusClass["success"]+reached.Errors)
+	assert.Equal(t, snapshot.Targets[unreachableURL].Requests, snapshot.Targets[unreachableURL].Errors)
+	assert.NotEmpty(t, snapshot.Targets[unreachableURL].LastError)
+}
+
+func TestRunSlowTarget(t *testing.T) {
+	slowEntered := make(chan struct{}, 1)
+	release := make(chan struct{})
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case slowEntered <- struct{}{}:
+		default:
+		}
+		select {
+		case <-release:
+		case <-r.Context().Done():
+		}
+	}))
+	defer slow.Close()
+	defer close(release)
+
+	fastReached := make(chan struct{}, 1)
+	fast := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case fastReached <- struct{}{}:
+		default:
+		}
+	}))
+	defer fast.Close()
+
+	client := httpclient.NewFactory(nil, nil).Client("heartbeat-slow")
+	h := New(client, Options{Targets: []string{slow.URL, fast.URL}, Interval: time.Second})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		h.Run(ctx)
+		close(done)
+	}()
+	defer func() {
+		cancel()
+		<-done
+	}()
+
+	select {
+	case <-slowEntered:
+	case <-time.After(5 * time.Second):
+		t.Fatal("no heartbeat to the slow target")
+	}
+	// The fast target is probed while the slow request is still pending
+	select {
+	case <-fastReached:
+	case <-time.After(500 * time.Millisecond):
+		t.Fatal("the slow target delayed the heartbeat to the fast target")
+	}
+}
+
+func TestNewDefaultInterval(t *testing.T) {
+	h := New(httpclient.NewFactory(nil, nil).Client("heartbeat-default"), Options{})
+	assert.Equal(t, time.Second, h.options.Interval)
+}
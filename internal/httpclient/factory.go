@@ -0,0 +1,210 @@
+package httpclient
+
+import (
+	"context"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"istio-test/internal/deadline"
+	"istio-test/internal/httpretry"
+	"istio-test/internal/observability"
+	"istio-test/internal/testrun"
+
+	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace"
+
+	httptrace "gopkg.in/DataDog/dd-trace-go.v1/contrib/net/http"
+)
+
+// Names of the outbound clients built by the application
+const (
+	ClientMetadata  = "metadata"
+	ClientFanout    = "fanout"
+	ClientEgress    = "egress"
+	ClientProbes    = "probes"
+	ClientCatalog   = "catalog"
+	ClientHeartbeat = "heartbeat"
+	ClientSidecar   = "sidecar"
+	ClientArtifacts = "artifacts"
+	ClientMirror    = "mirror"
+	ClientJWKS      = "jwks"
+	ClientWebhook   = "webhook"
+)
+
+// TestRunTag is the span tag carrying the test run ID
+const TestRunTag = observability.TestRunTag
+
+// ClientOptions configures a named outbound client
+type ClientOptions struct {
+	Timeout             time.Duration    // Overall request timeout, zero means none
+	Retry               httpretry.Policy // Retry policy applied by Client.Do
+	MaxIdleConnsPerHost int              // Idle connections kept per host, zero uses the transport default
+	IdleConnTimeout     time.Duration    // How long idle connections are kept, zero uses the transport default
+	DisableKeepAlives   bool             // Open a new connection for every request
+	Tracing             bool             // Create a client span for every request
+}
+
+// DefaultClientOptions returns the options used for clients without explicit configuration
+func DefaultClientOptions() ClientOptions {
+	return ClientOptions{
+		Timeout: 10 * time.Second,
+		Retry:   httpretry.Policy{MaxAttempts: 1},
+		Tracing: true,
+	}
+}
+
+// Client is a named outbound client
+type Client struct {
+	Name  string
+	HTTP  *http.Client
+	Retry httpretry.Policy
+}
+
+// Do sends the request built by newRequest using the client's retry policy
+func (c *Client) Do(ctx context.Context, newRequest func(ctx context.Context) (*http.Request, error)) (*http.Response, error) {
+	return c.Retry.Do(ctx, c.HTTP, newRequest)
+}
+
+// WithCheckRedirect returns a copy of the client that shares its transport and
+// retry policy but decides whether to follow redirects with check
+func (c *Client) WithCheckRedirect(check func(req *http.Request, via []*http.Request) error) *Client {
+	httpClient := *c.HTTP
+	httpClient.CheckRedirect = check
+	return &Client{Name: c.Name, HTTP: &httpClient, Retry: c.Retry}
+}
+
+// Factory builds named outbound clients that share a TLS policy. Each client
+// gets its own connection pool and connection statistics, so outbound paths
+// can be tuned and observed independently.
+type Factory struct {
+	mu      sync.Mutex
+	policy  *TLSPolicy
+	options map[string]ClientOptions
+	clients map[string]*Client
+}
+
+// NewFactory creates a client factory; clients without options use DefaultClientOptions
+func NewFactory(policy *TLSPolicy, options map[string]ClientOptions) *Factory {
+	return &Factory{
+		policy:  policy,
+		options: options,
+		clients: make(map[string]*Client),
+	}
+}
+
+// Client returns the client registered under name, building it on first use
+func (f *Factory) Client(name string) *Client {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if client, ok := f.clients[name]; ok {
+		return client
+	}
+
+	options, ok := f.options[name]
+	if !ok {
+		options = DefaultClientOptions()
+	}
+	client := newClient(name, f.policy, options)
+	f.clients[name] = client
+	return client
+}
+
+// Names returns the names of the clients built so far in sorted order
+func (f *Factory) Names() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	names := make([]string, 0, len(f.clients))
+	for name := range f.clients {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// TracingTransport wraps next so every request gets a client span named after
+// the client, tagged with the test run ID and the retry attempt. The span is
+// created with OpenTelemetry while it is the active tracer, Datadog otherwise;
+// the choice is made per request, so clients built before the tracer started
+// are traced too.
+func TracingTransport(name string, next http.RoundTripper) http.RoundTripper {
+	resourceName := func(req *http.Request) string {
+		return name + " " + req.Method
+	}
+	return &tracingTransport{
+		next: next,
+		otel: observability.OTelTransport(next, resourceName, func(req *http.Request, span observability.Span) {
+			tagRequest(req, span.SetTag)
+		}),
+		datadog: httptrace.WrapRoundTripper(next,
+			httptrace.RTWithResourceNamer(resourceName),
+			httptrace.WithBefore(func(req *http.Request, span ddtrace.Span) {
+				tagRequest(req, span.SetTag)
+			}),
+		),
+	}
+}
+
+// tracingTransport sends requests through the transport of the active tracer
+type tracingTransport struct {
+	next    http.RoundTripper
+	otel    http.RoundTripper
+	datadog http.RoundTripper
+}
+
+func (t *tracingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if observability.OTelTracing() {
+		return t.otel.RoundTrip(req)
+	}
+	return t.datadog.RoundTrip(req)
+}
+
+// Unwrap returns the transport wrapped by the tracing
+func (t *tracingTransport) Unwrap() http.RoundTripper {
+	return t.next
+}
+
+// tagRequest sets the test run and retry attempt tags of an outbound request
+func tagRequest(req *http.Request, setTag func(key string, value any)) {
+	if id := testrun.FromContext(req.Context()); id != "" {
+		setTag(TestRunTag, id)
+	}
+	if attempt := httpretry.AttemptFromContext(req.Context()); attempt > 0 {
+		setTag(httpretry.AttemptTag, attempt)
+	}
+}
+
+// newClient builds a client with its own transport
+func newClient(name string, policy *TLSPolicy, options ClientOptions) *Client {
+	transport := NewTransport(policy)
+	if options.MaxIdleConnsPerHost > 0 {
+		transport.MaxIdleConnsPerHost = options.MaxIdleConnsPerHost
+	}
+	if options.IdleConnTimeout > 0 {
+		transport.IdleConnTimeout = options.IdleConnTimeout
+	}
+	transport.DisableKeepAlives = options.DisableKeepAlives
+
+	// Outbound requests carry the remaining deadline and test run ID of the inbound
+	// request; requests with an SNI override get a connection pool of their own
+	rt := testrun.Transport(deadline.Transport(NewSNITransports(policy, transport)))
+	if options.Tracing {
+		rt = TracingTransport(name, rt)
+	}
+
+	retry := options.Retry
+	if retry.SpanName == "" {
+		retry.SpanName = name + ".request"
+	}
+
+	return &Client{
+		Name: name,
+		HTTP: &http.Client{
+			Timeout:   options.Timeout,
+			Transport: Instrument(name, rt),
+		},
+		Retry: retry,
+	}
+}
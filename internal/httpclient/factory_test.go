@@ -0,0 +1,128 @@
+package httpclient
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"istio-test/internal/httpretry"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/mocktracer"
+)
+
+// unwrap follows Unwrap methods down to the innermost transport
+func unwrap(rt http.RoundTripper) *http.Transport {
+	for {
+		switch t := rt.(type) {
+		case *http.Transport:
+			return t
+		case interface{ Unwrap() http.RoundTripper }:
+			rt = t.Unwrap()
+		default:
+			return nil
+		}
+	}
+}
+
+func TestFactory(t *testing.T) {
+	factory := NewFactory(nil, map[string]ClientOptions{
+		"factory-fanout": {
+			Timeout:             2 * time.Second,
+			Retry:               httpretry.Policy{MaxAttempts: 3},
+			MaxIdleConnsPerHost: 7,
+			DisableKeepAlives:   true,
+		},
+	})
+
+	t.Run("configured client", func(t *testing.T) {
+		client := factory.Client("factory-fanout")
+		assert.Equal(t, "factory-fanout", client.Name)
+		assert.Equal(t, 2*time.Second, client.HTTP.Timeout)
+		assert.Equal(t, 3, client.Retry.MaxAttempts)
+		assert.Equal(t, "factory-fanout.request", client.Retry.SpanName)
+		assert.Same(t, client, factory.Client("factory-fanout"))
+
+		transport := unwrap(client.HTTP.Transport.(*instrumentedTransport).next)
+		assert.Equal(t, 7, transport.MaxIdleConnsPerHost)
+		assert.True(t, transport.DisableKeepAlives)
+	})
+
+	t.Run("unconfigured client uses defaults", func(t *testing.T) {
+		client := factory.Client("factory-probes")
+		assert.Equal(t, DefaultClientOptions().Timeout, client.HTTP.Timeout)
+		assert.Equal(t, 1, client.Retry.MaxAttempts)
+		assert.NotSame(t, factory.Client("factory-fanout").HTTP.Transport, client.HTTP.Transport)
+	})
+
+	assert.Equal(t, []string{"factory-fanout", "factory-probes"}, factory.Names())
+}
+
+func TestClientDo(t *testing.T) {
+	var calls atomic.Int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if calls.Add(1) == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte("ok"))
+	}))
+	defer ts.Close()
+
+	factory := NewFactory(nil, map[string]ClientOptions{
+		"factory-retry": {
+			Timeout: time.Second,
+			Retry:   httpretry.Policy{MaxAttempts: 2, BaseDelay: time.Millisecond},
+			Tracing: true,
+		},
+	})
+	client := factory.Client("factory-retry")
+
+	resp, err := client.Do(context.Background(), func(ctx context.Context) (*http.Request, error) {
+		return http.NewRequestWithContext(ctx, "GET", ts.URL, nil)
+	})
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "ok", string(body))
+	assert.Equal(t, int32(2), calls.Load())
+	assert.Equal(t, int64(2), Stats()["factory-retry"].Requests)
+}
+
+func TestTracingTransport(t *testing.T) {
+	tracer := mocktracer.Start()
+	defer tracer.Stop()
+
+	var calls atomic.Int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if calls.Add(1) == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer ts.Close()
+
+	client := &http.Client{Transport: TracingTransport("tracing-test", http.DefaultTransport)}
+	policy := httpretry.Policy{MaxAttempts: 2, BaseDelay: time.Millisecond}
+	resp, err := policy.Do(context.Background(), client, func(ctx context.Context) (*http.Request, error) {
+		return http.NewRequestWithContext(ctx, "GET", ts.URL, nil)
+	})
+	require.NoError(t, err)
+	resp.Body.Close()
+
+	var attempts []any
+	for _, span := range tracer.FinishedSpans() {
+		if span.Tag("resource.name") == "tracing-test GET" {
+			attempts = append(attempts, span.Tag(httpretry.AttemptTag))
+		}
+	}
+	// Datadog stores numeric tags as float64
+	assert.Equal(t, []any{1.0, 2.0}, attempts)
+	assert.Same(t, http.DefaultTransport, client.Transport.(*tracingTransport).Unwrap())
+}
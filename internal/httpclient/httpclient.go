@@ -0,0 +1,468 @@
+// Package httpclient builds the clients and transports used for
+// application-originated outbound calls.
+//
+// A Factory hands out named clients (metadata, fanout, egress, probes), each
+// with its own timeout, retry policy, connection pool and tracing, so every
+// outbound path behaves consistently and can be observed on its own.
+//
+// Outbound calls can present a client certificate and pin a CA bundle per
+// target host, so app-originated mTLS can be compared against sidecar-originated
+// mTLS when PeerAuthentication is DISABLE or PERMISSIVE. Allowlisted Host header
+// and SNI overrides make ServiceEntry resolution and SNI-based routing at egress
+// gateways testable. Instrumented transports count new versus reused connections,
+// DNS lookups and TLS handshakes so keep-alive behavior through the sidecar can
+// be quantified.
+package httpclient
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptrace"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"istio-test/internal/observability"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// TLSOptions describes the certificate material used for outbound TLS
+type TLSOptions struct {
+	CertFile  string            // Client certificate presented to targets (PEM)
+	KeyFile   string            // Private key for CertFile (PEM)
+	CAFile    string            // Default CA bundle, empty uses the system pool
+	TargetCAs map[string]string // CA bundle pinned per target host
+}
+
+// Enabled reports whether any outbound TLS material is configured
+func (o TLSOptions) Enabled() bool {
+	return o.CertFile != "" || o.CAFile != "" || len(o.TargetCAs) > 0
+}
+
+// TLSPolicy selects the TLS configuration used for each target host
+type TLSPolicy struct {
+	defaultConfig *tls.Config
+	targets       map[string]*tls.Config
+}
+
+// LoadTLSPolicy reads the certificate files referenced by options
+func LoadTLSPolicy(options TLSOptions) (*TLSPolicy, error) {
+	var certificates []tls.Certificate
+	if options.CertFile != "" || options.KeyFile != "" {
+		cert, err := tls.LoadX509KeyPair(options.CertFile, options.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("error loading client certificate: %w", err)
+		}
+		certificates = []tls.Certificate{cert}
+	}
+
+	defaultConfig := &tls.Config{
+		MinVersion:   tls.VersionTLS12,
+		Certificates: certificates,
+	}
+	if options.CAFile != "" {
+		pool, err := loadCertPool(options.CAFile)
+		if err != nil {
+			return nil, err
+		}
+		defaultConfig.RootCAs = pool
+	}
+
+	policy := &TLSPolicy{
+		defaultConfig: defaultConfig,
+		targets:       make(map[string]*tls.Config, len(options.TargetCAs)),
+	}
+	for host, caFile := range options.TargetCAs {
+		pool, err := loadCertPool(caFile)
+		if err != nil {
+			return nil, fmt.Errorf("target %s: %w", host, err)
+		}
+		targetConfig := defaultConfig.Clone()
+		targetConfig.RootCAs = pool
+		policy.targets[strings.ToLower(host)] = targetConfig
+	}
+
+	return policy, nil
+}
+
+// loadCertPool reads a PEM CA bundle into a certificate pool
+func loadCertPool(caFile string) (*x509.CertPool, error) {
+	pem, err := os.ReadFile(caFile)
+	if err != nil {
+		return nil, fmt.Errorf("error reading CA bundle: %w", err)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(pem) {
+		return nil, fmt.Errorf("no certificates found in CA bundle %s", caFile)
+	}
+	return pool, nil
+}
+
+// ConfigFor returns the TLS configuration for the given host, with the server
+// name set for verification
+func (p *TLSPolicy) ConfigFor(host string) *tls.Config {
+	base, ok := p.targets[strings.ToLower(host)]
+	if !ok {
+		base = p.defaultConfig
+	}
+
+	cfg := base.Clone()
+	if cfg.ServerName == "" {
+		cfg.ServerName = host
+	}
+	return cfg
+}
+
+// PinnedTargets returns the number of targets with a pinned CA bundle
+func (p *TLSPolicy) PinnedTargets() int {
+	return len(p.targets)
+}
+
+// NewTransport returns a transport that dials TLS connections using policy. A nil
+// policy returns a clone of the default transport.
+func NewTransport(policy *TLSPolicy) *http.Transport {
+	return newTransport(policy, "")
+}
+
+// newTransport returns a transport dialing TLS with policy, using sni as the
+// server name when set
+func newTransport(policy *TLSPolicy, sni string) *http.Transport {
+	return withTLS(http.DefaultTransport.(*http.Transport).Clone(), policy, sni)
+}
+
+// withTLS makes transport dial TLS with policy, using sni as the server name
+// when set
+func withTLS(transport *http.Transport, policy *TLSPolicy, sni string) *http.Transport {
+	if policy == nil && sni == "" {
+		return transport
+	}
+	if policy == nil {
+		policy = &TLSPolicy{defaultConfig: &tls.Config{MinVersion: tls.VersionTLS12}}
+	}
+
+	transport.DialTLSContext = func(ctx context.Context, network, addr string) (net.Conn, error) {
+		host, _, err := net.SplitHostPort(addr)
+		if err != nil {
+			host = addr
+		}
+		cfg := policy.ConfigFor(host)
+		if sni != "" {
+			cfg.ServerName = sni
+		}
+		dialer := &tls.Dialer{Config: cfg}
+		return dialer.DialContext(ctx, network, addr)
+	}
+	return transport
+}
+
+// Allowlist restricts the hosts that may be used as Host header or SNI overrides.
+// Entries match exactly or, when prefixed with "*.", any subdomain.
+type Allowlist []string
+
+// Allows reports whether host matches an allowlist entry
+func (a Allowlist) Allows(host string) bool {
+	host = strings.ToLower(host)
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	for _, entry := range a {
+		entry = strings.ToLower(entry)
+		if suffix, ok := strings.CutPrefix(entry, "*"); ok && strings.HasPrefix(suffix, ".") {
+			if strings.HasSuffix(host, suffix) && len(host) > len(suffix) {
+				return true
+			}
+			continue
+		}
+		if host == entry {
+			return true
+		}
+	}
+	return false
+}
+
+// maxRedirects is the number of redirects followed by CheckRedirect, the
+// net/http default
+const maxRedirects = 10
+
+// CheckRedirect is an http.Client CheckRedirect function that follows a
+// redirect only to an allowlisted host, so an allowlisted target cannot send a
+// call on to arbitrary hosts such as the metadata server
+func (a Allowlist) CheckRedirect(req *http.Request, via []*http.Request) error {
+	if len(via) >= maxRedirects {
+		return fmt.Errorf("stopped after %d redirects", maxRedirects)
+	}
+	if !a.Allows(req.URL.Host) {
+		return fmt.Errorf("redirect to host %s is not allowlisted", req.URL.Hostname())
+	}
+	return nil
+}
+
+// Overrides holds explicit Host header and TLS SNI values for an outbound request
+type Overrides struct {
+	Host string // Host header sent instead of the URL host
+	SNI  string // TLS server name sent instead of the URL host
+}
+
+// Validate checks that every set override is allowlisted
+func (o Overrides) Validate(allowlist Allowlist) error {
+	if o.Host != "" && !allowlist.Allows(o.Host) {
+		return fmt.Errorf("host override %q is not allowlisted", o.Host)
+	}
+	if o.SNI != "" && !allowlist.Allows(o.SNI) {
+		return fmt.Errorf("SNI override %q is not allowlisted", o.SNI)
+	}
+	return nil
+}
+
+// Apply sets the Host header override on req and returns it with the SNI
+// override attached to its context, where clients of a Factory pick it up
+func (o Overrides) Apply(req *http.Request) *http.Request {
+	if o.Host != "" {
+		req.Host = o.Host
+	}
+	if o.SNI != "" {
+		req = req.WithContext(WithSNI(req.Context(), o.SNI))
+	}
+	return req
+}
+
+type sniContextKey struct{}
+
+// WithSNI returns a context whose outbound requests are sent with sni as the
+// TLS server name by transports of SNITransports
+func WithSNI(ctx context.Context, sni string) context.Context {
+	return context.WithValue(ctx, sniContextKey{}, sni)
+}
+
+// SNIFromContext returns the SNI override carried by ctx, if any
+func SNIFromContext(ctx context.Context) string {
+	sni, _ := ctx.Value(sniContextKey{}).(string)
+	return sni
+}
+
+// SNITransports hands out transports per SNI override. Each server name gets its
+// own connection pool so a connection negotiated for one name is never reused
+// for another.
+type SNITransports struct {
+	mu         sync.Mutex
+	policy     *TLSPolicy
+	base       http.RoundTripper
+	transports map[string]*http.Transport
+}
+
+// NewSNITransports creates an SNI transport cache; requests without an override use base
+func NewSNITransports(policy *TLSPolicy, base http.RoundTripper) *SNITransports {
+	return &SNITransports{
+		policy:     policy,
+		base:       base,
+		transports: make(map[string]*http.Transport),
+	}
+}
+
+// RoundTripper returns the transport to use for the given SNI override.
+// Transports for overrides are clones of base when it is an *http.Transport,
+// so they keep its connection pool settings.
+func (s *SNITransports) RoundTripper(sni string) http.RoundTripper {
+	if sni == "" {
+		return s.base
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	transport, ok := s.transports[sni]
+	if !ok {
+		if base, isTransport := s.base.(*http.Transport); isTransport {
+			transport = withTLS(base.Clone(), s.policy, sni)
+		} else {
+			transport = newTransport(s.policy, sni)
+		}
+		s.transports[sni] = transport
+	}
+	return transport
+}
+
+// RoundTrip sends req through the transport of the SNI override carried by
+// its context
+func (s *SNITransports) RoundTrip(req *http.Request) (*http.Response, error) {
+	return s.RoundTripper(SNIFromContext(req.Context())).RoundTrip(req)
+}
+
+// Unwrap returns the transport used for requests without an SNI override
+func (s *SNITransports) Unwrap() http.RoundTripper {
+	return s.base
+}
+
+var (
+	outboundConnections = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "istio_test",
+		Name:      "outbound_connections_total",
+		Help:      "Total number of connections used by outbound requests, by client and whether the connection was reused.",
+	}, []string{"client", "reused"})
+
+	outboundDNSLookups = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "istio_test",
+		Name:      "outbound_dns_lookups_total",
+		Help:      "Total number of DNS lookups made by outbound clients, by client.",
+	}, []string{"client"})
+
+	outboundTLSHandshakes = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "istio_test",
+		Name:      "outbound_tls_handshakes_total",
+		Help:      "Total number of TLS handshakes made by outbound clients, by client and outcome (success or failure).",
+	}, []string{"client", "outcome"})
+)
+
+func init() {
+	observability.MetricsRegistry().MustRegister(outboundConnections, outboundDNSLookups, outboundTLSHandshakes)
+}
+
+// ConnStats counts connection usage for one instrumented client
+type ConnStats struct {
+	name            string // Client label of the Prometheus counters
+	requests        atomic.Int64
+	newConns        atomic.Int64
+	reusedConns     atomic.Int64
+	idleConns       atomic.Int64
+	dnsLookups      atomic.Int64
+	tlsHandshakes   atomic.Int64
+	tlsFailures     atomic.Int64
+	connectFailures atomic.Int64
+}
+
+// ConnStatsSnapshot is a point-in-time copy of ConnStats
+type ConnStatsSnapshot struct {
+	Requests          int64   `json:"requests"`
+	NewConnections    int64   `json:"new_connections"`
+	ReusedConnections int64   `json:"reused_connections"`
+	IdleReused        int64   `json:"idle_reused"`
+	DNSLookups        int64   `json:"dns_lookups"`
+	TLSHandshakes     int64   `json:"tls_handshakes"`
+	TLSFailures       int64   `json:"tls_failures"`
+	ConnectFailures   int64   `json:"connect_failures"`
+	ReuseRatio        float64 `json:"reuse_ratio"`
+}
+
+// Snapshot returns the current counter values
+func (s *ConnStats) Snapshot() ConnStatsSnapshot {
+	snapshot := ConnStatsSnapshot{
+		Requests:          s.requests.Load(),
+		NewConnections:    s.newConns.Load(),
+		ReusedConnections: s.reusedConns.Load(),
+		IdleReused:        s.idleConns.Load(),
+		DNSLookups:        s.dnsLookups.Load(),
+		TLSHandshakes:     s.tlsHandshakes.Load(),
+		TLSFailures:       s.tlsFailures.Load(),
+		ConnectFailures:   s.connectFailures.Load(),
+	}
+	if total := snapshot.NewConnections + snapshot.ReusedConnections; total > 0 {
+		snapshot.ReuseRatio = float64(snapshot.ReusedConnections) / float64(total)
+	}
+	return snapshot
+}
+
+// clientTrace returns an httptrace hook set that updates the counters
+func (s *ConnStats) clientTrace() *httptrace.ClientTrace {
+	return &httptrace.ClientTrace{
+		GotConn: func(info httptrace.GotConnInfo) {
+			if info.Reused {
+				s.reusedConns.Add(1)
+			} else {
+				s.newConns.Add(1)
+			}
+			if info.WasIdle {
+				s.idleConns.Add(1)
+			}
+			outboundConnections.WithLabelValues(s.name, strconv.FormatBool(info.Reused)).Inc()
+		},
+		DNSStart: func(httptrace.DNSStartInfo) {
+			s.dnsLookups.Add(1)
+			outboundDNSLookups.WithLabelValues(s.name).Inc()
+		},
+		ConnectDone: func(network, addr string, err error) {
+			if err != nil {
+				s.connectFailures.Add(1)
+			}
+		},
+		TLSHandshakeDone: func(_ tls.ConnectionState, err error) {
+			if err != nil {
+				s.tlsFailures.Add(1)
+				outboundTLSHandshakes.WithLabelValues(s.name, "failure").Inc()
+				return
+			}
+			s.tlsHandshakes.Add(1)
+			outboundTLSHandshakes.WithLabelValues(s.name, "success").Inc()
+		},
+	}
+}
+
+// instrumentedTransport attaches connection tracing to every request
+type instrumentedTransport struct {
+	next  http.RoundTripper
+	stats *ConnStats
+}
+
+func (t *instrumentedTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	t.stats.requests.Add(1)
+	ctx := httptrace.WithClientTrace(req.Context(), t.stats.clientTrace())
+	return t.next.RoundTrip(req.WithContext(ctx))
+}
+
+var (
+	statsMu sync.RWMutex
+	stats   = map[string]*ConnStats{}
+)
+
+// Instrument wraps next so connection usage is counted under name, which is
+// also the client label of the Prometheus counters. Clients instrumented with
+// the same name share counters.
+func Instrument(name string, next http.RoundTripper) http.RoundTripper {
+	statsMu.Lock()
+	defer statsMu.Unlock()
+
+	s, ok := stats[name]
+	if !ok {
+		s = &ConnStats{name: name}
+		stats[name] = s
+	}
+	return &instrumentedTransport{next: next, stats: s}
+}
+
+// Stats returns a snapshot of the connection counters of every instrumented client
+func Stats() map[string]ConnStatsSnapshot {
+	statsMu.RLock()
+	defer statsMu.RUnlock()
+
+	result := make(map[string]ConnStatsSnapshot, len(stats))
+	for name, s := range stats {
+		result[name] = s.Snapshot()
+	}
+	return result
+}
+
+// ConnectionsHandler reports connection reuse statistics of the outbound clients
+func ConnectionsHandler(w http.ResponseWriter, r *http.Request) {
+	response := map[string]any{
+		"timestamp": time.Now().UTC(),
+		"clients":   Stats(),
+	}
+
+	jsonData, err := json.Marshal(response)
+	if err != nil {
+		http.Error(w, "Failed to encode connection statistics", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write(jsonData)
+}
@@ -0,0 +1,258 @@
+package httpclient
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"encoding/pem"
+	"io"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testCA issues certificates for tests
+type testCA struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	pem  []byte
+}
+
+func newTestCA(t *testing.T) *testCA {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "test-ca"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	require.NoError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+
+	return &testCA{cert: cert, key: key, pem: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})}
+}
+
+// issue returns PEM encoded certificate and key signed by the CA
+func (ca *testCA) issue(t *testing.T, usage x509.ExtKeyUsage) ([]byte, []byte) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: "istio-test"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{usage},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, ca.cert, &key.PublicKey, ca.key)
+	require.NoError(t, err)
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	require.NoError(t, err)
+
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+}
+
+func writeFile(t *testing.T, dir, name string, data []byte) string {
+	path := filepath.Join(dir, name)
+	require.NoError(t, os.WriteFile(path, data, 0600))
+	return path
+}
+
+func TestTLSOptionsEnabled(t *testing.T) {
+	assert.False(t, TLSOptions{}.Enabled())
+	assert.True(t, TLSOptions{CAFile: "/ca.pem"}.Enabled())
+	assert.True(t, TLSOptions{TargetCAs: map[string]string{"svc": "/ca.pem"}}.Enabled())
+}
+
+func TestLoadTLSPolicy(t *testing.T) {
+	dir := t.TempDir()
+	ca := newTestCA(t)
+	caFile := writeFile(t, dir, "ca.pem", ca.pem)
+
+	t.Run("missing client certificate", func(t *testing.T) {
+		_, err := LoadTLSPolicy(TLSOptions{CertFile: filepath.Join(dir, "missing.pem"), KeyFile: filepath.Join(dir, "missing.key")})
+		assert.Error(t, err)
+	})
+
+	t.Run("invalid CA bundle", func(t *testing.T) {
+		badCA := writeFile(t, dir, "bad.pem", []byte("not a certificate"))
+		_, err := LoadTLSPolicy(TLSOptions{TargetCAs: map[string]string{"svc": badCA}})
+		assert.Error(t, err)
+		assert.Contains(t, err.Error(), "target svc")
+	})
+
+	t.Run("pinned targets get their own CA", func(t *testing.T) {
+		policy, err := LoadTLSPolicy(TLSOptions{TargetCAs: map[string]string{"Svc-B": caFile}})
+		require.NoError(t, err)
+		assert.Equal(t, 1, policy.PinnedTargets())
+
+		pinned := policy.ConfigFor("svc-b")
+		assert.NotNil(t, pinned.RootCAs)
+		assert.Equal(t, "svc-b", pinned.ServerName)
+
+		other := policy.ConfigFor("svc-c")
+		assert.Nil(t, other.RootCAs)
+		assert.Equal(t, "svc-c", other.ServerName)
+	})
+}
+
+func TestNewTransport(t *testing.T) {
+	dir := t.TempDir()
+	ca := newTestCA(t)
+	serverCert, serverKey := ca.issue(t, x509.ExtKeyUsageServerAuth)
+	clientCert, clientKey := ca.issue(t, x509.ExtKeyUsageClientAuth)
+
+	serverPair, err := tls.X509KeyPair(serverCert, serverKey)
+	require.NoError(t, err)
+	clientCAs := x509.NewCertPool()
+	clientCAs.AddCert(ca.cert)
+
+	ts := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.TLS.PeerCertificates[0].Subject.CommonName))
+	}))
+	ts.TLS = &tls.Config{
+		Certificates: []tls.Certificate{serverPair},
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+		ClientCAs:    clientCAs,
+	}
+	ts.StartTLS()
+	defer ts.Close()
+
+	t.Run("presents client certificate and verifies pinned CA", func(t *testing.T) {
+		policy, err := LoadTLSPolicy(TLSOptions{
+			CertFile:  writeFile(t, dir, "client.pem", clientCert),
+			KeyFile:   writeFile(t, dir, "client.key", clientKey),
+			TargetCAs: map[string]string{"127.0.0.1": writeFile(t, dir, "ca.pem", ca.pem)},
+		})
+		require.NoError(t, err)
+
+		client := &http.Client{Transport: NewTransport(policy)}
+		resp, err := client.Get(ts.URL)
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+	})
+
+	t.Run("fails without the pinned CA", func(t *testing.T) {
+		client := &http.Client{Transport: NewTransport(nil)}
+		_, err := client.Get(ts.URL)
+		assert.Error(t, err)
+	})
+}
+
+func TestAllowlist(t *testing.T) {
+	allowlist := Allowlist{"api.example.com", "*.svc.cluster.local"}
+
+	assert.True(t, allowlist.Allows("api.example.com"))
+	assert.True(t, allowlist.Allows("API.example.com:443"))
+	assert.True(t, allowlist.Allows("reviews.default.svc.cluster.local"))
+	assert.False(t, allowlist.Allows("svc.cluster.local"))
+	assert.False(t, allowlist.Allows("other.example.com"))
+	assert.False(t, Allowlist(nil).Allows("api.example.com"))
+}
+
+func TestOverrides(t *testing.T) {
+	allowlist := Allowlist{"*.example.com"}
+
+	assert.NoError(t, Overrides{}.Validate(allowlist))
+	assert.NoError(t, Overrides{Host: "a.example.com", SNI: "b.example.com"}.Validate(allowlist))
+	assert.Error(t, Overrides{Host: "evil.test"}.Validate(allowlist))
+	assert.Error(t, Overrides{SNI: "evil.test"}.Validate(allowlist))
+
+	req := httptest.NewRequest("GET", "http://target.internal/", nil)
+	req = Overrides{Host: "a.example.com", SNI: "b.example.com"}.Apply(req)
+	assert.Equal(t, "a.example.com", req.Host)
+	assert.Equal(t, "b.example.com", SNIFromContext(req.Context()))
+	assert.Empty(t, SNIFromContext(Overrides{Host: "a.example.com"}.Apply(httptest.NewRequest("GET", "/", nil)).Context()))
+}
+
+func TestSNITransports(t *testing.T) {
+	base := http.DefaultTransport
+	transports := NewSNITransports(nil, base)
+
+	assert.Equal(t, base, transports.RoundTripper(""))
+
+	first := transports.RoundTripper("a.example.com")
+	assert.NotEqual(t, base, first)
+	assert.Same(t, first, transports.RoundTripper("a.example.com"))
+	assert.NotSame(t, first, transports.RoundTripper("b.example.com"))
+
+	t.Run("dials with the overridden server name", func(t *testing.T) {
+		serverNames := make(chan string, 1)
+		ts := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+		ts.TLS = &tls.Config{
+			GetConfigForClient: func(hello *tls.ClientHelloInfo) (*tls.Config, error) {
+				serverNames <- hello.ServerName
+				return nil, nil
+			},
+		}
+		ts.StartTLS()
+		defer ts.Close()
+
+		// The test server certificate is not valid for the overridden name
+		_, err := (&http.Client{Transport: transports.RoundTripper("sni.example.com")}).Get(ts.URL)
+		assert.Error(t, err)
+		assert.Equal(t, "sni.example.com", <-serverNames)
+	})
+}
+
+func TestInstrument(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	}))
+	defer ts.Close()
+
+	client := &http.Client{Transport: Instrument("test-reuse", NewTransport(nil))}
+	for i := 0; i < 3; i++ {
+		resp, err := client.Get(ts.URL)
+		require.NoError(t, err)
+		io.Copy(io.Discard, resp.Body)
+		resp.Body.Close()
+	}
+
+	snapshot := Stats()["test-reuse"]
+	assert.Equal(t, int64(3), snapshot.Requests)
+	assert.Equal(t, int64(1), snapshot.NewConnections)
+	assert.Equal(t, int64(2), snapshot.ReusedConnections)
+	assert.Equal(t, int64(2), snapshot.IdleReused)
+	assert.InDelta(t, 2.0/3.0, snapshot.ReuseRatio, 0.001)
+	assert.Equal(t, 1.0, testutil.ToFloat64(outboundConnections.WithLabelValues("test-reuse", "false")))
+	assert.Equal(t, 2.0, testutil.ToFloat64(outboundConnections.WithLabelValues("test-reuse", "true")))
+
+	t.Run("connections handler reports instrumented clients", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		ConnectionsHandler(w, httptest.NewRequest("GET", "/admin/connections", nil))
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, "application/json", w.Header().Get("Content-Type"))
+
+		var body struct {
+			Clients map[string]ConnStatsSnapshot `json:"clients"`
+		}
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &body))
+		assert.Equal(t, int64(3), body.Clients["test-reuse"].Requests)
+	})
+}
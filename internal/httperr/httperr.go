@@ -0,0 +1,66 @@
+// Package httperr writes error responses as RFC 7807 problem details, so
+// clients and test harnesses can parse errors instead of matching text.
+package httperr
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"istio-test/internal/observability"
+)
+
+// ContentType is the media type of problem detail responses
+const ContentType = "application/problem+json"
+
+// Problem is an RFC 7807 problem detail
+type Problem struct {
+	Type      string `json:"type"`  // URI identifying the problem type, "about:blank" when the status says it all
+	Title     string `json:"title"` // Short summary of the problem type
+	Status    int    `json:"status"`
+	Detail    string `json:"detail,omitempty"`   // Explanation specific to this occurrence
+	Instance  string `json:"instance,omitempty"` // Path of the request
+	RequestID string `json:"request_id,omitempty"`
+
+	// Violations lists every problem found in the request body, e.g.
+	// "steps[0].error_rate: must be at most 1"
+	Violations []string `json:"violations,omitempty"`
+}
+
+// New returns a problem of the generic type of status
+func New(status int, detail string) Problem {
+	return Problem{
+		Type:   "about:blank",
+		Title:  http.StatusText(status),
+		Status: status,
+		Detail: detail,
+	}
+}
+
+// Error writes a problem of the generic type of status, like http.Error
+func Error(w http.ResponseWriter, r *http.Request, status int, detail string) {
+	Write(w, r, New(status, detail))
+}
+
+// Write writes problem as the response, completing its instance and request
+// ID from r when they are not set
+func Write(w http.ResponseWriter, r *http.Request, problem Problem) {
+	if problem.Instance == "" {
+		problem.Instance = r.URL.Path
+	}
+	if problem.RequestID == "" {
+		problem.RequestID = observability.RequestID(r)
+	}
+
+	jsonData, err := json.Marshal(problem)
+	if err != nil {
+		http.Error(w, problem.Title, problem.Status)
+		return
+	}
+
+	// Like http.Error, drop headers describing a body that is not sent
+	w.Header().Del("Content-Length")
+	w.Header().Set("Content-Type", ContentType)
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(problem.Status)
+	_, _ = w.Write(jsonData)
+}
@@ -0,0 +1,53 @@
+package httperr
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestError(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "/istio-test/metadata/unknown", nil)
+	req.Header.Set("X-Request-ID", "abc-123")
+	w := httptest.NewRecorder()
+
+	Error(w, req, http.StatusBadRequest, "Unknown metadata type")
+
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Equal(t, ContentType, w.Header().Get("Content-Type"))
+	assert.Equal(t, "nosniff", w.Header().Get("X-Content-Type-Options"))
+
+	var problem Problem
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &problem))
+	assert.Equal(t, Problem{
+		Type:      "about:blank",
+		Title:     "Bad Request",
+		Status:    http.StatusBadRequest,
+		Detail:    "Unknown metadata type",
+		Instance:  "/istio-test/metadata/unknown",
+		RequestID: "abc-123",
+	}, problem)
+}
+
+func TestWriteKeepsExplicitFields(t *testing.T) {
+	w := httptest.NewRecorder()
+	w.Header().Set("Content-Length", "42")
+
+	problem := New(http.StatusBadGateway, "Metadata server unreachable")
+	problem.Type = "https://example.com/problems/upstream"
+	problem.Instance = "/custom"
+	Write(w, httptest.NewRequest(http.MethodGet, "/istio-test/metadata/zone", nil), problem)
+
+	assert.Equal(t, http.StatusBadGateway, w.Code)
+	assert.Empty(t, w.Header().Get("Content-Length"))
+
+	var body map[string]any
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &body))
+	assert.Equal(t, "https://example.com/problems/upstream", body["type"])
+	assert.Equal(t, "/custom", body["instance"])
+	assert.NotContains(t, body, "request_id")
+}
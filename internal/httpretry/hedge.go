@@ -0,0 +1,184 @@
+package httpretry
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+)
+
+// hedgeResult is the outcome of one hedged attempt
+type hedgeResult struct {
+	number   int
+	resp     *http.Response
+	err      error
+	duration time.Duration
+}
+
+// cancelOnClose cancels the context of the attempt that produced a response
+// once its body is closed, so the body stays readable until then
+type cancelOnClose struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (b *cancelOnClose) Close() error {
+	err := b.ReadCloser.Close()
+	b.cancel()
+	return err
+}
+
+// idempotent reports whether a request may be sent more than once at a time
+func idempotent(req *http.Request) bool {
+	switch req.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace, http.MethodPut, http.MethodDelete:
+		return req.Body == nil || req.Body == http.NoBody || req.GetBody != nil
+	}
+	return false
+}
+
+// hedge sends up to maxAttempts attempts concurrently. Another attempt starts
+// when the outstanding ones have not answered within HedgeDelay, or at once
+// when an attempt fails retryably; hedges are spent from the Budget like
+// retries. The first response that is not retryable wins and the other
+// attempts are canceled. Requests that are not idempotent are never sent
+// twice at a time: they are retried without backoff once the previous
+// attempt failed.
+func (p Policy) hedge(ctx context.Context, client *http.Client, newRequest func(ctx context.Context) (*http.Request, error), maxAttempts int, retryable func(*http.Response, error) bool, spanName string) (*http.Response, error) {
+	results := make(chan hedgeResult, maxAttempts)
+	cancels := make(map[int]context.CancelFunc, maxAttempts)
+	launched, pending := 0, 0
+	concurrent := true
+
+	launch := func() error {
+		launched++
+		attemptCtx, cancel := context.WithCancel(ctx)
+		req, span, err := p.prepare(attemptCtx, newRequest, spanName, launched)
+		if err != nil {
+			cancel()
+			return err
+		}
+		concurrent = concurrent && idempotent(req)
+		cancels[launched] = cancel
+		pending++
+
+		start := time.Now()
+		go func(number int) {
+			resp, err := send(client, req, span)
+			results <- hedgeResult{number: number, resp: resp, err: err, duration: time.Since(start)}
+		}(launched)
+		return nil
+	}
+	// abandon cancels the outstanding attempts and closes their late responses
+	abandon := func() {
+		for _, cancel := range cancels {
+			cancel()
+		}
+		go func(pending int) {
+			for ; pending > 0; pending-- {
+				if r := <-results; r.resp != nil {
+					r.resp.Body.Close()
+				}
+			}
+		}(pending)
+	}
+	canLaunch := func() bool {
+		return launched < maxAttempts && (p.Budget == nil || p.Budget.allowRetry())
+	}
+	// hedgeTimer fires when the next hedge is due, or never
+	hedgeTimer := func() <-chan time.Time {
+		if !concurrent || launched >= maxAttempts {
+			return nil
+		}
+		return time.After(p.HedgeDelay)
+	}
+
+	if err := launch(); err != nil {
+		return nil, err
+	}
+	hedgeAt := hedgeTimer()
+
+	var last *hedgeResult
+	for {
+		select {
+		case <-ctx.Done():
+			abandon()
+			if last != nil && last.resp != nil {
+				last.resp.Body.Close()
+			}
+			return nil, fmt.Errorf("context cancelled: %w", ctx.Err())
+
+		case <-hedgeAt:
+			hedgeAt = nil
+			if !canLaunch() {
+				continue
+			}
+			if p.OnRetry != nil {
+				p.OnRetry(ctx, Attempt{Number: launched})
+			}
+			if err := launch(); err != nil {
+				abandon()
+				return nil, err
+			}
+			hedgeAt = hedgeTimer()
+
+		case r := <-results:
+			pending--
+			cancel := cancels[r.number]
+			delete(cancels, r.number)
+			outcome := Attempt{Number: r.number, Err: r.err, Duration: r.duration}
+			if r.resp != nil {
+				outcome.StatusCode = r.resp.StatusCode
+			}
+			if p.OnAttempt != nil {
+				p.OnAttempt(ctx, outcome)
+			}
+
+			if !retryable(r.resp, r.err) {
+				abandon()
+				if last != nil && last.resp != nil {
+					last.resp.Body.Close()
+				}
+				if r.err != nil {
+					cancel()
+					return nil, &Error{Attempts: launched, Err: r.err}
+				}
+				r.resp.Body = &cancelOnClose{ReadCloser: r.resp.Body, cancel: cancel}
+				return r.resp, nil
+			}
+
+			// Keep the latest retryable outcome in case no attempt succeeds
+			if last != nil && last.resp != nil {
+				_, _ = io.Copy(io.Discard, last.resp.Body)
+				last.resp.Body.Close()
+			}
+			if r.resp != nil {
+				r.resp.Body = &cancelOnClose{ReadCloser: r.resp.Body, cancel: cancel}
+			} else {
+				cancel()
+			}
+			last = &r
+
+			if (concurrent || pending == 0) && canLaunch() {
+				if p.OnRetry != nil {
+					p.OnRetry(ctx, outcome)
+				}
+				if err := launch(); err != nil {
+					abandon()
+					if r.resp != nil {
+						r.resp.Body.Close()
+					}
+					return nil, err
+				}
+				hedgeAt = hedgeTimer()
+			}
+			if pending == 0 {
+				if r.err != nil {
+					return nil, &Error{Attempts: launched, Err: r.err}
+				}
+				return r.resp, nil
+			}
+		}
+	}
+}
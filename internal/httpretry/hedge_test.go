@@ -0,0 +1,113 @@
+package httpretry
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPolicyHedge(t *testing.T) {
+	t.Run("a hedge answers for a slow attempt", func(t *testing.T) {
+		var calls int32
+		canceled := make(chan struct{})
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if atomic.AddInt32(&calls, 1) == 1 {
+				<-r.Context().Done()
+				close(canceled)
+				return
+			}
+			w.Write([]byte("ok"))
+		}))
+		defer ts.Close()
+
+		var attempts []Attempt
+		policy := fastPolicy(3)
+		policy.HedgeDelay = 20 * time.Millisecond
+		policy.OnAttempt = func(ctx context.Context, a Attempt) { attempts = append(attempts, a) }
+
+		start := time.Now()
+		resp, err := policy.Do(context.Background(), ts.Client(), getRequest(ts.URL))
+		require.NoError(t, err)
+		body, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+
+		assert.Equal(t, "ok", string(body))
+		assert.Less(t, time.Since(start), time.Second)
+		assert.Equal(t, int32(2), atomic.LoadInt32(&calls), "no further hedge once an attempt answered")
+		require.Len(t, attempts, 1)
+		assert.Equal(t, 2, attempts[0].Number)
+
+		select {
+		case <-canceled:
+		case <-time.After(5 * time.Second):
+			t.Fatal("the slow attempt was not canceled")
+		}
+	})
+
+	t.Run("retryable failures start the next attempt at once", func(t *testing.T) {
+		var calls int32
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			atomic.AddInt32(&calls, 1)
+			w.WriteHeader(http.StatusServiceUnavailable)
+			w.Write([]byte("unavailable"))
+		}))
+		defer ts.Close()
+
+		policy := fastPolicy(3)
+		policy.HedgeDelay = time.Minute
+
+		resp, err := policy.Do(context.Background(), ts.Client(), getRequest(ts.URL))
+		require.NoError(t, err)
+		body, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+
+		assert.Equal(t, http.StatusServiceUnavailable, resp.StatusCode)
+		assert.Equal(t, "unavailable", string(body), "the last response stays readable")
+		assert.Equal(t, int32(3), atomic.LoadInt32(&calls))
+	})
+
+	t.Run("requests that are not idempotent are not hedged", func(t *testing.T) {
+		var calls int32
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			atomic.AddInt32(&calls, 1)
+			time.Sleep(100 * time.Millisecond)
+		}))
+		defer ts.Close()
+
+		policy := fastPolicy(3)
+		policy.HedgeDelay = 10 * time.Millisecond
+
+		resp, err := policy.Do(context.Background(), ts.Client(), func(ctx context.Context) (*http.Request, error) {
+			return http.NewRequestWithContext(ctx, http.MethodPost, ts.URL, strings.NewReader("payload"))
+		})
+		require.NoError(t, err)
+		resp.Body.Close()
+		assert.Equal(t, int32(1), atomic.LoadInt32(&calls))
+	})
+
+	t.Run("hedges are spent from the budget", func(t *testing.T) {
+		var calls int32
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			atomic.AddInt32(&calls, 1)
+			time.Sleep(50 * time.Millisecond)
+		}))
+		defer ts.Close()
+
+		policy := fastPolicy(3)
+		policy.HedgeDelay = 5 * time.Millisecond
+		policy.Budget = NewBudget(0, 0, time.Minute)
+
+		resp, err := policy.Do(context.Background(), ts.Client(), getRequest(ts.URL))
+		require.NoError(t, err)
+		resp.Body.Close()
+		assert.Equal(t, int32(1), atomic.LoadInt32(&calls))
+	})
+}
@@ -0,0 +1,363 @@
+// Package httpretry provides reusable retry policies for outbound HTTP calls.
+//
+// A Policy describes how many attempts to make, how to back off between them
+// and which outcomes are worth retrying. With a hedge delay the attempts are
+// sent concurrently instead, trading extra load for a shorter tail latency. An optional Budget caps the share of
+// retries across all callers sharing it so that a struggling upstream is not
+// amplified into a retry storm.
+package httpretry
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"math/rand/v2"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"istio-test/internal/observability"
+
+	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/ext"
+)
+
+// Attempt describes the outcome of a single attempt
+type Attempt struct {
+	Number     int           // 1-based attempt number
+	StatusCode int           // Response status code, zero when the request failed
+	Err        error         // Transport error, nil when a response was received
+	Delay      time.Duration // Backoff before the next attempt, set for OnRetry
+	RetryAfter time.Duration // Delay requested by the Retry-After header, set for OnRetry when honored
+	Duration   time.Duration // Time the attempt took, set for OnAttempt
+}
+
+// Policy defines retry and backoff behavior for outbound requests
+type Policy struct {
+	MaxAttempts int           // Total attempts including the first one
+	BaseDelay   time.Duration // Delay before the first retry
+	MaxDelay    time.Duration // Upper bound for any single delay
+	Multiplier  float64       // Growth factor applied to the delay after each retry
+	Jitter      float64       // Fraction (0-1) of each delay that is randomized
+
+	// HonorRetryAfter makes 429 and 503 responses carrying a Retry-After
+	// header wait the delay it requests, capped at MaxDelay, instead of the
+	// backoff; the backoff still grows for later attempts
+	HonorRetryAfter bool
+
+	// HedgeDelay, when positive, sends the attempts concurrently: another
+	// attempt starts whenever the outstanding ones have not answered within
+	// the delay, and the first response that is not retryable wins. Only
+	// idempotent requests are hedged; see Policy.hedge.
+	HedgeDelay time.Duration
+
+	// Budget optionally limits retries across all callers sharing it
+	Budget *Budget
+
+	// Retryable decides whether an outcome should be retried (defaults to RetryableStatus)
+	Retryable func(resp *http.Response, err error) bool
+
+	// OnRetry is called before sleeping ahead of the next attempt
+	OnRetry func(ctx context.Context, attempt Attempt)
+
+	// OnAttempt is called after every attempt that sent a request, including the last
+	OnAttempt func(ctx context.Context, attempt Attempt)
+
+	// SpanName is the operation name used for per-attempt trace spans
+	SpanName string
+}
+
+// DefaultJitter is the share of each delay randomized by DefaultPolicy, so
+// pods retrying the same failure do not retry in lockstep
+const DefaultJitter = 0.2
+
+// DefaultPolicy returns the policy historically used by the metadata client
+func DefaultPolicy() Policy {
+	return Policy{
+		MaxAttempts: 3,
+		BaseDelay:   100 * time.Millisecond,
+		MaxDelay:    2 * time.Second,
+		Multiplier:  2.0,
+		Jitter:      DefaultJitter,
+	}
+}
+
+// Error is returned when all attempts failed with a transport error
+type Error struct {
+	Attempts int
+	Err      error
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("failed after %d attempts: %v", e.Attempts, e.Err)
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// RetryableStatus retries transport errors, 5xx responses and 429 (rate limiting)
+func RetryableStatus(resp *http.Response, err error) bool {
+	if err != nil {
+		return true
+	}
+	return (resp.StatusCode >= 500 && resp.StatusCode < 600) || resp.StatusCode == http.StatusTooManyRequests
+}
+
+// Do sends the request built by newRequest until it succeeds, the policy gives up
+// or ctx is done. newRequest is called once per attempt so request bodies can be
+// rebuilt. The response of the final attempt is returned unread; callers own its body.
+func (p Policy) Do(ctx context.Context, client *http.Client, newRequest func(ctx context.Context) (*http.Request, error)) (*http.Response, error) {
+	maxAttempts := p.MaxAttempts
+	if maxAttempts < 1 {
+		maxAttempts = 1
+	}
+	retryable := p.Retryable
+	if retryable == nil {
+		retryable = RetryableStatus
+	}
+	spanName := p.SpanName
+	if spanName == "" {
+		spanName = "http.attempt"
+	}
+
+	if p.Budget != nil {
+		p.Budget.recordRequest()
+	}
+	if p.HedgeDelay > 0 && maxAttempts > 1 {
+		return p.hedge(ctx, client, newRequest, maxAttempts, retryable, spanName)
+	}
+
+	delay := p.BaseDelay
+	for attempt := 1; ; attempt++ {
+		// Check if context is already cancelled
+		select {
+		case <-ctx.Done():
+			return nil, fmt.Errorf("context cancelled: %w", ctx.Err())
+		default:
+		}
+
+		start := time.Now()
+		resp, err := p.attempt(ctx, client, newRequest, spanName, attempt)
+		var reqErr *requestError
+		if errors.As(err, &reqErr) {
+			return nil, err
+		}
+		if p.OnAttempt != nil {
+			outcome := Attempt{Number: attempt, Err: err, Duration: time.Since(start)}
+			if resp != nil {
+				outcome.StatusCode = resp.StatusCode
+			}
+			p.OnAttempt(ctx, outcome)
+		}
+
+		if !retryable(resp, err) || attempt >= maxAttempts || (p.Budget != nil && !p.Budget.allowRetry()) {
+			if err != nil {
+				return nil, &Error{Attempts: attempt, Err: err}
+			}
+			return resp, nil
+		}
+
+		info := Attempt{Number: attempt, Err: err, Delay: p.withJitter(delay)}
+		if resp != nil {
+			info.StatusCode = resp.StatusCode
+			if retryAfter, ok := p.retryAfter(resp); ok {
+				info.RetryAfter = retryAfter
+				info.Delay = retryAfter
+			}
+			// Drain so the connection can be reused by the next attempt
+			_, _ = io.Copy(io.Discard, resp.Body)
+			resp.Body.Close()
+		}
+		if p.OnRetry != nil {
+			p.OnRetry(ctx, info)
+		}
+
+		// Back off, giving up as soon as ctx is done
+		timer := time.NewTimer(info.Delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, fmt.Errorf("context cancelled: %w", ctx.Err())
+		case <-timer.C:
+		}
+		delay = p.nextDelay(delay)
+	}
+}
+
+// requestError marks failures building the request, which are never retried
+type requestError struct{ err error }
+
+func (e *requestError) Error() string { return fmt.Sprintf("error creating request: %v", e.err) }
+func (e *requestError) Unwrap() error { return e.err }
+
+// AttemptTag is the span tag carrying the 1-based attempt number
+const AttemptTag = "retry.attempt"
+
+type attemptKey struct{}
+
+// AttemptFromContext returns the 1-based number of the attempt a request
+// belongs to, or zero for requests not sent by Policy.Do
+func AttemptFromContext(ctx context.Context) int {
+	number, _ := ctx.Value(attemptKey{}).(int)
+	return number
+}
+
+// attempt performs one traced attempt
+func (p Policy) attempt(ctx context.Context, client *http.Client, newRequest func(ctx context.Context) (*http.Request, error), spanName string, number int) (*http.Response, error) {
+	req, span, err := p.prepare(ctx, newRequest, spanName, number)
+	if err != nil {
+		return nil, err
+	}
+	return send(client, req, span)
+}
+
+// prepare starts the span of an attempt and builds its request
+func (p Policy) prepare(ctx context.Context, newRequest func(ctx context.Context) (*http.Request, error), spanName string, number int) (*http.Request, observability.Span, error) {
+	span, spanCtx := observability.StartSpan(ctx, spanName)
+	span.SetTag(ext.SpanType, ext.SpanTypeHTTP)
+	span.SetTag(AttemptTag, number)
+	spanCtx = context.WithValue(spanCtx, attemptKey{}, number)
+
+	req, err := newRequest(spanCtx)
+	if err != nil {
+		span.Finish(err)
+		return nil, nil, &requestError{err: err}
+	}
+	span.SetTag(ext.HTTPMethod, req.Method)
+	span.SetTag(ext.HTTPURL, req.URL.String())
+	return req, span, nil
+}
+
+// send sends a prepared request and finishes its span
+func send(client *http.Client, req *http.Request, span observability.Span) (*http.Response, error) {
+	resp, err := client.Do(req)
+	if err != nil {
+		span.Finish(err)
+		return nil, fmt.Errorf("error executing request: %w", err)
+	}
+	span.SetTag(ext.HTTPCode, resp.StatusCode)
+	span.Finish(nil)
+	return resp, nil
+}
+
+// maxRetryAfterSeconds is the longest Retry-After delay a time.Duration holds
+const maxRetryAfterSeconds = math.MaxInt64 / int64(time.Second)
+
+// ParseRetryAfter parses a Retry-After header value, either delay seconds or
+// an HTTP date, into the delay it requests from now. Dates in the past
+// request no delay; delays too long for a time.Duration are clamped to the
+// longest one instead of overflowing.
+func ParseRetryAfter(value string, now time.Time) (time.Duration, bool) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return 0, false
+	}
+	if seconds, err := strconv.ParseInt(value, 10, 64); err == nil || errors.Is(err, strconv.ErrRange) {
+		if seconds < 0 {
+			return 0, false
+		}
+		return time.Duration(min(seconds, maxRetryAfterSeconds)) * time.Second, true
+	}
+	date, err := http.ParseTime(value)
+	if err != nil {
+		return 0, false
+	}
+	return max(date.Sub(now), 0), true
+}
+
+// retryAfter returns the delay requested by the Retry-After header of resp,
+// capped at MaxDelay, when the policy honors it
+func (p Policy) retryAfter(resp *http.Response) (time.Duration, bool) {
+	if !p.HonorRetryAfter || (resp.StatusCode != http.StatusTooManyRequests && resp.StatusCode != http.StatusServiceUnavailable) {
+		return 0, false
+	}
+	delay, ok := ParseRetryAfter(resp.Header.Get("Retry-After"), time.Now())
+	if !ok {
+		return 0, false
+	}
+	if p.MaxDelay > 0 && delay > p.MaxDelay {
+		delay = p.MaxDelay
+	}
+	return delay, true
+}
+
+// nextDelay grows the delay by the multiplier, capped at MaxDelay
+func (p Policy) nextDelay(delay time.Duration) time.Duration {
+	next := time.Duration(float64(delay) * p.Multiplier)
+	if p.MaxDelay > 0 && next > p.MaxDelay {
+		next = p.MaxDelay
+	}
+	return next
+}
+
+// withJitter randomizes the configured fraction of delay downwards
+func (p Policy) withJitter(delay time.Duration) time.Duration {
+	if p.Jitter <= 0 || delay <= 0 {
+		return delay
+	}
+	jitter := p.Jitter
+	if jitter > 1 {
+		jitter = 1
+	}
+	return delay - time.Duration(rand.Float64()*jitter*float64(delay))
+}
+
+// Budget limits retries to a ratio of requests observed in a rolling window,
+// with a floor so that low-traffic callers can still retry
+type Budget struct {
+	mu         sync.Mutex
+	ratio      float64
+	minRetries int
+	window     time.Duration
+	start      time.Time
+	requests   int
+	retries    int
+}
+
+// NewBudget creates a retry budget allowing ratio retries per request, and at
+// least minRetries retries, per window
+func NewBudget(ratio float64, minRetries int, window time.Duration) *Budget {
+	return &Budget{
+		ratio:      ratio,
+		minRetries: minRetries,
+		window:     window,
+		start:      time.Now(),
+	}
+}
+
+// roll resets the counters once the window has elapsed; callers must hold mu
+func (b *Budget) roll() {
+	if time.Since(b.start) >= b.window {
+		b.start = time.Now()
+		b.requests = 0
+		b.retries = 0
+	}
+}
+
+func (b *Budget) recordRequest() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.roll()
+	b.requests++
+}
+
+// allowRetry reserves a retry if the budget has room for it
+func (b *Budget) allowRetry() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.roll()
+
+	limit := int(float64(b.requests) * b.ratio)
+	if limit < b.minRetries {
+		limit = b.minRetries
+	}
+	if b.retries >= limit {
+		return false
+	}
+	b.retries++
+	return true
+}
@@ -0,0 +1,294 @@
+package httpretry
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func fastPolicy(maxAttempts int) Policy {
+	return Policy{
+		MaxAttempts: maxAttempts,
+		BaseDelay:   time.Millisecond,
+		MaxDelay:    5 * time.Millisecond,
+		Multiplier:  2.0,
+	}
+}
+
+func getRequest(url string) func(ctx context.Context) (*http.Request, error) {
+	return func(ctx context.Context) (*http.Request, error) {
+		return http.NewRequestWithContext(ctx, "GET", url, nil)
+	}
+}
+
+func TestPolicyDo(t *testing.T) {
+	t.Run("retries 5xx until success", func(t *testing.T) {
+		var calls int32
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if atomic.AddInt32(&calls, 1) < 3 {
+				w.WriteHeader(http.StatusServiceUnavailable)
+				return
+			}
+			w.Write([]byte("ok"))
+		}))
+		defer ts.Close()
+
+		var retried []Attempt
+		policy := fastPolicy(3)
+		policy.OnRetry = func(ctx context.Context, a Attempt) { retried = append(retried, a) }
+
+		resp, err := policy.Do(context.Background(), ts.Client(), getRequest(ts.URL))
+		assert.NoError(t, err)
+		defer resp.Body.Close()
+
+		body, _ := io.ReadAll(resp.Body)
+		assert.Equal(t, "ok", string(body))
+		assert.Equal(t, int32(3), atomic.LoadInt32(&calls))
+		assert.Len(t, retried, 2)
+		assert.Equal(t, 1, retried[0].Number)
+		assert.Equal(t, http.StatusServiceUnavailable, retried[0].StatusCode)
+	})
+
+	t.Run("reports every attempt", func(t *testing.T) {
+		var calls int32
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if atomic.AddInt32(&calls, 1) == 1 {
+				w.WriteHeader(http.StatusServiceUnavailable)
+			}
+		}))
+		defer ts.Close()
+
+		var attempts []Attempt
+		var numbers []int
+		policy := fastPolicy(3)
+		policy.OnAttempt = func(ctx context.Context, a Attempt) { attempts = append(attempts, a) }
+
+		resp, err := policy.Do(context.Background(), ts.Client(), func(ctx context.Context) (*http.Request, error) {
+			numbers = append(numbers, AttemptFromContext(ctx))
+			return http.NewRequestWithContext(ctx, "GET", ts.URL, nil)
+		})
+		assert.NoError(t, err)
+		resp.Body.Close()
+
+		assert.Equal(t, []int{1, 2}, numbers)
+		assert.Len(t, attempts, 2)
+		assert.Equal(t, http.StatusServiceUnavailable, attempts[0].StatusCode)
+		assert.Equal(t, 2, attempts[1].Number)
+		assert.Equal(t, http.StatusOK, attempts[1].StatusCode)
+		assert.Positive(t, attempts[1].Duration)
+		assert.Zero(t, AttemptFromContext(context.Background()))
+	})
+
+	t.Run("does not retry 4xx", func(t *testing.T) {
+		var calls int32
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			atomic.AddInt32(&calls, 1)
+			w.WriteHeader(http.StatusNotFound)
+		}))
+		defer ts.Close()
+
+		resp, err := fastPolicy(3).Do(context.Background(), ts.Client(), getRequest(ts.URL))
+		assert.NoError(t, err)
+		defer resp.Body.Close()
+
+		assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+		assert.Equal(t, int32(1), atomic.LoadInt32(&calls))
+	})
+
+	t.Run("returns last response when attempts are exhausted", func(t *testing.T) {
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusTooManyRequests)
+		}))
+		defer ts.Close()
+
+		resp, err := fastPolicy(2).Do(context.Background(), ts.Client(), getRequest(ts.URL))
+		assert.NoError(t, err)
+		defer resp.Body.Close()
+		assert.Equal(t, http.StatusTooManyRequests, resp.StatusCode)
+	})
+
+	t.Run("wraps transport errors with attempt count", func(t *testing.T) {
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+		url := ts.URL
+		ts.Close()
+
+		_, err := fastPolicy(2).Do(context.Background(), http.DefaultClient, getRequest(url))
+		var retryErr *Error
+		assert.True(t, errors.As(err, &retryErr))
+		assert.Equal(t, 2, retryErr.Attempts)
+		assert.Contains(t, err.Error(), "failed after 2 attempts")
+	})
+
+	t.Run("request build errors are not retried", func(t *testing.T) {
+		calls := 0
+		_, err := fastPolicy(3).Do(context.Background(), http.DefaultClient, func(ctx context.Context) (*http.Request, error) {
+			calls++
+			return nil, errors.New("boom")
+		})
+		assert.Error(t, err)
+		assert.Contains(t, err.Error(), "error creating request")
+		assert.Equal(t, 1, calls)
+	})
+
+	t.Run("cancelled context stops immediately", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+
+		_, err := fastPolicy(3).Do(ctx, http.DefaultClient, getRequest("http://127.0.0.1:1"))
+		assert.ErrorIs(t, err, context.Canceled)
+	})
+
+	t.Run("cancellation interrupts the backoff", func(t *testing.T) {
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}))
+		defer ts.Close()
+
+		ctx, cancel := context.WithCancel(context.Background())
+		policy := fastPolicy(3)
+		policy.BaseDelay = time.Hour
+		policy.MaxDelay = time.Hour
+		policy.OnRetry = func(ctx context.Context, a Attempt) { cancel() }
+
+		start := time.Now()
+		_, err := policy.Do(ctx, ts.Client(), getRequest(ts.URL))
+		assert.ErrorIs(t, err, context.Canceled)
+		assert.Less(t, time.Since(start), time.Second)
+	})
+}
+
+func TestPolicyDelays(t *testing.T) {
+	policy := Policy{BaseDelay: 100 * time.Millisecond, MaxDelay: 300 * time.Millisecond, Multiplier: 2.0}
+
+	assert.Equal(t, 200*time.Millisecond, policy.nextDelay(100*time.Millisecond))
+	assert.Equal(t, 300*time.Millisecond, policy.nextDelay(200*time.Millisecond))
+
+	// No jitter leaves the delay untouched
+	assert.Equal(t, 100*time.Millisecond, policy.withJitter(100*time.Millisecond))
+
+	policy.Jitter = 0.5
+	for i := 0; i < 100; i++ {
+		d := policy.withJitter(100 * time.Millisecond)
+		assert.GreaterOrEqual(t, d, 50*time.Millisecond)
+		assert.LessOrEqual(t, d, 100*time.Millisecond)
+	}
+}
+
+func TestPolicyHonorsRetryAfter(t *testing.T) {
+	var calls int32
+	retryAfter := "120"
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&calls, 1) < 3 {
+			w.Header().Set("Retry-After", retryAfter)
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+		w.Write([]byte("ok"))
+	}))
+	defer ts.Close()
+
+	var retried []Attempt
+	policy := fastPolicy(3)
+	policy.HonorRetryAfter = true
+	policy.OnRetry = func(ctx context.Context, a Attempt) { retried = append(retried, a) }
+
+	resp, err := policy.Do(context.Background(), ts.Client(), getRequest(ts.URL))
+	assert.NoError(t, err)
+	resp.Body.Close()
+
+	// The requested two minutes are capped at MaxDelay
+	assert.Len(t, retried, 2)
+	for _, a := range retried {
+		assert.Equal(t, 5*time.Millisecond, a.RetryAfter)
+		assert.Equal(t, 5*time.Millisecond, a.Delay)
+	}
+
+	// Delays too long for a time.Duration are capped rather than overflowing
+	atomic.StoreInt32(&calls, 0)
+	retried = nil
+	retryAfter = "99999999999"
+	resp, err = policy.Do(context.Background(), ts.Client(), getRequest(ts.URL))
+	assert.NoError(t, err)
+	resp.Body.Close()
+	assert.Len(t, retried, 2)
+	for _, a := range retried {
+		assert.Equal(t, 5*time.Millisecond, a.Delay)
+	}
+
+	// Without HonorRetryAfter the backoff applies
+	atomic.StoreInt32(&calls, 0)
+	retried = nil
+	policy.HonorRetryAfter = false
+	resp, err = policy.Do(context.Background(), ts.Client(), getRequest(ts.URL))
+	assert.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, time.Duration(0), retried[0].RetryAfter)
+	assert.Equal(t, time.Millisecond, retried[0].Delay)
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Date(2026, 10, 15, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		value    string
+		expected time.Duration
+		ok       bool
+	}{
+		{"3", 3 * time.Second, true},
+		{" 0 ", 0, true},
+		{"Thu, 15 Oct 2026 12:00:30 GMT", 30 * time.Second, true},
+		{"Thu, 15 Oct 2026 11:59:00 GMT", 0, true},
+		{"", 0, false},
+		{"-1", 0, false},
+		{"soon", 0, false},
+		{"99999999999", time.Duration(maxRetryAfterSeconds) * time.Second, true},
+		{"99999999999999999999", time.Duration(maxRetryAfterSeconds) * time.Second, true},
+	}
+	for _, tt := range tests {
+		delay, ok := ParseRetryAfter(tt.value, now)
+		assert.Equal(t, tt.ok, ok, tt.value)
+		assert.Equal(t, tt.expected, delay, tt.value)
+	}
+}
+
+func TestBudget(t *testing.T) {
+	t.Run("minimum retries are always allowed", func(t *testing.T) {
+		budget := NewBudget(0, 2, time.Minute)
+		assert.True(t, budget.allowRetry())
+		assert.True(t, budget.allowRetry())
+		assert.False(t, budget.allowRetry())
+	})
+
+	t.Run("ratio scales with requests", func(t *testing.T) {
+		budget := NewBudget(0.5, 0, time.Minute)
+		for i := 0; i < 4; i++ {
+			budget.recordRequest()
+		}
+		assert.True(t, budget.allowRetry())
+		assert.True(t, budget.allowRetry())
+		assert.False(t, budget.allowRetry())
+	})
+
+	t.Run("exhausted budget stops retries", func(t *testing.T) {
+		var calls int32
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			atomic.AddInt32(&calls, 1)
+			w.WriteHeader(http.StatusInternalServerError)
+		}))
+		defer ts.Close()
+
+		policy := fastPolicy(5)
+		policy.Budget = NewBudget(0, 1, time.Minute)
+
+		resp, err := policy.Do(context.Background(), ts.Client(), getRequest(ts.URL))
+		assert.NoError(t, err)
+		resp.Body.Close()
+		assert.Equal(t, int32(2), atomic.LoadInt32(&calls))
+	})
+}
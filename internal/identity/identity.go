@@ -0,0 +1,167 @@
+// Package identity reports the mTLS peer identity forwarded by the sidecar.
+//
+// When a request arrives over mTLS, the Istio sidecar describes the client
+// certificate in the X-Forwarded-Client-Cert (XFCC) header. The identity
+// endpoint parses that header, which makes it easy to check which workload a
+// PeerAuthentication or AuthorizationPolicy actually saw.
+package identity
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"istio-test/internal/observability"
+)
+
+// Header is the header the sidecar forwards client certificate details in
+const Header = "X-Forwarded-Client-Cert"
+
+// Element describes one certificate of the XFCC header. Proxies that forward
+// the header append an element per hop.
+type Element struct {
+	By             string   `json:"by,omitempty"`   // SAN of the certificate of the proxy that added the element
+	Hash           string   `json:"hash,omitempty"` // SHA-256 of the client certificate
+	Subject        string   `json:"subject,omitempty"`
+	URI            string   `json:"uri,omitempty"` // URI SAN, the SPIFFE ID in Istio
+	DNS            []string `json:"dns,omitempty"` // DNS SANs
+	TrustDomain    string   `json:"trust_domain,omitempty"`
+	Namespace      string   `json:"namespace,omitempty"`
+	ServiceAccount string   `json:"service_account,omitempty"`
+}
+
+// Response is returned by Handler
+type Response struct {
+	MTLS  bool      `json:"mtls"`           // Whether the sidecar forwarded a client certificate
+	Peer  *Element  `json:"peer,omitempty"` // Certificate of the closest hop
+	Chain []Element `json:"chain,omitempty"`
+	Raw   string    `json:"raw,omitempty"`
+}
+
+// split splits s at sep outside of double quoted strings
+func split(s string, sep byte) ([]string, error) {
+	var parts []string
+	start, quoted := 0, false
+	for i := 0; i < len(s); i++ {
+		switch {
+		case s[i] == '\\' && quoted:
+			i++
+		case s[i] == '"':
+			quoted = !quoted
+		case s[i] == sep && !quoted:
+			parts = append(parts, s[start:i])
+			start = i + 1
+		}
+	}
+	if quoted {
+		return nil, errors.New("unterminated quoted value")
+	}
+	return append(parts, s[start:]), nil
+}
+
+// unquote removes the quotes and escapes of a quoted value
+func unquote(value string) string {
+	if len(value) < 2 || value[0] != '"' || value[len(value)-1] != '"' {
+		return value
+	}
+	var b strings.Builder
+	value = value[1 : len(value)-1]
+	for i := 0; i < len(value); i++ {
+		if value[i] == '\\' && i+1 < len(value) {
+			i++
+		}
+		b.WriteByte(value[i])
+	}
+	return b.String()
+}
+
+// parseSPIFFE fills the trust domain, namespace and service account of e from
+// a SPIFFE ID of the form spiffe://<trust domain>/ns/<namespace>/sa/<account>
+func (e *Element) parseSPIFFE() {
+	rest, ok := strings.CutPrefix(e.URI, "spiffe://")
+	if !ok {
+		return
+	}
+	trustDomain, path, _ := strings.Cut(rest, "/")
+	e.TrustDomain = trustDomain
+	segments := strings.Split(path, "/")
+	if len(segments) == 4 && segments[0] == "ns" && segments[2] == "sa" {
+		e.Namespace = segments[1]
+		e.ServiceAccount = segments[3]
+	}
+}
+
+// Parse parses an XFCC header value into its elements
+func Parse(header string) ([]Element, error) {
+	rawElements, err := split(header, ',')
+	if err != nil {
+		return nil, err
+	}
+
+	elements := make([]Element, 0, len(rawElements))
+	for _, rawElement := range rawElements {
+		pairs, err := split(rawElement, ';')
+		if err != nil {
+			return nil, err
+		}
+
+		var element Element
+		for _, pair := range pairs {
+			pair = strings.TrimSpace(pair)
+			if pair == "" {
+				continue
+			}
+			key, value, ok := strings.Cut(pair, "=")
+			if !ok {
+				return nil, fmt.Errorf("invalid key/value pair '%s'", pair)
+			}
+			value = unquote(value)
+			switch strings.ToLower(key) {
+			case "by":
+				element.By = value
+			case "hash":
+				element.Hash = value
+			case "subject":
+				element.Subject = value
+			case "uri":
+				element.URI = value
+			case "dns":
+				element.DNS = append(element.DNS, value)
+			}
+		}
+		element.parseSPIFFE()
+		elements = append(elements, element)
+	}
+	return elements, nil
+}
+
+// Handler returns the client certificate details forwarded by the sidecar as JSON
+func Handler(w http.ResponseWriter, r *http.Request) {
+	var response Response
+	if header := r.Header.Get(Header); header != "" {
+		chain, err := Parse(header)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Invalid %s header: %v", Header, err), http.StatusBadRequest)
+			return
+		}
+		response = Response{
+			MTLS:  true,
+			Peer:  &chain[len(chain)-1],
+			Chain: chain,
+			Raw:   header,
+		}
+	}
+
+	jsonData, err := json.Marshal(response)
+	if err != nil {
+		observability.ErrorWithContext(r.Context(), fmt.Sprintf("Error encoding identity response: %v", err))
+		http.Error(w, "Failed to encode identity response", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write(jsonData)
+}
@@ -0,0 +1,83 @@
+package identity
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const sidecarXFCC = `By=spiffe://cluster.local/ns/istio-test/sa/istio-test;Hash=3f1c0a;Subject="";URI=spiffe://cluster.local/ns/client/sa/sleep`
+
+func TestParse(t *testing.T) {
+	elements, err := Parse(sidecarXFCC)
+	require.NoError(t, err)
+	require.Len(t, elements, 1)
+	assert.Equal(t, Element{
+		By:             "spiffe://cluster.local/ns/istio-test/sa/istio-test",
+		Hash:           "3f1c0a",
+		URI:            "spiffe://cluster.local/ns/client/sa/sleep",
+		TrustDomain:    "cluster.local",
+		Namespace:      "client",
+		ServiceAccount: "sleep",
+	}, elements[0])
+}
+
+func TestParseQuotedValuesAndChain(t *testing.T) {
+	header := `Hash=aa;Subject="CN=gateway,O=Example \"Corp\"";DNS=gw.example.com;DNS=gw.internal,` +
+		`Hash=bb;URI=spiffe://example.org/workload`
+
+	elements, err := Parse(header)
+	require.NoError(t, err)
+	require.Len(t, elements, 2)
+
+	assert.Equal(t, `CN=gateway,O=Example "Corp"`, elements[0].Subject)
+	assert.Equal(t, []string{"gw.example.com", "gw.internal"}, elements[0].DNS)
+
+	assert.Equal(t, "bb", elements[1].Hash)
+	assert.Equal(t, "example.org", elements[1].TrustDomain)
+	assert.Empty(t, elements[1].Namespace)
+}
+
+func TestParseInvalid(t *testing.T) {
+	for _, header := range []string{`Subject="CN=unterminated`, `Hash`} {
+		_, err := Parse(header)
+		assert.Error(t, err, header)
+	}
+}
+
+func TestHandler(t *testing.T) {
+	t.Run("mtls", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/istio-test/identity", nil)
+		req.Header.Set(Header, sidecarXFCC)
+		w := httptest.NewRecorder()
+		Handler(w, req)
+
+		require.Equal(t, http.StatusOK, w.Code)
+		var response Response
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+		assert.True(t, response.MTLS)
+		require.NotNil(t, response.Peer)
+		assert.Equal(t, "sleep", response.Peer.ServiceAccount)
+		assert.Equal(t, sidecarXFCC, response.Raw)
+	})
+
+	t.Run("plaintext", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		Handler(w, httptest.NewRequest(http.MethodGet, "/istio-test/identity", nil))
+
+		require.Equal(t, http.StatusOK, w.Code)
+		assert.JSONEq(t, `{"mtls":false}`, w.Body.String())
+	})
+
+	t.Run("invalid header", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/istio-test/identity", nil)
+		req.Header.Set(Header, `Subject="broken`)
+		w := httptest.NewRecorder()
+		Handler(w, req)
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+	})
+}
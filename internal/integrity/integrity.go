@@ -0,0 +1,186 @@
+// Package integrity proves whether payloads survive the mesh unchanged.
+//
+// The middleware announces the SHA-256 and length of the bytes a handler
+// wrote, and the verify handler checks a received body against a checksum the
+// caller computed, so corruption or rewriting by proxies on either direction
+// of a call can be told apart from a handler bug. Checksums cover the payload
+// as written by the handler, before any content encoding applied on the way.
+package integrity
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"istio-test/internal/observability"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Headers carrying the checksum and length of a payload
+const (
+	SHA256Header = "X-Content-SHA256"
+	LengthHeader = "X-Content-Length"
+)
+
+// Query parameters of the verify handler, used when the headers are not set
+const (
+	SHA256Param = "sha256"
+	LengthParam = "length"
+)
+
+// maxVerifyBytes limits the bodies accepted by the verify handler; bodies are
+// hashed while read, so the limit only bounds the time spent
+const maxVerifyBytes = 64 << 20
+
+var verifications = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Namespace: "istio_test",
+	Name:      "integrity_verifications_total",
+	Help:      "Bodies checked by the verify endpoint by result: match or mismatch.",
+}, []string{"result"})
+
+func init() {
+	observability.MetricsRegistry().MustRegister(verifications)
+}
+
+// Sum returns the hex encoded SHA-256 of b
+func Sum(b []byte) string {
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:])
+}
+
+// bufferWriter holds the status and body of a response until the handler
+// returned
+type bufferWriter struct {
+	http.ResponseWriter
+	status int
+	body   bytes.Buffer
+}
+
+func (w *bufferWriter) WriteHeader(code int) {
+	if w.status == 0 {
+		w.status = code
+	}
+}
+
+func (w *bufferWriter) Write(b []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	return w.body.Write(b)
+}
+
+// Middleware sets the checksum and length headers on the responses of next.
+// Responses are buffered in full, so it is meant for routes with bounded
+// payloads.
+func Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		buffered := &bufferWriter{ResponseWriter: w}
+		next.ServeHTTP(buffered, r)
+		if buffered.status == 0 {
+			buffered.status = http.StatusOK
+		}
+
+		body := buffered.body.Bytes()
+		length := strconv.Itoa(len(body))
+		w.Header().Set(SHA256Header, Sum(body))
+		w.Header().Set(LengthHeader, length)
+		w.Header().Set("Content-Length", length)
+		w.WriteHeader(buffered.status)
+		if r.Method != http.MethodHead {
+			_, _ = w.Write(body)
+		}
+	})
+}
+
+// Result is returned by the verify handler
+type Result struct {
+	Match          bool   `json:"match"`
+	ExpectedSHA256 string `json:"expected_sha256"`
+	ActualSHA256   string `json:"actual_sha256"`
+	ExpectedLength *int64 `json:"expected_length,omitempty"`
+	ActualLength   int64  `json:"actual_length"`
+}
+
+// expected returns the checksum and optional length the caller announced in
+// the headers or query parameters
+func expected(r *http.Request) (string, *int64, error) {
+	query := r.URL.Query()
+	sum := r.Header.Get(SHA256Header)
+	if sum == "" {
+		sum = query.Get(SHA256Param)
+	}
+	sum = strings.ToLower(sum)
+	if decoded, err := hex.DecodeString(sum); err != nil || len(decoded) != sha256.Size {
+		return "", nil, fmt.Errorf("%s header or %s query parameter must be a hex encoded SHA-256", SHA256Header, SHA256Param)
+	}
+
+	lengthValue := r.Header.Get(LengthHeader)
+	if lengthValue == "" {
+		lengthValue = query.Get(LengthParam)
+	}
+	if lengthValue == "" {
+		return sum, nil, nil
+	}
+	length, err := strconv.ParseInt(lengthValue, 10, 64)
+	if err != nil || length < 0 {
+		return "", nil, fmt.Errorf("%s header or %s query parameter must be a non-negative integer", LengthHeader, LengthParam)
+	}
+	return sum, &length, nil
+}
+
+// VerifyHandler checks the request body against the SHA-256, and optionally
+// the length, announced by the caller. It answers 200 when the body matches
+// and 422 with the actual checksum when it does not.
+func VerifyHandler(w http.ResponseWriter, r *http.Request) {
+	sum, length, err := expected(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	hash := sha256.New()
+	n, err := io.Copy(hash, http.MaxBytesReader(w, r.Body, maxVerifyBytes))
+	if err != nil {
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			http.Error(w, fmt.Sprintf("Body exceeds %d bytes", maxVerifyBytes), http.StatusRequestEntityTooLarge)
+			return
+		}
+		http.Error(w, fmt.Sprintf("Failed to read body: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	result := Result{
+		ExpectedSHA256: sum,
+		ActualSHA256:   hex.EncodeToString(hash.Sum(nil)),
+		ExpectedLength: length,
+		ActualLength:   n,
+	}
+	result.Match = result.ActualSHA256 == sum && (length == nil || *length == n)
+
+	status := http.StatusOK
+	if result.Match {
+		verifications.WithLabelValues("match").Inc()
+	} else {
+		verifications.WithLabelValues("mismatch").Inc()
+		observability.WarnWithContext(r.Context(), fmt.Sprintf("Body of %d bytes does not match the expected checksum %s", n, sum))
+		status = http.StatusUnprocessableEntity
+	}
+
+	jsonData, err := json.Marshal(result)
+	if err != nil {
+		http.Error(w, "Failed to encode result", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_, _ = w.Write(jsonData)
+}
@@ -0,0 +1,111 @@
+package integrity
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMiddleware(t *testing.T) {
+	handler := Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain")
+		w.WriteHeader(http.StatusCreated)
+		_, _ = w.Write([]byte("hello "))
+		_, _ = w.Write([]byte("mesh"))
+	}))
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/istio-test/respond", nil))
+
+	assert.Equal(t, http.StatusCreated, w.Code)
+	assert.Equal(t, "hello mesh", w.Body.String())
+	assert.Equal(t, Sum([]byte("hello mesh")), w.Header().Get(SHA256Header))
+	assert.Equal(t, "10", w.Header().Get(LengthHeader))
+	assert.Equal(t, "10", w.Header().Get("Content-Length"))
+	assert.Equal(t, "text/plain", w.Header().Get("Content-Type"))
+
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodHead, "/istio-test/respond", nil))
+	assert.Empty(t, w.Body.String())
+	assert.Equal(t, "10", w.Header().Get(LengthHeader))
+}
+
+func TestVerifyHandler(t *testing.T) {
+	body := "payload that must not change"
+	sum := Sum([]byte(body))
+
+	tests := []struct {
+		name           string
+		target         string
+		header         map[string]string
+		body           string
+		expectedStatus int
+		expectedMatch  bool
+	}{
+		{
+			name:           "matching header checksum",
+			target:         "/istio-test/verify",
+			header:         map[string]string{SHA256Header: sum, LengthHeader: "28"},
+			body:           body,
+			expectedStatus: http.StatusOK,
+			expectedMatch:  true,
+		},
+		{
+			name:           "matching query checksum in upper case",
+			target:         "/istio-test/verify?sha256=" + strings.ToUpper(sum),
+			body:           body,
+			expectedStatus: http.StatusOK,
+			expectedMatch:  true,
+		},
+		{
+			name:           "corrupted body",
+			target:         "/istio-test/verify?sha256=" + sum,
+			body:           body + "!",
+			expectedStatus: http.StatusUnprocessableEntity,
+		},
+		{
+			name:           "length mismatch",
+			target:         "/istio-test/verify?sha256=" + sum + "&length=10",
+			body:           body,
+			expectedStatus: http.StatusUnprocessableEntity,
+		},
+		{
+			name:           "missing checksum",
+			target:         "/istio-test/verify",
+			body:           body,
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "invalid length",
+			target:         "/istio-test/verify?sha256=" + sum + "&length=-1",
+			body:           body,
+			expectedStatus: http.StatusBadRequest,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, tt.target, strings.NewReader(tt.body))
+			for name, value := range tt.header {
+				req.Header.Set(name, value)
+			}
+			w := httptest.NewRecorder()
+			VerifyHandler(w, req)
+
+			assert.Equal(t, tt.expectedStatus, w.Code)
+			if tt.expectedStatus == http.StatusBadRequest {
+				return
+			}
+			var result Result
+			require.NoError(t, json.Unmarshal(w.Body.Bytes(), &result))
+			assert.Equal(t, tt.expectedMatch, result.Match)
+			assert.Equal(t, Sum([]byte(tt.body)), result.ActualSHA256)
+			assert.Equal(t, int64(len(tt.body)), result.ActualLength)
+		})
+	}
+}
@@ -0,0 +1,220 @@
+// Package istioinfo reports which Istio revision and sidecar serve the pod.
+//
+// During a canary revision rollout pods of the same workload can be injected
+// by different control planes. The info endpoint combines the pod labels and
+// annotations exposed through the Downward API with the Envoy admin
+// server_info, so the revision, injection template and proxy version can be
+// audited per pod.
+package istioinfo
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"istio-test/internal/httpclient"
+	"istio-test/internal/observability"
+)
+
+// Labels and annotations set by Istio that describe the injection
+const (
+	RevisionLabel      = "istio.io/rev"
+	StatusAnnotation   = "sidecar.istio.io/status"
+	TemplateAnnotation = "inject.istio.io/templates"
+)
+
+// annotationPrefixes select the annotations reported in Info.Annotations
+var annotationPrefixes = []string{"sidecar.istio.io/", "proxy.istio.io/", "inject.istio.io/"}
+
+// labelPrefixes select the labels reported in Info.Labels
+var labelPrefixes = []string{"istio.io/", "sidecar.istio.io/", "service.istio.io/"}
+
+// Options configures where the pod information is read from
+type Options struct {
+	PodInfoDir    string // Directory holding the Downward API labels and annotations files
+	EnvoyAdminURL string // Envoy admin base URL, empty skips server_info
+}
+
+// Proxy describes the sidecar as reported by the Envoy admin server_info
+type Proxy struct {
+	IstioVersion string `json:"istio_version,omitempty"`
+	EnvoyVersion string `json:"envoy_version,omitempty"`
+	State        string `json:"state,omitempty"`
+	NodeID       string `json:"node_id,omitempty"`
+}
+
+// Info is returned by Handler
+type Info struct {
+	Injected           bool              `json:"injected"`                      // Whether the injection status annotation is present
+	Revision           string            `json:"revision,omitempty"`            // Revision that injected the sidecar, falling back to the istio.io/rev label
+	RevisionLabel      string            `json:"revision_label,omitempty"`      // istio.io/rev label of the pod
+	Templates          []string          `json:"templates,omitempty"`           // Injection templates applied
+	Proxy              *Proxy            `json:"proxy,omitempty"`               // Sidecar reported by Envoy, absent when unreachable
+	Labels             map[string]string `json:"labels,omitempty"`              // Istio labels of the pod
+	Annotations        map[string]string `json:"annotations,omitempty"`         // Istio annotations of the pod
+	UnavailableSources []string          `json:"unavailable_sources,omitempty"` // Sources that could not be read
+}
+
+// injectionStatus is the JSON value of the sidecar.istio.io/status annotation
+type injectionStatus struct {
+	Revision  string   `json:"revision"`
+	Templates []string `json:"templates"`
+}
+
+// serverInfo is the subset of the Envoy admin /server_info response in use
+type serverInfo struct {
+	Version string `json:"version"`
+	State   string `json:"state"`
+	Node    struct {
+		ID       string `json:"id"`
+		Metadata struct {
+			IstioVersion string `json:"ISTIO_VERSION"`
+		} `json:"metadata"`
+	} `json:"node"`
+}
+
+// ReadPodInfoFile parses a Downward API labels or annotations file, which
+// holds one key="value" pair per line with the value quoted as in Go
+func ReadPodInfoFile(path string) (map[string]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	values := make(map[string]string)
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		key, quoted, ok := strings.Cut(line, "=")
+		if !ok {
+			return nil, fmt.Errorf("malformed line in %s: %q", path, line)
+		}
+		value, err := strconv.Unquote(quoted)
+		if err != nil {
+			return nil, fmt.Errorf("malformed value of %s in %s: %w", key, path, err)
+		}
+		values[key] = value
+	}
+	return values, scanner.Err()
+}
+
+// withPrefix returns the entries whose key starts with one of the prefixes
+func withPrefix(values map[string]string, prefixes []string) map[string]string {
+	selected := make(map[string]string)
+	for key, value := range values {
+		for _, prefix := range prefixes {
+			if strings.HasPrefix(key, prefix) {
+				selected[key] = value
+				break
+			}
+		}
+	}
+	return selected
+}
+
+// fetchProxy reads the Envoy admin server_info
+func fetchProxy(ctx context.Context, client *httpclient.Client, adminURL string) (*Proxy, error) {
+	resp, err := client.Do(ctx, func(ctx context.Context) (*http.Request, error) {
+		return http.NewRequestWithContext(ctx, http.MethodGet, strings.TrimSuffix(adminURL, "/")+"/server_info", nil)
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		_, _ = io.Copy(io.Discard, resp.Body)
+		return nil, fmt.Errorf("envoy admin responded with status %d", resp.StatusCode)
+	}
+	var info serverInfo
+	if err := json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(&info); err != nil {
+		return nil, fmt.Errorf("error decoding server_info: %w", err)
+	}
+
+	proxy := &Proxy{
+		IstioVersion: info.Node.Metadata.IstioVersion,
+		EnvoyVersion: info.Version,
+		State:        info.State,
+		NodeID:       info.Node.ID,
+	}
+	// The build version reads <sha>/<version>/<status>/<build type>/<ssl>
+	if parts := strings.Split(info.Version, "/"); len(parts) > 1 {
+		proxy.EnvoyVersion = parts[1]
+	}
+	return proxy, nil
+}
+
+// Collect gathers the Istio information of the pod. Unreadable sources are
+// listed in the result rather than failing the collection.
+func Collect(ctx context.Context, client *httpclient.Client, options Options) Info {
+	var info Info
+
+	labels, err := ReadPodInfoFile(filepath.Join(options.PodInfoDir, "labels"))
+	if err != nil {
+		observability.WarnWithContext(ctx, fmt.Sprintf("Pod labels unavailable: %v", err))
+		info.UnavailableSources = append(info.UnavailableSources, "labels")
+	}
+	annotations, err := ReadPodInfoFile(filepath.Join(options.PodInfoDir, "annotations"))
+	if err != nil {
+		observability.WarnWithContext(ctx, fmt.Sprintf("Pod annotations unavailable: %v", err))
+		info.UnavailableSources = append(info.UnavailableSources, "annotations")
+	}
+
+	info.Labels = withPrefix(labels, labelPrefixes)
+	info.Annotations = withPrefix(annotations, annotationPrefixes)
+	info.RevisionLabel = labels[RevisionLabel]
+	info.Revision = info.RevisionLabel
+
+	if raw, ok := annotations[StatusAnnotation]; ok {
+		info.Injected = true
+		var status injectionStatus
+		if err := json.Unmarshal([]byte(raw), &status); err == nil {
+			if status.Revision != "" {
+				info.Revision = status.Revision
+			}
+			info.Templates = status.Templates
+		}
+	}
+	if len(info.Templates) == 0 && annotations[TemplateAnnotation] != "" {
+		info.Templates = strings.Split(annotations[TemplateAnnotation], ",")
+	}
+
+	if options.EnvoyAdminURL != "" {
+		proxy, err := fetchProxy(ctx, client, options.EnvoyAdminURL)
+		if err != nil {
+			observability.WarnWithContext(ctx, fmt.Sprintf("Envoy server_info unavailable: %v", err))
+			info.UnavailableSources = append(info.UnavailableSources, "envoy")
+		}
+		info.Proxy = proxy
+	}
+
+	return info
+}
+
+// Handler returns the Istio information of the pod as JSON
+func Handler(client *httpclient.Client, options Options) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		jsonData, err := json.Marshal(Collect(r.Context(), client, options))
+		if err != nil {
+			observability.ErrorWithContext(r.Context(), fmt.Sprintf("Error encoding Istio info: %v", err))
+			http.Error(w, "Failed to encode Istio info", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		_, _ = w.Write(jsonData)
+	}
+}
@@ -0,0 +1,124 @@
+package istioinfo
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"istio-test/internal/httpclient"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testLabels = `app="istio-test"
+istio.io/rev="1-24-canary"
+pod-template-hash="5d9f8c7b6"
+service.istio.io/canonical-name="istio-test"
+`
+
+const testAnnotations = `kubectl.kubernetes.io/default-container="istio-test"
+proxy.istio.io/config="{\"holdApplicationUntilProxyStarts\":true}"
+sidecar.istio.io/status="{\"initContainers\":[\"istio-init\"],\"containers\":[\"istio-proxy\"],\"revision\":\"1-24-canary\",\"templates\":[\"sidecar\"]}"
+`
+
+const testServerInfo = `{
+  "version": "6c72b2179f5a58988b920a55b0be8346de3f7b35/1.32.3/Clean/RELEASE/BoringSSL",
+  "state": "LIVE",
+  "node": {
+    "id": "sidecar~10.0.0.12~istio-test-5d9f8c7b6-x2k4q.istio-test~istio-test.svc.cluster.local",
+    "metadata": {"ISTIO_VERSION": "1.24.2"}
+  }
+}`
+
+func newClient() *httpclient.Client {
+	return httpclient.NewFactory(nil, nil).Client("istioinfo-test")
+}
+
+func writePodInfo(t *testing.T, labels, annotations string) string {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "labels"), []byte(labels), 0600))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "annotations"), []byte(annotations), 0600))
+	return dir
+}
+
+func TestReadPodInfoFile(t *testing.T) {
+	dir := writePodInfo(t, testLabels, "broken")
+
+	labels, err := ReadPodInfoFile(filepath.Join(dir, "labels"))
+	require.NoError(t, err)
+	assert.Equal(t, "1-24-canary", labels["istio.io/rev"])
+	assert.Len(t, labels, 4)
+
+	_, err = ReadPodInfoFile(filepath.Join(dir, "annotations"))
+	assert.Error(t, err)
+
+	_, err = ReadPodInfoFile(filepath.Join(dir, "missing"))
+	assert.Error(t, err)
+}
+
+func TestCollect(t *testing.T) {
+	envoy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/server_info", r.URL.Path)
+		w.Write([]byte(testServerInfo))
+	}))
+	defer envoy.Close()
+
+	info := Collect(context.Background(), newClient(), Options{
+		PodInfoDir:    writePodInfo(t, testLabels, testAnnotations),
+		EnvoyAdminURL: envoy.URL,
+	})
+
+	assert.True(t, info.Injected)
+	assert.Equal(t, "1-24-canary", info.Revision)
+	assert.Equal(t, "1-24-canary", info.RevisionLabel)
+	assert.Equal(t, []string{"sidecar"}, info.Templates)
+	assert.Equal(t, map[string]string{
+		"istio.io/rev":                    "1-24-canary",
+		"service.istio.io/canonical-name": "istio-test",
+	}, info.Labels)
+	assert.Contains(t, info.Annotations, "proxy.istio.io/config")
+	assert.NotContains(t, info.Annotations, "kubectl.kubernetes.io/default-container")
+	require.NotNil(t, info.Proxy)
+	assert.Equal(t, Proxy{
+		IstioVersion: "1.24.2",
+		EnvoyVersion: "1.32.3",
+		State:        "LIVE",
+		NodeID:       "sidecar~10.0.0.12~istio-test-5d9f8c7b6-x2k4q.istio-test~istio-test.svc.cluster.local",
+	}, *info.Proxy)
+	assert.Empty(t, info.UnavailableSources)
+}
+
+func TestCollectWithoutSources(t *testing.T) {
+	envoy := httptest.NewServer(http.NotFoundHandler())
+	defer envoy.Close()
+
+	info := Collect(context.Background(), newClient(), Options{
+		PodInfoDir:    t.TempDir(),
+		EnvoyAdminURL: envoy.URL,
+	})
+
+	assert.False(t, info.Injected)
+	assert.Nil(t, info.Proxy)
+	assert.Equal(t, []string{"labels", "annotations", "envoy"}, info.UnavailableSources)
+}
+
+func TestHandler(t *testing.T) {
+	dir := writePodInfo(t, `istio.io/rev="default"`, `inject.istio.io/templates="sidecar,custom"`)
+
+	w := httptest.NewRecorder()
+	Handler(newClient(), Options{PodInfoDir: dir})(w, httptest.NewRequest(http.MethodGet, "/admin/istio/info", nil))
+
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "application/json", w.Header().Get("Content-Type"))
+	var info Info
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &info))
+	assert.False(t, info.Injected)
+	assert.Equal(t, "default", info.Revision)
+	assert.Equal(t, []string{"sidecar", "custom"}, info.Templates)
+	assert.Nil(t, info.Proxy, "no admin URL skips server_info")
+}
@@ -0,0 +1,105 @@
+package istioinfo
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"istio-test/internal/httpclient"
+)
+
+// syncStatsFilter selects the Envoy stats describing the xDS connection and
+// the cluster and listener updates received through it
+const syncStatsFilter = `^(control_plane\.connected_state|cluster_manager\.cds\.|listener_manager\.lds\.)`
+
+// XDSStatus describes the updates the sidecar received from one xDS API
+type XDSStatus struct {
+	Version  string `json:"version,omitempty"` // Version of the last accepted update
+	Attempts uint64 `json:"update_attempts"`
+	Accepted uint64 `json:"update_success"`
+	Rejected uint64 `json:"update_rejected"` // Updates the sidecar refused, e.g. invalid configuration
+	Failures uint64 `json:"update_failure"`  // Updates that failed to arrive
+}
+
+// SyncStatus tells whether the sidecar is connected to istiod and in sync,
+// from the pod side of what istioctl proxy-status shows
+type SyncStatus struct {
+	Connected bool      `json:"connected"` // The sidecar holds an xDS connection to the control plane
+	Clusters  XDSStatus `json:"clusters"`  // CDS
+	Listeners XDSStatus `json:"listeners"` // LDS
+}
+
+// FetchSyncStatus reads the xDS stats of the sidecar from the Envoy admin
+func FetchSyncStatus(ctx context.Context, client *httpclient.Client, adminURL string) (*SyncStatus, error) {
+	target := strings.TrimSuffix(adminURL, "/") + "/stats?" + url.Values{"filter": {syncStatsFilter}}.Encode()
+	resp, err := client.Do(ctx, func(ctx context.Context) (*http.Request, error) {
+		return http.NewRequestWithContext(ctx, http.MethodGet, target, nil)
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		_, _ = io.Copy(io.Discard, resp.Body)
+		return nil, fmt.Errorf("envoy admin responded with status %d", resp.StatusCode)
+	}
+	return parseSyncStats(io.LimitReader(resp.Body, 1<<20))
+}
+
+// parseSyncStats parses the "name: value" lines of the Envoy stats text
+// format; text readouts such as version_text are quoted
+func parseSyncStats(r io.Reader) (*SyncStatus, error) {
+	var status SyncStatus
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		name, value, ok := strings.Cut(scanner.Text(), ": ")
+		if !ok {
+			continue
+		}
+		if name == "control_plane.connected_state" {
+			status.Connected = value == "1"
+			continue
+		}
+
+		var xds *XDSStatus
+		switch {
+		case strings.HasPrefix(name, "cluster_manager.cds."):
+			xds, name = &status.Clusters, strings.TrimPrefix(name, "cluster_manager.cds.")
+		case strings.HasPrefix(name, "listener_manager.lds."):
+			xds, name = &status.Listeners, strings.TrimPrefix(name, "listener_manager.lds.")
+		default:
+			continue
+		}
+		if name == "version_text" {
+			if unquoted, err := strconv.Unquote(value); err == nil {
+				value = unquoted
+			}
+			xds.Version = value
+			continue
+		}
+		count, err := strconv.ParseUint(value, 10, 64)
+		if err != nil {
+			continue
+		}
+		switch name {
+		case "update_attempt":
+			xds.Attempts = count
+		case "update_success":
+			xds.Accepted = count
+		case "update_rejected":
+			xds.Rejected = count
+		case "update_failure":
+			xds.Failures = count
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("error reading stats: %w", err)
+	}
+	return &status, nil
+}
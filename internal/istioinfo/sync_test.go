@@ -0,0 +1,47 @@
+package istioinfo
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testSyncStats = `cluster_manager.cds.update_attempt: 12
+cluster_manager.cds.update_failure: 1
+cluster_manager.cds.update_rejected: 2
+cluster_manager.cds.update_success: 9
+cluster_manager.cds.version_text: "2024-11-02T10:15:00Z/42"
+control_plane.connected_state: 1
+listener_manager.lds.update_attempt: 5
+listener_manager.lds.update_success: 5
+listener_manager.lds.version_text: "2024-11-02T10:15:00Z/42"
+`
+
+func TestFetchSyncStatus(t *testing.T) {
+	envoy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/stats", r.URL.Path)
+		assert.Equal(t, syncStatsFilter, r.URL.Query().Get("filter"))
+		w.Write([]byte(testSyncStats))
+	}))
+	defer envoy.Close()
+
+	status, err := FetchSyncStatus(context.Background(), newClient(), envoy.URL)
+	require.NoError(t, err)
+	assert.Equal(t, SyncStatus{
+		Connected: true,
+		Clusters:  XDSStatus{Version: "2024-11-02T10:15:00Z/42", Attempts: 12, Accepted: 9, Rejected: 2, Failures: 1},
+		Listeners: XDSStatus{Version: "2024-11-02T10:15:00Z/42", Attempts: 5, Accepted: 5},
+	}, *status)
+}
+
+func TestFetchSyncStatusErrors(t *testing.T) {
+	envoy := httptest.NewServer(http.NotFoundHandler())
+	defer envoy.Close()
+
+	_, err := FetchSyncStatus(context.Background(), newClient(), envoy.URL)
+	assert.ErrorContains(t, err, "status 404")
+}
@@ -0,0 +1,135 @@
+package metadata
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"istio-test/internal/observability"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// NoExpiry marks a cached URL whose value never changes during the pod's lifetime
+const NoExpiry time.Duration = -1
+
+// CacheBypassParam is the query parameter that makes a metadata request skip
+// the cache; the fetched value still refreshes the cached entry
+const CacheBypassParam = "nocache"
+
+// CacheOptions configures the metadata cache
+type CacheOptions struct {
+	TTL  time.Duration            // Lifetime of a cached value
+	TTLs map[string]time.Duration // Per-URL lifetimes overriding TTL, NoExpiry caches for the pod's lifetime
+}
+
+// DefaultCacheTTLs returns the per-URL lifetimes of values that never change
+// while the pod runs
+func DefaultCacheTTLs() map[string]time.Duration {
+	return map[string]time.Duration{
+		ClusterNameURL:      NoExpiry,
+		ClusterLocationURL:  NoExpiry,
+		ProjectIDURL:        NoExpiry,
+		NumericProjectIDURL: NoExpiry,
+		InstanceIDURL:       NoExpiry,
+		MachineTypeURL:      NoExpiry,
+		HostnameURL:         NoExpiry,
+	}
+}
+
+var cacheRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Namespace: "istio_test",
+	Name:      "metadata_cache_requests_total",
+	Help:      "Total number of metadata cache lookups by metadata type and result (hit, miss, bypass).",
+}, []string{"type", "result"})
+
+func init() {
+	observability.MetricsRegistry().MustRegister(cacheRequests)
+}
+
+// cacheEntry is a cached metadata value
+type cacheEntry struct {
+	value    string
+	storedAt time.Time
+}
+
+// Cache caches successful metadata fetches in memory
+type Cache struct {
+	mu      sync.Mutex
+	fetcher MetadataFetcher
+	options CacheOptions
+	entries map[string]cacheEntry
+	now     func() time.Time
+}
+
+// NewCache creates a metadata cache in front of fetcher
+func NewCache(fetcher MetadataFetcher, options CacheOptions) *Cache {
+	return &Cache{
+		fetcher: fetcher,
+		options: options,
+		entries: make(map[string]cacheEntry),
+		now:     time.Now,
+	}
+}
+
+type cacheBypassKey struct{}
+
+// WithCacheBypass returns a context whose metadata fetches skip the cache
+func WithCacheBypass(ctx context.Context) context.Context {
+	return context.WithValue(ctx, cacheBypassKey{}, true)
+}
+
+// cacheBypassed reports whether ctx was created by WithCacheBypass
+func cacheBypassed(ctx context.Context) bool {
+	bypass, _ := ctx.Value(cacheBypassKey{}).(bool)
+	return bypass
+}
+
+// ttl returns the lifetime of a cached value of url
+func (c *Cache) ttl(url string) time.Duration {
+	if ttl, ok := c.options.TTLs[url]; ok {
+		return ttl
+	}
+	return c.options.TTL
+}
+
+// FetchMetadata returns the cached value of url, fetching it on a miss, an
+// expired entry or a bypassed lookup. Errors are not cached.
+func (c *Cache) FetchMetadata(ctx context.Context, url string) (string, error) {
+	metadataType := typeFor(url)
+
+	if cacheBypassed(ctx) {
+		cacheRequests.WithLabelValues(metadataType, "bypass").Inc()
+	} else {
+		c.mu.Lock()
+		e, ok := c.entries[url]
+		c.mu.Unlock()
+
+		ttl := c.ttl(url)
+		if ok && (ttl == NoExpiry || c.now().Sub(e.storedAt) < ttl) {
+			cacheRequests.WithLabelValues(metadataType, "hit").Inc()
+			return e.value, nil
+		}
+		cacheRequests.WithLabelValues(metadataType, "miss").Inc()
+	}
+
+	value, err := c.fetcher.FetchMetadata(ctx, url)
+	if err != nil {
+		return "", err
+	}
+
+	c.mu.Lock()
+	c.entries[url] = cacheEntry{value: value, storedAt: c.now()}
+	c.mu.Unlock()
+	return value, nil
+}
+
+// typeFor returns the metadata type of url, used as a bounded metric label
+func typeFor(url string) string {
+	for t, u := range metadataURLs {
+		if u == url {
+			return t
+		}
+	}
+	return "other"
+}
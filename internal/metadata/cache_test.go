@@ -0,0 +1,104 @@
+package metadata
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// countingFetcher counts fetches and can be made to fail
+type countingFetcher struct {
+	calls int
+	err   error
+}
+
+func (f *countingFetcher) FetchMetadata(ctx context.Context, url string) (string, error) {
+	f.calls++
+	if f.err != nil {
+		return "", f.err
+	}
+	return url, nil
+}
+
+func TestCacheTTL(t *testing.T) {
+	fetcher := &countingFetcher{}
+	c := NewCache(fetcher, CacheOptions{TTL: time.Minute, TTLs: DefaultCacheTTLs()})
+	now := time.Now()
+	c.now = func() time.Time { return now }
+
+	for i := 0; i < 3; i++ {
+		value, err := c.FetchMetadata(context.Background(), InstanceZoneURL)
+		require.NoError(t, err)
+		assert.Equal(t, InstanceZoneURL, value)
+		_, err = c.FetchMetadata(context.Background(), ClusterNameURL)
+		require.NoError(t, err)
+	}
+	assert.Equal(t, 2, fetcher.calls)
+
+	// The zone expires after TTL, the cluster name never does
+	now = now.Add(time.Hour)
+	_, err := c.FetchMetadata(context.Background(), InstanceZoneURL)
+	require.NoError(t, err)
+	_, err = c.FetchMetadata(context.Background(), ClusterNameURL)
+	require.NoError(t, err)
+	assert.Equal(t, 3, fetcher.calls)
+}
+
+func TestCacheBypass(t *testing.T) {
+	fetcher := &countingFetcher{}
+	c := NewCache(fetcher, CacheOptions{TTL: time.Minute})
+
+	hits := testutil.ToFloat64(cacheRequests.WithLabelValues("cluster-location", "hit"))
+	bypasses := testutil.ToFloat64(cacheRequests.WithLabelValues("cluster-location", "bypass"))
+
+	_, err := c.FetchMetadata(context.Background(), ClusterLocationURL)
+	require.NoError(t, err)
+	_, err = c.FetchMetadata(WithCacheBypass(context.Background()), ClusterLocationURL)
+	require.NoError(t, err)
+	_, err = c.FetchMetadata(context.Background(), ClusterLocationURL)
+	require.NoError(t, err)
+
+	assert.Equal(t, 2, fetcher.calls)
+	assert.Equal(t, hits+1, testutil.ToFloat64(cacheRequests.WithLabelValues("cluster-location", "hit")))
+	assert.Equal(t, bypasses+1, testutil.ToFloat64(cacheRequests.WithLabelValues("cluster-location", "bypass")))
+}
+
+func TestCacheDoesNotStoreErrors(t *testing.T) {
+	fetcher := &countingFetcher{err: errors.New("unavailable")}
+	c := NewCache(fetcher, CacheOptions{TTL: time.Minute})
+
+	_, err := c.FetchMetadata(context.Background(), ClusterNameURL)
+	assert.Error(t, err)
+
+	fetcher.err = nil
+	value, err := c.FetchMetadata(context.Background(), ClusterNameURL)
+	require.NoError(t, err)
+	assert.Equal(t, ClusterNameURL, value)
+	assert.Equal(t, 2, fetcher.calls)
+}
+
+func TestMetadataHandlerCacheBypass(t *testing.T) {
+	var bypassed bool
+	handler := MetadataHandler(func(ctx context.Context, url string) (string, error) {
+		bypassed = cacheBypassed(ctx)
+		return "test-cluster", nil
+	})
+
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/istio-test/metadata/cluster-name", nil))
+	assert.False(t, bypassed)
+
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/istio-test/metadata/cluster-name?nocache=true", nil))
+	assert.True(t, bypassed)
+}
+
+func TestTypeFor(t *testing.T) {
+	assert.Equal(t, "instance-zone", typeFor(InstanceZoneURL))
+	assert.Equal(t, "other", typeFor("http://example.com"))
+}
@@ -0,0 +1,287 @@
+package metadata
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"istio-test/internal/httperr"
+	"istio-test/internal/observability"
+	"istio-test/internal/version"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// CheckerOptions configures the background health checker
+type CheckerOptions struct {
+	Interval       time.Duration // Interval between check runs
+	StaleAfter     time.Duration // Results older than this degrade the check
+	UnhealthyAfter time.Duration // Results older than this fail the check, zero never fails on age
+}
+
+// HealthChecker runs the checks of a HealthRegistry in the background, so
+// health probes are answered from the latest results instead of reaching
+// every dependency on each request
+type HealthChecker struct {
+	registry *HealthRegistry
+	options  CheckerOptions
+	now      func() time.Time
+
+	mu           sync.RWMutex
+	results      map[string]HealthCheck
+	history      []HealthSnapshot
+	transitions  []HealthTransition
+	onTransition []func(ctx context.Context, transition HealthTransition)
+}
+
+// healthHistorySize is the number of check runs kept by a HealthChecker
+const healthHistorySize = 60
+
+// healthTransitionsSize is the number of transitions kept by a HealthChecker;
+// they outlive the run history, which a flapping check fills in minutes
+const healthTransitionsSize = 100
+
+var healthTransitions = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Namespace: "istio_test",
+	Name:      "health_transitions_total",
+	Help:      "Total number of changes of the overall health status between background check runs, by previous and new status.",
+}, []string{"from", "to"})
+
+func init() {
+	observability.MetricsRegistry().MustRegister(healthTransitions)
+}
+
+// HealthSnapshot summarizes one background check run
+type HealthSnapshot struct {
+	Time   time.Time               `json:"time"`
+	Status HealthStatus            `json:"status"`
+	Checks map[string]HealthStatus `json:"checks"`
+}
+
+// HealthTransition is a change of the overall status between check runs
+type HealthTransition struct {
+	Time    time.Time              `json:"time"`
+	From    HealthStatus           `json:"from,omitempty"` // Empty when the first run was not healthy
+	To      HealthStatus           `json:"to"`
+	Failing map[string]HealthCheck `json:"failing,omitempty"` // Checks that were not healthy in the run
+}
+
+// NewHealthChecker creates a health checker; call Run to start checking
+func NewHealthChecker(registry *HealthRegistry, options CheckerOptions) *HealthChecker {
+	if options.Interval <= 0 {
+		options.Interval = 10 * time.Second
+	}
+	if options.StaleAfter <= 0 {
+		options.StaleAfter = 3 * options.Interval
+	}
+	return &HealthChecker{
+		registry: registry,
+		options:  options,
+		now:      time.Now,
+	}
+}
+
+// Run checks immediately and then on every interval until ctx is done
+func (c *HealthChecker) Run(ctx context.Context) {
+	ticker := time.NewTicker(c.options.Interval)
+	defer ticker.Stop()
+
+	for {
+		c.check(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// check runs every check once and stores the results
+func (c *HealthChecker) check(ctx context.Context) {
+	results := c.registry.CheckAll(ctx)
+	snapshot := HealthSnapshot{
+		Time:   c.now().UTC(),
+		Status: determineOverallHealth(results),
+		Checks: make(map[string]HealthStatus, len(results)),
+	}
+	for name, result := range results {
+		snapshot.Checks[name] = result.Status
+	}
+
+	c.mu.Lock()
+	var previous HealthStatus
+	if len(c.history) > 0 {
+		previous = c.history[len(c.history)-1].Status
+	}
+	c.results = results
+	if len(c.history) == healthHistorySize {
+		c.history = c.history[1:]
+	}
+	c.history = append(c.history, snapshot)
+
+	// A first run is only a transition when it starts out unhealthy
+	changed := previous != snapshot.Status && (previous != "" || snapshot.Status != HealthStatusHealthy)
+	var transition HealthTransition
+	if changed {
+		transition = HealthTransition{Time: snapshot.Time, From: previous, To: snapshot.Status}
+		for name, result := range results {
+			if result.Status != HealthStatusHealthy {
+				if transition.Failing == nil {
+					transition.Failing = map[string]HealthCheck{}
+				}
+				transition.Failing[name] = result
+			}
+		}
+		if len(c.transitions) == healthTransitionsSize {
+			c.transitions = c.transitions[1:]
+		}
+		c.transitions = append(c.transitions, transition)
+	}
+	onTransition := c.onTransition
+	c.mu.Unlock()
+
+	if changed {
+		c.reportTransition(ctx, transition)
+		for _, fn := range onTransition {
+			fn(ctx, transition)
+		}
+	}
+}
+
+// reportTransition logs and counts a transition
+func (c *HealthChecker) reportTransition(ctx context.Context, transition HealthTransition) {
+	from := string(transition.From)
+	if from == "" {
+		from = "none"
+	}
+	healthTransitions.WithLabelValues(from, string(transition.To)).Inc()
+
+	failing := slices.Sorted(maps.Keys(transition.Failing))
+	fields := map[string]any{
+		"type":           "health_transition",
+		"from":           from,
+		"to":             transition.To,
+		"failing_checks": failing,
+	}
+	if transition.To == HealthStatusHealthy {
+		observability.InfoWithFields(ctx, fmt.Sprintf("Health recovered from %s to %s", from, transition.To), fields)
+		return
+	}
+	observability.WarnWithFields(ctx, fmt.Sprintf("Health changed from %s to %s, failing checks: %s",
+		from, transition.To, strings.Join(failing, ", ")), fields)
+}
+
+// OnTransition registers fn to be called after every change of the overall
+// status; fn runs on the checking goroutine and must not block it
+func (c *HealthChecker) OnTransition(fn func(ctx context.Context, transition HealthTransition)) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.onTransition = append(c.onTransition, fn)
+}
+
+// Transitions returns the latest changes of the overall status, oldest first
+func (c *HealthChecker) Transitions() []HealthTransition {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return append([]HealthTransition{}, c.transitions...)
+}
+
+// History returns the summaries of the latest check runs, oldest first
+func (c *HealthChecker) History() []HealthSnapshot {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return append([]HealthSnapshot{}, c.history...)
+}
+
+// TransitionsHandler serves the latest changes of the overall status
+func (c *HealthChecker) TransitionsHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		jsonData, err := json.Marshal(c.Transitions())
+		if err != nil {
+			observability.ErrorWithContext(r.Context(), fmt.Sprintf("Error encoding health transitions: %v", err))
+			httperr.Error(w, r, http.StatusInternalServerError, "Failed to encode health transitions")
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		_, _ = w.Write(jsonData)
+	}
+}
+
+// Results returns the latest results with their age, degrading or failing
+// results that are older than the staleness thresholds
+func (c *HealthChecker) Results() map[string]HealthCheck {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	now := c.now()
+	if c.results == nil {
+		pending := make(map[string]HealthCheck)
+		for _, checker := range c.registry.Checkers() {
+			pending[checker.Name()] = HealthCheck{
+				Status:  HealthStatusDegraded,
+				Message: "Waiting for the first background check",
+			}
+		}
+		return pending
+	}
+
+	results := make(map[string]HealthCheck, len(c.results))
+	for name, check := range c.results {
+		age := now.Sub(check.LastChecked)
+		check.Age = age.Round(time.Millisecond).String()
+		switch {
+		case c.options.UnhealthyAfter > 0 && age > c.options.UnhealthyAfter:
+			check.Status = HealthStatusUnhealthy
+			check.Message = fmt.Sprintf("Result is stale (%s old): %s", check.Age, check.Message)
+		case age > c.options.StaleAfter && check.Status == HealthStatusHealthy:
+			check.Status = HealthStatusDegraded
+			check.Message = fmt.Sprintf("Result is stale (%s old): %s", check.Age, check.Message)
+		}
+		results[name] = check
+	}
+	return results
+}
+
+// Handler serves the cached results in the same format as EnhancedHealthCheckHandler
+func (c *HealthChecker) Handler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		health := HealthResponse{
+			Timestamp: time.Now().UTC(),
+			Uptime:    time.Since(startTime).String(),
+			Version:   version.Get().Version,
+			Checks:    c.Results(),
+		}
+		health.Checks["http_server"] = HealthCheck{
+			Status:      HealthStatusHealthy,
+			Message:     "HTTP server is responding",
+			Duration:    "0s",
+			LastChecked: health.Timestamp,
+		}
+		health.Status = determineOverallHealth(health.Checks)
+
+		jsonData, err := json.Marshal(health)
+		if err != nil {
+			observability.ErrorWithContext(r.Context(), fmt.Sprintf("Error encoding health response: %v", err))
+			httperr.Error(w, r, http.StatusInternalServerError, "Failed to encode health response")
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		if health.Status == HealthStatusUnhealthy {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		} else {
+			w.WriteHeader(http.StatusOK)
+		}
+		if _, err := w.Write(jsonData); err != nil {
+			observability.ErrorWithContext(r.Context(), fmt.Sprintf("Error writing health response: %v", err))
+		}
+	}
+}
@@ -0,0 +1,195 @@
+package metadata
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"istio-test/internal/httpretry"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newTestMetadataClient returns a client whose metadata server requests reach handler
+func newTestMetadataClient(t *testing.T, handler http.HandlerFunc) *Client {
+	ts := httptest.NewServer(handler)
+	t.Cleanup(ts.Close)
+
+	return NewClientWithPolicy(&http.Client{
+		Timeout: time.Second,
+		Transport: roundTripFunc(func(req *http.Request) (*http.Response, error) {
+			req.URL.Scheme = "http"
+			req.URL.Host = ts.Listener.Addr().String()
+			return http.DefaultTransport.RoundTrip(req)
+		}),
+	}, httpretry.DefaultPolicy())
+}
+
+func TestHealthCheckerServesCachedResults(t *testing.T) {
+	var requests atomic.Int32
+	client := newTestMetadataClient(t, func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		w.Write([]byte("test-cluster"))
+	})
+	registry := NewHealthRegistry(MetadataServiceCheck(client))
+	registry.RegisterDependency(dependencyFunc{name: "queue", err: fmt.Errorf("connection refused")})
+	checker := NewHealthChecker(registry, CheckerOptions{Interval: time.Hour})
+
+	// Before the first run the result is pending
+	assert.Equal(t, HealthStatusDegraded, checker.Results()["metadata_service"].Status)
+
+	checker.check(context.Background())
+	for i := 0; i < 3; i++ {
+		w := httptest.NewRecorder()
+		checker.Handler()(w, httptest.NewRequest("GET", "/istio-test/health", nil))
+		require.Equal(t, http.StatusOK, w.Code)
+
+		var health HealthResponse
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &health))
+		assert.Equal(t, HealthStatusDegraded, health.Status)
+		assert.Equal(t, HealthStatusHealthy, health.Checks["metadata_service"].Status)
+		assert.NotEmpty(t, health.Checks["metadata_service"].Age)
+		assert.Equal(t, HealthStatusDegraded, health.Checks["queue"].Status)
+		assert.Equal(t, HealthStatusHealthy, health.Checks["http_server"].Status)
+	}
+	assert.Equal(t, int32(1), requests.Load(), "probes must not reach the metadata server")
+}
+
+func TestHealthCheckerStaleness(t *testing.T) {
+	client := newTestMetadataClient(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("test-cluster"))
+	})
+	checker := NewHealthChecker(NewHealthRegistry(MetadataServiceCheck(client)), CheckerOptions{
+		Interval:       time.Second,
+		StaleAfter:     5 * time.Second,
+		UnhealthyAfter: 30 * time.Second,
+	})
+	checker.check(context.Background())
+	checked := checker.results["metadata_service"].LastChecked
+
+	checker.now = func() time.Time { return checked.Add(10 * time.Second) }
+	result := checker.Results()["metadata_service"]
+	assert.Equal(t, HealthStatusDegraded, result.Status)
+	assert.Equal(t, "10s", result.Age)
+	assert.Contains(t, result.Message, "stale")
+
+	checker.now = func() time.Time { return checked.Add(time.Minute) }
+	assert.Equal(t, HealthStatusUnhealthy, checker.Results()["metadata_service"].Status)
+
+	w := httptest.NewRecorder()
+	checker.Handler()(w, httptest.NewRequest("GET", "/istio-test/health", nil))
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+}
+
+func TestHealthCheckerRun(t *testing.T) {
+	var requests atomic.Int32
+	client := newTestMetadataClient(t, func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		w.Write([]byte("test-cluster"))
+	})
+	checker := NewHealthChecker(NewHealthRegistry(MetadataServiceCheck(client)), CheckerOptions{Interval: 10 * time.Millisecond})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		checker.Run(ctx)
+		close(done)
+	}()
+
+	assert.Eventually(t, func() bool { return requests.Load() >= 2 }, time.Second, 5*time.Millisecond)
+	cancel()
+	<-done
+	assert.Equal(t, HealthStatusHealthy, checker.Results()["metadata_service"].Status)
+}
+
+func TestHealthCheckerHistory(t *testing.T) {
+	var failing atomic.Bool
+	registry := NewHealthRegistry(NewCheck("dns", true, 0, func(ctx context.Context) error {
+		if failing.Load() {
+			return fmt.Errorf("no such host")
+		}
+		return nil
+	}))
+	checker := NewHealthChecker(registry, CheckerOptions{Interval: time.Hour})
+	assert.Empty(t, checker.History())
+
+	checker.check(context.Background())
+	failing.Store(true)
+	checker.check(context.Background())
+
+	history := checker.History()
+	require.Len(t, history, 2)
+	assert.Equal(t, HealthStatusHealthy, history[0].Status)
+	assert.Equal(t, HealthStatusUnhealthy, history[1].Status)
+	assert.Equal(t, map[string]HealthStatus{"dns": HealthStatusUnhealthy}, history[1].Checks)
+
+	for i := 0; i < healthHistorySize; i++ {
+		checker.check(context.Background())
+	}
+	history = checker.History()
+	assert.Len(t, history, healthHistorySize)
+	assert.Equal(t, HealthStatusUnhealthy, history[0].Status, "oldest runs are dropped")
+}
+
+func TestHealthCheckerTransitions(t *testing.T) {
+	var failing atomic.Bool
+	registry := NewHealthRegistry(NewCheck("dns", true, 0, func(ctx context.Context) error {
+		if failing.Load() {
+			return fmt.Errorf("no such host")
+		}
+		return nil
+	}))
+	checker := NewHealthChecker(registry, CheckerOptions{Interval: time.Hour})
+	var notified []HealthTransition
+	checker.OnTransition(func(ctx context.Context, transition HealthTransition) {
+		notified = append(notified, transition)
+	})
+
+	// A healthy start and unchanged runs are no transitions
+	checker.check(context.Background())
+	checker.check(context.Background())
+	assert.Empty(t, checker.Transitions())
+
+	failing.Store(true)
+	checker.check(context.Background())
+	checker.check(context.Background())
+	failing.Store(false)
+	checker.check(context.Background())
+
+	transitions := checker.Transitions()
+	require.Len(t, transitions, 2)
+	assert.Equal(t, notified, transitions)
+	assert.Equal(t, HealthStatusHealthy, transitions[0].From)
+	assert.Equal(t, HealthStatusUnhealthy, transitions[0].To)
+	require.Contains(t, transitions[0].Failing, "dns")
+	assert.Contains(t, transitions[0].Failing["dns"].Message, "no such host")
+	assert.Equal(t, HealthStatusUnhealthy, transitions[1].From)
+	assert.Equal(t, HealthStatusHealthy, transitions[1].To)
+	assert.Empty(t, transitions[1].Failing)
+
+	w := httptest.NewRecorder()
+	checker.TransitionsHandler()(w, httptest.NewRequest("GET", "/admin/health/transitions", nil))
+	require.Equal(t, http.StatusOK, w.Code)
+	var served []HealthTransition
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &served))
+	assert.Len(t, served, 2)
+}
+
+func TestHealthCheckerUnhealthyStart(t *testing.T) {
+	registry := NewHealthRegistry(NewCheck("dns", true, 0, func(ctx context.Context) error {
+		return fmt.Errorf("no such host")
+	}))
+	checker := NewHealthChecker(registry, CheckerOptions{Interval: time.Hour})
+	checker.check(context.Background())
+
+	transitions := checker.Transitions()
+	require.Len(t, transitions, 1)
+	assert.Empty(t, transitions[0].From)
+	assert.Equal(t, HealthStatusUnhealthy, transitions[0].To)
+}
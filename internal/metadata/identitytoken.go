@@ -0,0 +1,164 @@
+package metadata
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+
+	"istio-test/internal/httperr"
+	"istio-test/internal/observability"
+)
+
+// Token URLs of the default service account on the GCE metadata server
+const (
+	IdentityTokenURL = "http://metadata.google.internal/computeMetadata/v1/instance/service-accounts/default/identity"
+	AccessTokenURL   = "http://metadata.google.internal/computeMetadata/v1/instance/service-accounts/default/token"
+)
+
+// Query parameters of the identity token endpoint
+const (
+	AudienceParam    = "audience"     // Audience of the identity token, one of IdentityTokenOptions.Audiences
+	AccessTokenParam = "access_token" // Also return an access token when true
+)
+
+// IdentityTokenOptions configures the identity token endpoint
+type IdentityTokenOptions struct {
+	Audiences   []string // Audiences tokens may be requested for
+	AccessToken bool     // Whether access tokens may be requested too
+}
+
+// AccessToken is an OAuth 2.0 access token of the service account, as
+// returned by the metadata server
+type AccessToken struct {
+	AccessToken string `json:"access_token"`
+	ExpiresIn   int    `json:"expires_in"` // Seconds until the token expires
+	TokenType   string `json:"token_type"`
+}
+
+// IdentityTokenResponse is returned by IdentityTokenHandler
+type IdentityTokenResponse struct {
+	Audience      string         `json:"audience"`
+	IdentityToken string         `json:"identity_token"`
+	Claims        map[string]any `json:"claims,omitempty"` // Payload of the identity token, decoded without verifying it
+	AccessToken   *AccessToken   `json:"access_token,omitempty"`
+}
+
+// identityTokenURL returns the URL of an identity token for audience
+func identityTokenURL(audience string) string {
+	return IdentityTokenURL + "?" + url.Values{AudienceParam: {audience}}.Encode()
+}
+
+// decodeClaims returns the payload of a JWT without verifying its signature
+func decodeClaims(token string) (map[string]any, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, errors.New("not a JWT")
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return nil, fmt.Errorf("invalid JWT payload: %w", err)
+	}
+	var claims map[string]any
+	if err := json.Unmarshal(payload, &claims); err != nil {
+		return nil, fmt.Errorf("invalid JWT payload: %w", err)
+	}
+	return claims, nil
+}
+
+// IdentityTokenHandler serves an identity token of the service account for
+// an allowed audience, and optionally an access token, fetched from the
+// metadata server on each request; tokens are never cached or logged
+func IdentityTokenHandler(fetchMetadataFunc func(ctx context.Context, url string) (string, error), options IdentityTokenOptions) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+		audience := query.Get(AudienceParam)
+		if audience == "" {
+			httperr.Error(w, r, http.StatusBadRequest, "Invalid request: audience is required")
+			return
+		}
+		if !slices.Contains(options.Audiences, audience) {
+			observability.WarnWithFields(r.Context(), fmt.Sprintf("Identity token requested for audience %s, which is not allowed", audience), map[string]any{
+				"type":     "identity_token",
+				"audience": audience,
+			})
+			httperr.Error(w, r, http.StatusForbidden, "Audience not allowed")
+			return
+		}
+		withAccessToken := false
+		if query.Has(AccessTokenParam) {
+			var err error
+			if withAccessToken, err = strconv.ParseBool(query.Get(AccessTokenParam)); err != nil {
+				httperr.Error(w, r, http.StatusBadRequest, fmt.Sprintf("Invalid request: %s must be true or false", AccessTokenParam))
+				return
+			}
+		}
+		if withAccessToken && !options.AccessToken {
+			httperr.Error(w, r, http.StatusForbidden, "Access tokens are not enabled")
+			return
+		}
+
+		token, err := fetchMetadataFunc(r.Context(), identityTokenURL(audience))
+		if err != nil {
+			writeTokenError(w, r, "identity", err)
+			return
+		}
+		response := IdentityTokenResponse{Audience: audience, IdentityToken: strings.TrimSpace(token)}
+		if response.Claims, err = decodeClaims(response.IdentityToken); err != nil {
+			observability.WarnWithContext(r.Context(), fmt.Sprintf("Identity token claims could not be decoded: %v", err))
+		}
+
+		if withAccessToken {
+			body, err := fetchMetadataFunc(r.Context(), AccessTokenURL)
+			if err != nil {
+				writeTokenError(w, r, "access", err)
+				return
+			}
+			response.AccessToken = &AccessToken{}
+			if err := json.Unmarshal([]byte(body), response.AccessToken); err != nil {
+				writeTokenError(w, r, "access", fmt.Errorf("invalid access token response: %w", err))
+				return
+			}
+		}
+
+		fields := map[string]any{
+			"type":         "identity_token",
+			"audience":     audience,
+			"access_token": withAccessToken,
+		}
+		if subject, ok := response.Claims["sub"].(string); ok {
+			fields["subject"] = subject
+		}
+		observability.InfoWithFields(r.Context(), fmt.Sprintf("Issued identity token for audience %s", audience), fields)
+
+		var buf bytes.Buffer
+		if err := json.NewEncoder(&buf).Encode(response); err != nil {
+			httperr.Error(w, r, http.StatusInternalServerError, "Failed to encode response")
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		_, _ = w.Write(buf.Bytes())
+	}
+}
+
+// writeTokenError answers a failed token fetch, 404 when the metadata
+// provider issues no such tokens and 502 otherwise
+func writeTokenError(w http.ResponseWriter, r *http.Request, kind string, err error) {
+	if errors.Is(err, ErrUnsupported) {
+		httperr.Error(w, r, http.StatusNotFound, fmt.Sprintf("The metadata provider does not issue %s tokens", kind))
+		return
+	}
+	observability.ErrorWithFields(r.Context(), fmt.Sprintf("Failed to fetch %s token: %v", kind, err), map[string]any{
+		"type":  "identity_token",
+		"error": err.Error(),
+	})
+	httperr.Error(w, r, http.StatusBadGateway, fmt.Sprintf("Failed to fetch %s token", kind))
+}
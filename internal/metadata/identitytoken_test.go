@@ -0,0 +1,98 @@
+package metadata
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testIdentityToken is an unsigned JWT shaped like the tokens of the metadata server
+var testIdentityToken = "eyJhbGciOiJSUzI1NiJ9." +
+	base64.RawURLEncoding.EncodeToString([]byte(`{"aud":"https://istio-test.example.com","iss":"https://accounts.google.com","sub":"1234567890"}`)) +
+	".c2lnbmF0dXJl"
+
+var testIdentityTokenOptions = IdentityTokenOptions{Audiences: []string{"https://istio-test.example.com"}, AccessToken: true}
+
+// fetchTokens serves the token URLs like the GCE metadata server and records the URLs fetched
+func fetchTokens(fetched *[]string) func(ctx context.Context, url string) (string, error) {
+	return func(ctx context.Context, url string) (string, error) {
+		*fetched = append(*fetched, url)
+		switch url {
+		case identityTokenURL("https://istio-test.example.com"):
+			return testIdentityToken, nil
+		case AccessTokenURL:
+			return `{"access_token":"ya29.test","expires_in":3599,"token_type":"Bearer"}`, nil
+		}
+		return "", fmt.Errorf("unexpected URL %s", url)
+	}
+}
+
+func TestIdentityTokenHandler(t *testing.T) {
+	var fetched []string
+	handler := IdentityTokenHandler(fetchTokens(&fetched), testIdentityTokenOptions)
+
+	w := httptest.NewRecorder()
+	handler(w, httptest.NewRequest(http.MethodGet, "/istio-test/metadata/identity-token?audience=https%3A%2F%2Fistio-test.example.com", nil))
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.Equal(t, []string{IdentityTokenURL + "?audience=https%3A%2F%2Fistio-test.example.com"}, fetched)
+
+	var response IdentityTokenResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	assert.Equal(t, "https://istio-test.example.com", response.Audience)
+	assert.Equal(t, testIdentityToken, response.IdentityToken)
+	assert.Equal(t, "https://accounts.google.com", response.Claims["iss"])
+	assert.Nil(t, response.AccessToken)
+
+	w = httptest.NewRecorder()
+	handler(w, httptest.NewRequest(http.MethodGet, "/istio-test/metadata/identity-token?audience=https://istio-test.example.com&access_token=true", nil))
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	assert.Equal(t, &AccessToken{AccessToken: "ya29.test", ExpiresIn: 3599, TokenType: "Bearer"}, response.AccessToken)
+}
+
+func TestIdentityTokenHandlerRejects(t *testing.T) {
+	var fetched []string
+	handler := IdentityTokenHandler(fetchTokens(&fetched), IdentityTokenOptions{Audiences: testIdentityTokenOptions.Audiences})
+
+	for target, status := range map[string]int{
+		"/istio-test/metadata/identity-token":                                                            http.StatusBadRequest,
+		"/istio-test/metadata/identity-token?audience=https://attacker.example.com":                      http.StatusForbidden,
+		"/istio-test/metadata/identity-token?audience=https://istio-test.example.com&access_token=maybe": http.StatusBadRequest,
+		"/istio-test/metadata/identity-token?audience=https://istio-test.example.com&access_token=true":  http.StatusForbidden,
+	} {
+		w := httptest.NewRecorder()
+		handler(w, httptest.NewRequest(http.MethodGet, target, nil))
+		assert.Equal(t, status, w.Code, target)
+	}
+	assert.Empty(t, fetched, "nothing is fetched for rejected requests")
+}
+
+func TestIdentityTokenHandlerFetchErrors(t *testing.T) {
+	for err, status := range map[error]int{
+		fmt.Errorf("%w: no identity tokens", ErrUnsupported): http.StatusNotFound,
+		fmt.Errorf("metadata server unreachable"):            http.StatusBadGateway,
+	} {
+		handler := IdentityTokenHandler(func(ctx context.Context, url string) (string, error) { return "", err }, testIdentityTokenOptions)
+		w := httptest.NewRecorder()
+		handler(w, httptest.NewRequest(http.MethodGet, "/istio-test/metadata/identity-token?audience=https://istio-test.example.com", nil))
+		assert.Equal(t, status, w.Code, err.Error())
+	}
+}
+
+func TestDecodeClaims(t *testing.T) {
+	claims, err := decodeClaims(testIdentityToken)
+	require.NoError(t, err)
+	assert.Equal(t, "1234567890", claims["sub"])
+
+	for _, token := range []string{"", "a.b", "a.!!!.c", "a." + base64.RawURLEncoding.EncodeToString([]byte("[]")) + ".c"} {
+		_, err := decodeClaims(token)
+		assert.Error(t, err, token)
+	}
+}
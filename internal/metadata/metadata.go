@@ -4,123 +4,334 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
+	"sort"
+	"strconv"
 	"strings"
+	"sync"
 	"time"
 
+	"istio-test/internal/breaker"
+	"istio-test/internal/httpclient"
+	"istio-test/internal/httperr"
+	"istio-test/internal/httpretry"
 	"istio-test/internal/observability"
 	"istio-test/internal/security"
+	"istio-test/internal/version"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"golang.org/x/sync/singleflight"
 )
 
 const (
-	ClusterNameURL     = "http://metadata.google.internal/computeMetadata/v1/instance/attributes/cluster-name"
-	ClusterLocationURL = "http://metadata.google.internal/computeMetadata/v1/instance/attributes/cluster-location"
-	InstanceZoneURL    = "http://metadata.google.internal/computeMetadata/v1/instance/zone"
+	ClusterNameURL         = "http://metadata.google.internal/computeMetadata/v1/instance/attributes/cluster-name"
+	ClusterLocationURL     = "http://metadata.google.internal/computeMetadata/v1/instance/attributes/cluster-location"
+	InstanceZoneURL        = "http://metadata.google.internal/computeMetadata/v1/instance/zone"
+	ProjectIDURL           = "http://metadata.google.internal/computeMetadata/v1/project/project-id"
+	NumericProjectIDURL    = "http://metadata.google.internal/computeMetadata/v1/project/numeric-project-id"
+	InstanceIDURL          = "http://metadata.google.internal/computeMetadata/v1/instance/id"
+	MachineTypeURL         = "http://metadata.google.internal/computeMetadata/v1/instance/machine-type"
+	HostnameURL            = "http://metadata.google.internal/computeMetadata/v1/instance/hostname"
+	ServiceAccountEmailURL = "http://metadata.google.internal/computeMetadata/v1/instance/service-accounts/default/email"
 )
 
+// metadataURLs maps the supported metadata types to their metadata server URLs
+var metadataURLs = map[string]string{
+	"cluster-name":       ClusterNameURL,
+	"cluster-location":   ClusterLocationURL,
+	"instance-zone":      InstanceZoneURL,
+	"project-id":         ProjectIDURL,
+	"numeric-project-id": NumericProjectIDURL,
+	"instance-id":        InstanceIDURL,
+	"machine-type":       MachineTypeURL,
+	"hostname":           HostnameURL,
+	"service-account":    ServiceAccountEmailURL,
+}
+
+// resourcePathTypes are the metadata types returned as a resource path, such
+// as projects/123/zones/us-central1-a, of which only the last segment is served
+var resourcePathTypes = map[string]bool{
+	"instance-zone": true,
+	"machine-type":  true,
+}
+
+// URLFor returns the metadata server URL of a supported metadata type
+func URLFor(metadataType string) (string, bool) {
+	url, ok := metadataURLs[metadataType]
+	return url, ok
+}
+
+// FormatValue returns the value served for a metadata type, trimming resource
+// paths to their last segment
+func FormatValue(metadataType, value string) string {
+	if resourcePathTypes[metadataType] {
+		return value[strings.LastIndex(value, "/")+1:]
+	}
+	return value
+}
+
+// Types returns the supported metadata types in sorted order
+func Types() []string {
+	types := make([]string, 0, len(metadataURLs))
+	for t := range metadataURLs {
+		types = append(types, t)
+	}
+	sort.Strings(types)
+	return types
+}
+
 type MetadataFetcher interface {
 	FetchMetadata(ctx context.Context, url string) (string, error)
 }
 
+var sharedFetches = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Namespace: "istio_test",
+	Name:      "metadata_fetches_shared_total",
+	Help:      "Total number of metadata fetches served by an identical fetch already in flight, by metadata type.",
+}, []string{"type"})
+
+var fetchAttemptDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+	Namespace: "istio_test",
+	Name:      "metadata_fetch_attempt_duration_seconds",
+	Help:      "Duration of single metadata server requests, retries included, by metadata type, attempt and outcome (status class or error).",
+	Buckets:   prometheus.DefBuckets,
+}, []string{"type", "attempt", "outcome"})
+
+var rateLimitedAttempts = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Namespace: "istio_test",
+	Name:      "metadata_rate_limited_attempts_total",
+	Help:      "Total number of metadata server requests answered with 429 Too Many Requests, by metadata type.",
+}, []string{"type"})
+
+func init() {
+	observability.MetricsRegistry().MustRegister(sharedFetches, fetchAttemptDuration, rateLimitedAttempts)
+}
+
+// maxAttemptLabel caps the attempt label; later attempts are reported as "5+"
+const maxAttemptLabel = 5
+
+// observeAttempt records the duration of one metadata server request
+func observeAttempt(metadataType string, attempt httpretry.Attempt) {
+	label := strconv.Itoa(attempt.Number)
+	if attempt.Number >= maxAttemptLabel {
+		label = strconv.Itoa(maxAttemptLabel) + "+"
+	}
+	outcome := "error"
+	if attempt.Err == nil {
+		outcome = strconv.Itoa(attempt.StatusCode/100) + "xx"
+	}
+	fetchAttemptDuration.WithLabelValues(metadataType, label, outcome).Observe(attempt.Duration.Seconds())
+}
+
 // Client holds the HTTP client and configuration for metadata operations
 type Client struct {
-	httpClient      *http.Client
-	maxRetries      int
-	baseRetryDelay  time.Duration
-	maxRetryDelay   time.Duration
-	retryMultiplier float64
+	httpClient  *http.Client
+	retryPolicy httpretry.Policy
+	provider    Provider
+	inFlight    singleflight.Group
+	breaker     *breaker.Breaker
+}
+
+// newTracedHTTPClient returns an HTTP client whose requests get client spans
+func newTracedHTTPClient(timeout time.Duration) *http.Client {
+	return &http.Client{
+		Timeout:   timeout,
+		Transport: httpclient.TracingTransport(httpclient.ClientMetadata, http.DefaultTransport),
+	}
 }
 
 // NewClient creates a new metadata client with the given configuration
 func NewClient(httpTimeout time.Duration, maxRetries int, baseRetryDelay, maxRetryDelay time.Duration, retryMultiplier float64) *Client {
+	return NewClientWithPolicy(newTracedHTTPClient(httpTimeout), httpretry.Policy{
+		MaxAttempts: maxRetries,
+		BaseDelay:   baseRetryDelay,
+		MaxDelay:    maxRetryDelay,
+		Multiplier:  retryMultiplier,
+		Jitter:      httpretry.DefaultJitter,
+	})
+}
+
+// NewClientWithPolicy creates a new metadata client using the given HTTP client and retry policy
+func NewClientWithPolicy(httpClient *http.Client, policy httpretry.Policy) *Client {
+	return NewClientWithProvider(httpClient, policy, GCEProvider{})
+}
+
+// NewClientWithProvider creates a new metadata client reading the metadata
+// service of provider
+func NewClientWithProvider(httpClient *http.Client, policy httpretry.Policy, provider Provider) *Client {
+	policy.SpanName = "metadata.fetch"
+	// The metadata server rate limits per VM; its Retry-After beats our backoff
+	policy.HonorRetryAfter = true
 	return &Client{
-		httpClient:      &http.Client{Timeout: httpTimeout},
-		maxRetries:      maxRetries,
-		baseRetryDelay:  baseRetryDelay,
-		maxRetryDelay:   maxRetryDelay,
-		retryMultiplier: retryMultiplier,
+		httpClient:  httpClient,
+		retryPolicy: policy,
+		provider:    provider,
 	}
 }
 
+// Provider returns the metadata provider of the client
+func (c *Client) Provider() Provider {
+	return c.provider
+}
+
+// SetBreaker makes fetches go through b, so they fail fast while the metadata
+// server keeps failing; it must be called before the client is used
+func (c *Client) SetBreaker(b *breaker.Breaker) {
+	c.breaker = b
+}
+
+// statusError is returned when the metadata server responds with an
+// unexpected status
+type statusError struct {
+	code    int
+	message string
+}
+
+func (e *statusError) Error() string { return e.message }
+
+// serverFailure reports whether err shows the metadata server failing, as
+// opposed to a type it does not serve or a request it refused
+func serverFailure(err error) bool {
+	if err == nil || errors.Is(err, ErrUnsupported) {
+		return false
+	}
+	var se *statusError
+	if errors.As(err, &se) {
+		return se.code >= 500 || se.code == http.StatusTooManyRequests
+	}
+	return true
+}
+
 // Default client for backward compatibility
-var defaultClient = NewClient(10*time.Second, 3, 100*time.Millisecond, 2*time.Second, 2.0)
+var defaultClient = NewClientWithPolicy(newTracedHTTPClient(10*time.Second), httpretry.DefaultPolicy())
 
 // FetchMetadata fetches metadata using the default client (for backward compatibility)
 func FetchMetadata(ctx context.Context, url string) (string, error) {
 	return defaultClient.FetchMetadata(ctx, url)
 }
 
-// FetchMetadata fetches metadata from the given URL with retry logic
+// FetchMetadata fetches metadata from the given URL with retry logic.
+// Concurrent fetches of the same URL share one upstream request and its
+// retries; each caller still stops waiting when its own context is done.
 func (c *Client) FetchMetadata(ctx context.Context, url string) (string, error) {
-	var lastErr error
-	retryDelay := c.baseRetryDelay
-
-	for attempt := 0; attempt < c.maxRetries; attempt++ {
-		// Check if context is already cancelled
-		select {
-		case <-ctx.Done():
-			return "", fmt.Errorf("context cancelled: %w", ctx.Err())
-		default:
+	// The shared fetch must outlive any single caller, so it keeps the
+	// context values of the caller that started it but not its cancellation
+	fetchCtx := context.WithoutCancel(ctx)
+	result := c.inFlight.DoChan(url, func() (any, error) {
+		return c.guardedFetch(fetchCtx, url)
+	})
+
+	select {
+	case r := <-result:
+		if r.Shared {
+			sharedFetches.WithLabelValues(typeFor(url)).Inc()
 		}
-
-		req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
-		if err != nil {
-			return "", fmt.Errorf("error creating request: %w", err)
+		if r.Err != nil {
+			return "", r.Err
 		}
+		return r.Val.(string), nil
+	case <-ctx.Done():
+		return "", ctx.Err()
+	}
+}
 
-		req.Header.Add("Metadata-Flavor", "Google")
+// guardedFetch fetches through the circuit breaker, when one is set
+func (c *Client) guardedFetch(ctx context.Context, url string) (string, error) {
+	if c.breaker == nil {
+		return c.fetch(ctx, url)
+	}
+	generation, err := c.breaker.Allow(ctx)
+	if err != nil {
+		return "", fmt.Errorf("metadata server failing, not fetching %s: %w", url, err)
+	}
+	metadata, err := c.fetch(ctx, url)
+	c.breaker.Record(ctx, generation, serverFailure(err))
+	return metadata, err
+}
 
-		resp, err := c.httpClient.Do(req)
-		if err != nil {
-			lastErr = fmt.Errorf("error executing request: %w", err)
-			if attempt < c.maxRetries-1 {
-				observability.InfoWithContext(ctx, fmt.Sprintf("Metadata fetch attempt %d failed, retrying in %v: %v", attempt+1, retryDelay, err))
-				time.Sleep(retryDelay)
-				retryDelay = time.Duration(float64(retryDelay) * c.retryMultiplier)
-				if retryDelay > c.maxRetryDelay {
-					retryDelay = c.maxRetryDelay
-				}
-				continue
-			}
-			return "", fmt.Errorf("failed after %d attempts: %w", c.maxRetries, lastErr)
+// fetch fetches metadata from the given URL with retry logic
+func (c *Client) fetch(ctx context.Context, url string) (string, error) {
+	metadataType := typeFor(url)
+	policy := c.retryPolicy
+	rateLimited := 0
+	policy.OnAttempt = func(ctx context.Context, attempt httpretry.Attempt) {
+		observeAttempt(metadataType, attempt)
+		if attempt.StatusCode == http.StatusTooManyRequests {
+			rateLimited++
+			rateLimitedAttempts.WithLabelValues(metadataType).Inc()
 		}
-
-		if resp.StatusCode != http.StatusOK {
-			body, _ := io.ReadAll(resp.Body)
-			resp.Body.Close()
-			lastErr = fmt.Errorf("failed to get metadata from %s, status code: %d, response: %s", url, resp.StatusCode, string(body))
-
-			// Only retry on 5xx errors or 429 (rate limiting)
-			if (resp.StatusCode >= 500 && resp.StatusCode < 600) || resp.StatusCode == http.StatusTooManyRequests {
-				if attempt < c.maxRetries-1 {
-					observability.InfoWithContext(ctx, fmt.Sprintf("Metadata fetch attempt %d failed with status %d, retrying in %v", attempt+1, resp.StatusCode, retryDelay))
-					time.Sleep(retryDelay)
-					retryDelay = time.Duration(float64(retryDelay) * c.retryMultiplier)
-					if retryDelay > c.maxRetryDelay {
-						retryDelay = c.maxRetryDelay
-					}
-					continue
-				}
-			}
-			return "", fmt.Errorf("failed after %d attempts: %w", c.maxRetries, lastErr)
+	}
+	policy.OnRetry = func(ctx context.Context, attempt httpretry.Attempt) {
+		fields := map[string]any{
+			"type":          "metadata_fetch_retry",
+			"metadata_type": metadataType,
+			"url":           url,
+			"attempt":       attempt.Number,
+			"retry_in_ms":   observability.Milliseconds(attempt.Delay),
 		}
-
-		metadata, err := io.ReadAll(resp.Body)
-		resp.Body.Close()
-		if err != nil {
-			return "", fmt.Errorf("error reading response body: %w", err)
+		if attempt.Err != nil {
+			fields["error"] = attempt.Err.Error()
+			observability.InfoWithFields(ctx, fmt.Sprintf("Metadata fetch attempt %d failed, retrying in %v: %v", attempt.Number, attempt.Delay, attempt.Err), fields)
+			return
 		}
+		fields["status"] = attempt.StatusCode
+		if attempt.RetryAfter > 0 {
+			fields["retry_after_ms"] = observability.Milliseconds(attempt.RetryAfter)
+		}
+		observability.InfoWithFields(ctx, fmt.Sprintf("Metadata fetch attempt %d failed with status %d, retrying in %v", attempt.Number, attempt.StatusCode, attempt.Delay), fields)
+	}
 
-		// Success!
-		if attempt > 0 {
-			observability.InfoWithContext(ctx, fmt.Sprintf("Metadata fetch succeeded on attempt %d", attempt+1))
+	attempts := 0
+	start := time.Now()
+	resp, err := policy.Do(ctx, c.httpClient, func(ctx context.Context) (*http.Request, error) {
+		attempts++
+		return c.provider.NewRequest(ctx, url)
+	})
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		if tp, ok := c.provider.(tokenProvider); ok && resp.StatusCode == http.StatusUnauthorized {
+			// The session token was rejected, the next fetch requests a new one
+			tp.resetToken()
+		}
+		body, _ := io.ReadAll(resp.Body)
+		attemptsDesc := fmt.Sprintf("%d attempts", attempts)
+		if rateLimited > 0 {
+			attemptsDesc += fmt.Sprintf(" (%d rate limited)", rateLimited)
+		}
+		return "", &statusError{
+			code:    resp.StatusCode,
+			message: fmt.Sprintf("failed after %s: failed to get metadata from %s, status code: %d, response: %s", attemptsDesc, url, resp.StatusCode, string(body)),
 		}
-		return string(metadata), nil
 	}
 
-	return "", fmt.Errorf("failed after %d attempts: %w", c.maxRetries, lastErr)
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", fmt.Errorf("error reading response body: %w", err)
+	}
+	metadata, err := c.provider.Value(url, body)
+	if err != nil {
+		return "", err
+	}
+
+	// Success!
+	if attempts > 1 {
+		observability.InfoWithFields(ctx, fmt.Sprintf("Metadata fetch succeeded on attempt %d", attempts), map[string]any{
+			"type":          "metadata_fetch_recovered",
+			"metadata_type": metadataType,
+			"url":           url,
+			"attempts":      attempts,
+			"rate_limited":  rateLimited,
+			"duration_ms":   observability.Milliseconds(time.Since(start)),
+		})
+	}
+	return metadata, nil
 }
 
 // HealthStatus represents the overall health status
@@ -147,45 +358,51 @@ type HealthCheck struct {
 	Message     string       `json:"message,omitempty"`
 	Duration    string       `json:"duration"`
 	LastChecked time.Time    `json:"last_checked"`
+	Age         string       `json:"age,omitempty"` // Time since LastChecked when served from the background checker
 }
 
 var startTime = time.Now()
 
-// Build-time version variable (set via ldflags during build)
-var version = "dev"
-
-// getVersion returns the application version
-func getVersion() string {
-	return version
-}
-
 func HealthCheckHandler(w http.ResponseWriter, r *http.Request) {
 	// Set content type for health check
 	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
 	w.WriteHeader(http.StatusOK)
 	if _, err := w.Write([]byte("OK")); err != nil {
 		observability.ErrorWithContext(r.Context(), fmt.Sprintf("Error writing response: %v", err))
-		http.Error(w, "Failed to write response", http.StatusInternalServerError)
+		httperr.Error(w, r, http.StatusInternalServerError, "Failed to write response")
 	}
 }
 
-// EnhancedHealthCheckHandler provides comprehensive health checks including dependencies
-func EnhancedHealthCheckHandler(metadataClient *Client) http.HandlerFunc {
-	return func(w http.ResponseWriter, r *http.Request) {
+// DependencyCheck is an external dependency reported by the enhanced health check
+type DependencyCheck interface {
+	Name() string
+	Check(ctx context.Context) error
+}
+
+// EnhancedHealthCheckHandler provides comprehensive health checks including
+// dependencies, running the checks of the metadata service and of the
+// dependencies on every request
+func EnhancedHealthCheckHandler(metadataClient *Client, dependencies ...DependencyCheck) http.HandlerFunc {
+	registry := NewHealthRegistry(MetadataServiceCheck(metadataClient))
+	for _, dependency := range dependencies {
+		registry.RegisterDependency(dependency)
+	}
+	return registry.Handler()
+}
+
+// Handler runs every registered check on each request and reports the results
+func (r *HealthRegistry) Handler() http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
 		startCheck := time.Now()
 
 		health := HealthResponse{
 			Status:    HealthStatusHealthy,
 			Timestamp: time.Now().UTC(),
 			Uptime:    time.Since(startTime).String(),
-			Version:   getVersion(),
-			Checks:    make(map[string]HealthCheck),
+			Version:   version.Get().Version,
+			Checks:    r.CheckAll(req.Context()),
 		}
 
-		// Check metadata service connectivity
-		metadataCheck := checkMetadataService(r.Context(), metadataClient)
-		health.Checks["metadata_service"] = metadataCheck
-
 		// Check HTTP server responsiveness (implicit since we're responding)
 		health.Checks["http_server"] = HealthCheck{
 			Status:      HealthStatusHealthy,
@@ -200,8 +417,8 @@ func EnhancedHealthCheckHandler(metadataClient *Client) http.HandlerFunc {
 		// Marshal JSON response first to handle encoding errors before setting status
 		jsonData, err := json.Marshal(health)
 		if err != nil {
-			observability.ErrorWithContext(r.Context(), fmt.Sprintf("Error encoding health response: %v", err))
-			http.Error(w, "Failed to encode health response", http.StatusInternalServerError)
+			observability.ErrorWithContext(req.Context(), fmt.Sprintf("Error encoding health response: %v", err))
+			httperr.Error(w, req, http.StatusInternalServerError, "Failed to encode health response")
 			return
 		}
 
@@ -217,57 +434,16 @@ func EnhancedHealthCheckHandler(metadataClient *Client) http.HandlerFunc {
 
 		// Write the pre-encoded JSON data
 		if _, err := w.Write(jsonData); err != nil {
-			observability.ErrorWithContext(r.Context(), fmt.Sprintf("Error writing health response: %v", err))
+			observability.ErrorWithContext(req.Context(), fmt.Sprintf("Error writing health response: %v", err))
 		}
 
 		// Log health check result
-		observability.InfoWithContext(r.Context(), fmt.Sprintf("Health check completed: %s (took %v)", health.Status, time.Since(startCheck)))
-	}
-}
-
-// checkMetadataService tests connectivity to the GCP metadata service
-func checkMetadataService(ctx context.Context, metadataClient *Client) HealthCheck {
-	checkStart := time.Now()
-	checkCtx, cancel := context.WithTimeout(ctx, 3*time.Second)
-	defer cancel()
-
-	// Try to fetch cluster name as a connectivity test
-	_, err := metadataClient.FetchMetadata(checkCtx, ClusterNameURL)
-	duration := time.Since(checkStart)
-
-	if err != nil {
-		// Check if it's a timeout or other error
-		if checkCtx.Err() == context.DeadlineExceeded {
-			return HealthCheck{
-				Status:      HealthStatusUnhealthy,
-				Message:     "Metadata service timeout",
-				Duration:    duration.String(),
-				LastChecked: time.Now().UTC(),
-			}
-		}
-		return HealthCheck{
-			Status:      HealthStatusDegraded,
-			Message:     fmt.Sprintf("Metadata service error: %v", err),
-			Duration:    duration.String(),
-			LastChecked: time.Now().UTC(),
-		}
-	}
-
-	// Check response time
-	if duration > 1*time.Second {
-		return HealthCheck{
-			Status:      HealthStatusDegraded,
-			Message:     "Metadata service responding slowly",
-			Duration:    duration.String(),
-			LastChecked: time.Now().UTC(),
-		}
-	}
-
-	return HealthCheck{
-		Status:      HealthStatusHealthy,
-		Message:     "Metadata service is responsive",
-		Duration:    duration.String(),
-		LastChecked: time.Now().UTC(),
+		elapsed := time.Since(startCheck)
+		observability.InfoWithFields(req.Context(), fmt.Sprintf("Health check completed: %s (took %v)", health.Status, elapsed), map[string]any{
+			"type":        "health_check",
+			"status":      string(health.Status),
+			"duration_ms": observability.Milliseconds(elapsed),
+		})
 	}
 }
 
@@ -318,59 +494,74 @@ func SecureEnhancedHealthCheckHandler(metadataClient *Client) http.HandlerFunc {
 }
 
 // SecureEnhancedHealthCheckHandlerWithOptions returns an enhanced health check handler with configurable security headers and method validation
-func SecureEnhancedHealthCheckHandlerWithOptions(metadataClient *Client, options security.SecurityHeadersOptions) http.HandlerFunc {
-	return security.SecureHandlerWithOptions([]string{"GET", "HEAD"}, EnhancedHealthCheckHandler(metadataClient), options)
+func SecureEnhancedHealthCheckHandlerWithOptions(metadataClient *Client, options security.SecurityHeadersOptions, dependencies ...DependencyCheck) http.HandlerFunc {
+	return security.SecureHandlerWithOptions([]string{"GET", "HEAD"}, EnhancedHealthCheckHandler(metadataClient, dependencies...), options)
 }
 
 func MetadataHandler(fetchMetadataFunc func(ctx context.Context, url string) (string, error)) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		observability.InfoWithContext(r.Context(), fmt.Sprintf("Received request for %s", r.URL.Path))
+		observability.InfoWithFields(r.Context(), fmt.Sprintf("Received request for %s", r.URL.Path), map[string]any{
+			"type": "metadata_request",
+			"path": r.URL.Path,
+		})
 
 		cleanPath := strings.TrimSuffix(r.URL.Path, "/")
 		pathParts := strings.Split(cleanPath, "/")
+		if len(pathParts) == 3 {
+			// No type: every attribute at once
+			batchMetadata(w, r, fetchMetadataFunc)
+			return
+		}
 		if len(pathParts) != 4 {
-			observability.ErrorWithContext(r.Context(), fmt.Sprintf("Invalid request: %s", r.URL.Path))
-			http.Error(w, "Invalid request: expected /istio-test/metadata/{type}", http.StatusBadRequest)
+			observability.ErrorWithFields(r.Context(), fmt.Sprintf("Invalid request: %s", r.URL.Path), map[string]any{
+				"type": "metadata_request",
+				"path": r.URL.Path,
+			})
+			httperr.Error(w, r, http.StatusBadRequest, "Invalid request: expected /istio-test/metadata/{type}")
 			return
 		}
 
 		metadataType := pathParts[3]
-		var url string
-
-		switch metadataType {
-		case "cluster-name":
-			url = ClusterNameURL
-		case "cluster-location":
-			url = ClusterLocationURL
-		case "instance-zone":
-			url = InstanceZoneURL
-		default:
-			observability.ErrorWithContext(r.Context(), fmt.Sprintf("Unknown metadata type: %s", metadataType))
-			http.Error(w, "Unknown metadata type", http.StatusBadRequest)
+		url, ok := metadataURLs[metadataType]
+		if !ok {
+			observability.ErrorWithFields(r.Context(), fmt.Sprintf("Unknown metadata type: %s", metadataType), map[string]any{
+				"type":          "metadata_request",
+				"metadata_type": metadataType,
+			})
+			httperr.Error(w, r, http.StatusBadRequest, "Unknown metadata type")
 			return
 		}
 
-		metadata, err := fetchMetadataFunc(r.Context(), url)
-		if err != nil {
-			observability.ErrorWithContext(r.Context(), fmt.Sprintf("Failed to fetch metadata: %v", err))
-			http.Error(w, "Failed to fetch metadata", http.StatusBadGateway)
+		ctx := r.Context()
+		if bypass, _ := strconv.ParseBool(r.URL.Query().Get(CacheBypassParam)); bypass {
+			ctx = WithCacheBypass(ctx)
+		}
+
+		metadata, err := fetchMetadataFunc(ctx, url)
+		if errors.Is(err, ErrUnsupported) {
+			observability.InfoWithFields(r.Context(), fmt.Sprintf("Metadata type %s not available: %v", metadataType, err), map[string]any{
+				"type":          "metadata_request",
+				"metadata_type": metadataType,
+				"error":         err.Error(),
+			})
+			httperr.Error(w, r, http.StatusNotFound, "Metadata type not available from this metadata provider")
 			return
 		}
-		if metadataType == "instance-zone" {
-			instanceZoneParts := strings.Split(metadata, "/")
-			if len(instanceZoneParts) > 0 {
-				metadata = instanceZoneParts[len(instanceZoneParts)-1]
-			} else {
-				observability.ErrorWithContext(r.Context(), fmt.Sprintf("Unexpected format for instance-zone metadata: %s", metadata))
-				http.Error(w, "Unexpected format for instance-zone metadata", http.StatusInternalServerError)
-				return
-			}
+		if err != nil {
+			observability.ErrorWithFields(r.Context(), fmt.Sprintf("Failed to fetch metadata: %v", err), map[string]any{
+				"type":          "metadata_request",
+				"metadata_type": metadataType,
+				"url":           url,
+				"error":         err.Error(),
+			})
+			httperr.Error(w, r, http.StatusBadGateway, "Failed to fetch metadata")
+			return
 		}
 
-		response := map[string]string{metadataType: metadata}
+		response := map[string]string{metadataType: FormatValue(metadataType, metadata)}
 		var buf bytes.Buffer
 		if err := json.NewEncoder(&buf).Encode(response); err != nil {
-			http.Error(w, "Failed to encode response", http.StatusInternalServerError)
+			httperr.Error(w, r, http.StatusInternalServerError, "Failed to encode response")
 			return
 		}
 		w.Header().Set("Content-Type", "application/json")
@@ -379,8 +570,92 @@ func MetadataHandler(fetchMetadataFunc func(ctx context.Context, url string) (st
 	}
 }
 
+// TypesParam selects the metadata types returned by the batch endpoint, comma-separated
+const TypesParam = "types"
+
+// BatchResponse is the response of the batch metadata endpoint. Values are
+// keyed by metadata type; types that could not be fetched are reported in
+// Errors instead, so one failing attribute does not fail the others.
+type BatchResponse struct {
+	Metadata map[string]string `json:"metadata"`
+	Errors   map[string]string `json:"errors,omitempty"`
+}
+
+// BatchMetadataHandler fetches every supported metadata type, or those listed
+// in the types parameter, concurrently and returns them in one document. It
+// responds 502 only when no type could be fetched.
+func BatchMetadataHandler(fetchMetadataFunc func(ctx context.Context, url string) (string, error)) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		batchMetadata(w, r, fetchMetadataFunc)
+	}
+}
+
+// batchMetadata serves the batch metadata endpoint
+func batchMetadata(w http.ResponseWriter, r *http.Request, fetchMetadataFunc func(ctx context.Context, url string) (string, error)) {
+	types := Types()
+	if value := r.URL.Query().Get(TypesParam); value != "" {
+		types = strings.Split(value, ",")
+		for _, metadataType := range types {
+			if _, ok := metadataURLs[metadataType]; !ok {
+				httperr.Error(w, r, http.StatusBadRequest, fmt.Sprintf("Unknown metadata type: %s", metadataType))
+				return
+			}
+		}
+	}
+
+	ctx := r.Context()
+	if bypass, _ := strconv.ParseBool(r.URL.Query().Get(CacheBypassParam)); bypass {
+		ctx = WithCacheBypass(ctx)
+	}
+
+	response := BatchResponse{Metadata: make(map[string]string, len(types))}
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for _, metadataType := range types {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			value, err := fetchMetadataFunc(ctx, metadataURLs[metadataType])
+
+			mu.Lock()
+			defer mu.Unlock()
+			switch {
+			case errors.Is(err, ErrUnsupported):
+				err = errors.New("not available from this metadata provider")
+			case err != nil:
+				observability.WarnWithFields(r.Context(), fmt.Sprintf("Failed to fetch metadata %s: %v", metadataType, err), map[string]any{
+					"type":          "metadata_request",
+					"metadata_type": metadataType,
+					"error":         err.Error(),
+				})
+			default:
+				response.Metadata[metadataType] = FormatValue(metadataType, value)
+				return
+			}
+			if response.Errors == nil {
+				response.Errors = make(map[string]string)
+			}
+			response.Errors[metadataType] = err.Error()
+		}()
+	}
+	wg.Wait()
+
+	status := http.StatusOK
+	if len(response.Metadata) == 0 {
+		status = http.StatusBadGateway
+	}
+	var buf bytes.Buffer
+	if err := json.NewEncoder(&buf).Encode(response); err != nil {
+		httperr.Error(w, r, http.StatusInternalServerError, "Failed to encode response")
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_, _ = w.Write(buf.Bytes())
+}
+
 func NotFoundHandler(w http.ResponseWriter, r *http.Request) {
-	http.Error(w, "Not Found", http.StatusNotFound)
+	httperr.Error(w, r, http.StatusNotFound, "No route matches the request path")
 }
 
 // SecureMetadataHandler returns a metadata handler with security headers and method validation
@@ -8,9 +8,16 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"os"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
+	"istio-test/internal/breaker"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	dto "github.com/prometheus/client_model/go"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -24,6 +31,18 @@ func (m *MockFetchMetadata) FetchMetadata(ctx context.Context, url string) (stri
 		return "test-cluster-location", nil
 	case InstanceZoneURL:
 		return "projects/1234567890/zones/us-central1-a", nil
+	case ProjectIDURL:
+		return "test-project", nil
+	case NumericProjectIDURL:
+		return "1234567890", nil
+	case InstanceIDURL:
+		return "4520031799277581759", nil
+	case MachineTypeURL:
+		return "projects/1234567890/machineTypes/e2-standard-4", nil
+	case HostnameURL:
+		return "gke-test-pool-1234.us-central1-a.c.test-project.internal", nil
+	case ServiceAccountEmailURL:
+		return "test-sa@test-project.iam.gserviceaccount.com", nil
 	default:
 		return "", fmt.Errorf("unknown URL: %s", url)
 	}
@@ -52,7 +71,13 @@ func TestMain(t *testing.T) {
 		{ts.URL + "/istio-test/metadata/cluster-name", http.StatusOK, `{"cluster-name":"test-cluster-name"}`, true},
 		{ts.URL + "/istio-test/metadata/cluster-location", http.StatusOK, `{"cluster-location":"test-cluster-location"}`, true},
 		{ts.URL + "/istio-test/metadata/instance-zone", http.StatusOK, `{"instance-zone":"us-central1-a"}`, true},
-		{ts.URL + "/istio-test/metadata/unknown", http.StatusBadRequest, "Unknown metadata type\n", false},
+		{ts.URL + "/istio-test/metadata/project-id", http.StatusOK, `{"project-id":"test-project"}`, true},
+		{ts.URL + "/istio-test/metadata/numeric-project-id", http.StatusOK, `{"numeric-project-id":"1234567890"}`, true},
+		{ts.URL + "/istio-test/metadata/instance-id", http.StatusOK, `{"instance-id":"4520031799277581759"}`, true},
+		{ts.URL + "/istio-test/metadata/machine-type", http.StatusOK, `{"machine-type":"e2-standard-4"}`, true},
+		{ts.URL + "/istio-test/metadata/hostname", http.StatusOK, `{"hostname":"gke-test-pool-1234.us-central1-a.c.test-project.internal"}`, true},
+		{ts.URL + "/istio-test/metadata/service-account", http.StatusOK, `{"service-account":"test-sa@test-project.iam.gserviceaccount.com"}`, true},
+		{ts.URL + "/istio-test/metadata/unknown", http.StatusBadRequest, `{"type":"about:blank","title":"Bad Request","status":400,"detail":"Unknown metadata type","instance":"/istio-test/metadata/unknown"}`, true},
 	}
 
 	// Run the test cases
@@ -73,6 +98,60 @@ func TestMain(t *testing.T) {
 	}
 }
 
+func TestBatchMetadataHandler(t *testing.T) {
+	var calls atomic.Int32
+	fetch := func(ctx context.Context, url string) (string, error) {
+		calls.Add(1)
+		switch url {
+		case HostnameURL:
+			return "", fmt.Errorf("metadata server unreachable")
+		case ServiceAccountEmailURL:
+			return "", fmt.Errorf("%w: no service account", ErrUnsupported)
+		}
+		return (&MockFetchMetadata{}).FetchMetadata(ctx, url)
+	}
+
+	t.Run("all types with per-field errors", func(t *testing.T) {
+		calls.Store(0)
+		w := httptest.NewRecorder()
+		BatchMetadataHandler(fetch)(w, httptest.NewRequest("GET", "/istio-test/metadata", nil))
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, int32(len(Types())), calls.Load())
+		var response BatchResponse
+		assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+		assert.Equal(t, "test-cluster-name", response.Metadata["cluster-name"])
+		assert.Equal(t, "test-cluster-location", response.Metadata["cluster-location"])
+		assert.Equal(t, "us-central1-a", response.Metadata["instance-zone"])
+		assert.Len(t, response.Metadata, len(Types())-2)
+		assert.Equal(t, map[string]string{
+			"hostname":        "metadata server unreachable",
+			"service-account": "not available from this metadata provider",
+		}, response.Errors)
+	})
+
+	t.Run("selected types through the type handler", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		MetadataHandler(fetch)(w, httptest.NewRequest("GET", "/istio-test/metadata/?types=cluster-name,instance-zone", nil))
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.JSONEq(t, `{"metadata": {"cluster-name": "test-cluster-name", "instance-zone": "us-central1-a"}}`, w.Body.String())
+	})
+
+	t.Run("unknown type", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		BatchMetadataHandler(fetch)(w, httptest.NewRequest("GET", "/istio-test/metadata?types=cluster-name,bogus", nil))
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+	})
+
+	t.Run("every type failing", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		BatchMetadataHandler(fetch)(w, httptest.NewRequest("GET", "/istio-test/metadata?types=hostname", nil))
+		assert.Equal(t, http.StatusBadGateway, w.Code)
+		assert.JSONEq(t, `{"metadata": {}, "errors": {"hostname": "metadata server unreachable"}}`, w.Body.String())
+	})
+}
+
 func TestHealthCheckHandler(t *testing.T) {
 	req := httptest.NewRequest("GET", "/health", nil)
 	w := httptest.NewRecorder()
@@ -118,30 +197,33 @@ func TestEnhancedHealthCheckHandler(t *testing.T) {
 		assert.Equal(t, HealthStatusHealthy, healthResp.Checks["http_server"].Status)
 		assert.Contains(t, healthResp.Checks["http_server"].Message, "responding")
 	})
-}
 
-func TestGetVersion(t *testing.T) {
-	t.Run("default version", func(t *testing.T) {
-		// Reset version to default for testing
-		originalVersion := version
-		version = "dev"
-		defer func() { version = originalVersion }()
-
-		result := getVersion()
-		assert.Equal(t, "dev", result)
-	})
+	t.Run("dependency checks", func(t *testing.T) {
+		mockClient := NewClient(1*time.Second, 1, 50*time.Millisecond, 500*time.Millisecond, 2.0)
 
-	t.Run("custom version", func(t *testing.T) {
-		// Set a custom version
-		originalVersion := version
-		version = "v1.2.3"
-		defer func() { version = originalVersion }()
+		w := httptest.NewRecorder()
+		EnhancedHealthCheckHandler(mockClient,
+			dependencyFunc{name: "database"},
+			dependencyFunc{name: "queue", err: fmt.Errorf("connection refused")},
+		)(w, httptest.NewRequest("GET", "/health", nil))
 
-		result := getVersion()
-		assert.Equal(t, "v1.2.3", result)
+		var healthResp HealthResponse
+		assert.NoError(t, json.NewDecoder(w.Body).Decode(&healthResp))
+		assert.Equal(t, HealthStatusHealthy, healthResp.Checks["database"].Status)
+		assert.Equal(t, HealthStatusDegraded, healthResp.Checks["queue"].Status)
+		assert.Contains(t, healthResp.Checks["queue"].Message, "connection refused")
 	})
 }
 
+// dependencyFunc is a DependencyCheck returning a fixed error
+type dependencyFunc struct {
+	name string
+	err  error
+}
+
+func (d dependencyFunc) Name() string                    { return d.name }
+func (d dependencyFunc) Check(ctx context.Context) error { return d.err }
+
 func TestDetermineOverallHealth(t *testing.T) {
 	tests := []struct {
 		name     string
@@ -190,3 +272,180 @@ func TestDetermineOverallHealth(t *testing.T) {
 		})
 	}
 }
+
+func TestURLFor(t *testing.T) {
+	url, ok := URLFor("instance-zone")
+	assert.True(t, ok)
+	assert.Equal(t, InstanceZoneURL, url)
+
+	_, ok = URLFor("unknown")
+	assert.False(t, ok)
+}
+
+func TestTypes(t *testing.T) {
+	assert.Equal(t, []string{
+		"cluster-location", "cluster-name", "hostname", "instance-id", "instance-zone",
+		"machine-type", "numeric-project-id", "project-id", "service-account",
+	}, Types())
+}
+
+func TestFormatValue(t *testing.T) {
+	assert.Equal(t, "us-central1-a", FormatValue("instance-zone", "projects/1234567890/zones/us-central1-a"))
+	assert.Equal(t, "e2-standard-4", FormatValue("machine-type", "projects/1234567890/machineTypes/e2-standard-4"))
+	assert.Equal(t, "us-central1-a", FormatValue("instance-zone", "us-central1-a"))
+	assert.Equal(t, "test-sa@test-project.iam.gserviceaccount.com", FormatValue("service-account", "test-sa@test-project.iam.gserviceaccount.com"))
+}
+
+func TestFetchMetadataSharesConcurrentFetches(t *testing.T) {
+	var requests atomic.Int32
+	release := make(chan struct{})
+	client := newTestMetadataClient(t, func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		<-release
+		w.Write([]byte("test-cluster"))
+	})
+
+	const callers = 5
+	var wg sync.WaitGroup
+	values := make([]string, callers)
+	for i := range callers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			value, err := client.FetchMetadata(context.Background(), ClusterNameURL)
+			assert.NoError(t, err)
+			values[i] = value
+		}()
+	}
+
+	// Let every caller join the in-flight fetch before it completes
+	assert.Eventually(t, func() bool { return requests.Load() == 1 }, time.Second, time.Millisecond)
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	assert.Equal(t, int32(1), requests.Load())
+	for _, value := range values {
+		assert.Equal(t, "test-cluster", value)
+	}
+}
+
+func TestFetchMetadataCircuitBreaker(t *testing.T) {
+	var requests atomic.Int32
+	var status atomic.Int32
+	status.Store(http.StatusServiceUnavailable)
+	client := newTestMetadataClient(t, func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		w.WriteHeader(int(status.Load()))
+		w.Write([]byte("test-cluster"))
+	})
+	client.retryPolicy.MaxAttempts = 1
+	cb := breaker.New("metadata-test", breaker.Options{FailureThreshold: 2, ResetTimeout: 50 * time.Millisecond})
+	client.SetBreaker(cb)
+
+	// Types the server does not have are not failures of the server
+	status.Store(http.StatusNotFound)
+	for range 3 {
+		_, err := client.FetchMetadata(context.Background(), ClusterNameURL)
+		assert.Error(t, err)
+	}
+	assert.Equal(t, breaker.StateClosed, cb.Status().State)
+
+	status.Store(http.StatusServiceUnavailable)
+	for range 2 {
+		_, err := client.FetchMetadata(context.Background(), ClusterNameURL)
+		assert.Error(t, err)
+	}
+	assert.Equal(t, breaker.StateOpen, cb.Status().State)
+
+	_, err := client.FetchMetadata(context.Background(), ClusterNameURL)
+	assert.ErrorIs(t, err, breaker.ErrOpen)
+	assert.Equal(t, int32(5), requests.Load(), "fetches fail fast while the breaker is open")
+
+	status.Store(http.StatusOK)
+	assert.Eventually(t, func() bool {
+		value, err := client.FetchMetadata(context.Background(), ClusterNameURL)
+		return err == nil && value == "test-cluster"
+	}, time.Second, 10*time.Millisecond)
+	assert.Equal(t, breaker.StateClosed, cb.Status().State)
+}
+
+func TestFetchMetadataCallerCancellation(t *testing.T) {
+	release := make(chan struct{})
+	client := newTestMetadataClient(t, func(w http.ResponseWriter, r *http.Request) {
+		<-release
+		w.Write([]byte("test-cluster"))
+	})
+
+	result := make(chan string)
+	go func() {
+		value, _ := client.FetchMetadata(context.Background(), ClusterNameURL)
+		result <- value
+	}()
+
+	// A caller giving up does not cancel the fetch shared with others
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	_, err := client.FetchMetadata(ctx, ClusterNameURL)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+
+	close(release)
+	assert.Equal(t, "test-cluster", <-result)
+}
+
+func TestFetchMetadataRecordsAttempts(t *testing.T) {
+	var requests atomic.Int32
+	client := newTestMetadataClient(t, func(w http.ResponseWriter, r *http.Request) {
+		if requests.Add(1) == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte("us-central1-a"))
+	})
+
+	failed := fetchAttemptDuration.WithLabelValues("instance-zone", "1", "5xx")
+	succeeded := fetchAttemptDuration.WithLabelValues("instance-zone", "2", "2xx")
+
+	_, err := client.FetchMetadata(context.Background(), InstanceZoneURL)
+	assert.NoError(t, err)
+
+	assert.Equal(t, uint64(1), histogramCount(t, failed))
+	assert.Equal(t, uint64(1), histogramCount(t, succeeded))
+}
+
+func TestFetchMetadataRateLimited(t *testing.T) {
+	var requests atomic.Int32
+	client := newTestMetadataClient(t, func(w http.ResponseWriter, r *http.Request) {
+		if requests.Add(1) == 1 {
+			w.Header().Set("Retry-After", "0")
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+		w.Write([]byte("my-project"))
+	})
+
+	rateLimited := testutil.ToFloat64(rateLimitedAttempts.WithLabelValues("project-id"))
+	value, err := client.FetchMetadata(context.Background(), ProjectIDURL)
+	assert.NoError(t, err)
+	assert.Equal(t, "my-project", value)
+	assert.Equal(t, rateLimited+1, testutil.ToFloat64(rateLimitedAttempts.WithLabelValues("project-id")))
+}
+
+// histogramCount returns the number of observations of a histogram
+func histogramCount(t *testing.T, observer prometheus.Observer) uint64 {
+	t.Helper()
+	var metric dto.Metric
+	assert.NoError(t, observer.(prometheus.Metric).Write(&metric))
+	return metric.GetHistogram().GetSampleCount()
+}
+
+func TestNotFoundHandler(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "/nowhere", nil)
+	req.Header.Set("X-Request-ID", "abc-123")
+	w := httptest.NewRecorder()
+	NotFoundHandler(w, req)
+
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	assert.Equal(t, "application/problem+json", w.Header().Get("Content-Type"))
+	assert.JSONEq(t, `{"type":"about:blank","title":"Not Found","status":404,"detail":"No route matches the request path","instance":"/nowhere","request_id":"abc-123"}`, w.Body.String())
+}
@@ -0,0 +1,308 @@
+package metadata
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Supported metadata providers
+const (
+	ProviderGCE   = "gce"
+	ProviderAWS   = "aws"
+	ProviderAzure = "azure"
+)
+
+// ProviderNames lists the supported metadata providers
+var ProviderNames = []string{ProviderGCE, ProviderAWS, ProviderAzure}
+
+// ErrUnsupported is returned for metadata types a provider does not serve
+var ErrUnsupported = errors.New("metadata type not supported by provider")
+
+// Provider adapts a cloud's instance metadata service. Metadata types keep
+// being identified by their GCE metadata server URLs, which providers for
+// other clouds translate to their own requests.
+type Provider interface {
+	// Name returns the provider name, one of ProviderNames
+	Name() string
+	// NewRequest builds the request fetching the metadata type of url
+	NewRequest(ctx context.Context, url string) (*http.Request, error)
+	// Value extracts the metadata value from a successful response body
+	Value(url string, body []byte) (string, error)
+}
+
+// tokenProvider is implemented by providers authenticating with a session
+// token, which is dropped when the metadata service rejects it
+type tokenProvider interface {
+	resetToken()
+}
+
+// NewProvider returns the named provider; httpClient is used by providers
+// that need requests of their own, such as the AWS session token
+func NewProvider(name string, httpClient *http.Client) (Provider, error) {
+	switch name {
+	case ProviderGCE, "":
+		return GCEProvider{}, nil
+	case ProviderAWS:
+		return &AWSProvider{HTTPClient: httpClient}, nil
+	case ProviderAzure:
+		return AzureProvider{}, nil
+	default:
+		return nil, fmt.Errorf("unknown metadata provider %q", name)
+	}
+}
+
+// probeURL returns the metadata type used to test connectivity with p
+func probeURL(p Provider) string {
+	if p.Name() == ProviderGCE {
+		return ClusterNameURL
+	}
+	// Only GKE nodes are guaranteed to know their cluster
+	return InstanceIDURL
+}
+
+// GCEProvider reads the GCE metadata server, and fetches any URL as it is
+type GCEProvider struct{}
+
+// Name returns ProviderGCE
+func (GCEProvider) Name() string { return ProviderGCE }
+
+// NewRequest builds a GET of url with the Metadata-Flavor header
+func (GCEProvider) NewRequest(ctx context.Context, url string) (*http.Request, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Add("Metadata-Flavor", "Google")
+	return req, nil
+}
+
+// Value returns body unchanged
+func (GCEProvider) Value(url string, body []byte) (string, error) {
+	return string(body), nil
+}
+
+// DefaultIMDSEndpoint is the link-local address of the AWS and Azure
+// instance metadata services
+const DefaultIMDSEndpoint = "http://169.254.169.254"
+
+// awsIdentityDocument is the path of the instance identity document
+const awsIdentityDocument = "/latest/dynamic/instance-identity/document"
+
+// awsPaths maps metadata types to IMDS paths
+var awsPaths = map[string]string{
+	"cluster-name":       "/latest/meta-data/tags/instance/eks:cluster-name", // Requires instance metadata tags
+	"cluster-location":   "/latest/meta-data/placement/region",
+	"instance-zone":      "/latest/meta-data/placement/availability-zone",
+	"project-id":         awsIdentityDocument,
+	"numeric-project-id": awsIdentityDocument,
+	"instance-id":        "/latest/meta-data/instance-id",
+	"machine-type":       "/latest/meta-data/instance-type",
+	"hostname":           "/latest/meta-data/local-hostname",
+	"service-account":    "/latest/meta-data/iam/security-credentials/",
+}
+
+// AWSProvider reads the EC2 instance metadata service with IMDSv2 session
+// tokens. The token is requested once and reused until shortly before it
+// expires; a failed token request fails the fetch without retries.
+type AWSProvider struct {
+	Endpoint   string        // Defaults to DefaultIMDSEndpoint
+	HTTPClient *http.Client  // Requests session tokens, defaults to http.DefaultClient
+	TokenTTL   time.Duration // Lifetime requested for session tokens, defaults to 6h
+
+	mu      sync.Mutex
+	token   string
+	expires time.Time
+}
+
+// Name returns ProviderAWS
+func (p *AWSProvider) Name() string { return ProviderAWS }
+
+func (p *AWSProvider) endpoint() string {
+	if p.Endpoint != "" {
+		return p.Endpoint
+	}
+	return DefaultIMDSEndpoint
+}
+
+// sessionToken returns the cached session token, requesting a new one when
+// there is none or it is about to expire
+func (p *AWSProvider) sessionToken(ctx context.Context) (string, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.token != "" && time.Now().Before(p.expires) {
+		return p.token, nil
+	}
+
+	ttl := p.TokenTTL
+	if ttl <= 0 {
+		ttl = 6 * time.Hour
+	}
+	req, err := http.NewRequestWithContext(ctx, "PUT", p.endpoint()+"/latest/api/token", nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("X-aws-ec2-metadata-token-ttl-seconds", strconv.Itoa(int(ttl.Seconds())))
+
+	client := p.HTTPClient
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("failed to get IMDSv2 token: %w", err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", fmt.Errorf("failed to read IMDSv2 token: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("failed to get IMDSv2 token, status code: %d", resp.StatusCode)
+	}
+
+	p.token = strings.TrimSpace(string(body))
+	// Renew ahead of expiry so a token never runs out mid-fetch
+	p.expires = time.Now().Add(ttl * 9 / 10)
+	return p.token, nil
+}
+
+func (p *AWSProvider) resetToken() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.token = ""
+}
+
+// NewRequest builds a GET of the IMDS path of url carrying a session token
+func (p *AWSProvider) NewRequest(ctx context.Context, url string) (*http.Request, error) {
+	path, ok := awsPaths[typeFor(url)]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnsupported, url)
+	}
+	token, err := p.sessionToken(ctx)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, "GET", p.endpoint()+path, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("X-aws-ec2-metadata-token", token)
+	return req, nil
+}
+
+// Value reads the account from the identity document and the first role
+// from the security credentials listing
+func (p *AWSProvider) Value(url string, body []byte) (string, error) {
+	switch typeFor(url) {
+	case "project-id", "numeric-project-id":
+		var document struct {
+			AccountID string `json:"accountId"`
+		}
+		if err := json.Unmarshal(body, &document); err != nil {
+			return "", fmt.Errorf("invalid instance identity document: %w", err)
+		}
+		return document.AccountID, nil
+	case "service-account":
+		role, _, _ := strings.Cut(strings.TrimSpace(string(body)), "\n")
+		if role == "" {
+			return "", fmt.Errorf("%w: no instance profile role", ErrUnsupported)
+		}
+		return role, nil
+	}
+	return string(body), nil
+}
+
+// azureComputePath is the path of the Azure IMDS compute document, which
+// holds every supported value
+const azureComputePath = "/metadata/instance/compute?api-version=2021-02-01"
+
+// azureCompute is the part of the Azure compute document served as metadata
+type azureCompute struct {
+	Location       string `json:"location"`
+	Zone           string `json:"zone"`
+	Name           string `json:"name"`
+	SubscriptionID string `json:"subscriptionId"`
+	VMID           string `json:"vmId"`
+	VMSize         string `json:"vmSize"`
+	OSProfile      struct {
+		ComputerName string `json:"computerName"`
+	} `json:"osProfile"`
+	TagsList []struct {
+		Name  string `json:"name"`
+		Value string `json:"value"`
+	} `json:"tagsList"`
+}
+
+// AzureProvider reads the Azure instance metadata service. Managed identities
+// and numeric project IDs have no Azure equivalent and are unsupported.
+type AzureProvider struct {
+	Endpoint string // Defaults to DefaultIMDSEndpoint
+}
+
+// Name returns ProviderAzure
+func (AzureProvider) Name() string { return ProviderAzure }
+
+// NewRequest builds a GET of the compute document with the Metadata header
+func (p AzureProvider) NewRequest(ctx context.Context, url string) (*http.Request, error) {
+	switch typeFor(url) {
+	case "numeric-project-id", "service-account", "other":
+		return nil, fmt.Errorf("%w: %s", ErrUnsupported, url)
+	}
+	endpoint := p.Endpoint
+	if endpoint == "" {
+		endpoint = DefaultIMDSEndpoint
+	}
+	req, err := http.NewRequestWithContext(ctx, "GET", endpoint+azureComputePath, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Metadata", "true")
+	return req, nil
+}
+
+// Value picks the value of the metadata type of url from the compute document.
+// Zones are served as location-zone, like eastus-1, or as the location for
+// VMs outside availability zones.
+func (AzureProvider) Value(url string, body []byte) (string, error) {
+	var compute azureCompute
+	if err := json.Unmarshal(body, &compute); err != nil {
+		return "", fmt.Errorf("invalid compute metadata: %w", err)
+	}
+
+	switch typeFor(url) {
+	case "cluster-name":
+		for _, tag := range compute.TagsList {
+			if tag.Name == "aks-managed-cluster-name" {
+				return tag.Value, nil
+			}
+		}
+		return "", fmt.Errorf("%w: VM has no aks-managed-cluster-name tag", ErrUnsupported)
+	case "cluster-location":
+		return compute.Location, nil
+	case "instance-zone":
+		if compute.Zone == "" {
+			return compute.Location, nil
+		}
+		return compute.Location + "-" + compute.Zone, nil
+	case "project-id":
+		return compute.SubscriptionID, nil
+	case "instance-id":
+		return compute.VMID, nil
+	case "machine-type":
+		return compute.VMSize, nil
+	case "hostname":
+		if compute.OSProfile.ComputerName != "" {
+			return compute.OSProfile.ComputerName, nil
+		}
+		return compute.Name, nil
+	}
+	return "", fmt.Errorf("%w: %s", ErrUnsupported, url)
+}
@@ -0,0 +1,152 @@
+package metadata
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"istio-test/internal/httpretry"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeIMDSv2 emulates the EC2 metadata service, rejecting requests without a
+// valid session token
+func fakeIMDSv2(t *testing.T, token *atomic.Value, tokenRequests *atomic.Int32) *httptest.Server {
+	values := map[string]string{
+		"/latest/meta-data/placement/availability-zone":    "us-east-1a",
+		"/latest/meta-data/placement/region":               "us-east-1",
+		"/latest/meta-data/instance-id":                    "i-0123456789abcdef0",
+		"/latest/meta-data/instance-type":                  "m5.large",
+		"/latest/meta-data/iam/security-credentials/":      "eks-node-role\n",
+		"/latest/dynamic/instance-identity/document":       `{"accountId":"123456789012","region":"us-east-1"}`,
+		"/latest/meta-data/tags/instance/eks:cluster-name": "test-cluster",
+	}
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/latest/api/token" {
+			if r.Method != http.MethodPut || r.Header.Get("X-aws-ec2-metadata-token-ttl-seconds") == "" {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			tokenRequests.Add(1)
+			w.Write([]byte(token.Load().(string)))
+			return
+		}
+		if r.Header.Get("X-aws-ec2-metadata-token") != token.Load().(string) {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		value, ok := values[r.URL.Path]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Write([]byte(value))
+	}))
+	t.Cleanup(ts.Close)
+	return ts
+}
+
+func TestAWSProvider(t *testing.T) {
+	var token atomic.Value
+	token.Store("token-1")
+	var tokenRequests atomic.Int32
+	ts := fakeIMDSv2(t, &token, &tokenRequests)
+
+	provider := &AWSProvider{Endpoint: ts.URL, HTTPClient: ts.Client()}
+	client := NewClientWithProvider(ts.Client(), httpretry.Policy{MaxAttempts: 1}, provider)
+
+	expected := map[string]string{
+		InstanceZoneURL:        "us-east-1a",
+		ClusterLocationURL:     "us-east-1",
+		InstanceIDURL:          "i-0123456789abcdef0",
+		MachineTypeURL:         "m5.large",
+		ServiceAccountEmailURL: "eks-node-role",
+		ProjectIDURL:           "123456789012",
+		NumericProjectIDURL:    "123456789012",
+		ClusterNameURL:         "test-cluster",
+	}
+	for url, value := range expected {
+		got, err := client.FetchMetadata(context.Background(), url)
+		require.NoError(t, err, url)
+		assert.Equal(t, value, got, url)
+	}
+	assert.Equal(t, int32(1), tokenRequests.Load(), "the session token is reused")
+
+	// A rotated token is rejected once and then requested again
+	token.Store("token-2")
+	_, err := client.FetchMetadata(context.Background(), InstanceIDURL)
+	assert.Error(t, err)
+	value, err := client.FetchMetadata(context.Background(), InstanceIDURL)
+	require.NoError(t, err)
+	assert.Equal(t, "i-0123456789abcdef0", value)
+	assert.Equal(t, int32(2), tokenRequests.Load())
+
+	_, err = client.FetchMetadata(context.Background(), ts.URL+"/unknown")
+	assert.ErrorIs(t, err, ErrUnsupported)
+}
+
+func TestAzureProvider(t *testing.T) {
+	compute := `{
+		"location": "eastus",
+		"zone": "2",
+		"name": "aks-nodepool1-12345678-vmss_0",
+		"subscriptionId": "00000000-0000-0000-0000-000000000000",
+		"vmId": "13f56399-bd52-4150-9748-7190aae1ff21",
+		"vmSize": "Standard_D2s_v3",
+		"osProfile": {"computerName": "aks-nodepool1-12345678-vmss000000"},
+		"tagsList": [{"name": "aks-managed-cluster-name", "value": "test-cluster"}]
+	}`
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Metadata") != "true" || r.URL.Path != "/metadata/instance/compute" || r.URL.Query().Get("api-version") == "" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		w.Write([]byte(compute))
+	}))
+	t.Cleanup(ts.Close)
+
+	client := NewClientWithProvider(ts.Client(), httpretry.Policy{MaxAttempts: 1}, AzureProvider{Endpoint: ts.URL})
+
+	expected := map[string]string{
+		InstanceZoneURL:    "eastus-2",
+		ClusterLocationURL: "eastus",
+		ClusterNameURL:     "test-cluster",
+		ProjectIDURL:       "00000000-0000-0000-0000-000000000000",
+		InstanceIDURL:      "13f56399-bd52-4150-9748-7190aae1ff21",
+		MachineTypeURL:     "Standard_D2s_v3",
+		HostnameURL:        "aks-nodepool1-12345678-vmss000000",
+	}
+	for url, value := range expected {
+		got, err := client.FetchMetadata(context.Background(), url)
+		require.NoError(t, err, url)
+		assert.Equal(t, value, got, url)
+	}
+
+	_, err := client.FetchMetadata(context.Background(), ServiceAccountEmailURL)
+	assert.ErrorIs(t, err, ErrUnsupported)
+}
+
+func TestNewProvider(t *testing.T) {
+	for _, name := range append(ProviderNames, "") {
+		provider, err := NewProvider(name, http.DefaultClient)
+		require.NoError(t, err, name)
+		if name != "" {
+			assert.Equal(t, name, provider.Name())
+		}
+	}
+	_, err := NewProvider("openstack", http.DefaultClient)
+	assert.Error(t, err)
+}
+
+func TestMetadataHandlerUnsupportedType(t *testing.T) {
+	client := NewClientWithProvider(&http.Client{Timeout: time.Second}, httpretry.Policy{MaxAttempts: 1}, AzureProvider{})
+
+	w := httptest.NewRecorder()
+	MetadataHandler(client.FetchMetadata)(w, httptest.NewRequest(http.MethodGet, "/istio-test/metadata/numeric-project-id", nil))
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
@@ -0,0 +1,89 @@
+package metadata
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"istio-test/internal/httperr"
+	"istio-test/internal/observability"
+	"istio-test/internal/version"
+)
+
+// Readiness reports whether the pod should receive traffic. Unlike liveness it
+// fails while the server drains during graceful shutdown and when the metadata
+// server cannot be reached at all.
+type Readiness struct {
+	metadataCheck Checker
+	draining      atomic.Bool
+}
+
+// NewReadiness creates a readiness check depending on the metadata server
+func NewReadiness(metadataClient *Client) *Readiness {
+	return NewReadinessWithOptions(metadataClient, MetadataCheckOptions{})
+}
+
+// NewReadinessWithOptions creates a readiness check depending on the metadata
+// server, checked with options
+func NewReadinessWithOptions(metadataClient *Client, options MetadataCheckOptions) *Readiness {
+	return &Readiness{metadataCheck: MetadataServiceCheckWithOptions(metadataClient, options)}
+}
+
+// StartDraining makes readiness fail from now on, so the pod is removed from
+// load balancing before its connections are closed
+func (rd *Readiness) StartDraining() {
+	rd.draining.Store(true)
+}
+
+// Draining reports whether StartDraining has been called
+func (rd *Readiness) Draining() bool {
+	return rd.draining.Load()
+}
+
+// Handler responds 200 when the pod is ready and 503 while draining or when
+// the metadata server is unreachable; a slow or failing metadata server only
+// degrades readiness
+func (rd *Readiness) Handler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		startCheck := time.Now()
+
+		health := HealthResponse{
+			Status:    HealthStatusHealthy,
+			Timestamp: time.Now().UTC(),
+			Uptime:    time.Since(startTime).String(),
+			Version:   version.Get().Version,
+			Checks:    make(map[string]HealthCheck),
+		}
+
+		if rd.Draining() {
+			health.Checks["draining"] = HealthCheck{
+				Status:      HealthStatusUnhealthy,
+				Message:     "Server is shutting down",
+				Duration:    time.Since(startCheck).String(),
+				LastChecked: time.Now().UTC(),
+			}
+		} else {
+			health.Checks["metadata_service"] = RunCheck(r.Context(), rd.metadataCheck)
+		}
+		health.Status = determineOverallHealth(health.Checks)
+
+		jsonData, err := json.Marshal(health)
+		if err != nil {
+			observability.ErrorWithContext(r.Context(), fmt.Sprintf("Error encoding readiness response: %v", err))
+			httperr.Error(w, r, http.StatusInternalServerError, "Failed to encode readiness response")
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		if health.Status == HealthStatusUnhealthy {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		} else {
+			w.WriteHeader(http.StatusOK)
+		}
+		if _, err := w.Write(jsonData); err != nil {
+			observability.ErrorWithContext(r.Context(), fmt.Sprintf("Error writing readiness response: %v", err))
+		}
+	}
+}
@@ -0,0 +1,58 @@
+package metadata
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"istio-test/internal/httpretry"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// roundTripFunc adapts a function to http.RoundTripper
+type roundTripFunc func(req *http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+func TestReadinessHandler(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("test-cluster"))
+	}))
+	defer ts.Close()
+
+	// Route metadata server requests to the test server
+	client := NewClientWithPolicy(&http.Client{
+		Timeout: time.Second,
+		Transport: roundTripFunc(func(req *http.Request) (*http.Response, error) {
+			req.URL.Scheme = "http"
+			req.URL.Host = ts.Listener.Addr().String()
+			return http.DefaultTransport.RoundTrip(req)
+		}),
+	}, httpretry.DefaultPolicy())
+	readiness := NewReadiness(client)
+
+	w := httptest.NewRecorder()
+	readiness.Handler()(w, httptest.NewRequest("GET", "/istio-test/health/ready", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var health HealthResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &health))
+	assert.Equal(t, HealthStatusHealthy, health.Status)
+	assert.Contains(t, health.Checks, "metadata_service")
+
+	readiness.StartDraining()
+	assert.True(t, readiness.Draining())
+
+	w = httptest.NewRecorder()
+	readiness.Handler()(w, httptest.NewRequest("GET", "/istio-test/health/ready", nil))
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &health))
+	assert.Equal(t, HealthStatusUnhealthy, health.Status)
+	assert.Contains(t, health.Checks, "draining")
+}
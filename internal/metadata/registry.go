@@ -0,0 +1,226 @@
+package metadata
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// DefaultCheckTimeout bounds a check that does not set its own timeout
+const DefaultCheckTimeout = 3 * time.Second
+
+// Checker is a health check registered with a HealthRegistry
+type Checker interface {
+	Name() string
+	Check(ctx context.Context) error
+	Critical() bool         // A failing critical check makes the application unhealthy, others degrade it
+	Timeout() time.Duration // Time the check may take, zero means DefaultCheckTimeout
+}
+
+// degradedError marks a check failure that only degrades health
+type degradedError struct {
+	err error
+}
+
+func (e degradedError) Error() string { return e.err.Error() }
+func (e degradedError) Unwrap() error { return e.err }
+
+// Degraded wraps err so that it only degrades health, even when returned by a
+// critical check, e.g. for a dependency that responds slowly
+func Degraded(err error) error {
+	return degradedError{err: err}
+}
+
+// checkFunc is a Checker running a function
+type checkFunc struct {
+	name     string
+	critical bool
+	timeout  time.Duration
+	check    func(ctx context.Context) error
+}
+
+func (c checkFunc) Name() string                    { return c.name }
+func (c checkFunc) Check(ctx context.Context) error { return c.check(ctx) }
+func (c checkFunc) Critical() bool                  { return c.critical }
+func (c checkFunc) Timeout() time.Duration          { return c.timeout }
+
+// NewCheck returns a Checker running check
+func NewCheck(name string, critical bool, timeout time.Duration, check func(ctx context.Context) error) Checker {
+	return checkFunc{name: name, critical: critical, timeout: timeout, check: check}
+}
+
+// AsChecker returns dependency as a non-critical Checker with the default
+// timeout, unless it already is a Checker
+func AsChecker(dependency DependencyCheck) Checker {
+	if checker, ok := dependency.(Checker); ok {
+		return checker
+	}
+	return NewCheck(dependency.Name(), false, 0, dependency.Check)
+}
+
+// HealthRegistry holds the health checks of the application. Checks are
+// registered at startup; the health handlers and the background checker run
+// whatever is registered.
+type HealthRegistry struct {
+	mu       sync.RWMutex
+	checkers []Checker
+	timeouts map[string]time.Duration
+}
+
+// NewHealthRegistry creates a registry holding checkers
+func NewHealthRegistry(checkers ...Checker) *HealthRegistry {
+	r := &HealthRegistry{}
+	for _, checker := range checkers {
+		r.Register(checker)
+	}
+	return r
+}
+
+// Register adds checker to the registry. Like http.ServeMux, it panics when a
+// check of the same name is already registered.
+func (r *HealthRegistry) Register(checker Checker) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, registered := range r.checkers {
+		if registered.Name() == checker.Name() {
+			panic(fmt.Sprintf("health check %q registered twice", checker.Name()))
+		}
+	}
+	r.checkers = append(r.checkers, checker)
+}
+
+// withTimeout is a Checker whose timeout is overridden
+type withTimeout struct {
+	Checker
+	timeout time.Duration
+}
+
+func (c withTimeout) Timeout() time.Duration { return c.timeout }
+
+// SetTimeouts overrides the timeouts of the checks named in timeouts, e.g.
+// for a dependency that is slower in one cluster than in another
+func (r *HealthRegistry) SetTimeouts(timeouts map[string]time.Duration) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.timeouts = timeouts
+}
+
+// RegisterDependency registers dependency as a non-critical check
+func (r *HealthRegistry) RegisterDependency(dependency DependencyCheck) {
+	r.Register(AsChecker(dependency))
+}
+
+// Checkers returns the registered checks in registration order, with their
+// timeouts overridden by SetTimeouts
+func (r *HealthRegistry) Checkers() []Checker {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	checkers := make([]Checker, len(r.checkers))
+	for i, checker := range r.checkers {
+		if timeout, ok := r.timeouts[checker.Name()]; ok && timeout > 0 {
+			checker = withTimeout{Checker: checker, timeout: timeout}
+		}
+		checkers[i] = checker
+	}
+	return checkers
+}
+
+// CheckAll runs every registered check concurrently, each within its own
+// timeout, and returns the results by check name
+func (r *HealthRegistry) CheckAll(ctx context.Context) map[string]HealthCheck {
+	checkers := r.Checkers()
+	results := make(map[string]HealthCheck, len(checkers))
+
+	var (
+		mu sync.Mutex
+		wg sync.WaitGroup
+	)
+	for _, checker := range checkers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			result := RunCheck(ctx, checker)
+			mu.Lock()
+			results[checker.Name()] = result
+			mu.Unlock()
+		}()
+	}
+	wg.Wait()
+	return results
+}
+
+// RunCheck runs checker within its timeout. A failure makes the result
+// unhealthy when the check is critical and degraded otherwise; failures
+// wrapped with Degraded are always degraded.
+func RunCheck(ctx context.Context, checker Checker) HealthCheck {
+	timeout := checker.Timeout()
+	if timeout <= 0 {
+		timeout = DefaultCheckTimeout
+	}
+	checkStart := time.Now()
+	checkCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	err := checker.Check(checkCtx)
+	result := HealthCheck{
+		Status:      HealthStatusHealthy,
+		Message:     fmt.Sprintf("%s is reachable", checker.Name()),
+		Duration:    time.Since(checkStart).String(),
+		LastChecked: time.Now().UTC(),
+	}
+	if err != nil {
+		var degraded degradedError
+		result.Status = HealthStatusDegraded
+		if checker.Critical() && !errors.As(err, &degraded) {
+			result.Status = HealthStatusUnhealthy
+		}
+		result.Message = fmt.Sprintf("%s check failed: %v", checker.Name(), err)
+	}
+	return result
+}
+
+// DefaultMetadataSlowThreshold is the response time above which the metadata
+// service degrades health, unless a check sets its own
+const DefaultMetadataSlowThreshold = time.Second
+
+// MetadataCheckOptions configures the check of the metadata service; zero
+// values use the defaults
+type MetadataCheckOptions struct {
+	Timeout       time.Duration // Time the service has to answer, defaults to DefaultCheckTimeout
+	SlowThreshold time.Duration // Response time that degrades health, defaults to DefaultMetadataSlowThreshold
+}
+
+// MetadataServiceCheck returns the critical check of the metadata service of
+// metadataClient with the default timeout and slow threshold
+func MetadataServiceCheck(metadataClient *Client) Checker {
+	return MetadataServiceCheckWithOptions(metadataClient, MetadataCheckOptions{})
+}
+
+// MetadataServiceCheckWithOptions returns the critical check of the metadata
+// service of metadataClient: it is unhealthy when the service does not answer
+// in time and degraded when it fails or answers slowly
+func MetadataServiceCheckWithOptions(metadataClient *Client, options MetadataCheckOptions) Checker {
+	if options.Timeout <= 0 {
+		options.Timeout = DefaultCheckTimeout
+	}
+	if options.SlowThreshold <= 0 {
+		options.SlowThreshold = DefaultMetadataSlowThreshold
+	}
+	return NewCheck("metadata_service", true, options.Timeout, func(ctx context.Context) error {
+		checkStart := time.Now()
+		// Fetch a value every instance has as a connectivity test
+		_, err := metadataClient.FetchMetadata(ctx, probeURL(metadataClient.provider))
+		switch {
+		case err != nil && ctx.Err() == context.DeadlineExceeded:
+			return fmt.Errorf("metadata service timeout: %w", err)
+		case err != nil:
+			return Degraded(fmt.Errorf("metadata service error: %w", err))
+		case time.Since(checkStart) > options.SlowThreshold:
+			return Degraded(fmt.Errorf("metadata service responding slowly (%v)", time.Since(checkStart).Round(time.Millisecond)))
+		}
+		return nil
+	})
+}
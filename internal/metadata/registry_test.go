@@ -0,0 +1,128 @@
+package metadata
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRunCheck(t *testing.T) {
+	failure := errors.New("disk full")
+
+	tests := []struct {
+		name    string
+		checker Checker
+		status  HealthStatus
+	}{
+		{"passing", NewCheck("dns", true, 0, func(ctx context.Context) error { return nil }), HealthStatusHealthy},
+		{"failing critical", NewCheck("dns", true, 0, func(ctx context.Context) error { return failure }), HealthStatusUnhealthy},
+		{"failing non-critical", NewCheck("disk", false, 0, func(ctx context.Context) error { return failure }), HealthStatusDegraded},
+		{"degraded critical", NewCheck("dns", true, 0, func(ctx context.Context) error { return Degraded(failure) }), HealthStatusDegraded},
+		{"dependency", AsChecker(dependencyFunc{name: "queue", err: failure}), HealthStatusDegraded},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := RunCheck(context.Background(), tt.checker)
+			assert.Equal(t, tt.status, result.Status)
+			assert.NotEmpty(t, result.Duration)
+			if tt.status != HealthStatusHealthy {
+				assert.Contains(t, result.Message, "disk full")
+			}
+		})
+	}
+}
+
+func TestRunCheckTimeout(t *testing.T) {
+	checker := NewCheck("slow", true, 10*time.Millisecond, func(ctx context.Context) error {
+		<-ctx.Done()
+		return ctx.Err()
+	})
+
+	start := time.Now()
+	result := RunCheck(context.Background(), checker)
+	assert.Less(t, time.Since(start), time.Second)
+	assert.Equal(t, HealthStatusUnhealthy, result.Status)
+	assert.Contains(t, result.Message, "deadline exceeded")
+}
+
+func TestHealthRegistry(t *testing.T) {
+	registry := NewHealthRegistry(NewCheck("dns", true, 0, func(ctx context.Context) error { return nil }))
+	registry.RegisterDependency(dependencyFunc{name: "queue", err: errors.New("connection refused")})
+
+	assert.Len(t, registry.Checkers(), 2)
+	assert.Panics(t, func() { registry.RegisterDependency(dependencyFunc{name: "dns"}) })
+
+	results := registry.CheckAll(context.Background())
+	assert.Equal(t, HealthStatusHealthy, results["dns"].Status)
+	assert.Equal(t, HealthStatusDegraded, results["queue"].Status)
+
+	w := httptest.NewRecorder()
+	registry.Handler()(w, httptest.NewRequest(http.MethodGet, "/health", nil))
+	require.Equal(t, http.StatusOK, w.Code)
+
+	var health HealthResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &health))
+	assert.Equal(t, HealthStatusDegraded, health.Status)
+	assert.Len(t, health.Checks, 3, "registered checks and http_server")
+}
+
+func TestMetadataServiceCheck(t *testing.T) {
+	client := newTestMetadataClient(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("test-cluster"))
+	})
+	checker := MetadataServiceCheck(client)
+	assert.Equal(t, "metadata_service", checker.Name())
+	assert.True(t, checker.Critical())
+	assert.Equal(t, HealthStatusHealthy, RunCheck(context.Background(), checker).Status)
+
+	failing := newTestMetadataClient(t, func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+	})
+	result := RunCheck(context.Background(), MetadataServiceCheck(failing))
+	assert.Equal(t, HealthStatusDegraded, result.Status, "errors other than timeouts only degrade")
+}
+
+func TestMetadataServiceCheckWithOptions(t *testing.T) {
+	client := newTestMetadataClient(t, func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(20 * time.Millisecond)
+		w.Write([]byte("test-cluster"))
+	})
+
+	checker := MetadataServiceCheckWithOptions(client, MetadataCheckOptions{Timeout: time.Second, SlowThreshold: 5 * time.Millisecond})
+	assert.Equal(t, time.Second, checker.Timeout())
+	result := RunCheck(context.Background(), checker)
+	assert.Equal(t, HealthStatusDegraded, result.Status)
+	assert.Contains(t, result.Message, "responding slowly")
+
+	checker = MetadataServiceCheckWithOptions(client, MetadataCheckOptions{})
+	assert.Equal(t, DefaultCheckTimeout, checker.Timeout())
+	assert.Equal(t, HealthStatusHealthy, RunCheck(context.Background(), checker).Status)
+}
+
+func TestHealthRegistrySetTimeouts(t *testing.T) {
+	registry := NewHealthRegistry(
+		NewCheck("dns", false, 0, func(ctx context.Context) error { return nil }),
+		NewCheck("dbping", false, time.Second, func(ctx context.Context) error {
+			<-ctx.Done()
+			return ctx.Err()
+		}),
+	)
+	registry.SetTimeouts(map[string]time.Duration{"dbping": 10 * time.Millisecond, "unknown": time.Second})
+
+	checkers := registry.Checkers()
+	assert.Equal(t, time.Duration(0), checkers[0].Timeout(), "checks without an override keep their timeout")
+	assert.Equal(t, 10*time.Millisecond, checkers[1].Timeout())
+	assert.Equal(t, "dbping", checkers[1].Name())
+
+	results := registry.CheckAll(context.Background())
+	assert.Equal(t, HealthStatusDegraded, results["dbping"].Status)
+	assert.Contains(t, results["dbping"].Message, "deadline exceeded")
+}
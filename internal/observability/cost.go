@@ -0,0 +1,127 @@
+package observability
+
+import (
+	"context"
+	"net/http"
+	"runtime/metrics"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	httpRequestCPUSeconds = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: metricsNamespace,
+		Name:      "http_request_cpu_seconds",
+		Help:      "Process CPU time consumed while serving HTTP requests; includes concurrent work.",
+		Buckets:   []float64{.0001, .00025, .0005, .001, .0025, .005, .01, .025, .05, .1, .25, .5, 1},
+	}, []string{"path", "method"})
+
+	httpRequestAllocBytes = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: metricsNamespace,
+		Name:      "http_request_alloc_bytes",
+		Help:      "Heap bytes allocated by the process while serving HTTP requests; includes concurrent work.",
+		Buckets:   prometheus.ExponentialBuckets(1024, 4, 10), // 1 KiB to 256 MiB
+	}, []string{"path", "method"})
+)
+
+func init() {
+	metricsRegistry.MustRegister(httpRequestCPUSeconds, httpRequestAllocBytes)
+}
+
+// costAccounting is set once a CostMiddleware is built, so request logs
+// carry the measured cost
+var costAccounting atomic.Bool
+
+// costSampleNames are the runtime metrics read for allocations
+var costSampleNames = []string{"/gc/heap/allocs:bytes", "/gc/heap/allocs:objects"}
+
+var costSamplePool = sync.Pool{New: func() any {
+	samples := make([]metrics.Sample, len(costSampleNames))
+	for i, name := range costSampleNames {
+		samples[i].Name = name
+	}
+	return samples
+}}
+
+// costReading is a snapshot of the cumulative process cost
+type costReading struct {
+	cpu          time.Duration
+	allocBytes   uint64
+	allocObjects uint64
+}
+
+// readCost returns the CPU time and heap allocations of the process so far
+func readCost() costReading {
+	var reading costReading
+
+	var usage syscall.Rusage
+	if err := syscall.Getrusage(syscall.RUSAGE_SELF, &usage); err == nil {
+		reading.cpu = time.Duration(usage.Utime.Nano() + usage.Stime.Nano())
+	}
+
+	samples := costSamplePool.Get().([]metrics.Sample)
+	metrics.Read(samples)
+	if samples[0].Value.Kind() == metrics.KindUint64 {
+		reading.allocBytes = samples[0].Value.Uint64()
+	}
+	if samples[1].Value.Kind() == metrics.KindUint64 {
+		reading.allocObjects = samples[1].Value.Uint64()
+	}
+	costSamplePool.Put(samples)
+	return reading
+}
+
+// requestCost is the cost measured for a request, filled in by CostMiddleware
+// for RequestLoggingMiddleware
+type requestCost struct {
+	measured     bool
+	cpu          time.Duration
+	allocBytes   uint64
+	allocObjects uint64
+}
+
+type requestCostKey struct{}
+
+// withRequestCost returns a copy of r whose context carries an empty cost
+// record, and the record
+func withRequestCost(r *http.Request) (*http.Request, *requestCost) {
+	cost := &requestCost{}
+	return r.WithContext(context.WithValue(r.Context(), requestCostKey{}, cost)), cost
+}
+
+// CostMiddleware measures the CPU time and heap allocations of the process
+// while each request is served and records them in histograms by route and in
+// the request_complete log entries. The runtime has no per-goroutine
+// accounting, so concurrent requests are included; costs are exact when
+// requests are served one at a time, as in a serial benchmark run, and upper
+// bounds otherwise. pathLabel is used as in MetricsMiddleware.
+func CostMiddleware(next http.Handler, pathLabel func(r *http.Request) string) http.Handler {
+	costAccounting.Store(true)
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		before := readCost()
+		next.ServeHTTP(w, r)
+		after := readCost()
+
+		cpu := after.cpu - before.cpu
+		allocBytes := after.allocBytes - before.allocBytes
+
+		path := r.URL.Path
+		if pathLabel != nil {
+			path = pathLabel(r)
+		}
+		httpRequestCPUSeconds.WithLabelValues(path, r.Method).Observe(cpu.Seconds())
+		httpRequestAllocBytes.WithLabelValues(path, r.Method).Observe(float64(allocBytes))
+
+		if cost, ok := r.Context().Value(requestCostKey{}).(*requestCost); ok {
+			cost.measured = true
+			cost.cpu = cpu
+			cost.allocBytes = allocBytes
+			cost.allocObjects = after.allocObjects - before.allocObjects
+		}
+	})
+}
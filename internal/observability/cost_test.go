@@ -0,0 +1,55 @@
+package observability
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var costSink []byte
+
+func TestReadCost(t *testing.T) {
+	before := readCost()
+	costSink = make([]byte, 4<<20)
+	after := readCost()
+
+	assert.GreaterOrEqual(t, after.allocBytes-before.allocBytes, uint64(4<<20))
+	assert.GreaterOrEqual(t, after.allocObjects-before.allocObjects, uint64(1))
+	assert.GreaterOrEqual(t, after.cpu, before.cpu)
+}
+
+func TestCostMiddleware(t *testing.T) {
+	t.Cleanup(func() { costAccounting.Store(false) })
+
+	hook := recordLogs(t)
+
+	handler := RequestLoggingMiddleware(CostMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		costSink = make([]byte, 2<<20)
+		// Burn some CPU so the measurement is not zero
+		deadline := time.Now().Add(20 * time.Millisecond)
+		for time.Now().Before(deadline) {
+		}
+		w.WriteHeader(http.StatusOK)
+	}), func(r *http.Request) string { return "/costly" }))
+
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/costly/1", nil))
+
+	var complete *logEntry
+	for _, entry := range hook.Entries {
+		if entry.Data["type"] == "request_complete" {
+			complete = entry
+		}
+	}
+	require.NotNil(t, complete)
+	assert.GreaterOrEqual(t, complete.Data["alloc_bytes"], uint64(2<<20))
+	assert.Greater(t, complete.Data["cpu_ms"], 0.0)
+	assert.Contains(t, complete.Data, "alloc_objects")
+
+	assert.Equal(t, 1, testutil.CollectAndCount(httpRequestCPUSeconds, "istio_test_http_request_cpu_seconds"))
+	assert.Equal(t, 1, testutil.CollectAndCount(httpRequestAllocBytes, "istio_test_http_request_alloc_bytes"))
+}
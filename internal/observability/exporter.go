@@ -0,0 +1,282 @@
+package observability
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"sync"
+	"time"
+)
+
+// Exporter states
+const (
+	ExporterPending = "pending" // Waiting for the agent or collector to accept connections
+	ExporterRunning = "running" // Started
+	ExporterFailed  = "failed"  // Start failed with an error retrying cannot fix
+)
+
+// Default backoff between attempts to reach an agent or collector
+const (
+	DefaultExporterBaseDelay = time.Second
+	DefaultExporterMaxDelay  = 30 * time.Second
+)
+
+// exporterDialTimeout bounds a single reachability probe
+const exporterDialTimeout = 2 * time.Second
+
+// ExporterStatus describes an exporter
+type ExporterStatus struct {
+	Name      string    `json:"name"`
+	State     string    `json:"state"`
+	Address   string    `json:"address"`
+	Attempts  int       `json:"attempts"`
+	LastError string    `json:"last_error,omitempty"`
+	StartedAt time.Time `json:"started_at"` // Zero until running
+}
+
+// Exporter starts the tracer or profiler in the background once the agent or
+// collector it sends to accepts connections, retrying with backoff. Started at
+// boot in a fresh cluster, the agent is often not up yet; the tracers do not
+// fail then but drop what they send, so waiting for the agent keeps the first
+// traces and profiles. The exporter is a dependency check reporting whether it
+// is running.
+type Exporter struct {
+	name    string
+	network string
+	address string
+	start   func() error
+	dial    func(ctx context.Context, network, address string) (net.Conn, error)
+
+	mu     sync.Mutex
+	status ExporterStatus
+}
+
+// newExporter creates a pending exporter running start once address accepts
+// connections
+func newExporter(name, network, address string, start func() error) *Exporter {
+	dialer := &net.Dialer{Timeout: exporterDialTimeout}
+	return &Exporter{
+		name:    name,
+		network: network,
+		address: address,
+		start:   start,
+		dial:    dialer.DialContext,
+		status:  ExporterStatus{Name: name, State: ExporterPending, Address: address},
+	}
+}
+
+// NewTracerExporter returns the exporter starting the tracer with options once
+// its Datadog agent or OTLP collector is reachable. Invalid options are
+// reported right away rather than retried.
+func NewTracerExporter(options TracerOptions) (*Exporter, error) {
+	var (
+		network, address string
+		err              error
+	)
+	switch options.Backend {
+	case "", TracingBackendDatadog:
+		_, err = tracerOptions(options)
+		network, address = TraceAgentAddr(options.AgentAddr)
+	case TracingBackendOTel:
+		_, err = otelSampler(options)
+		if err == nil {
+			address, err = OTLPAddr(options.OTLPEndpoint)
+		}
+		network = "tcp"
+	default:
+		err = fmt.Errorf("unknown tracing backend '%s'", options.Backend)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return newExporter("tracer", network, address, func() error { return StartTracer(options) }), nil
+}
+
+// NewProfilerExporter returns the exporter starting the profiler with options
+// once its Datadog agent is reachable. Invalid options are reported right away
+// rather than retried.
+func NewProfilerExporter(options ProfilerOptions) (*Exporter, error) {
+	if _, _, _, err := profilerOptions(options); err != nil {
+		return nil, err
+	}
+	network, address := TraceAgentAddr(options.AgentAddr)
+	return newExporter("profiler", network, address, func() error { return StartProfiler(options) }), nil
+}
+
+// TraceAgentAddr returns the network and address of the Datadog agent the
+// tracer and profiler send to: configured when set, otherwise the agent the
+// Datadog libraries find through DD_TRACE_AGENT_URL, DD_AGENT_HOST and
+// DD_TRACE_AGENT_PORT. Runtime metrics go to DogStatsD on the same agent.
+func TraceAgentAddr(configured string) (network, address string) {
+	if configured != "" {
+		return "tcp", configured
+	}
+	if u, err := url.Parse(os.Getenv("DD_TRACE_AGENT_URL")); err == nil {
+		switch u.Scheme {
+		case "unix":
+			return "unix", u.Path
+		case "http", "https":
+			return "tcp", hostPort(u)
+		}
+	}
+	host := os.Getenv("DD_AGENT_HOST")
+	if host == "" {
+		host = "localhost"
+	}
+	port := os.Getenv("DD_TRACE_AGENT_PORT")
+	if port == "" {
+		port = "8126"
+	}
+	return "tcp", net.JoinHostPort(host, port)
+}
+
+// OTLPAddr returns the host:port of the OTLP/HTTP collector spans are exported
+// to: endpoint when set, otherwise the standard OpenTelemetry environment
+// variables and the exporter default of localhost:4318
+func OTLPAddr(endpoint string) (string, error) {
+	for _, candidate := range []string{endpoint, os.Getenv("OTEL_EXPORTER_OTLP_TRACES_ENDPOINT"), os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT")} {
+		if candidate == "" {
+			continue
+		}
+		u, err := url.Parse(candidate)
+		if err != nil || u.Host == "" {
+			return "", fmt.Errorf("invalid OTLP endpoint '%s': must be an http or https URL", candidate)
+		}
+		return hostPort(u), nil
+	}
+	return "localhost:4318", nil
+}
+
+// hostPort returns the host of u with the default port of its scheme
+func hostPort(u *url.URL) string {
+	if u.Port() != "" {
+		return u.Host
+	}
+	port := "80"
+	if u.Scheme == "https" {
+		port = "443"
+	}
+	return net.JoinHostPort(u.Hostname(), port)
+}
+
+// Run probes the agent or collector until it accepts a connection, waiting
+// baseDelay after the first failure and doubling up to maxDelay, then starts
+// the exporter. It returns once the exporter started, failed to start or ctx
+// is done.
+func (e *Exporter) Run(ctx context.Context, baseDelay, maxDelay time.Duration) {
+	if baseDelay <= 0 {
+		baseDelay = DefaultExporterBaseDelay
+	}
+	if maxDelay <= 0 {
+		maxDelay = DefaultExporterMaxDelay
+	}
+	maxDelay = max(maxDelay, baseDelay)
+
+	begin := time.Now()
+	delay := baseDelay
+	for {
+		err := e.probe(ctx)
+		if err == nil {
+			e.startExporter(ctx, time.Since(begin))
+			return
+		}
+
+		attempts := e.record(err)
+		if attempts == 1 {
+			WarnWithFields(ctx, fmt.Sprintf("Waiting for the %s agent at %s: %v", e.name, e.address, err), map[string]any{
+				"type":     "exporter_waiting",
+				"exporter": e.name,
+				"address":  e.address,
+				"error":    err.Error(),
+			})
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(delay):
+		}
+		delay = min(2*delay, maxDelay)
+	}
+}
+
+// probe dials the agent or collector
+func (e *Exporter) probe(ctx context.Context) error {
+	conn, err := e.dial(ctx, e.network, e.address)
+	if err != nil {
+		return err
+	}
+	return conn.Close()
+}
+
+// record counts a failed probe and returns the number of attempts so far
+func (e *Exporter) record(err error) int {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.status.Attempts++
+	e.status.LastError = err.Error()
+	return e.status.Attempts
+}
+
+// startExporter starts the exporter once its agent was reached after waited
+func (e *Exporter) startExporter(ctx context.Context, waited time.Duration) {
+	err := e.start()
+
+	e.mu.Lock()
+	e.status.Attempts++
+	if err != nil {
+		e.status.State = ExporterFailed
+		e.status.LastError = err.Error()
+	} else {
+		e.status.State = ExporterRunning
+		e.status.LastError = ""
+		e.status.StartedAt = time.Now().UTC()
+	}
+	attempts := e.status.Attempts
+	e.mu.Unlock()
+
+	fields := map[string]any{
+		"type":      "exporter_started",
+		"exporter":  e.name,
+		"address":   e.address,
+		"attempts":  attempts,
+		"waited_ms": Milliseconds(waited),
+	}
+	if err != nil {
+		fields["type"] = "exporter_failed"
+		fields["error"] = err.Error()
+		ErrorWithFields(ctx, fmt.Sprintf("Failed to start %s: %v", e.name, err), fields)
+		return
+	}
+	InfoWithFields(ctx, fmt.Sprintf("Started %s sending to %s", e.name, e.address), fields)
+}
+
+// Status returns the state of the exporter
+func (e *Exporter) Status() ExporterStatus {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.status
+}
+
+// Name implements metadata.DependencyCheck
+func (e *Exporter) Name() string {
+	return e.name
+}
+
+// Check implements metadata.DependencyCheck, failing until the exporter runs
+func (e *Exporter) Check(ctx context.Context) error {
+	status := e.Status()
+	switch status.State {
+	case ExporterRunning:
+		return nil
+	case ExporterFailed:
+		return errors.New(status.LastError)
+	}
+	if status.Attempts == 0 {
+		return fmt.Errorf("waiting for the agent at %s", status.Address)
+	}
+	return fmt.Errorf("waiting for the agent at %s after %d attempts: %s", status.Address, status.Attempts, status.LastError)
+}
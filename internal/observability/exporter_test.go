@@ -0,0 +1,145 @@
+package observability
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTraceAgentAddr(t *testing.T) {
+	t.Setenv("DD_TRACE_AGENT_URL", "")
+	t.Setenv("DD_AGENT_HOST", "")
+	t.Setenv("DD_TRACE_AGENT_PORT", "")
+
+	network, address := TraceAgentAddr("")
+	assert.Equal(t, "tcp", network)
+	assert.Equal(t, "localhost:8126", address)
+
+	network, address = TraceAgentAddr("datadog-agent:8126")
+	assert.Equal(t, "tcp", network)
+	assert.Equal(t, "datadog-agent:8126", address)
+
+	t.Setenv("DD_AGENT_HOST", "10.0.0.7")
+	t.Setenv("DD_TRACE_AGENT_PORT", "9126")
+	_, address = TraceAgentAddr("")
+	assert.Equal(t, "10.0.0.7:9126", address)
+
+	t.Setenv("DD_TRACE_AGENT_URL", "unix:///var/run/datadog/apm.socket")
+	network, address = TraceAgentAddr("")
+	assert.Equal(t, "unix", network)
+	assert.Equal(t, "/var/run/datadog/apm.socket", address)
+}
+
+func TestOTLPAddr(t *testing.T) {
+	t.Setenv("OTEL_EXPORTER_OTLP_TRACES_ENDPOINT", "")
+	t.Setenv("OTEL_EXPORTER_OTLP_ENDPOINT", "")
+
+	tests := []struct {
+		endpoint string
+		address  string
+	}{
+		{"", "localhost:4318"},
+		{"http://otel-collector:4318/v1/traces", "otel-collector:4318"},
+		{"https://collector.example.com", "collector.example.com:443"},
+		{"http://collector", "collector:80"},
+	}
+	for _, tt := range tests {
+		address, err := OTLPAddr(tt.endpoint)
+		require.NoError(t, err, tt.endpoint)
+		assert.Equal(t, tt.address, address, tt.endpoint)
+	}
+
+	t.Setenv("OTEL_EXPORTER_OTLP_ENDPOINT", "http://env-collector:4318")
+	address, err := OTLPAddr("")
+	require.NoError(t, err)
+	assert.Equal(t, "env-collector:4318", address)
+
+	_, err = OTLPAddr("collector:4318")
+	assert.Error(t, err)
+}
+
+func TestNewExporterInvalidOptions(t *testing.T) {
+	_, err := NewTracerExporter(TracerOptions{Backend: "jaeger"})
+	assert.ErrorContains(t, err, "unknown tracing backend")
+
+	_, err = NewTracerExporter(TracerOptions{SamplingRules: map[string]string{"api": "2"}})
+	assert.ErrorContains(t, err, "invalid rate")
+
+	_, err = NewProfilerExporter(ProfilerOptions{ProfileTypes: []string{"threads"}})
+	assert.ErrorContains(t, err, "unknown profile type")
+}
+
+func TestExporterWaitsForAgent(t *testing.T) {
+	var dials, starts atomic.Int32
+	exporter := newExporter("tracer", "tcp", "agent:8126", func() error {
+		starts.Add(1)
+		return nil
+	})
+	exporter.dial = func(ctx context.Context, network, address string) (net.Conn, error) {
+		if dials.Add(1) < 3 {
+			return nil, errors.New("connection refused")
+		}
+		client, server := net.Pipe()
+		server.Close()
+		return client, nil
+	}
+	assert.ErrorContains(t, exporter.Check(context.Background()), "waiting for the agent at agent:8126")
+
+	exporter.Run(context.Background(), time.Millisecond, 2*time.Millisecond)
+
+	assert.Equal(t, int32(1), starts.Load())
+	assert.NoError(t, exporter.Check(context.Background()))
+	status := exporter.Status()
+	assert.Equal(t, ExporterRunning, status.State)
+	assert.Equal(t, 3, status.Attempts)
+	assert.Empty(t, status.LastError)
+	assert.False(t, status.StartedAt.IsZero())
+}
+
+func TestExporterStartFailure(t *testing.T) {
+	exporter := newExporter("profiler", "tcp", "agent:8126", func() error { return errors.New("bad API key") })
+	exporter.dial = func(ctx context.Context, network, address string) (net.Conn, error) {
+		client, server := net.Pipe()
+		server.Close()
+		return client, nil
+	}
+
+	exporter.Run(context.Background(), time.Millisecond, time.Millisecond)
+
+	assert.Equal(t, ExporterFailed, exporter.Status().State)
+	assert.EqualError(t, exporter.Check(context.Background()), "bad API key")
+}
+
+func TestExporterStopsWaiting(t *testing.T) {
+	exporter := newExporter("tracer", "tcp", "agent:8126", func() error {
+		t.Error("started without an agent")
+		return nil
+	})
+	exporter.dial = func(ctx context.Context, network, address string) (net.Conn, error) {
+		return nil, errors.New("connection refused")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		exporter.Run(ctx, time.Millisecond, time.Millisecond)
+		close(done)
+	}()
+	assert.Eventually(t, func() bool { return exporter.Status().Attempts >= 2 }, time.Second, time.Millisecond)
+	cancel()
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Run did not return once the context was canceled")
+	}
+	err := exporter.Check(context.Background())
+	assert.ErrorContains(t, err, "connection refused")
+	assert.Equal(t, ExporterPending, exporter.Status().State)
+}
@@ -0,0 +1,199 @@
+package observability
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+
+	"istio-test/internal/tenant"
+	"istio-test/internal/testrun"
+
+	"go.opentelemetry.io/otel/trace"
+	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace"
+	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/ext"
+	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/tracer"
+)
+
+// Log formats
+const (
+	LogFormatJSON = "json"
+	LogFormatText = "text"
+)
+
+// Levels beyond the four of slog, kept so the LOG_LEVEL values of the logrus
+// days still parse
+const (
+	LevelTrace = slog.Level(-8)
+	LevelFatal = slog.Level(12)
+	LevelPanic = slog.Level(16)
+)
+
+// levelNames maps levels to the names written in entries and reported by LogLevel
+var levelNames = map[slog.Level]string{
+	LevelTrace:      "trace",
+	slog.LevelDebug: "debug",
+	slog.LevelInfo:  "info",
+	slog.LevelWarn:  "warning",
+	slog.LevelError: "error",
+	LevelFatal:      "fatal",
+	LevelPanic:      "panic",
+}
+
+// ParseLevel parses a level name such as "debug" or "warning", ignoring case
+func ParseLevel(name string) (slog.Level, error) {
+	switch strings.ToLower(name) {
+	case "trace":
+		return LevelTrace, nil
+	case "debug":
+		return slog.LevelDebug, nil
+	case "info":
+		return slog.LevelInfo, nil
+	case "warn", "warning":
+		return slog.LevelWarn, nil
+	case "error":
+		return slog.LevelError, nil
+	case "fatal":
+		return LevelFatal, nil
+	case "panic":
+		return LevelPanic, nil
+	}
+	return 0, fmt.Errorf("not a valid log level: %q", name)
+}
+
+// levelName returns the name of level, falling back to the slog form such as
+// "INFO+2" for levels between the named ones
+func levelName(level slog.Level) string {
+	if name, ok := levelNames[level]; ok {
+		return name
+	}
+	return level.String()
+}
+
+// logLevelVar is the minimum level of entries written, shared by every handler
+var logLevelVar slog.LevelVar
+
+// logOutput is where Init writes entries
+var logOutput io.Writer = os.Stdout
+
+var log = slog.New(newContextHandler(newLogHandler(LogFormatJSON, os.Stdout)))
+
+// Logger returns the logger used by the package functions, for callers that
+// log with the slog API directly
+func Logger() *slog.Logger {
+	return log
+}
+
+// SetLogHandler replaces the handler entries are written to, for instance to
+// ship them elsewhere than stdout. The handler still receives the trace,
+// test run and tenant attributes of the context, and only the entries at
+// or above the level set by Init or SetLogLevel.
+func SetLogHandler(handler slog.Handler) {
+	log = slog.New(newContextHandler(handler))
+}
+
+// newLogHandler returns the built-in handler for format, writing JSON unless
+// format is "text". Levels are written by name as logrus did, e.g. "warning".
+func newLogHandler(format string, w io.Writer) slog.Handler {
+	options := &slog.HandlerOptions{
+		Level: &logLevelVar,
+		ReplaceAttr: func(groups []string, a slog.Attr) slog.Attr {
+			if a.Key == slog.LevelKey && len(groups) == 0 {
+				if level, ok := a.Value.Any().(slog.Level); ok {
+					a.Value = slog.StringValue(levelName(level))
+				}
+			}
+			return a
+		},
+	}
+	if format == LogFormatText {
+		return slog.NewTextHandler(w, options)
+	}
+	return slog.NewJSONHandler(w, options)
+}
+
+// log128BitTraceIDs mirrors the Datadog log integrations, which write the
+// full 128-bit trace ID unless DD_TRACE_128_BIT_TRACEID_LOGGING_ENABLED is false
+var log128BitTraceIDs = func() bool {
+	enabled, err := strconv.ParseBool(os.Getenv("DD_TRACE_128_BIT_TRACEID_LOGGING_ENABLED"))
+	return err != nil || enabled
+}()
+
+// contextHandler adds the Datadog or OpenTelemetry trace and span IDs, test run ID and tenant
+// carried by the context of an entry as attributes
+type contextHandler struct {
+	slog.Handler
+}
+
+func newContextHandler(handler slog.Handler) *contextHandler {
+	return &contextHandler{Handler: handler}
+}
+
+func (h *contextHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	return level >= logLevelVar.Level() && h.Handler.Enabled(ctx, level)
+}
+
+func (h *contextHandler) Handle(ctx context.Context, record slog.Record) error {
+	if ctx != nil {
+		record.AddAttrs(contextAttrs(ctx)...)
+	}
+	return h.Handler.Handle(ctx, record)
+}
+
+func (h *contextHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return newContextHandler(h.Handler.WithAttrs(attrs))
+}
+
+func (h *contextHandler) WithGroup(name string) slog.Handler {
+	return newContextHandler(h.Handler.WithGroup(name))
+}
+
+// contextAttrs returns the correlation attributes carried by ctx
+func contextAttrs(ctx context.Context) []slog.Attr {
+	var attrs []slog.Attr
+	if span, ok := tracer.SpanFromContext(ctx); ok {
+		spanContext := span.Context()
+		traceID := strconv.FormatUint(spanContext.TraceID(), 10)
+		if w3c, ok := spanContext.(ddtrace.SpanContextW3C); ok && log128BitTraceIDs {
+			traceID = w3c.TraceID128()
+		}
+		attrs = append(attrs,
+			slog.String(ext.LogKeyTraceID, traceID),
+			slog.String(ext.LogKeySpanID, strconv.FormatUint(spanContext.SpanID(), 10)))
+	} else if spanContext := trace.SpanContextFromContext(ctx); spanContext.IsValid() {
+		// Datadog correlates OpenTelemetry spans by the same IDs: the span ID
+		// and the low 64 bits of the trace ID in decimal
+		traceID := spanContext.TraceID()
+		spanID := spanContext.SpanID()
+		traceIDText := strconv.FormatUint(binary.BigEndian.Uint64(traceID[8:]), 10)
+		if log128BitTraceIDs {
+			traceIDText = traceID.String()
+		}
+		attrs = append(attrs,
+			slog.String(ext.LogKeyTraceID, traceIDText),
+			slog.String(ext.LogKeySpanID, strconv.FormatUint(binary.BigEndian.Uint64(spanID[:]), 10)))
+	}
+	if id := testrun.FromContext(ctx); id != "" {
+		attrs = append(attrs, slog.String("test_run_id", id))
+	}
+	if id := tenant.FromContext(ctx); id != "" {
+		attrs = append(attrs, slog.String("tenant", id))
+	}
+	return attrs
+}
+
+// fieldAttrs converts the fields of the *WithFields functions to attributes,
+// sorted by key so entries read the same whatever the map order
+func fieldAttrs(fields map[string]any) []slog.Attr {
+	attrs := make([]slog.Attr, 0, len(fields))
+	for key, value := range fields {
+		attrs = append(attrs, slog.Any(key, value))
+	}
+	slices.SortFunc(attrs, func(a, b slog.Attr) int { return strings.Compare(a.Key, b.Key) })
+	return attrs
+}
@@ -0,0 +1,164 @@
+package observability
+
+import (
+	"bytes"
+	"context"
+	"log/slog"
+	"strconv"
+	"testing"
+
+	"istio-test/internal/tenant"
+	"istio-test/internal/testrun"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/trace"
+	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/ext"
+	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/mocktracer"
+	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/tracer"
+)
+
+// logEntry is an entry kept by a logRecorder
+type logEntry struct {
+	Message string
+	Level   slog.Level
+	Data    map[string]any
+}
+
+// logRecorder is a handler keeping the entries it receives
+type logRecorder struct {
+	Entries []*logEntry
+}
+
+func (r *logRecorder) Enabled(context.Context, slog.Level) bool { return true }
+
+func (r *logRecorder) Handle(_ context.Context, record slog.Record) error {
+	entry := &logEntry{Message: record.Message, Level: record.Level, Data: map[string]any{}}
+	record.Attrs(func(a slog.Attr) bool {
+		entry.Data[a.Key] = a.Value.Any()
+		return true
+	})
+	r.Entries = append(r.Entries, entry)
+	return nil
+}
+
+func (r *logRecorder) WithAttrs([]slog.Attr) slog.Handler { return r }
+
+func (r *logRecorder) WithGroup(string) slog.Handler { return r }
+
+// recordLogs sends entries to a recorder until the test ends
+func recordLogs(t *testing.T) *logRecorder {
+	recorder := &logRecorder{}
+	previous := log
+	SetLogHandler(recorder)
+	t.Cleanup(func() { log = previous })
+	return recorder
+}
+
+// captureLogOutput makes Init write to the returned buffer and restores the
+// logger and level once the test ends
+func captureLogOutput(t *testing.T) *bytes.Buffer {
+	out := &bytes.Buffer{}
+	previousLog, previousOutput, previousLevel := log, logOutput, logLevelVar.Level()
+	logOutput = out
+	t.Cleanup(func() {
+		log, logOutput = previousLog, previousOutput
+		logLevelVar.Set(previousLevel)
+	})
+	return out
+}
+
+func TestParseLevel(t *testing.T) {
+	for name, expected := range map[string]slog.Level{
+		"trace":   LevelTrace,
+		"DEBUG":   slog.LevelDebug,
+		"info":    slog.LevelInfo,
+		"warn":    slog.LevelWarn,
+		"warning": slog.LevelWarn,
+		"error":   slog.LevelError,
+		"fatal":   LevelFatal,
+		"panic":   LevelPanic,
+	} {
+		level, err := ParseLevel(name)
+		require.NoError(t, err, name)
+		assert.Equal(t, expected, level, name)
+	}
+	_, err := ParseLevel("chatty")
+	assert.Error(t, err)
+
+	assert.Equal(t, "warning", levelName(slog.LevelWarn))
+	assert.Equal(t, "INFO+2", levelName(slog.LevelInfo+2))
+}
+
+func TestContextHandlerTestRunAndTenant(t *testing.T) {
+	hook := recordLogs(t)
+
+	ctx := tenant.WithTenant(testrun.WithID(context.Background(), "run-7"), "payments")
+	InfoWithContext(ctx, "tagged message")
+	InfoWithContext(context.Background(), "untagged message")
+
+	require.Len(t, hook.Entries, 2)
+	assert.Equal(t, "run-7", hook.Entries[0].Data["test_run_id"])
+	assert.Equal(t, "payments", hook.Entries[0].Data["tenant"])
+	assert.NotContains(t, hook.Entries[1].Data, "test_run_id")
+	assert.NotContains(t, hook.Entries[1].Data, "tenant")
+}
+
+func TestContextHandlerDatadog(t *testing.T) {
+	mt := mocktracer.Start()
+	defer mt.Stop()
+	hook := recordLogs(t)
+
+	span, ctx := tracer.StartSpanFromContext(context.Background(), "test.operation")
+	defer span.Finish()
+	InfoWithFields(ctx, "traced message", map[string]any{"type": "test"})
+
+	require.Len(t, hook.Entries, 1)
+	assert.NotEmpty(t, hook.Entries[0].Data[ext.LogKeyTraceID])
+	assert.Equal(t, strconv.FormatUint(span.Context().SpanID(), 10), hook.Entries[0].Data[ext.LogKeySpanID])
+}
+
+func TestContextHandlerOTel(t *testing.T) {
+	hook := recordLogs(t)
+
+	traceID, err := trace.TraceIDFromHex("0af7651916cd43dd8448eb211c80319c")
+	require.NoError(t, err)
+	spanID, err := trace.SpanIDFromHex("00f067aa0ba902b7")
+	require.NoError(t, err)
+	ctx := trace.ContextWithSpanContext(context.Background(), trace.NewSpanContext(trace.SpanContextConfig{
+		TraceID:    traceID,
+		SpanID:     spanID,
+		TraceFlags: trace.FlagsSampled,
+	}))
+	InfoWithContext(ctx, "traced message")
+
+	require.Len(t, hook.Entries, 1)
+	if log128BitTraceIDs {
+		assert.Equal(t, "0af7651916cd43dd8448eb211c80319c", hook.Entries[0].Data[ext.LogKeyTraceID])
+	} else {
+		assert.Equal(t, strconv.FormatUint(0x8448eb211c80319c, 10), hook.Entries[0].Data[ext.LogKeyTraceID])
+	}
+	assert.Equal(t, strconv.FormatUint(0x00f067aa0ba902b7, 10), hook.Entries[0].Data[ext.LogKeySpanID])
+}
+
+func TestContextHandlerLevel(t *testing.T) {
+	restoreLogLevel(t)
+	hook := recordLogs(t)
+	require.NoError(t, SetLogLevel("warning", 0))
+
+	InfoWithContext(context.Background(), "dropped")
+	WarnWithContext(context.Background(), "kept")
+	Logger().Debug("dropped too")
+
+	require.Len(t, hook.Entries, 1, "handlers only receive entries at or above the level")
+	assert.Equal(t, "kept", hook.Entries[0].Message)
+}
+
+func TestFieldAttrsSorted(t *testing.T) {
+	attrs := fieldAttrs(map[string]any{"type": "test", "a": 1, "m": "x"})
+	keys := make([]string, 0, len(attrs))
+	for _, attr := range attrs {
+		keys = append(keys, attr.Key)
+	}
+	assert.Equal(t, []string{"a", "m", "type"}, keys)
+}
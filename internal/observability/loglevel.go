@@ -0,0 +1,144 @@
+package observability
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// maxLogLevelRequestBytes bounds the size of a log level change
+const maxLogLevelRequestBytes = 1 << 10
+
+// LogLevelRequest changes the log level, optionally only for a while
+type LogLevelRequest struct {
+	Level string `json:"level" schema:"required"`                // Level name, e.g. "debug"
+	TTL   string `json:"ttl,omitempty" schema:"format=duration"` // Duration after which the previous level is restored, empty keeps the level
+}
+
+// LogLevelResponse reports the log level in effect
+type LogLevelResponse struct {
+	Level     string     `json:"level"`
+	RevertsTo string     `json:"reverts_to,omitempty"` // Level restored at RevertsAt
+	RevertsAt *time.Time `json:"reverts_at,omitempty"`
+}
+
+// levelRevert restores the level set before a temporary change
+var levelRevert struct {
+	mu    sync.Mutex
+	timer *time.Timer
+	level slog.Level
+	at    time.Time
+}
+
+// LogLevel returns the current log level
+func LogLevel() string {
+	return levelName(logLevelVar.Level())
+}
+
+// SetLogLevel changes the log level without a restart. With a positive ttl
+// the level in effect before the first temporary change is restored after
+// ttl; a change without ttl cancels any pending restore.
+func SetLogLevel(level string, ttl time.Duration) error {
+	parsed, err := ParseLevel(level)
+	if err != nil {
+		return err
+	}
+
+	levelRevert.mu.Lock()
+	defer levelRevert.mu.Unlock()
+
+	previous := logLevelVar.Level()
+	if levelRevert.timer != nil {
+		levelRevert.timer.Stop()
+		// Extending a temporary change keeps restoring the original level
+		previous = levelRevert.level
+		levelRevert.timer = nil
+	}
+	logLevelVar.Set(parsed)
+
+	if ttl > 0 {
+		levelRevert.level, levelRevert.at = previous, time.Now().Add(ttl)
+		var timer *time.Timer
+		timer = time.AfterFunc(ttl, func() {
+			levelRevert.mu.Lock()
+			defer levelRevert.mu.Unlock()
+			if levelRevert.timer != timer {
+				return
+			}
+			levelRevert.timer = nil
+			logLevelVar.Set(previous)
+			WarnWithFields(context.Background(), "Log level restored to "+levelName(previous), map[string]any{
+				"type":  "log_level_change",
+				"level": levelName(previous),
+			})
+		})
+		levelRevert.timer = timer
+	}
+	return nil
+}
+
+// logLevelStatus reports the current level and any pending restore
+func logLevelStatus() LogLevelResponse {
+	levelRevert.mu.Lock()
+	defer levelRevert.mu.Unlock()
+
+	response := LogLevelResponse{Level: LogLevel()}
+	if levelRevert.timer != nil {
+		at := levelRevert.at.UTC()
+		response.RevertsTo, response.RevertsAt = levelName(levelRevert.level), &at
+	}
+	return response
+}
+
+// LogLevelHandler reports (GET) or changes (PUT) the log level
+func LogLevelHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodPut {
+		var request LogLevelRequest
+		if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxLogLevelRequestBytes)).Decode(&request); err != nil {
+			var maxBytesErr *http.MaxBytesError
+			if errors.As(err, &maxBytesErr) {
+				http.Error(w, fmt.Sprintf("Request exceeds %d bytes", maxLogLevelRequestBytes), http.StatusRequestEntityTooLarge)
+				return
+			}
+			http.Error(w, fmt.Sprintf("Invalid request: %v", err), http.StatusBadRequest)
+			return
+		}
+		var ttl time.Duration
+		if request.TTL != "" {
+			parsed, err := time.ParseDuration(request.TTL)
+			if err != nil || parsed <= 0 {
+				http.Error(w, fmt.Sprintf("Invalid ttl '%s': must be a positive duration", request.TTL), http.StatusBadRequest)
+				return
+			}
+			ttl = parsed
+		}
+
+		previous := LogLevel()
+		if err := SetLogLevel(request.Level, ttl); err != nil {
+			http.Error(w, fmt.Sprintf("Invalid level '%s'", request.Level), http.StatusBadRequest)
+			return
+		}
+		// Logged at warning so the change is recorded whatever the new level
+		WarnWithFields(r.Context(), fmt.Sprintf("Log level changed from %s to %s", previous, LogLevel()), map[string]any{
+			"type":      "log_level_change",
+			"level":     LogLevel(),
+			"previous":  previous,
+			"ttl":       request.TTL,
+			"client_ip": ClientIP(r),
+		})
+	}
+
+	jsonData, err := json.Marshal(logLevelStatus())
+	if err != nil {
+		http.Error(w, "Failed to encode log level", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write(jsonData)
+}
@@ -0,0 +1,81 @@
+package observability
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// restoreLogLevel resets the level and cancels pending restores after the test
+func restoreLogLevel(t *testing.T) {
+	level := LogLevel()
+	t.Cleanup(func() {
+		require.NoError(t, SetLogLevel(level, 0))
+	})
+}
+
+func TestSetLogLevel(t *testing.T) {
+	restoreLogLevel(t)
+	require.NoError(t, SetLogLevel("info", 0))
+
+	require.NoError(t, SetLogLevel("debug", 0))
+	assert.Equal(t, "debug", LogLevel())
+	assert.True(t, log.Enabled(context.Background(), slog.LevelDebug))
+
+	assert.Error(t, SetLogLevel("chatty", 0))
+	assert.Equal(t, "debug", LogLevel())
+}
+
+func TestSetLogLevelTTL(t *testing.T) {
+	restoreLogLevel(t)
+	require.NoError(t, SetLogLevel("warning", 0))
+
+	require.NoError(t, SetLogLevel("debug", 20*time.Millisecond))
+	status := logLevelStatus()
+	assert.Equal(t, "debug", status.Level)
+	assert.Equal(t, "warning", status.RevertsTo)
+	require.NotNil(t, status.RevertsAt)
+
+	// Extending the change still restores the original level
+	require.NoError(t, SetLogLevel("trace", 20*time.Millisecond))
+	assert.Equal(t, "warning", logLevelStatus().RevertsTo)
+
+	assert.Eventually(t, func() bool { return LogLevel() == "warning" }, time.Second, 5*time.Millisecond)
+	assert.Nil(t, logLevelStatus().RevertsAt)
+}
+
+func TestLogLevelHandler(t *testing.T) {
+	restoreLogLevel(t)
+	require.NoError(t, SetLogLevel("info", 0))
+
+	serve := func(method, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		LogLevelHandler(w, httptest.NewRequest(method, "/admin/loglevel", strings.NewReader(body)))
+		return w
+	}
+
+	w := serve(http.MethodPut, `{"level": "debug", "ttl": "10m"}`)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var response LogLevelResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	assert.Equal(t, "debug", response.Level)
+	assert.Equal(t, "info", response.RevertsTo)
+
+	w = serve(http.MethodGet, "")
+	require.Equal(t, http.StatusOK, w.Code)
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	assert.Equal(t, "debug", response.Level)
+
+	assert.Equal(t, http.StatusBadRequest, serve(http.MethodPut, `{"level": "chatty"}`).Code)
+	assert.Equal(t, http.StatusBadRequest, serve(http.MethodPut, `{"level": "info", "ttl": "-1m"}`).Code)
+	assert.Equal(t, http.StatusBadRequest, serve(http.MethodPut, `level=info`).Code)
+	assert.Equal(t, "debug", LogLevel(), "invalid requests change nothing")
+}
@@ -0,0 +1,181 @@
+package observability
+
+import (
+	"context"
+	"io"
+	"sync"
+	"sync/atomic"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	logEntriesDropped = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "log_entries_dropped_total",
+		Help:      "Total number of log entries dropped because the log buffer was full.",
+	})
+
+	logWriteErrors = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "log_write_errors_total",
+		Help:      "Total number of buffered log entries that failed to be written.",
+	})
+
+	logBufferEntries = prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+		Namespace: metricsNamespace,
+		Name:      "log_buffer_entries",
+		Help:      "Number of log entries waiting in the log buffer.",
+	}, func() float64 {
+		if w := asyncLogWriter.Load(); w != nil {
+			return float64(len(w.entries))
+		}
+		return 0
+	})
+)
+
+// asyncLogWriter is the buffered writer installed by Init, if any
+var asyncLogWriter atomic.Pointer[AsyncWriter]
+
+func init() {
+	metricsRegistry.MustRegister(logEntriesDropped, logWriteErrors, logBufferEntries)
+}
+
+// LogWriterStats reports the state of an AsyncWriter
+type LogWriterStats struct {
+	Capacity int
+	Buffered int
+	Written  uint64
+	Dropped  uint64
+	Errors   uint64
+}
+
+// AsyncWriter writes log entries to an underlying writer from a background
+// goroutine, so request handlers never wait on a slow stdout. When the buffer
+// is full the oldest entry is dropped: under extreme load recent entries are
+// the most useful, and latency must not depend on the log consumer.
+type AsyncWriter struct {
+	out     io.Writer
+	entries chan []byte
+
+	// mu is held for reading while enqueuing; Close takes it for writing so no
+	// entry is enqueued after the flusher drained the buffer
+	mu     sync.RWMutex
+	closed bool
+	stop   chan struct{}
+	done   chan struct{}
+
+	written atomic.Uint64
+	dropped atomic.Uint64
+	errors  atomic.Uint64
+}
+
+// NewAsyncWriter returns a writer buffering up to size entries for out
+func NewAsyncWriter(out io.Writer, size int) *AsyncWriter {
+	w := &AsyncWriter{
+		out:     out,
+		entries: make(chan []byte, size),
+		stop:    make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+	go w.flush()
+	return w
+}
+
+// Write buffers a copy of p, which holds one formatted entry. Once the writer
+// is closed entries are written synchronously.
+func (w *AsyncWriter) Write(p []byte) (int, error) {
+	w.mu.RLock()
+	if w.closed {
+		w.mu.RUnlock()
+		return w.out.Write(p)
+	}
+	defer w.mu.RUnlock()
+
+	entry := make([]byte, len(p))
+	copy(entry, p)
+	for {
+		select {
+		case w.entries <- entry:
+			return len(p), nil
+		default:
+		}
+		// Make room by dropping the oldest entry; another writer or the
+		// flusher may have done so already
+		select {
+		case <-w.entries:
+			w.dropped.Add(1)
+			logEntriesDropped.Inc()
+		default:
+		}
+	}
+}
+
+// flush writes buffered entries until the writer is closed, then drains the buffer
+func (w *AsyncWriter) flush() {
+	defer close(w.done)
+	for {
+		select {
+		case entry := <-w.entries:
+			w.writeEntry(entry)
+		case <-w.stop:
+			for {
+				select {
+				case entry := <-w.entries:
+					w.writeEntry(entry)
+				default:
+					return
+				}
+			}
+		}
+	}
+}
+
+func (w *AsyncWriter) writeEntry(entry []byte) {
+	if _, err := w.out.Write(entry); err != nil {
+		w.errors.Add(1)
+		logWriteErrors.Inc()
+		return
+	}
+	w.written.Add(1)
+}
+
+// Close stops buffering and waits until the buffered entries are written or
+// ctx is done
+func (w *AsyncWriter) Close(ctx context.Context) error {
+	w.mu.Lock()
+	if !w.closed {
+		w.closed = true
+		close(w.stop)
+	}
+	w.mu.Unlock()
+
+	select {
+	case <-w.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Stats reports the buffer usage and entry counters of the writer
+func (w *AsyncWriter) Stats() LogWriterStats {
+	return LogWriterStats{
+		Capacity: cap(w.entries),
+		Buffered: len(w.entries),
+		Written:  w.written.Load(),
+		Dropped:  w.dropped.Load(),
+		Errors:   w.errors.Load(),
+	}
+}
+
+// FlushLogs writes the entries buffered by the asynchronous log writer and
+// switches logging back to synchronous writes; it does nothing when log
+// buffering is disabled
+func FlushLogs(ctx context.Context) error {
+	w := asyncLogWriter.Load()
+	if w == nil {
+		return nil
+	}
+	return w.Close(ctx)
+}
@@ -0,0 +1,111 @@
+package observability
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// blockingWriter records entries once released
+type blockingWriter struct {
+	mu      sync.Mutex
+	buf     bytes.Buffer
+	release chan struct{}
+	err     error
+}
+
+func (w *blockingWriter) Write(p []byte) (int, error) {
+	<-w.release
+	if w.err != nil {
+		return 0, w.err
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.buf.Write(p)
+}
+
+func (w *blockingWriter) String() string {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.buf.String()
+}
+
+func TestAsyncWriter(t *testing.T) {
+	out := &blockingWriter{release: make(chan struct{})}
+	close(out.release)
+	w := NewAsyncWriter(out, 16)
+
+	for i := range 5 {
+		_, err := fmt.Fprintf(w, "entry %d\n", i)
+		require.NoError(t, err)
+	}
+	require.NoError(t, w.Close(context.Background()))
+
+	assert.Equal(t, "entry 0\nentry 1\nentry 2\nentry 3\nentry 4\n", out.String())
+	stats := w.Stats()
+	assert.Equal(t, uint64(5), stats.Written)
+	assert.Zero(t, stats.Dropped)
+	assert.Equal(t, 16, stats.Capacity)
+
+	// Entries are written synchronously once closed
+	_, err := w.Write([]byte("late\n"))
+	require.NoError(t, err)
+	assert.Contains(t, out.String(), "late\n")
+}
+
+func TestAsyncWriterDropsOldest(t *testing.T) {
+	out := &blockingWriter{release: make(chan struct{})}
+	w := NewAsyncWriter(out, 2)
+
+	// The flusher takes the first entry and blocks writing it
+	_, _ = w.Write([]byte("first\n"))
+	require.Eventually(t, func() bool { return w.Stats().Buffered == 0 }, time.Second, time.Millisecond)
+
+	start := time.Now()
+	for i := range 5 {
+		_, err := fmt.Fprintf(w, "entry %d\n", i)
+		require.NoError(t, err)
+	}
+	assert.Less(t, time.Since(start), 500*time.Millisecond, "writes never wait on the output")
+	assert.Equal(t, uint64(3), w.Stats().Dropped)
+
+	close(out.release)
+	require.NoError(t, w.Close(context.Background()))
+	assert.Equal(t, "first\nentry 3\nentry 4\n", out.String())
+}
+
+func TestAsyncWriterCloseTimeout(t *testing.T) {
+	out := &blockingWriter{release: make(chan struct{})}
+	w := NewAsyncWriter(out, 4)
+	_, _ = w.Write([]byte("stuck\n"))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	assert.ErrorIs(t, w.Close(ctx), context.DeadlineExceeded)
+
+	close(out.release)
+	require.NoError(t, w.Close(context.Background()))
+}
+
+func TestAsyncWriterErrors(t *testing.T) {
+	out := &blockingWriter{release: make(chan struct{}), err: errors.New("broken pipe")}
+	close(out.release)
+	w := NewAsyncWriter(out, 4)
+
+	_, err := w.Write([]byte("lost\n"))
+	require.NoError(t, err)
+	require.NoError(t, w.Close(context.Background()))
+	assert.Equal(t, uint64(1), w.Stats().Errors)
+	assert.Zero(t, w.Stats().Written)
+}
+
+func TestFlushLogsWithoutBuffer(t *testing.T) {
+	assert.NoError(t, FlushLogs(context.Background()))
+}
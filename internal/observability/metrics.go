@@ -0,0 +1,223 @@
+package observability
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"istio-test/internal/tenant"
+	"istio-test/internal/testrun"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// metricsNamespace prefixes every metric exposed by the application
+const metricsNamespace = "istio_test"
+
+var (
+	metricsRegistry = prometheus.NewRegistry()
+
+	httpRequestsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "http_requests_total",
+		Help:      "Total number of HTTP requests served.",
+	}, []string{"path", "method", "status_class", "test_run"})
+
+	httpRequestDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: metricsNamespace,
+		Name:      "http_request_duration_seconds",
+		Help:      "Duration of HTTP requests in seconds.",
+		Buckets:   []float64{.001, .0025, .005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10},
+	}, []string{"path", "method", "status_class", "test_run"})
+
+	httpTenantRequestsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "http_tenant_requests_total",
+		Help:      "Total number of HTTP requests served by tenant.",
+	}, []string{"tenant", "status_class"})
+
+	httpRequestsInFlight = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: metricsNamespace,
+		Name:      "http_requests_in_flight",
+		Help:      "Number of HTTP requests currently being served.",
+	}, []string{"path", "method"})
+
+	httpRequestHeaderBytes = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: metricsNamespace,
+		Name:      "http_request_header_bytes",
+		Help:      "Size of the request headers in bytes.",
+		Buckets:   prometheus.ExponentialBuckets(256, 2, 10), // 256 B to 128 KiB
+	}, []string{"path"})
+
+	httpRequestHeaderCount = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: metricsNamespace,
+		Name:      "http_request_header_count",
+		Help:      "Number of request header fields.",
+		Buckets:   []float64{5, 10, 20, 30, 50, 75, 100, 150, 200},
+	}, []string{"path"})
+
+	httpRequestHeadersOverThreshold = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "http_request_headers_over_threshold_total",
+		Help:      "Total number of requests whose headers exceeded a configured threshold.",
+	}, []string{"path", "threshold"})
+)
+
+func init() {
+	metricsRegistry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		httpRequestsTotal,
+		httpRequestDuration,
+		httpTenantRequestsTotal,
+		httpRequestsInFlight,
+		httpRequestHeaderBytes,
+		httpRequestHeaderCount,
+		httpRequestHeadersOverThreshold,
+	)
+
+	// Drop the series of expired test runs so their label slots can be reused
+	testrun.OnLabelExpired(func(id string) {
+		labels := prometheus.Labels{"test_run": id}
+		httpRequestsTotal.DeletePartialMatch(labels)
+		httpRequestDuration.DeletePartialMatch(labels)
+	})
+}
+
+// MetricsRegistry returns the registry served by MetricsHandler, so other
+// packages can register their own collectors
+func MetricsRegistry() *prometheus.Registry {
+	return metricsRegistry
+}
+
+// StatusClass returns the status_class label value of an HTTP status code, so
+// other packages label their metrics the same way
+func StatusClass(statusCode int) string {
+	return getStatusClass(statusCode)
+}
+
+// MetricsHandler serves the registered metrics in the Prometheus exposition format
+func MetricsHandler() http.Handler {
+	return promhttp.HandlerFor(metricsRegistry, promhttp.HandlerOpts{})
+}
+
+// MetricsMiddleware records request count, duration and in-flight requests.
+// Count and duration are also labeled with the test run ID of the request.
+// Requests the client disconnected from are labeled with the
+// client_disconnect status class rather than the status the handler wrote.
+// pathLabel maps a request to its path label and should return the matched
+// route pattern rather than the raw path to keep label cardinality bounded;
+// nil uses the raw path.
+func MetricsMiddleware(next http.Handler, pathLabel func(r *http.Request) string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path := r.URL.Path
+		if pathLabel != nil {
+			path = pathLabel(r)
+		}
+
+		inFlight := httpRequestsInFlight.WithLabelValues(path, r.Method)
+		inFlight.Inc()
+		defer inFlight.Dec()
+
+		start := time.Now()
+		wrapper := newResponseWrapper(w)
+		next.ServeHTTP(wrapper, r)
+
+		statusClass := getStatusClass(wrapper.statusCode)
+		if ClientDisconnected(r) {
+			statusClass = statusClassClientDisconnect
+		}
+		testRun := testrun.MetricLabel(testrun.FromContext(r.Context()))
+		httpRequestsTotal.WithLabelValues(path, r.Method, statusClass, testRun).Inc()
+		httpRequestDuration.WithLabelValues(path, r.Method, statusClass, testRun).Observe(time.Since(start).Seconds())
+		httpTenantRequestsTotal.WithLabelValues(tenant.MetricLabel(tenant.FromContext(r.Context())), statusClass).Inc()
+	})
+}
+
+// HeaderThresholds flags requests with unusually large headers; zero disables a threshold
+type HeaderThresholds struct {
+	Bytes int // Total header size in bytes
+	Count int // Number of header fields
+}
+
+// headerSize returns the size of the request headers as sent in HTTP/1.1,
+// "Name: value\r\n" per field including Host, and the number of fields
+func headerSize(r *http.Request) (int, int) {
+	size, count := 0, 0
+	if r.Host != "" {
+		size += len("Host: \r\n") + len(r.Host)
+		count++
+	}
+	for name, values := range r.Header {
+		for _, value := range values {
+			size += len(name) + len(": \r\n") + len(value)
+			count++
+		}
+	}
+	return size, count
+}
+
+// largestHeaders returns the names and sizes of the n largest header fields
+func largestHeaders(r *http.Request, n int) string {
+	type field struct {
+		name string
+		size int
+	}
+	fields := make([]field, 0, len(r.Header))
+	for name, values := range r.Header {
+		size := 0
+		for _, value := range values {
+			size += len(name) + len(value)
+		}
+		fields = append(fields, field{name, size})
+	}
+	sort.Slice(fields, func(i, j int) bool { return fields[i].size > fields[j].size })
+
+	parts := make([]string, 0, n)
+	for _, f := range fields[:min(n, len(fields))] {
+		parts = append(parts, fmt.Sprintf("%s=%d", f.name, f.size))
+	}
+	return strings.Join(parts, ",")
+}
+
+// HeaderMetricsMiddleware records the size and number of request headers and
+// counts and logs requests exceeding thresholds, which gives origin-side
+// visibility into requests approaching proxy header limits. pathLabel is used
+// as in MetricsMiddleware. Header values are never logged, only names and sizes.
+func HeaderMetricsMiddleware(next http.Handler, pathLabel func(r *http.Request) string, thresholds HeaderThresholds) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path := r.URL.Path
+		if pathLabel != nil {
+			path = pathLabel(r)
+		}
+
+		size, count := headerSize(r)
+		httpRequestHeaderBytes.WithLabelValues(path).Observe(float64(size))
+		httpRequestHeaderCount.WithLabelValues(path).Observe(float64(count))
+
+		overBytes := thresholds.Bytes > 0 && size > thresholds.Bytes
+		overCount := thresholds.Count > 0 && count > thresholds.Count
+		if overBytes {
+			httpRequestHeadersOverThreshold.WithLabelValues(path, "bytes").Inc()
+		}
+		if overCount {
+			httpRequestHeadersOverThreshold.WithLabelValues(path, "count").Inc()
+		}
+		if overBytes || overCount {
+			WarnWithFields(r.Context(), fmt.Sprintf("Request headers over threshold: %d bytes in %d fields", size, count), map[string]any{
+				"type":            "header_threshold",
+				"path":            path,
+				"header_bytes":    size,
+				"header_count":    count,
+				"largest_headers": largestHeaders(r, 5),
+				"request_id":      getRequestID(r),
+			})
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,118 @@
+package observability
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"istio-test/internal/tenant"
+	"istio-test/internal/testrun"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMetricsMiddleware(t *testing.T) {
+	handler := MetricsMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, 1.0, testutil.ToFloat64(httpRequestsInFlight.WithLabelValues("/metrics-test/{id}", r.Method)))
+		if r.URL.Path == "/metrics-test/missing" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Write([]byte("ok"))
+	}), func(r *http.Request) string {
+		return "/metrics-test/{id}"
+	})
+
+	for _, path := range []string{"/metrics-test/a", "/metrics-test/b", "/metrics-test/missing"} {
+		handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", path, nil))
+	}
+	req := httptest.NewRequest("GET", "/metrics-test/c", nil)
+	handler.ServeHTTP(httptest.NewRecorder(), req.WithContext(testrun.WithID(req.Context(), "metrics-run")))
+
+	assert.Equal(t, 2.0, testutil.ToFloat64(httpRequestsTotal.WithLabelValues("/metrics-test/{id}", "GET", "success", "none")))
+	assert.Equal(t, 1.0, testutil.ToFloat64(httpRequestsTotal.WithLabelValues("/metrics-test/{id}", "GET", "client_error", "none")))
+	assert.Equal(t, 1.0, testutil.ToFloat64(httpRequestsTotal.WithLabelValues("/metrics-test/{id}", "GET", "success", "metrics-run")))
+	assert.Equal(t, 0.0, testutil.ToFloat64(httpRequestsInFlight.WithLabelValues("/metrics-test/{id}", "GET")))
+	assert.Equal(t, 3, testutil.CollectAndCount(httpRequestDuration, "istio_test_http_request_duration_seconds"))
+}
+
+func TestMetricsMiddlewareTenant(t *testing.T) {
+	handler := MetricsMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	}), nil)
+
+	before := testutil.ToFloat64(httpTenantRequestsTotal.WithLabelValues("metrics-tenant", "success"))
+	req := httptest.NewRequest("GET", "/tenant-test", nil)
+	handler.ServeHTTP(httptest.NewRecorder(), req.WithContext(tenant.WithTenant(req.Context(), "metrics-tenant")))
+
+	assert.Equal(t, before+1, testutil.ToFloat64(httpTenantRequestsTotal.WithLabelValues("metrics-tenant", "success")))
+}
+
+func TestMetricsMiddlewareClientDisconnect(t *testing.T) {
+	handler := MetricsMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}), nil)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/disconnect-test", nil).WithContext(ctx))
+
+	assert.Equal(t, 1.0, testutil.ToFloat64(httpRequestsTotal.WithLabelValues("/disconnect-test", "GET", "client_disconnect", "none")))
+	assert.Equal(t, 0.0, testutil.ToFloat64(httpRequestsTotal.WithLabelValues("/disconnect-test", "GET", "server_error", "none")))
+}
+
+func TestMetricsHandler(t *testing.T) {
+	MetricsMiddleware(http.NotFoundHandler(), nil).ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/raw-path", nil))
+
+	w := httptest.NewRecorder()
+	MetricsHandler().ServeHTTP(w, httptest.NewRequest("GET", "/metrics", nil))
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	body := w.Body.String()
+	assert.Contains(t, body, `istio_test_http_requests_total{method="GET",path="/raw-path",status_class="client_error",test_run="none"} 1`)
+	assert.Contains(t, body, "istio_test_http_request_duration_seconds_bucket")
+	assert.Contains(t, body, "go_goroutines")
+}
+
+func TestHeaderMetricsMiddleware(t *testing.T) {
+	hook := recordLogs(t)
+
+	served := 0
+	handler := HeaderMetricsMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		served++
+	}), func(r *http.Request) string {
+		return "/header-test"
+	}, HeaderThresholds{Bytes: 1024, Count: 10})
+
+	// Host plus two fields
+	req := httptest.NewRequest("GET", "http://example.com/header-test", nil)
+	req.Header.Set("Accept", "*/*")
+	req.Header.Set("X-Small", "1")
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+
+	size, count := headerSize(req)
+	assert.Equal(t, 3, count)
+	assert.Equal(t, len("Host: example.com\r\nAccept: */*\r\nX-Small: 1\r\n"), size)
+	assert.Empty(t, hook.Entries)
+
+	req = httptest.NewRequest("GET", "/header-test", nil)
+	req.Header.Set("Cookie", strings.Repeat("a", 2048))
+	for i := 0; i < 10; i++ {
+		req.Header.Set(fmt.Sprintf("X-Extra-%d", i), "1")
+	}
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+
+	assert.Equal(t, 2, served)
+	assert.Equal(t, 1, testutil.CollectAndCount(httpRequestHeaderBytes, "istio_test_http_request_header_bytes"))
+	assert.Equal(t, 1.0, testutil.ToFloat64(httpRequestHeadersOverThreshold.WithLabelValues("/header-test", "bytes")))
+	assert.Equal(t, 1.0, testutil.ToFloat64(httpRequestHeadersOverThreshold.WithLabelValues("/header-test", "count")))
+
+	require.Len(t, hook.Entries, 1)
+	assert.True(t, strings.HasPrefix(hook.Entries[0].Data["largest_headers"].(string), "Cookie=2054"))
+	assert.NotContains(t, hook.Entries[0].Message, "aaaa")
+}
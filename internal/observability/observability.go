@@ -3,71 +3,186 @@ package observability
 import (
 	"bufio"
 	"context"
+	"crypto/hmac"
+	cryptorand "crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
 	"fmt"
+	"io"
+	"log/slog"
+	"math"
+	"math/rand/v2"
 	"net"
 	"net/http"
 	"net/url"
 	"os"
+	"slices"
 	"strings"
+	"sync/atomic"
 	"time"
-
-	"github.com/sirupsen/logrus"
-
-	dd_logrus "gopkg.in/DataDog/dd-trace-go.v1/contrib/sirupsen/logrus"
 )
 
-var log = logrus.New()
-
 // Config holds observability configuration
 type Config struct {
 	EnablePIIRedaction bool
+	LogFormat          string // "json" or "text", empty writes JSON
+	LogBufferSize      int    // Entries buffered by an asynchronous writer, zero writes synchronously
+	RecentRequests     int    // Completed requests kept for RecentRequests, zero keeps none
+
+	// Path prefixes whose successful requests are not logged, such as kubelet
+	// and sidecar health probes; slow and failed requests are still logged
+	LogExcludePaths []string
+
+	// PII redaction rules, applied when EnablePIIRedaction is set
+	RedactAllowedParams      []string // Query parameters logged as they are, nil allows DefaultRedactAllowedParams
+	RedactIPMode             string   // IPRedactionNone, IPRedactionTruncate or IPRedactionHash; empty truncates
+	RedactUserAgentMaxLength int      // Longer user agents are truncated, zero uses DefaultRedactUserAgentMaxLength
 }
 
+// Client IP redaction modes
+const (
+	IPRedactionNone     = "none"     // Logged as they are
+	IPRedactionTruncate = "truncate" // IPv4 keeps its first octet, e.g. 10.0.0.0; other addresses are replaced
+	IPRedactionHash     = "hash"     // Replaced with a keyed hash, so requests of a client can be correlated within a pod
+)
+
+// IPRedactionModes lists the client IP redaction modes
+var IPRedactionModes = []string{IPRedactionNone, IPRedactionTruncate, IPRedactionHash}
+
+// Redaction defaults used when Config leaves the rules unset
+var (
+	DefaultRedactAllowedParams      = []string{"page", "limit"}
+	DefaultRedactUserAgentMaxLength = 100
+)
+
+// ipHashKey keys the client IP hashes. It is random per process: IPv4
+// addresses are few enough that an unkeyed hash is easily reversed.
+var ipHashKey = func() []byte {
+	key := make([]byte, 32)
+	_, _ = cryptorand.Read(key)
+	return key
+}()
+
 // config holds the current observability configuration
 var config Config
 
-func Init(logLevel string, cfg Config) {
-	log.SetFormatter(&logrus.JSONFormatter{})
-	log.Info("Logrus set to JSON formatter")
+// Request logging settings that can be tuned while serving
+var (
+	slowRequestThreshold atomic.Int64  // Nanoseconds after which a request is logged as a warning
+	requestLogSampleRate atomic.Uint64 // Bits of the float64 share of successful requests logged
+)
 
-	// Output to stdout instead of the default stderr
-	log.SetOutput(os.Stdout)
-	log.Info("Logrus set to output to stdout")
+func init() {
+	slowRequestThreshold.Store(int64(time.Second))
+	requestLogSampleRate.Store(math.Float64bits(1))
+}
 
-	// Parse the provided log level, fallback to environment variable if empty, then to InfoLevel
-	var level logrus.Level
-	var err error
+// SlowRequestThreshold returns the duration after which requests are logged as warnings
+func SlowRequestThreshold() time.Duration {
+	return time.Duration(slowRequestThreshold.Load())
+}
 
-	if logLevel != "" {
-		level, err = logrus.ParseLevel(logLevel)
-	} else {
-		// Fallback to environment variable for backward compatibility
-		level, err = logrus.ParseLevel(os.Getenv("LOG_LEVEL"))
+// SetSlowRequestThreshold sets the duration after which requests are logged as warnings
+func SetSlowRequestThreshold(threshold time.Duration) {
+	slowRequestThreshold.Store(int64(threshold))
+}
+
+// RequestLogSampleRate returns the share (0-1) of successful requests that are logged
+func RequestLogSampleRate() float64 {
+	return math.Float64frombits(requestLogSampleRate.Load())
+}
+
+// SetRequestLogSampleRate sets the share (0-1) of successful requests that are
+// logged; slow and failed requests are always logged
+func SetRequestLogSampleRate(rate float64) {
+	requestLogSampleRate.Store(math.Float64bits(rate))
+}
+
+// sampleRequestLog decides whether the successful request logs of a request
+// to path are written
+func sampleRequestLog(path string) bool {
+	for _, prefix := range config.LogExcludePaths {
+		if strings.HasPrefix(path, prefix) {
+			return false
+		}
 	}
+	rate := RequestLogSampleRate()
+	return rate >= 1 || rand.Float64() < rate
+}
 
-	if err != nil {
-		level = logrus.InfoLevel
+// Init configures logging: entries at or above logLevel, falling back to the
+// LOG_LEVEL environment variable and then info, are written to stdout in
+// cfg.LogFormat
+func Init(logLevel string, cfg Config) {
+	format := cfg.LogFormat
+	if format != LogFormatText {
+		format = LogFormatJSON
 	}
 
-	log.SetLevel(level)
+	// Output to stdout, through a buffer when one is configured
+	var out io.Writer = logOutput
+	if cfg.LogBufferSize > 0 {
+		w := NewAsyncWriter(logOutput, cfg.LogBufferSize)
+		asyncLogWriter.Store(w)
+		out = w
+	}
+
+	// Parse the provided log level, fallback to environment variable if empty, then to info
+	if logLevel == "" {
+		// Fallback to environment variable for backward compatibility
+		logLevel = os.Getenv("LOG_LEVEL")
+	}
+	level, err := ParseLevel(logLevel)
+	if err != nil {
+		level = slog.LevelInfo
+	}
+	SetLogHandler(newLogHandler(format, out))
+	logLevelVar.Set(level)
 
 	// Store configuration
 	config = cfg
+	if cfg.RecentRequests > 0 {
+		recentRequests.Store(newRequestRing(cfg.RecentRequests))
+	}
 
-	// Add Datadog context log hook
-	log.AddHook(&dd_logrus.DDContextLogHook{})
+	if cfg.LogBufferSize > 0 {
+		log.Info(fmt.Sprintf("Logging %s to stdout through a %d entry buffer", format, cfg.LogBufferSize))
+	} else {
+		log.Info(fmt.Sprintf("Logging %s to stdout", format))
+	}
 }
 
 func InfoWithContext(ctx context.Context, msg string) {
-	log.WithContext(ctx).Info(msg)
+	log.InfoContext(ctx, msg)
 }
 
 func ErrorWithContext(ctx context.Context, msg string) {
-	log.WithContext(ctx).Error(msg)
+	log.ErrorContext(ctx, msg)
 }
 
 func WarnWithContext(ctx context.Context, msg string) {
-	log.WithContext(ctx).Warn(msg)
+	log.WarnContext(ctx, msg)
+}
+
+// InfoWithFields logs an info message carrying structured fields
+func InfoWithFields(ctx context.Context, msg string, fields map[string]any) {
+	log.LogAttrs(ctx, slog.LevelInfo, msg, fieldAttrs(fields)...)
+}
+
+// WarnWithFields logs a warning carrying structured fields
+func WarnWithFields(ctx context.Context, msg string, fields map[string]any) {
+	log.LogAttrs(ctx, slog.LevelWarn, msg, fieldAttrs(fields)...)
+}
+
+// ErrorWithFields logs an error carrying structured fields
+func ErrorWithFields(ctx context.Context, msg string, fields map[string]any) {
+	log.LogAttrs(ctx, slog.LevelError, msg, fieldAttrs(fields)...)
+}
+
+// Milliseconds converts d to the fractional milliseconds of *_ms log fields
+func Milliseconds(d time.Duration) float64 {
+	return float64(d.Nanoseconds()) / 1000000.0
 }
 
 // responseWrapper wraps http.ResponseWriter to capture response status and size
@@ -117,6 +232,12 @@ func (rw *responseWrapper) Flush() {
 	// No-op if flushing is not supported
 }
 
+// Unwrap returns the underlying ResponseWriter, so http.ResponseController
+// can reach the connection, e.g. to extend the write deadline of a stream
+func (rw *responseWrapper) Unwrap() http.ResponseWriter {
+	return rw.ResponseWriter
+}
+
 // Push implements the http.Pusher interface if the underlying ResponseWriter supports it
 func (rw *responseWrapper) Push(target string, opts *http.PushOptions) error {
 	pusher, ok := rw.ResponseWriter.(http.Pusher)
@@ -137,17 +258,26 @@ func RequestLoggingMiddleware(next http.Handler) http.Handler {
 		// Extract client info with PII redaction
 		sanitizedQuery, sanitizedClientIP, sanitizedUserAgent := redactRequestFields(r, config)
 
-		// Log incoming request
-		log.WithContext(r.Context()).WithFields(logrus.Fields{
-			"type":           "request_start",
-			"method":         r.Method,
-			"path":           r.URL.Path,
-			"query":          sanitizedQuery,
-			"client_ip":      sanitizedClientIP,
-			"user_agent":     sanitizedUserAgent,
-			"request_id":     getRequestID(r),
-			"content_length": r.ContentLength,
-		}).Info("HTTP request started")
+		// Log incoming request; slow and failed requests are logged on completion regardless
+		sampled := sampleRequestLog(r.URL.Path)
+		if sampled {
+			log.LogAttrs(r.Context(), slog.LevelInfo, "HTTP request started",
+				slog.String("type", "request_start"),
+				slog.String("method", r.Method),
+				slog.String("path", r.URL.Path),
+				slog.String("query", sanitizedQuery),
+				slog.String("client_ip", sanitizedClientIP),
+				slog.String("user_agent", sanitizedUserAgent),
+				slog.String("request_id", getRequestID(r)),
+				slog.Int64("content_length", r.ContentLength),
+			)
+		}
+
+		// Collect the cost measured by CostMiddleware
+		var cost *requestCost
+		if costAccounting.Load() {
+			r, cost = withRequestCost(r)
+		}
 
 		// Process request
 		next.ServeHTTP(wrapper, r)
@@ -157,33 +287,59 @@ func RequestLoggingMiddleware(next http.Handler) http.Handler {
 
 		// Determine log level based on status code and duration
 		logLevel := determineLogLevel(wrapper.statusCode, duration)
-
-		// Log response
-		logEntry := log.WithContext(r.Context()).WithFields(logrus.Fields{
-			"type":          "request_complete",
-			"method":        r.Method,
-			"path":          r.URL.Path,
-			"query":         sanitizedQuery,
-			"status":        wrapper.statusCode,
-			"status_class":  getStatusClass(wrapper.statusCode),
-			"duration_ms":   float64(duration.Nanoseconds()) / 1000000.0,
-			"response_size": wrapper.size,
-			"client_ip":     sanitizedClientIP,
-			"user_agent":    sanitizedUserAgent,
-			"request_id":    getRequestID(r),
-		})
-
+		logType, statusClass := "request_complete", getStatusClass(wrapper.statusCode)
 		message := fmt.Sprintf("HTTP %s %s - %d - %v - %s",
 			r.Method, r.URL.Path, wrapper.statusCode, duration, sanitizedClientIP)
 
-		switch logLevel {
-		case logrus.ErrorLevel:
-			logEntry.Error(message)
-		case logrus.WarnLevel:
-			logEntry.Warn(message)
-		default:
-			logEntry.Info(message)
+		if ring := recentRequests.Load(); ring != nil {
+			ring.add(RequestRecord{
+				Time:         start.UTC(),
+				Method:       r.Method,
+				Path:         r.URL.Path,
+				Query:        sanitizedQuery,
+				Status:       wrapper.statusCode,
+				DurationMs:   Milliseconds(duration),
+				ResponseSize: wrapper.size,
+				ClientIP:     sanitizedClientIP,
+				UserAgent:    sanitizedUserAgent,
+				RequestID:    getRequestID(r),
+			})
+		}
+
+		// A disconnect is not a server error whatever the handler wrote after it
+		if ClientDisconnected(r) {
+			logLevel = slog.LevelWarn
+			logType, statusClass = "client_disconnect", statusClassClientDisconnect
+			message = fmt.Sprintf("HTTP %s %s - client disconnected after %v - %s",
+				r.Method, r.URL.Path, duration, sanitizedClientIP)
+		}
+
+		if logLevel == slog.LevelInfo && !sampled {
+			return
 		}
+
+		// Log response
+		attrs := []slog.Attr{
+			slog.String("type", logType),
+			slog.String("method", r.Method),
+			slog.String("path", r.URL.Path),
+			slog.String("query", sanitizedQuery),
+			slog.Int("status", wrapper.statusCode),
+			slog.String("status_class", statusClass),
+			slog.Float64("duration_ms", Milliseconds(duration)),
+			slog.Int("response_size", wrapper.size),
+			slog.String("client_ip", sanitizedClientIP),
+			slog.String("user_agent", sanitizedUserAgent),
+			slog.String("request_id", getRequestID(r)),
+		}
+		if cost != nil && cost.measured {
+			attrs = append(attrs,
+				slog.Float64("cpu_ms", float64(cost.cpu.Nanoseconds())/1000000.0),
+				slog.Uint64("alloc_bytes", cost.allocBytes),
+				slog.Uint64("alloc_objects", cost.allocObjects),
+			)
+		}
+		log.LogAttrs(r.Context(), logLevel, message, attrs...)
 	})
 }
 
@@ -192,8 +348,8 @@ func RequestLoggingMiddlewareFunc(next http.HandlerFunc) http.HandlerFunc {
 	return RequestLoggingMiddleware(http.HandlerFunc(next)).ServeHTTP
 }
 
-// getClientIP extracts the client IP address from the request
-func getClientIP(r *http.Request) string {
+// ClientIP extracts the client IP address from the request
+func ClientIP(r *http.Request) string {
 	// Check X-Forwarded-For header (most common in reverse proxy setups)
 	if xff := r.Header.Get("X-Forwarded-For"); xff != "" {
 		// Take the first IP in the chain
@@ -216,8 +372,9 @@ func getClientIP(r *http.Request) string {
 	return strings.TrimSpace(ip)
 }
 
-// getRequestID extracts or generates a request ID for tracing
-func getRequestID(r *http.Request) string {
+// RequestID returns the request ID carried by the request headers, such as
+// the X-Request-ID set by Envoy, or an empty string
+func RequestID(r *http.Request) string {
 	// Check common request ID headers
 	if reqID := r.Header.Get("X-Request-ID"); reqID != "" {
 		return reqID
@@ -225,7 +382,12 @@ func getRequestID(r *http.Request) string {
 	if reqID := r.Header.Get("X-Correlation-ID"); reqID != "" {
 		return reqID
 	}
-	if reqID := r.Header.Get("X-Trace-ID"); reqID != "" {
+	return r.Header.Get("X-Trace-ID")
+}
+
+// getRequestID extracts or generates a request ID for tracing
+func getRequestID(r *http.Request) string {
+	if reqID := RequestID(r); reqID != "" {
 		return reqID
 	}
 
@@ -234,6 +396,18 @@ func getRequestID(r *http.Request) string {
 	return fmt.Sprintf("req_%d", time.Now().UnixNano())
 }
 
+// statusClassClientDisconnect is the status class of requests whose client or
+// proxy went away before the response completed
+const statusClassClientDisconnect = "client_disconnect"
+
+// ClientDisconnected reports whether the client, or the sidecar on its behalf,
+// disconnected before the request completed. The server cancels the request
+// context when the connection closes or the stream is reset; handler timeouts
+// derive their own contexts and surface as context.DeadlineExceeded instead.
+func ClientDisconnected(r *http.Request) bool {
+	return errors.Is(r.Context().Err(), context.Canceled)
+}
+
 // getStatusClass returns a human-readable status class
 func getStatusClass(statusCode int) string {
 	switch {
@@ -255,10 +429,14 @@ func getStatusClass(statusCode int) string {
 func redactRequestFields(r *http.Request, cfg Config) (string, string, string) {
 	if !cfg.EnablePIIRedaction {
 		// Return original values when redaction is disabled
-		return r.URL.RawQuery, getClientIP(r), r.Header.Get("User-Agent")
+		return r.URL.RawQuery, ClientIP(r), r.Header.Get("User-Agent")
 	}
 
-	// Redact query parameters - allowlist only "page" and "limit"
+	// Redact query parameters - allowlisted ones are kept
+	allowedParams := cfg.RedactAllowedParams
+	if allowedParams == nil {
+		allowedParams = DefaultRedactAllowedParams
+	}
 	var sanitizedQuery string
 	if r.URL.RawQuery != "" {
 		queryValues, err := url.ParseQuery(r.URL.RawQuery)
@@ -267,7 +445,7 @@ func redactRequestFields(r *http.Request, cfg Config) (string, string, string) {
 		} else {
 			sanitizedParams := url.Values{}
 			for key, values := range queryValues {
-				if key == "page" || key == "limit" {
+				if slices.Contains(allowedParams, key) {
 					sanitizedParams[key] = values
 				} else {
 					sanitizedParams[key] = []string{"<redacted>"}
@@ -277,22 +455,17 @@ func redactRequestFields(r *http.Request, cfg Config) (string, string, string) {
 		}
 	}
 
-	// Redact client IP - return first octet + ".0.0.0" for IPv4, or "redacted" for others
-	clientIP := getClientIP(r)
-	sanitizedIP := "redacted"
-	if strings.Contains(clientIP, ".") && !strings.Contains(clientIP, ":") {
-		// Looks like IPv4
-		parts := strings.Split(clientIP, ".")
-		if len(parts) == 4 {
-			sanitizedIP = parts[0] + ".0.0.0"
-		}
-	}
+	sanitizedIP := redactIP(ClientIP(r), cfg.RedactIPMode)
 
-	// Redact user agent - truncate to 100 chars max and replace disallowed values
+	// Redact user agent - truncate and replace disallowed values
+	maxLength := cfg.RedactUserAgentMaxLength
+	if maxLength <= 0 {
+		maxLength = DefaultRedactUserAgentMaxLength
+	}
 	userAgent := r.Header.Get("User-Agent")
 	sanitizedUserAgent := userAgent
-	if len(userAgent) > 100 {
-		sanitizedUserAgent = userAgent[:100]
+	if len(userAgent) > maxLength {
+		sanitizedUserAgent = userAgent[:maxLength]
 	}
 	if sanitizedUserAgent == "" {
 		sanitizedUserAgent = "<redacted>"
@@ -301,18 +474,40 @@ func redactRequestFields(r *http.Request, cfg Config) (string, string, string) {
 	return sanitizedQuery, sanitizedIP, sanitizedUserAgent
 }
 
+// redactIP redacts a client IP according to mode, truncating by default
+func redactIP(clientIP, mode string) string {
+	switch mode {
+	case IPRedactionNone:
+		return clientIP
+	case IPRedactionHash:
+		mac := hmac.New(sha256.New, ipHashKey)
+		mac.Write([]byte(clientIP))
+		return "ip-" + hex.EncodeToString(mac.Sum(nil)[:8])
+	}
+
+	// Return first octet + ".0.0.0" for IPv4, or "redacted" for others
+	if strings.Contains(clientIP, ".") && !strings.Contains(clientIP, ":") {
+		// Looks like IPv4
+		parts := strings.Split(clientIP, ".")
+		if len(parts) == 4 {
+			return parts[0] + ".0.0.0"
+		}
+	}
+	return "redacted"
+}
+
 // determineLogLevel determines the appropriate log level based on response status and duration
-func determineLogLevel(statusCode int, duration time.Duration) logrus.Level {
+func determineLogLevel(statusCode int, duration time.Duration) slog.Level {
 	// Log server errors as errors
 	if statusCode >= 500 {
-		return logrus.ErrorLevel
+		return slog.LevelError
 	}
 
 	// Log client errors and slow requests as warnings
-	if statusCode >= 400 || duration > 1*time.Second {
-		return logrus.WarnLevel
+	if statusCode >= 400 || duration > SlowRequestThreshold() {
+		return slog.LevelWarn
 	}
 
 	// Everything else as info
-	return logrus.InfoLevel
+	return slog.LevelInfo
 }
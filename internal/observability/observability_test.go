@@ -2,103 +2,102 @@ package observability
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
+	"log/slog"
 	"net/http"
 	"net/http/httptest"
 	"strings"
 	"testing"
 	"time"
 
-	"github.com/sirupsen/logrus"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
-type TestHook struct {
-	Entries []*logrus.Entry
-}
-
-func (hook *TestHook) Levels() []logrus.Level {
-	return logrus.AllLevels
-}
-
-func (hook *TestHook) Fire(entry *logrus.Entry) error {
-	hook.Entries = append(hook.Entries, entry)
-	return nil
-}
-
 func TestInit(t *testing.T) {
 	tests := []struct {
 		name     string
 		logLevel string
-		expected logrus.Level
+		expected slog.Level
 	}{
 		{
 			name:     "default log level (empty string)",
 			logLevel: "",
-			expected: logrus.InfoLevel,
+			expected: slog.LevelInfo,
 		},
 		{
 			name:     "debug log level",
 			logLevel: "debug",
-			expected: logrus.DebugLevel,
+			expected: slog.LevelDebug,
 		},
 		{
 			name:     "warn log level",
 			logLevel: "warn",
-			expected: logrus.WarnLevel,
+			expected: slog.LevelWarn,
 		},
 		{
 			name:     "error log level",
 			logLevel: "error",
-			expected: logrus.ErrorLevel,
+			expected: slog.LevelError,
 		},
 		{
 			name:     "invalid log level",
 			logLevel: "invalid",
-			expected: logrus.InfoLevel,
+			expected: slog.LevelInfo,
 		},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			// Create a fresh logger instance for testing to avoid interference
-			testLogger := logrus.New()
-			originalLogger := log
-			log = testLogger // Temporarily replace the global logger
-
-			// Add a test hook to capture log entries
-			hook := &TestHook{}
-			log.AddHook(hook)
+			out := captureLogOutput(t)
 
 			// Ensure env doesn't influence the default-level case
 			t.Setenv("LOG_LEVEL", "")
 			// Initialize the logger
 			Init(tt.logLevel, Config{EnablePIIRedaction: false})
-
-			// Check if the logger is set to JSON formatter
-			_, ok := log.Formatter.(*logrus.JSONFormatter)
-			assert.True(t, ok, "Expected JSONFormatter")
+			WarnWithFields(context.Background(), "after init", map[string]any{"type": "test"})
 
 			// Check if the logger level is set to expected level
-			assert.Equal(t, tt.expected, log.Level, "Expected log level to be %v", tt.expected)
-
-			// Check init log messages (allow future additions)
-			assert.GreaterOrEqual(t, len(hook.Entries), 2, "Expected at least two log entries during initialization")
-			if len(hook.Entries) >= 2 {
-				assert.Contains(t, hook.Entries[0].Message, "Logrus set to JSON formatter", "Expected first log message to contain 'Logrus set to JSON formatter'")
-				assert.Contains(t, hook.Entries[1].Message, "Logrus set to output to stdout", "Expected second log message to contain 'Logrus set to output to stdout'")
+			assert.Equal(t, tt.expected, logLevelVar.Level(), "Expected log level to be %v", tt.expected)
+
+			// Check that entries are written as JSON lines with logrus compatible levels
+			var entries []map[string]any
+			for _, line := range strings.Split(strings.TrimSpace(out.String()), "\n") {
+				if line == "" {
+					continue
+				}
+				var entry map[string]any
+				require.NoError(t, json.Unmarshal([]byte(line), &entry), line)
+				entries = append(entries, entry)
+			}
+			if tt.expected <= slog.LevelInfo {
+				require.Len(t, entries, 2)
+				assert.Equal(t, "Logging json to stdout", entries[0]["msg"])
+				assert.Equal(t, "info", entries[0]["level"])
+			}
+			if tt.expected <= slog.LevelWarn {
+				last := entries[len(entries)-1]
+				assert.Equal(t, "after init", last["msg"])
+				assert.Equal(t, "warning", last["level"])
+				assert.Equal(t, "test", last["type"])
 			}
-
-			// Restore the original logger
-			log = originalLogger
 		})
 	}
 }
 
+func TestInitTextFormat(t *testing.T) {
+	out := captureLogOutput(t)
+
+	Init("info", Config{LogFormat: LogFormatText})
+	InfoWithFields(context.Background(), "text entry", map[string]any{"type": "test"})
+
+	assert.Contains(t, out.String(), `level=info msg="Logging text to stdout"`)
+	assert.Contains(t, out.String(), `level=info msg="text entry" type=test`)
+}
+
 func TestInfoWithContext(t *testing.T) {
-	// Add a test hook to capture log entries
-	hook := &TestHook{}
-	log.AddHook(hook)
+	hook := recordLogs(t)
 
 	// Create a context
 	ctx := context.Background()
@@ -112,9 +111,7 @@ func TestInfoWithContext(t *testing.T) {
 }
 
 func TestErrorWithContext(t *testing.T) {
-	// Add a test hook to capture log entries
-	hook := &TestHook{}
-	log.AddHook(hook)
+	hook := recordLogs(t)
 
 	// Create a context
 	ctx := context.Background()
@@ -127,10 +124,34 @@ func TestErrorWithContext(t *testing.T) {
 	assert.Contains(t, hook.Entries[0].Message, "test error message", "Expected log message to contain 'test error message'")
 }
 
+func TestWarnWithFields(t *testing.T) {
+	hook := recordLogs(t)
+
+	WarnWithFields(context.Background(), "test warning", map[string]any{"condition": "goroutines", "value": 42})
+
+	assert.Len(t, hook.Entries, 1, "Expected one log entry")
+	assert.Equal(t, slog.LevelWarn, hook.Entries[0].Level)
+	assert.Equal(t, "goroutines", hook.Entries[0].Data["condition"])
+	assert.Equal(t, int64(42), hook.Entries[0].Data["value"])
+}
+
+func TestInfoWithFields(t *testing.T) {
+	hook := recordLogs(t)
+
+	InfoWithFields(context.Background(), "Metadata fetch attempt 1 failed", map[string]any{
+		"type":        "metadata_fetch_retry",
+		"attempt":     1,
+		"retry_in_ms": Milliseconds(1500 * time.Microsecond),
+	})
+
+	assert.Len(t, hook.Entries, 1, "Expected one log entry")
+	assert.Equal(t, slog.LevelInfo, hook.Entries[0].Level)
+	assert.Equal(t, "metadata_fetch_retry", hook.Entries[0].Data["type"])
+	assert.Equal(t, 1.5, hook.Entries[0].Data["retry_in_ms"])
+}
+
 func TestRequestLoggingMiddleware(t *testing.T) {
-	// Add a test hook to capture log entries
-	hook := &TestHook{}
-	log.AddHook(hook)
+	hook := recordLogs(t)
 
 	// Create a test handler
 	testHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -143,7 +164,7 @@ func TestRequestLoggingMiddleware(t *testing.T) {
 
 	t.Run("successful request logging", func(t *testing.T) {
 		// Clear previous entries
-		hook.Entries = []*logrus.Entry{}
+		hook.Entries = nil
 
 		req := httptest.NewRequest("GET", "/test?param=value", nil)
 		req.Header.Set("User-Agent", "test-agent")
@@ -156,8 +177,8 @@ func TestRequestLoggingMiddleware(t *testing.T) {
 		assert.GreaterOrEqual(t, len(hook.Entries), 2, "Expected at least 2 log entries")
 
 		// Find request start entry
-		var startEntry *logrus.Entry
-		var completeEntry *logrus.Entry
+		var startEntry *logEntry
+		var completeEntry *logEntry
 		for _, entry := range hook.Entries {
 			if entry.Data["type"] == "request_start" {
 				startEntry = entry
@@ -179,15 +200,15 @@ func TestRequestLoggingMiddleware(t *testing.T) {
 		assert.NotNil(t, completeEntry, "Expected request complete entry")
 		assert.Equal(t, "GET", completeEntry.Data["method"])
 		assert.Equal(t, "/test", completeEntry.Data["path"])
-		assert.Equal(t, 200, completeEntry.Data["status"])
+		assert.Equal(t, int64(200), completeEntry.Data["status"])
 		assert.Equal(t, "success", completeEntry.Data["status_class"])
 		assert.Contains(t, completeEntry.Data, "duration_ms")
-		assert.Equal(t, 13, completeEntry.Data["response_size"]) // "test response" = 13 bytes
+		assert.Equal(t, int64(13), completeEntry.Data["response_size"]) // "test response" = 13 bytes
 	})
 
 	t.Run("error response logging", func(t *testing.T) {
 		// Clear previous entries
-		hook.Entries = []*logrus.Entry{}
+		hook.Entries = nil
 
 		errorHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			w.WriteHeader(http.StatusInternalServerError)
@@ -201,7 +222,7 @@ func TestRequestLoggingMiddleware(t *testing.T) {
 		loggedErrorHandler.ServeHTTP(w, req)
 
 		// Find the complete entry
-		var completeEntry *logrus.Entry
+		var completeEntry *logEntry
 		for _, entry := range hook.Entries {
 			if entry.Data["type"] == "request_complete" {
 				completeEntry = entry
@@ -209,14 +230,14 @@ func TestRequestLoggingMiddleware(t *testing.T) {
 		}
 
 		assert.NotNil(t, completeEntry, "Expected request complete entry")
-		assert.Equal(t, 500, completeEntry.Data["status"])
+		assert.Equal(t, int64(500), completeEntry.Data["status"])
 		assert.Equal(t, "server_error", completeEntry.Data["status_class"])
-		assert.Equal(t, logrus.ErrorLevel, completeEntry.Level, "Expected error level for 500 status")
+		assert.Equal(t, slog.LevelError, completeEntry.Level, "Expected error level for 500 status")
 	})
 
 	t.Run("client error logging", func(t *testing.T) {
 		// Clear previous entries
-		hook.Entries = []*logrus.Entry{}
+		hook.Entries = nil
 
 		clientErrorHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			w.WriteHeader(http.StatusBadRequest)
@@ -230,7 +251,7 @@ func TestRequestLoggingMiddleware(t *testing.T) {
 		loggedClientErrorHandler.ServeHTTP(w, req)
 
 		// Find the complete entry
-		var completeEntry *logrus.Entry
+		var completeEntry *logEntry
 		for _, entry := range hook.Entries {
 			if entry.Data["type"] == "request_complete" {
 				completeEntry = entry
@@ -238,10 +259,113 @@ func TestRequestLoggingMiddleware(t *testing.T) {
 		}
 
 		assert.NotNil(t, completeEntry, "Expected request complete entry")
-		assert.Equal(t, 400, completeEntry.Data["status"])
+		assert.Equal(t, int64(400), completeEntry.Data["status"])
 		assert.Equal(t, "client_error", completeEntry.Data["status_class"])
-		assert.Equal(t, logrus.WarnLevel, completeEntry.Level, "Expected warn level for 400 status")
+		assert.Equal(t, slog.LevelWarn, completeEntry.Level, "Expected warn level for 400 status")
 	})
+
+	t.Run("client disconnect logging", func(t *testing.T) {
+		// Clear previous entries
+		hook.Entries = nil
+
+		ctx, cancel := context.WithCancel(context.Background())
+		disconnectHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			// The client goes away and the handler fails on the canceled context
+			cancel()
+			<-r.Context().Done()
+			w.WriteHeader(http.StatusInternalServerError)
+		})
+		loggedDisconnectHandler := RequestLoggingMiddleware(disconnectHandler)
+
+		req := httptest.NewRequest("GET", "/slow", nil).WithContext(ctx)
+		w := httptest.NewRecorder()
+
+		loggedDisconnectHandler.ServeHTTP(w, req)
+
+		var disconnectEntry *logEntry
+		for _, entry := range hook.Entries {
+			assert.NotEqual(t, "request_complete", entry.Data["type"])
+			if entry.Data["type"] == "client_disconnect" {
+				disconnectEntry = entry
+			}
+		}
+
+		assert.NotNil(t, disconnectEntry, "Expected client disconnect entry")
+		assert.Equal(t, int64(500), disconnectEntry.Data["status"])
+		assert.Equal(t, "client_disconnect", disconnectEntry.Data["status_class"])
+		assert.Contains(t, disconnectEntry.Data, "duration_ms")
+		assert.Equal(t, slog.LevelWarn, disconnectEntry.Level, "Expected warn level for disconnects")
+	})
+
+	t.Run("sampled out request logging", func(t *testing.T) {
+		SetRequestLogSampleRate(0)
+		defer SetRequestLogSampleRate(1)
+
+		// Clear previous entries
+		hook.Entries = nil
+		loggedHandler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/test", nil))
+		assert.Empty(t, hook.Entries, "Expected successful requests to be sampled out")
+
+		failingHandler := RequestLoggingMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusBadGateway)
+		}))
+		failingHandler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/test", nil))
+		require.Len(t, hook.Entries, 1, "Expected failed requests to be logged regardless")
+		assert.Equal(t, "request_complete", hook.Entries[0].Data["type"])
+
+		SetSlowRequestThreshold(time.Millisecond)
+		defer SetSlowRequestThreshold(time.Second)
+		hook.Entries = nil
+		slowHandler := RequestLoggingMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			time.Sleep(5 * time.Millisecond)
+		}))
+		slowHandler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/test", nil))
+		require.Len(t, hook.Entries, 1, "Expected slow requests to be logged regardless")
+		assert.Equal(t, slog.LevelWarn, hook.Entries[0].Level)
+	})
+
+	t.Run("excluded path logging", func(t *testing.T) {
+		previous := config
+		config.LogExcludePaths = []string{"/istio-test/health"}
+		defer func() { config = previous }()
+
+		hook.Entries = nil
+		loggedHandler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/istio-test/health/ready", nil))
+		assert.Empty(t, hook.Entries, "Expected successful probes to be suppressed")
+
+		loggedHandler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/test", nil))
+		assert.Len(t, hook.Entries, 2, "Expected other paths to be logged")
+
+		hook.Entries = nil
+		failingHandler := RequestLoggingMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}))
+		failingHandler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/istio-test/health/ready", nil))
+		require.Len(t, hook.Entries, 1, "Expected failed probes to be logged regardless")
+		assert.Equal(t, slog.LevelError, hook.Entries[0].Level)
+	})
+}
+
+func TestSlowRequestThreshold(t *testing.T) {
+	assert.Equal(t, time.Second, SlowRequestThreshold())
+	assert.Equal(t, slog.LevelInfo, determineLogLevel(200, 500*time.Millisecond))
+
+	SetSlowRequestThreshold(100 * time.Millisecond)
+	defer SetSlowRequestThreshold(time.Second)
+	assert.Equal(t, slog.LevelWarn, determineLogLevel(200, 500*time.Millisecond))
+}
+
+func TestClientDisconnected(t *testing.T) {
+	req := httptest.NewRequest("GET", "/", nil)
+	assert.False(t, ClientDisconnected(req))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 0)
+	defer cancel()
+	assert.False(t, ClientDisconnected(req.WithContext(ctx)), "deadlines are not disconnects")
+
+	ctx, cancel = context.WithCancel(context.Background())
+	cancel()
+	assert.True(t, ClientDisconnected(req.WithContext(ctx)))
 }
 
 func TestRedactRequestFields(t *testing.T) {
@@ -315,6 +439,55 @@ func TestRedactRequestFields(t *testing.T) {
 	}
 }
 
+func TestResponseWrapperUnwrap(t *testing.T) {
+	server := httptest.NewServer(RequestLoggingMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Deadlines are only reachable through Unwrap
+		controller := http.NewResponseController(w)
+		if err := controller.SetWriteDeadline(time.Now().Add(time.Minute)); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Write([]byte("ok"))
+	})))
+	defer server.Close()
+
+	resp, err := http.Get(server.URL)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+}
+
+func TestRedactRequestFieldsRules(t *testing.T) {
+	req := httptest.NewRequest("GET", "http://example.com/test?page=1&sort=name&email=user%40example.com", nil)
+	req.Header.Set("User-Agent", "Mozilla/5.0 (Test Browser)")
+	req.RemoteAddr = "192.168.1.100:12345"
+
+	cfg := Config{
+		EnablePIIRedaction:       true,
+		RedactAllowedParams:      []string{"sort"},
+		RedactIPMode:             IPRedactionNone,
+		RedactUserAgentMaxLength: 7,
+	}
+	query, clientIP, userAgent := redactRequestFields(req, cfg)
+	assert.Equal(t, "email=%3Credacted%3E&page=%3Credacted%3E&sort=name", query)
+	assert.Equal(t, "192.168.1.100", clientIP)
+	assert.Equal(t, "Mozilla", userAgent)
+
+	cfg.RedactAllowedParams = []string{}
+	query, _, _ = redactRequestFields(req, cfg)
+	assert.Equal(t, "email=%3Credacted%3E&page=%3Credacted%3E&sort=%3Credacted%3E", query, "an empty allowlist redacts every param")
+
+	// Hashes are stable within the process, so requests of a client correlate
+	cfg.RedactIPMode = IPRedactionHash
+	_, hashed, _ := redactRequestFields(req, cfg)
+	assert.Regexp(t, `^ip-[0-9a-f]{16}$`, hashed)
+	_, again, _ := redactRequestFields(req, cfg)
+	assert.Equal(t, hashed, again)
+	req.RemoteAddr = "192.168.1.101:12345"
+	_, other, _ := redactRequestFields(req, cfg)
+	assert.NotEqual(t, hashed, other)
+}
+
 func TestGetClientIP(t *testing.T) {
 	tests := []struct {
 		name       string
@@ -356,7 +529,7 @@ func TestGetClientIP(t *testing.T) {
 				req.Header.Set(k, v)
 			}
 
-			result := getClientIP(req)
+			result := ClientIP(req)
 			assert.Equal(t, tt.expected, result)
 		})
 	}
@@ -394,13 +567,13 @@ func TestDetermineLogLevel(t *testing.T) {
 		name       string
 		statusCode int
 		duration   time.Duration
-		expected   logrus.Level
+		expected   slog.Level
 	}{
-		{"server error", 500, 100 * time.Millisecond, logrus.ErrorLevel},
-		{"client error", 400, 100 * time.Millisecond, logrus.WarnLevel},
-		{"slow request", 200, 2 * time.Second, logrus.WarnLevel},
-		{"normal request", 200, 100 * time.Millisecond, logrus.InfoLevel},
-		{"fast success", 201, 50 * time.Millisecond, logrus.InfoLevel},
+		{"server error", 500, 100 * time.Millisecond, slog.LevelError},
+		{"client error", 400, 100 * time.Millisecond, slog.LevelWarn},
+		{"slow request", 200, 2 * time.Second, slog.LevelWarn},
+		{"normal request", 200, 100 * time.Millisecond, slog.LevelInfo},
+		{"fast success", 201, 50 * time.Millisecond, slog.LevelInfo},
 	}
 
 	for _, tt := range tests {
@@ -0,0 +1,240 @@
+package observability
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"istio-test/internal/tenant"
+	"istio-test/internal/testrun"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// otelInstrumentation names the tracer spans are created with
+const otelInstrumentation = "istio-test"
+
+// otelProvider is the provider started by StartTracer, nil until then
+var otelProvider *sdktrace.TracerProvider
+
+// startOTel starts an OpenTelemetry tracer provider exporting over OTLP/HTTP and
+// installs W3C trace context propagation
+func startOTel(options TracerOptions) error {
+	sampler, err := otelSampler(options)
+	if err != nil {
+		return err
+	}
+
+	var exporterOptions []otlptracehttp.Option
+	if options.OTLPEndpoint != "" {
+		exporterOptions = append(exporterOptions, otlptracehttp.WithEndpointURL(options.OTLPEndpoint))
+	}
+	exporter, err := otlptracehttp.New(context.Background(), exporterOptions...)
+	if err != nil {
+		return fmt.Errorf("creating OTLP exporter: %w", err)
+	}
+
+	otelProvider = sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(otelResource(options)),
+		sdktrace.WithSampler(sampler),
+	)
+	otel.SetTracerProvider(otelProvider)
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+	return nil
+}
+
+// stopOTel flushes pending spans and stops the provider
+func stopOTel() {
+	if otelProvider == nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := otelProvider.Shutdown(ctx); err != nil {
+		WarnWithContext(ctx, fmt.Sprintf("Error shutting down OpenTelemetry tracer: %v", err))
+	}
+}
+
+// otelResource describes the service with the attributes the Datadog tracer sets
+func otelResource(options TracerOptions) *resource.Resource {
+	var attributes []attribute.KeyValue
+	if options.Service != "" {
+		attributes = append(attributes, attribute.String("service.name", options.Service))
+	}
+	if options.Version != "" {
+		attributes = append(attributes, attribute.String("service.version", options.Version))
+	}
+	if options.Env != "" {
+		attributes = append(attributes, attribute.String("deployment.environment", options.Env))
+	}
+	for k, v := range options.Tags {
+		attributes = append(attributes, attribute.String(k, v))
+	}
+	return resource.NewSchemaless(attributes...)
+}
+
+// otelRule samples spans of an operation, or all spans when operation is empty
+type otelRule struct {
+	operation string
+	sampler   sdktrace.Sampler
+}
+
+// ruleSampler applies the first rule matching the span name, like the Datadog
+// tracer does, and samples everything when no rule matches
+type ruleSampler struct {
+	rules []otelRule
+}
+
+func (s ruleSampler) ShouldSample(parameters sdktrace.SamplingParameters) sdktrace.SamplingResult {
+	for _, rule := range s.rules {
+		if rule.operation == "" || rule.operation == parameters.Name {
+			return rule.sampler.ShouldSample(parameters)
+		}
+	}
+	return sdktrace.AlwaysSample().ShouldSample(parameters)
+}
+
+func (s ruleSampler) Description() string {
+	return fmt.Sprintf("RuleSampler{rules:%d}", len(s.rules))
+}
+
+// otelSampler translates the sampling rules for this service and the default
+// rate into a sampler; sampled parents are always honored so traces started
+// by the mesh stay complete
+func otelSampler(options TracerOptions) (sdktrace.Sampler, error) {
+	keys := make([]string, 0, len(options.SamplingRules))
+	for key := range options.SamplingRules {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		iOperation, jOperation := strings.Contains(keys[i], ":"), strings.Contains(keys[j], ":")
+		if iOperation != jOperation {
+			return iOperation
+		}
+		return keys[i] < keys[j]
+	})
+
+	var rules []otelRule
+	for _, key := range keys {
+		service, operation, rate, err := ParseSamplingRule(key, options.SamplingRules[key])
+		if err != nil {
+			return nil, err
+		}
+		if service != options.Service {
+			continue
+		}
+		rules = append(rules, otelRule{operation: operation, sampler: sdktrace.TraceIDRatioBased(rate)})
+	}
+	if options.SampleRate > 0 {
+		rules = append(rules, otelRule{sampler: sdktrace.TraceIDRatioBased(options.SampleRate)})
+	}
+	return sdktrace.ParentBased(ruleSampler{rules: rules}), nil
+}
+
+// otelSpan adapts an OpenTelemetry span to Span
+type otelSpan struct {
+	span trace.Span
+}
+
+func startOTelSpan(ctx context.Context, name string, opts ...trace.SpanStartOption) (otelSpan, context.Context) {
+	ctx, span := otel.Tracer(otelInstrumentation).Start(ctx, name, opts...)
+	return otelSpan{span}, ctx
+}
+
+func (s otelSpan) SetTag(key string, value any) {
+	switch v := value.(type) {
+	case string:
+		s.span.SetAttributes(attribute.String(key, v))
+	case int:
+		s.span.SetAttributes(attribute.Int(key, v))
+	case int64:
+		s.span.SetAttributes(attribute.Int64(key, v))
+	case float64:
+		s.span.SetAttributes(attribute.Float64(key, v))
+	case bool:
+		s.span.SetAttributes(attribute.Bool(key, v))
+	default:
+		s.span.SetAttributes(attribute.String(key, fmt.Sprint(v)))
+	}
+}
+
+func (s otelSpan) Finish(err error) {
+	if err != nil {
+		s.span.RecordError(err)
+		s.span.SetStatus(codes.Error, err.Error())
+	}
+	s.span.End()
+}
+
+// OTelMiddleware starts a server span for every request, continuing the trace
+// from the W3C traceparent header when present. pathLabel names the span so
+// span names stay bounded like metric labels.
+func OTelMiddleware(next http.Handler, pathLabel func(r *http.Request) string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := otel.GetTextMapPropagator().Extract(r.Context(), propagation.HeaderCarrier(r.Header))
+		span, ctx := startOTelSpan(ctx, r.Method+" "+pathLabel(r), trace.WithSpanKind(trace.SpanKindServer))
+		span.SetTag("http.method", r.Method)
+		span.SetTag("http.url", r.URL.Path)
+		if id := testrun.FromContext(ctx); id != "" {
+			span.SetTag(TestRunTag, id)
+		}
+		if id := tenant.FromContext(ctx); id != "" {
+			span.SetTag(TenantTag, id)
+		}
+
+		wrapped := newResponseWrapper(w)
+		next.ServeHTTP(wrapped, r.WithContext(ctx))
+
+		span.SetTag("http.status_code", wrapped.statusCode)
+		if wrapped.statusCode >= http.StatusInternalServerError {
+			span.span.SetStatus(codes.Error, http.StatusText(wrapped.statusCode))
+		}
+		span.Finish(nil)
+	})
+}
+
+// otelTransport starts a client span for every request and injects the W3C
+// traceparent header, so the mesh and the upstream continue the trace
+type otelTransport struct {
+	next   http.RoundTripper
+	name   func(*http.Request) string
+	before func(*http.Request, Span)
+}
+
+// OTelTransport wraps rt to trace outbound requests. name returns the span
+// name of a request; before, if set, runs on each span before the request is sent.
+func OTelTransport(rt http.RoundTripper, name func(*http.Request) string, before func(*http.Request, Span)) http.RoundTripper {
+	return &otelTransport{next: rt, name: name, before: before}
+}
+
+func (t *otelTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	span, ctx := startOTelSpan(req.Context(), t.name(req), trace.WithSpanKind(trace.SpanKindClient))
+	span.SetTag("http.method", req.Method)
+	span.SetTag("http.url", req.URL.String())
+	if t.before != nil {
+		t.before(req, span)
+	}
+
+	req = req.Clone(ctx)
+	otel.GetTextMapPropagator().Inject(ctx, propagation.HeaderCarrier(req.Header))
+	resp, err := t.next.RoundTrip(req)
+	if err == nil {
+		span.SetTag("http.status_code", resp.StatusCode)
+		if resp.StatusCode >= http.StatusInternalServerError {
+			span.span.SetStatus(codes.Error, resp.Status)
+		}
+	}
+	span.Finish(err)
+	return resp, err
+}
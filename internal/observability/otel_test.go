@@ -0,0 +1,135 @@
+package observability
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"istio-test/internal/tenant"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// useOTelRecorder makes OpenTelemetry the active backend for the test and
+// returns a recorder of the finished spans
+func useOTelRecorder(t *testing.T) *tracetest.SpanRecorder {
+	recorder := tracetest.NewSpanRecorder()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+
+	previousProvider, previousPropagator, previousBackend := otel.GetTracerProvider(), otel.GetTextMapPropagator(), otelTracing.Load()
+	otel.SetTracerProvider(provider)
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	otelTracing.Store(true)
+	t.Cleanup(func() {
+		otel.SetTracerProvider(previousProvider)
+		otel.SetTextMapPropagator(previousPropagator)
+		otelTracing.Store(previousBackend)
+	})
+	return recorder
+}
+
+func TestStartTracerUnknownBackend(t *testing.T) {
+	assert.Error(t, StartTracer(TracerOptions{Backend: "jaeger"}))
+}
+
+func TestStartSpanOTel(t *testing.T) {
+	recorder := useOTelRecorder(t)
+
+	span, ctx := StartSpan(context.Background(), "metadata.fetch")
+	span.SetTag("retry.attempt", 2)
+	child, _ := StartSpan(ctx, "child")
+	child.Finish(nil)
+	span.Finish(errors.New("connection refused"))
+
+	spans := recorder.Ended()
+	require.Len(t, spans, 2)
+	assert.Equal(t, "child", spans[0].Name())
+	assert.Equal(t, spans[1].SpanContext().SpanID(), spans[0].Parent().SpanID())
+	assert.Equal(t, "metadata.fetch", spans[1].Name())
+	assert.Equal(t, codes.Error, spans[1].Status().Code)
+	assert.Contains(t, spans[1].Attributes(), attribute.Int("retry.attempt", 2))
+}
+
+func TestOTelMiddleware(t *testing.T) {
+	recorder := useOTelRecorder(t)
+
+	handler := OTelMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.True(t, trace.SpanContextFromContext(r.Context()).IsValid())
+		w.WriteHeader(http.StatusBadGateway)
+	}), func(r *http.Request) string { return "/istio-test/echo" })
+
+	req := httptest.NewRequest(http.MethodGet, "/istio-test/echo?x=1", nil)
+	req.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	handler.ServeHTTP(httptest.NewRecorder(), req.WithContext(tenant.WithTenant(req.Context(), "payments")))
+
+	spans := recorder.Ended()
+	require.Len(t, spans, 1)
+	assert.Equal(t, "GET /istio-test/echo", spans[0].Name())
+	assert.Equal(t, trace.SpanKindServer, spans[0].SpanKind())
+	assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", spans[0].SpanContext().TraceID().String())
+	assert.Equal(t, "00f067aa0ba902b7", spans[0].Parent().SpanID().String())
+	assert.Equal(t, codes.Error, spans[0].Status().Code)
+	assert.Contains(t, spans[0].Attributes(), attribute.String(TenantTag, "payments"))
+}
+
+func TestOTelTransport(t *testing.T) {
+	recorder := useOTelRecorder(t)
+
+	var traceparent string
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		traceparent = r.Header.Get("traceparent")
+	}))
+	defer upstream.Close()
+
+	client := &http.Client{Transport: OTelTransport(http.DefaultTransport,
+		func(req *http.Request) string { return "echo " + req.Method },
+		func(req *http.Request, span Span) { span.SetTag("test.run_id", "run-1") },
+	)}
+	resp, err := client.Get(upstream.URL)
+	require.NoError(t, err)
+	resp.Body.Close()
+
+	spans := recorder.Ended()
+	require.Len(t, spans, 1)
+	assert.Equal(t, "echo GET", spans[0].Name())
+	assert.Equal(t, trace.SpanKindClient, spans[0].SpanKind())
+	assert.Contains(t, spans[0].Attributes(), attribute.String("test.run_id", "run-1"))
+	assert.Contains(t, traceparent, spans[0].SpanContext().TraceID().String())
+	assert.Contains(t, traceparent, spans[0].SpanContext().SpanID().String())
+}
+
+func TestOTelSampler(t *testing.T) {
+	sampler, err := otelSampler(TracerOptions{
+		Service: "istio-test",
+		SamplingRules: map[string]string{
+			"istio-test":                "0",
+			"istio-test:metadata.fetch": "1",
+			"other":                     "1",
+		},
+	})
+	require.NoError(t, err)
+
+	sample := func(name string) sdktrace.SamplingDecision {
+		return sampler.ShouldSample(sdktrace.SamplingParameters{
+			ParentContext: context.Background(),
+			TraceID:       trace.TraceID{1},
+			Name:          name,
+		}).Decision
+	}
+	assert.Equal(t, sdktrace.RecordAndSample, sample("metadata.fetch"))
+	assert.Equal(t, sdktrace.Drop, sample("GET /istio-test/echo"))
+
+	_, err = otelSampler(TracerOptions{SamplingRules: map[string]string{"istio-test": "all"}})
+	assert.Error(t, err)
+}
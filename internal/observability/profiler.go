@@ -0,0 +1,107 @@
+package observability
+
+import (
+	"fmt"
+	"runtime"
+	"sort"
+	"strings"
+	"time"
+
+	"gopkg.in/DataDog/dd-trace-go.v1/profiler"
+)
+
+// ProfilerOptions configures the continuous profiler
+type ProfilerOptions struct {
+	ProfileTypes         []string      // Profile type names, see ProfileTypeNames
+	Period               time.Duration // Collection and upload period, zero uses the profiler default
+	UploadTimeout        time.Duration // Upload timeout, zero uses the profiler default
+	BlockProfileRate     int           // Nanoseconds spent blocked per sampled event when block profiles are enabled
+	MutexProfileFraction int           // 1/n mutex contention events are sampled when mutex profiles are enabled
+	AgentAddr            string        // Datadog agent host:port profiles are uploaded to, empty uses the profiler default
+}
+
+// profileTypes maps configuration names to profiler profile types
+var profileTypes = map[string]profiler.ProfileType{
+	"cpu":       profiler.CPUProfile,
+	"heap":      profiler.HeapProfile,
+	"block":     profiler.BlockProfile,
+	"mutex":     profiler.MutexProfile,
+	"goroutine": profiler.GoroutineProfile,
+}
+
+// ProfileTypeNames returns the supported profile type names in sorted order
+func ProfileTypeNames() []string {
+	names := make([]string, 0, len(profileTypes))
+	for name := range profileTypes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// profilerOptions translates options into profiler options and reports whether
+// block and mutex profiles are enabled
+func profilerOptions(options ProfilerOptions) ([]profiler.Option, bool, bool, error) {
+	names := options.ProfileTypes
+	if len(names) == 0 {
+		names = []string{"cpu", "heap"}
+	}
+
+	var (
+		types        []profiler.ProfileType
+		block, mutex bool
+	)
+	for _, name := range names {
+		name = strings.ToLower(strings.TrimSpace(name))
+		profileType, ok := profileTypes[name]
+		if !ok {
+			return nil, false, false, fmt.Errorf("unknown profile type '%s': must be one of %s", name, strings.Join(ProfileTypeNames(), ", "))
+		}
+		types = append(types, profileType)
+		block = block || profileType == profiler.BlockProfile
+		mutex = mutex || profileType == profiler.MutexProfile
+	}
+
+	opts := []profiler.Option{profiler.WithProfileTypes(types...)}
+	if options.Period > 0 {
+		opts = append(opts, profiler.WithPeriod(options.Period))
+	}
+	if options.UploadTimeout > 0 {
+		opts = append(opts, profiler.WithUploadTimeout(options.UploadTimeout))
+	}
+	if options.AgentAddr != "" {
+		opts = append(opts, profiler.WithAgentAddr(options.AgentAddr))
+	}
+	if block {
+		opts = append(opts, profiler.BlockProfileRate(options.BlockProfileRate))
+	}
+	if mutex {
+		opts = append(opts, profiler.MutexProfileFraction(options.MutexProfileFraction))
+	}
+
+	return opts, block, mutex, nil
+}
+
+// StartProfiler starts the continuous profiler. Block and mutex sampling is
+// enabled in the runtime only when the matching profile type is requested,
+// since both add overhead to every contention event.
+func StartProfiler(options ProfilerOptions) error {
+	opts, block, mutex, err := profilerOptions(options)
+	if err != nil {
+		return err
+	}
+
+	if block {
+		runtime.SetBlockProfileRate(options.BlockProfileRate)
+	}
+	if mutex {
+		runtime.SetMutexProfileFraction(options.MutexProfileFraction)
+	}
+
+	return profiler.Start(opts...)
+}
+
+// StopProfiler stops the continuous profiler
+func StopProfiler() {
+	profiler.Stop()
+}
@@ -0,0 +1,42 @@
+package observability
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestProfileTypeNames(t *testing.T) {
+	assert.Equal(t, []string{"block", "cpu", "goroutine", "heap", "mutex"}, ProfileTypeNames())
+}
+
+func TestProfilerOptions(t *testing.T) {
+	t.Run("defaults to cpu and heap", func(t *testing.T) {
+		opts, block, mutex, err := profilerOptions(ProfilerOptions{})
+		require.NoError(t, err)
+		assert.Len(t, opts, 1)
+		assert.False(t, block)
+		assert.False(t, mutex)
+	})
+
+	t.Run("contention profiles and timings", func(t *testing.T) {
+		opts, block, mutex, err := profilerOptions(ProfilerOptions{
+			ProfileTypes:         []string{"cpu", "Block", " mutex", "goroutine"},
+			Period:               30 * time.Second,
+			UploadTimeout:        5 * time.Second,
+			BlockProfileRate:     10000,
+			MutexProfileFraction: 10,
+		})
+		require.NoError(t, err)
+		assert.Len(t, opts, 5)
+		assert.True(t, block)
+		assert.True(t, mutex)
+	})
+
+	t.Run("unknown profile type", func(t *testing.T) {
+		_, _, _, err := profilerOptions(ProfilerOptions{ProfileTypes: []string{"threads"}})
+		assert.ErrorContains(t, err, "unknown profile type 'threads'")
+	})
+}
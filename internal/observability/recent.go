@@ -0,0 +1,68 @@
+package observability
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// RequestRecord is a completed request kept by the recent requests buffer.
+// Query, client IP and user agent are redacted like in request logs.
+type RequestRecord struct {
+	Time         time.Time `json:"time"`
+	Method       string    `json:"method"`
+	Path         string    `json:"path"`
+	Query        string    `json:"query,omitempty"`
+	Status       int       `json:"status"`
+	DurationMs   float64   `json:"duration_ms"`
+	ResponseSize int       `json:"response_size"`
+	ClientIP     string    `json:"client_ip"`
+	UserAgent    string    `json:"user_agent,omitempty"`
+	RequestID    string    `json:"request_id,omitempty"`
+}
+
+// requestRing keeps the latest completed requests, overwriting the oldest
+type requestRing struct {
+	mu      sync.Mutex
+	records []RequestRecord
+	next    int
+	full    bool
+}
+
+// recentRequests is the buffer installed by Init, if any
+var recentRequests atomic.Pointer[requestRing]
+
+func newRequestRing(size int) *requestRing {
+	return &requestRing{records: make([]RequestRecord, size)}
+}
+
+// add records a completed request
+func (b *requestRing) add(record RequestRecord) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.records[b.next] = record
+	b.next = (b.next + 1) % len(b.records)
+	b.full = b.full || b.next == 0
+}
+
+// list returns the recorded requests, oldest first
+func (b *requestRing) list() []RequestRecord {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if !b.full {
+		return append([]RequestRecord(nil), b.records[:b.next]...)
+	}
+	records := make([]RequestRecord, 0, len(b.records))
+	records = append(records, b.records[b.next:]...)
+	return append(records, b.records[:b.next]...)
+}
+
+// RecentRequests returns the latest requests completed by
+// RequestLoggingMiddleware, oldest first, whether or not they were logged.
+// It is empty unless Config.RecentRequests is set.
+func RecentRequests() []RequestRecord {
+	if ring := recentRequests.Load(); ring != nil {
+		return ring.list()
+	}
+	return []RequestRecord{}
+}
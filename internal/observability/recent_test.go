@@ -0,0 +1,54 @@
+package observability
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRequestRing(t *testing.T) {
+	ring := newRequestRing(3)
+	assert.Empty(t, ring.list())
+
+	for _, path := range []string{"/a", "/b"} {
+		ring.add(RequestRecord{Path: path})
+	}
+	assert.Equal(t, []RequestRecord{{Path: "/a"}, {Path: "/b"}}, ring.list())
+
+	for _, path := range []string{"/c", "/d", "/e"} {
+		ring.add(RequestRecord{Path: path})
+	}
+	assert.Equal(t, []RequestRecord{{Path: "/c"}, {Path: "/d"}, {Path: "/e"}}, ring.list())
+}
+
+func TestRecentRequests(t *testing.T) {
+	previous := recentRequests.Load()
+	t.Cleanup(func() { recentRequests.Store(previous) })
+
+	recentRequests.Store(nil)
+	assert.Empty(t, RecentRequests())
+
+	recentRequests.Store(newRequestRing(10))
+	previousRate := RequestLogSampleRate()
+	SetRequestLogSampleRate(0)
+	t.Cleanup(func() { SetRequestLogSampleRate(previousRate) })
+
+	handler := RequestLoggingMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusTeapot)
+		w.Write([]byte("short and stout"))
+	}))
+	req := httptest.NewRequest(http.MethodGet, "/istio-test/echo", nil)
+	req.Header.Set("X-Request-ID", "abc-123")
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+
+	records := RecentRequests()
+	require.Len(t, records, 1, "requests are kept even when their log is sampled out")
+	assert.Equal(t, "/istio-test/echo", records[0].Path)
+	assert.Equal(t, http.StatusTeapot, records[0].Status)
+	assert.Equal(t, len("short and stout"), records[0].ResponseSize)
+	assert.Equal(t, "abc-123", records[0].RequestID)
+	assert.False(t, records[0].Time.IsZero())
+}
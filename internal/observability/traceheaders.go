@@ -0,0 +1,81 @@
+package observability
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"go.opentelemetry.io/otel/trace"
+	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace"
+	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/tracer"
+)
+
+// Response headers identifying the server span of a request
+const (
+	TraceIDHeader         = "X-Trace-Id"          // 128-bit trace ID in hex
+	SpanIDHeader          = "X-Span-Id"           // Span ID in hex
+	DatadogTraceIDHeader  = "X-Datadog-Trace-Id"  // Lower 64 bits of the trace ID in decimal, as searched in Datadog
+	DatadogParentIDHeader = "X-Datadog-Parent-Id" // Span ID in decimal
+	TraceResponseHeader   = "Traceresponse"       // W3C Trace Context response header
+)
+
+// SpanIDs identifies a span of the active tracing backend
+type SpanIDs struct {
+	TraceID [16]byte
+	SpanID  uint64
+	Sampled bool
+}
+
+// SpanIDsFromContext returns the IDs of the span carried by ctx
+func SpanIDsFromContext(ctx context.Context) (SpanIDs, bool) {
+	if OTelTracing() {
+		spanContext := trace.SpanContextFromContext(ctx)
+		if !spanContext.IsValid() {
+			return SpanIDs{}, false
+		}
+		spanID := spanContext.SpanID()
+		return SpanIDs{
+			TraceID: spanContext.TraceID(),
+			SpanID:  binary.BigEndian.Uint64(spanID[:]),
+			Sampled: spanContext.IsSampled(),
+		}, true
+	}
+
+	span, ok := tracer.SpanFromContext(ctx)
+	if !ok || span.Context().TraceID() == 0 {
+		return SpanIDs{}, false
+	}
+	spanContext := span.Context()
+	// The sampling decision of Datadog spans is left to the agent
+	ids := SpanIDs{SpanID: spanContext.SpanID(), Sampled: true}
+	binary.BigEndian.PutUint64(ids.TraceID[8:], spanContext.TraceID())
+	if w3c, ok := spanContext.(ddtrace.SpanContextW3C); ok {
+		if upper, err := strconv.ParseUint(w3c.TraceID128()[:16], 16, 64); err == nil {
+			binary.BigEndian.PutUint64(ids.TraceID[:8], upper)
+		}
+	}
+	return ids, true
+}
+
+// TraceHeadersMiddleware adds the trace and span IDs of the request span to
+// the response, so a test client can go from a response straight to its trace.
+// It must run inside the server span, next to the middleware starting it.
+func TraceHeadersMiddleware(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if ids, ok := SpanIDsFromContext(r.Context()); ok {
+			flags := "00"
+			if ids.Sampled {
+				flags = "01"
+			}
+			header := w.Header()
+			header.Set(TraceIDHeader, fmt.Sprintf("%032x", ids.TraceID))
+			header.Set(SpanIDHeader, fmt.Sprintf("%016x", ids.SpanID))
+			header.Set(DatadogTraceIDHeader, strconv.FormatUint(binary.BigEndian.Uint64(ids.TraceID[8:]), 10))
+			header.Set(DatadogParentIDHeader, strconv.FormatUint(ids.SpanID, 10))
+			header.Set(TraceResponseHeader, fmt.Sprintf("00-%032x-%016x-%s", ids.TraceID, ids.SpanID, flags))
+		}
+		next(w, r)
+	}
+}
@@ -0,0 +1,57 @@
+package observability
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/mocktracer"
+	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/tracer"
+)
+
+func okHandler(w http.ResponseWriter, r *http.Request) {
+	w.WriteHeader(http.StatusOK)
+}
+
+func TestTraceHeadersMiddlewareOTel(t *testing.T) {
+	useOTelRecorder(t)
+	handler := OTelMiddleware(TraceHeadersMiddleware(okHandler), func(r *http.Request) string { return r.URL.Path })
+
+	req := httptest.NewRequest(http.MethodGet, "/istio-test/echo", nil)
+	req.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+
+	assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", w.Header().Get(TraceIDHeader))
+	spanID := w.Header().Get(SpanIDHeader)
+	require.Len(t, spanID, 16)
+	assert.NotEqual(t, "00f067aa0ba902b7", spanID, "the server span is reported, not its parent")
+	assert.Equal(t, strconv.FormatUint(0xa3ce929d0e0e4736, 10), w.Header().Get(DatadogTraceIDHeader))
+	assert.Equal(t, "00-4bf92f3577b34da6a3ce929d0e0e4736-"+spanID+"-01", w.Header().Get(TraceResponseHeader))
+}
+
+func TestTraceHeadersMiddlewareDatadog(t *testing.T) {
+	mt := mocktracer.Start()
+	defer mt.Stop()
+
+	span, ctx := tracer.StartSpanFromContext(context.Background(), "http.request")
+	defer span.Finish()
+	w := httptest.NewRecorder()
+	TraceHeadersMiddleware(okHandler)(w, httptest.NewRequest(http.MethodGet, "/istio-test/echo", nil).WithContext(ctx))
+
+	assert.Equal(t, strconv.FormatUint(span.Context().TraceID(), 10), w.Header().Get(DatadogTraceIDHeader))
+	assert.Equal(t, strconv.FormatUint(span.Context().SpanID(), 10), w.Header().Get(DatadogParentIDHeader))
+	assert.Len(t, w.Header().Get(TraceIDHeader), 32)
+	assert.NotEmpty(t, w.Header().Get(TraceResponseHeader))
+}
+
+func TestTraceHeadersMiddlewareUntraced(t *testing.T) {
+	w := httptest.NewRecorder()
+	TraceHeadersMiddleware(okHandler)(w, httptest.NewRequest(http.MethodGet, "/istio-test/echo", nil))
+	assert.Empty(t, w.Header().Get(TraceIDHeader))
+	assert.Empty(t, w.Header().Get(TraceResponseHeader))
+}
@@ -0,0 +1,180 @@
+package observability
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync/atomic"
+
+	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace"
+	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/tracer"
+)
+
+// Tracing backends
+const (
+	TracingBackendDatadog = "datadog"
+	TracingBackendOTel    = "otel"
+)
+
+// Span tags attributing a request
+const (
+	TestRunTag = "test.run_id"
+	TenantTag  = "tenant"
+)
+
+// otelTracing is set once StartTracer started the OpenTelemetry backend. The
+// tracer may be started in the background while requests are served.
+var otelTracing atomic.Bool
+
+// TracerOptions configures the tracer
+type TracerOptions struct {
+	Backend       string            // TracingBackendDatadog (default) or TracingBackendOTel
+	Service       string            // Service name reported with every span
+	Env           string            // Environment tag, e.g. the cluster the deployment runs in
+	Version       string            // Service version tag
+	AgentAddr     string            // Datadog trace agent host:port, empty uses the tracer default
+	OTLPEndpoint  string            // OTLP/HTTP collector URL, empty uses the exporter default
+	SampleRate    float64           // Rate for traces matching no rule, zero leaves sampling to the agent
+	SamplingRules map[string]string // Rates keyed by "service" or "service:operation"
+	Tags          map[string]string // Global tags added to every span
+}
+
+// ParseSamplingRule parses a sampling rule key and rate
+func ParseSamplingRule(key, rate string) (service, operation string, sampleRate float64, err error) {
+	service, operation, _ = strings.Cut(key, ":")
+	if service == "" {
+		return "", "", 0, fmt.Errorf("sampling rule '%s' has no service", key)
+	}
+	sampleRate, err = strconv.ParseFloat(rate, 64)
+	if err != nil || sampleRate < 0 || sampleRate > 1 {
+		return "", "", 0, fmt.Errorf("sampling rule '%s' has invalid rate '%s': must be between 0 and 1", key, rate)
+	}
+	return service, operation, sampleRate, nil
+}
+
+// samplingRules builds tracer sampling rules, most specific first, since the
+// tracer applies the first matching rule
+func samplingRules(options TracerOptions) ([]tracer.SamplingRule, error) {
+	keys := make([]string, 0, len(options.SamplingRules))
+	for key := range options.SamplingRules {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		iOperation, jOperation := strings.Contains(keys[i], ":"), strings.Contains(keys[j], ":")
+		if iOperation != jOperation {
+			return iOperation
+		}
+		return keys[i] < keys[j]
+	})
+
+	var rules []tracer.SamplingRule
+	for _, key := range keys {
+		service, operation, rate, err := ParseSamplingRule(key, options.SamplingRules[key])
+		if err != nil {
+			return nil, err
+		}
+		if operation != "" {
+			rules = append(rules, tracer.NameServiceRule(operation, service, rate))
+		} else {
+			rules = append(rules, tracer.ServiceRule(service, rate))
+		}
+	}
+	if options.SampleRate > 0 {
+		rules = append(rules, tracer.RateRule(options.SampleRate))
+	}
+	return rules, nil
+}
+
+// tracerOptions translates options into tracer start options
+func tracerOptions(options TracerOptions) ([]tracer.StartOption, error) {
+	opts := []tracer.StartOption{tracer.WithRuntimeMetrics()}
+	if options.Service != "" {
+		opts = append(opts, tracer.WithService(options.Service))
+	}
+	if options.Env != "" {
+		opts = append(opts, tracer.WithEnv(options.Env))
+	}
+	if options.Version != "" {
+		opts = append(opts, tracer.WithServiceVersion(options.Version))
+	}
+	if options.AgentAddr != "" {
+		opts = append(opts, tracer.WithAgentAddr(options.AgentAddr))
+	}
+
+	rules, err := samplingRules(options)
+	if err != nil {
+		return nil, err
+	}
+	if len(rules) > 0 {
+		opts = append(opts, tracer.WithSamplingRules(rules))
+	}
+
+	for k, v := range options.Tags {
+		opts = append(opts, tracer.WithGlobalTag(k, v))
+	}
+
+	return opts, nil
+}
+
+// StartTracer starts the tracer of the configured backend
+func StartTracer(options TracerOptions) error {
+	switch options.Backend {
+	case "", TracingBackendDatadog:
+	case TracingBackendOTel:
+		if err := startOTel(options); err != nil {
+			return err
+		}
+		otelTracing.Store(true)
+		return nil
+	default:
+		return fmt.Errorf("unknown tracing backend '%s'", options.Backend)
+	}
+
+	opts, err := tracerOptions(options)
+	if err != nil {
+		return err
+	}
+	tracer.Start(opts...)
+	return nil
+}
+
+// StopTracer flushes and stops the tracer
+func StopTracer() {
+	if otelTracing.Load() {
+		stopOTel()
+		return
+	}
+	tracer.Stop()
+}
+
+// OTelTracing reports whether spans are sent with OpenTelemetry rather than Datadog
+func OTelTracing() bool {
+	return otelTracing.Load()
+}
+
+// Span is a span of the active tracing backend
+type Span interface {
+	SetTag(key string, value any)
+	// Finish ends the span, marking it failed when err is not nil
+	Finish(err error)
+}
+
+// StartSpan starts a span as a child of the span in ctx on the active tracing
+// backend and returns it with a context carrying it
+func StartSpan(ctx context.Context, name string) (Span, context.Context) {
+	if OTelTracing() {
+		return startOTelSpan(ctx, name)
+	}
+	span, ctx := tracer.StartSpanFromContext(ctx, name)
+	return ddSpan{span}, ctx
+}
+
+// ddSpan adapts a Datadog span to Span
+type ddSpan struct {
+	span ddtrace.Span
+}
+
+func (s ddSpan) SetTag(key string, value any) { s.span.SetTag(key, value) }
+func (s ddSpan) Finish(err error)             { s.span.Finish(tracer.WithError(err)) }
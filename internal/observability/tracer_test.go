@@ -0,0 +1,72 @@
+package observability
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseSamplingRule(t *testing.T) {
+	service, operation, rate, err := ParseSamplingRule("istio-test:http.request", "0.25")
+	require.NoError(t, err)
+	assert.Equal(t, "istio-test", service)
+	assert.Equal(t, "http.request", operation)
+	assert.Equal(t, 0.25, rate)
+
+	service, operation, _, err = ParseSamplingRule("istio-test", "1")
+	require.NoError(t, err)
+	assert.Equal(t, "istio-test", service)
+	assert.Empty(t, operation)
+
+	_, _, _, err = ParseSamplingRule(":http.request", "0.5")
+	assert.Error(t, err)
+	_, _, _, err = ParseSamplingRule("istio-test", "1.5")
+	assert.Error(t, err)
+	_, _, _, err = ParseSamplingRule("istio-test", "half")
+	assert.Error(t, err)
+}
+
+func TestSamplingRules(t *testing.T) {
+	rules, err := samplingRules(TracerOptions{
+		SampleRate: 0.1,
+		SamplingRules: map[string]string{
+			"istio-test":                "0.5",
+			"istio-test:metadata.fetch": "1",
+			"other":                     "0",
+		},
+	})
+	require.NoError(t, err)
+	require.Len(t, rules, 4)
+
+	// Operation rules come first and the catch-all rate comes last
+	encoded, err := json.Marshal(rules)
+	require.NoError(t, err)
+	var decoded []map[string]any
+	require.NoError(t, json.Unmarshal(encoded, &decoded))
+	assert.Equal(t, "metadata.fetch", decoded[0]["name"])
+	assert.Equal(t, "istio-test", decoded[1]["service"])
+	assert.Equal(t, "other", decoded[2]["service"])
+	assert.Equal(t, 0.1, decoded[3]["sample_rate"])
+
+	_, err = samplingRules(TracerOptions{SamplingRules: map[string]string{"istio-test": "2"}})
+	assert.Error(t, err)
+}
+
+func TestTracerOptions(t *testing.T) {
+	opts, err := tracerOptions(TracerOptions{})
+	require.NoError(t, err)
+	assert.Len(t, opts, 1)
+
+	opts, err = tracerOptions(TracerOptions{
+		Service:    "istio-test",
+		Env:        "test",
+		Version:    "v1",
+		AgentAddr:  "localhost:8126",
+		SampleRate: 0.5,
+		Tags:       map[string]string{"cluster": "a"},
+	})
+	require.NoError(t, err)
+	assert.Len(t, opts, 7)
+}
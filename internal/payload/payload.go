@@ -0,0 +1,182 @@
+// Package payload implements an endpoint generating response bodies of a
+// requested size.
+//
+// Envoy buffer limits, request and response size policies and the streaming
+// behaviour of gateways all depend on how large a body is and how it is paced.
+// The endpoint writes n bytes at once with a Content-Length, or streams them
+// in flushed chunks, optionally separated by a delay. The body is generated
+// from a fixed pattern, so its checksum is announced up front in the integrity
+// headers even when it is streamed.
+package payload
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"istio-test/internal/integrity"
+	"istio-test/internal/observability"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Query parameters of the payload endpoint
+const (
+	ChunkSizeParam = "chunk_size"  // Bytes written per chunk, each flushed to the client
+	DelayParam     = "chunk_delay" // Delay between chunks, e.g. 100ms
+)
+
+// Methods are the request methods the payload endpoint accepts
+var Methods = []string{"GET", "HEAD", "POST"}
+
+// pattern is the data payloads repeat; it is printable so that truncated
+// bodies can be spotted and 64 bytes long so that offsets are easy to check
+var pattern = []byte("abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789-\n")
+
+// block is written repeatedly to produce payloads
+var block = bytes.Repeat(pattern, 512)
+
+var payloadBytes = prometheus.NewCounter(prometheus.CounterOpts{
+	Namespace: "istio_test",
+	Name:      "payload_bytes_total",
+	Help:      "Total number of bytes written by the payload generator endpoint.",
+})
+
+func init() {
+	observability.MetricsRegistry().MustRegister(payloadBytes)
+}
+
+// Options configures the payload handler
+type Options struct {
+	MaxBytes    int           // Largest payload generated
+	MaxDuration time.Duration // Upper bound for the delays between the chunks of a payload
+}
+
+// request is a validated payload request
+type request struct {
+	size      int
+	chunkSize int
+	delay     time.Duration
+	streamed  bool // Chunks are flushed as they are written instead of sent with a Content-Length
+}
+
+// parseRequest parses the size in the last path segment and the chunking
+// query parameters
+func parseRequest(r *http.Request, prefix string, options Options) (request, error) {
+	value := strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, prefix), "/")
+	size, err := strconv.Atoi(value)
+	if err != nil || size < 0 || size > options.MaxBytes {
+		return request{}, fmt.Errorf("size must be a number of bytes between 0 and %d", options.MaxBytes)
+	}
+	req := request{size: size, chunkSize: size}
+
+	query := r.URL.Query()
+	if query.Has(ChunkSizeParam) {
+		chunkSize, err := strconv.Atoi(query.Get(ChunkSizeParam))
+		if err != nil || chunkSize < 1 {
+			return request{}, fmt.Errorf("%s must be a positive number of bytes", ChunkSizeParam)
+		}
+		req.chunkSize, req.streamed = min(chunkSize, size), true
+	}
+	if query.Has(DelayParam) {
+		delay, err := time.ParseDuration(query.Get(DelayParam))
+		if err != nil || delay < 0 {
+			return request{}, fmt.Errorf("%s must be a non-negative duration such as 100ms", DelayParam)
+		}
+		req.delay, req.streamed = delay, true
+	}
+
+	if req.delay > 0 && req.chunkSize > 0 {
+		chunks := (size + req.chunkSize - 1) / req.chunkSize
+		if total := time.Duration(chunks-1) * req.delay; total > options.MaxDuration {
+			return request{}, fmt.Errorf("%d chunks %v apart take %v, more than %v", chunks, req.delay, total, options.MaxDuration)
+		}
+	}
+	return req, nil
+}
+
+// fill writes size bytes of the payload starting at offset to w and returns
+// the number of bytes written
+func fill(w io.Writer, offset, size int) (int, error) {
+	written := 0
+	for written < size {
+		start := (offset + written) % len(pattern)
+		n, err := w.Write(block[start : start+min(size-written, len(block)-start)])
+		written += n
+		if err != nil {
+			return written, err
+		}
+	}
+	return written, nil
+}
+
+// write writes size bytes of the payload starting at offset to the client
+func write(w http.ResponseWriter, offset, size int) error {
+	n, err := fill(w, offset, size)
+	payloadBytes.Add(float64(n))
+	return err
+}
+
+// checksum returns the hex encoded SHA-256 of a payload of size bytes
+func checksum(size int) string {
+	hash := sha256.New()
+	_, _ = fill(hash, 0, size)
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+// Handler writes the number of bytes in the last path segment, e.g.
+// /istio-test/bytes/1048576. With chunk_size or chunk_delay the body is
+// streamed in chunks flushed one by one, chunk_delay apart, and sent without
+// Content-Length. Every response carries the SHA-256 and length of the body in
+// the integrity headers. Long streams are still bound by the server write
+// timeout.
+func Handler(prefix string, options Options) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		req, err := parseRequest(r, prefix, options)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Invalid request: %v", err), http.StatusBadRequest)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/octet-stream")
+		w.Header().Set("X-Content-Type-Options", "nosniff")
+		w.Header().Set(integrity.SHA256Header, checksum(req.size))
+		w.Header().Set(integrity.LengthHeader, strconv.Itoa(req.size))
+		if !req.streamed {
+			w.Header().Set("Content-Length", strconv.Itoa(req.size))
+		}
+		w.WriteHeader(http.StatusOK)
+		if r.Method == http.MethodHead || req.size == 0 {
+			return
+		}
+		if !req.streamed {
+			_ = write(w, 0, req.size)
+			return
+		}
+
+		controller := http.NewResponseController(w)
+		for offset := 0; offset < req.size; offset += req.chunkSize {
+			if offset > 0 && req.delay > 0 {
+				timer := time.NewTimer(req.delay)
+				select {
+				case <-r.Context().Done():
+					timer.Stop()
+					return
+				case <-timer.C:
+				}
+			}
+			if err := write(w, offset, min(req.chunkSize, req.size-offset)); err != nil {
+				return
+			}
+			if err := controller.Flush(); err != nil {
+				return
+			}
+		}
+	}
+}
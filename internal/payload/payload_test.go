@@ -0,0 +1,92 @@
+package payload
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"istio-test/internal/integrity"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var testOptions = Options{MaxBytes: 1 << 20, MaxDuration: time.Second}
+
+func serve(method, target string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	Handler("/istio-test/bytes/", testOptions)(w, httptest.NewRequest(method, target, nil))
+	return w
+}
+
+func TestHandler(t *testing.T) {
+	w := serve(http.MethodGet, "/istio-test/bytes/100000")
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.Equal(t, "100000", w.Header().Get("Content-Length"))
+	assert.Equal(t, "application/octet-stream", w.Header().Get("Content-Type"))
+	assert.Equal(t, 100000, w.Body.Len())
+	assert.False(t, w.Flushed)
+
+	body := w.Body.Bytes()
+	assert.Equal(t, pattern, body[:len(pattern)])
+	assert.Equal(t, pattern[:100000%len(pattern)], body[len(body)-100000%len(pattern):])
+
+	assert.Equal(t, integrity.Sum(body), w.Header().Get(integrity.SHA256Header))
+	assert.Equal(t, "100000", w.Header().Get(integrity.LengthHeader))
+
+	w = serve(http.MethodHead, "/istio-test/bytes/1024")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "1024", w.Header().Get("Content-Length"))
+	assert.Zero(t, w.Body.Len())
+
+	w = serve(http.MethodGet, "/istio-test/bytes/0")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Zero(t, w.Body.Len())
+}
+
+func TestHandlerStreamed(t *testing.T) {
+	start := time.Now()
+	w := serve(http.MethodGet, "/istio-test/bytes/1000?chunk_size=300&chunk_delay=10ms")
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.GreaterOrEqual(t, time.Since(start), 30*time.Millisecond, "three delays separate four chunks")
+	assert.Empty(t, w.Header().Get("Content-Length"))
+	assert.True(t, w.Flushed)
+
+	// Chunks continue the pattern where the previous one stopped
+	expected := bytes.Repeat(pattern, 1000/len(pattern)+1)[:1000]
+	assert.Equal(t, expected, w.Body.Bytes())
+
+	// The checksum of a streamed body is announced before the first chunk
+	assert.Equal(t, integrity.Sum(expected), w.Header().Get(integrity.SHA256Header))
+	assert.Equal(t, "1000", w.Header().Get(integrity.LengthHeader))
+}
+
+func TestHandlerInvalid(t *testing.T) {
+	for _, target := range []string{
+		"/istio-test/bytes/",
+		"/istio-test/bytes/ten",
+		"/istio-test/bytes/-1",
+		"/istio-test/bytes/2097152",
+		"/istio-test/bytes/10/20",
+		"/istio-test/bytes/100?chunk_size=0",
+		"/istio-test/bytes/100?chunk_delay=soon",
+		"/istio-test/bytes/100?chunk_size=1&chunk_delay=100ms",
+	} {
+		assert.Equal(t, http.StatusBadRequest, serve(http.MethodGet, target).Code, target)
+	}
+}
+
+func TestHandlerFlushesChunks(t *testing.T) {
+	server := httptest.NewServer(Handler("/istio-test/bytes/", testOptions))
+	defer server.Close()
+
+	response, err := http.Get(server.URL + "/istio-test/bytes/10?chunk_size=1&chunk_delay=100ms")
+	require.NoError(t, err)
+	buf := make([]byte, 1)
+	_, err = response.Body.Read(buf)
+	require.NoError(t, err, "the first chunk is flushed before the delays")
+	assert.Equal(t, pattern[:1], buf)
+	require.NoError(t, response.Body.Close())
+}
@@ -0,0 +1,155 @@
+// Package podinfo reports where in Kubernetes the serving pod runs.
+//
+// Pod name, namespace, node, pod IP and service account are read from
+// Downward API environment variables, falling back to Downward API and
+// service account files where Kubernetes can provide them that way. Labels
+// come from the Downward API labels file. Together with the cluster metadata
+// endpoints this tells exactly where a request landed.
+package podinfo
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"istio-test/internal/istioinfo"
+	"istio-test/internal/observability"
+)
+
+// Downward API environment variables read by Collect, set from the pod spec
+// with fieldRef metadata.name, metadata.namespace, spec.nodeName, status.podIP
+// and spec.serviceAccountName
+const (
+	PodNameEnv        = "POD_NAME"
+	PodNamespaceEnv   = "POD_NAMESPACE"
+	NodeNameEnv       = "NODE_NAME"
+	PodIPEnv          = "POD_IP"
+	ServiceAccountEnv = "POD_SERVICE_ACCOUNT"
+)
+
+// DefaultServiceAccountDir is where Kubernetes mounts the service account token
+const DefaultServiceAccountDir = "/var/run/secrets/kubernetes.io/serviceaccount"
+
+// Options configures where the pod information is read from
+type Options struct {
+	PodInfoDir        string // Directory of the Downward API files: name, namespace and labels
+	ServiceAccountDir string // Directory of the mounted service account, whose namespace file is a fallback
+}
+
+// Info is returned by Handler
+type Info struct {
+	PodName        string            `json:"pod_name,omitempty"`
+	Namespace      string            `json:"namespace,omitempty"`
+	NodeName       string            `json:"node_name,omitempty"`
+	PodIP          string            `json:"pod_ip,omitempty"`
+	ServiceAccount string            `json:"service_account,omitempty"`
+	Labels         map[string]string `json:"labels,omitempty"`
+	Sources        map[string]string `json:"sources"`                       // Where each reported field was read: env, file or hostname
+	Unavailable    []string          `json:"unavailable_sources,omitempty"` // Fields that could not be determined
+}
+
+// field resolves one value from an environment variable, then the fallbacks in order
+type field struct {
+	name      string
+	env       string
+	fallbacks []func() (string, string) // Return the value and its source name
+	target    *string
+}
+
+// fromFile returns a fallback reading a single-value file
+func fromFile(path string) func() (string, string) {
+	return func() (string, string) {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return "", ""
+		}
+		return strings.TrimSpace(string(data)), "file"
+	}
+}
+
+// fromHostname returns the hostname, which is the pod name unless the pod
+// spec sets hostname
+func fromHostname() (string, string) {
+	hostname, err := os.Hostname()
+	if err != nil {
+		return "", ""
+	}
+	return hostname, "hostname"
+}
+
+// Collect gathers the pod information. Fields that cannot be determined are
+// listed in the result rather than failing the collection.
+func Collect(options Options) Info {
+	info := Info{Sources: make(map[string]string)}
+
+	var podNameFallbacks, namespaceFallbacks []func() (string, string)
+	if options.PodInfoDir != "" {
+		podNameFallbacks = append(podNameFallbacks, fromFile(filepath.Join(options.PodInfoDir, "name")))
+		namespaceFallbacks = append(namespaceFallbacks, fromFile(filepath.Join(options.PodInfoDir, "namespace")))
+	}
+	podNameFallbacks = append(podNameFallbacks, fromHostname)
+	if options.ServiceAccountDir != "" {
+		namespaceFallbacks = append(namespaceFallbacks, fromFile(filepath.Join(options.ServiceAccountDir, "namespace")))
+	}
+
+	for _, f := range []field{
+		{name: "pod_name", env: PodNameEnv, fallbacks: podNameFallbacks, target: &info.PodName},
+		{name: "namespace", env: PodNamespaceEnv, fallbacks: namespaceFallbacks, target: &info.Namespace},
+		{name: "node_name", env: NodeNameEnv, target: &info.NodeName},
+		{name: "pod_ip", env: PodIPEnv, target: &info.PodIP},
+		{name: "service_account", env: ServiceAccountEnv, target: &info.ServiceAccount},
+	} {
+		value, source := f.resolve()
+		if value == "" {
+			info.Unavailable = append(info.Unavailable, f.name)
+			continue
+		}
+		*f.target = value
+		info.Sources[f.name] = source
+	}
+
+	if options.PodInfoDir != "" {
+		labels, err := istioinfo.ReadPodInfoFile(filepath.Join(options.PodInfoDir, "labels"))
+		if err == nil {
+			info.Labels = labels
+			info.Sources["labels"] = "file"
+		}
+	}
+	if info.Labels == nil {
+		info.Unavailable = append(info.Unavailable, "labels")
+	}
+
+	return info
+}
+
+// resolve returns the value of the field and its source
+func (f field) resolve() (string, string) {
+	if value := strings.TrimSpace(os.Getenv(f.env)); value != "" {
+		return value, "env"
+	}
+	for _, fallback := range f.fallbacks {
+		if value, source := fallback(); value != "" {
+			return value, source
+		}
+	}
+	return "", ""
+}
+
+// Handler returns the pod information as JSON
+func Handler(options Options) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		jsonData, err := json.Marshal(Collect(options))
+		if err != nil {
+			observability.ErrorWithContext(r.Context(), fmt.Sprintf("Error encoding pod info: %v", err))
+			http.Error(w, "Failed to encode pod info", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		_, _ = w.Write(jsonData)
+	}
+}
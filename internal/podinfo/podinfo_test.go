@@ -0,0 +1,85 @@
+package podinfo
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// clearEnv unsets the Downward API variables for the test
+func clearEnv(t *testing.T) {
+	for _, env := range []string{PodNameEnv, PodNamespaceEnv, NodeNameEnv, PodIPEnv, ServiceAccountEnv} {
+		t.Setenv(env, "")
+	}
+}
+
+func TestCollectFromEnv(t *testing.T) {
+	clearEnv(t)
+	t.Setenv(PodNameEnv, "istio-test-5d9f8c7b6-x2k4q")
+	t.Setenv(PodNamespaceEnv, "istio-test")
+	t.Setenv(NodeNameEnv, "gke-pool-1-abcd")
+	t.Setenv(PodIPEnv, "10.0.0.12")
+	t.Setenv(ServiceAccountEnv, "istio-test")
+
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "name"), []byte("from-file"), 0600))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "labels"), []byte("app=\"istio-test\"\nversion=\"v2\"\n"), 0600))
+
+	info := Collect(Options{PodInfoDir: dir})
+
+	assert.Equal(t, "istio-test-5d9f8c7b6-x2k4q", info.PodName)
+	assert.Equal(t, "istio-test", info.Namespace)
+	assert.Equal(t, "gke-pool-1-abcd", info.NodeName)
+	assert.Equal(t, "10.0.0.12", info.PodIP)
+	assert.Equal(t, "istio-test", info.ServiceAccount)
+	assert.Equal(t, map[string]string{"app": "istio-test", "version": "v2"}, info.Labels)
+	assert.Equal(t, "env", info.Sources["pod_name"])
+	assert.Equal(t, "file", info.Sources["labels"])
+	assert.Empty(t, info.Unavailable)
+}
+
+func TestCollectFallbacks(t *testing.T) {
+	clearEnv(t)
+
+	podInfoDir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(podInfoDir, "name"), []byte("istio-test-abc\n"), 0600))
+	serviceAccountDir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(serviceAccountDir, "namespace"), []byte("team-a"), 0600))
+
+	info := Collect(Options{PodInfoDir: podInfoDir, ServiceAccountDir: serviceAccountDir})
+
+	assert.Equal(t, "istio-test-abc", info.PodName)
+	assert.Equal(t, "file", info.Sources["pod_name"])
+	assert.Equal(t, "team-a", info.Namespace)
+	assert.Equal(t, "file", info.Sources["namespace"])
+	assert.Equal(t, []string{"node_name", "pod_ip", "service_account", "labels"}, info.Unavailable)
+
+	// Without the Downward API files the hostname stands in for the pod name
+	info = Collect(Options{})
+	hostname, _ := os.Hostname()
+	assert.Equal(t, hostname, info.PodName)
+	assert.Equal(t, "hostname", info.Sources["pod_name"])
+	assert.Contains(t, info.Unavailable, "namespace")
+}
+
+func TestHandler(t *testing.T) {
+	clearEnv(t)
+	t.Setenv(PodIPEnv, "10.0.0.12")
+
+	w := httptest.NewRecorder()
+	Handler(Options{})(w, httptest.NewRequest(http.MethodGet, "/istio-test/podinfo", nil))
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "application/json", w.Header().Get("Content-Type"))
+
+	var info Info
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &info))
+	assert.Equal(t, "10.0.0.12", info.PodIP)
+	assert.Equal(t, "env", info.Sources["pod_ip"])
+}
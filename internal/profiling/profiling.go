@@ -0,0 +1,173 @@
+// Package profiling serves the net/http/pprof endpoints behind short-lived
+// signed tokens.
+//
+// Tokens are minted by an admin endpoint, which requires the admin token, for
+// a single profile (for example "heap" or "profile") or for all of them, and
+// expire after a bounded TTL. This lets engineers be granted temporary
+// profiling access during an incident without handing out the admin token. Tokens are passed in the token
+// query parameter, so they work with go tool pprof, or as a bearer token.
+package profiling
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/pprof"
+	"net/url"
+	runtimepprof "runtime/pprof"
+	"strings"
+	"time"
+
+	"istio-test/internal/observability"
+	"istio-test/internal/security"
+)
+
+const (
+	// Prefix is the path the profiling endpoints are served under
+	Prefix = "/debug/pprof/"
+
+	// IndexScope grants access to the profile index at Prefix
+	IndexScope = "index"
+
+	// DefaultTokenTTL is used when a token request does not set a TTL
+	DefaultTokenTTL = 15 * time.Minute
+
+	maxTokenRequestBytes = 4 << 10
+)
+
+// TokenRequest is the body accepted by TokenHandler
+type TokenRequest struct {
+	Scope string `json:"scope" schema:"required"`                // Profile name, "index" or "*"
+	TTL   string `json:"ttl,omitempty" schema:"format=duration"` // Go duration, defaults to DefaultTokenTTL
+}
+
+// TokenResponse is returned by TokenHandler
+type TokenResponse struct {
+	Token     string    `json:"token"`
+	Scope     string    `json:"scope"`
+	ExpiresAt time.Time `json:"expires_at"`
+	URL       string    `json:"url"` // Relative URL of the granted endpoint including the token
+}
+
+// scopeFor returns the token scope required for a request path
+func scopeFor(path string) string {
+	name := strings.TrimPrefix(path, Prefix)
+	if name == "" {
+		return IndexScope
+	}
+	return name
+}
+
+// validScope reports whether scope names an endpoint served by Handler
+func validScope(scope string) bool {
+	switch scope {
+	case security.ScopeAll, IndexScope, "cmdline", "profile", "symbol", "trace":
+		return true
+	}
+	return runtimepprof.Lookup(scope) != nil
+}
+
+// requestToken returns the token of r from the token query parameter or the
+// Authorization header
+func requestToken(r *http.Request) string {
+	if token := r.URL.Query().Get("token"); token != "" {
+		return token
+	}
+	if token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer "); ok {
+		return token
+	}
+	return ""
+}
+
+// Handler serves the pprof endpoints under Prefix to requests carrying a
+// valid token for the requested profile
+func Handler(signer *security.TokenSigner) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		scope := scopeFor(r.URL.Path)
+		token := requestToken(r)
+		if token == "" {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			http.Error(w, "Profiling token required", http.StatusUnauthorized)
+			return
+		}
+		if err := signer.Verify(token, scope); err != nil {
+			if errors.Is(err, security.ErrTokenScope) {
+				http.Error(w, fmt.Sprintf("Token does not grant access to %s", scope), http.StatusForbidden)
+				return
+			}
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			http.Error(w, fmt.Sprintf("Profiling token rejected: %v", err), http.StatusUnauthorized)
+			return
+		}
+
+		switch scope {
+		case IndexScope:
+			pprof.Index(w, r)
+		case "cmdline":
+			pprof.Cmdline(w, r)
+		case "profile":
+			pprof.Profile(w, r)
+		case "symbol":
+			pprof.Symbol(w, r)
+		case "trace":
+			pprof.Trace(w, r)
+		default:
+			pprof.Handler(scope).ServeHTTP(w, r)
+		}
+	}
+}
+
+// TokenHandler mints tokens for the pprof endpoints. Tokens never outlive
+// maxTTL.
+func TokenHandler(signer *security.TokenSigner, maxTTL time.Duration) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req TokenRequest
+		decoder := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxTokenRequestBytes))
+		decoder.DisallowUnknownFields()
+		if err := decoder.Decode(&req); err != nil {
+			http.Error(w, fmt.Sprintf("Invalid token request: %v", err), http.StatusBadRequest)
+			return
+		}
+		if !validScope(req.Scope) {
+			http.Error(w, fmt.Sprintf("Invalid token request: unknown scope '%s'", req.Scope), http.StatusBadRequest)
+			return
+		}
+
+		ttl := min(DefaultTokenTTL, maxTTL)
+		if req.TTL != "" {
+			parsed, err := time.ParseDuration(req.TTL)
+			if err != nil || parsed <= 0 {
+				http.Error(w, fmt.Sprintf("Invalid token request: invalid ttl '%s'", req.TTL), http.StatusBadRequest)
+				return
+			}
+			if parsed > maxTTL {
+				http.Error(w, fmt.Sprintf("Invalid token request: ttl %v exceeds maximum %v", parsed, maxTTL), http.StatusBadRequest)
+				return
+			}
+			ttl = parsed
+		}
+
+		token, expiresAt := signer.Sign(req.Scope, ttl)
+		path := Prefix
+		if req.Scope != security.ScopeAll && req.Scope != IndexScope {
+			path += req.Scope
+		}
+		observability.InfoWithContext(r.Context(), fmt.Sprintf("Profiling token for scope %s minted, expires at %s", req.Scope, expiresAt.Format(time.RFC3339)))
+
+		jsonData, err := json.Marshal(TokenResponse{
+			Token:     token,
+			Scope:     req.Scope,
+			ExpiresAt: expiresAt.UTC(),
+			URL:       path + "?token=" + url.QueryEscape(token),
+		})
+		if err != nil {
+			http.Error(w, "Failed to encode token", http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Cache-Control", "no-store")
+		w.WriteHeader(http.StatusOK)
+		_, _ = w.Write(jsonData)
+	}
+}
@@ -0,0 +1,93 @@
+package profiling
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"istio-test/internal/security"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newSigner(t *testing.T) *security.TokenSigner {
+	signer, err := security.NewTokenSigner(nil)
+	require.NoError(t, err)
+	return signer
+}
+
+func mintToken(t *testing.T, signer *security.TokenSigner, body string) (*httptest.ResponseRecorder, TokenResponse) {
+	w := httptest.NewRecorder()
+	TokenHandler(signer, time.Hour)(w, httptest.NewRequest(http.MethodPost, "/admin/pprof/token", strings.NewReader(body)))
+	var resp TokenResponse
+	if w.Code == http.StatusOK {
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	}
+	return w, resp
+}
+
+func TestTokenHandler(t *testing.T) {
+	signer := newSigner(t)
+
+	w, resp := mintToken(t, signer, `{"scope":"heap","ttl":"5m"}`)
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "no-store", w.Header().Get("Cache-Control"))
+	assert.Equal(t, "heap", resp.Scope)
+	assert.WithinDuration(t, time.Now().Add(5*time.Minute), resp.ExpiresAt, 2*time.Second)
+	assert.True(t, strings.HasPrefix(resp.URL, "/debug/pprof/heap?token="))
+	assert.NoError(t, signer.Verify(resp.Token, "heap"))
+
+	w, resp = mintToken(t, signer, `{"scope":"*"}`)
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.WithinDuration(t, time.Now().Add(DefaultTokenTTL), resp.ExpiresAt, 2*time.Second)
+	assert.True(t, strings.HasPrefix(resp.URL, "/debug/pprof/?token="))
+
+	for _, body := range []string{
+		`{"scope":"unknown"}`,
+		`{"scope":"heap","ttl":"2h"}`,
+		`{"scope":"heap","ttl":"-1m"}`,
+		`{"scope":"heap","extra":true}`,
+		`not json`,
+	} {
+		w, _ := mintToken(t, signer, body)
+		assert.Equal(t, http.StatusBadRequest, w.Code, body)
+	}
+}
+
+func TestHandler(t *testing.T) {
+	signer := newSigner(t)
+	heapToken, _ := signer.Sign("heap", time.Minute)
+	allToken, _ := signer.Sign(security.ScopeAll, time.Minute)
+
+	tests := []struct {
+		name   string
+		target string
+		header string
+		status int
+	}{
+		{name: "missing token", target: "/debug/pprof/heap", status: http.StatusUnauthorized},
+		{name: "invalid token", target: "/debug/pprof/heap?token=invalid", status: http.StatusUnauthorized},
+		{name: "query token", target: "/debug/pprof/heap?token=" + heapToken, status: http.StatusOK},
+		{name: "bearer token", target: "/debug/pprof/heap", header: "Bearer " + heapToken, status: http.StatusOK},
+		{name: "wrong scope", target: "/debug/pprof/goroutine?token=" + heapToken, status: http.StatusForbidden},
+		{name: "index needs its own scope", target: "/debug/pprof/?token=" + heapToken, status: http.StatusForbidden},
+		{name: "wildcard index", target: "/debug/pprof/?token=" + allToken, status: http.StatusOK},
+		{name: "wildcard profile", target: "/debug/pprof/goroutine?debug=1&token=" + allToken, status: http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, tt.target, nil)
+			if tt.header != "" {
+				req.Header.Set("Authorization", tt.header)
+			}
+			w := httptest.NewRecorder()
+			Handler(signer)(w, req)
+			assert.Equal(t, tt.status, w.Code, w.Body.String())
+		})
+	}
+}
@@ -0,0 +1,206 @@
+package proxy
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"net/http"
+	"net/url"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"istio-test/internal/goroutines"
+	"istio-test/internal/httpclient"
+	"istio-test/internal/observability"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// MirrorHeader marks mirrored requests, so the mirror target can tell them
+// from its own traffic
+const MirrorHeader = "X-Istio-Test-Mirror"
+
+// Mirror delivery results
+const (
+	MirrorDelivered = "delivered" // The mirror target responded, whatever the status
+	MirrorFailed    = "failed"    // The request failed without a response
+	MirrorDropped   = "dropped"   // Too many mirrored requests were in flight
+)
+
+var (
+	mirrorRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "istio_test",
+		Name:      "proxy_mirror_requests_total",
+		Help:      "Total number of proxied requests mirrored to the secondary target by result (delivered, failed, dropped).",
+	}, []string{"result"})
+
+	mirrorDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: "istio_test",
+		Name:      "proxy_mirror_request_duration_seconds",
+		Help:      "Duration of mirrored requests that got a response, by status class.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"status_class"})
+)
+
+func init() {
+	observability.MetricsRegistry().MustRegister(mirrorRequests, mirrorDuration)
+}
+
+// MirrorOptions configures request mirroring
+type MirrorOptions struct {
+	Target      string  // Base URL whose scheme and host replace those of the forwarded URL
+	SampleRate  float64 // Fraction of forwarded requests that are mirrored
+	MaxInFlight int     // Mirrored requests in flight above which new ones are dropped, zero means 100
+}
+
+// MirrorStats reports the delivery of mirrored requests
+type MirrorStats struct {
+	Target      string           `json:"target"`
+	SampleRate  float64          `json:"sample_rate"`
+	Forwarded   int64            `json:"forwarded"` // Requests forwarded by the proxy, mirrored or not
+	Mirrored    int64            `json:"mirrored"`  // Requests selected by sampling
+	Delivered   int64            `json:"delivered"`
+	Failed      int64            `json:"failed"`
+	Dropped     int64            `json:"dropped"`
+	InFlight    int64            `json:"in_flight"`
+	StatusClass map[string]int64 `json:"status_class"` // Delivered requests by status class
+}
+
+// Mirror sends fire-and-forget copies of forwarded requests to a secondary
+// target, like the mirror policy of an Istio VirtualService. Responses of the
+// mirror are discarded and never delay or change the proxied response.
+type Mirror struct {
+	client  *httpclient.Client
+	target  *url.URL
+	options MirrorOptions
+	sample  func() float64
+
+	forwarded atomic.Int64
+	mirrored  atomic.Int64
+	inFlight  atomic.Int64
+
+	mu          sync.Mutex
+	results     map[string]int64
+	statusClass map[string]int64
+}
+
+// NewMirror creates a mirror sending requests through client
+func NewMirror(client *httpclient.Client, options MirrorOptions) (*Mirror, error) {
+	target, err := url.Parse(options.Target)
+	if err != nil || (target.Scheme != "http" && target.Scheme != "https") || target.Host == "" {
+		return nil, fmt.Errorf("invalid mirror target %q: must be an absolute http or https URL", options.Target)
+	}
+	if options.MaxInFlight <= 0 {
+		options.MaxInFlight = 100
+	}
+	return &Mirror{
+		client:      client,
+		target:      target,
+		options:     options,
+		sample:      rand.Float64,
+		results:     make(map[string]int64),
+		statusClass: make(map[string]int64),
+	}, nil
+}
+
+// Send mirrors a sampled share of the requests forwarded to u in the
+// background; header holds the headers of the forwarded request
+func (m *Mirror) Send(ctx context.Context, u *url.URL, header http.Header) {
+	m.forwarded.Add(1)
+	if m.sample() >= m.options.SampleRate {
+		return
+	}
+	m.mirrored.Add(1)
+	if m.inFlight.Add(1) > int64(m.options.MaxInFlight) {
+		m.inFlight.Add(-1)
+		m.record(MirrorDropped, "")
+		return
+	}
+
+	mirrored := *u
+	mirrored.Scheme = m.target.Scheme
+	mirrored.Host = m.target.Host
+	header = header.Clone()
+	header.Set(MirrorHeader, "true")
+
+	// The mirrored request outlives the proxied one but keeps its trace
+	goroutines.Go(context.WithoutCancel(ctx), "mirror", func(ctx context.Context) {
+		defer m.inFlight.Add(-1)
+		start := time.Now()
+		resp, err := m.client.Do(ctx, func(ctx context.Context) (*http.Request, error) {
+			req, err := http.NewRequestWithContext(ctx, http.MethodGet, mirrored.String(), nil)
+			if err != nil {
+				return nil, err
+			}
+			req.Header = header.Clone()
+			return req, nil
+		})
+		if err != nil {
+			observability.WarnWithFields(ctx, fmt.Sprintf("Mirrored request to %s failed: %v", mirrored.Redacted(), err), map[string]any{
+				"type":        "proxy_mirror",
+				"url":         mirrored.Redacted(),
+				"error":       err.Error(),
+				"duration_ms": observability.Milliseconds(time.Since(start)),
+			})
+			m.record(MirrorFailed, "")
+			return
+		}
+		_, _ = io.Copy(io.Discard, resp.Body)
+		resp.Body.Close()
+
+		statusClass := observability.StatusClass(resp.StatusCode)
+		mirrorDuration.WithLabelValues(statusClass).Observe(time.Since(start).Seconds())
+		m.record(MirrorDelivered, statusClass)
+	})
+}
+
+// record counts the result of a mirrored request
+func (m *Mirror) record(result, statusClass string) {
+	mirrorRequests.WithLabelValues(result).Inc()
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.results[result]++
+	if statusClass != "" {
+		m.statusClass[statusClass]++
+	}
+}
+
+// Stats returns the delivery statistics since the mirror was created
+func (m *Mirror) Stats() MirrorStats {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	stats := MirrorStats{
+		Target:      m.target.String(),
+		SampleRate:  m.options.SampleRate,
+		Forwarded:   m.forwarded.Load(),
+		Mirrored:    m.mirrored.Load(),
+		Delivered:   m.results[MirrorDelivered],
+		Failed:      m.results[MirrorFailed],
+		Dropped:     m.results[MirrorDropped],
+		InFlight:    m.inFlight.Load(),
+		StatusClass: make(map[string]int64, len(m.statusClass)),
+	}
+	for class, count := range m.statusClass {
+		stats.StatusClass[class] = count
+	}
+	return stats
+}
+
+// Handler reports the delivery statistics
+func (m *Mirror) Handler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		jsonData, err := json.Marshal(m.Stats())
+		if err != nil {
+			observability.ErrorWithContext(r.Context(), fmt.Sprintf("Error encoding mirror stats: %v", err))
+			http.Error(w, "Failed to encode mirror stats", http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		_, _ = w.Write(jsonData)
+	}
+}
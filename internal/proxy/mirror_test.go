@@ -0,0 +1,120 @@
+package proxy
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"istio-test/internal/httpclient"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHandlerWithMirror(t *testing.T) {
+	primary := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Empty(t, r.Header.Get(MirrorHeader))
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer primary.Close()
+
+	mirrored := make(chan *http.Request, 10)
+	secondary := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mirrored <- r
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer secondary.Close()
+
+	mirror, err := NewMirror(newClient(), MirrorOptions{Target: secondary.URL, SampleRate: 1})
+	require.NoError(t, err)
+	handler := HandlerWithMirror(newClient(), httpclient.Allowlist{"127.0.0.1"}, mirror)
+
+	w := call(handler, primary.URL+"/istio-test/echo?x=1", map[string]string{"X-B3-Traceid": "abc", "Cookie": "secret"})
+	assert.Equal(t, http.StatusOK, w.Code, "the mirror response does not change the proxied one")
+
+	select {
+	case r := <-mirrored:
+		assert.Equal(t, "/istio-test/echo", r.URL.Path)
+		assert.Equal(t, "x=1", r.URL.RawQuery)
+		assert.Equal(t, "true", r.Header.Get(MirrorHeader))
+		assert.Equal(t, "abc", r.Header.Get("X-B3-Traceid"))
+		assert.Equal(t, "1", r.Header.Get(HopsHeader))
+		assert.Empty(t, r.Header.Get("Cookie"))
+	case <-time.After(5 * time.Second):
+		t.Fatal("request was not mirrored")
+	}
+
+	assert.Eventually(t, func() bool { return mirror.Stats().Delivered == 1 }, 5*time.Second, 10*time.Millisecond)
+	stats := mirror.Stats()
+	assert.Equal(t, int64(1), stats.Forwarded)
+	assert.Equal(t, int64(1), stats.StatusClass["server_error"])
+}
+
+func TestMirrorSampling(t *testing.T) {
+	var requests atomic.Int32
+	secondary := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+	}))
+	defer secondary.Close()
+
+	mirror, err := NewMirror(newClient(), MirrorOptions{Target: secondary.URL, SampleRate: 0.5})
+	require.NoError(t, err)
+	samples := []float64{0.1, 0.7, 0.4, 0.9}
+	mirror.sample = func() float64 {
+		next := samples[0]
+		samples = samples[1:]
+		return next
+	}
+
+	u := mustParse(t, "http://backend.istio-test.svc.cluster.local/istio-test/echo")
+	for range 4 {
+		mirror.Send(t.Context(), u, http.Header{})
+	}
+
+	assert.Eventually(t, func() bool { return mirror.Stats().Delivered == 2 }, 5*time.Second, 10*time.Millisecond)
+	assert.Equal(t, int32(2), requests.Load())
+	stats := mirror.Stats()
+	assert.Equal(t, int64(4), stats.Forwarded)
+	assert.Equal(t, int64(2), stats.Mirrored)
+}
+
+func TestMirrorDropsAboveMaxInFlight(t *testing.T) {
+	release := make(chan struct{})
+	secondary := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer secondary.Close()
+	defer close(release)
+
+	mirror, err := NewMirror(newClient(), MirrorOptions{Target: secondary.URL, SampleRate: 1, MaxInFlight: 1})
+	require.NoError(t, err)
+	u := mustParse(t, "http://backend/istio-test/echo")
+	mirror.Send(t.Context(), u, http.Header{})
+	mirror.Send(t.Context(), u, http.Header{})
+
+	stats := mirror.Stats()
+	assert.Equal(t, int64(1), stats.Dropped)
+	assert.Equal(t, int64(1), stats.InFlight)
+
+	w := httptest.NewRecorder()
+	mirror.Handler()(w, httptest.NewRequest(http.MethodGet, "/admin/mirror", nil))
+	var response MirrorStats
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	assert.Equal(t, int64(1), response.Dropped)
+}
+
+func TestNewMirrorInvalidTarget(t *testing.T) {
+	_, err := NewMirror(newClient(), MirrorOptions{Target: "backend:8080"})
+	assert.Error(t, err)
+}
+
+func mustParse(t *testing.T, rawURL string) *url.URL {
+	t.Helper()
+	u, err := url.Parse(rawURL)
+	require.NoError(t, err)
+	return u
+}
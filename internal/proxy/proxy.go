@@ -0,0 +1,186 @@
+// Package proxy implements an endpoint that calls another in-mesh service.
+//
+// Chaining proxy calls (A -> B -> C) exercises Istio routing, retries and
+// distributed tracing across hops. Targets are restricted to an allowlist of
+// hosts, trace context headers of the inbound request are propagated so
+// Envoy spans join one trace, and a hop counter stops accidental loops.
+// Forwarded requests can be mirrored to a secondary target, to compare
+// application-level mirroring with Istio's mirror policy.
+package proxy
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"istio-test/internal/httpclient"
+	"istio-test/internal/observability"
+)
+
+const (
+	// HopsHeader counts the proxy hops a request has passed through
+	HopsHeader = "X-Istio-Test-Hops"
+
+	// MaxHops is the longest call chain that is followed
+	MaxHops = 10
+
+	maxBodyBytes = 1 << 20
+)
+
+// TraceHeaders are the trace context headers Envoy needs the application to
+// propagate for spans of consecutive hops to join one trace
+var TraceHeaders = []string{
+	"X-Request-Id",
+	"Traceparent",
+	"Tracestate",
+	"Baggage",
+	"X-B3-Traceid",
+	"X-B3-Spanid",
+	"X-B3-Parentspanid",
+	"X-B3-Sampled",
+	"X-B3-Flags",
+	"B3",
+	"X-Ot-Span-Context",
+	"X-Cloud-Trace-Context",
+	"Grpc-Trace-Bin",
+}
+
+// Response describes the downstream call
+type Response struct {
+	URL           string              `json:"url"`
+	Host          string              `json:"host,omitempty"` // Host header override
+	SNI           string              `json:"sni,omitempty"`  // TLS server name override
+	Status        int                 `json:"status,omitempty"`
+	DurationMs    float64             `json:"duration_ms"`
+	Headers       map[string][]string `json:"headers,omitempty"`
+	Body          json.RawMessage     `json:"body,omitempty"` // Set when the downstream body is JSON, so chains nest
+	BodyText      string              `json:"body_text,omitempty"`
+	BodyTruncated bool                `json:"body_truncated,omitempty"`
+	Error         string              `json:"error,omitempty"`
+}
+
+// Handler calls the URL in the url query parameter and returns the response
+// with its timing. The response status mirrors the downstream status, so
+// retries and outlier detection see failures of later hops; 502 is returned
+// when the call fails without a response.
+func Handler(client *httpclient.Client, allowlist httpclient.Allowlist) http.HandlerFunc {
+	return HandlerWithMirror(client, allowlist, nil)
+}
+
+// HandlerWithMirror is Handler that also mirrors forwarded requests through
+// mirror, unless it is nil
+func HandlerWithMirror(client *httpclient.Client, allowlist httpclient.Allowlist, mirror *Mirror) http.HandlerFunc {
+	return HandlerWithOptions(client, Options{Allowlist: allowlist, Mirror: mirror})
+}
+
+// Options configures the proxy endpoint
+type Options struct {
+	Allowlist         httpclient.Allowlist // Hosts that may be called
+	OverrideAllowlist httpclient.Allowlist // Hosts allowed in the host and sni query parameters
+	Mirror            *Mirror              // Mirrors forwarded requests unless nil
+}
+
+// HandlerWithOptions is Handler configured by options. The host and sni query
+// parameters override the Host header and TLS server name of the call, so
+// ServiceEntry resolution, SNI routing at egress gateways and virtual host
+// mismatches can be exercised; both must match OverrideAllowlist.
+func HandlerWithOptions(client *httpclient.Client, options Options) http.HandlerFunc {
+	allowlist, mirror := options.Allowlist, options.Mirror
+
+	// Redirects are followed only to allowlisted hosts
+	client = client.WithCheckRedirect(allowlist.CheckRedirect)
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+		target := query.Get("url")
+		u, err := url.Parse(target)
+		if target == "" || err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			http.Error(w, "Query parameter url must be an absolute http or https URL", http.StatusBadRequest)
+			return
+		}
+		if !allowlist.Allows(u.Host) {
+			http.Error(w, fmt.Sprintf("Host %s is not allowlisted", u.Hostname()), http.StatusForbidden)
+			return
+		}
+		overrides := httpclient.Overrides{Host: query.Get("host"), SNI: query.Get("sni")}
+		if err := overrides.Validate(options.OverrideAllowlist); err != nil {
+			http.Error(w, fmt.Sprintf("Invalid override: %v", err), http.StatusForbidden)
+			return
+		}
+
+		hops, _ := strconv.Atoi(r.Header.Get(HopsHeader))
+		if hops >= MaxHops {
+			http.Error(w, fmt.Sprintf("Call chain exceeds %d hops", MaxHops), http.StatusLoopDetected)
+			return
+		}
+
+		header := make(http.Header)
+		for _, name := range TraceHeaders {
+			if values := r.Header.Values(name); len(values) > 0 {
+				header[name] = values
+			}
+		}
+		header.Set(HopsHeader, strconv.Itoa(hops+1))
+		if mirror != nil {
+			mirror.Send(r.Context(), u, header)
+		}
+
+		start := time.Now()
+		resp, err := client.Do(r.Context(), func(ctx context.Context) (*http.Request, error) {
+			req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+			if err != nil {
+				return nil, err
+			}
+			req.Header = header.Clone()
+			return overrides.Apply(req), nil
+		})
+
+		response := Response{URL: u.String(), Host: overrides.Host, SNI: overrides.SNI}
+		status := http.StatusBadGateway
+		if err != nil {
+			observability.WarnWithFields(r.Context(), fmt.Sprintf("Proxy call to %s failed: %v", u.Redacted(), err), map[string]any{
+				"type":        "proxy_call",
+				"url":         u.Redacted(),
+				"error":       err.Error(),
+				"duration_ms": observability.Milliseconds(time.Since(start)),
+			})
+			response.Error = err.Error()
+		} else {
+			body, readErr := io.ReadAll(io.LimitReader(resp.Body, maxBodyBytes+1))
+			resp.Body.Close()
+			if readErr != nil {
+				response.Error = readErr.Error()
+			}
+			if len(body) > maxBodyBytes {
+				body = body[:maxBodyBytes]
+				response.BodyTruncated = true
+			}
+			if !response.BodyTruncated && json.Valid(body) {
+				response.Body = bytes.TrimSpace(body)
+			} else {
+				response.BodyText = string(body)
+			}
+			response.Status = resp.StatusCode
+			response.Headers = resp.Header
+			status = resp.StatusCode
+		}
+		response.DurationMs = float64(time.Since(start).Microseconds()) / 1000
+
+		jsonData, err := json.Marshal(response)
+		if err != nil {
+			observability.ErrorWithContext(r.Context(), fmt.Sprintf("Error encoding proxy response: %v", err))
+			http.Error(w, "Failed to encode proxy response", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		_, _ = w.Write(jsonData)
+	}
+}
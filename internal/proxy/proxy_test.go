@@ -0,0 +1,195 @@
+package proxy
+
+import (
+	"crypto/tls"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"istio-test/internal/httpclient"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newClient() *httpclient.Client {
+	return httpclient.NewFactory(nil, nil).Client("proxy-test")
+}
+
+func call(handler http.HandlerFunc, target string, headers map[string]string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodGet, "/istio-test/proxy?url="+url.QueryEscape(target), nil)
+	for name, value := range headers {
+		req.Header.Set(name, value)
+	}
+	w := httptest.NewRecorder()
+	handler(w, req)
+	return w
+}
+
+func callWithOverrides(handler http.HandlerFunc, target, host, sni string) *httptest.ResponseRecorder {
+	query := url.Values{"url": {target}, "host": {host}, "sni": {sni}}
+	w := httptest.NewRecorder()
+	handler(w, httptest.NewRequest(http.MethodGet, "/istio-test/proxy?"+query.Encode(), nil))
+	return w
+}
+
+func TestHandler(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusAccepted)
+		_ = json.NewEncoder(w).Encode(map[string]string{
+			"request_id": r.Header.Get("X-Request-Id"),
+			"b3":         r.Header.Get("X-B3-Traceid"),
+			"hops":       r.Header.Get(HopsHeader),
+			"cookie":     r.Header.Get("Cookie"),
+		})
+	}))
+	defer ts.Close()
+
+	handler := Handler(newClient(), httpclient.Allowlist{"127.0.0.1"})
+	w := call(handler, ts.URL+"/next", map[string]string{
+		"X-Request-Id": "req-1",
+		"X-B3-Traceid": "abc",
+		HopsHeader:     "2",
+		"Cookie":       "session=secret",
+	})
+
+	require.Equal(t, http.StatusAccepted, w.Code)
+	var response Response
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	assert.Equal(t, ts.URL+"/next", response.URL)
+	assert.Equal(t, http.StatusAccepted, response.Status)
+	assert.GreaterOrEqual(t, response.DurationMs, 0.0)
+	assert.JSONEq(t, `{"request_id":"req-1","b3":"abc","hops":"3","cookie":""}`, string(response.Body))
+}
+
+func TestHandlerTextBody(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "upstream failure", http.StatusServiceUnavailable)
+	}))
+	defer ts.Close()
+
+	w := call(Handler(newClient(), httpclient.Allowlist{"127.0.0.1"}), ts.URL, nil)
+	require.Equal(t, http.StatusServiceUnavailable, w.Code)
+	var response Response
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	assert.Equal(t, "upstream failure\n", response.BodyText)
+	assert.Empty(t, response.Body)
+}
+
+func TestHandlerRejectsRequests(t *testing.T) {
+	handler := Handler(newClient(), httpclient.Allowlist{"*.svc.cluster.local"})
+
+	tests := []struct {
+		name    string
+		target  string
+		headers map[string]string
+		status  int
+	}{
+		{name: "missing url", target: "", status: http.StatusBadRequest},
+		{name: "relative url", target: "/istio-test/echo", status: http.StatusBadRequest},
+		{name: "unsupported scheme", target: "file:///etc/passwd", status: http.StatusBadRequest},
+		{name: "host not allowlisted", target: "http://169.254.169.254/", status: http.StatusForbidden},
+		{name: "too many hops", target: "http://b.ns.svc.cluster.local/", headers: map[string]string{HopsHeader: "10"}, status: http.StatusLoopDetected},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.status, call(handler, tt.target, tt.headers).Code)
+		})
+	}
+}
+
+func TestHandlerUnreachable(t *testing.T) {
+	ts := httptest.NewServer(http.NotFoundHandler())
+	target := ts.URL
+	ts.Close()
+
+	w := call(Handler(newClient(), httpclient.Allowlist{"127.0.0.1"}), target, nil)
+	require.Equal(t, http.StatusBadGateway, w.Code)
+	var response Response
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	assert.NotEmpty(t, response.Error)
+	assert.Zero(t, response.Status)
+}
+
+func TestHandlerRedirects(t *testing.T) {
+	var internalHits atomic.Int32
+	internal := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		internalHits.Add(1)
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer internal.Close()
+	// The same server reached through a host that is not allowlisted
+	notAllowlisted := strings.Replace(internal.URL, "127.0.0.1", "localhost", 1)
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		target := internal.URL
+		if r.URL.Path == "/escape" {
+			target = notAllowlisted
+		}
+		http.Redirect(w, r, target, http.StatusFound)
+	}))
+	defer ts.Close()
+
+	handler := Handler(newClient(), httpclient.Allowlist{"127.0.0.1"})
+
+	w := call(handler, ts.URL+"/escape", nil)
+	assert.Equal(t, http.StatusBadGateway, w.Code)
+	assert.Contains(t, w.Body.String(), "not allowlisted")
+	assert.Zero(t, internalHits.Load(), "redirects to hosts off the allowlist are not followed")
+
+	w = call(handler, ts.URL+"/allowed", nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, int32(1), internalHits.Load())
+}
+
+func TestHandlerOverrides(t *testing.T) {
+	hosts := make(chan string, 1)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hosts <- r.Host
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer ts.Close()
+
+	handler := HandlerWithOptions(newClient(), Options{
+		Allowlist:         httpclient.Allowlist{"127.0.0.1"},
+		OverrideAllowlist: httpclient.Allowlist{"*.example.com"},
+	})
+
+	t.Run("host header", func(t *testing.T) {
+		w := callWithOverrides(handler, ts.URL, "reviews.example.com", "")
+		require.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, "reviews.example.com", <-hosts)
+		var response Response
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+		assert.Equal(t, "reviews.example.com", response.Host)
+	})
+
+	t.Run("overrides off the allowlist", func(t *testing.T) {
+		assert.Equal(t, http.StatusForbidden, callWithOverrides(handler, ts.URL, "evil.test", "").Code)
+		assert.Equal(t, http.StatusForbidden, callWithOverrides(handler, ts.URL, "", "evil.test").Code)
+	})
+
+	t.Run("server name", func(t *testing.T) {
+		serverNames := make(chan string, 1)
+		tlsServer := httptest.NewUnstartedServer(http.NotFoundHandler())
+		tlsServer.TLS = &tls.Config{
+			GetConfigForClient: func(hello *tls.ClientHelloInfo) (*tls.Config, error) {
+				serverNames <- hello.ServerName
+				return nil, nil
+			},
+		}
+		tlsServer.StartTLS()
+		defer tlsServer.Close()
+
+		// The test server certificate is not valid for the overridden name
+		w := callWithOverrides(handler, tlsServer.URL, "", "gateway.example.com")
+		assert.Equal(t, http.StatusBadGateway, w.Code)
+		assert.Equal(t, "gateway.example.com", <-serverNames)
+	})
+}
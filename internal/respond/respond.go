@@ -0,0 +1,334 @@
+// Package respond implements a response shaping endpoint driven by a JSON spec.
+//
+// Test authors POST a spec describing the status, headers, body template, delay
+// and repeat count of the response they want, instead of adding a new handler
+// for each scenario. Body templates use text/template syntax with these
+// functions:
+//   - pod: pod name (HOSTNAME)
+//   - zone: zone of the node serving the request
+//   - cluster: name of the cluster serving the request
+//   - time: current time in RFC 3339 format
+//   - header "Name": value of a request header
+//   - query "name": value of a query parameter
+//   - requestID: request ID taken from the request headers
+//
+// The endpoint is unauthenticated, so rendering is bounded: range loops and
+// template calls are rejected because their cost does not follow from the
+// template size, and the functions producing strings share a byte and time
+// budget.
+package respond
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"text/template"
+	"text/template/parse"
+	"time"
+
+	"istio-test/internal/metadata"
+	"istio-test/internal/observability"
+)
+
+const (
+	maxSpecBytes     = 64 << 10 // Maximum size of the request body
+	maxTemplateBytes = 16 << 10 // Maximum size of the body template
+	maxResponseBytes = 1 << 20  // Maximum size of the rendered, repeated body
+	maxRepeat        = 1000     // Maximum number of body repetitions
+	maxHeaders       = 32       // Maximum number of response headers
+	maxRenderBytes   = 1 << 20  // Maximum size of all strings produced by template functions
+	maxRenderTime    = time.Second
+)
+
+// Spec describes the response to produce
+type Spec struct {
+	Status  int               `json:"status" schema:"maximum=599"`            // Response status code, defaults to 200
+	Headers map[string]string `json:"headers"`                                // Response headers
+	Body    string            `json:"body" schema:"maxLength=16384"`          // Body template
+	Delay   string            `json:"delay" schema:"format=duration"`         // Delay before responding, e.g. "250ms"
+	Repeat  int               `json:"repeat" schema:"minimum=0,maximum=1000"` // Number of times the rendered body is written, defaults to 1
+}
+
+// Options configures the respond handler
+type Options struct {
+	MaxDelay      time.Duration                                         // Upper bound for Spec.Delay
+	FetchMetadata func(ctx context.Context, url string) (string, error) // Metadata source for zone and cluster
+}
+
+// forbiddenHeaders may not be set by a spec because they control message framing
+var forbiddenHeaders = map[string]bool{
+	"Connection":        true,
+	"Content-Length":    true,
+	"Keep-Alive":        true,
+	"Trailer":           true,
+	"Transfer-Encoding": true,
+	"Upgrade":           true,
+}
+
+// validate checks the spec against the limits and returns the parsed delay
+func (s *Spec) validate(maxDelay time.Duration) (time.Duration, error) {
+	if s.Status == 0 {
+		s.Status = http.StatusOK
+	}
+	if s.Status < 200 || s.Status > 599 {
+		return 0, fmt.Errorf("status must be between 200 and 599")
+	}
+
+	if len(s.Headers) > maxHeaders {
+		return 0, fmt.Errorf("at most %d headers are allowed", maxHeaders)
+	}
+	for name, value := range s.Headers {
+		if name == "" || strings.ContainsAny(name, " :\r\n") || strings.ContainsAny(value, "\r\n") {
+			return 0, fmt.Errorf("invalid header %q", name)
+		}
+		if forbiddenHeaders[http.CanonicalHeaderKey(name)] {
+			return 0, fmt.Errorf("header %q cannot be set", name)
+		}
+	}
+
+	if len(s.Body) > maxTemplateBytes {
+		return 0, fmt.Errorf("body template must not exceed %d bytes", maxTemplateBytes)
+	}
+
+	if s.Repeat == 0 {
+		s.Repeat = 1
+	}
+	if s.Repeat < 1 || s.Repeat > maxRepeat {
+		return 0, fmt.Errorf("repeat must be between 1 and %d", maxRepeat)
+	}
+
+	var delay time.Duration
+	if s.Delay != "" {
+		var err error
+		delay, err = time.ParseDuration(s.Delay)
+		if err != nil {
+			return 0, fmt.Errorf("invalid delay: %v", err)
+		}
+		if delay < 0 || delay > maxDelay {
+			return 0, fmt.Errorf("delay must be between 0 and %v", maxDelay)
+		}
+	}
+
+	return delay, nil
+}
+
+// limitedBuffer is a buffer that fails writes beyond its limit
+type limitedBuffer struct {
+	bytes.Buffer
+	limit int
+}
+
+var errResponseTooLarge = errors.New("rendered body too large")
+
+func (b *limitedBuffer) Write(p []byte) (int, error) {
+	if b.Len()+len(p) > b.limit {
+		return 0, errResponseTooLarge
+	}
+	return b.Buffer.Write(p)
+}
+
+var (
+	errRenderBudget = fmt.Errorf("template functions produced more than %d bytes", maxRenderBytes)
+	errRenderTime   = fmt.Errorf("rendering took longer than %v", maxRenderTime)
+)
+
+// checkNodes rejects the actions whose cost does not follow from the
+// template size: range loops, which can iterate over large integers, and
+// template calls, which can recurse
+func checkNodes(node parse.Node) error {
+	switch n := node.(type) {
+	case *parse.ListNode:
+		if n == nil {
+			return nil
+		}
+		for _, child := range n.Nodes {
+			if err := checkNodes(child); err != nil {
+				return err
+			}
+		}
+	case *parse.IfNode:
+		return checkBranch(&n.BranchNode)
+	case *parse.WithNode:
+		return checkBranch(&n.BranchNode)
+	case *parse.RangeNode:
+		return errors.New("range is not supported, use repeat instead")
+	case *parse.TemplateNode:
+		return errors.New("template calls are not supported")
+	}
+	return nil
+}
+
+func checkBranch(n *parse.BranchNode) error {
+	if err := checkNodes(n.List); err != nil {
+		return err
+	}
+	return checkNodes(n.ElseList)
+}
+
+// renderBudget bounds the work of the template functions of one request
+type renderBudget struct {
+	deadline time.Time
+	bytes    int
+}
+
+// spend charges a string produced by a template function to the budget
+func (b *renderBudget) spend(value string) (string, error) {
+	if time.Now().After(b.deadline) {
+		return "", errRenderTime
+	}
+	b.bytes += len(value)
+	if b.bytes > maxRenderBytes {
+		return "", errRenderBudget
+	}
+	return value, nil
+}
+
+// templateFuncs returns the functions available to body templates. The
+// builtins producing strings are replaced by equivalents charged to budget.
+func templateFuncs(r *http.Request, fetch func(ctx context.Context, url string) (string, error), budget *renderBudget) template.FuncMap {
+	fetchMetadata := func(url string) (string, error) {
+		if fetch == nil {
+			return "", errors.New("metadata is not available")
+		}
+		value, err := fetch(r.Context(), url)
+		if err != nil {
+			return "", err
+		}
+		return value[strings.LastIndex(value, "/")+1:], nil
+	}
+
+	return template.FuncMap{
+		"pod": func() string {
+			return os.Getenv("HOSTNAME")
+		},
+		"zone": func() (string, error) {
+			return fetchMetadata(metadata.InstanceZoneURL)
+		},
+		"cluster": func() (string, error) {
+			return fetchMetadata(metadata.ClusterNameURL)
+		},
+		"time": func() string {
+			return time.Now().UTC().Format(time.RFC3339Nano)
+		},
+		"header": func(name string) string {
+			return r.Header.Get(name)
+		},
+		"query": func(name string) string {
+			return r.URL.Query().Get(name)
+		},
+		"requestID": func() string {
+			for _, name := range []string{"X-Request-ID", "X-Correlation-ID", "X-Trace-ID"} {
+				if id := r.Header.Get(name); id != "" {
+					return id
+				}
+			}
+			return ""
+		},
+		"print": func(args ...any) (string, error) {
+			return budget.spend(fmt.Sprint(args...))
+		},
+		"printf": func(format string, args ...any) (string, error) {
+			return budget.spend(fmt.Sprintf(format, args...))
+		},
+		"println": func(args ...any) (string, error) {
+			return budget.spend(fmt.Sprintln(args...))
+		},
+		"html": func(args ...any) (string, error) {
+			return budget.spend(template.HTMLEscaper(args...))
+		},
+		"js": func(args ...any) (string, error) {
+			return budget.spend(template.JSEscaper(args...))
+		},
+		"urlquery": func(args ...any) (string, error) {
+			return budget.spend(template.URLQueryEscaper(args...))
+		},
+	}
+}
+
+// Handler returns the response shaping handler
+func Handler(options Options) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var spec Spec
+		decoder := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxSpecBytes))
+		decoder.DisallowUnknownFields()
+		if err := decoder.Decode(&spec); err != nil {
+			var maxBytesErr *http.MaxBytesError
+			if errors.As(err, &maxBytesErr) {
+				http.Error(w, fmt.Sprintf("Spec exceeds %d bytes", maxSpecBytes), http.StatusRequestEntityTooLarge)
+				return
+			}
+			http.Error(w, fmt.Sprintf("Invalid spec: %v", err), http.StatusBadRequest)
+			return
+		}
+		if decoder.More() {
+			http.Error(w, "Invalid spec: unexpected data after JSON object", http.StatusBadRequest)
+			return
+		}
+
+		delay, err := spec.validate(options.MaxDelay)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Invalid spec: %v", err), http.StatusBadRequest)
+			return
+		}
+
+		budget := &renderBudget{deadline: time.Now().Add(maxRenderTime)}
+		tmpl, err := template.New("body").Funcs(templateFuncs(r, options.FetchMetadata, budget)).Parse(spec.Body)
+		if err == nil {
+			for _, defined := range tmpl.Templates() {
+				if err = checkNodes(defined.Root); err != nil {
+					break
+				}
+			}
+		}
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Invalid body template: %v", err), http.StatusBadRequest)
+			return
+		}
+
+		body := &limitedBuffer{limit: maxResponseBytes}
+		for i := 0; i < spec.Repeat; i++ {
+			if time.Now().After(budget.deadline) {
+				err = errRenderTime
+			} else {
+				err = tmpl.Execute(body, nil)
+			}
+			if err != nil {
+				switch {
+				case errors.Is(err, errResponseTooLarge):
+					http.Error(w, fmt.Sprintf("Rendered body exceeds %d bytes", maxResponseBytes), http.StatusBadRequest)
+					return
+				case errors.Is(err, errRenderBudget), errors.Is(err, errRenderTime):
+					http.Error(w, fmt.Sprintf("Body template too expensive: %v", err), http.StatusBadRequest)
+					return
+				}
+				observability.ErrorWithContext(r.Context(), fmt.Sprintf("Error rendering respond template: %v", err))
+				http.Error(w, fmt.Sprintf("Failed to render body template: %v", err), http.StatusBadRequest)
+				return
+			}
+		}
+
+		if delay > 0 {
+			timer := time.NewTimer(delay)
+			select {
+			case <-r.Context().Done():
+				timer.Stop()
+				return
+			case <-timer.C:
+			}
+		}
+
+		if spec.Headers["Content-Type"] == "" {
+			w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		}
+		for name, value := range spec.Headers {
+			w.Header().Set(name, value)
+		}
+		w.WriteHeader(spec.Status)
+		_, _ = w.Write(body.Bytes())
+	}
+}
@@ -0,0 +1,163 @@
+package respond
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"istio-test/internal/metadata"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func mockFetch(ctx context.Context, url string) (string, error) {
+	switch url {
+	case metadata.InstanceZoneURL:
+		return "projects/123/zones/us-east1-b", nil
+	case metadata.ClusterNameURL:
+		return "test-cluster", nil
+	}
+	return "", errors.New("unexpected url")
+}
+
+func post(handler http.Handler, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest("POST", "/istio-test/respond?case=a", strings.NewReader(body))
+	req.Header.Set("X-Request-ID", "req-1")
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	return w
+}
+
+func TestHandler(t *testing.T) {
+	t.Setenv("HOSTNAME", "pod-1")
+	handler := Handler(Options{MaxDelay: time.Second, FetchMetadata: mockFetch})
+
+	t.Run("defaults", func(t *testing.T) {
+		w := post(handler, `{"body":"ok"}`)
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, "text/plain; charset=utf-8", w.Header().Get("Content-Type"))
+		assert.Equal(t, "ok", w.Body.String())
+	})
+
+	t.Run("status, headers and template variables", func(t *testing.T) {
+		w := post(handler, `{
+			"status": 503,
+			"headers": {"Content-Type": "application/json", "X-Test": "yes"},
+			"body": "{\"pod\":\"{{pod}}\",\"zone\":\"{{zone}}\",\"cluster\":\"{{cluster}}\",\"case\":\"{{query \"case\"}}\",\"id\":\"{{requestID}}\"}"
+		}`)
+		assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+		assert.Equal(t, "application/json", w.Header().Get("Content-Type"))
+		assert.Equal(t, "yes", w.Header().Get("X-Test"))
+		assert.JSONEq(t, `{"pod":"pod-1","zone":"us-east1-b","cluster":"test-cluster","case":"a","id":"req-1"}`, w.Body.String())
+	})
+
+	t.Run("repeat", func(t *testing.T) {
+		w := post(handler, `{"body":"ab","repeat":3}`)
+		assert.Equal(t, "ababab", w.Body.String())
+	})
+
+	t.Run("delay", func(t *testing.T) {
+		start := time.Now()
+		w := post(handler, `{"delay":"50ms"}`)
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.GreaterOrEqual(t, time.Since(start), 50*time.Millisecond)
+	})
+
+	t.Run("builtins", func(t *testing.T) {
+		w := post(handler, `{"body":"{{printf \"%s-%03d\" pod 7}} {{html \"<b>\"}} {{if eq (query \"case\") \"a\"}}a{{end}}","repeat":2}`)
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, "pod-1-007 &lt;b&gt; apod-1-007 &lt;b&gt; a", w.Body.String())
+	})
+
+	t.Run("time variable", func(t *testing.T) {
+		w := post(handler, `{"body":"{{time}}"}`)
+		_, err := time.Parse(time.RFC3339Nano, w.Body.String())
+		assert.NoError(t, err)
+	})
+}
+
+func TestHandlerValidation(t *testing.T) {
+	handler := Handler(Options{MaxDelay: time.Second})
+
+	tests := []struct {
+		name string
+		spec string
+		code int
+	}{
+		{name: "malformed JSON", spec: `{`, code: http.StatusBadRequest},
+		{name: "unknown field", spec: `{"stauts":200}`, code: http.StatusBadRequest},
+		{name: "trailing data", spec: `{} {}`, code: http.StatusBadRequest},
+		{name: "status out of range", spec: `{"status":99}`, code: http.StatusBadRequest},
+		{name: "framing header", spec: `{"headers":{"content-length":"1"}}`, code: http.StatusBadRequest},
+		{name: "header injection", spec: `{"headers":{"X-A":"a\r\nX-B: b"}}`, code: http.StatusBadRequest},
+		{name: "repeat too large", spec: `{"repeat":1001}`, code: http.StatusBadRequest},
+		{name: "negative repeat", spec: `{"repeat":-1}`, code: http.StatusBadRequest},
+		{name: "invalid delay", spec: `{"delay":"soon"}`, code: http.StatusBadRequest},
+		{name: "delay above maximum", spec: `{"delay":"2s"}`, code: http.StatusBadRequest},
+		{name: "invalid template", spec: `{"body":"{{"}`, code: http.StatusBadRequest},
+		{name: "unknown template function", spec: `{"body":"{{secret}}"}`, code: http.StatusBadRequest},
+		{name: "metadata unavailable", spec: `{"body":"{{zone}}"}`, code: http.StatusBadRequest},
+		{name: "rendered body too large", spec: `{"body":"` + strings.Repeat("a", 2000) + `","repeat":1000}`, code: http.StatusBadRequest},
+		{name: "template too large", spec: `{"body":"` + strings.Repeat("a", maxTemplateBytes+1) + `"}`, code: http.StatusBadRequest},
+		{name: "spec too large", spec: `{"body":"` + strings.Repeat("a", maxSpecBytes) + `"}`, code: http.StatusRequestEntityTooLarge},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := post(handler, tt.spec)
+			assert.Equal(t, tt.code, w.Code, w.Body.String())
+		})
+	}
+}
+
+func TestHandlerExpensiveTemplates(t *testing.T) {
+	handler := Handler(Options{MaxDelay: time.Second})
+
+	tests := []struct {
+		name string
+		body string
+	}{
+		{name: "range over a large integer", body: `{{range 300000000}}{{end}}`},
+		{name: "nested range", body: `{{range 1000}}{{range 1000}}{{end}}{{end}}`},
+		{name: "range in a branch", body: `{{if true}}{{else}}{{range 300000000}}{{end}}{{end}}`},
+		{name: "recursive template", body: `{{define \"a\"}}{{template \"a\"}}{{end}}{{template \"a\"}}`},
+		{name: "block", body: `{{block \"a\" .}}x{{end}}`},
+		{name: "unwritten wide strings", body: strings.Repeat(`{{if printf \"%01000000d\" 1}}{{end}}`, 10)},
+		{name: "doubled strings", body: `{{$x := printf \"%0100000d\" 1}}` + strings.Repeat(`{{$x = printf \"%s%s\" $x $x}}`, 10)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			start := time.Now()
+			w := post(handler, `{"body":"`+tt.body+`","repeat":1000}`)
+			assert.Equal(t, http.StatusBadRequest, w.Code, w.Body.String())
+			assert.Less(t, time.Since(start), 2*time.Second)
+		})
+	}
+}
+
+func TestHandlerClientGone(t *testing.T) {
+	handler := Handler(Options{MaxDelay: time.Minute})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	req := httptest.NewRequest("POST", "/istio-test/respond", strings.NewReader(`{"delay":"1m","body":"late"}`)).WithContext(ctx)
+	w := httptest.NewRecorder()
+
+	done := make(chan struct{})
+	go func() {
+		handler.ServeHTTP(w, req)
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		assert.Empty(t, w.Body.String())
+	case <-time.After(5 * time.Second):
+		t.Fatal("handler did not return after the client went away")
+	}
+}
@@ -0,0 +1,378 @@
+// Package routes keeps a registry of the HTTP routes served by the application
+// and renders it as an OpenAPI 3 document, so that test harnesses and gateway
+// configuration can be generated from the same source of truth as the mux.
+package routes
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"istio-test/internal/security"
+)
+
+// Mux is the subset of a ServeMux used to register handlers
+type Mux interface {
+	HandleFunc(pattern string, handler func(http.ResponseWriter, *http.Request))
+}
+
+// Parameter describes a path, query or header parameter of a route
+type Parameter struct {
+	Name        string
+	In          string // "path", "query" or "header"
+	Description string
+	Required    bool
+	Enum        []string
+}
+
+// Response describes a possible response of a route
+type Response struct {
+	Description string
+	ContentType string // Defaults to application/json when Body is set
+	Body        any    // Example value whose type is used to derive the schema
+}
+
+// Route describes a registered route
+type Route struct {
+	Pattern     string   // ServeMux pattern the handler is registered under
+	Path        string   // OpenAPI path template, defaults to Pattern
+	Methods     []string // Allowed methods
+	Summary     string
+	Tags        []string
+	Parameters  []Parameter
+	RequestBody any // Example JSON request body whose type is used to derive the schema
+
+	// Media types accepted for the request body, defaults to application/json
+	// when RequestBody is set. Bodies of other types are rejected.
+	ContentTypes []string
+	Responses    map[int]Response
+}
+
+// RequestContentTypes returns the media types accepted for the request body of
+// the route, or nil when it takes no body
+func (route Route) RequestContentTypes() []string {
+	if len(route.ContentTypes) > 0 {
+		return route.ContentTypes
+	}
+	if route.RequestBody != nil {
+		return []string{"application/json"}
+	}
+	return nil
+}
+
+// Registry registers handlers on a mux while recording their route descriptions
+type Registry struct {
+	mux    Mux
+	mu     sync.RWMutex
+	routes []Route
+}
+
+// NewRegistry creates a registry that registers handlers on mux
+func NewRegistry(mux Mux) *Registry {
+	return &Registry{mux: mux}
+}
+
+// HandleFunc registers handler on the mux and records the route description.
+// Routes that take a request body parse it strictly and only accept its
+// content types; JSON bodies must match the schema of RequestBody.
+func (r *Registry) HandleFunc(route Route, handler http.HandlerFunc) {
+	if route.RequestBody != nil {
+		handler = ValidateBody(RequestSchema(reflect.TypeOf(route.RequestBody)), handler)
+	}
+	if contentTypes := route.RequestContentTypes(); len(contentTypes) > 0 {
+		handler = security.ContentTypeMiddlewareFunc(contentTypes...)(handler)
+	}
+	r.mux.HandleFunc(route.Pattern, handler)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.routes = append(r.routes, route)
+}
+
+// Routes returns a copy of the registered routes
+func (r *Registry) Routes() []Route {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	routes := make([]Route, len(r.routes))
+	copy(routes, r.routes)
+	return routes
+}
+
+// OpenAPI builds an OpenAPI 3 document describing the registered routes
+func (r *Registry) OpenAPI(title, version string) map[string]any {
+	paths := map[string]any{}
+
+	for _, route := range r.Routes() {
+		path := route.Path
+		if path == "" {
+			path = route.Pattern
+		}
+
+		item, ok := paths[path].(map[string]any)
+		if !ok {
+			item = map[string]any{}
+			paths[path] = item
+		}
+
+		for _, method := range route.Methods {
+			item[strings.ToLower(method)] = operation(route, method)
+		}
+	}
+
+	return map[string]any{
+		"openapi": "3.0.3",
+		"info": map[string]any{
+			"title":   title,
+			"version": version,
+		},
+		"paths": paths,
+	}
+}
+
+// OpenAPIHandler serves the OpenAPI document. The document is generated on the
+// first request, once all routes have been registered at startup.
+func (r *Registry) OpenAPIHandler(title, version string) http.HandlerFunc {
+	var (
+		once sync.Once
+		doc  []byte
+		err  error
+	)
+
+	return func(w http.ResponseWriter, req *http.Request) {
+		once.Do(func() {
+			doc, err = json.Marshal(r.OpenAPI(title, version))
+		})
+		if err != nil {
+			http.Error(w, "Failed to encode OpenAPI document", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		_, _ = w.Write(doc)
+	}
+}
+
+// operation builds the OpenAPI operation object for a route and method
+func operation(route Route, method string) map[string]any {
+	op := map[string]any{
+		"operationId": operationID(method, route),
+	}
+	if route.Summary != "" {
+		op["summary"] = route.Summary
+	}
+	if len(route.Tags) > 0 {
+		op["tags"] = route.Tags
+	}
+
+	if len(route.Parameters) > 0 {
+		params := make([]map[string]any, 0, len(route.Parameters))
+		for _, p := range route.Parameters {
+			schema := map[string]any{"type": "string"}
+			if len(p.Enum) > 0 {
+				schema["enum"] = p.Enum
+			}
+			param := map[string]any{
+				"name":     p.Name,
+				"in":       p.In,
+				"required": p.Required || p.In == "path",
+				"schema":   schema,
+			}
+			if p.Description != "" {
+				param["description"] = p.Description
+			}
+			params = append(params, param)
+		}
+		op["parameters"] = params
+	}
+
+	if contentTypes := route.RequestContentTypes(); len(contentTypes) > 0 {
+		content := map[string]any{}
+		for _, contentType := range contentTypes {
+			if contentType == "application/json" && route.RequestBody != nil {
+				content[contentType] = map[string]any{"schema": RequestSchema(reflect.TypeOf(route.RequestBody))}
+			} else {
+				content[contentType] = map[string]any{"schema": map[string]any{"type": "string"}}
+			}
+		}
+		op["requestBody"] = map[string]any{
+			"required": true,
+			"content":  content,
+		}
+	}
+
+	responses := map[string]any{}
+	codes := make([]int, 0, len(route.Responses))
+	for code := range route.Responses {
+		codes = append(codes, code)
+	}
+	sort.Ints(codes)
+	for _, code := range codes {
+		resp := route.Responses[code]
+		entry := map[string]any{"description": resp.Description}
+
+		contentType := resp.ContentType
+		if contentType == "" && resp.Body != nil {
+			contentType = "application/json"
+		}
+		if contentType != "" {
+			media := map[string]any{}
+			if resp.Body != nil {
+				media["schema"] = Schema(reflect.TypeOf(resp.Body))
+			} else {
+				media["schema"] = map[string]any{"type": "string"}
+			}
+			entry["content"] = map[string]any{contentType: media}
+		}
+		responses[strconv.Itoa(code)] = entry
+	}
+	if len(responses) == 0 {
+		responses["default"] = map[string]any{"description": "Response"}
+	}
+	op["responses"] = responses
+
+	return op
+}
+
+// operationID derives a stable operation identifier from the method and path
+func operationID(method string, route Route) string {
+	path := route.Path
+	if path == "" {
+		path = route.Pattern
+	}
+
+	var b strings.Builder
+	b.WriteString(strings.ToLower(method))
+	for _, part := range strings.FieldsFunc(path, func(r rune) bool {
+		return r == '/' || r == '-' || r == '{' || r == '}' || r == '_' || r == '.'
+	}) {
+		b.WriteString(strings.ToUpper(part[:1]) + part[1:])
+	}
+	return b.String()
+}
+
+var (
+	timeType       = reflect.TypeOf(time.Time{})
+	rawMessageType = reflect.TypeOf(json.RawMessage{})
+)
+
+// Schema derives a JSON schema from a Go type, following encoding/json field
+// naming. Constraints are taken from the schema struct tag, a comma-separated
+// list of:
+//   - required: the field must be present and not null
+//   - minimum=N, maximum=N: bounds of a number
+//   - maxLength=N, maxItems=N: bounds of a string or array
+//   - enum=a|b: allowed values of a string
+//   - format=F: e.g. duration for Go durations such as "250ms"
+func Schema(t reflect.Type) map[string]any {
+	return schemaOf(t, false)
+}
+
+// RequestSchema derives the schema of a request body like Schema, except that
+// objects reject fields their struct does not declare, like a decoder with
+// DisallowUnknownFields
+func RequestSchema(t reflect.Type) map[string]any {
+	return schemaOf(t, true)
+}
+
+// schemaOf derives the schema of t; closed objects reject undeclared fields
+func schemaOf(t reflect.Type, closed bool) map[string]any {
+	if t == nil {
+		return map[string]any{}
+	}
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	switch t {
+	case timeType:
+		return map[string]any{"type": "string", "format": "date-time"}
+	case rawMessageType:
+		return map[string]any{}
+	}
+
+	switch t.Kind() {
+	case reflect.String:
+		return map[string]any{"type": "string"}
+	case reflect.Bool:
+		return map[string]any{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]any{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]any{"type": "number"}
+	case reflect.Slice, reflect.Array:
+		if t.Kind() == reflect.Slice && t.Elem().Kind() == reflect.Uint8 {
+			// encoding/json encodes byte slices as base64
+			return map[string]any{"type": "string", "format": "byte"}
+		}
+		return map[string]any{"type": "array", "items": schemaOf(t.Elem(), closed)}
+	case reflect.Map:
+		return map[string]any{"type": "object", "additionalProperties": schemaOf(t.Elem(), closed)}
+	case reflect.Struct:
+		properties := map[string]any{}
+		var required []string
+		for i := 0; i < t.NumField(); i++ {
+			field := t.Field(i)
+			if !field.IsExported() {
+				continue
+			}
+			name := field.Name
+			if tag := field.Tag.Get("json"); tag != "" {
+				tagName, _, _ := strings.Cut(tag, ",")
+				if tagName == "-" {
+					continue
+				}
+				if tagName != "" {
+					name = tagName
+				}
+			}
+			property := schemaOf(field.Type, closed)
+			if applyConstraints(property, field.Tag.Get("schema")) {
+				required = append(required, name)
+			}
+			properties[name] = property
+		}
+		schema := map[string]any{"type": "object", "properties": properties}
+		if len(required) > 0 {
+			schema["required"] = required
+		}
+		if closed {
+			schema["additionalProperties"] = false
+		}
+		return schema
+	default:
+		return map[string]any{}
+	}
+}
+
+// applyConstraints adds the constraints of a schema struct tag to schema and
+// reports whether the field is required
+func applyConstraints(schema map[string]any, tag string) bool {
+	required := false
+	for _, constraint := range strings.Split(tag, ",") {
+		key, value, _ := strings.Cut(strings.TrimSpace(constraint), "=")
+		switch key {
+		case "required":
+			required = true
+		case "minimum", "maximum":
+			if n, err := strconv.ParseFloat(value, 64); err == nil {
+				schema[key] = n
+			}
+		case "maxLength", "maxItems":
+			if n, err := strconv.Atoi(value); err == nil {
+				schema[key] = n
+			}
+		case "enum":
+			schema[key] = strings.Split(value, "|")
+		case "format":
+			schema[key] = value
+		}
+	}
+	return required
+}
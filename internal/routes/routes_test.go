@@ -0,0 +1,172 @@
+package routes
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type testPayload struct {
+	Name      string            `json:"name"`
+	Count     int               `json:"count,omitempty"`
+	Ratio     float64           `json:"ratio"`
+	Enabled   bool              `json:"enabled"`
+	Tags      []string          `json:"tags"`
+	Labels    map[string]string `json:"labels"`
+	Timestamp time.Time         `json:"timestamp"`
+	Ignored   string            `json:"-"`
+	internal  string
+}
+
+func TestRegistry(t *testing.T) {
+	mux := http.NewServeMux()
+	registry := NewRegistry(mux)
+
+	registry.HandleFunc(Route{
+		Pattern: "/items/",
+		Path:    "/items/{id}",
+		Methods: []string{"GET"},
+		Summary: "Get an item",
+		Parameters: []Parameter{
+			{Name: "id", In: "path", Enum: []string{"a", "b"}},
+		},
+		Responses: map[int]Response{
+			http.StatusOK:         {Description: "Item", Body: testPayload{}},
+			http.StatusBadRequest: {Description: "Bad request", ContentType: "text/plain"},
+		},
+	}, func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("item"))
+	})
+
+	t.Run("handler is registered on the mux", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, httptest.NewRequest("GET", "/items/a", nil))
+		assert.Equal(t, "item", w.Body.String())
+		assert.Len(t, registry.Routes(), 1)
+	})
+
+	t.Run("openapi document describes the route", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		registry.OpenAPIHandler("test", "v1").ServeHTTP(w, httptest.NewRequest("GET", "/openapi.json", nil))
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, "application/json", w.Header().Get("Content-Type"))
+
+		var doc map[string]any
+		assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &doc))
+		assert.Equal(t, "3.0.3", doc["openapi"])
+
+		paths := doc["paths"].(map[string]any)
+		get := paths["/items/{id}"].(map[string]any)["get"].(map[string]any)
+		assert.Equal(t, "getItemsId", get["operationId"])
+		assert.Equal(t, "Get an item", get["summary"])
+
+		params := get["parameters"].([]any)
+		param := params[0].(map[string]any)
+		assert.Equal(t, true, param["required"])
+		assert.Equal(t, []any{"a", "b"}, param["schema"].(map[string]any)["enum"])
+
+		responses := get["responses"].(map[string]any)
+		assert.Contains(t, responses, "200")
+		assert.Contains(t, responses, "400")
+		content := responses["200"].(map[string]any)["content"].(map[string]any)
+		assert.Contains(t, content, "application/json")
+		assert.NotContains(t, get, "requestBody")
+	})
+
+	t.Run("request body schema", func(t *testing.T) {
+		registry.HandleFunc(Route{
+			Pattern:     "/items",
+			Methods:     []string{"POST"},
+			RequestBody: testPayload{},
+		}, func(w http.ResponseWriter, r *http.Request) {})
+
+		post := registry.OpenAPI("test", "v1")["paths"].(map[string]any)["/items"].(map[string]any)["post"].(map[string]any)
+		body := post["requestBody"].(map[string]any)
+		assert.Equal(t, true, body["required"])
+		schema := body["content"].(map[string]any)["application/json"].(map[string]any)["schema"].(map[string]any)
+		assert.Equal(t, "object", schema["type"])
+	})
+
+	t.Run("request bodies of other content types are rejected", func(t *testing.T) {
+		req := httptest.NewRequest("POST", "/items", strings.NewReader("name=a"))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusUnsupportedMediaType, w.Code)
+
+		req = httptest.NewRequest("POST", "/items", strings.NewReader(`{"name":"a"}`))
+		req.Header.Set("Content-Type", "application/json")
+		w = httptest.NewRecorder()
+		mux.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusOK, w.Code)
+	})
+
+	t.Run("custom request content types", func(t *testing.T) {
+		registry.HandleFunc(Route{
+			Pattern:      "/uploads",
+			Methods:      []string{"PUT"},
+			ContentTypes: []string{"application/octet-stream"},
+		}, func(w http.ResponseWriter, r *http.Request) {})
+
+		put := registry.OpenAPI("test", "v1")["paths"].(map[string]any)["/uploads"].(map[string]any)["put"].(map[string]any)
+		content := put["requestBody"].(map[string]any)["content"].(map[string]any)
+		assert.Contains(t, content, "application/octet-stream")
+		assert.NotContains(t, content, "application/json")
+
+		req := httptest.NewRequest("PUT", "/uploads", strings.NewReader(`{}`))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusUnsupportedMediaType, w.Code)
+	})
+}
+
+func TestSchema(t *testing.T) {
+	schema := Schema(reflect.TypeOf(testPayload{}))
+	assert.Equal(t, "object", schema["type"])
+
+	properties := schema["properties"].(map[string]any)
+	assert.Equal(t, map[string]any{"type": "string"}, properties["name"])
+	assert.Equal(t, map[string]any{"type": "integer"}, properties["count"])
+	assert.Equal(t, map[string]any{"type": "number"}, properties["ratio"])
+	assert.Equal(t, map[string]any{"type": "boolean"}, properties["enabled"])
+	assert.Equal(t, map[string]any{"type": "array", "items": map[string]any{"type": "string"}}, properties["tags"])
+	assert.Equal(t, map[string]any{"type": "object", "additionalProperties": map[string]any{"type": "string"}}, properties["labels"])
+	assert.Equal(t, map[string]any{"type": "string", "format": "date-time"}, properties["timestamp"])
+	assert.NotContains(t, properties, "Ignored")
+	assert.NotContains(t, properties, "internal")
+}
+
+type testRequest struct {
+	Name    string          `json:"name" schema:"required,maxLength=8"`
+	Rate    float64         `json:"rate" schema:"minimum=0,maximum=1"`
+	Delay   string          `json:"delay,omitempty" schema:"format=duration"`
+	Mode    string          `json:"mode,omitempty" schema:"enum=fast|slow"`
+	Items   []testPayload   `json:"items,omitempty" schema:"maxItems=2"`
+	Raw     json.RawMessage `json:"raw,omitempty"`
+	Payload []byte          `json:"payload,omitempty"`
+}
+
+func TestRequestSchema(t *testing.T) {
+	schema := RequestSchema(reflect.TypeOf(testRequest{}))
+	assert.Equal(t, false, schema["additionalProperties"])
+	assert.Equal(t, []string{"name"}, schema["required"])
+
+	properties := schema["properties"].(map[string]any)
+	assert.Equal(t, map[string]any{"type": "string", "maxLength": 8}, properties["name"])
+	assert.Equal(t, map[string]any{"type": "number", "minimum": 0.0, "maximum": 1.0}, properties["rate"])
+	assert.Equal(t, map[string]any{"type": "string", "format": "duration"}, properties["delay"])
+	assert.Equal(t, []string{"fast", "slow"}, properties["mode"].(map[string]any)["enum"])
+	assert.Equal(t, false, properties["items"].(map[string]any)["items"].(map[string]any)["additionalProperties"], "nested objects are closed too")
+	assert.Equal(t, map[string]any{}, properties["raw"])
+	assert.Equal(t, map[string]any{"type": "string", "format": "byte"}, properties["payload"])
+
+	assert.NotContains(t, Schema(reflect.TypeOf(testRequest{})), "additionalProperties", "response schemas stay open")
+}
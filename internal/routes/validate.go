@@ -0,0 +1,179 @@
+package routes
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"slices"
+	"sort"
+	"strconv"
+	"time"
+
+	"istio-test/internal/httperr"
+)
+
+// ValidateBody rejects JSON request bodies that do not match schema with a
+// 400 problem listing every violation, so a harness learns about all of its
+// mistakes at once. Bodies that are not JSON are passed on for the handler to
+// reject with its own message.
+func ValidateBody(schema map[string]any, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost && r.Method != http.MethodPut && r.Method != http.MethodPatch {
+			next(w, r)
+			return
+		}
+		if mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type")); err != nil || mediaType != "application/json" {
+			next(w, r)
+			return
+		}
+
+		// The body is already buffered by the content type middleware
+		body, err := io.ReadAll(r.Body)
+		r.Body = io.NopCloser(bytes.NewReader(body))
+		if err != nil {
+			next(w, r)
+			return
+		}
+
+		decoder := json.NewDecoder(bytes.NewReader(body))
+		decoder.UseNumber()
+		var value any
+		if err := decoder.Decode(&value); err != nil {
+			next(w, r)
+			return
+		}
+
+		if violations := Validate(schema, value); len(violations) > 0 {
+			problem := httperr.New(http.StatusBadRequest, fmt.Sprintf("Request body has %d schema violations", len(violations)))
+			problem.Violations = violations
+			httperr.Write(w, r, problem)
+			return
+		}
+		next(w, r)
+	}
+}
+
+// Validate returns every violation of schema by value, a JSON document decoded
+// with UseNumber. Null stands for a missing value, like it does for
+// encoding/json, and only violates required.
+func Validate(schema map[string]any, value any) []string {
+	var violations []string
+	validate(schema, value, "body", &violations)
+	return violations
+}
+
+// validate appends the violations of schema by the value at path
+func validate(schema map[string]any, value any, path string, violations *[]string) {
+	if value == nil {
+		return
+	}
+	violate := func(format string, args ...any) {
+		*violations = append(*violations, path+": "+fmt.Sprintf(format, args...))
+	}
+
+	switch schema["type"] {
+	case "object":
+		object, ok := value.(map[string]any)
+		if !ok {
+			violate("must be an object")
+			return
+		}
+		properties, _ := schema["properties"].(map[string]any)
+		required, _ := schema["required"].([]string)
+		for _, name := range required {
+			if object[name] == nil {
+				*violations = append(*violations, path+"."+name+": is required")
+			}
+		}
+
+		names := make([]string, 0, len(object))
+		for name := range object {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			if property, ok := properties[name].(map[string]any); ok {
+				validate(property, object[name], path+"."+name, violations)
+				continue
+			}
+			switch additional := schema["additionalProperties"].(type) {
+			case bool:
+				if !additional {
+					*violations = append(*violations, path+"."+name+": unknown field")
+				}
+			case map[string]any:
+				validate(additional, object[name], path+"."+name, violations)
+			}
+		}
+
+	case "array":
+		array, ok := value.([]any)
+		if !ok {
+			violate("must be an array")
+			return
+		}
+		if maxItems, ok := schema["maxItems"].(int); ok && len(array) > maxItems {
+			violate("must have at most %d items", maxItems)
+		}
+		if items, ok := schema["items"].(map[string]any); ok {
+			for i, item := range array {
+				validate(items, item, path+"["+strconv.Itoa(i)+"]", violations)
+			}
+		}
+
+	case "string":
+		s, ok := value.(string)
+		if !ok {
+			violate("must be a string")
+			return
+		}
+		if maxLength, ok := schema["maxLength"].(int); ok && len(s) > maxLength {
+			violate("must be at most %d bytes long", maxLength)
+		}
+		if enum, ok := schema["enum"].([]string); ok && !slices.Contains(enum, s) {
+			violate("must be one of %v", enum)
+		}
+		switch schema["format"] {
+		case "duration":
+			if _, err := time.ParseDuration(s); err != nil {
+				violate("must be a duration such as \"250ms\"")
+			}
+		case "date-time":
+			if _, err := time.Parse(time.RFC3339, s); err != nil {
+				violate("must be an RFC 3339 date-time")
+			}
+		}
+
+	case "integer", "number":
+		n, ok := value.(json.Number)
+		if !ok {
+			violate("must be a %s", schema["type"])
+			return
+		}
+		if schema["type"] == "integer" {
+			if _, err := n.Int64(); err != nil {
+				violate("must be an integer")
+				return
+			}
+		}
+		f, err := n.Float64()
+		if err != nil {
+			violate("must be a number")
+			return
+		}
+		if minimum, ok := schema["minimum"].(float64); ok && f < minimum {
+			violate("must be at least %v", minimum)
+		}
+		if maximum, ok := schema["maximum"].(float64); ok && f > maximum {
+			violate("must be at most %v", maximum)
+		}
+
+	case "boolean":
+		if _, ok := value.(bool); !ok {
+			violate("must be a boolean")
+		}
+	}
+}
@@ -0,0 +1,108 @@
+package routes
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"istio-test/internal/httperr"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// decode decodes a JSON document like ValidateBody does
+func decode(t *testing.T, document string) any {
+	t.Helper()
+	decoder := json.NewDecoder(strings.NewReader(document))
+	decoder.UseNumber()
+	var value any
+	require.NoError(t, decoder.Decode(&value))
+	return value
+}
+
+func TestValidate(t *testing.T) {
+	schema := RequestSchema(reflect.TypeOf(testRequest{}))
+
+	tests := []struct {
+		name       string
+		document   string
+		violations []string
+	}{
+		{
+			name:     "valid",
+			document: `{"name":"a","rate":0.5,"delay":"250ms","mode":"fast","items":[{"count":1}],"raw":{"any":"thing"}}`,
+		},
+		{
+			name:     "null stands for a missing optional value",
+			document: `{"name":"a","delay":null}`,
+		},
+		{
+			name:       "every violation is reported",
+			document:   `{"rate":2,"delay":"soon","mode":"medium","extra":true}`,
+			violations: []string{"body.name: is required", "body.delay: must be a duration such as \"250ms\"", "body.extra: unknown field", "body.mode: must be one of [fast slow]", "body.rate: must be at most 1"},
+		},
+		{
+			name:       "nested violations have a path",
+			document:   `{"name":"too long name","items":[{"count":1.5},{"tags":"a"},{}]}`,
+			violations: []string{"body.items: must have at most 2 items", "body.items[0].count: must be an integer", "body.items[1].tags: must be an array", "body.name: must be at most 8 bytes long"},
+		},
+		{
+			name:       "wrong type",
+			document:   `[]`,
+			violations: []string{"body: must be an object"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			violations := Validate(schema, decode(t, tt.document))
+			assert.ElementsMatch(t, tt.violations, violations)
+		})
+	}
+}
+
+func TestValidateBody(t *testing.T) {
+	var received []byte
+	handler := ValidateBody(RequestSchema(reflect.TypeOf(testRequest{})), func(w http.ResponseWriter, r *http.Request) {
+		received, _ = io.ReadAll(r.Body)
+	})
+
+	post := func(body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/items", bytes.NewBufferString(body))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		handler(w, req)
+		return w
+	}
+
+	t.Run("valid body reaches the handler unchanged", func(t *testing.T) {
+		w := post(`{"name":"a"}`)
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, `{"name":"a"}`, string(received))
+	})
+
+	t.Run("violations are listed in a problem", func(t *testing.T) {
+		received = nil
+		w := post(`{"rate":-1}`)
+		require.Equal(t, http.StatusBadRequest, w.Code)
+		assert.Equal(t, httperr.ContentType, w.Header().Get("Content-Type"))
+		assert.Nil(t, received)
+
+		var problem httperr.Problem
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &problem))
+		assert.Equal(t, "Request body has 2 schema violations", problem.Detail)
+		assert.ElementsMatch(t, []string{"body.name: is required", "body.rate: must be at least 0"}, problem.Violations)
+	})
+
+	t.Run("malformed JSON is left to the handler", func(t *testing.T) {
+		w := post(`{"name":`)
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, `{"name":`, string(received))
+	})
+}
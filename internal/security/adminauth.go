@@ -0,0 +1,124 @@
+package security
+
+import (
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+
+	"istio-test/internal/observability"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// AdminTokenHeader carries the admin token when the Authorization header is
+// taken, such as by a profiling or lifecycle token
+const AdminTokenHeader = "X-Istio-Test-Admin-Token"
+
+var adminAuthRejections = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Namespace: "istio_test",
+	Name:      "admin_auth_rejections_total",
+	Help:      "Total number of requests to admin routes rejected by the admin token check, by reason (missing, invalid).",
+}, []string{"reason"})
+
+func init() {
+	observability.MetricsRegistry().MustRegister(adminAuthRejections)
+}
+
+// AdminAuthOptions configures the admin token check
+type AdminAuthOptions struct {
+	Token     string   // Static token admin routes require
+	TokenFile string   // File holding the token, e.g. a mounted secret; used when Token is empty
+	Routes    []string // Path prefixes that require the token
+}
+
+// AdminAuth requires a static token on admin and debug routes, so fault
+// injection, drain and profiling controls are not open to everything that can
+// reach the pod
+type AdminAuth struct {
+	token  []byte
+	routes []string
+}
+
+// NewAdminAuth creates the admin token check, reading the token from
+// TokenFile when Token is empty
+func NewAdminAuth(options AdminAuthOptions) (*AdminAuth, error) {
+	token := options.Token
+	if token == "" && options.TokenFile != "" {
+		data, err := os.ReadFile(options.TokenFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read admin token file: %w", err)
+		}
+		token = strings.TrimSpace(string(data))
+	}
+	if token == "" {
+		return nil, errors.New("admin token is empty")
+	}
+	return &AdminAuth{token: []byte(token), routes: options.Routes}, nil
+}
+
+// protected reports whether path matches a route requiring the token
+func (a *AdminAuth) protected(path string) bool {
+	for _, prefix := range a.routes {
+		if strings.HasPrefix(path, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// Authorized reports whether r carries the admin token, as a bearer token or
+// in AdminTokenHeader, and why not when it does not
+func (a *AdminAuth) Authorized(r *http.Request) (bool, string) {
+	var candidates []string
+	if token := r.Header.Get(AdminTokenHeader); token != "" {
+		candidates = append(candidates, token)
+	}
+	if scheme, token, ok := strings.Cut(r.Header.Get("Authorization"), " "); ok && strings.EqualFold(scheme, "Bearer") {
+		candidates = append(candidates, strings.TrimSpace(token))
+	}
+	if len(candidates) == 0 {
+		return false, "missing"
+	}
+	for _, token := range candidates {
+		if subtle.ConstantTimeCompare([]byte(token), a.token) == 1 {
+			return true, ""
+		}
+	}
+	return false, "invalid"
+}
+
+// Middleware rejects requests to protected routes without the admin token
+// with 401 Unauthorized
+func (a *AdminAuth) Middleware(next http.Handler) http.Handler {
+	required := a.Require(next)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !a.protected(r.URL.Path) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		required.ServeHTTP(w, r)
+	})
+}
+
+// Require rejects every request without the admin token with 401
+// Unauthorized, whatever routes the token is configured for. It guards
+// handlers that must never be reachable anonymously.
+func (a *AdminAuth) Require(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if ok, reason := a.Authorized(r); !ok {
+			adminAuthRejections.WithLabelValues(reason).Inc()
+			observability.WarnWithFields(r.Context(), fmt.Sprintf("Admin request to %s rejected: %s token", r.URL.Path, reason), map[string]any{
+				"type":      "admin_auth",
+				"reason":    reason,
+				"client_ip": observability.ClientIP(r),
+			})
+			w.Header().Set("WWW-Authenticate", `Bearer realm="istio-test-admin"`)
+			http.Error(w, "Admin token required", http.StatusUnauthorized)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,92 @@
+package security
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAdminAuthMiddleware(t *testing.T) {
+	auth, err := NewAdminAuth(AdminAuthOptions{Token: "s3cret", Routes: []string{"/admin/", "/drain"}})
+	require.NoError(t, err)
+	handler := auth.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	tests := []struct {
+		name     string
+		path     string
+		headers  map[string]string
+		expected int
+	}{
+		{name: "unprotected route", path: "/istio-test/health", expected: http.StatusOK},
+		{name: "missing token", path: "/admin/config", expected: http.StatusUnauthorized},
+		{name: "wrong token", path: "/drain", headers: map[string]string{"Authorization": "Bearer nope"}, expected: http.StatusUnauthorized},
+		{name: "bearer token", path: "/admin/config", headers: map[string]string{"Authorization": "Bearer s3cret"}, expected: http.StatusOK},
+		{name: "header token", path: "/drain", headers: map[string]string{AdminTokenHeader: "s3cret"}, expected: http.StatusOK},
+		{
+			name:     "header token next to another bearer token",
+			path:     "/admin/config",
+			headers:  map[string]string{AdminTokenHeader: "s3cret", "Authorization": "Bearer lifecycle"},
+			expected: http.StatusOK,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", tt.path, nil)
+			for name, value := range tt.headers {
+				req.Header.Set(name, value)
+			}
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, req)
+			assert.Equal(t, tt.expected, w.Code)
+			if tt.expected == http.StatusUnauthorized {
+				assert.NotEmpty(t, w.Header().Get("WWW-Authenticate"))
+			}
+		})
+	}
+}
+
+func TestNewAdminAuthTokenFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "token")
+	require.NoError(t, os.WriteFile(path, []byte("from-file\n"), 0o600))
+
+	auth, err := NewAdminAuth(AdminAuthOptions{TokenFile: path, Routes: []string{"/admin/"}})
+	require.NoError(t, err)
+	req := httptest.NewRequest("GET", "/admin/config", nil)
+	req.Header.Set("Authorization", "Bearer from-file")
+	ok, _ := auth.Authorized(req)
+	assert.True(t, ok, "trailing newline of the mounted secret is trimmed")
+
+	_, err = NewAdminAuth(AdminAuthOptions{TokenFile: filepath.Join(t.TempDir(), "missing")})
+	assert.Error(t, err)
+
+	empty := filepath.Join(t.TempDir(), "empty")
+	require.NoError(t, os.WriteFile(empty, nil, 0o600))
+	_, err = NewAdminAuth(AdminAuthOptions{TokenFile: empty})
+	assert.Error(t, err)
+}
+
+func TestAdminAuthRequire(t *testing.T) {
+	auth, err := NewAdminAuth(AdminAuthOptions{Token: "s3cret", Routes: []string{"/debug/"}})
+	require.NoError(t, err)
+	handler := auth.Require(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest("POST", "/admin/pprof/token", nil))
+	assert.Equal(t, http.StatusUnauthorized, w.Code, "the token is required outside of the configured routes")
+
+	req := httptest.NewRequest("POST", "/admin/pprof/token", nil)
+	req.Header.Set(AdminTokenHeader, "s3cret")
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+}
@@ -0,0 +1,299 @@
+package security
+
+import (
+	"context"
+	"math"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"istio-test/internal/observability"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Concurrency limiter modes
+const (
+	ConcurrencyModeFixed    = "fixed"
+	ConcurrencyModeGradient = "gradient"
+)
+
+// Tuning of the gradient limit, following the Gradient2 limiter of Netflix's
+// concurrency-limits library
+const (
+	shortRTTWindow    = 10  // Samples averaged by the short-term RTT
+	longRTTWindow     = 600 // Samples averaged by the long-term RTT
+	rttTolerance      = 1.5 // Short-term RTT increase tolerated before the limit shrinks
+	limitSmoothing    = 0.2 // Weight of a new limit estimate
+	minLimitGradient  = 0.5 // Largest shrink of the limit per sample
+	longRTTDriftRatio = 2   // Long-term RTT above this multiple of the short-term RTT decays
+	longRTTDecay      = 0.95
+)
+
+var (
+	concurrencyLimit = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: "istio_test",
+		Name:      "concurrency_limit",
+		Help:      "Concurrent requests currently allowed by the in-app concurrency limiter.",
+	})
+	concurrencyLimitedRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "istio_test",
+		Name:      "concurrency_limited_requests_total",
+		Help:      "Total number of requests rejected by the in-app concurrency limiter.",
+	}, []string{"mode"})
+	concurrencyInFlight = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: "istio_test",
+		Name:      "concurrency_in_flight",
+		Help:      "Requests holding a slot of the in-app concurrency limiter; saturated when equal to istio_test_concurrency_limit.",
+	})
+	concurrencyQueued = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: "istio_test",
+		Name:      "concurrency_queued",
+		Help:      "Requests waiting for a slot of the in-app concurrency limiter.",
+	})
+	concurrencyQueueWait = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: "istio_test",
+		Name:      "concurrency_queue_wait_seconds",
+		Help:      "Time requests waited for a slot of the in-app concurrency limiter, by outcome (admitted, shed).",
+		Buckets:   []float64{.001, .005, .01, .025, .05, .1, .25, .5, 1, 2.5},
+	}, []string{"outcome"})
+)
+
+func init() {
+	observability.MetricsRegistry().MustRegister(concurrencyLimit, concurrencyLimitedRequests,
+		concurrencyInFlight, concurrencyQueued, concurrencyQueueWait)
+}
+
+// DefaultConcurrencyRetryAfter is the Retry-After sent with shed requests
+// when ConcurrencyLimitOptions.RetryAfter is not set
+const DefaultConcurrencyRetryAfter = time.Second
+
+// ConcurrencyLimitOptions configures the in-app concurrency limiter
+type ConcurrencyLimitOptions struct {
+	Mode          string   // ConcurrencyModeFixed or ConcurrencyModeGradient
+	Limit         int      // Fixed limit, or the initial limit in gradient mode
+	MinLimit      int      // Lower bound of the gradient limit, defaults to 1
+	MaxLimit      int      // Upper bound of the gradient limit, defaults to Limit
+	ExcludeRoutes []string // Path prefixes that are never limited
+
+	// Requests over the limit wait up to QueueTimeout for a slot, at most
+	// QueueSize of them at once; zero sheds them right away
+	QueueSize    int
+	QueueTimeout time.Duration
+	RetryAfter   time.Duration // Retry-After of shed requests, rounded up to seconds; zero uses DefaultConcurrencyRetryAfter
+}
+
+// ConcurrencyLimiter caps the number of requests handled at once. In fixed
+// mode the cap only changes through SetLimit. In gradient mode it follows
+// latency: the limit grows while the short-term round-trip time stays close
+// to the long-term one and shrinks as queueing makes requests slower, like
+// Envoy's adaptive concurrency filter does in the sidecar, so the two can be
+// compared under the same load.
+type ConcurrencyLimiter struct {
+	mu       sync.Mutex
+	options  ConcurrencyLimitOptions
+	limit    float64
+	inFlight int
+	waiters  []chan struct{} // Queued requests, oldest first; closed when handed a slot
+	shortRTT float64         // Seconds
+	longRTT  float64         // Seconds
+	samples  int
+	now      func() time.Time
+}
+
+// NewConcurrencyLimiter creates a concurrency limiter
+func NewConcurrencyLimiter(options ConcurrencyLimitOptions) *ConcurrencyLimiter {
+	if options.MinLimit <= 0 {
+		options.MinLimit = 1
+	}
+	if options.MaxLimit < options.Limit {
+		options.MaxLimit = options.Limit
+	}
+	if options.RetryAfter <= 0 {
+		options.RetryAfter = DefaultConcurrencyRetryAfter
+	}
+	l := &ConcurrencyLimiter{
+		options: options,
+		limit:   float64(options.Limit),
+		now:     time.Now,
+	}
+	concurrencyLimit.Set(float64(options.Limit))
+	return l
+}
+
+// Limit returns the number of concurrent requests currently allowed
+func (l *ConcurrencyLimiter) Limit() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return int(l.limit)
+}
+
+// SetLimit changes the limit while serving. In gradient mode the value is
+// clamped to the bounds and adapts from there.
+func (l *ConcurrencyLimiter) SetLimit(limit int) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.setLimit(float64(limit))
+}
+
+// setLimit stores the limit, clamped in gradient mode; l.mu must be held
+func (l *ConcurrencyLimiter) setLimit(limit float64) {
+	if l.options.Mode == ConcurrencyModeGradient {
+		limit = math.Max(float64(l.options.MinLimit), math.Min(float64(l.options.MaxLimit), limit))
+	}
+	l.limit = limit
+	concurrencyLimit.Set(math.Floor(limit))
+	l.admitWaiters()
+}
+
+// admitWaiters hands free slots to queued requests, oldest first; l.mu must
+// be held
+func (l *ConcurrencyLimiter) admitWaiters() {
+	for len(l.waiters) > 0 && l.inFlight < int(l.limit) {
+		close(l.waiters[0])
+		l.waiters = l.waiters[1:]
+		l.inFlight++
+	}
+	concurrencyInFlight.Set(float64(l.inFlight))
+	concurrencyQueued.Set(float64(len(l.waiters)))
+}
+
+// InFlight returns the number of requests holding a slot
+func (l *ConcurrencyLimiter) InFlight() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.inFlight
+}
+
+// acquire takes a slot and reports whether the request may proceed
+func (l *ConcurrencyLimiter) acquire() bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.inFlight >= int(l.limit) {
+		return false
+	}
+	l.inFlight++
+	concurrencyInFlight.Set(float64(l.inFlight))
+	return true
+}
+
+// wait queues for a slot until one is handed over, the queue timeout expires
+// or ctx is done, and reports whether the request may proceed
+func (l *ConcurrencyLimiter) wait(ctx context.Context) bool {
+	l.mu.Lock()
+	if len(l.waiters) >= l.options.QueueSize || l.options.QueueTimeout <= 0 {
+		l.mu.Unlock()
+		return false
+	}
+	admitted := make(chan struct{})
+	l.waiters = append(l.waiters, admitted)
+	concurrencyQueued.Set(float64(len(l.waiters)))
+	l.mu.Unlock()
+
+	timer := time.NewTimer(l.options.QueueTimeout)
+	defer timer.Stop()
+	select {
+	case <-admitted:
+		return true
+	case <-timer.C:
+	case <-ctx.Done():
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if i := slices.Index(l.waiters, admitted); i >= 0 {
+		l.waiters = slices.Delete(l.waiters, i, i+1)
+		concurrencyQueued.Set(float64(len(l.waiters)))
+		return false
+	}
+	// A slot was handed over as the wait ended
+	return true
+}
+
+// release returns a slot and feeds the round-trip time of the request to the
+// gradient limit
+func (l *ConcurrencyLimiter) release(rtt time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	inFlight := l.inFlight
+	l.inFlight--
+	if l.options.Mode == ConcurrencyModeGradient {
+		l.sample(rtt.Seconds(), inFlight)
+	}
+	l.admitWaiters()
+}
+
+// sample updates the gradient limit with the round-trip time of a request
+// that completed with inFlight requests in flight; l.mu must be held
+func (l *ConcurrencyLimiter) sample(rtt float64, inFlight int) {
+	if rtt <= 0 {
+		return
+	}
+	if l.samples == 0 {
+		l.shortRTT, l.longRTT = rtt, rtt
+	}
+	l.samples++
+	l.shortRTT += (rtt - l.shortRTT) * 2 / (shortRTTWindow + 1)
+	l.longRTT += (rtt - l.longRTT) * 2 / (longRTTWindow + 1)
+
+	// Recover quickly after a period of high latency
+	if l.longRTT/l.shortRTT > longRTTDriftRatio {
+		l.longRTT *= longRTTDecay
+	}
+
+	// The limit is not tested while most of it is unused, so do not grow it
+	if float64(inFlight) < l.limit/2 {
+		return
+	}
+
+	gradient := math.Max(minLimitGradient, math.Min(1, rttTolerance*l.longRTT/l.shortRTT))
+	estimate := l.limit*gradient + math.Sqrt(l.limit)
+	l.setLimit(l.limit*(1-limitSmoothing) + estimate*limitSmoothing)
+}
+
+// excluded reports whether path matches an excluded route
+func (l *ConcurrencyLimiter) excluded(path string) bool {
+	for _, prefix := range l.options.ExcludeRoutes {
+		if strings.HasPrefix(path, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// Middleware queues requests over the limit briefly and sheds those that get
+// no slot with 503 Service Unavailable, the status Envoy's adaptive
+// concurrency filter uses, and a Retry-After header in whole seconds
+func (l *ConcurrencyLimiter) Middleware(next http.Handler) http.Handler {
+	retryAfter := strconv.Itoa(int(math.Ceil(l.options.RetryAfter.Seconds())))
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if l.excluded(r.URL.Path) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		if !l.acquire() {
+			queued := l.now()
+			admitted := l.wait(r.Context())
+			if l.options.QueueSize > 0 && l.options.QueueTimeout > 0 {
+				outcome := "admitted"
+				if !admitted {
+					outcome = "shed"
+				}
+				concurrencyQueueWait.WithLabelValues(outcome).Observe(l.now().Sub(queued).Seconds())
+			}
+			if !admitted {
+				concurrencyLimitedRequests.WithLabelValues(l.options.Mode).Inc()
+				w.Header().Set("Retry-After", retryAfter)
+				http.Error(w, "Concurrency limit exceeded", http.StatusServiceUnavailable)
+				return
+			}
+		}
+		start := l.now()
+		defer func() { l.release(l.now().Sub(start)) }()
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,163 @@
+package security
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestConcurrencyLimiterFixed(t *testing.T) {
+	l := NewConcurrencyLimiter(ConcurrencyLimitOptions{Mode: ConcurrencyModeFixed, Limit: 2})
+
+	assert.True(t, l.acquire())
+	assert.True(t, l.acquire())
+	assert.False(t, l.acquire())
+	assert.Equal(t, 2, l.InFlight())
+
+	l.release(0)
+	assert.True(t, l.acquire())
+
+	l.SetLimit(3)
+	assert.Equal(t, 3, l.Limit())
+	assert.True(t, l.acquire())
+}
+
+func TestConcurrencyLimiterGradient(t *testing.T) {
+	l := NewConcurrencyLimiter(ConcurrencyLimitOptions{Mode: ConcurrencyModeGradient, Limit: 20, MinLimit: 5, MaxLimit: 50})
+
+	// Steady latency under load grows the limit up to the maximum
+	for range 200 {
+		l.sample(0.010, l.Limit())
+	}
+	assert.Equal(t, 50, l.Limit())
+
+	// Queueing latency shrinks it
+	for range 50 {
+		l.sample(0.200, l.Limit())
+	}
+	shrunk := l.Limit()
+	assert.Less(t, shrunk, 20)
+
+	// Latency recovers, and so does the limit
+	for range 200 {
+		l.sample(0.010, l.Limit())
+	}
+	assert.Greater(t, l.Limit(), shrunk)
+}
+
+func TestConcurrencyLimiterGradientAppLimited(t *testing.T) {
+	l := NewConcurrencyLimiter(ConcurrencyLimitOptions{Mode: ConcurrencyModeGradient, Limit: 20, MinLimit: 5, MaxLimit: 50})
+
+	// A mostly idle limit is not grown
+	for range 200 {
+		l.sample(0.010, 1)
+	}
+	assert.Equal(t, 20, l.Limit())
+
+	l.SetLimit(1000)
+	assert.Equal(t, 50, l.Limit(), "SetLimit is clamped to the bounds")
+}
+
+func TestConcurrencyLimiterMiddleware(t *testing.T) {
+	l := NewConcurrencyLimiter(ConcurrencyLimitOptions{Mode: ConcurrencyModeFixed, Limit: 1, ExcludeRoutes: []string{"/health"}})
+	started := make(chan struct{})
+	release := make(chan struct{})
+	handler := l.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/slow" {
+			close(started)
+			<-release
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	serve := func(path string) int {
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+		return w.Code
+	}
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		serve("/slow")
+	}()
+	<-started
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/echo", nil))
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+	assert.Equal(t, "1", w.Header().Get("Retry-After"))
+	assert.Equal(t, http.StatusOK, serve("/health"))
+
+	close(release)
+	wg.Wait()
+	require.Equal(t, 0, l.InFlight())
+	assert.Equal(t, http.StatusOK, serve("/echo"))
+}
+
+func TestConcurrencyLimiterQueue(t *testing.T) {
+	l := NewConcurrencyLimiter(ConcurrencyLimitOptions{Mode: ConcurrencyModeFixed, Limit: 1, QueueSize: 1, QueueTimeout: time.Second})
+	require.True(t, l.acquire())
+
+	// A queued request is handed the slot released by the request in flight
+	admitted := make(chan bool)
+	go func() { admitted <- l.wait(context.Background()) }()
+	assert.Eventually(t, func() bool {
+		l.mu.Lock()
+		defer l.mu.Unlock()
+		return len(l.waiters) == 1
+	}, time.Second, time.Millisecond)
+
+	// The queue is full
+	assert.False(t, l.wait(context.Background()))
+
+	l.release(0)
+	assert.True(t, <-admitted)
+	assert.Equal(t, 1, l.InFlight(), "the slot moved to the queued request")
+
+	// Raising the limit admits queued requests too
+	go func() { admitted <- l.wait(context.Background()) }()
+	assert.Eventually(t, func() bool {
+		l.mu.Lock()
+		defer l.mu.Unlock()
+		return len(l.waiters) == 1
+	}, time.Second, time.Millisecond)
+	l.SetLimit(2)
+	assert.True(t, <-admitted)
+	assert.Equal(t, 2, l.InFlight())
+}
+
+func TestConcurrencyLimiterQueueTimeout(t *testing.T) {
+	l := NewConcurrencyLimiter(ConcurrencyLimitOptions{
+		Mode:         ConcurrencyModeFixed,
+		Limit:        1,
+		QueueSize:    10,
+		QueueTimeout: 20 * time.Millisecond,
+		RetryAfter:   2500 * time.Millisecond,
+	})
+	require.True(t, l.acquire())
+
+	start := time.Now()
+	w := httptest.NewRecorder()
+	l.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Error("request admitted over the limit")
+	})).ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/echo", nil))
+
+	assert.GreaterOrEqual(t, time.Since(start), 20*time.Millisecond, "the request waited in the queue")
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+	assert.Equal(t, "3", w.Header().Get("Retry-After"))
+	assert.Empty(t, l.waiters)
+
+	// A canceled request leaves the queue
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	assert.False(t, l.wait(ctx))
+	assert.Empty(t, l.waiters)
+	assert.Equal(t, 1, l.InFlight())
+}
@@ -0,0 +1,72 @@
+package security
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"slices"
+	"strings"
+)
+
+// MaxStrictBodyBytes bounds the request bodies buffered by ContentTypeMiddlewareFunc
+const MaxStrictBodyBytes = 1 << 20
+
+// ContentTypeMiddlewareFunc enforces strict, predictable parsing of request
+// bodies so request smuggling tests against the mesh get a deterministic
+// origin:
+//   - GET and HEAD requests must not carry a body (400)
+//   - a body must have one of the allowed media types (415)
+//   - a body must be exactly as long as its Content-Length (400) and at most
+//     MaxStrictBodyBytes (413)
+//
+// The body is buffered before the handler runs, so handlers never see a
+// truncated body. Requests without a body pass unchanged.
+func ContentTypeMiddlewareFunc(allowedTypes ...string) func(http.HandlerFunc) http.HandlerFunc {
+	return func(next http.HandlerFunc) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			if r.ContentLength == 0 && len(r.TransferEncoding) == 0 {
+				next(w, r)
+				return
+			}
+
+			if r.Method == http.MethodGet || r.Method == http.MethodHead {
+				http.Error(w, fmt.Sprintf("%s requests must not carry a body", r.Method), http.StatusBadRequest)
+				return
+			}
+
+			mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+			if err != nil || !slices.Contains(allowedTypes, mediaType) {
+				w.Header().Set("Accept", strings.Join(allowedTypes, ", "))
+				http.Error(w, fmt.Sprintf("Unsupported Content-Type: must be %s", strings.Join(allowedTypes, " or ")), http.StatusUnsupportedMediaType)
+				return
+			}
+
+			if r.ContentLength > MaxStrictBodyBytes {
+				http.Error(w, fmt.Sprintf("Request exceeds %d bytes", MaxStrictBodyBytes), http.StatusRequestEntityTooLarge)
+				return
+			}
+			body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, MaxStrictBodyBytes))
+			if err != nil {
+				var maxBytesErr *http.MaxBytesError
+				if errors.As(err, &maxBytesErr) {
+					http.Error(w, fmt.Sprintf("Request exceeds %d bytes", MaxStrictBodyBytes), http.StatusRequestEntityTooLarge)
+					return
+				}
+				// A body shorter than its Content-Length ends in io.ErrUnexpectedEOF
+				http.Error(w, fmt.Sprintf("Request body does not match Content-Length %d", r.ContentLength), http.StatusBadRequest)
+				return
+			}
+			if r.ContentLength > 0 && int64(len(body)) != r.ContentLength {
+				http.Error(w, fmt.Sprintf("Request body does not match Content-Length %d", r.ContentLength), http.StatusBadRequest)
+				return
+			}
+
+			r.Body = io.NopCloser(bytes.NewReader(body))
+			r.ContentLength = int64(len(body))
+			next(w, r)
+		}
+	}
+}
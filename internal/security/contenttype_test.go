@@ -0,0 +1,73 @@
+package security
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestContentTypeMiddlewareFunc(t *testing.T) {
+	var received string
+	handler := ContentTypeMiddlewareFunc("application/json", "text/plain")(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		received = string(body)
+		w.WriteHeader(http.StatusOK)
+	})
+
+	tests := []struct {
+		name          string
+		method        string
+		body          string
+		contentType   string
+		contentLength int64 // Overrides the length of body when non-zero
+		chunked       bool
+		expectedCode  int
+	}{
+		{name: "JSON body", method: "POST", body: `{"a":1}`, contentType: "application/json", expectedCode: http.StatusOK},
+		{name: "media type parameters", method: "PUT", body: "hi", contentType: "text/plain; charset=utf-8", expectedCode: http.StatusOK},
+		{name: "chunked body", method: "POST", body: `{}`, contentType: "application/json", chunked: true, expectedCode: http.StatusOK},
+		{name: "no body", method: "GET", expectedCode: http.StatusOK},
+		{name: "no body without content type", method: "DELETE", expectedCode: http.StatusOK},
+		{name: "unlisted content type", method: "POST", body: "a=1", contentType: "application/x-www-form-urlencoded", expectedCode: http.StatusUnsupportedMediaType},
+		{name: "missing content type", method: "POST", body: `{}`, expectedCode: http.StatusUnsupportedMediaType},
+		{name: "malformed content type", method: "POST", body: `{}`, contentType: "application/json;;", expectedCode: http.StatusUnsupportedMediaType},
+		{name: "GET with body", method: "GET", body: `{}`, contentType: "application/json", expectedCode: http.StatusBadRequest},
+		{name: "body shorter than Content-Length", method: "POST", body: `{}`, contentType: "application/json", contentLength: 10, expectedCode: http.StatusBadRequest},
+		{name: "body over the limit", method: "POST", body: strings.Repeat("a", MaxStrictBodyBytes+1), contentType: "text/plain", expectedCode: http.StatusRequestEntityTooLarge},
+		{name: "chunked body over the limit", method: "POST", body: strings.Repeat("a", MaxStrictBodyBytes+1), contentType: "text/plain", chunked: true, expectedCode: http.StatusRequestEntityTooLarge},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			received = ""
+			req := httptest.NewRequest(tt.method, "/items", strings.NewReader(tt.body))
+			if tt.body == "" {
+				req = httptest.NewRequest(tt.method, "/items", nil)
+			}
+			if tt.contentType != "" {
+				req.Header.Set("Content-Type", tt.contentType)
+			}
+			if tt.contentLength != 0 {
+				req.ContentLength = tt.contentLength
+			}
+			if tt.chunked {
+				req.ContentLength = -1
+				req.TransferEncoding = []string{"chunked"}
+			}
+
+			w := httptest.NewRecorder()
+			handler(w, req)
+			assert.Equal(t, tt.expectedCode, w.Code, w.Body.String())
+			if tt.expectedCode == http.StatusOK {
+				assert.Equal(t, tt.body, received)
+			}
+			if tt.expectedCode == http.StatusUnsupportedMediaType {
+				assert.Equal(t, "application/json, text/plain", w.Header().Get("Accept"))
+			}
+		})
+	}
+}
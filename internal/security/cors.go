@@ -0,0 +1,163 @@
+package security
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// CORSOptions configures Cross-Origin Resource Sharing
+type CORSOptions struct {
+	AllowedOrigins   []string      // "*", an origin such as "https://app.example.com", or "https://*.example.com" for subdomains
+	AllowedMethods   []string      // Methods allowed in preflighted requests
+	AllowedHeaders   []string      // Request headers allowed in preflighted requests, "*" allows any
+	ExposedHeaders   []string      // Response headers readable by scripts
+	AllowCredentials bool          // Allow cookies and authorization headers; the origin is echoed instead of "*"
+	MaxAge           time.Duration // How long browsers may cache a preflight result, zero leaves it to the browser
+}
+
+// ValidateOrigin reports whether origin is a usable allowed origin pattern
+func ValidateOrigin(origin string) error {
+	if origin == "*" {
+		return nil
+	}
+	u, err := url.Parse(origin)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" || u.Path != "" || u.RawQuery != "" {
+		return fmt.Errorf("invalid CORS origin '%s': must be \"*\" or scheme://host[:port]", origin)
+	}
+	if strings.Contains(strings.TrimPrefix(u.Host, "*."), "*") {
+		return fmt.Errorf("invalid CORS origin '%s': only a leading \"*.\" wildcard is supported", origin)
+	}
+	return nil
+}
+
+// cors answers preflight requests and adds CORS headers to actual requests
+type cors struct {
+	options        CORSOptions
+	allowedMethods string
+	allowedHeaders string
+	exposedHeaders string
+	maxAge         string
+}
+
+// CORSMiddleware applies the CORS policy of options. Preflight requests from
+// allowed origins are answered with 204 without reaching next, so routes do
+// not need to allow OPTIONS; preflights from other origins get 403.
+func CORSMiddleware(next http.Handler, options CORSOptions) http.Handler {
+	c := &cors{
+		options:        options,
+		allowedMethods: strings.Join(options.AllowedMethods, ", "),
+		allowedHeaders: strings.Join(options.AllowedHeaders, ", "),
+		exposedHeaders: strings.Join(options.ExposedHeaders, ", "),
+	}
+	if options.MaxAge > 0 {
+		c.maxAge = strconv.Itoa(int(options.MaxAge.Seconds()))
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		origin := r.Header.Get("Origin")
+		if r.Method == http.MethodOptions && origin != "" && r.Header.Get("Access-Control-Request-Method") != "" {
+			c.preflight(w, r, origin)
+			return
+		}
+
+		if origin != "" {
+			c.setOrigin(w, origin)
+			if c.exposedHeaders != "" && c.originAllowed(origin) {
+				w.Header().Set("Access-Control-Expose-Headers", c.exposedHeaders)
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// preflight answers a preflight request
+func (c *cors) preflight(w http.ResponseWriter, r *http.Request, origin string) {
+	headers := w.Header()
+	headers.Add("Vary", "Origin")
+	headers.Add("Vary", "Access-Control-Request-Method")
+	headers.Add("Vary", "Access-Control-Request-Headers")
+
+	method := r.Header.Get("Access-Control-Request-Method")
+	if !c.originAllowed(origin) || !slices.Contains(c.options.AllowedMethods, method) || !c.headersAllowed(r.Header.Get("Access-Control-Request-Headers")) {
+		http.Error(w, "CORS preflight rejected", http.StatusForbidden)
+		return
+	}
+
+	c.setOrigin(w, origin)
+	headers.Set("Access-Control-Allow-Methods", c.allowedMethods)
+	if requested := r.Header.Get("Access-Control-Request-Headers"); requested != "" {
+		if c.allowedHeaders == "*" {
+			headers.Set("Access-Control-Allow-Headers", requested)
+		} else {
+			headers.Set("Access-Control-Allow-Headers", c.allowedHeaders)
+		}
+	}
+	if c.maxAge != "" {
+		headers.Set("Access-Control-Max-Age", c.maxAge)
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// setOrigin sets Access-Control-Allow-Origin when origin is allowed
+func (c *cors) setOrigin(w http.ResponseWriter, origin string) {
+	headers := w.Header()
+	wildcard := slices.Contains(c.options.AllowedOrigins, "*") && !c.options.AllowCredentials
+	if !wildcard {
+		// The response depends on the origin, so caches must key on it
+		headers.Add("Vary", "Origin")
+	}
+	if !c.originAllowed(origin) {
+		return
+	}
+
+	if wildcard {
+		headers.Set("Access-Control-Allow-Origin", "*")
+	} else {
+		headers.Set("Access-Control-Allow-Origin", origin)
+	}
+	if c.options.AllowCredentials {
+		headers.Set("Access-Control-Allow-Credentials", "true")
+	}
+}
+
+// originAllowed reports whether origin matches an allowed origin
+func (c *cors) originAllowed(origin string) bool {
+	for _, allowed := range c.options.AllowedOrigins {
+		if allowed == "*" || strings.EqualFold(allowed, origin) {
+			return true
+		}
+		// "https://*.example.com" matches subdomains of example.com over https
+		if scheme, host, ok := strings.Cut(allowed, "://*."); ok {
+			rest, found := strings.CutPrefix(strings.ToLower(origin), strings.ToLower(scheme)+"://")
+			if found && strings.HasSuffix(rest, "."+strings.ToLower(host)) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// headersAllowed reports whether every header of a preflight's
+// Access-Control-Request-Headers is allowed
+func (c *cors) headersAllowed(requested string) bool {
+	if requested == "" || slices.Contains(c.options.AllowedHeaders, "*") {
+		return true
+	}
+	for _, header := range strings.Split(requested, ",") {
+		header = strings.TrimSpace(header)
+		if header == "" {
+			continue
+		}
+		if !slices.ContainsFunc(c.options.AllowedHeaders, func(allowed string) bool {
+			return strings.EqualFold(allowed, header)
+		}) {
+			return false
+		}
+	}
+	return true
+}
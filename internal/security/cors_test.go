@@ -0,0 +1,136 @@
+package security
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCORSMiddlewarePreflight(t *testing.T) {
+	reached := false
+	handler := CORSMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		reached = true
+	}), CORSOptions{
+		AllowedOrigins: []string{"https://app.example.com", "https://*.example.org"},
+		AllowedMethods: []string{"GET", "POST"},
+		AllowedHeaders: []string{"Content-Type", "X-Request-ID"},
+		MaxAge:         10 * time.Minute,
+	})
+
+	tests := []struct {
+		name           string
+		origin         string
+		method         string
+		headers        string
+		expectedCode   int
+		expectedOrigin string
+	}{
+		{name: "allowed origin", origin: "https://app.example.com", method: "POST", headers: "content-type, x-request-id", expectedCode: http.StatusNoContent, expectedOrigin: "https://app.example.com"},
+		{name: "wildcard subdomain", origin: "https://ui.example.org", method: "GET", expectedCode: http.StatusNoContent, expectedOrigin: "https://ui.example.org"},
+		{name: "wildcard does not match the apex", origin: "https://example.org", method: "GET", expectedCode: http.StatusForbidden},
+		{name: "wildcard does not match another scheme", origin: "http://ui.example.org", method: "GET", expectedCode: http.StatusForbidden},
+		{name: "unlisted origin", origin: "https://evil.example.net", method: "GET", expectedCode: http.StatusForbidden},
+		{name: "unlisted method", origin: "https://app.example.com", method: "DELETE", expectedCode: http.StatusForbidden},
+		{name: "unlisted header", origin: "https://app.example.com", method: "GET", headers: "Authorization", expectedCode: http.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reached = false
+			req := httptest.NewRequest(http.MethodOptions, "/istio-test/metadata", nil)
+			req.Header.Set("Origin", tt.origin)
+			req.Header.Set("Access-Control-Request-Method", tt.method)
+			if tt.headers != "" {
+				req.Header.Set("Access-Control-Request-Headers", tt.headers)
+			}
+			w := httptest.NewRecorder()
+
+			handler.ServeHTTP(w, req)
+
+			assert.False(t, reached, "preflight requests must not reach the handler")
+			assert.Equal(t, tt.expectedCode, w.Code)
+			assert.Equal(t, tt.expectedOrigin, w.Header().Get("Access-Control-Allow-Origin"))
+			assert.Contains(t, w.Header().Values("Vary"), "Origin")
+			if tt.expectedCode == http.StatusNoContent {
+				assert.Equal(t, "GET, POST", w.Header().Get("Access-Control-Allow-Methods"))
+				assert.Equal(t, "600", w.Header().Get("Access-Control-Max-Age"))
+			}
+			if tt.headers != "" && tt.expectedCode == http.StatusNoContent {
+				assert.Equal(t, "Content-Type, X-Request-ID", w.Header().Get("Access-Control-Allow-Headers"))
+			}
+		})
+	}
+}
+
+func TestCORSMiddlewareActualRequest(t *testing.T) {
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+
+	t.Run("allowed origin with credentials", func(t *testing.T) {
+		handler := CORSMiddleware(next, CORSOptions{
+			AllowedOrigins:   []string{"https://app.example.com"},
+			ExposedHeaders:   []string{"X-Request-ID"},
+			AllowCredentials: true,
+		})
+		req := httptest.NewRequest(http.MethodGet, "/istio-test/metadata", nil)
+		req.Header.Set("Origin", "https://app.example.com")
+		w := httptest.NewRecorder()
+
+		handler.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, "https://app.example.com", w.Header().Get("Access-Control-Allow-Origin"))
+		assert.Equal(t, "true", w.Header().Get("Access-Control-Allow-Credentials"))
+		assert.Equal(t, "X-Request-ID", w.Header().Get("Access-Control-Expose-Headers"))
+		assert.Equal(t, "Origin", w.Header().Get("Vary"))
+	})
+
+	t.Run("disallowed origin is served without CORS headers", func(t *testing.T) {
+		handler := CORSMiddleware(next, CORSOptions{AllowedOrigins: []string{"https://app.example.com"}})
+		req := httptest.NewRequest(http.MethodGet, "/istio-test/metadata", nil)
+		req.Header.Set("Origin", "https://evil.example.net")
+		w := httptest.NewRecorder()
+
+		handler.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Empty(t, w.Header().Get("Access-Control-Allow-Origin"))
+		assert.Equal(t, "Origin", w.Header().Get("Vary"))
+	})
+
+	t.Run("any origin", func(t *testing.T) {
+		handler := CORSMiddleware(next, CORSOptions{AllowedOrigins: []string{"*"}})
+		req := httptest.NewRequest(http.MethodGet, "/istio-test/metadata", nil)
+		req.Header.Set("Origin", "https://anything.example.net")
+		w := httptest.NewRecorder()
+
+		handler.ServeHTTP(w, req)
+
+		assert.Equal(t, "*", w.Header().Get("Access-Control-Allow-Origin"))
+		assert.Empty(t, w.Header().Get("Vary"))
+	})
+
+	t.Run("OPTIONS without preflight headers reaches the handler", func(t *testing.T) {
+		handler := CORSMiddleware(next, CORSOptions{AllowedOrigins: []string{"*"}})
+		w := httptest.NewRecorder()
+
+		handler.ServeHTTP(w, httptest.NewRequest(http.MethodOptions, "/istio-test/metadata", nil))
+
+		assert.Equal(t, http.StatusOK, w.Code)
+	})
+}
+
+func TestValidateOrigin(t *testing.T) {
+	assert.NoError(t, ValidateOrigin("*"))
+	assert.NoError(t, ValidateOrigin("https://app.example.com"))
+	assert.NoError(t, ValidateOrigin("http://localhost:8080"))
+	assert.NoError(t, ValidateOrigin("https://*.example.com"))
+	assert.Error(t, ValidateOrigin("app.example.com"))
+	assert.Error(t, ValidateOrigin("https://app.example.com/"))
+	assert.Error(t, ValidateOrigin("ftp://app.example.com"))
+	assert.Error(t, ValidateOrigin("https://app.*.example.com"))
+}
@@ -0,0 +1,574 @@
+package security
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"istio-test/internal/httpclient"
+	"istio-test/internal/observability"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"golang.org/x/sync/singleflight"
+)
+
+// JWT validation modes
+const (
+	JWTModeEnforce = "enforce" // Reject requests carrying an invalid token
+	JWTModeObserve = "observe" // Only record the validation result
+)
+
+// JWT validation results, also the values of the result metric label
+const (
+	JWTResultMissing = "missing"
+	JWTResultValid   = "valid"
+	JWTResultInvalid = "invalid"
+)
+
+// Defaults matching Envoy's jwt_authn filter as configured by Istio
+const (
+	DefaultJWKSRefresh = 20 * time.Minute
+	DefaultJWTSkew     = 60 * time.Second
+)
+
+// jwksRefetchInterval bounds the refetches caused by tokens with an unknown
+// kid, so a flood of forged tokens does not hammer the JWKS server
+const jwksRefetchInterval = time.Minute
+
+// jwksRetryBackoff is the wait after a failed JWKS fetch; it doubles with
+// every further failure up to jwksRefetchInterval
+const jwksRetryBackoff = time.Second
+
+// JWT validation errors. The messages are the ones Envoy's jwt_authn filter
+// returns in the body of a 401, so in-app and sidecar results can be compared
+// as they are.
+var (
+	ErrJWTBadFormat        = errors.New("Jwt is not in the form of Header.Payload.Signature with two dots and 3 sections")
+	ErrJWTHeaderBadJSON    = errors.New("Jwt header is an invalid JSON")
+	ErrJWTPayloadBadJSON   = errors.New("Jwt payload is an invalid JSON")
+	ErrJWTSignatureBase64  = errors.New("Jwt signature is an invalid Base64url encoded")
+	ErrJWTAlgNotSupported  = errors.New("Jwt header [alg] is not supported")
+	ErrJWTExpired          = errors.New("Jwt is expired")
+	ErrJWTNotYetValid      = errors.New("Jwt not yet valid")
+	ErrJWTUnknownIssuer    = errors.New("Jwt issuer is not configured")
+	ErrJWTAudience         = errors.New("Audiences in Jwt are not allowed")
+	ErrJWTNoMatchingKey    = errors.New("Jwks doesn't have key to match kid or alg from Jwt")
+	ErrJWTVerificationFail = errors.New("Jwt verification fails")
+	ErrJWKSFetch           = errors.New("Jwks remote fetch is failed")
+)
+
+var jwtValidations = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Namespace: "istio_test",
+	Name:      "jwt_validations_total",
+	Help:      "Total number of requests checked by the in-app JWT validation, by mode and result (missing, valid, invalid).",
+}, []string{"mode", "result"})
+
+func init() {
+	observability.MetricsRegistry().MustRegister(jwtValidations)
+}
+
+// JWTOptions configures the in-app JWT validation
+type JWTOptions struct {
+	Mode          string        // JWTModeEnforce or JWTModeObserve
+	JWKSURL       string        // Where the signing keys are fetched from
+	Issuer        string        // Required iss claim
+	Audiences     []string      // Accepted aud claims, any one matching is enough; empty accepts any
+	JWKSRefresh   time.Duration // How long fetched keys are used, defaults to DefaultJWKSRefresh
+	ExcludeRoutes []string      // Path prefixes that are never validated
+}
+
+// JWTResult is the outcome of validating the token of a request
+type JWTResult struct {
+	Result    string         `json:"result"`              // JWTResultMissing, JWTResultValid or JWTResultInvalid
+	Error     string         `json:"error,omitempty"`     // Why the token is invalid
+	Principal string         `json:"principal,omitempty"` // iss/sub, the request principal Istio derives from the token
+	Claims    map[string]any `json:"claims,omitempty"`    // Claims of a valid token
+}
+
+// jwtContextKey carries the JWTResult of a request
+type jwtContextKey struct{}
+
+// JWTFromContext returns the validation result of the request token, if the
+// request went through the JWT middleware
+func JWTFromContext(ctx context.Context) (JWTResult, bool) {
+	result, ok := ctx.Value(jwtContextKey{}).(JWTResult)
+	return result, ok
+}
+
+// jwtHeader is the JOSE header of a token
+type jwtHeader struct {
+	Alg string `json:"alg"`
+	Kid string `json:"kid"`
+}
+
+// jwk is a public key of a JWKS
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Alg string `json:"alg"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+// publicKey is a parsed key of the JWKS
+type publicKey struct {
+	kid string
+	alg string
+	key crypto.PublicKey
+}
+
+// jwtAlgorithms maps the supported signing algorithms to their hash
+var jwtAlgorithms = map[string]crypto.Hash{
+	"RS256": crypto.SHA256, "RS384": crypto.SHA384, "RS512": crypto.SHA512,
+	"PS256": crypto.SHA256, "PS384": crypto.SHA384, "PS512": crypto.SHA512,
+	"ES256": crypto.SHA256, "ES384": crypto.SHA384, "ES512": crypto.SHA512,
+}
+
+// JWTValidator validates bearer tokens against the keys of a JWKS URL, the
+// way a RequestAuthentication jwtRules entry does in the sidecar. Running it
+// behind the sidecar shows whether both agree on the same requests.
+type JWTValidator struct {
+	options JWTOptions
+	client  *httpclient.Client
+	now     func() time.Time
+
+	inFlight singleflight.Group // Callers needing fresh keys share one fetch
+
+	mu          sync.Mutex
+	keys        []publicKey
+	fetchedAt   time.Time // Last successful fetch
+	attemptedAt time.Time // Last fetch, successful or not
+	failures    int       // Consecutive failed fetches
+	fetchErr    error     // Error of the last failed fetch
+}
+
+// NewJWTValidator creates a validator fetching keys with client
+func NewJWTValidator(client *httpclient.Client, options JWTOptions) *JWTValidator {
+	if options.JWKSRefresh <= 0 {
+		options.JWKSRefresh = DefaultJWKSRefresh
+	}
+	return &JWTValidator{options: options, client: client, now: time.Now}
+}
+
+// fetchKeys downloads and parses the JWKS
+func (v *JWTValidator) fetchKeys(ctx context.Context) ([]publicKey, error) {
+	resp, err := v.client.Do(ctx, func(ctx context.Context) (*http.Request, error) {
+		return http.NewRequestWithContext(ctx, http.MethodGet, v.options.JWKSURL, nil)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrJWKSFetch, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		_, _ = io.Copy(io.Discard, resp.Body)
+		return nil, fmt.Errorf("%w: status %d", ErrJWKSFetch, resp.StatusCode)
+	}
+	var set struct {
+		Keys []jwk `json:"keys"`
+	}
+	if err := json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(&set); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrJWKSFetch, err)
+	}
+
+	// Keys of unsupported types are skipped, as Envoy does
+	keys := make([]publicKey, 0, len(set.Keys))
+	for _, k := range set.Keys {
+		key, err := k.publicKey()
+		if err != nil {
+			continue
+		}
+		keys = append(keys, publicKey{kid: k.Kid, alg: k.Alg, key: key})
+	}
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("%w: no usable keys", ErrJWKSFetch)
+	}
+	return keys, nil
+}
+
+// publicKey parses an RSA or EC key
+func (k jwk) publicKey() (crypto.PublicKey, error) {
+	decode := base64.RawURLEncoding.DecodeString
+	switch k.Kty {
+	case "RSA":
+		n, err := decode(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := decode(k.E)
+		if err != nil {
+			return nil, err
+		}
+		exponent := new(big.Int).SetBytes(e)
+		if !exponent.IsInt64() || exponent.Int64() < 2 || exponent.Int64() > 1<<31-1 {
+			return nil, fmt.Errorf("invalid RSA exponent")
+		}
+		return &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(exponent.Int64())}, nil
+	case "EC":
+		var curve elliptic.Curve
+		switch k.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, fmt.Errorf("unsupported curve %s", k.Crv)
+		}
+		x, err := decode(k.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := decode(k.Y)
+		if err != nil {
+			return nil, err
+		}
+		return &ecdsa.PublicKey{Curve: curve, X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}, nil
+	default:
+		return nil, fmt.Errorf("unsupported key type %s", k.Kty)
+	}
+}
+
+// publicKeys returns the cached keys, fetching them when they are older than
+// the refresh interval. An unknown kid triggers an early refetch, at most
+// once per jwksRefetchInterval, to pick up rotated keys. The fetch runs
+// outside the lock and is shared by concurrent callers; after a failure the
+// next one waits for a backoff, so an unreachable JWKS server does not add its
+// timeout to every request.
+func (v *JWTValidator) publicKeys(ctx context.Context, kid string) ([]publicKey, error) {
+	v.mu.Lock()
+	keys, err, due := v.keys, v.fetchErr, v.fetchDue(kid)
+	v.mu.Unlock()
+	if !due {
+		if keys == nil {
+			return nil, err
+		}
+		return keys, nil
+	}
+
+	// The shared fetch must outlive any single caller, so it keeps the
+	// context values of the caller that started it but not its cancellation
+	fetchCtx := context.WithoutCancel(ctx)
+	result, err, _ := v.inFlight.Do("jwks", func() (any, error) {
+		return v.refresh(fetchCtx, kid)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result.([]publicKey), nil
+}
+
+// fetchDue reports whether the keys must be fetched for a token with kid;
+// v.mu must be held
+func (v *JWTValidator) fetchDue(kid string) bool {
+	now := v.now()
+	if v.failures > 0 {
+		backoff := min(jwksRetryBackoff<<min(v.failures-1, 16), jwksRefetchInterval)
+		if now.Sub(v.attemptedAt) < backoff {
+			return false
+		}
+	}
+	if v.keys == nil || now.Sub(v.fetchedAt) >= v.options.JWKSRefresh {
+		return true
+	}
+	return kid != "" && now.Sub(v.attemptedAt) >= jwksRefetchInterval &&
+		!slices.ContainsFunc(v.keys, func(k publicKey) bool { return k.kid == kid })
+}
+
+// refresh fetches the keys unless a fetch that just completed made it
+// unnecessary, and records the outcome
+func (v *JWTValidator) refresh(ctx context.Context, kid string) ([]publicKey, error) {
+	v.mu.Lock()
+	if !v.fetchDue(kid) {
+		defer v.mu.Unlock()
+		if v.keys == nil {
+			return nil, v.fetchErr
+		}
+		return v.keys, nil
+	}
+	v.mu.Unlock()
+
+	keys, err := v.fetchKeys(ctx)
+
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	v.attemptedAt = v.now()
+	if err != nil {
+		v.failures++
+		v.fetchErr = err
+		if v.keys != nil {
+			// Keep using the keys we have until the JWKS is reachable again
+			observability.WarnWithContext(ctx, fmt.Sprintf("Error refreshing JWKS, using cached keys: %v", err))
+			return v.keys, nil
+		}
+		return nil, err
+	}
+	v.keys, v.fetchedAt, v.failures, v.fetchErr = keys, v.attemptedAt, 0, nil
+	return keys, nil
+}
+
+// verifySignature checks the signature of signingInput with key
+func verifySignature(alg string, key crypto.PublicKey, signingInput string, signature []byte) bool {
+	hash := jwtAlgorithms[alg]
+	h := hash.New()
+	h.Write([]byte(signingInput))
+	digest := h.Sum(nil)
+
+	switch key := key.(type) {
+	case *rsa.PublicKey:
+		switch alg[:2] {
+		case "RS":
+			return rsa.VerifyPKCS1v15(key, hash, digest, signature) == nil
+		case "PS":
+			return rsa.VerifyPSS(key, hash, digest, signature, nil) == nil
+		}
+	case *ecdsa.PublicKey:
+		if alg[:2] != "ES" {
+			return false
+		}
+		size := (key.Curve.Params().BitSize + 7) / 8
+		if len(signature) != 2*size {
+			return false
+		}
+		r := new(big.Int).SetBytes(signature[:size])
+		s := new(big.Int).SetBytes(signature[size:])
+		return ecdsa.Verify(key, digest, r, s)
+	}
+	return false
+}
+
+// keyMatches reports whether key may verify a token signed with alg; the
+// key type must fit the algorithm and a key restricted to an alg must match
+func keyMatches(key publicKey, alg string) bool {
+	if key.alg != "" && key.alg != alg {
+		return false
+	}
+	switch key.key.(type) {
+	case *rsa.PublicKey:
+		return alg[:2] == "RS" || alg[:2] == "PS"
+	case *ecdsa.PublicKey:
+		return alg[:2] == "ES"
+	}
+	return false
+}
+
+// numericDate reads a NumericDate claim, reporting whether it is present
+func numericDate(claims map[string]any, name string) (time.Time, bool, error) {
+	value, ok := claims[name]
+	if !ok {
+		return time.Time{}, false, nil
+	}
+	number, ok := value.(json.Number)
+	if !ok {
+		return time.Time{}, false, fmt.Errorf("Jwt payload [%s] field is not a number", name)
+	}
+	seconds, err := number.Float64()
+	if err != nil {
+		return time.Time{}, false, fmt.Errorf("Jwt payload [%s] field is not a number", name)
+	}
+	return time.Unix(0, int64(seconds*float64(time.Second))), true, nil
+}
+
+// audiences reads the aud claim, which is either a string or a list of strings
+func audiences(claims map[string]any) []string {
+	switch aud := claims["aud"].(type) {
+	case string:
+		return []string{aud}
+	case []any:
+		var list []string
+		for _, a := range aud {
+			if s, ok := a.(string); ok {
+				list = append(list, s)
+			}
+		}
+		return list
+	}
+	return nil
+}
+
+// Validate checks the signature, issuer, audiences and validity period of
+// token and returns its claims
+func (v *JWTValidator) Validate(ctx context.Context, token string) (map[string]any, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, ErrJWTBadFormat
+	}
+
+	headerJSON, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return nil, ErrJWTHeaderBadJSON
+	}
+	var header jwtHeader
+	if err := json.Unmarshal(headerJSON, &header); err != nil {
+		return nil, ErrJWTHeaderBadJSON
+	}
+	if _, ok := jwtAlgorithms[header.Alg]; !ok {
+		return nil, ErrJWTAlgNotSupported
+	}
+
+	payloadJSON, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return nil, ErrJWTPayloadBadJSON
+	}
+	var claims map[string]any
+	decoder := json.NewDecoder(bytes.NewReader(payloadJSON))
+	decoder.UseNumber()
+	if err := decoder.Decode(&claims); err != nil || claims == nil {
+		return nil, ErrJWTPayloadBadJSON
+	}
+
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, ErrJWTSignatureBase64
+	}
+
+	// Claims are checked before the signature, in the order Envoy checks them
+	if issuer, _ := claims["iss"].(string); v.options.Issuer != "" && issuer != v.options.Issuer {
+		return nil, ErrJWTUnknownIssuer
+	}
+	now := v.now()
+	notBefore, ok, err := numericDate(claims, "nbf")
+	if err != nil {
+		return nil, err
+	}
+	if ok && now.Add(DefaultJWTSkew).Before(notBefore) {
+		return nil, ErrJWTNotYetValid
+	}
+	expiresAt, ok, err := numericDate(claims, "exp")
+	if err != nil {
+		return nil, err
+	}
+	if ok && !now.Add(-DefaultJWTSkew).Before(expiresAt) {
+		return nil, ErrJWTExpired
+	}
+	if len(v.options.Audiences) > 0 && !slices.ContainsFunc(audiences(claims), func(aud string) bool {
+		return slices.Contains(v.options.Audiences, aud)
+	}) {
+		return nil, ErrJWTAudience
+	}
+
+	keys, err := v.publicKeys(ctx, header.Kid)
+	if err != nil {
+		return nil, err
+	}
+	signingInput := parts[0] + "." + parts[1]
+	matched := false
+	for _, key := range keys {
+		if (header.Kid != "" && key.kid != header.Kid) || !keyMatches(key, header.Alg) {
+			continue
+		}
+		matched = true
+		if verifySignature(header.Alg, key.key, signingInput, signature) {
+			return claims, nil
+		}
+	}
+	if !matched {
+		return nil, ErrJWTNoMatchingKey
+	}
+	return nil, ErrJWTVerificationFail
+}
+
+// bearerToken extracts the token from the Authorization header or the
+// access_token query parameter, the locations Istio reads by default
+func bearerToken(r *http.Request) string {
+	if scheme, token, ok := strings.Cut(r.Header.Get("Authorization"), " "); ok && strings.EqualFold(scheme, "Bearer") {
+		return strings.TrimSpace(token)
+	}
+	return r.URL.Query().Get("access_token")
+}
+
+// excluded reports whether path matches an excluded route
+func (v *JWTValidator) excluded(path string) bool {
+	for _, prefix := range v.options.ExcludeRoutes {
+		if strings.HasPrefix(path, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// check validates the token of r
+func (v *JWTValidator) check(r *http.Request) JWTResult {
+	token := bearerToken(r)
+	if token == "" {
+		return JWTResult{Result: JWTResultMissing}
+	}
+	claims, err := v.Validate(r.Context(), token)
+	if err != nil {
+		return JWTResult{Result: JWTResultInvalid, Error: err.Error()}
+	}
+	result := JWTResult{Result: JWTResultValid, Claims: claims}
+	issuer, _ := claims["iss"].(string)
+	subject, _ := claims["sub"].(string)
+	if issuer != "" || subject != "" {
+		result.Principal = issuer + "/" + subject
+	}
+	return result
+}
+
+// Middleware validates the token of every request and stores the result in
+// the request context. In enforce mode an invalid token is rejected with 401
+// Unauthorized; like RequestAuthentication, a missing token is let through
+// and left for authorization policies to deny.
+func (v *JWTValidator) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if v.excluded(r.URL.Path) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		result := v.check(r)
+		jwtValidations.WithLabelValues(v.options.Mode, result.Result).Inc()
+		if result.Result == JWTResultInvalid {
+			observability.WarnWithFields(r.Context(), fmt.Sprintf("Invalid JWT: %s", result.Error), map[string]any{
+				"type":     "jwt_validation",
+				"mode":     v.options.Mode,
+				"error":    result.Error,
+				"rejected": v.options.Mode == JWTModeEnforce,
+			})
+			if v.options.Mode == JWTModeEnforce {
+				w.Header().Set("WWW-Authenticate", `Bearer realm="istio-test", error="invalid_token"`)
+				http.Error(w, result.Error, http.StatusUnauthorized)
+				return
+			}
+		}
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), jwtContextKey{}, result)))
+	})
+}
+
+// JWTHandler returns the validation result of the request token, so tests can
+// compare it with what the sidecar decided for the same request
+func JWTHandler(w http.ResponseWriter, r *http.Request) {
+	result, ok := JWTFromContext(r.Context())
+	if !ok {
+		http.Error(w, "JWT validation is not enabled for this route", http.StatusNotFound)
+		return
+	}
+
+	data, err := json.Marshal(result)
+	if err != nil {
+		http.Error(w, "Failed to encode JWT result", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write(data)
+}
@@ -0,0 +1,278 @@
+package security
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"istio-test/internal/httpclient"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testIssuer = "https://issuer.example.com"
+
+// testJWKS serves the public keys of an RSA and an EC signing key
+type testJWKS struct {
+	rsaKey  *rsa.PrivateKey
+	ecKey   *ecdsa.PrivateKey
+	server  *httptest.Server
+	fetches atomic.Int32
+}
+
+func newTestJWKS(t *testing.T) *testJWKS {
+	t.Helper()
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	jwks := &testJWKS{rsaKey: rsaKey, ecKey: ecKey}
+	encode := base64.RawURLEncoding.EncodeToString
+	body, err := json.Marshal(map[string]any{"keys": []map[string]string{
+		{"kty": "RSA", "kid": "rsa-1", "n": encode(rsaKey.N.Bytes()), "e": encode(big.NewInt(int64(rsaKey.E)).Bytes())},
+		{"kty": "EC", "kid": "ec-1", "crv": "P-256", "x": encode(ecKey.X.FillBytes(make([]byte, 32))), "y": encode(ecKey.Y.FillBytes(make([]byte, 32)))},
+		{"kty": "oct", "kid": "hmac-1", "k": "c2VjcmV0"},
+	}})
+	require.NoError(t, err)
+	jwks.server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		jwks.fetches.Add(1)
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(body)
+	}))
+	t.Cleanup(jwks.server.Close)
+	return jwks
+}
+
+// sign returns a token over claims signed with alg, RS256 or ES256
+func (j *testJWKS) sign(t *testing.T, alg, kid string, claims map[string]any) string {
+	t.Helper()
+	header, err := json.Marshal(map[string]string{"alg": alg, "kid": kid, "typ": "JWT"})
+	require.NoError(t, err)
+	payload, err := json.Marshal(claims)
+	require.NoError(t, err)
+	signingInput := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+
+	digest := crypto.SHA256.New()
+	digest.Write([]byte(signingInput))
+	var signature []byte
+	switch alg {
+	case "RS256":
+		signature, err = rsa.SignPKCS1v15(rand.Reader, j.rsaKey, crypto.SHA256, digest.Sum(nil))
+		require.NoError(t, err)
+	case "ES256":
+		r, s, err := ecdsa.Sign(rand.Reader, j.ecKey, digest.Sum(nil))
+		require.NoError(t, err)
+		signature = append(r.FillBytes(make([]byte, 32)), s.FillBytes(make([]byte, 32))...)
+	}
+	return signingInput + "." + base64.RawURLEncoding.EncodeToString(signature)
+}
+
+func newTestJWTValidator(jwks *testJWKS, options JWTOptions) (*JWTValidator, *time.Time) {
+	options.JWKSURL = jwks.server.URL
+	v := NewJWTValidator(httpclient.NewFactory(nil, nil).Client("jwks-test"), options)
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	v.now = func() time.Time { return now }
+	return v, &now
+}
+
+func TestJWTValidatorValidate(t *testing.T) {
+	jwks := newTestJWKS(t)
+	v, now := newTestJWTValidator(jwks, JWTOptions{Issuer: testIssuer, Audiences: []string{"istio-test", "other"}})
+	claims := func(overrides map[string]any) map[string]any {
+		c := map[string]any{"iss": testIssuer, "sub": "alice", "aud": []string{"istio-test"}, "exp": now.Add(time.Hour).Unix()}
+		for k, value := range overrides {
+			c[k] = value
+		}
+		return c
+	}
+	tamper := func(token string) string { return token[:len(token)-4] + "AAAA" }
+
+	tests := []struct {
+		name    string
+		token   string
+		wantErr error
+	}{
+		{name: "RS256 token", token: jwks.sign(t, "RS256", "rsa-1", claims(nil))},
+		{name: "ES256 token", token: jwks.sign(t, "ES256", "ec-1", claims(nil))},
+		{name: "token without kid", token: jwks.sign(t, "RS256", "", claims(nil))},
+		{name: "string audience", token: jwks.sign(t, "RS256", "rsa-1", claims(map[string]any{"aud": "other"}))},
+		{name: "expired within skew", token: jwks.sign(t, "RS256", "rsa-1", claims(map[string]any{"exp": now.Add(-30 * time.Second).Unix()}))},
+		{name: "not two dots", token: "abc.def", wantErr: ErrJWTBadFormat},
+		{name: "header not JSON", token: "bm9wZQ.e30.c2ln", wantErr: ErrJWTHeaderBadJSON},
+		{name: "HS256 token", token: jwks.sign(t, "HS256", "hmac-1", claims(nil)), wantErr: ErrJWTAlgNotSupported},
+		{name: "wrong issuer", token: jwks.sign(t, "RS256", "rsa-1", claims(map[string]any{"iss": "https://evil.example.com"})), wantErr: ErrJWTUnknownIssuer},
+		{name: "expired", token: jwks.sign(t, "RS256", "rsa-1", claims(map[string]any{"exp": now.Add(-2 * time.Minute).Unix()})), wantErr: ErrJWTExpired},
+		{name: "not yet valid", token: jwks.sign(t, "RS256", "rsa-1", claims(map[string]any{"nbf": now.Add(2 * time.Minute).Unix()})), wantErr: ErrJWTNotYetValid},
+		{name: "wrong audience", token: jwks.sign(t, "RS256", "rsa-1", claims(map[string]any{"aud": "someone-else"})), wantErr: ErrJWTAudience},
+		{name: "unknown kid", token: jwks.sign(t, "RS256", "rsa-2", claims(nil)), wantErr: ErrJWTNoMatchingKey},
+		{name: "kid of another key type", token: jwks.sign(t, "RS256", "ec-1", claims(nil)), wantErr: ErrJWTNoMatchingKey},
+		{name: "tampered signature", token: tamper(jwks.sign(t, "ES256", "ec-1", claims(nil))), wantErr: ErrJWTVerificationFail},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := v.Validate(context.Background(), tt.token)
+			if tt.wantErr != nil {
+				assert.ErrorIs(t, err, tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, "alice", got["sub"])
+		})
+	}
+}
+
+func TestJWTValidatorKeyRefresh(t *testing.T) {
+	jwks := newTestJWKS(t)
+	v, now := newTestJWTValidator(jwks, JWTOptions{JWKSRefresh: 10 * time.Minute})
+	valid := jwks.sign(t, "RS256", "rsa-1", map[string]any{"sub": "alice"})
+	unknown := jwks.sign(t, "RS256", "rotated", map[string]any{"sub": "alice"})
+
+	_, err := v.Validate(context.Background(), valid)
+	require.NoError(t, err)
+	_, err = v.Validate(context.Background(), unknown)
+	assert.ErrorIs(t, err, ErrJWTNoMatchingKey)
+	assert.Equal(t, int32(1), jwks.fetches.Load(), "unknown kids refetch at most once a minute")
+
+	*now = now.Add(2 * time.Minute)
+	_, err = v.Validate(context.Background(), unknown)
+	assert.ErrorIs(t, err, ErrJWTNoMatchingKey)
+	assert.Equal(t, int32(2), jwks.fetches.Load())
+
+	*now = now.Add(10 * time.Minute)
+	_, err = v.Validate(context.Background(), valid)
+	require.NoError(t, err)
+	assert.Equal(t, int32(3), jwks.fetches.Load(), "keys are refetched after the refresh interval")
+
+	jwks.server.Close()
+	*now = now.Add(10 * time.Minute)
+	_, err = v.Validate(context.Background(), valid)
+	assert.NoError(t, err, "cached keys are used while the JWKS is unreachable")
+}
+
+func TestJWTValidatorFetchError(t *testing.T) {
+	server := httptest.NewServer(http.NotFoundHandler())
+	defer server.Close()
+
+	v := NewJWTValidator(httpclient.NewFactory(nil, nil).Client("jwks-test"), JWTOptions{JWKSURL: server.URL})
+	_, err := v.Validate(context.Background(), "eyJhbGciOiJSUzI1NiJ9.e30.c2ln")
+	assert.ErrorIs(t, err, ErrJWKSFetch)
+	assert.ErrorContains(t, err, "status 404")
+}
+
+func TestJWTValidatorFetchBackoff(t *testing.T) {
+	var fetches atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fetches.Add(1)
+		time.Sleep(10 * time.Millisecond)
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	v := NewJWTValidator(httpclient.NewFactory(nil, nil).Client("jwks-test"), JWTOptions{JWKSURL: server.URL})
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	v.now = func() time.Time { return now }
+	validate := func() {
+		var wg sync.WaitGroup
+		for i := 0; i < 10; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				_, err := v.Validate(context.Background(), "eyJhbGciOiJSUzI1NiJ9.e30.c2ln")
+				assert.ErrorIs(t, err, ErrJWKSFetch)
+			}()
+		}
+		wg.Wait()
+	}
+
+	validate()
+	assert.Equal(t, int32(1), fetches.Load(), "concurrent requests share one fetch and then back off")
+
+	now = now.Add(500 * time.Millisecond)
+	validate()
+	assert.Equal(t, int32(1), fetches.Load(), "no fetch within the backoff")
+
+	now = now.Add(500 * time.Millisecond)
+	validate()
+	assert.Equal(t, int32(2), fetches.Load(), "one fetch once the backoff passed")
+
+	now = now.Add(time.Second)
+	validate()
+	assert.Equal(t, int32(2), fetches.Load(), "the backoff doubles with every failure")
+
+	now = now.Add(time.Second)
+	validate()
+	assert.Equal(t, int32(3), fetches.Load())
+}
+
+func TestJWTMiddleware(t *testing.T) {
+	jwks := newTestJWKS(t)
+	valid := jwks.sign(t, "RS256", "rsa-1", map[string]any{"iss": testIssuer, "sub": "alice"})
+	forged := jwks.sign(t, "RS256", "rsa-1", map[string]any{"iss": "https://evil.example.com", "sub": "mallory"})
+
+	tests := []struct {
+		name          string
+		mode          string
+		path          string
+		authorization string
+		wantStatus    int
+		wantResult    *JWTResult
+	}{
+		{name: "valid bearer token", mode: JWTModeEnforce, path: "/istio-test/jwt", authorization: "Bearer " + valid, wantStatus: http.StatusOK,
+			wantResult: &JWTResult{Result: JWTResultValid, Principal: testIssuer + "/alice"}},
+		{name: "valid query token", mode: JWTModeEnforce, path: "/istio-test/jwt?access_token=" + valid, wantStatus: http.StatusOK,
+			wantResult: &JWTResult{Result: JWTResultValid, Principal: testIssuer + "/alice"}},
+		{name: "missing token passes", mode: JWTModeEnforce, path: "/istio-test/jwt", wantStatus: http.StatusOK,
+			wantResult: &JWTResult{Result: JWTResultMissing}},
+		{name: "basic auth is not a token", mode: JWTModeEnforce, path: "/istio-test/jwt", authorization: "Basic YWxpY2U6c2VjcmV0", wantStatus: http.StatusOK,
+			wantResult: &JWTResult{Result: JWTResultMissing}},
+		{name: "invalid token rejected when enforcing", mode: JWTModeEnforce, path: "/istio-test/jwt", authorization: "Bearer " + forged, wantStatus: http.StatusUnauthorized},
+		{name: "invalid token observed", mode: JWTModeObserve, path: "/istio-test/jwt", authorization: "Bearer " + forged, wantStatus: http.StatusOK,
+			wantResult: &JWTResult{Result: JWTResultInvalid, Error: ErrJWTUnknownIssuer.Error()}},
+		{name: "excluded route", mode: JWTModeEnforce, path: "/istio-test/health", authorization: "Bearer " + forged, wantStatus: http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v, _ := newTestJWTValidator(jwks, JWTOptions{Mode: tt.mode, Issuer: testIssuer, ExcludeRoutes: []string{"/istio-test/health"}})
+			handler := v.Middleware(http.HandlerFunc(JWTHandler))
+
+			req := httptest.NewRequest(http.MethodGet, tt.path, nil)
+			if tt.authorization != "" {
+				req.Header.Set("Authorization", tt.authorization)
+			}
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, req)
+
+			require.Equal(t, tt.wantStatus, w.Code)
+			switch {
+			case tt.wantStatus == http.StatusUnauthorized:
+				assert.Contains(t, w.Body.String(), ErrJWTUnknownIssuer.Error())
+				assert.Contains(t, w.Header().Get("WWW-Authenticate"), `error="invalid_token"`)
+			case tt.wantResult != nil:
+				var got JWTResult
+				require.NoError(t, json.Unmarshal(w.Body.Bytes(), &got))
+				assert.Equal(t, tt.wantResult.Result, got.Result)
+				assert.Equal(t, tt.wantResult.Error, got.Error)
+				assert.Equal(t, tt.wantResult.Principal, got.Principal)
+				if got.Result == JWTResultValid {
+					assert.Equal(t, "alice", got.Claims["sub"])
+				}
+			}
+		})
+	}
+}
@@ -37,10 +37,36 @@
 //   - SECURITY_API_COEP= (empty, header not set)
 //   - SECURITY_API_COOP=same-origin-allow-popups
 //   - SECURITY_API_CORP=cross-origin
+//
+// Transport and feature policies (opt-in, for all endpoints):
+//   - SECURITY_HSTS_MAX_AGE=8760h (zero, the default, leaves Strict-Transport-Security unset)
+//   - SECURITY_HSTS_INCLUDE_SUBDOMAINS=true
+//   - SECURITY_HSTS_PRELOAD=true
+//   - SECURITY_PERMISSIONS_POLICY=camera=(), microphone=(), geolocation=()
+//
+// # Rate Limiting
+//
+// RateLimiter is an opt-in token bucket limiter, global or per client IP,
+// configured with RATE_LIMIT_RPS and RATE_LIMIT_BURST. Rejected requests get
+// 429 Too Many Requests with a Retry-After header. Clients are keyed on the
+// peer address, or on the X-Forwarded-For entry added by the outermost of
+// RATE_LIMIT_TRUSTED_HOPS proxies, never on entries a client could spoof.
+//
+// # Admin Authentication
+//
+// AdminAuth requires a static token, set with ADMIN_AUTH_TOKEN or read from
+// ADMIN_AUTH_TOKEN_FILE, on the routes in ADMIN_AUTH_ROUTES. The token is sent
+// as a bearer token or in the X-Istio-Test-Admin-Token header.
 package security
 
 import (
+	"fmt"
 	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
 )
 
 // SecurityHeadersOptions defines configurable security header policies
@@ -53,6 +79,69 @@ type SecurityHeadersOptions struct {
 	// Other configurable headers (future extensibility)
 	EnableStrictCSP bool   // Whether to use strict Content Security Policy
 	CacheControl    string // Custom Cache-Control header (empty uses default)
+
+	// Transport and feature policies, unset unless configured
+	HSTS              HSTSOptions // Strict-Transport-Security
+	PermissionsPolicy string      // Permissions-Policy value, e.g. "camera=(), microphone=()"
+}
+
+// HSTSOptions configures the Strict-Transport-Security header. TLS is
+// terminated by the ingress gateway, so the header is set on every response
+// rather than only on requests the service itself received over TLS.
+type HSTSOptions struct {
+	MaxAge            time.Duration // Time browsers keep to HTTPS, zero leaves the header unset
+	IncludeSubDomains bool          // Apply the policy to every subdomain
+	Preload           bool          // Ask to be included in browser preload lists
+}
+
+// hstsPreloadMinAge is the shortest max-age browser preload lists accept
+const hstsPreloadMinAge = 365 * 24 * time.Hour
+
+// Validate reports options that browsers or preload lists would reject
+func (o HSTSOptions) Validate() error {
+	if o.MaxAge < 0 {
+		return fmt.Errorf("invalid HSTS max-age: must not be negative")
+	}
+	if o.MaxAge%time.Second != 0 {
+		return fmt.Errorf("invalid HSTS max-age %v: must be whole seconds", o.MaxAge)
+	}
+	if o.Preload && (o.MaxAge < hstsPreloadMinAge || !o.IncludeSubDomains) {
+		return fmt.Errorf("invalid HSTS preload: requires includeSubDomains and a max-age of at least %v", hstsPreloadMinAge)
+	}
+	return nil
+}
+
+// Value returns the header value, or "" when HSTS is disabled
+func (o HSTSOptions) Value() string {
+	if o.MaxAge <= 0 {
+		return ""
+	}
+	value := "max-age=" + strconv.FormatInt(int64(o.MaxAge/time.Second), 10)
+	if o.IncludeSubDomains {
+		value += "; includeSubDomains"
+	}
+	if o.Preload {
+		value += "; preload"
+	}
+	return value
+}
+
+// permissionsPolicyFeature matches a Permissions-Policy feature name
+var permissionsPolicyFeature = regexp.MustCompile(`^[a-z][a-z0-9-]*$`)
+
+// ValidatePermissionsPolicy reports whether policy is a list of
+// feature=allowlist directives, e.g. "camera=(), geolocation=(self)"
+func ValidatePermissionsPolicy(policy string) error {
+	for _, directive := range strings.Split(policy, ",") {
+		feature, allowlist, ok := strings.Cut(strings.TrimSpace(directive), "=")
+		if !ok || !permissionsPolicyFeature.MatchString(feature) {
+			return fmt.Errorf("invalid Permissions-Policy directive '%s': must be feature=allowlist", strings.TrimSpace(directive))
+		}
+		if allowlist != "*" && allowlist != "self" && (!strings.HasPrefix(allowlist, "(") || !strings.HasSuffix(allowlist, ")")) {
+			return fmt.Errorf("invalid Permissions-Policy allowlist '%s' for %s: must be *, self or a parenthesized list", allowlist, feature)
+		}
+	}
+	return nil
 }
 
 // StrictSecurityOptions returns the most restrictive security options (original behavior)
@@ -131,9 +220,14 @@ func SecurityMiddleware(next http.Handler) http.Handler {
 
 // SecurityMiddlewareWithOptions wraps an HTTP handler with configurable security headers
 func SecurityMiddlewareWithOptions(next http.Handler, options SecurityHeadersOptions) http.Handler {
+	return SecurityMiddlewareWithHeaders(next, NewHeaders(options))
+}
+
+// SecurityMiddlewareWithHeaders wraps an HTTP handler with the security headers of a reloadable handle
+func SecurityMiddlewareWithHeaders(next http.Handler, headers *Headers) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		// Set security headers with options
-		setSecurityHeadersWithOptions(w, options)
+		headers.get().apply(w.Header())
 
 		// Call the next handler
 		next.ServeHTTP(w, r)
@@ -147,9 +241,14 @@ func SecurityMiddlewareFunc(next http.HandlerFunc) http.HandlerFunc {
 
 // SecurityMiddlewareFuncWithOptions wraps an HTTP handler function with configurable security headers
 func SecurityMiddlewareFuncWithOptions(next http.HandlerFunc, options SecurityHeadersOptions) http.HandlerFunc {
+	return SecurityMiddlewareFuncWithHeaders(next, NewHeaders(options))
+}
+
+// SecurityMiddlewareFuncWithHeaders wraps an HTTP handler function with the security headers of a reloadable handle
+func SecurityMiddlewareFuncWithHeaders(next http.HandlerFunc, headers *Headers) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		// Set security headers with options
-		setSecurityHeadersWithOptions(w, options)
+		headers.get().apply(w.Header())
 
 		// Call the next handler
 		next.ServeHTTP(w, r)
@@ -163,6 +262,11 @@ func MethodValidationMiddleware(allowedMethods ...string) func(http.Handler) htt
 
 // MethodValidationMiddlewareWithOptions ensures only specified HTTP methods are allowed with configurable security headers
 func MethodValidationMiddlewareWithOptions(options SecurityHeadersOptions, allowedMethods ...string) func(http.Handler) http.Handler {
+	return MethodValidationMiddlewareWithHeaders(NewHeaders(options), allowedMethods...)
+}
+
+// MethodValidationMiddlewareWithHeaders ensures only specified HTTP methods are allowed with the security headers of a reloadable handle
+func MethodValidationMiddlewareWithHeaders(headers *Headers, allowedMethods ...string) func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			// Check if the method is allowed
@@ -175,14 +279,14 @@ func MethodValidationMiddlewareWithOptions(options SecurityHeadersOptions, allow
 			}
 
 			if !methodAllowed {
-				setSecurityHeadersWithOptions(w, options)
+				headers.get().apply(w.Header())
 				w.Header().Set("Allow", joinMethods(allowedMethods))
 				http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
 				return
 			}
 
 			// Method is allowed, proceed with security headers and next handler
-			setSecurityHeadersWithOptions(w, options)
+			headers.get().apply(w.Header())
 			next.ServeHTTP(w, r)
 		})
 	}
@@ -195,6 +299,11 @@ func MethodValidationMiddlewareFunc(allowedMethods ...string) func(http.HandlerF
 
 // MethodValidationMiddlewareFuncWithOptions ensures only specified HTTP methods are allowed for handler functions with configurable security headers
 func MethodValidationMiddlewareFuncWithOptions(options SecurityHeadersOptions, allowedMethods ...string) func(http.HandlerFunc) http.HandlerFunc {
+	return MethodValidationMiddlewareFuncWithHeaders(NewHeaders(options), allowedMethods...)
+}
+
+// MethodValidationMiddlewareFuncWithHeaders ensures only specified HTTP methods are allowed for handler functions with the security headers of a reloadable handle
+func MethodValidationMiddlewareFuncWithHeaders(headers *Headers, allowedMethods ...string) func(http.HandlerFunc) http.HandlerFunc {
 	return func(next http.HandlerFunc) http.HandlerFunc {
 		return func(w http.ResponseWriter, r *http.Request) {
 			// Check if the method is allowed
@@ -207,14 +316,14 @@ func MethodValidationMiddlewareFuncWithOptions(options SecurityHeadersOptions, a
 			}
 
 			if !methodAllowed {
-				setSecurityHeadersWithOptions(w, options)
+				headers.get().apply(w.Header())
 				w.Header().Set("Allow", joinMethods(allowedMethods))
 				http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
 				return
 			}
 
 			// Method is allowed, proceed with security headers and next handler
-			setSecurityHeadersWithOptions(w, options)
+			headers.get().apply(w.Header())
 			next.ServeHTTP(w, r)
 		}
 	}
@@ -226,44 +335,118 @@ func setSecurityHeaders(w http.ResponseWriter) {
 	setSecurityHeadersWithOptions(w, StrictSecurityOptions())
 }
 
-// setSecurityHeadersWithOptions adds security headers based on the provided options
+// setSecurityHeadersWithOptions adds security headers based on the provided
+// options; middleware precomputes them with newSecurityHeaders instead
 func setSecurityHeadersWithOptions(w http.ResponseWriter, options SecurityHeadersOptions) {
-	headers := w.Header()
+	newSecurityHeaders(options).apply(w.Header())
+}
+
+// securityHeaders is the immutable set of headers computed from a
+// SecurityHeadersOptions, with canonical names in the order they are set
+type securityHeaders struct {
+	names  []string
+	values []string
+}
+
+// newSecurityHeaders computes the headers of options once, so that
+// middleware copies them into each response instead of rebuilding them
+func newSecurityHeaders(options SecurityHeadersOptions) *securityHeaders {
+	h := &securityHeaders{}
+	add := func(name, value string) {
+		h.names = append(h.names, http.CanonicalHeaderKey(name))
+		h.values = append(h.values, value)
+	}
 
 	// Always set these fundamental security headers
-	headers.Set("X-Content-Type-Options", "nosniff")
-	headers.Set("X-Frame-Options", "DENY")
-	headers.Set("X-XSS-Protection", "1; mode=block")
-	headers.Set("Referrer-Policy", "strict-origin-when-cross-origin")
-	headers.Set("X-Permitted-Cross-Domain-Policies", "none")
-	headers.Set("Server", "istio-test")
+	add("X-Content-Type-Options", "nosniff")
+	add("X-Frame-Options", "DENY")
+	add("X-XSS-Protection", "1; mode=block")
+	add("Referrer-Policy", "strict-origin-when-cross-origin")
+	add("X-Permitted-Cross-Domain-Policies", "none")
+	add("Server", "istio-test")
 
 	// Content Security Policy - always strict to match test expectations
-	headers.Set("Content-Security-Policy", "default-src 'none'; frame-ancestors 'none'")
+	add("Content-Security-Policy", "default-src 'none'; frame-ancestors 'none'")
 
 	// Cache Control - configurable or default
 	if options.CacheControl != "" {
-		headers.Set("Cache-Control", options.CacheControl)
+		add("Cache-Control", options.CacheControl)
 	} else {
-		headers.Set("Cache-Control", "no-cache, no-store, must-revalidate, private")
+		add("Cache-Control", "no-cache, no-store, must-revalidate, private")
 	}
-	headers.Set("Pragma", "no-cache")
-	headers.Set("Expires", "0")
+	add("Pragma", "no-cache")
+	add("Expires", "0")
 
 	// Cross-Origin policies - only set if specified (non-empty)
 	if options.COEP != "" {
-		headers.Set("Cross-Origin-Embedder-Policy", options.COEP)
+		add("Cross-Origin-Embedder-Policy", options.COEP)
 	}
 
 	if options.COOP != "" {
-		headers.Set("Cross-Origin-Opener-Policy", options.COOP)
+		add("Cross-Origin-Opener-Policy", options.COOP)
 	}
 
 	if options.CORP != "" {
-		headers.Set("Cross-Origin-Resource-Policy", options.CORP)
+		add("Cross-Origin-Resource-Policy", options.CORP)
+	}
+
+	// Transport and feature policies - only set if configured
+	if hsts := options.HSTS.Value(); hsts != "" {
+		add("Strict-Transport-Security", hsts)
+	}
+
+	if options.PermissionsPolicy != "" {
+		add("Permissions-Policy", options.PermissionsPolicy)
+	}
+	return h
+}
+
+// apply sets the headers in one pass, replacing any previous values. The
+// values are copied into a single allocation so that handlers changing a
+// response header never alter the precomputed set.
+func (h *securityHeaders) apply(header http.Header) {
+	values := make([]string, len(h.values))
+	copy(values, h.values)
+	for i, name := range h.names {
+		header[name] = values[i : i+1 : i+1]
 	}
 }
 
+// Headers holds the security header options of the middleware created with
+// it. Setting new options changes the headers of that middleware only, so
+// header policies are reloaded without a restart.
+type Headers struct {
+	current atomic.Pointer[headerSet]
+}
+
+// headerSet is a set of options with the headers computed from them
+type headerSet struct {
+	options SecurityHeadersOptions
+	headers *securityHeaders
+}
+
+// NewHeaders creates a handle on options for middleware to share
+func NewHeaders(options SecurityHeadersOptions) *Headers {
+	h := &Headers{}
+	h.Set(options)
+	return h
+}
+
+// Options returns the options currently applied
+func (h *Headers) Options() SecurityHeadersOptions {
+	return h.current.Load().options
+}
+
+// Set makes the middleware created with h set the headers of options
+func (h *Headers) Set(options SecurityHeadersOptions) {
+	h.current.Store(&headerSet{options: options, headers: newSecurityHeaders(options)})
+}
+
+// get returns the current headers
+func (h *Headers) get() *securityHeaders {
+	return h.current.Load().headers
+}
+
 // joinMethods joins allowed methods with comma separator for Allow header
 func joinMethods(methods []string) string {
 	if len(methods) == 0 {
@@ -284,5 +467,11 @@ func SecureHandler(allowedMethods []string, handler http.HandlerFunc) http.Handl
 
 // SecureHandlerWithOptions wraps a handler function with both security headers and method validation using configurable security options
 func SecureHandlerWithOptions(allowedMethods []string, handler http.HandlerFunc, options SecurityHeadersOptions) http.HandlerFunc {
-	return MethodValidationMiddlewareFuncWithOptions(options, allowedMethods...)(SecurityMiddlewareFuncWithOptions(handler, options))
+	return SecureHandlerWithHeaders(allowedMethods, handler, NewHeaders(options))
+}
+
+// SecureHandlerWithHeaders wraps a handler function with both security headers and method validation using a reloadable handle
+func SecureHandlerWithHeaders(allowedMethods []string, handler http.HandlerFunc, headers *Headers) http.HandlerFunc {
+	// Method validation sets the security headers on every response it lets through
+	return MethodValidationMiddlewareFuncWithHeaders(headers, allowedMethods...)(handler)
 }
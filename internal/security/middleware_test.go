@@ -4,6 +4,7 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"testing"
+	"time"
 )
 
 func TestSecurityMiddleware(t *testing.T) {
@@ -348,3 +349,207 @@ func TestSetSecurityHeaders(t *testing.T) {
 		t.Errorf("Expected %d security headers, but found %d", len(expectedHeaders), headerCount)
 	}
 }
+
+func TestHSTSOptionsValue(t *testing.T) {
+	tests := []struct {
+		name     string
+		options  HSTSOptions
+		expected string
+	}{
+		{"disabled", HSTSOptions{}, ""},
+		{"max-age only", HSTSOptions{MaxAge: 24 * time.Hour}, "max-age=86400"},
+		{"subdomains", HSTSOptions{MaxAge: time.Hour, IncludeSubDomains: true}, "max-age=3600; includeSubDomains"},
+		{"preload", HSTSOptions{MaxAge: 365 * 24 * time.Hour, IncludeSubDomains: true, Preload: true}, "max-age=31536000; includeSubDomains; preload"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if actual := tt.options.Value(); actual != tt.expected {
+				t.Errorf("Expected %q, got %q", tt.expected, actual)
+			}
+		})
+	}
+}
+
+func TestTransportAndFeaturePolicyHeaders(t *testing.T) {
+	w := httptest.NewRecorder()
+	setSecurityHeadersWithOptions(w, StrictSecurityOptions())
+	for _, header := range []string{"Strict-Transport-Security", "Permissions-Policy"} {
+		if _, ok := w.Header()[header]; ok {
+			t.Errorf("Expected %s to be unset by default", header)
+		}
+	}
+
+	options := APISecurityOptions()
+	options.HSTS = HSTSOptions{MaxAge: 365 * 24 * time.Hour, IncludeSubDomains: true}
+	options.PermissionsPolicy = "camera=(), geolocation=(self)"
+	w = httptest.NewRecorder()
+	setSecurityHeadersWithOptions(w, options)
+
+	if actual := w.Header().Get("Strict-Transport-Security"); actual != "max-age=31536000; includeSubDomains" {
+		t.Errorf("Unexpected Strict-Transport-Security %q", actual)
+	}
+	if actual := w.Header().Get("Permissions-Policy"); actual != "camera=(), geolocation=(self)" {
+		t.Errorf("Unexpected Permissions-Policy %q", actual)
+	}
+}
+
+func TestHSTSOptionsValidate(t *testing.T) {
+	tests := []struct {
+		name        string
+		options     HSTSOptions
+		expectError bool
+	}{
+		{"disabled", HSTSOptions{}, false},
+		{"one year with preload", HSTSOptions{MaxAge: 365 * 24 * time.Hour, IncludeSubDomains: true, Preload: true}, false},
+		{"negative max-age", HSTSOptions{MaxAge: -time.Second}, true},
+		{"fractional seconds", HSTSOptions{MaxAge: 1500 * time.Millisecond}, true},
+		{"preload without subdomains", HSTSOptions{MaxAge: 365 * 24 * time.Hour, Preload: true}, true},
+		{"preload with short max-age", HSTSOptions{MaxAge: time.Hour, IncludeSubDomains: true, Preload: true}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.options.Validate()
+			if tt.expectError && err == nil {
+				t.Error("expected error but got none")
+			}
+			if !tt.expectError && err != nil {
+				t.Errorf("unexpected error: %v", err)
+			}
+		})
+	}
+}
+
+func TestValidatePermissionsPolicy(t *testing.T) {
+	valid := []string{
+		"camera=()",
+		"camera=(), microphone=(), geolocation=()",
+		`fullscreen=*, geolocation=(self "https://maps.example.com")`,
+		"payment=self",
+	}
+	for _, policy := range valid {
+		if err := ValidatePermissionsPolicy(policy); err != nil {
+			t.Errorf("Expected %q to be valid, got %v", policy, err)
+		}
+	}
+
+	invalid := []string{
+		"camera",
+		"camera 'none'",
+		"Camera=()",
+		"camera=none",
+		"camera=(), ",
+	}
+	for _, policy := range invalid {
+		if err := ValidatePermissionsPolicy(policy); err == nil {
+			t.Errorf("Expected %q to be invalid", policy)
+		}
+	}
+}
+
+// benchmarkWriter is a ResponseWriter whose header map is reused across
+// iterations, so that benchmarks measure the header values only
+type benchmarkWriter struct {
+	header http.Header
+}
+
+func (w *benchmarkWriter) Header() http.Header         { return w.header }
+func (w *benchmarkWriter) Write(b []byte) (int, error) { return len(b), nil }
+func (w *benchmarkWriter) WriteHeader(int)             {}
+
+func benchmarkOptions() SecurityHeadersOptions {
+	options := APISecurityOptions()
+	options.HSTS = HSTSOptions{MaxAge: 365 * 24 * time.Hour, IncludeSubDomains: true}
+	options.PermissionsPolicy = "camera=(), geolocation=(self)"
+	return options
+}
+
+func BenchmarkSecurityMiddleware(b *testing.B) {
+	handler := SecurityMiddlewareWithOptions(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {}), benchmarkOptions())
+	w := &benchmarkWriter{header: http.Header{}}
+	r := httptest.NewRequest(http.MethodGet, "/istio-test/whoami", nil)
+
+	b.ReportAllocs()
+	for b.Loop() {
+		clear(w.header)
+		handler.ServeHTTP(w, r)
+	}
+}
+
+func BenchmarkSecureHandler(b *testing.B) {
+	handler := SecureHandlerWithOptions([]string{"GET"}, func(http.ResponseWriter, *http.Request) {}, benchmarkOptions())
+	w := &benchmarkWriter{header: http.Header{}}
+	r := httptest.NewRequest(http.MethodGet, "/istio-test/whoami", nil)
+
+	b.ReportAllocs()
+	for b.Loop() {
+		clear(w.header)
+		handler(w, r)
+	}
+}
+
+func TestSecurityHeadersImmutable(t *testing.T) {
+	var seen []string
+	handler := SecurityMiddlewareWithOptions(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		seen = append(seen, w.Header().Get("Cache-Control"))
+		// Handlers may change or extend the headers of their own response
+		w.Header()["Cache-Control"][0] = "public, max-age=60"
+		w.Header().Add("X-Frame-Options", "SAMEORIGIN")
+	}), StrictSecurityOptions())
+
+	for range 2 {
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+		if actual := w.Header().Values("X-Frame-Options"); len(actual) != 2 || actual[0] != "DENY" {
+			t.Errorf("Expected DENY followed by the handler's value, got %v", actual)
+		}
+	}
+
+	// Changes made for the first response do not leak into the second
+	for _, cacheControl := range seen {
+		if cacheControl != "no-cache, no-store, must-revalidate, private" {
+			t.Errorf("Unexpected Cache-Control %q", cacheControl)
+		}
+	}
+}
+
+func TestHeadersSet(t *testing.T) {
+	options := CustomSecurityOptions("", "same-origin", "same-site")
+	headers := NewHeaders(options)
+	handler := SecureHandlerWithHeaders([]string{"GET"}, func(w http.ResponseWriter, r *http.Request) {}, headers)
+	serve := func(handler http.HandlerFunc) http.Header {
+		w := httptest.NewRecorder()
+		handler(w, httptest.NewRequest(http.MethodGet, "/", nil))
+		return w.Header()
+	}
+
+	// Middleware created with equal options but its own handle
+	other := SecureHandlerWithOptions([]string{"GET"}, func(w http.ResponseWriter, r *http.Request) {}, options)
+
+	replacement := options
+	replacement.CORP = "cross-origin"
+	replacement.PermissionsPolicy = "camera=()"
+	headers.Set(replacement)
+	if headers.Options() != replacement {
+		t.Errorf("Expected the replacement options, got %+v", headers.Options())
+	}
+	if actual := serve(handler).Get("Cross-Origin-Resource-Policy"); actual != "cross-origin" {
+		t.Errorf("Expected the replaced CORP, got %q", actual)
+	}
+	if actual := serve(handler).Get("Permissions-Policy"); actual != "camera=()" {
+		t.Errorf("Expected the replaced Permissions-Policy, got %q", actual)
+	}
+	if actual := serve(other).Get("Cross-Origin-Resource-Policy"); actual != "same-site" {
+		t.Errorf("Expected the CORP of the other handle to stay, got %q", actual)
+	}
+
+	headers.Set(options)
+	header := serve(handler)
+	if actual := header.Get("Cross-Origin-Resource-Policy"); actual != "same-site" {
+		t.Errorf("Expected the original CORP once restored, got %q", actual)
+	}
+	if _, ok := header["Permissions-Policy"]; ok {
+		t.Error("Expected no Permissions-Policy once restored")
+	}
+}
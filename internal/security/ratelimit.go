@@ -0,0 +1,199 @@
+package security
+
+import (
+	"container/list"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"istio-test/internal/observability"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// maxRateLimitClients bounds the number of per-client buckets kept in memory;
+// past it the least recently seen client loses its bucket
+const maxRateLimitClients = 10000
+
+var rateLimitedRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Namespace: "istio_test",
+	Name:      "rate_limited_requests_total",
+	Help:      "Total number of requests rejected by the in-app rate limiter.",
+}, []string{"scope"})
+
+func init() {
+	observability.MetricsRegistry().MustRegister(rateLimitedRequests)
+}
+
+// RateLimitOptions configures the in-app rate limiter
+type RateLimitOptions struct {
+	RPS           float64  // Sustained requests per second
+	Burst         int      // Requests allowed at once, defaults to RPS rounded up
+	PerClientIP   bool     // Limit every client IP separately instead of all requests together
+	TrustedHops   int      // Proxies in front of the app that append to X-Forwarded-For, zero keys clients on the peer address
+	ExcludeRoutes []string // Path prefixes that are never limited
+}
+
+// bucket is a token bucket refilled continuously at the configured rate
+type bucket struct {
+	key    string
+	tokens float64
+	last   time.Time
+}
+
+// RateLimiter is a token bucket rate limiter, either global or per client IP.
+// It mirrors what Istio's local rate limit filter does in the sidecar, so the
+// two can be compared under the same load.
+type RateLimiter struct {
+	mu         sync.Mutex
+	options    RateLimitOptions
+	global     *bucket
+	clients    map[string]*list.Element // Client buckets by key
+	recent     *list.List               // Client buckets, most recently seen first
+	maxClients int
+	now        func() time.Time
+}
+
+// NewRateLimiter creates a rate limiter
+func NewRateLimiter(options RateLimitOptions) *RateLimiter {
+	if options.Burst <= 0 {
+		options.Burst = int(math.Ceil(options.RPS))
+	}
+	return &RateLimiter{
+		options:    options,
+		clients:    make(map[string]*list.Element),
+		recent:     list.New(),
+		maxClients: maxRateLimitClients,
+		now:        time.Now,
+	}
+}
+
+// Limit returns the sustained rate and burst currently enforced
+func (l *RateLimiter) Limit() (rps float64, burst int) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.options.RPS, l.options.Burst
+}
+
+// SetLimit changes the sustained rate and burst while serving; a burst of
+// zero uses the rate rounded up. Tokens above the new burst are dropped on
+// the next request.
+func (l *RateLimiter) SetLimit(rps float64, burst int) {
+	if burst <= 0 {
+		burst = int(math.Ceil(rps))
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.options.RPS, l.options.Burst = rps, burst
+}
+
+// refill adds the tokens accrued since the last request to b
+func (l *RateLimiter) refill(b *bucket, now time.Time) {
+	elapsed := now.Sub(b.last).Seconds()
+	b.tokens = math.Min(float64(l.options.Burst), b.tokens+elapsed*l.options.RPS)
+	b.last = now
+}
+
+// clientBucket returns the bucket of key, creating it when needed. Once
+// maxClients buckets exist the least recently seen one is dropped, so memory
+// stays bounded however many addresses send requests.
+func (l *RateLimiter) clientBucket(key string, now time.Time) *bucket {
+	if element, ok := l.clients[key]; ok {
+		l.recent.MoveToFront(element)
+		return element.Value.(*bucket)
+	}
+
+	if l.recent.Len() >= l.maxClients {
+		oldest := l.recent.Back()
+		l.recent.Remove(oldest)
+		delete(l.clients, oldest.Value.(*bucket).key)
+	}
+	b := &bucket{key: key, tokens: float64(l.options.Burst), last: now}
+	l.clients[key] = l.recent.PushFront(b)
+	return b
+}
+
+// Allow takes a token for key and reports whether the request may proceed.
+// When it may not, the returned duration is the time until a token is available.
+func (l *RateLimiter) Allow(key string) (bool, time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	var b *bucket
+	if l.options.PerClientIP {
+		b = l.clientBucket(key, now)
+	} else {
+		if l.global == nil {
+			l.global = &bucket{tokens: float64(l.options.Burst), last: now}
+		}
+		b = l.global
+	}
+
+	l.refill(b, now)
+	if b.tokens >= 1 {
+		b.tokens--
+		return true, 0
+	}
+	return false, time.Duration((1 - b.tokens) / l.options.RPS * float64(time.Second))
+}
+
+// clientKey returns the address requests of r are limited by. X-Forwarded-For
+// is only trusted as far as the configured proxies append to it: its leftmost
+// entries are set by the client and could be spoofed to dodge the limit or
+// to exhaust the bucket of another client.
+func (l *RateLimiter) clientKey(r *http.Request) string {
+	if hops := l.options.TrustedHops; hops > 0 {
+		var addresses []string
+		for _, value := range r.Header.Values("X-Forwarded-For") {
+			addresses = append(addresses, strings.Split(value, ",")...)
+		}
+		if len(addresses) >= hops {
+			return strings.TrimSpace(addresses[len(addresses)-hops])
+		}
+	}
+
+	if host, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+		return host
+	}
+	return r.RemoteAddr
+}
+
+// excluded reports whether path matches an excluded route
+func (l *RateLimiter) excluded(path string) bool {
+	for _, prefix := range l.options.ExcludeRoutes {
+		if strings.HasPrefix(path, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// Middleware rejects requests over the limit with 429 Too Many Requests and a
+// Retry-After header in whole seconds
+func (l *RateLimiter) Middleware(next http.Handler) http.Handler {
+	scope := "global"
+	if l.options.PerClientIP {
+		scope = "client_ip"
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if l.excluded(r.URL.Path) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		allowed, wait := l.Allow(l.clientKey(r))
+		if !allowed {
+			rateLimitedRequests.WithLabelValues(scope).Inc()
+			w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+			http.Error(w, "Rate limit exceeded", http.StatusTooManyRequests)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,128 @@
+package security
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestRateLimiter(options RateLimitOptions) (*RateLimiter, *time.Time) {
+	l := NewRateLimiter(options)
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	l.now = func() time.Time { return now }
+	return l, &now
+}
+
+func TestRateLimiterAllow(t *testing.T) {
+	l, now := newTestRateLimiter(RateLimitOptions{RPS: 2, Burst: 3})
+
+	for i := 0; i < 3; i++ {
+		allowed, _ := l.Allow("")
+		assert.True(t, allowed, "request %d within burst", i)
+	}
+	allowed, wait := l.Allow("")
+	assert.False(t, allowed)
+	assert.Equal(t, 500*time.Millisecond, wait)
+
+	*now = now.Add(500 * time.Millisecond)
+	allowed, _ = l.Allow("")
+	assert.True(t, allowed)
+}
+
+func TestRateLimiterDefaultBurst(t *testing.T) {
+	assert.Equal(t, 3, NewRateLimiter(RateLimitOptions{RPS: 2.5}).options.Burst)
+}
+
+func TestRateLimiterSetLimit(t *testing.T) {
+	l, now := newTestRateLimiter(RateLimitOptions{RPS: 1, Burst: 1})
+	allowed, _ := l.Allow("")
+	assert.True(t, allowed)
+
+	l.SetLimit(10, 0)
+	rps, burst := l.Limit()
+	assert.Equal(t, 10.0, rps)
+	assert.Equal(t, 10, burst)
+
+	*now = now.Add(100 * time.Millisecond)
+	allowed, _ = l.Allow("")
+	assert.True(t, allowed, "the new rate refills the bucket")
+}
+
+func TestRateLimiterPerClientIP(t *testing.T) {
+	l, _ := newTestRateLimiter(RateLimitOptions{RPS: 1, Burst: 1, PerClientIP: true})
+
+	allowed, _ := l.Allow("10.0.0.1")
+	assert.True(t, allowed)
+	allowed, _ = l.Allow("10.0.0.1")
+	assert.False(t, allowed)
+	allowed, _ = l.Allow("10.0.0.2")
+	assert.True(t, allowed)
+}
+
+func TestRateLimiterCapsClients(t *testing.T) {
+	l, _ := newTestRateLimiter(RateLimitOptions{RPS: 1, Burst: 1, PerClientIP: true})
+	l.maxClients = 3
+
+	for _, key := range []string{"10.0.0.1", "10.0.0.2", "10.0.0.3"} {
+		allowed, _ := l.Allow(key)
+		assert.True(t, allowed)
+	}
+	// 10.0.0.1 is seen again, so 10.0.0.2 is now the least recently seen
+	allowed, _ := l.Allow("10.0.0.1")
+	assert.False(t, allowed)
+
+	for i := 0; i < 100; i++ {
+		l.Allow(fmt.Sprintf("192.168.0.%d", i))
+		assert.LessOrEqual(t, len(l.clients), 3)
+		assert.Equal(t, len(l.clients), l.recent.Len())
+	}
+	assert.NotContains(t, l.clients, "10.0.0.2")
+}
+
+func TestRateLimiterMiddleware(t *testing.T) {
+	l, _ := newTestRateLimiter(RateLimitOptions{RPS: 0.5, Burst: 1, PerClientIP: true, ExcludeRoutes: []string{"/health"}})
+	handler := l.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	serve := func(path, clientIP, forwardedFor string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		req.RemoteAddr = clientIP + ":40000"
+		if forwardedFor != "" {
+			req.Header.Set("X-Forwarded-For", forwardedFor)
+		}
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		return w
+	}
+
+	assert.Equal(t, http.StatusOK, serve("/api", "10.0.0.1", "").Code)
+
+	w := serve("/api", "10.0.0.1", "")
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+	assert.Equal(t, "2", w.Header().Get("Retry-After"))
+
+	assert.Equal(t, http.StatusTooManyRequests, serve("/api", "10.0.0.1", "203.0.113.9").Code, "a spoofed X-Forwarded-For does not reset the limit")
+	assert.Equal(t, http.StatusOK, serve("/api", "10.0.0.2", "").Code)
+	assert.Equal(t, http.StatusOK, serve("/health", "10.0.0.1", "").Code)
+}
+
+func TestRateLimiterTrustedHops(t *testing.T) {
+	l := NewRateLimiter(RateLimitOptions{RPS: 1, PerClientIP: true, TrustedHops: 1})
+
+	req := httptest.NewRequest(http.MethodGet, "/api", nil)
+	req.RemoteAddr = "127.0.0.6:40000"
+	assert.Equal(t, "127.0.0.6", l.clientKey(req), "requests without X-Forwarded-For are keyed on the peer")
+
+	req.Header.Set("X-Forwarded-For", "203.0.113.9, 10.0.0.1")
+	assert.Equal(t, "10.0.0.1", l.clientKey(req), "entries left of the trusted hops are ignored")
+
+	l.options.TrustedHops = 2
+	assert.Equal(t, "203.0.113.9", l.clientKey(req))
+	l.options.TrustedHops = 3
+	assert.Equal(t, "127.0.0.6", l.clientKey(req), "a chain shorter than the trusted hops falls back to the peer")
+}
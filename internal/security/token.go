@@ -0,0 +1,86 @@
+package security
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Token verification errors
+var (
+	ErrTokenInvalid = errors.New("invalid token")
+	ErrTokenExpired = errors.New("token expired")
+	ErrTokenScope   = errors.New("token not valid for this scope")
+)
+
+// ScopeAll grants access to every scope
+const ScopeAll = "*"
+
+// TokenSigner mints and verifies short-lived HMAC-SHA256 signed tokens. A
+// token carries its scope and expiry, so access can be granted temporarily
+// without distributing or rotating a shared secret.
+type TokenSigner struct {
+	secret []byte
+	now    func() time.Time
+}
+
+// NewTokenSigner creates a signer using secret; an empty secret is replaced by
+// a random one, so tokens are only valid on the process that minted them
+func NewTokenSigner(secret []byte) (*TokenSigner, error) {
+	if len(secret) == 0 {
+		secret = make([]byte, 32)
+		if _, err := rand.Read(secret); err != nil {
+			return nil, fmt.Errorf("failed to generate token secret: %w", err)
+		}
+	}
+	return &TokenSigner{secret: secret, now: time.Now}, nil
+}
+
+// signature returns the encoded signature of payload
+func (s *TokenSigner) signature(payload string) string {
+	mac := hmac.New(sha256.New, s.secret)
+	mac.Write([]byte(payload))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// Sign returns a token for scope that expires after ttl
+func (s *TokenSigner) Sign(scope string, ttl time.Duration) (string, time.Time) {
+	expiresAt := s.now().Add(ttl).Truncate(time.Second)
+	payload := base64.RawURLEncoding.EncodeToString([]byte(scope + "|" + strconv.FormatInt(expiresAt.Unix(), 10)))
+	return payload + "." + s.signature(payload), expiresAt
+}
+
+// Verify checks that token is authentic, unexpired and grants scope
+func (s *TokenSigner) Verify(token, scope string) error {
+	payload, signature, ok := strings.Cut(token, ".")
+	if !ok || !hmac.Equal([]byte(signature), []byte(s.signature(payload))) {
+		return ErrTokenInvalid
+	}
+
+	decoded, err := base64.RawURLEncoding.DecodeString(payload)
+	if err != nil {
+		return ErrTokenInvalid
+	}
+	tokenScope, expiry, ok := strings.Cut(string(decoded), "|")
+	if !ok {
+		return ErrTokenInvalid
+	}
+	expiresAt, err := strconv.ParseInt(expiry, 10, 64)
+	if err != nil {
+		return ErrTokenInvalid
+	}
+
+	if !s.now().Before(time.Unix(expiresAt, 0)) {
+		return ErrTokenExpired
+	}
+	if tokenScope != ScopeAll && tokenScope != scope {
+		return ErrTokenScope
+	}
+	return nil
+}
@@ -0,0 +1,58 @@
+package security
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTokenSigner(t *testing.T) {
+	signer, err := NewTokenSigner([]byte("secret"))
+	require.NoError(t, err)
+	now := time.Now()
+	signer.now = func() time.Time { return now }
+
+	token, expiresAt := signer.Sign("heap", time.Minute)
+	assert.Equal(t, now.Add(time.Minute).Truncate(time.Second), expiresAt)
+
+	assert.NoError(t, signer.Verify(token, "heap"))
+	assert.ErrorIs(t, signer.Verify(token, "profile"), ErrTokenScope)
+
+	wildcard, _ := signer.Sign(ScopeAll, time.Minute)
+	assert.NoError(t, signer.Verify(wildcard, "profile"))
+
+	now = now.Add(2 * time.Minute)
+	assert.ErrorIs(t, signer.Verify(token, "heap"), ErrTokenExpired)
+}
+
+func TestTokenSignerRejectsTampering(t *testing.T) {
+	signer, err := NewTokenSigner([]byte("secret"))
+	require.NoError(t, err)
+	token, _ := signer.Sign("heap", time.Minute)
+	payload, signature, _ := strings.Cut(token, ".")
+
+	other, err := NewTokenSigner([]byte("other"))
+	require.NoError(t, err)
+	forged, _ := other.Sign(ScopeAll, time.Hour)
+	forgedPayload, _, _ := strings.Cut(forged, ".")
+
+	assert.ErrorIs(t, signer.Verify("", "heap"), ErrTokenInvalid)
+	assert.ErrorIs(t, signer.Verify(payload, "heap"), ErrTokenInvalid)
+	assert.ErrorIs(t, signer.Verify(payload+".x"+signature, "heap"), ErrTokenInvalid)
+	assert.ErrorIs(t, signer.Verify(forgedPayload+"."+signature, "heap"), ErrTokenInvalid)
+	assert.ErrorIs(t, other.Verify(token, "heap"), ErrTokenInvalid)
+}
+
+func TestNewTokenSignerRandomSecret(t *testing.T) {
+	a, err := NewTokenSigner(nil)
+	require.NoError(t, err)
+	b, err := NewTokenSigner(nil)
+	require.NoError(t, err)
+
+	token, _ := a.Sign("heap", time.Minute)
+	assert.NoError(t, a.Verify(token, "heap"))
+	assert.ErrorIs(t, b.Verify(token, "heap"), ErrTokenInvalid)
+}
@@ -0,0 +1,173 @@
+// Package sse implements an endpoint streaming server-sent events.
+//
+// Istio idle timeouts, stream durations and the buffering of gateways are
+// only observable on responses that stay open and trickle data. The endpoint
+// sends a fixed number of events at a fixed interval, flushing each one, and
+// ends with a done event so that clients can tell a completed stream from one
+// cut by a proxy.
+package sse
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"istio-test/internal/observability"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Query parameters of the SSE endpoint
+const (
+	CountParam    = "count"    // Number of tick events, 10 by default
+	IntervalParam = "interval" // Delay between events, 1s by default
+)
+
+// Event types sent on the stream
+const (
+	EventTick = "tick" // Sent count times, interval apart
+	EventDone = "done" // Sent once after the last tick
+)
+
+// Defaults of the query parameters
+const (
+	DefaultCount    = 10
+	DefaultInterval = time.Second
+)
+
+// writeDeadlineSlack extends the write deadline past the expected end of a
+// stream, which would otherwise be cut by the server write timeout
+const writeDeadlineSlack = 10 * time.Second
+
+var sentEvents = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Namespace: "istio_test",
+	Name:      "sse_events_total",
+	Help:      "Total number of server-sent events written, by event type (tick, done).",
+}, []string{"event"})
+
+func init() {
+	observability.MetricsRegistry().MustRegister(sentEvents)
+}
+
+// Options configures the SSE handler
+type Options struct {
+	MaxCount    int           // Most tick events of a stream
+	MaxDuration time.Duration // Upper bound for the duration of a stream
+}
+
+// Tick is the data of a tick event
+type Tick struct {
+	Sequence int       `json:"sequence"` // 1-based, also the event ID
+	Count    int       `json:"count"`    // Tick events the stream sends in total
+	Time     time.Time `json:"time"`
+}
+
+// Done is the data of the done event
+type Done struct {
+	Sent     int    `json:"sent"`     // Tick events sent by this response
+	Duration string `json:"duration"` // Time since the stream started
+}
+
+// request is a validated SSE request
+type request struct {
+	count    int
+	interval time.Duration
+	start    int // Sequence of the first tick, after the Last-Event-ID of a reconnecting client
+}
+
+// parseRequest parses the query parameters and Last-Event-ID header
+func parseRequest(r *http.Request, options Options) (request, error) {
+	req := request{count: DefaultCount, interval: DefaultInterval, start: 1}
+
+	query := r.URL.Query()
+	if query.Has(CountParam) {
+		count, err := strconv.Atoi(query.Get(CountParam))
+		if err != nil || count < 1 || count > options.MaxCount {
+			return request{}, fmt.Errorf("%s must be a number of events between 1 and %d", CountParam, options.MaxCount)
+		}
+		req.count = count
+	}
+	if query.Has(IntervalParam) {
+		interval, err := time.ParseDuration(query.Get(IntervalParam))
+		if err != nil || interval < 0 {
+			return request{}, fmt.Errorf("%s must be a non-negative duration such as 1s", IntervalParam)
+		}
+		req.interval = interval
+	}
+	if total := time.Duration(req.count-1) * req.interval; total > options.MaxDuration {
+		return request{}, fmt.Errorf("%d events %v apart take %v, more than %v", req.count, req.interval, total, options.MaxDuration)
+	}
+
+	// EventSource resends the ID of the last event it received when it reconnects
+	if lastID := r.Header.Get("Last-Event-ID"); lastID != "" {
+		sequence, err := strconv.Atoi(lastID)
+		if err != nil || sequence < 0 {
+			return request{}, fmt.Errorf("Last-Event-ID must be the sequence of a previous event")
+		}
+		req.start = sequence + 1
+	}
+	return req, nil
+}
+
+// writeEvent writes one event and flushes it to the client
+func writeEvent(w http.ResponseWriter, controller *http.ResponseController, id, event string, data any) error {
+	payload, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+	if id != "" {
+		if _, err := fmt.Fprintf(w, "id: %s\n", id); err != nil {
+			return err
+		}
+	}
+	if _, err := fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event, payload); err != nil {
+		return err
+	}
+	sentEvents.WithLabelValues(event).Inc()
+	return controller.Flush()
+}
+
+// Handler streams count tick events, interval apart, followed by a done
+// event. A client reconnecting with Last-Event-ID resumes after that event.
+// The write deadline is extended to the expected end of the stream, so it is
+// not cut by the server write timeout.
+func Handler(options Options) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		req, err := parseRequest(r, options)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Invalid request: %v", err), http.StatusBadRequest)
+			return
+		}
+
+		start := time.Now()
+		controller := http.NewResponseController(w)
+		_ = controller.SetWriteDeadline(start.Add(time.Duration(req.count)*req.interval + writeDeadlineSlack))
+
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Header().Set("Cache-Control", "no-cache")
+		// Asks buffering proxies such as NGINX to pass events through as they are written
+		w.Header().Set("X-Accel-Buffering", "no")
+		w.WriteHeader(http.StatusOK)
+
+		sent := 0
+		for sequence := req.start; sequence <= req.count; sequence++ {
+			if sent > 0 && req.interval > 0 {
+				timer := time.NewTimer(req.interval)
+				select {
+				case <-r.Context().Done():
+					timer.Stop()
+					return
+				case <-timer.C:
+				}
+			}
+			tick := Tick{Sequence: sequence, Count: req.count, Time: time.Now().UTC()}
+			if err := writeEvent(w, controller, strconv.Itoa(sequence), EventTick, tick); err != nil {
+				return
+			}
+			sent++
+		}
+		_ = writeEvent(w, controller, "", EventDone, Done{Sent: sent, Duration: time.Since(start).String()})
+	}
+}
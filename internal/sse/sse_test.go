@@ -0,0 +1,125 @@
+package sse
+
+import (
+	"bufio"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var testOptions = Options{MaxCount: 100, MaxDuration: time.Second}
+
+func serve(target string, header http.Header) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodGet, target, nil)
+	for name, values := range header {
+		r.Header[name] = values
+	}
+	Handler(testOptions)(w, r)
+	return w
+}
+
+// event is a parsed server-sent event
+type event struct {
+	id, name, data string
+}
+
+// parseEvents splits an event stream into its events
+func parseEvents(t *testing.T, body string) []event {
+	t.Helper()
+	var events []event
+	for _, block := range strings.Split(strings.TrimSuffix(body, "\n\n"), "\n\n") {
+		var e event
+		for _, line := range strings.Split(block, "\n") {
+			field, value, ok := strings.Cut(line, ": ")
+			require.True(t, ok, line)
+			switch field {
+			case "id":
+				e.id = value
+			case "event":
+				e.name = value
+			case "data":
+				e.data = value
+			}
+		}
+		events = append(events, e)
+	}
+	return events
+}
+
+func TestHandler(t *testing.T) {
+	start := time.Now()
+	w := serve("/istio-test/stream/sse?count=3&interval=10ms", nil)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.GreaterOrEqual(t, time.Since(start), 20*time.Millisecond, "two intervals separate three events")
+	assert.Equal(t, "text/event-stream", w.Header().Get("Content-Type"))
+	assert.Equal(t, "no-cache", w.Header().Get("Cache-Control"))
+	assert.True(t, w.Flushed)
+
+	events := parseEvents(t, w.Body.String())
+	require.Len(t, events, 4)
+	for i, e := range events[:3] {
+		assert.Equal(t, EventTick, e.name)
+		var tick Tick
+		require.NoError(t, json.Unmarshal([]byte(e.data), &tick))
+		assert.Equal(t, i+1, tick.Sequence)
+		assert.Equal(t, 3, tick.Count)
+		assert.False(t, tick.Time.IsZero())
+	}
+	assert.Equal(t, []string{"1", "2", "3"}, []string{events[0].id, events[1].id, events[2].id})
+
+	assert.Equal(t, EventDone, events[3].name)
+	assert.Empty(t, events[3].id)
+	var done Done
+	require.NoError(t, json.Unmarshal([]byte(events[3].data), &done))
+	assert.Equal(t, 3, done.Sent)
+}
+
+func TestHandlerResumes(t *testing.T) {
+	w := serve("/istio-test/stream/sse?count=5&interval=0s", http.Header{"Last-Event-Id": {"3"}})
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+	events := parseEvents(t, w.Body.String())
+	require.Len(t, events, 3)
+	assert.Equal(t, "4", events[0].id)
+	assert.Equal(t, "5", events[1].id)
+	var done Done
+	require.NoError(t, json.Unmarshal([]byte(events[2].data), &done))
+	assert.Equal(t, 2, done.Sent)
+}
+
+func TestHandlerInvalid(t *testing.T) {
+	for _, target := range []string{
+		"/istio-test/stream/sse?count=0",
+		"/istio-test/stream/sse?count=ten",
+		"/istio-test/stream/sse?count=101",
+		"/istio-test/stream/sse?interval=soon",
+		"/istio-test/stream/sse?interval=-1s",
+		"/istio-test/stream/sse?count=20&interval=100ms",
+	} {
+		assert.Equal(t, http.StatusBadRequest, serve(target, nil).Code, target)
+	}
+	assert.Equal(t, http.StatusBadRequest, serve("/istio-test/stream/sse", http.Header{"Last-Event-Id": {"abc"}}).Code)
+}
+
+func TestHandlerFlushesEvents(t *testing.T) {
+	server := httptest.NewServer(Handler(testOptions))
+	defer server.Close()
+
+	response, err := http.Get(server.URL + "/istio-test/stream/sse?count=2&interval=500ms")
+	require.NoError(t, err)
+	defer response.Body.Close()
+
+	// The first event arrives before the interval elapsed
+	start := time.Now()
+	line, err := bufio.NewReader(response.Body).ReadString('\n')
+	require.NoError(t, err)
+	assert.Equal(t, "id: 1\n", line)
+	assert.Less(t, time.Since(start), 400*time.Millisecond)
+}
@@ -0,0 +1,288 @@
+// Package store keeps counters that endpoints aggregate across requests.
+//
+// By default counters live in memory and are therefore per replica. When a
+// Redis address is configured, counters are kept in Redis so every replica of
+// a deployment reports the same aggregate numbers. The Redis backend is health
+// checked in the background; while it is unreachable, counters fall back to
+// memory and return to Redis once it recovers.
+package store
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"istio-test/internal/observability"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/redis/go-redis/v9"
+)
+
+// Store is a set of named integer counters
+type Store interface {
+	// Incr adds delta to the counter and returns its new value. A positive
+	// ttl expires a counter ttl after it was created.
+	Incr(ctx context.Context, key string, delta int64, ttl time.Duration) (int64, error)
+	// Get returns the value of the counter, 0 when it does not exist
+	Get(ctx context.Context, key string) (int64, error)
+	// Ping reports whether the store is reachable
+	Ping(ctx context.Context) error
+	// Backend names the store, e.g. "memory" or "redis"
+	Backend() string
+}
+
+// Options configures the store returned by New
+type Options struct {
+	RedisAddr      string        // Redis host:port, empty keeps counters in memory
+	RedisPassword  string        // Redis AUTH password
+	RedisDB        int           // Redis database number
+	HealthInterval time.Duration // Interval between Redis health checks
+}
+
+var backendHealthy = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+	Namespace: "istio_test",
+	Name:      "store_backend_healthy",
+	Help:      "Whether the counter store backend is reachable (1) or counters fall back to memory (0).",
+}, []string{"backend"})
+
+func init() {
+	observability.MetricsRegistry().MustRegister(backendHealthy)
+}
+
+// New returns an in-memory store, or a Redis store with in-memory fallback
+// when options.RedisAddr is set. The returned function stops background health
+// checks and releases connections.
+func New(options Options) (Store, func() error) {
+	if options.RedisAddr == "" {
+		return NewMemory(), func() error { return nil }
+	}
+
+	client := redis.NewClient(&redis.Options{
+		Addr:     options.RedisAddr,
+		Password: options.RedisPassword,
+		DB:       options.RedisDB,
+	})
+	fallback := NewFallback(&Redis{client: client}, NewMemory())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go fallback.Run(ctx, options.HealthInterval)
+
+	return fallback, func() error {
+		cancel()
+		return client.Close()
+	}
+}
+
+// memoryCounter is a counter held in memory
+type memoryCounter struct {
+	value     int64
+	expiresAt time.Time // Zero when the counter does not expire
+}
+
+// Memory keeps counters in process memory
+type Memory struct {
+	mu       sync.Mutex
+	counters map[string]*memoryCounter
+	now      func() time.Time
+}
+
+// NewMemory creates an empty in-memory store
+func NewMemory() *Memory {
+	return &Memory{counters: make(map[string]*memoryCounter), now: time.Now}
+}
+
+// counter returns the live counter for key, dropping it when expired
+func (m *Memory) counter(key string) *memoryCounter {
+	c, ok := m.counters[key]
+	if ok && !c.expiresAt.IsZero() && !m.now().Before(c.expiresAt) {
+		delete(m.counters, key)
+		return nil
+	}
+	return c
+}
+
+// Incr adds delta to the counter
+func (m *Memory) Incr(ctx context.Context, key string, delta int64, ttl time.Duration) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	c := m.counter(key)
+	if c == nil {
+		c = &memoryCounter{}
+		if ttl > 0 {
+			c.expiresAt = m.now().Add(ttl)
+		}
+		m.counters[key] = c
+	}
+	c.value += delta
+	return c.value, nil
+}
+
+// Get returns the value of the counter
+func (m *Memory) Get(ctx context.Context, key string) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if c := m.counter(key); c != nil {
+		return c.value, nil
+	}
+	return 0, nil
+}
+
+// Ping always succeeds
+func (m *Memory) Ping(ctx context.Context) error {
+	return nil
+}
+
+// Backend returns "memory"
+func (m *Memory) Backend() string {
+	return "memory"
+}
+
+// redisKeyPrefix namespaces the keys written to a shared Redis
+const redisKeyPrefix = "istio-test:"
+
+// Redis keeps counters in Redis
+type Redis struct {
+	client *redis.Client
+}
+
+// incrScript increments a counter and sets its expiry in one atomic step, so
+// a counter never outlives a failure between the two. The expiry is only set
+// while the key has none (PTTL -1), which is EXPIRE NX without requiring
+// Redis 7.
+var incrScript = redis.NewScript(`
+local value = redis.call('INCRBY', KEYS[1], ARGV[1])
+if tonumber(ARGV[2]) > 0 and redis.call('PTTL', KEYS[1]) == -1 then
+	redis.call('PEXPIRE', KEYS[1], ARGV[2])
+end
+return value
+`)
+
+// Incr adds delta to the counter; the expiry is set when the counter is created
+func (r *Redis) Incr(ctx context.Context, key string, delta int64, ttl time.Duration) (int64, error) {
+	ttlMillis := int64(0)
+	if ttl > 0 {
+		ttlMillis = max(ttl.Milliseconds(), 1)
+	}
+	return incrScript.Run(ctx, r.client, []string{redisKeyPrefix + key}, delta, ttlMillis).Int64()
+}
+
+// Get returns the value of the counter
+func (r *Redis) Get(ctx context.Context, key string) (int64, error) {
+	value, err := r.client.Get(ctx, redisKeyPrefix+key).Int64()
+	if err == redis.Nil {
+		return 0, nil
+	}
+	return value, err
+}
+
+// Ping checks that Redis answers
+func (r *Redis) Ping(ctx context.Context) error {
+	return r.client.Ping(ctx).Err()
+}
+
+// Backend returns "redis"
+func (r *Redis) Backend() string {
+	return "redis"
+}
+
+// Fallback uses a primary store while it is healthy and a secondary store
+// otherwise. A failed operation marks the primary unhealthy until the next
+// successful health check.
+type Fallback struct {
+	primary   Store
+	secondary Store
+	healthy   atomic.Bool
+}
+
+// NewFallback creates a store that falls back from primary to secondary
+func NewFallback(primary, secondary Store) *Fallback {
+	f := &Fallback{primary: primary, secondary: secondary}
+	f.setHealthy(context.Background(), true, nil)
+	return f
+}
+
+// setHealthy records the health of the primary store, logging transitions
+func (f *Fallback) setHealthy(ctx context.Context, healthy bool, err error) {
+	if healthy {
+		backendHealthy.WithLabelValues(f.primary.Backend()).Set(1)
+	} else {
+		backendHealthy.WithLabelValues(f.primary.Backend()).Set(0)
+	}
+	if f.healthy.Swap(healthy) == healthy {
+		return
+	}
+	if healthy {
+		observability.InfoWithContext(ctx, fmt.Sprintf("Counter store %s recovered", f.primary.Backend()))
+	} else {
+		observability.WarnWithContext(ctx, fmt.Sprintf("Counter store %s unavailable, falling back to %s: %v", f.primary.Backend(), f.secondary.Backend(), err))
+	}
+}
+
+// active returns the store operations currently go to
+func (f *Fallback) active() Store {
+	if f.healthy.Load() {
+		return f.primary
+	}
+	return f.secondary
+}
+
+// Incr adds delta to the counter of the active store
+func (f *Fallback) Incr(ctx context.Context, key string, delta int64, ttl time.Duration) (int64, error) {
+	if f.healthy.Load() {
+		value, err := f.primary.Incr(ctx, key, delta, ttl)
+		if err == nil {
+			return value, nil
+		}
+		f.setHealthy(ctx, false, err)
+	}
+	return f.secondary.Incr(ctx, key, delta, ttl)
+}
+
+// Get returns the value of the counter from the active store
+func (f *Fallback) Get(ctx context.Context, key string) (int64, error) {
+	if f.healthy.Load() {
+		value, err := f.primary.Get(ctx, key)
+		if err == nil {
+			return value, nil
+		}
+		f.setHealthy(ctx, false, err)
+	}
+	return f.secondary.Get(ctx, key)
+}
+
+// Ping checks the primary store and updates its health
+func (f *Fallback) Ping(ctx context.Context) error {
+	err := f.primary.Ping(ctx)
+	f.setHealthy(ctx, err == nil, err)
+	return err
+}
+
+// Backend names the store operations currently go to
+func (f *Fallback) Backend() string {
+	return f.active().Backend()
+}
+
+// Run health checks the primary store every interval until ctx is done
+func (f *Fallback) Run(ctx context.Context, interval time.Duration) {
+	if interval <= 0 {
+		interval = 10 * time.Second
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		pingCtx, cancel := context.WithTimeout(ctx, interval)
+		_ = f.Ping(pingCtx)
+		cancel()
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,107 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// flakyStore is a primary store whose availability is controlled by the test
+type flakyStore struct {
+	*Memory
+	err error
+}
+
+func (f *flakyStore) Incr(ctx context.Context, key string, delta int64, ttl time.Duration) (int64, error) {
+	if f.err != nil {
+		return 0, f.err
+	}
+	return f.Memory.Incr(ctx, key, delta, ttl)
+}
+
+func (f *flakyStore) Get(ctx context.Context, key string) (int64, error) {
+	if f.err != nil {
+		return 0, f.err
+	}
+	return f.Memory.Get(ctx, key)
+}
+
+func (f *flakyStore) Ping(ctx context.Context) error {
+	return f.err
+}
+
+func (f *flakyStore) Backend() string {
+	return "flaky"
+}
+
+func TestMemory(t *testing.T) {
+	ctx := context.Background()
+	m := NewMemory()
+	now := time.Now()
+	m.now = func() time.Time { return now }
+
+	value, err := m.Incr(ctx, "requests", 2, time.Minute)
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), value)
+	value, err = m.Incr(ctx, "requests", 3, time.Minute)
+	require.NoError(t, err)
+	assert.Equal(t, int64(5), value)
+
+	value, err = m.Get(ctx, "missing")
+	require.NoError(t, err)
+	assert.Equal(t, int64(0), value)
+
+	// The expiry is set when the counter is created, not on every increment
+	now = now.Add(time.Minute)
+	value, err = m.Get(ctx, "requests")
+	require.NoError(t, err)
+	assert.Equal(t, int64(0), value)
+}
+
+func TestFallback(t *testing.T) {
+	ctx := context.Background()
+	primary := &flakyStore{Memory: NewMemory()}
+	f := NewFallback(primary, NewMemory())
+
+	_, err := f.Incr(ctx, "hits", 1, 0)
+	require.NoError(t, err)
+	assert.Equal(t, "flaky", f.Backend())
+
+	// Failures switch to the secondary store without surfacing errors
+	primary.err = errors.New("connection refused")
+	value, err := f.Incr(ctx, "hits", 1, 0)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), value)
+	assert.Equal(t, "memory", f.Backend())
+	assert.Equal(t, 0.0, testutil.ToFloat64(backendHealthy.WithLabelValues("flaky")))
+
+	// A successful health check returns to the primary store
+	primary.err = nil
+	require.NoError(t, f.Ping(ctx))
+	value, err = f.Get(ctx, "hits")
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), value)
+	assert.Equal(t, "flaky", f.Backend())
+	assert.Equal(t, 1.0, testutil.ToFloat64(backendHealthy.WithLabelValues("flaky")))
+}
+
+func TestNewWithoutRedis(t *testing.T) {
+	s, closeStore := New(Options{})
+	defer closeStore()
+	assert.Equal(t, "memory", s.Backend())
+}
+
+func TestNewWithUnreachableRedis(t *testing.T) {
+	s, closeStore := New(Options{RedisAddr: "127.0.0.1:1", HealthInterval: time.Hour})
+	defer closeStore()
+
+	value, err := s.Incr(context.Background(), "hits", 1, 0)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), value)
+	assert.Equal(t, "memory", s.Backend())
+}
@@ -0,0 +1,397 @@
+// Package streams keeps a registry of long-lived connections such as
+// WebSockets, server-sent events and other streaming responses.
+//
+// Envoy applies idle timeouts, stream durations and drain behavior to these
+// connections differently than to short requests. The registry shows how many
+// are open, how old they are, how many bytes they moved and who the client
+// is, and can force-close them, so that behavior can be observed and
+// provoked from a test.
+package streams
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"istio-test/internal/identity"
+	"istio-test/internal/observability"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Kinds of long-lived connections
+const (
+	KindWebSocket = "websocket" // Upgraded with Upgrade: websocket
+	KindSSE       = "sse"       // Requested with Accept: text/event-stream
+	KindStream    = "stream"    // Any other response tracked explicitly
+)
+
+// Reasons a stream ended
+const (
+	ReasonCompleted = "completed" // The handler returned
+	ReasonClosed    = "closed"    // Force-closed through the registry
+)
+
+// ErrClosed is returned by writes to a stream that was force-closed
+var ErrClosed = errors.New("stream closed by the registry")
+
+var (
+	activeStreams = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: "istio_test",
+		Name:      "streams_active",
+		Help:      "Number of open long-lived connections by kind (websocket, sse, stream).",
+	}, []string{"kind"})
+
+	endedStreams = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "istio_test",
+		Name:      "streams_ended_total",
+		Help:      "Total number of long-lived connections that ended, by kind and reason (completed, closed).",
+	}, []string{"kind", "reason"})
+)
+
+func init() {
+	observability.MetricsRegistry().MustRegister(activeStreams, endedStreams)
+}
+
+// Info describes an open stream
+type Info struct {
+	ID           uint64    `json:"id"`
+	Kind         string    `json:"kind"`
+	Method       string    `json:"method"`
+	Path         string    `json:"path"`
+	ClientIP     string    `json:"client_ip"`
+	Peer         string    `json:"peer,omitempty"` // SPIFFE ID of the mTLS client forwarded by the sidecar
+	StartedAt    time.Time `json:"started_at"`
+	Age          string    `json:"age"`
+	BytesRead    int64     `json:"bytes_read"`
+	BytesWritten int64     `json:"bytes_written"`
+}
+
+// Stream is a tracked long-lived connection
+type Stream struct {
+	id        uint64
+	kind      string
+	method    string
+	path      string
+	clientIP  string
+	peer      string
+	startedAt time.Time
+	cancel    context.CancelFunc
+
+	read    atomic.Int64
+	written atomic.Int64
+	closed  atomic.Bool
+
+	mu   sync.Mutex
+	conn net.Conn // Set once the connection is hijacked
+}
+
+// info returns the description of the stream at now
+func (s *Stream) info(now time.Time) Info {
+	return Info{
+		ID:           s.id,
+		Kind:         s.kind,
+		Method:       s.method,
+		Path:         s.path,
+		ClientIP:     s.clientIP,
+		Peer:         s.peer,
+		StartedAt:    s.startedAt.UTC(),
+		Age:          now.Sub(s.startedAt).Round(time.Millisecond).String(),
+		BytesRead:    s.read.Load(),
+		BytesWritten: s.written.Load(),
+	}
+}
+
+// close cancels the request context of the stream and closes its connection
+// if it was hijacked; later writes fail with ErrClosed
+func (s *Stream) close() {
+	s.closed.Store(true)
+	s.cancel()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.conn != nil {
+		_ = s.conn.Close()
+	}
+}
+
+// Registry tracks the open streams
+type Registry struct {
+	now    func() time.Time
+	nextID atomic.Uint64
+
+	mu      sync.Mutex
+	streams map[uint64]*Stream
+}
+
+// NewRegistry creates an empty registry
+func NewRegistry() *Registry {
+	return &Registry{now: time.Now, streams: make(map[uint64]*Stream)}
+}
+
+// Kind returns the kind of long-lived connection r asks for, or "" for a
+// regular request
+func Kind(r *http.Request) string {
+	if strings.EqualFold(r.Header.Get("Upgrade"), "websocket") {
+		return KindWebSocket
+	}
+	if strings.Contains(r.Header.Get("Accept"), "text/event-stream") {
+		return KindSSE
+	}
+	return ""
+}
+
+// Middleware tracks the requests handled by next that ask for a WebSocket
+// or an event stream until their handler returns
+func (reg *Registry) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		kind := Kind(r)
+		if kind == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		w, r, done := reg.Track(w, r, kind)
+		defer done()
+		next.ServeHTTP(w, r)
+	})
+}
+
+// Track registers the response to r as a stream of kind. The handler must
+// use the returned writer and request, whose context is canceled when the
+// stream is force-closed, and call done when it returns.
+func (reg *Registry) Track(w http.ResponseWriter, r *http.Request, kind string) (http.ResponseWriter, *http.Request, func()) {
+	ctx, cancel := context.WithCancel(r.Context())
+	stream := &Stream{
+		id:        reg.nextID.Add(1),
+		kind:      kind,
+		method:    r.Method,
+		path:      r.URL.Path,
+		clientIP:  observability.ClientIP(r),
+		startedAt: reg.now(),
+		cancel:    cancel,
+	}
+	if header := r.Header.Get(identity.Header); header != "" {
+		if chain, err := identity.Parse(header); err == nil {
+			stream.peer = chain[len(chain)-1].URI
+		}
+	}
+
+	reg.mu.Lock()
+	reg.streams[stream.id] = stream
+	reg.mu.Unlock()
+	activeStreams.WithLabelValues(kind).Inc()
+
+	r = r.WithContext(ctx)
+	if r.Body != nil && r.Body != http.NoBody {
+		r.Body = &countingBody{ReadCloser: r.Body, stream: stream}
+	}
+
+	done := func() {
+		reg.mu.Lock()
+		_, ok := reg.streams[stream.id]
+		delete(reg.streams, stream.id)
+		reg.mu.Unlock()
+		if !ok {
+			return
+		}
+		cancel()
+		activeStreams.WithLabelValues(kind).Dec()
+		reason := ReasonCompleted
+		if stream.closed.Load() {
+			reason = ReasonClosed
+		}
+		endedStreams.WithLabelValues(kind, reason).Inc()
+	}
+	return &trackedWriter{ResponseWriter: w, stream: stream}, r, done
+}
+
+// List returns the open streams, oldest first
+func (reg *Registry) List() []Info {
+	reg.mu.Lock()
+	defer reg.mu.Unlock()
+
+	now := reg.now()
+	infos := make([]Info, 0, len(reg.streams))
+	for _, stream := range reg.streams {
+		infos = append(infos, stream.info(now))
+	}
+	sort.Slice(infos, func(i, j int) bool { return infos[i].ID < infos[j].ID })
+	return infos
+}
+
+// Close force-closes the stream with id and reports whether it was open
+func (reg *Registry) Close(id uint64) bool {
+	reg.mu.Lock()
+	stream, ok := reg.streams[id]
+	reg.mu.Unlock()
+	if ok {
+		stream.close()
+	}
+	return ok
+}
+
+// CloseAll force-closes every open stream of kind, or of every kind when kind
+// is empty, and returns the number closed
+func (reg *Registry) CloseAll(kind string) int {
+	reg.mu.Lock()
+	var streams []*Stream
+	for _, stream := range reg.streams {
+		if kind == "" || stream.kind == kind {
+			streams = append(streams, stream)
+		}
+	}
+	reg.mu.Unlock()
+
+	for _, stream := range streams {
+		stream.close()
+	}
+	return len(streams)
+}
+
+// Response is returned by Handler
+type Response struct {
+	Count   int    `json:"count"`
+	Closed  int    `json:"closed,omitempty"` // Streams force-closed by a DELETE
+	Streams []Info `json:"streams"`
+}
+
+// Handler lists the open streams (GET) or force-closes them (DELETE) by ?id=,
+// by ?kind= or all of them with ?all=true
+func (reg *Registry) Handler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var response Response
+		if r.Method == http.MethodDelete {
+			query := r.URL.Query()
+			all, _ := strconv.ParseBool(query.Get("all"))
+			switch {
+			case query.Get("id") != "":
+				id, err := strconv.ParseUint(query.Get("id"), 10, 64)
+				if err != nil {
+					http.Error(w, "Invalid id parameter: must be a stream ID", http.StatusBadRequest)
+					return
+				}
+				if !reg.Close(id) {
+					http.Error(w, fmt.Sprintf("Stream %d is not open", id), http.StatusNotFound)
+					return
+				}
+				response.Closed = 1
+			case query.Get("kind") != "":
+				response.Closed = reg.CloseAll(query.Get("kind"))
+			case all:
+				response.Closed = reg.CloseAll("")
+			default:
+				http.Error(w, "Missing id, kind or all=true parameter", http.StatusBadRequest)
+				return
+			}
+			observability.InfoWithFields(r.Context(), fmt.Sprintf("Force-closed %d streams", response.Closed), map[string]any{
+				"type":   "streams_closed",
+				"closed": response.Closed,
+				"query":  r.URL.RawQuery,
+			})
+		}
+
+		response.Streams = reg.List()
+		response.Count = len(response.Streams)
+		jsonData, err := json.Marshal(response)
+		if err != nil {
+			observability.ErrorWithContext(r.Context(), fmt.Sprintf("Error encoding streams: %v", err))
+			http.Error(w, "Failed to encode streams", http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		_, _ = w.Write(jsonData)
+	}
+}
+
+// countingBody counts the request body bytes read by the handler
+type countingBody struct {
+	io.ReadCloser
+	stream *Stream
+}
+
+func (b *countingBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	b.stream.read.Add(int64(n))
+	return n, err
+}
+
+// trackedWriter counts the bytes written to a stream and fails writes once
+// it is force-closed
+type trackedWriter struct {
+	http.ResponseWriter
+	stream *Stream
+}
+
+func (w *trackedWriter) Write(p []byte) (int, error) {
+	if w.stream.closed.Load() {
+		return 0, ErrClosed
+	}
+	n, err := w.ResponseWriter.Write(p)
+	w.stream.written.Add(int64(n))
+	return n, err
+}
+
+// Flush implements http.Flusher, which event streams rely on
+func (w *trackedWriter) Flush() {
+	_ = http.NewResponseController(w.ResponseWriter).Flush()
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer
+func (w *trackedWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// Hijack implements http.Hijacker for WebSocket upgrades; the hijacked
+// connection keeps being counted and can be force-closed
+func (w *trackedWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	conn, brw, err := http.NewResponseController(w.ResponseWriter).Hijack()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	counted := &countingConn{Conn: conn, stream: w.stream}
+	w.stream.mu.Lock()
+	w.stream.conn = counted
+	w.stream.mu.Unlock()
+	if w.stream.closed.Load() {
+		_ = conn.Close()
+	}
+
+	// Keep the bytes the server already buffered, then read through the
+	// counting connection
+	_ = brw.Writer.Flush()
+	buffered, _ := brw.Reader.Peek(brw.Reader.Buffered())
+	reader := io.MultiReader(bytes.NewReader(bytes.Clone(buffered)), counted)
+	w.stream.read.Add(int64(len(buffered)))
+	return counted, bufio.NewReadWriter(bufio.NewReader(reader), bufio.NewWriter(counted)), nil
+}
+
+// countingConn counts the bytes moved over a hijacked connection
+type countingConn struct {
+	net.Conn
+	stream *Stream
+}
+
+func (c *countingConn) Read(p []byte) (int, error) {
+	n, err := c.Conn.Read(p)
+	c.stream.read.Add(int64(n))
+	return n, err
+}
+
+func (c *countingConn) Write(p []byte) (int, error) {
+	n, err := c.Conn.Write(p)
+	c.stream.written.Add(int64(n))
+	return n, err
+}
@@ -0,0 +1,147 @@
+package streams
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestKind(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	assert.Equal(t, "", Kind(req))
+
+	req.Header.Set("Accept", "text/event-stream")
+	assert.Equal(t, KindSSE, Kind(req))
+
+	req.Header.Set("Upgrade", "WebSocket")
+	assert.Equal(t, KindWebSocket, Kind(req))
+}
+
+// listStreams returns the response of a GET to the registry handler
+func listStreams(t *testing.T, reg *Registry) Response {
+	t.Helper()
+	w := httptest.NewRecorder()
+	reg.Handler()(w, httptest.NewRequest(http.MethodGet, "/admin/streams", nil))
+	require.Equal(t, http.StatusOK, w.Code)
+	var response Response
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	return response
+}
+
+func TestEventStreamTrackingAndClose(t *testing.T) {
+	reg := NewRegistry()
+	started := make(chan struct{})
+	ended := make(chan error, 1)
+	server := httptest.NewServer(reg.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		fmt.Fprint(w, "data: hello\n\n")
+		http.NewResponseController(w).Flush()
+		close(started)
+		<-r.Context().Done()
+		_, err := fmt.Fprint(w, "data: bye\n\n")
+		ended <- err
+	})))
+	defer server.Close()
+
+	req, err := http.NewRequest(http.MethodGet, server.URL+"/events", nil)
+	require.NoError(t, err)
+	req.Header.Set("Accept", "text/event-stream")
+	req.Header.Set("X-Forwarded-Client-Cert", `By=spiffe://cluster.local/ns/a/sa/b;URI=spiffe://cluster.local/ns/test/sa/client`)
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	<-started
+
+	response := listStreams(t, reg)
+	require.Equal(t, 1, response.Count)
+	stream := response.Streams[0]
+	assert.Equal(t, KindSSE, stream.Kind)
+	assert.Equal(t, "/events", stream.Path)
+	assert.Equal(t, "spiffe://cluster.local/ns/test/sa/client", stream.Peer)
+	assert.Equal(t, int64(len("data: hello\n\n")), stream.BytesWritten)
+
+	w := httptest.NewRecorder()
+	reg.Handler()(w, httptest.NewRequest(http.MethodDelete, fmt.Sprintf("/admin/streams?id=%d", stream.ID), nil))
+	require.Equal(t, http.StatusOK, w.Code)
+
+	select {
+	case err := <-ended:
+		assert.ErrorIs(t, err, ErrClosed)
+	case <-time.After(time.Second):
+		t.Fatal("handler did not see the stream close")
+	}
+	assert.Eventually(t, func() bool { return len(reg.List()) == 0 }, time.Second, 5*time.Millisecond)
+}
+
+func TestRegularRequestsAreNotTracked(t *testing.T) {
+	reg := NewRegistry()
+	var count int
+	handler := reg.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		count = len(reg.List())
+	}))
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+	assert.Equal(t, 0, count)
+}
+
+func TestHijackedConnection(t *testing.T) {
+	reg := NewRegistry()
+	upgraded := make(chan struct{})
+	server := httptest.NewServer(reg.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, brw, err := http.NewResponseController(w).Hijack()
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		defer conn.Close()
+		brw.WriteString("HTTP/1.1 101 Switching Protocols\r\nUpgrade: websocket\r\nConnection: Upgrade\r\n\r\n")
+		brw.Flush()
+		close(upgraded)
+		// Echo until the connection is closed
+		_, _ = io.Copy(conn, brw)
+	})))
+	defer server.Close()
+
+	conn, err := net.Dial("tcp", server.Listener.Addr().String())
+	require.NoError(t, err)
+	defer conn.Close()
+	fmt.Fprint(conn, "GET /ws HTTP/1.1\r\nHost: test\r\nUpgrade: websocket\r\nConnection: Upgrade\r\n\r\n")
+	reader := bufio.NewReader(conn)
+	status, err := reader.ReadString('\n')
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(status, "HTTP/1.1 101"))
+	<-upgraded
+
+	fmt.Fprint(conn, "ping")
+	assert.Eventually(t, func() bool {
+		streams := reg.List()
+		return len(streams) == 1 && streams[0].BytesRead >= 4 && streams[0].BytesWritten >= 8
+	}, time.Second, 5*time.Millisecond)
+	assert.Equal(t, KindWebSocket, reg.List()[0].Kind)
+
+	assert.Equal(t, 1, reg.CloseAll(KindWebSocket))
+	assert.Eventually(t, func() bool { return len(reg.List()) == 0 }, time.Second, 5*time.Millisecond)
+}
+
+func TestHandlerDeleteValidation(t *testing.T) {
+	reg := NewRegistry()
+	for target, status := range map[string]int{
+		"/admin/streams":          http.StatusBadRequest,
+		"/admin/streams?id=x":     http.StatusBadRequest,
+		"/admin/streams?id=7":     http.StatusNotFound,
+		"/admin/streams?all=true": http.StatusOK,
+	} {
+		w := httptest.NewRecorder()
+		reg.Handler()(w, httptest.NewRequest(http.MethodDelete, target, nil))
+		assert.Equal(t, status, w.Code, target)
+	}
+}
@@ -0,0 +1,288 @@
+// Package support assembles support bundles: a single gzip tarball holding
+// everything needed to debug a misbehaving pod during a mesh experiment, so
+// one download replaces a round of calls to the individual admin endpoints.
+//
+// A bundle is a list of named sources collected concurrently when the bundle
+// is requested. A source that fails or times out is recorded in the manifest
+// instead of failing the bundle, since the pod being debugged is often the
+// one whose dependencies are broken.
+package support
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"runtime"
+	"runtime/pprof"
+	"sync"
+	"time"
+
+	"istio-test/internal/gctune"
+	"istio-test/internal/observability"
+	"istio-test/internal/version"
+)
+
+// DefaultSourceTimeout bounds the collection of a single source
+const DefaultSourceTimeout = 10 * time.Second
+
+// ManifestFile is the name of the manifest in every bundle
+const ManifestFile = "manifest.json"
+
+// Collector returns the content of a bundle file
+type Collector func(ctx context.Context) ([]byte, error)
+
+// JSON returns a collector encoding the value returned by collect as
+// indented JSON
+func JSON[T any](collect func(ctx context.Context) (T, error)) Collector {
+	return func(ctx context.Context) ([]byte, error) {
+		value, err := collect(ctx)
+		if err != nil {
+			return nil, err
+		}
+		return json.MarshalIndent(value, "", "  ")
+	}
+}
+
+// Value returns a collector encoding the value returned by value as indented
+// JSON, for sources that cannot fail
+func Value[T any](value func() T) Collector {
+	return JSON(func(ctx context.Context) (T, error) { return value(), nil })
+}
+
+// source is a file of the bundle
+type source struct {
+	name    string
+	collect Collector
+}
+
+// FileStatus describes a file of a bundle in its manifest
+type FileStatus struct {
+	Name       string  `json:"name"`
+	Size       int     `json:"size"`
+	DurationMs float64 `json:"duration_ms"`
+	Error      string  `json:"error,omitempty"` // Set when the source failed; the file is then left out
+}
+
+// Manifest is the first file of every bundle
+type Manifest struct {
+	CreatedAt time.Time    `json:"created_at"`
+	Hostname  string       `json:"hostname"`
+	Build     version.Info `json:"build"`
+	Files     []FileStatus `json:"files"`
+}
+
+// Bundle is the list of sources a support bundle is assembled from
+type Bundle struct {
+	timeout time.Duration
+	now     func() time.Time
+
+	mu      sync.RWMutex
+	sources []source
+}
+
+// NewBundle creates a bundle without sources whose sources each get timeout
+// to collect; zero uses DefaultSourceTimeout
+func NewBundle(timeout time.Duration) *Bundle {
+	if timeout <= 0 {
+		timeout = DefaultSourceTimeout
+	}
+	return &Bundle{timeout: timeout, now: time.Now}
+}
+
+// Add adds the file name collected by collect. Like http.ServeMux, it panics
+// when a file of the same name was already added.
+func (b *Bundle) Add(name string, collect Collector) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if name == ManifestFile {
+		panic(fmt.Sprintf("support bundle file %q is reserved", name))
+	}
+	for _, s := range b.sources {
+		if s.name == name {
+			panic(fmt.Sprintf("support bundle file %q added twice", name))
+		}
+	}
+	b.sources = append(b.sources, source{name: name, collect: collect})
+}
+
+// collected is the outcome of collecting one source
+type collected struct {
+	data   []byte
+	status FileStatus
+}
+
+// collect runs every source concurrently, each within the timeout, and
+// returns the outcomes in the order the sources were added
+func (b *Bundle) collect(ctx context.Context) []collected {
+	b.mu.RLock()
+	sources := append([]source(nil), b.sources...)
+	b.mu.RUnlock()
+
+	results := make([]collected, len(sources))
+	var wg sync.WaitGroup
+	for i, s := range sources {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			sourceCtx, cancel := context.WithTimeout(ctx, b.timeout)
+			defer cancel()
+
+			start := time.Now()
+			data, err := s.collect(sourceCtx)
+			status := FileStatus{Name: s.name, DurationMs: observability.Milliseconds(time.Since(start))}
+			if err != nil {
+				status.Error = err.Error()
+				data = nil
+			}
+			status.Size = len(data)
+			results[i] = collected{data: data, status: status}
+		}()
+	}
+	wg.Wait()
+	return results
+}
+
+// Write collects the sources and writes the bundle to w as a gzip tarball
+// with the manifest first, and returns the manifest
+func (b *Bundle) Write(ctx context.Context, w io.Writer) (Manifest, error) {
+	results := b.collect(ctx)
+
+	hostname, _ := os.Hostname()
+	manifest := Manifest{
+		CreatedAt: b.now().UTC(),
+		Hostname:  hostname,
+		Build:     version.Get(),
+		Files:     make([]FileStatus, len(results)),
+	}
+	for i, result := range results {
+		manifest.Files[i] = result.status
+	}
+	manifestData, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return manifest, fmt.Errorf("error encoding manifest: %w", err)
+	}
+
+	gz := gzip.NewWriter(w)
+	tw := tar.NewWriter(gz)
+	if err := writeFile(tw, ManifestFile, manifestData, manifest.CreatedAt); err != nil {
+		return manifest, err
+	}
+	for _, result := range results {
+		if result.status.Error != "" {
+			continue
+		}
+		if err := writeFile(tw, result.status.Name, result.data, manifest.CreatedAt); err != nil {
+			return manifest, err
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return manifest, fmt.Errorf("error closing tarball: %w", err)
+	}
+	if err := gz.Close(); err != nil {
+		return manifest, fmt.Errorf("error closing gzip stream: %w", err)
+	}
+	return manifest, nil
+}
+
+// writeFile adds a regular file to the tarball
+func writeFile(tw *tar.Writer, name string, data []byte, modTime time.Time) error {
+	header := &tar.Header{
+		Typeflag: tar.TypeReg,
+		Name:     name,
+		Size:     int64(len(data)),
+		Mode:     0o644,
+		ModTime:  modTime,
+	}
+	if err := tw.WriteHeader(header); err != nil {
+		return fmt.Errorf("error writing %s header: %w", name, err)
+	}
+	if _, err := tw.Write(data); err != nil {
+		return fmt.Errorf("error writing %s: %w", name, err)
+	}
+	return nil
+}
+
+// Handler serves the bundle as a gzip tarball download. The bundle is
+// assembled in memory first so a failure is still reported as an error.
+func (b *Bundle) Handler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var buf bytes.Buffer
+		manifest, err := b.Write(r.Context(), &buf)
+		if err != nil {
+			observability.ErrorWithContext(r.Context(), fmt.Sprintf("Error assembling support bundle: %v", err))
+			http.Error(w, "Failed to assemble support bundle", http.StatusInternalServerError)
+			return
+		}
+
+		var failed []string
+		for _, file := range manifest.Files {
+			if file.Error != "" {
+				failed = append(failed, file.Name)
+			}
+		}
+		observability.InfoWithFields(r.Context(), fmt.Sprintf("Assembled support bundle of %d bytes", buf.Len()), map[string]any{
+			"type":   "support_bundle",
+			"bytes":  buf.Len(),
+			"files":  len(manifest.Files),
+			"failed": failed,
+		})
+
+		filename := fmt.Sprintf("support-%s-%s.tar.gz", manifest.Hostname, manifest.CreatedAt.Format("20060102T150405Z"))
+		w.Header().Set("Content-Type", "application/gzip")
+		w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+		w.Header().Set("Content-Length", fmt.Sprint(buf.Len()))
+		w.WriteHeader(http.StatusOK)
+		_, _ = w.Write(buf.Bytes())
+	}
+}
+
+// GoroutineDump collects the stacks of every goroutine, as the pprof
+// goroutine endpoint with debug=2 returns them
+func GoroutineDump(ctx context.Context) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := pprof.Lookup("goroutine").WriteTo(&buf, 2); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// RuntimeStats describes the Go runtime of the process
+type RuntimeStats struct {
+	gctune.Status
+	NumCPU        int     `json:"num_cpu"`
+	HeapSysBytes  uint64  `json:"heap_sys_bytes"`
+	HeapObjects   uint64  `json:"heap_objects"`
+	StackInUse    uint64  `json:"stack_in_use_bytes"`
+	TotalAlloc    uint64  `json:"total_alloc_bytes"`
+	PauseTotalNs  uint64  `json:"gc_pause_total_ns"`
+	LastGC        string  `json:"last_gc,omitempty"`
+	NumForcedGC   uint32  `json:"num_forced_gc"`
+	GCCPUFraction float64 `json:"gc_cpu_fraction"`
+}
+
+// CurrentRuntimeStats reads the runtime statistics of the process
+func CurrentRuntimeStats() RuntimeStats {
+	var memStats runtime.MemStats
+	runtime.ReadMemStats(&memStats)
+	stats := RuntimeStats{
+		Status:        gctune.Current(),
+		NumCPU:        runtime.NumCPU(),
+		HeapSysBytes:  memStats.HeapSys,
+		HeapObjects:   memStats.HeapObjects,
+		StackInUse:    memStats.StackInuse,
+		TotalAlloc:    memStats.TotalAlloc,
+		PauseTotalNs:  memStats.PauseTotalNs,
+		NumForcedGC:   memStats.NumForcedGC,
+		GCCPUFraction: memStats.GCCPUFraction,
+	}
+	if memStats.LastGC > 0 {
+		stats.LastGC = time.Unix(0, int64(memStats.LastGC)).UTC().Format(time.RFC3339Nano)
+	}
+	return stats
+}
@@ -0,0 +1,97 @@
+package support
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// readBundle returns the files of a bundle by name, in archive order
+func readBundle(t *testing.T, data []byte) ([]string, map[string][]byte) {
+	t.Helper()
+	gz, err := gzip.NewReader(bytes.NewReader(data))
+	require.NoError(t, err)
+	tr := tar.NewReader(gz)
+
+	var names []string
+	files := make(map[string][]byte)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		require.NoError(t, err)
+		content, err := io.ReadAll(tr)
+		require.NoError(t, err)
+		names = append(names, header.Name)
+		files[header.Name] = content
+	}
+	return names, files
+}
+
+func TestBundleWrite(t *testing.T) {
+	bundle := NewBundle(50 * time.Millisecond)
+	bundle.Add("config.json", Value(func() map[string]string { return map[string]string{"port": "8080"} }))
+	bundle.Add("broken.json", JSON(func(ctx context.Context) (any, error) { return nil, errors.New("metadata server unreachable") }))
+	bundle.Add("slow.txt", func(ctx context.Context) ([]byte, error) {
+		<-ctx.Done()
+		return nil, ctx.Err()
+	})
+	bundle.Add("goroutines.txt", GoroutineDump)
+
+	var buf bytes.Buffer
+	manifest, err := bundle.Write(context.Background(), &buf)
+	require.NoError(t, err)
+
+	names, files := readBundle(t, buf.Bytes())
+	assert.Equal(t, []string{ManifestFile, "config.json", "goroutines.txt"}, names, "failed sources are left out")
+	assert.JSONEq(t, `{"port": "8080"}`, string(files["config.json"]))
+	assert.Contains(t, string(files["goroutines.txt"]), "goroutine ")
+
+	var written Manifest
+	require.NoError(t, json.Unmarshal(files[ManifestFile], &written))
+	assert.Equal(t, manifest.Files, written.Files)
+	require.Len(t, written.Files, 4)
+	assert.Equal(t, "config.json", written.Files[0].Name)
+	assert.Equal(t, len(files["config.json"]), written.Files[0].Size)
+	assert.Equal(t, "metadata server unreachable", written.Files[1].Error)
+	assert.Contains(t, written.Files[2].Error, "deadline exceeded")
+	assert.NotEmpty(t, written.Build.Version)
+}
+
+func TestBundleAddPanics(t *testing.T) {
+	bundle := NewBundle(0)
+	bundle.Add("config.json", GoroutineDump)
+	assert.Panics(t, func() { bundle.Add("config.json", GoroutineDump) })
+	assert.Panics(t, func() { bundle.Add(ManifestFile, GoroutineDump) })
+}
+
+func TestHandler(t *testing.T) {
+	bundle := NewBundle(0)
+	bundle.Add("runtime.json", Value(CurrentRuntimeStats))
+
+	w := httptest.NewRecorder()
+	bundle.Handler()(w, httptest.NewRequest(http.MethodGet, "/admin/support-bundle", nil))
+
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "application/gzip", w.Header().Get("Content-Type"))
+	assert.True(t, strings.HasPrefix(w.Header().Get("Content-Disposition"), `attachment; filename="support-`))
+
+	_, files := readBundle(t, w.Body.Bytes())
+	var stats RuntimeStats
+	require.NoError(t, json.Unmarshal(files["runtime.json"], &stats))
+	assert.Positive(t, stats.NumCPU)
+	assert.Positive(t, stats.Goroutines)
+}
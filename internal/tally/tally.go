@@ -0,0 +1,226 @@
+// Package tally implements endpoints that count requests across replicas.
+//
+// Counts are kept in a store.Store, so with a shared Redis backend every
+// replica of a deployment reports the same aggregate numbers:
+//   - dedupe counts deliveries of a request ID, to spot retried or mirrored duplicates
+//   - quota admits a fixed number of requests per key and window
+//   - distribution counts the requests each pod served for a key next to the total
+package tally
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"istio-test/internal/observability"
+	"istio-test/internal/store"
+)
+
+const (
+	// WindowParam sets how long counts are kept
+	WindowParam = "window"
+	// LimitParam sets the number of requests a quota admits per window
+	LimitParam = "limit"
+
+	defaultDedupeWindow       = 5 * time.Minute
+	defaultQuotaWindow        = time.Minute
+	defaultDistributionWindow = time.Hour
+	defaultQuotaLimit         = 10
+	maxWindow                 = 24 * time.Hour
+	maxQuotaLimit             = 1000000
+)
+
+// validKey restricts keys to characters that are safe in store keys
+var validKey = regexp.MustCompile(`^[A-Za-z0-9._-]{1,128}$`)
+
+// now returns the current time; replaced in tests
+var now = time.Now
+
+// DedupeResponse reports how often a request ID was delivered
+type DedupeResponse struct {
+	ID        string `json:"id"`
+	Count     int64  `json:"count"`     // Deliveries within the window, including this one
+	Duplicate bool   `json:"duplicate"` // Whether the ID was delivered before
+	Backend   string `json:"backend"`   // Store the count was kept in
+}
+
+// QuotaResponse reports the use of a quota window
+type QuotaResponse struct {
+	Key       string `json:"key"`
+	Limit     int64  `json:"limit"`
+	Used      int64  `json:"used"` // Requests within the window, including this one
+	Remaining int64  `json:"remaining"`
+	ResetIn   string `json:"reset_in"` // Time until the window ends
+	Backend   string `json:"backend"`
+}
+
+// DistributionResponse reports the share of requests this pod served
+type DistributionResponse struct {
+	Key     string  `json:"key"`
+	Pod     string  `json:"pod"`
+	Served  int64   `json:"served"` // Requests served by this pod
+	Total   int64   `json:"total"`  // Requests served by all pods
+	Share   float64 `json:"share"`  // Served divided by total
+	Backend string  `json:"backend"`
+}
+
+// parseKey returns the key in the last path segment
+func parseKey(r *http.Request, prefix string) (string, error) {
+	key := strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, prefix), "/")
+	if !validKey.MatchString(key) {
+		return "", fmt.Errorf("key must be 1 to 128 letters, digits, '.', '_' or '-'")
+	}
+	return key, nil
+}
+
+// parseWindow returns the window query parameter, or fallback when unset
+func parseWindow(r *http.Request, fallback time.Duration) (time.Duration, error) {
+	value := r.URL.Query().Get(WindowParam)
+	if value == "" {
+		return fallback, nil
+	}
+	window, err := time.ParseDuration(value)
+	if err != nil || window < time.Second || window > maxWindow {
+		return 0, fmt.Errorf("%s must be a duration between 1s and %v", WindowParam, maxWindow)
+	}
+	return window, nil
+}
+
+// DedupeHandler counts deliveries of the request ID in the path within a
+// window, so duplicates caused by retries or mirroring are visible even when
+// they land on different replicas
+func DedupeHandler(prefix string, counters store.Store) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, err := parseKey(r, prefix)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		window, err := parseWindow(r, defaultDedupeWindow)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		count, err := counters.Incr(r.Context(), "dedupe:"+id, 1, window)
+		if err != nil {
+			storeError(w, r, err)
+			return
+		}
+		writeJSON(w, r, http.StatusOK, DedupeResponse{ID: id, Count: count, Duplicate: count > 1, Backend: counters.Backend()})
+	}
+}
+
+// QuotaHandler admits limit requests per key in fixed windows and answers
+// 429 with Retry-After once the window's quota is used up
+func QuotaHandler(prefix string, counters store.Store) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		key, err := parseKey(r, prefix)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		window, err := parseWindow(r, defaultQuotaWindow)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		limit := int64(defaultQuotaLimit)
+		if value := r.URL.Query().Get(LimitParam); value != "" {
+			limit, err = strconv.ParseInt(value, 10, 64)
+			if err != nil || limit < 1 || limit > maxQuotaLimit {
+				http.Error(w, fmt.Sprintf("%s must be a number between 1 and %d", LimitParam, maxQuotaLimit), http.StatusBadRequest)
+				return
+			}
+		}
+
+		// Windows are aligned to the epoch so every replica agrees on them
+		start := now().Truncate(window)
+		resetIn := start.Add(window).Sub(now())
+		used, err := counters.Incr(r.Context(), fmt.Sprintf("quota:%s:%d:%d", key, window.Milliseconds(), start.Unix()), 1, window)
+		if err != nil {
+			storeError(w, r, err)
+			return
+		}
+
+		response := QuotaResponse{
+			Key:       key,
+			Limit:     limit,
+			Used:      used,
+			Remaining: max(limit-used, 0),
+			ResetIn:   resetIn.Round(time.Millisecond).String(),
+			Backend:   counters.Backend(),
+		}
+		status := http.StatusOK
+		if used > limit {
+			w.Header().Set("Retry-After", strconv.Itoa(int((resetIn+time.Second-1)/time.Second)))
+			status = http.StatusTooManyRequests
+		}
+		writeJSON(w, r, status, response)
+	}
+}
+
+// DistributionHandler counts the requests for the key in the path that this
+// pod served next to the total over all pods, to check load balancing weights
+func DistributionHandler(prefix string, counters store.Store) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		key, err := parseKey(r, prefix)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		window, err := parseWindow(r, defaultDistributionWindow)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		pod, _ := os.Hostname()
+		served, err := counters.Incr(r.Context(), "distribution:"+key+":pod:"+pod, 1, window)
+		if err != nil {
+			storeError(w, r, err)
+			return
+		}
+		total, err := counters.Incr(r.Context(), "distribution:"+key, 1, window)
+		if err != nil {
+			storeError(w, r, err)
+			return
+		}
+
+		writeJSON(w, r, http.StatusOK, DistributionResponse{
+			Key:     key,
+			Pod:     pod,
+			Served:  served,
+			Total:   total,
+			Share:   float64(served) / float64(max(total, 1)),
+			Backend: counters.Backend(),
+		})
+	}
+}
+
+// storeError answers 503 when the store fails
+func storeError(w http.ResponseWriter, r *http.Request, err error) {
+	observability.ErrorWithContext(r.Context(), fmt.Sprintf("Counter store error: %v", err))
+	http.Error(w, "Counter store unavailable", http.StatusServiceUnavailable)
+}
+
+// writeJSON writes response as JSON with status
+func writeJSON(w http.ResponseWriter, r *http.Request, status int, response any) {
+	jsonData, err := json.Marshal(response)
+	if err != nil {
+		observability.ErrorWithContext(r.Context(), fmt.Sprintf("Error encoding tally response: %v", err))
+		http.Error(w, "Failed to encode tally response", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	// Counts change on every request
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	_, _ = w.Write(jsonData)
+}
@@ -0,0 +1,96 @@
+package tally
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"istio-test/internal/store"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func call(t *testing.T, handler http.HandlerFunc, target string, response any) *httptest.ResponseRecorder {
+	t.Helper()
+	w := httptest.NewRecorder()
+	handler(w, httptest.NewRequest(http.MethodGet, target, nil))
+	if response != nil && w.Code < http.StatusBadRequest {
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), response))
+	}
+	return w
+}
+
+func TestDedupeHandler(t *testing.T) {
+	handler := DedupeHandler("/istio-test/dedupe/", store.NewMemory())
+
+	var response DedupeResponse
+	w := call(t, handler, "/istio-test/dedupe/req-1", &response)
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, DedupeResponse{ID: "req-1", Count: 1, Backend: "memory"}, response)
+
+	call(t, handler, "/istio-test/dedupe/req-1", &response)
+	assert.Equal(t, int64(2), response.Count)
+	assert.True(t, response.Duplicate)
+
+	call(t, handler, "/istio-test/dedupe/req-2", &response)
+	assert.False(t, response.Duplicate)
+
+	assert.Equal(t, http.StatusBadRequest, call(t, handler, "/istio-test/dedupe/a:b", nil).Code)
+	assert.Equal(t, http.StatusBadRequest, call(t, handler, "/istio-test/dedupe/", nil).Code)
+	assert.Equal(t, http.StatusBadRequest, call(t, handler, "/istio-test/dedupe/req-1?window=48h", nil).Code)
+}
+
+func TestQuotaHandler(t *testing.T) {
+	original := now
+	t.Cleanup(func() { now = original })
+	current := time.Date(2025, 1, 1, 12, 0, 20, 0, time.UTC)
+	now = func() time.Time { return current }
+
+	handler := QuotaHandler("/istio-test/quota/", store.NewMemory())
+
+	var response QuotaResponse
+	for i := 1; i <= 2; i++ {
+		w := call(t, handler, "/istio-test/quota/tenant-a?limit=2&window=1m", &response)
+		require.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, int64(i), response.Used)
+		assert.Equal(t, int64(2-i), response.Remaining)
+	}
+
+	w := call(t, handler, "/istio-test/quota/tenant-a?limit=2&window=1m", &response)
+	require.Equal(t, http.StatusTooManyRequests, w.Code)
+	assert.Equal(t, "40", w.Header().Get("Retry-After"))
+	assert.Equal(t, int64(0), response.Remaining)
+	assert.Equal(t, "40s", response.ResetIn)
+
+	// Keys and windows are counted separately
+	assert.Equal(t, http.StatusOK, call(t, handler, "/istio-test/quota/tenant-b?limit=2&window=1m", nil).Code)
+	assert.Equal(t, http.StatusOK, call(t, handler, "/istio-test/quota/tenant-a?limit=2&window=1h", nil).Code)
+
+	// The next window starts over
+	current = current.Add(time.Minute)
+	assert.Equal(t, http.StatusOK, call(t, handler, "/istio-test/quota/tenant-a?limit=2&window=1m", nil).Code)
+
+	assert.Equal(t, http.StatusBadRequest, call(t, handler, "/istio-test/quota/tenant-a?limit=0", nil).Code)
+	assert.Equal(t, http.StatusBadRequest, call(t, handler, "/istio-test/quota/tenant-a?window=10ms", nil).Code)
+}
+
+func TestDistributionHandler(t *testing.T) {
+	counters := store.NewMemory()
+	handler := DistributionHandler("/istio-test/distribution/", counters)
+
+	// Requests served by another replica sharing the store
+	_, err := counters.Incr(t.Context(), "distribution:canary", 3, time.Hour)
+	require.NoError(t, err)
+
+	var response DistributionResponse
+	w := call(t, handler, "/istio-test/distribution/canary", &response)
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "no-store", w.Header().Get("Cache-Control"))
+	assert.NotEmpty(t, response.Pod)
+	assert.Equal(t, int64(1), response.Served)
+	assert.Equal(t, int64(4), response.Total)
+	assert.Equal(t, 0.25, response.Share)
+}
@@ -0,0 +1,212 @@
+// Package tcpecho serves a raw TCP echo listener alongside the HTTP server, so
+// Istio TCP routing, opaque ports and mTLS between sidecars can be exercised
+// with traffic the mesh cannot parse as HTTP.
+//
+// Every byte read from a connection is written back unchanged. Connections are
+// logged when they open and close, with the peer as seen after the sidecar and
+// the bytes echoed, so a test can tell which client reached which pod.
+package tcpecho
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"time"
+
+	"istio-test/internal/observability"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// DefaultIdleTimeout closes connections that send nothing for this long
+const DefaultIdleTimeout = 5 * time.Minute
+
+// Bounds of the backoff between retries of temporary accept errors
+const (
+	minAcceptRetryDelay = 5 * time.Millisecond
+	maxAcceptRetryDelay = time.Second
+)
+
+var (
+	tcpConnections = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: "istio_test",
+		Name:      "tcp_echo_connections_total",
+		Help:      "Total number of connections accepted by the TCP echo listener.",
+	})
+
+	tcpConnectionsOpen = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: "istio_test",
+		Name:      "tcp_echo_connections_open",
+		Help:      "Number of connections currently open on the TCP echo listener.",
+	})
+
+	tcpEchoedBytes = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: "istio_test",
+		Name:      "tcp_echo_bytes_total",
+		Help:      "Total number of bytes echoed by the TCP echo listener.",
+	})
+)
+
+func init() {
+	observability.MetricsRegistry().MustRegister(tcpConnections, tcpConnectionsOpen, tcpEchoedBytes)
+}
+
+// Options configures the echo server
+type Options struct {
+	IdleTimeout time.Duration // Closes connections idle for this long, defaults to DefaultIdleTimeout
+}
+
+// Server echoes the bytes of every connection back to its peer
+type Server struct {
+	options Options
+
+	mu       sync.Mutex
+	listener net.Listener
+	conns    map[net.Conn]struct{}
+	closed   bool
+	wg       sync.WaitGroup
+}
+
+// New creates an echo server; call Serve to start accepting connections
+func New(options Options) *Server {
+	if options.IdleTimeout <= 0 {
+		options.IdleTimeout = DefaultIdleTimeout
+	}
+	return &Server{options: options, conns: map[net.Conn]struct{}{}}
+}
+
+// Serve accepts connections on lis until the server is shut down
+func (s *Server) Serve(lis net.Listener) error {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		lis.Close()
+		return net.ErrClosed
+	}
+	s.listener = lis
+	s.mu.Unlock()
+
+	var retryDelay time.Duration
+	for {
+		conn, err := lis.Accept()
+		if err != nil {
+			s.mu.Lock()
+			closed := s.closed
+			s.mu.Unlock()
+			if closed {
+				return nil
+			}
+			// Retry temporary errors such as running out of file descriptors
+			// with backoff, as net/http.Server.Serve does
+			if temporary, ok := err.(interface{ Temporary() bool }); ok && temporary.Temporary() {
+				retryDelay = min(max(2*retryDelay, minAcceptRetryDelay), maxAcceptRetryDelay)
+				observability.WarnWithContext(context.Background(), fmt.Sprintf("TCP echo accept error: %v; retrying in %v", err, retryDelay))
+				time.Sleep(retryDelay)
+				continue
+			}
+			return err
+		}
+		retryDelay = 0
+
+		s.mu.Lock()
+		if s.closed {
+			s.mu.Unlock()
+			conn.Close()
+			return nil
+		}
+		s.conns[conn] = struct{}{}
+		s.wg.Add(1)
+		s.mu.Unlock()
+
+		go s.handle(conn)
+	}
+}
+
+// idleReader extends the read deadline of a connection before every read
+type idleReader struct {
+	conn    net.Conn
+	timeout time.Duration
+}
+
+func (r idleReader) Read(p []byte) (int, error) {
+	if err := r.conn.SetReadDeadline(time.Now().Add(r.timeout)); err != nil {
+		return 0, err
+	}
+	return r.conn.Read(p)
+}
+
+// handle echoes conn until the peer closes it, it idles out or the server shuts down
+func (s *Server) handle(conn net.Conn) {
+	defer s.wg.Done()
+	defer func() {
+		s.mu.Lock()
+		delete(s.conns, conn)
+		s.mu.Unlock()
+		conn.Close()
+	}()
+
+	start := time.Now()
+	peer := conn.RemoteAddr().String()
+	tcpConnections.Inc()
+	tcpConnectionsOpen.Inc()
+	defer tcpConnectionsOpen.Dec()
+
+	ctx := context.Background()
+	observability.InfoWithFields(ctx, fmt.Sprintf("TCP echo connection opened from %s", peer), map[string]any{
+		"type":  "tcp_echo_open",
+		"peer":  peer,
+		"local": conn.LocalAddr().String(),
+	})
+
+	echoed, err := io.Copy(conn, idleReader{conn: conn, timeout: s.options.IdleTimeout})
+	tcpEchoedBytes.Add(float64(echoed))
+
+	reason := "peer closed"
+	var netErr net.Error
+	switch {
+	case errors.As(err, &netErr) && netErr.Timeout():
+		reason = "idle timeout"
+	case errors.Is(err, net.ErrClosed):
+		reason = "server shutdown"
+	case err != nil:
+		reason = err.Error()
+	}
+	observability.InfoWithFields(ctx, fmt.Sprintf("TCP echo connection from %s closed after %v: %s", peer, time.Since(start).Round(time.Millisecond), reason), map[string]any{
+		"type":        "tcp_echo_close",
+		"peer":        peer,
+		"bytes":       echoed,
+		"duration_ms": observability.Milliseconds(time.Since(start)),
+		"reason":      reason,
+	})
+}
+
+// Shutdown stops accepting connections and waits for open ones to close
+// until ctx is done, then closes them
+func (s *Server) Shutdown(ctx context.Context) {
+	s.mu.Lock()
+	s.closed = true
+	if s.listener != nil {
+		s.listener.Close()
+	}
+	s.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		s.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-ctx.Done():
+		s.mu.Lock()
+		for conn := range s.conns {
+			conn.Close()
+		}
+		s.mu.Unlock()
+		<-done
+	}
+}
@@ -0,0 +1,126 @@
+package tcpecho
+
+import (
+	"context"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// startServer serves s on a local port and returns its address
+func startServer(t *testing.T, s *Server) string {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	go s.Serve(lis)
+	t.Cleanup(func() { s.Shutdown(context.Background()) })
+	return lis.Addr().String()
+}
+
+func TestEcho(t *testing.T) {
+	addr := startServer(t, New(Options{}))
+	echoed := testutil.ToFloat64(tcpEchoedBytes)
+
+	conn, err := net.Dial("tcp", addr)
+	require.NoError(t, err)
+	defer conn.Close()
+
+	payload := []byte("\x00\x01 not HTTP \xff")
+	_, err = conn.Write(payload)
+	require.NoError(t, err)
+	received := make([]byte, len(payload))
+	_, err = io.ReadFull(conn, received)
+	require.NoError(t, err)
+	assert.Equal(t, payload, received)
+
+	conn.Close()
+	assert.Eventually(t, func() bool {
+		return testutil.ToFloat64(tcpEchoedBytes) == echoed+float64(len(payload))
+	}, time.Second, 5*time.Millisecond)
+}
+
+// temporaryError is an accept error the server retries
+type temporaryError struct{}
+
+func (temporaryError) Error() string   { return "too many open files" }
+func (temporaryError) Temporary() bool { return true }
+func (temporaryError) Timeout() bool   { return false }
+
+// flakyListener fails the first accepts with a temporary error
+type flakyListener struct {
+	net.Listener
+	failures int
+}
+
+func (l *flakyListener) Accept() (net.Conn, error) {
+	if l.failures > 0 {
+		l.failures--
+		return nil, temporaryError{}
+	}
+	return l.Listener.Accept()
+}
+
+func TestServeRetriesTemporaryErrors(t *testing.T) {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	s := New(Options{})
+	served := make(chan error, 1)
+	go func() { served <- s.Serve(&flakyListener{Listener: lis, failures: 3}) }()
+	t.Cleanup(func() { s.Shutdown(context.Background()) })
+
+	conn, err := net.Dial("tcp", lis.Addr().String())
+	require.NoError(t, err)
+	defer conn.Close()
+	_, err = conn.Write([]byte("ping"))
+	require.NoError(t, err)
+	received := make([]byte, 4)
+	require.NoError(t, conn.SetReadDeadline(time.Now().Add(time.Second)))
+	_, err = io.ReadFull(conn, received)
+	require.NoError(t, err, "connections are accepted after temporary errors")
+	assert.Equal(t, "ping", string(received))
+
+	conn.Close()
+	s.Shutdown(context.Background())
+	assert.NoError(t, <-served)
+}
+
+func TestIdleTimeout(t *testing.T) {
+	addr := startServer(t, New(Options{IdleTimeout: 20 * time.Millisecond}))
+
+	conn, err := net.Dial("tcp", addr)
+	require.NoError(t, err)
+	defer conn.Close()
+
+	require.NoError(t, conn.SetReadDeadline(time.Now().Add(time.Second)))
+	_, err = conn.Read(make([]byte, 1))
+	assert.ErrorIs(t, err, io.EOF, "idle connections are closed by the server")
+}
+
+func TestShutdownClosesOpenConnections(t *testing.T) {
+	s := New(Options{})
+	addr := startServer(t, s)
+
+	conn, err := net.Dial("tcp", addr)
+	require.NoError(t, err)
+	defer conn.Close()
+	assert.Eventually(t, func() bool {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		return len(s.conns) == 1
+	}, time.Second, 5*time.Millisecond)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	s.Shutdown(ctx)
+
+	require.NoError(t, conn.SetReadDeadline(time.Now().Add(time.Second)))
+	_, err = conn.Read(make([]byte, 1))
+	assert.ErrorIs(t, err, io.EOF)
+
+	_, err = net.Dial("tcp", addr)
+	assert.Error(t, err, "the listener is closed")
+}
@@ -0,0 +1,181 @@
+// Package tenant attributes requests to the team that sent them.
+//
+// Shared istio-test gateways are used by several teams at once. A configurable
+// rule extracts the tenant from a request header, a JWT claim or a path
+// segment; the tenant is carried in the request context so logs, metrics and
+// traces can be attributed, and echoed on the response in X-Tenant-Id.
+package tenant
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+// Header carries the extracted tenant on the response, and on the request for
+// trace header tagging
+const Header = "X-Tenant-Id"
+
+// Sources a tenant can be extracted from
+const (
+	SourceHeader = "header" // Key is the header name
+	SourceJWT    = "jwt"    // Key is the claim of the bearer token
+	SourcePath   = "path"   // Key is a prefix such as "/tenants/"; the following segment is the tenant
+)
+
+// MaxMetricLabels bounds the number of distinct tenants used as metric label
+// values; later tenants are reported as "other"
+const MaxMetricLabels = 50
+
+// maxTenantLength bounds the accepted tenant length
+const maxTenantLength = 64
+
+type contextKey struct{}
+
+// Rule describes where the tenant of a request is found
+type Rule struct {
+	Source string
+	Key    string
+}
+
+// Validate reports whether the rule can extract a tenant
+func (rule Rule) Validate() error {
+	switch rule.Source {
+	case SourceHeader, SourceJWT:
+		if rule.Key == "" {
+			return fmt.Errorf("tenant %s rule requires a key", rule.Source)
+		}
+	case SourcePath:
+		if !strings.HasPrefix(rule.Key, "/") || !strings.HasSuffix(rule.Key, "/") {
+			return fmt.Errorf("tenant path prefix '%s' must start and end with /", rule.Key)
+		}
+	default:
+		return fmt.Errorf("unknown tenant source '%s': must be %s, %s or %s", rule.Source, SourceHeader, SourceJWT, SourcePath)
+	}
+	return nil
+}
+
+// Valid reports whether tenant is usable: 1-64 characters of letters, digits,
+// '.', '_' or '-'
+func Valid(tenant string) bool {
+	if tenant == "" || len(tenant) > maxTenantLength {
+		return false
+	}
+	for _, c := range tenant {
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9', c == '.', c == '_', c == '-':
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// Extract returns the tenant of r according to the rule, or an empty string
+// when it is missing or invalid
+func (rule Rule) Extract(r *http.Request) string {
+	var tenant string
+	switch rule.Source {
+	case SourceHeader:
+		tenant = r.Header.Get(rule.Key)
+	case SourceJWT:
+		tenant = bearerClaim(r, rule.Key)
+	case SourcePath:
+		if rest, ok := strings.CutPrefix(r.URL.Path, rule.Key); ok {
+			tenant, _, _ = strings.Cut(rest, "/")
+		}
+	}
+	if !Valid(tenant) {
+		return ""
+	}
+	return tenant
+}
+
+// bearerClaim returns a string or numeric claim of the bearer token. The
+// signature is not verified: tokens are expected to be validated by the
+// sidecar's RequestAuthentication before they reach the app.
+func bearerClaim(r *http.Request, claim string) string {
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok {
+		return ""
+	}
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return ""
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return ""
+	}
+	var claims map[string]any
+	if err := json.Unmarshal(payload, &claims); err != nil {
+		return ""
+	}
+	switch value := claims[claim].(type) {
+	case string:
+		return value
+	case float64:
+		return fmt.Sprint(value)
+	default:
+		return ""
+	}
+}
+
+// WithTenant returns a copy of ctx carrying the tenant
+func WithTenant(ctx context.Context, tenant string) context.Context {
+	return context.WithValue(ctx, contextKey{}, tenant)
+}
+
+// FromContext returns the tenant carried by ctx, or an empty string
+func FromContext(ctx context.Context) string {
+	tenant, _ := ctx.Value(contextKey{}).(string)
+	return tenant
+}
+
+// Middleware stores the tenant extracted by rule in the request context and
+// echoes it on the response. The request's X-Tenant-Id header is replaced by
+// the extracted tenant so clients cannot claim a tenant the rule did not find.
+func Middleware(rule Rule, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.Header.Del(Header)
+		tenant := rule.Extract(r)
+		if tenant == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		r.Header.Set(Header, tenant)
+		w.Header().Set(Header, tenant)
+		next.ServeHTTP(w, r.WithContext(WithTenant(r.Context(), tenant)))
+	})
+}
+
+var (
+	labelsMu sync.Mutex
+	labels   = map[string]struct{}{}
+)
+
+// MetricLabel returns the metric label value for tenant: "none" without a
+// tenant, the tenant itself for the first MaxMetricLabels distinct tenants and
+// "other" afterwards
+func MetricLabel(tenant string) string {
+	if tenant == "" {
+		return "none"
+	}
+
+	labelsMu.Lock()
+	defer labelsMu.Unlock()
+
+	if _, ok := labels[tenant]; ok {
+		return tenant
+	}
+	if len(labels) >= MaxMetricLabels {
+		return "other"
+	}
+	labels[tenant] = struct{}{}
+	return tenant
+}
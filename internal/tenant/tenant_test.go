@@ -0,0 +1,142 @@
+package tenant
+
+import (
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// bearerToken returns an unsigned JWT with the given payload
+func bearerToken(payload string) string {
+	encode := base64.RawURLEncoding.EncodeToString
+	return "Bearer " + encode([]byte(`{"alg":"none"}`)) + "." + encode([]byte(payload)) + ".sig"
+}
+
+func TestRuleValidate(t *testing.T) {
+	assert.NoError(t, Rule{Source: SourceHeader, Key: "X-Team"}.Validate())
+	assert.NoError(t, Rule{Source: SourceJWT, Key: "team"}.Validate())
+	assert.NoError(t, Rule{Source: SourcePath, Key: "/tenants/"}.Validate())
+	assert.Error(t, Rule{Source: SourceHeader}.Validate())
+	assert.Error(t, Rule{Source: SourcePath, Key: "tenants"}.Validate())
+	assert.Error(t, Rule{Source: "cookie", Key: "team"}.Validate())
+}
+
+func TestValid(t *testing.T) {
+	assert.True(t, Valid("team-a.payments_1"))
+	assert.False(t, Valid(""))
+	assert.False(t, Valid("team a"))
+	assert.False(t, Valid(strings.Repeat("a", 65)))
+}
+
+func TestExtract(t *testing.T) {
+	tests := []struct {
+		name     string
+		rule     Rule
+		setup    func(r *http.Request)
+		path     string
+		expected string
+	}{
+		{
+			name:     "header",
+			rule:     Rule{Source: SourceHeader, Key: "X-Team"},
+			setup:    func(r *http.Request) { r.Header.Set("X-Team", "payments") },
+			expected: "payments",
+		},
+		{
+			name:     "invalid header value",
+			rule:     Rule{Source: SourceHeader, Key: "X-Team"},
+			setup:    func(r *http.Request) { r.Header.Set("X-Team", "pay ments") },
+			expected: "",
+		},
+		{
+			name:     "JWT claim",
+			rule:     Rule{Source: SourceJWT, Key: "team"},
+			setup:    func(r *http.Request) { r.Header.Set("Authorization", bearerToken(`{"sub":"alice","team":"search"}`)) },
+			expected: "search",
+		},
+		{
+			name:     "numeric JWT claim",
+			rule:     Rule{Source: SourceJWT, Key: "org"},
+			setup:    func(r *http.Request) { r.Header.Set("Authorization", bearerToken(`{"org":42}`)) },
+			expected: "42",
+		},
+		{
+			name:     "missing JWT claim",
+			rule:     Rule{Source: SourceJWT, Key: "team"},
+			setup:    func(r *http.Request) { r.Header.Set("Authorization", bearerToken(`{"sub":"alice"}`)) },
+			expected: "",
+		},
+		{
+			name:     "malformed JWT",
+			rule:     Rule{Source: SourceJWT, Key: "team"},
+			setup:    func(r *http.Request) { r.Header.Set("Authorization", "Bearer not-a-jwt") },
+			expected: "",
+		},
+		{
+			name:     "path prefix",
+			rule:     Rule{Source: SourcePath, Key: "/tenants/"},
+			path:     "/tenants/checkout/istio-test/echo",
+			expected: "checkout",
+		},
+		{
+			name:     "other path",
+			rule:     Rule{Source: SourcePath, Key: "/tenants/"},
+			path:     "/istio-test/echo",
+			expected: "",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := tt.path
+			if path == "" {
+				path = "/"
+			}
+			req := httptest.NewRequest("GET", path, nil)
+			if tt.setup != nil {
+				tt.setup(req)
+			}
+			assert.Equal(t, tt.expected, tt.rule.Extract(req))
+		})
+	}
+}
+
+func TestMiddleware(t *testing.T) {
+	var seen, seenHeader string
+	handler := Middleware(Rule{Source: SourceHeader, Key: "X-Team"}, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		seen, seenHeader = FromContext(r.Context()), r.Header.Get(Header)
+	}))
+
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set("X-Team", "payments")
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	assert.Equal(t, "payments", seen)
+	assert.Equal(t, "payments", seenHeader)
+	assert.Equal(t, "payments", w.Header().Get(Header))
+
+	// A client cannot claim a tenant through X-Tenant-Id
+	req = httptest.NewRequest("GET", "/", nil)
+	req.Header.Set(Header, "spoofed")
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	assert.Empty(t, seen)
+	assert.Empty(t, seenHeader)
+	assert.Empty(t, w.Header().Get(Header))
+}
+
+func TestMetricLabel(t *testing.T) {
+	assert.Equal(t, "none", MetricLabel(""))
+
+	for i := 0; i < MaxMetricLabels; i++ {
+		tenant := fmt.Sprintf("label-tenant-%d", i)
+		assert.Equal(t, tenant, MetricLabel(tenant))
+	}
+	assert.Equal(t, "other", MetricLabel("label-tenant-overflow"))
+	assert.Equal(t, "label-tenant-0", MetricLabel("label-tenant-0"))
+}
@@ -0,0 +1,154 @@
+// Package testrun propagates the X-Test-Run-Id correlation header.
+//
+// Overlapping experiments against the same pods tag their requests with a test
+// run ID. The ID is carried in the request context so logs, metrics, traces
+// and outbound calls made on behalf of the request can be attributed to the
+// experiment that caused them.
+package testrun
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Header carries the test run ID
+const Header = "X-Test-Run-Id"
+
+// MaxMetricLabels bounds the number of distinct test run IDs used as metric
+// label values; later IDs are reported as "other" until an ID expires
+const MaxMetricLabels = 20
+
+// LabelIdleTimeout is how long an ID keeps its metric label without requests;
+// expired IDs free their slot for new test runs
+const LabelIdleTimeout = time.Hour
+
+// maxIDLength bounds the accepted ID length
+const maxIDLength = 64
+
+type contextKey struct{}
+
+// Valid reports whether id is a usable test run ID: 1-64 characters of
+// letters, digits, '.', '_' or '-'
+func Valid(id string) bool {
+	if id == "" || len(id) > maxIDLength {
+		return false
+	}
+	for _, c := range id {
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9', c == '.', c == '_', c == '-':
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// WithID returns a copy of ctx carrying the test run ID
+func WithID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, contextKey{}, id)
+}
+
+// FromContext returns the test run ID carried by ctx, or an empty string
+func FromContext(ctx context.Context) string {
+	id, _ := ctx.Value(contextKey{}).(string)
+	return id
+}
+
+// Middleware stores a valid X-Test-Run-Id request header in the request
+// context and echoes it on the response. Invalid IDs are ignored.
+func Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(Header)
+		if !Valid(id) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		w.Header().Set(Header, id)
+		next.ServeHTTP(w, r.WithContext(WithID(r.Context(), id)))
+	})
+}
+
+// propagatingTransport adds the test run ID of the request context to outbound requests
+type propagatingTransport struct {
+	next http.RoundTripper
+}
+
+func (t *propagatingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	id := FromContext(req.Context())
+	if id == "" || req.Header.Get(Header) != "" {
+		return t.next.RoundTrip(req)
+	}
+
+	req = req.Clone(req.Context())
+	req.Header.Set(Header, id)
+	return t.next.RoundTrip(req)
+}
+
+// Unwrap returns the wrapped transport
+func (t *propagatingTransport) Unwrap() http.RoundTripper {
+	return t.next
+}
+
+// Transport wraps next so outbound requests carry the test run ID
+func Transport(next http.RoundTripper) http.RoundTripper {
+	return &propagatingTransport{next: next}
+}
+
+var (
+	labelsMu sync.Mutex
+	labels   = map[string]time.Time{} // Last use of each ID
+	expired  []func(id string)
+
+	// now returns the current time; replaced in tests
+	now = time.Now
+)
+
+// OnLabelExpired registers fn to be called with each ID whose metric label
+// expired, so the series labeled with it can be deleted
+func OnLabelExpired(fn func(id string)) {
+	labelsMu.Lock()
+	defer labelsMu.Unlock()
+	expired = append(expired, fn)
+}
+
+// MetricLabel returns the metric label value for id: "none" without an ID, the
+// ID itself while fewer than MaxMetricLabels IDs were used within
+// LabelIdleTimeout and "other" otherwise
+func MetricLabel(id string) string {
+	if id == "" {
+		return "none"
+	}
+
+	labelsMu.Lock()
+	current := now()
+	if _, ok := labels[id]; ok {
+		labels[id] = current
+		labelsMu.Unlock()
+		return id
+	}
+
+	var idle []string
+	for label, lastUsed := range labels {
+		if current.Sub(lastUsed) >= LabelIdleTimeout {
+			delete(labels, label)
+			idle = append(idle, label)
+		}
+	}
+	label := "other"
+	if len(labels) < MaxMetricLabels {
+		labels[id] = current
+		label = id
+	}
+	callbacks := expired
+	labelsMu.Unlock()
+
+	for _, label := range idle {
+		for _, fn := range callbacks {
+			fn(label)
+		}
+	}
+	return label
+}
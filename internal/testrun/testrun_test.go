@@ -0,0 +1,106 @@
+package testrun
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestValid(t *testing.T) {
+	assert.True(t, Valid("run-2024.01_a"))
+	assert.False(t, Valid(""))
+	assert.False(t, Valid("run 1"))
+	assert.False(t, Valid("run/1"))
+	assert.False(t, Valid(strings.Repeat("a", 65)))
+}
+
+func TestMiddleware(t *testing.T) {
+	var seen string
+	handler := Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		seen = FromContext(r.Context())
+	}))
+
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set(Header, "run-1")
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	assert.Equal(t, "run-1", seen)
+	assert.Equal(t, "run-1", w.Header().Get(Header))
+
+	req = httptest.NewRequest("GET", "/", nil)
+	req.Header.Set(Header, "bad id")
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	assert.Empty(t, seen)
+	assert.Empty(t, w.Header().Get(Header))
+}
+
+func TestTransport(t *testing.T) {
+	received := make(chan string, 1)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received <- r.Header.Get(Header)
+	}))
+	defer ts.Close()
+
+	client := &http.Client{Transport: Transport(http.DefaultTransport)}
+	req, err := http.NewRequestWithContext(WithID(context.Background(), "run-2"), "GET", ts.URL, nil)
+	require.NoError(t, err)
+	resp, err := client.Do(req)
+	require.NoError(t, err)
+	resp.Body.Close()
+
+	assert.Equal(t, "run-2", <-received)
+	assert.Empty(t, req.Header.Get(Header), "caller's request must not be modified")
+}
+
+func TestMetricLabel(t *testing.T) {
+	assert.Equal(t, "none", MetricLabel(""))
+
+	for i := 0; i < MaxMetricLabels; i++ {
+		id := fmt.Sprintf("label-run-%d", i)
+		assert.Equal(t, id, MetricLabel(id))
+	}
+	assert.Equal(t, "other", MetricLabel("label-run-overflow"))
+	assert.Equal(t, "label-run-0", MetricLabel("label-run-0"))
+}
+
+func TestMetricLabelExpiry(t *testing.T) {
+	original := now
+	current := time.Now()
+	now = func() time.Time { return current }
+	resetLabels := func() {
+		labelsMu.Lock()
+		defer labelsMu.Unlock()
+		clear(labels)
+		expired = nil
+	}
+	resetLabels()
+	t.Cleanup(func() {
+		now = original
+		resetLabels()
+	})
+
+	for i := 0; i < MaxMetricLabels; i++ {
+		MetricLabel(fmt.Sprintf("expiry-run-%d", i))
+	}
+	assert.Equal(t, "other", MetricLabel("expiry-run-new"))
+
+	var expiredIDs []string
+	OnLabelExpired(func(id string) { expiredIDs = append(expiredIDs, id) })
+
+	// Only IDs without requests for LabelIdleTimeout expire
+	current = current.Add(LabelIdleTimeout / 2)
+	MetricLabel("expiry-run-0")
+	current = current.Add(LabelIdleTimeout / 2)
+	assert.Equal(t, "expiry-run-new", MetricLabel("expiry-run-new"))
+	assert.Len(t, expiredIDs, MaxMetricLabels-1)
+	assert.NotContains(t, expiredIDs, "expiry-run-0")
+	assert.Equal(t, "expiry-run-0", MetricLabel("expiry-run-0"))
+}
@@ -0,0 +1,458 @@
+// Package transform applies configured transformations to responses at the
+// origin, such as injecting headers, rewriting JSON fields or truncating
+// bodies, so they can be contrasted with the same mutations done by an
+// EnvoyFilter or Wasm extension in the sidecar.
+package transform
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"mime"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+
+	"istio-test/internal/observability"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const (
+	maxRules     = 100
+	maxStepsRule = 20
+	maxRuleBytes = 64 << 10
+)
+
+var responseTransforms = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Namespace: "istio_test",
+	Name:      "response_transforms_total",
+	Help:      "Transformation steps run on responses by step type and result (applied or skipped).",
+}, []string{"type", "result"})
+
+func init() {
+	observability.MetricsRegistry().MustRegister(responseTransforms)
+}
+
+// Step is one transformation of a rule. The fields used depend on the type.
+type Step struct {
+	Type  string          `json:"type" schema:"required"` // set_header, remove_header, set_field, remove_field, truncate or a registered type
+	Name  string          `json:"name,omitempty"`         // Header name
+	Value string          `json:"value,omitempty"`        // Header value
+	Path  string          `json:"path,omitempty"`         // Dotted JSON field path such as "metadata.zone"
+	JSON  json.RawMessage `json:"json,omitempty"`         // Field value
+	Bytes int             `json:"bytes,omitempty"`        // Body bytes kept by truncate
+}
+
+// Rule is the chain of steps applied to the responses of a route
+type Rule struct {
+	Route string `json:"route" schema:"required"` // Path prefix, the longest matching prefix wins
+	Steps []Step `json:"steps"`
+}
+
+// Rules is the body accepted by Pipeline.Handler and LoadRules
+type Rules struct {
+	Rules []Rule `json:"rules"`
+}
+
+// Response is a buffered response as seen by a Transformer
+type Response struct {
+	Status int
+	Header http.Header
+	Body   []byte
+}
+
+// ErrSkipped is returned by a Transformer that does not apply to a response,
+// e.g. a JSON rewrite of a text body; the response is left as it was
+var ErrSkipped = errors.New("transformation does not apply")
+
+// Transformer mutates a buffered response
+type Transformer interface {
+	Transform(resp *Response) error
+}
+
+// TransformerFunc adapts a function to a Transformer
+type TransformerFunc func(resp *Response) error
+
+// Transform calls f(resp)
+func (f TransformerFunc) Transform(resp *Response) error {
+	return f(resp)
+}
+
+// Builder validates a step and builds its Transformer
+type Builder func(step Step) (Transformer, error)
+
+var (
+	buildersMu sync.RWMutex
+	builders   = map[string]Builder{
+		"set_header":    buildSetHeader,
+		"remove_header": buildRemoveHeader,
+		"set_field":     buildSetField,
+		"remove_field":  buildRemoveField,
+		"truncate":      buildTruncate,
+	}
+)
+
+// Register makes a step type available to rules. Rules loaded before the
+// registration do not see it, so it is meant to be called from init.
+func Register(stepType string, builder Builder) error {
+	buildersMu.Lock()
+	defer buildersMu.Unlock()
+	if _, ok := builders[stepType]; ok {
+		return fmt.Errorf("step type '%s' is already registered", stepType)
+	}
+	builders[stepType] = builder
+	return nil
+}
+
+// build returns the Transformer of a step
+func build(step Step) (Transformer, error) {
+	buildersMu.RLock()
+	builder, ok := builders[step.Type]
+	buildersMu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("unknown step type '%s'", step.Type)
+	}
+	return builder(step)
+}
+
+func buildSetHeader(step Step) (Transformer, error) {
+	if step.Name == "" {
+		return nil, errors.New("set_header requires a name")
+	}
+	name, value := step.Name, step.Value
+	return TransformerFunc(func(resp *Response) error {
+		resp.Header.Set(name, value)
+		return nil
+	}), nil
+}
+
+func buildRemoveHeader(step Step) (Transformer, error) {
+	if step.Name == "" {
+		return nil, errors.New("remove_header requires a name")
+	}
+	name := step.Name
+	return TransformerFunc(func(resp *Response) error {
+		resp.Header.Del(name)
+		return nil
+	}), nil
+}
+
+func buildSetField(step Step) (Transformer, error) {
+	path, err := splitPath(step.Path)
+	if err != nil {
+		return nil, err
+	}
+	if !json.Valid(step.JSON) {
+		return nil, errors.New("set_field requires a JSON value")
+	}
+	raw := step.JSON
+	return TransformerFunc(func(resp *Response) error {
+		// Decoded per response, so later steps never mutate a shared value
+		var value any
+		if err := decodeJSON(raw, &value); err != nil {
+			return err
+		}
+		return rewriteJSON(resp, func(doc map[string]any) {
+			for _, key := range path[:len(path)-1] {
+				child, ok := doc[key].(map[string]any)
+				if !ok {
+					child = map[string]any{}
+					doc[key] = child
+				}
+				doc = child
+			}
+			doc[path[len(path)-1]] = value
+		})
+	}), nil
+}
+
+func buildRemoveField(step Step) (Transformer, error) {
+	path, err := splitPath(step.Path)
+	if err != nil {
+		return nil, err
+	}
+	return TransformerFunc(func(resp *Response) error {
+		return rewriteJSON(resp, func(doc map[string]any) {
+			for _, key := range path[:len(path)-1] {
+				child, ok := doc[key].(map[string]any)
+				if !ok {
+					return
+				}
+				doc = child
+			}
+			delete(doc, path[len(path)-1])
+		})
+	}), nil
+}
+
+func buildTruncate(step Step) (Transformer, error) {
+	if step.Bytes < 0 {
+		return nil, errors.New("truncate bytes must not be negative")
+	}
+	limit := step.Bytes
+	return TransformerFunc(func(resp *Response) error {
+		if resp.Header.Get("Content-Encoding") != "" {
+			return ErrSkipped
+		}
+		if len(resp.Body) > limit {
+			resp.Body = resp.Body[:limit]
+		}
+		return nil
+	}), nil
+}
+
+// splitPath splits a dotted JSON field path
+func splitPath(path string) ([]string, error) {
+	keys := strings.Split(path, ".")
+	for _, key := range keys {
+		if key == "" {
+			return nil, fmt.Errorf("invalid field path '%s'", path)
+		}
+	}
+	return keys, nil
+}
+
+// rewriteJSON applies edit to the JSON object of an unencoded JSON response.
+// Numbers keep their precision; object keys are written in sorted order.
+func rewriteJSON(resp *Response, edit func(doc map[string]any)) error {
+	if resp.Header.Get("Content-Encoding") != "" || !isJSON(resp.Header.Get("Content-Type")) {
+		return ErrSkipped
+	}
+
+	var doc map[string]any
+	if err := decodeJSON(resp.Body, &doc); err != nil || doc == nil {
+		return ErrSkipped
+	}
+	edit(doc)
+
+	body, err := json.Marshal(doc)
+	if err != nil {
+		return err
+	}
+	resp.Body = body
+	return nil
+}
+
+// decodeJSON decodes data keeping the precision of numbers
+func decodeJSON(data []byte, v any) error {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	return decoder.Decode(v)
+}
+
+// isJSON reports whether a Content-Type is application/json or a +json type
+func isJSON(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	return err == nil && (mediaType == "application/json" || strings.HasSuffix(mediaType, "+json"))
+}
+
+// chain is a validated rule with the Transformers of its steps
+type chain struct {
+	rule         Rule
+	transformers []Transformer
+}
+
+// compile validates a rule and builds its chain
+func compile(rule Rule) (chain, error) {
+	if !strings.HasPrefix(rule.Route, "/") {
+		return chain{}, fmt.Errorf("route '%s' must start with /", rule.Route)
+	}
+	if len(rule.Steps) == 0 || len(rule.Steps) > maxStepsRule {
+		return chain{}, fmt.Errorf("route '%s': between 1 and %d steps are required", rule.Route, maxStepsRule)
+	}
+	c := chain{rule: rule}
+	for i, step := range rule.Steps {
+		transformer, err := build(step)
+		if err != nil {
+			return chain{}, fmt.Errorf("route '%s' step %d: %w", rule.Route, i, err)
+		}
+		c.transformers = append(c.transformers, transformer)
+	}
+	return c, nil
+}
+
+// Pipeline transforms the responses of routes matching a rule. Rules can be
+// replaced at runtime, so A/B runs can switch transformations without a
+// redeploy.
+type Pipeline struct {
+	mu     sync.RWMutex
+	chains []chain
+}
+
+// NewPipeline creates a pipeline without rules
+func NewPipeline() *Pipeline {
+	return &Pipeline{}
+}
+
+// Set validates and replaces the rules of the pipeline
+func (p *Pipeline) Set(rules []Rule) error {
+	if len(rules) > maxRules {
+		return fmt.Errorf("at most %d rules are allowed", maxRules)
+	}
+	chains := make([]chain, 0, len(rules))
+	for _, rule := range rules {
+		c, err := compile(rule)
+		if err != nil {
+			return err
+		}
+		chains = append(chains, c)
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.chains = chains
+	return nil
+}
+
+// Rules returns a copy of the current rules
+func (p *Pipeline) Rules() []Rule {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	rules := make([]Rule, 0, len(p.chains))
+	for _, c := range p.chains {
+		rules = append(rules, c.rule)
+	}
+	return rules
+}
+
+// match returns the chain with the longest route prefix of path
+func (p *Pipeline) match(path string) (chain, bool) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	var best chain
+	found := false
+	for _, c := range p.chains {
+		if strings.HasPrefix(path, c.rule.Route) && (!found || len(c.rule.Route) > len(best.rule.Route)) {
+			best, found = c, true
+		}
+	}
+	return best, found
+}
+
+// bufferWriter holds the status and body of a response until the chain ran.
+// It does not expose the underlying writer, so flushes cannot bypass the
+// buffer.
+type bufferWriter struct {
+	http.ResponseWriter
+	status int
+	body   bytes.Buffer
+}
+
+func (w *bufferWriter) WriteHeader(code int) {
+	if w.status == 0 {
+		w.status = code
+	}
+}
+
+func (w *bufferWriter) Write(b []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	return w.body.Write(b)
+}
+
+// Middleware runs the chain of the matching rule on responses. Matching
+// responses are buffered in full, so rules should not target streaming routes.
+func (p *Pipeline) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		c, ok := p.match(r.URL.Path)
+		if !ok {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		buffered := &bufferWriter{ResponseWriter: w}
+		next.ServeHTTP(buffered, r)
+		if buffered.status == 0 {
+			buffered.status = http.StatusOK
+		}
+
+		resp := &Response{Status: buffered.status, Header: w.Header(), Body: buffered.body.Bytes()}
+		length := len(resp.Body)
+		for i, transformer := range c.transformers {
+			stepType := c.rule.Steps[i].Type
+			if err := transformer.Transform(resp); err != nil {
+				if !errors.Is(err, ErrSkipped) {
+					observability.WarnWithContext(r.Context(), fmt.Sprintf("Response transformation %s failed on %s: %v", stepType, r.URL.Path, err))
+				}
+				responseTransforms.WithLabelValues(stepType, "skipped").Inc()
+				continue
+			}
+			responseTransforms.WithLabelValues(stepType, "applied").Inc()
+		}
+
+		// HEAD responses describe a body that is not sent
+		if r.Method != http.MethodHead && (len(resp.Body) != length || resp.Header.Get("Content-Length") != "") {
+			resp.Header.Set("Content-Length", strconv.Itoa(len(resp.Body)))
+		}
+		w.WriteHeader(resp.Status)
+		_, _ = w.Write(resp.Body)
+	})
+}
+
+// decodeRules strictly decodes a Rules document
+func decodeRules(decoder *json.Decoder) ([]Rule, error) {
+	decoder.DisallowUnknownFields()
+	var rules Rules
+	if err := decoder.Decode(&rules); err != nil {
+		return nil, err
+	}
+	if decoder.More() {
+		return nil, errors.New("unexpected data after JSON object")
+	}
+	return rules.Rules, nil
+}
+
+// LoadRules reads a Rules document from a file, e.g. a mounted ConfigMap
+func LoadRules(path string) ([]Rule, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open transform rules: %w", err)
+	}
+	defer file.Close()
+
+	rules, err := decodeRules(json.NewDecoder(file))
+	if err != nil {
+		return nil, fmt.Errorf("invalid transform rules in %s: %w", path, err)
+	}
+	return rules, nil
+}
+
+// Handler serves the rules on GET, replaces them on PUT and removes them on DELETE
+func (p *Pipeline) Handler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodPut:
+			rules, err := decodeRules(json.NewDecoder(http.MaxBytesReader(w, r.Body, maxRuleBytes)))
+			if err != nil {
+				var maxBytesErr *http.MaxBytesError
+				if errors.As(err, &maxBytesErr) {
+					http.Error(w, fmt.Sprintf("Rules exceed %d bytes", maxRuleBytes), http.StatusRequestEntityTooLarge)
+					return
+				}
+				http.Error(w, fmt.Sprintf("Invalid rules: %v", err), http.StatusBadRequest)
+				return
+			}
+			if err := p.Set(rules); err != nil {
+				http.Error(w, fmt.Sprintf("Invalid rules: %v", err), http.StatusBadRequest)
+				return
+			}
+		case http.MethodDelete:
+			_ = p.Set(nil)
+		}
+
+		jsonData, err := json.Marshal(Rules{Rules: p.Rules()})
+		if err != nil {
+			http.Error(w, "Failed to encode rules", http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		_, _ = w.Write(jsonData)
+	}
+}
@@ -0,0 +1,151 @@
+package transform
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newTestHandler returns the pipeline middleware around a handler answering
+// JSON on /metadata/ and text elsewhere
+func newTestHandler(p *Pipeline) http.Handler {
+	return p.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasPrefix(r.URL.Path, "/metadata/") {
+			w.Header().Set("Content-Type", "application/json")
+			w.Header().Set("X-Internal", "secret")
+			_, _ = w.Write([]byte(`{"zone":"us-east1-b","project":{"id":"p-1","number":123456789012345678}}`))
+			return
+		}
+		w.Header().Set("Content-Type", "text/plain")
+		w.Header().Set("Content-Length", "11")
+		w.WriteHeader(http.StatusAccepted)
+		_, _ = w.Write([]byte("hello world"))
+	}))
+}
+
+func serve(handler http.Handler, method, path string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(method, path, nil))
+	return w
+}
+
+func TestPipelineMiddleware(t *testing.T) {
+	p := NewPipeline()
+	require.NoError(t, p.Set([]Rule{
+		{Route: "/metadata/", Steps: []Step{
+			{Type: "set_header", Name: "X-Transformed-By", Value: "origin"},
+			{Type: "remove_header", Name: "X-Internal"},
+			{Type: "set_field", Path: "zone", JSON: json.RawMessage(`"europe-west1-b"`)},
+			{Type: "set_field", Path: "labels.variant", JSON: json.RawMessage(`"b"`)},
+			{Type: "remove_field", Path: "project.id"},
+		}},
+		{Route: "/text", Steps: []Step{
+			{Type: "set_field", Path: "zone", JSON: json.RawMessage(`"x"`)},
+			{Type: "truncate", Bytes: 5},
+		}},
+	}))
+	handler := newTestHandler(p)
+
+	w := serve(handler, http.MethodGet, "/metadata/zone")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "origin", w.Header().Get("X-Transformed-By"))
+	assert.Empty(t, w.Header().Get("X-Internal"))
+	assert.JSONEq(t, `{"zone":"europe-west1-b","labels":{"variant":"b"},"project":{"number":123456789012345678}}`, w.Body.String())
+	assert.Equal(t, strconv.Itoa(w.Body.Len()), w.Header().Get("Content-Length"))
+
+	// The JSON rewrite is skipped on text, the truncation applies
+	before := testutil.ToFloat64(responseTransforms.WithLabelValues("set_field", "skipped"))
+	w = serve(handler, http.MethodGet, "/text")
+	assert.Equal(t, http.StatusAccepted, w.Code)
+	assert.Equal(t, "hello", w.Body.String())
+	assert.Equal(t, "5", w.Header().Get("Content-Length"))
+	assert.Equal(t, before+1, testutil.ToFloat64(responseTransforms.WithLabelValues("set_field", "skipped")))
+
+	// Unmatched routes are untouched
+	w = serve(handler, http.MethodGet, "/other")
+	assert.Equal(t, "hello world", w.Body.String())
+	assert.Equal(t, "11", w.Header().Get("Content-Length"))
+}
+
+func TestPipelineSetRejectsInvalidRules(t *testing.T) {
+	p := NewPipeline()
+	assert.Error(t, p.Set([]Rule{{Route: "metadata", Steps: []Step{{Type: "truncate"}}}}))
+	assert.Error(t, p.Set([]Rule{{Route: "/metadata/"}}))
+	assert.Error(t, p.Set([]Rule{{Route: "/metadata/", Steps: []Step{{Type: "unknown"}}}}))
+	assert.Error(t, p.Set([]Rule{{Route: "/metadata/", Steps: []Step{{Type: "set_header"}}}}))
+	assert.Error(t, p.Set([]Rule{{Route: "/metadata/", Steps: []Step{{Type: "set_field", Path: "a..b", JSON: json.RawMessage(`1`)}}}}))
+	assert.Error(t, p.Set([]Rule{{Route: "/metadata/", Steps: []Step{{Type: "set_field", Path: "a", JSON: json.RawMessage(`{`)}}}}))
+	assert.Error(t, p.Set([]Rule{{Route: "/metadata/", Steps: []Step{{Type: "truncate", Bytes: -1}}}}))
+	assert.Empty(t, p.Rules())
+}
+
+func TestRegister(t *testing.T) {
+	require.NoError(t, Register("uppercase", func(step Step) (Transformer, error) {
+		return TransformerFunc(func(resp *Response) error {
+			resp.Body = []byte(strings.ToUpper(string(resp.Body)))
+			return nil
+		}), nil
+	}))
+	assert.Error(t, Register("truncate", buildTruncate))
+
+	p := NewPipeline()
+	require.NoError(t, p.Set([]Rule{{Route: "/text", Steps: []Step{{Type: "uppercase"}}}}))
+
+	w := serve(newTestHandler(p), http.MethodGet, "/text")
+	assert.Equal(t, "HELLO WORLD", w.Body.String())
+}
+
+func TestLoadRules(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "rules.json")
+	require.NoError(t, os.WriteFile(path, []byte(`{"rules":[{"route":"/metadata/","steps":[{"type":"set_header","name":"X-Variant","value":"a"}]}]}`), 0o600))
+
+	rules, err := LoadRules(path)
+	require.NoError(t, err)
+	require.Len(t, rules, 1)
+	assert.Equal(t, "X-Variant", rules[0].Steps[0].Name)
+
+	require.NoError(t, os.WriteFile(path, []byte(`{"rules":[],"extra":true}`), 0o600))
+	_, err = LoadRules(path)
+	assert.Error(t, err)
+
+	_, err = LoadRules(filepath.Join(dir, "missing.json"))
+	assert.Error(t, err)
+}
+
+func TestPipelineHandler(t *testing.T) {
+	p := NewPipeline()
+	handler := p.Handler()
+
+	put := func(body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		handler(w, httptest.NewRequest(http.MethodPut, "/admin/transforms", strings.NewReader(body)))
+		return w
+	}
+
+	w := put(`{"rules":[{"route":"/metadata/","steps":[{"type":"truncate","bytes":10}]}]}`)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"truncate"`)
+	assert.Len(t, p.Rules(), 1)
+
+	w = put(`{"rules":[{"route":"/metadata/","steps":[{"type":"nope"}]}]}`)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Len(t, p.Rules(), 1)
+
+	w = put(strings.Repeat(" ", maxRuleBytes+1))
+	assert.Equal(t, http.StatusRequestEntityTooLarge, w.Code)
+
+	w = httptest.NewRecorder()
+	handler(w, httptest.NewRequest(http.MethodDelete, "/admin/transforms", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Empty(t, p.Rules())
+}
@@ -0,0 +1,224 @@
+// Package tunables exposes a safe set of settings that can be changed while
+// serving, so experiments can be adjusted mid-run without a pod restart or a
+// config rollout.
+//
+// Each tunable is owned by the package it affects, which keeps the value in an
+// atomic or behind its own lock; the registry only knows how to read, validate
+// and set it. A PATCH applies all requested changes or none of them, and every
+// change is logged as an audit event with the previous and new value.
+package tunables
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"istio-test/internal/gctune"
+	"istio-test/internal/observability"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// maxPatchBytes bounds the size of a PATCH body
+const maxPatchBytes = 4 << 10
+
+var changes = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Namespace: "istio_test",
+	Name:      "tunable_changes_total",
+	Help:      "Total number of runtime tunable changes by tunable.",
+}, []string{"name"})
+
+func init() {
+	observability.MetricsRegistry().MustRegister(changes)
+}
+
+// Duration is a time.Duration encoded as a string such as "500ms" in JSON
+type Duration time.Duration
+
+// String formats the duration like time.Duration
+func (d Duration) String() string {
+	return time.Duration(d).String()
+}
+
+// MarshalJSON encodes the duration as a string
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+// UnmarshalJSON decodes a duration string
+func (d *Duration) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return fmt.Errorf("duration must be a string such as \"500ms\"")
+	}
+	parsed, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	*d = Duration(parsed)
+	return nil
+}
+
+// ValidateRate accepts probabilities between 0 and 1
+func ValidateRate(rate float64) error {
+	if rate < 0 || rate > 1 {
+		return fmt.Errorf("must be between 0 and 1")
+	}
+	return nil
+}
+
+// ValidatePositive accepts values above zero
+func ValidatePositive[T ~int | ~int64 | ~float64](value T) error {
+	if value <= 0 {
+		return fmt.Errorf("must be positive")
+	}
+	return nil
+}
+
+// tunable reads a value and prepares changes to it
+type tunable struct {
+	get func() any
+	// prepare decodes and validates value and returns the function that applies it
+	prepare func(value json.RawMessage) (apply func(), err error)
+}
+
+// Registry holds the tunables exposed by Handler
+type Registry struct {
+	mu       sync.Mutex
+	tunables map[string]tunable
+}
+
+// NewRegistry creates an empty registry
+func NewRegistry() *Registry {
+	return &Registry{tunables: make(map[string]tunable)}
+}
+
+// Register exposes a tunable under name. validate, if set, rejects values
+// before any change of the same request is applied.
+func Register[T any](r *Registry, name string, get func() T, validate func(T) error, set func(T)) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.tunables[name] = tunable{
+		get: func() any { return get() },
+		prepare: func(raw json.RawMessage) (func(), error) {
+			var value T
+			if err := json.Unmarshal(raw, &value); err != nil {
+				return nil, err
+			}
+			if validate != nil {
+				if err := validate(value); err != nil {
+					return nil, err
+				}
+			}
+			return func() { set(value) }, nil
+		},
+	}
+}
+
+// Values returns the current value of every tunable
+func (r *Registry) Values() map[string]any {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	values := make(map[string]any, len(r.tunables))
+	for name, t := range r.tunables {
+		values[name] = t.get()
+	}
+	return values
+}
+
+// Change is the previous and new value of a changed tunable
+type Change struct {
+	Old any `json:"old"`
+	New any `json:"new"`
+}
+
+// Update validates every requested value and then applies them all; nothing
+// is applied when any value is unknown or invalid
+func (r *Registry) Update(values map[string]json.RawMessage) (map[string]Change, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	names := make([]string, 0, len(values))
+	for name := range values {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	applies := make([]func(), 0, len(names))
+	for _, name := range names {
+		t, ok := r.tunables[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown tunable '%s'", name)
+		}
+		apply, err := t.prepare(values[name])
+		if err != nil {
+			return nil, fmt.Errorf("invalid value for '%s': %w", name, err)
+		}
+		applies = append(applies, apply)
+	}
+
+	changed := make(map[string]Change, len(names))
+	for i, name := range names {
+		old := r.tunables[name].get()
+		applies[i]()
+		changed[name] = Change{Old: old, New: r.tunables[name].get()}
+	}
+	return changed, nil
+}
+
+// Response is served by Handler
+type Response struct {
+	Runtime  gctune.Status  `json:"runtime"`
+	Tunables map[string]any `json:"tunables"`
+}
+
+// Handler reports the runtime memory settings and the tunables (GET) or
+// changes tunables from a JSON object of names and values (PATCH)
+func (r *Registry) Handler() http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		if req.Method == http.MethodPatch {
+			var values map[string]json.RawMessage
+			if err := json.NewDecoder(http.MaxBytesReader(w, req.Body, maxPatchBytes)).Decode(&values); err != nil {
+				var maxBytesErr *http.MaxBytesError
+				if errors.As(err, &maxBytesErr) {
+					http.Error(w, fmt.Sprintf("Tunables exceed %d bytes", maxPatchBytes), http.StatusRequestEntityTooLarge)
+					return
+				}
+				http.Error(w, fmt.Sprintf("Invalid tunables: %v", err), http.StatusBadRequest)
+				return
+			}
+			changed, err := r.Update(values)
+			if err != nil {
+				http.Error(w, fmt.Sprintf("Invalid tunables: %v", err), http.StatusBadRequest)
+				return
+			}
+			for name, change := range changed {
+				changes.WithLabelValues(name).Inc()
+				observability.InfoWithFields(req.Context(), fmt.Sprintf("Tunable %s changed from %v to %v", name, change.Old, change.New), map[string]any{
+					"type":      "tunable_change",
+					"tunable":   name,
+					"old":       change.Old,
+					"new":       change.New,
+					"client_ip": observability.ClientIP(req),
+				})
+			}
+		}
+
+		jsonData, err := json.Marshal(Response{Runtime: gctune.Current(), Tunables: r.Values()})
+		if err != nil {
+			observability.ErrorWithContext(req.Context(), fmt.Sprintf("Error encoding tunables: %v", err))
+			http.Error(w, "Failed to encode tunables", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		_, _ = w.Write(jsonData)
+	}
+}
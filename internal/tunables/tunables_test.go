@@ -0,0 +1,100 @@
+package tunables
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestRegistry() (*Registry, *float64, *Duration) {
+	rate, threshold := 1.0, Duration(time.Second)
+	r := NewRegistry()
+	Register(r, "log_sample_rate", func() float64 { return rate }, ValidateRate, func(v float64) { rate = v })
+	Register(r, "slow_threshold", func() Duration { return threshold }, nil, func(v Duration) { threshold = v })
+	return r, &rate, &threshold
+}
+
+func TestValidators(t *testing.T) {
+	assert.NoError(t, ValidateRate(0))
+	assert.NoError(t, ValidateRate(1))
+	assert.Error(t, ValidateRate(1.1))
+	assert.NoError(t, ValidatePositive(Duration(time.Millisecond)))
+	assert.Error(t, ValidatePositive(0))
+	assert.Error(t, ValidatePositive(-0.5))
+}
+
+func patch(handler http.HandlerFunc, body string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	handler(w, httptest.NewRequest(http.MethodPatch, "/admin/runtime", strings.NewReader(body)))
+	return w
+}
+
+func TestDuration(t *testing.T) {
+	data, err := json.Marshal(Duration(1500 * time.Millisecond))
+	require.NoError(t, err)
+	assert.Equal(t, `"1.5s"`, string(data))
+
+	var d Duration
+	require.NoError(t, json.Unmarshal([]byte(`"250ms"`), &d))
+	assert.Equal(t, Duration(250*time.Millisecond), d)
+	assert.Error(t, json.Unmarshal([]byte(`250`), &d))
+	assert.Error(t, json.Unmarshal([]byte(`"soon"`), &d))
+}
+
+func TestHandlerGet(t *testing.T) {
+	r, _, _ := newTestRegistry()
+
+	w := httptest.NewRecorder()
+	r.Handler()(w, httptest.NewRequest(http.MethodGet, "/admin/runtime", nil))
+
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "application/json", w.Header().Get("Content-Type"))
+	var response struct {
+		Runtime  map[string]any `json:"runtime"`
+		Tunables map[string]any `json:"tunables"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	assert.Contains(t, response.Runtime, "gc_percent")
+	assert.Equal(t, map[string]any{"log_sample_rate": 1.0, "slow_threshold": "1s"}, response.Tunables)
+}
+
+func TestHandlerPatch(t *testing.T) {
+	r, rate, threshold := newTestRegistry()
+
+	w := patch(r.Handler(), `{"log_sample_rate": 0.25, "slow_threshold": "200ms"}`)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.Equal(t, 0.25, *rate)
+	assert.Equal(t, Duration(200*time.Millisecond), *threshold)
+	assert.Contains(t, w.Body.String(), `"slow_threshold":"200ms"`)
+}
+
+func TestHandlerPatchIsAllOrNothing(t *testing.T) {
+	r, rate, threshold := newTestRegistry()
+
+	tests := map[string]string{
+		"invalid value":   `{"slow_threshold": "200ms", "log_sample_rate": 2}`,
+		"wrong type":      `{"slow_threshold": "200ms", "log_sample_rate": "all"}`,
+		"unknown tunable": `{"slow_threshold": "200ms", "gomaxprocs": 1}`,
+		"not an object":   `[1]`,
+	}
+	for name, body := range tests {
+		w := patch(r.Handler(), body)
+		assert.Equal(t, http.StatusBadRequest, w.Code, name)
+	}
+	assert.Equal(t, 1.0, *rate)
+	assert.Equal(t, Duration(time.Second), *threshold)
+}
+
+func TestUpdateReportsChanges(t *testing.T) {
+	r, _, _ := newTestRegistry()
+
+	changed, err := r.Update(map[string]json.RawMessage{"log_sample_rate": json.RawMessage(`0.5`)})
+	require.NoError(t, err)
+	assert.Equal(t, map[string]Change{"log_sample_rate": {Old: 1.0, New: 0.5}}, changed)
+}
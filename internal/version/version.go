@@ -0,0 +1,86 @@
+// Package version reports the build the running binary was made from.
+//
+// The values are set at build time with -ldflags, for example:
+//
+//	go build -ldflags "-X istio-test/internal/version.version=v1.2.3 \
+//	  -X istio-test/internal/version.gitCommit=$(git rev-parse HEAD) \
+//	  -X istio-test/internal/version.buildDate=$(date -u +%Y-%m-%dT%H:%M:%SZ)"
+//
+// When the commit or build date are not set, the VCS information embedded by
+// the Go toolchain is used instead.
+package version
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"runtime"
+	"runtime/debug"
+	"sync"
+
+	"istio-test/internal/observability"
+)
+
+// Build-time variables (set via ldflags during build)
+var (
+	version   = "dev"
+	gitCommit = ""
+	buildDate = ""
+)
+
+// Info describes the build of the running binary
+type Info struct {
+	Version   string `json:"version"`
+	GitCommit string `json:"git_commit,omitempty"`
+	BuildDate string `json:"build_date,omitempty"`
+	GoVersion string `json:"go_version"`
+	Platform  string `json:"platform"`
+}
+
+// String returns a one-line summary for logs
+func (i Info) String() string {
+	return fmt.Sprintf("version %s, commit %s, built %s, %s %s", i.Version, i.GitCommit, i.BuildDate, i.GoVersion, i.Platform)
+}
+
+var (
+	infoOnce sync.Once
+	info     Info
+)
+
+// Get returns the build information
+func Get() Info {
+	infoOnce.Do(func() {
+		info = Info{
+			Version:   version,
+			GitCommit: gitCommit,
+			BuildDate: buildDate,
+			GoVersion: runtime.Version(),
+			Platform:  runtime.GOOS + "/" + runtime.GOARCH,
+		}
+		if buildInfo, ok := debug.ReadBuildInfo(); ok {
+			for _, setting := range buildInfo.Settings {
+				switch {
+				case setting.Key == "vcs.revision" && info.GitCommit == "":
+					info.GitCommit = setting.Value
+				case setting.Key == "vcs.time" && info.BuildDate == "":
+					info.BuildDate = setting.Value
+				}
+			}
+		}
+	})
+	return info
+}
+
+// Handler returns the build information as JSON
+func Handler(w http.ResponseWriter, r *http.Request) {
+	jsonData, err := json.Marshal(Get())
+	if err != nil {
+		observability.ErrorWithContext(r.Context(), fmt.Sprintf("Error encoding version: %v", err))
+		http.Error(w, "Failed to encode version", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write(jsonData)
+}
@@ -0,0 +1,60 @@
+package version
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"runtime"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// withBuildVars sets the ldflags variables for the duration of a test
+func withBuildVars(t *testing.T, v, commit, date string) {
+	original := []string{version, gitCommit, buildDate}
+	version, gitCommit, buildDate = v, commit, date
+	infoOnce = sync.Once{}
+	t.Cleanup(func() {
+		version, gitCommit, buildDate = original[0], original[1], original[2]
+		infoOnce = sync.Once{}
+	})
+}
+
+func TestGet(t *testing.T) {
+	withBuildVars(t, "v1.2.3", "abc123", "2024-01-01T00:00:00Z")
+
+	info := Get()
+	assert.Equal(t, Info{
+		Version:   "v1.2.3",
+		GitCommit: "abc123",
+		BuildDate: "2024-01-01T00:00:00Z",
+		GoVersion: runtime.Version(),
+		Platform:  runtime.GOOS + "/" + runtime.GOARCH,
+	}, info)
+	assert.Contains(t, info.String(), "version v1.2.3, commit abc123")
+}
+
+func TestGetDefaults(t *testing.T) {
+	withBuildVars(t, "dev", "", "")
+
+	info := Get()
+	assert.Equal(t, "dev", info.Version)
+	assert.Equal(t, runtime.Version(), info.GoVersion)
+}
+
+func TestHandler(t *testing.T) {
+	withBuildVars(t, "v1.2.3", "abc123", "")
+
+	w := httptest.NewRecorder()
+	Handler(w, httptest.NewRequest(http.MethodGet, "/istio-test/version", nil))
+
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "application/json", w.Header().Get("Content-Type"))
+	var info Info
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &info))
+	assert.Equal(t, "v1.2.3", info.Version)
+	assert.Equal(t, "abc123", info.GitCommit)
+}
@@ -0,0 +1,377 @@
+// Package watchdog reports conditions that tend to precede an OOM kill or a
+// stuck pod, and logs handler panics as structured events.
+//
+// The watchdog samples the process periodically and rates four conditions:
+// memory use against the container limit, heap growth rate, goroutine count
+// and response writes blocked on slow clients. Every change of a condition's
+// level is logged as a structured warning (or error when critical) and the
+// current level is exported as istio_test_watchdog_level. When memory becomes
+// critical, a heap profile can be written to a mounted volume so it survives
+// the OOM kill that usually follows.
+package watchdog
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"net/http"
+	"os"
+	"path/filepath"
+	"runtime"
+	"runtime/debug"
+	"runtime/pprof"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"istio-test/internal/observability"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Level rates how close a condition is to causing an outage
+type Level int
+
+// Condition levels in escalating order
+const (
+	LevelOK Level = iota
+	LevelWarning
+	LevelCritical
+)
+
+// String returns the name of the level
+func (l Level) String() string {
+	switch l {
+	case LevelWarning:
+		return "warning"
+	case LevelCritical:
+		return "critical"
+	default:
+		return "ok"
+	}
+}
+
+// Names of the monitored conditions
+const (
+	ConditionMemory        = "memory"
+	ConditionHeapGrowth    = "heap_growth"
+	ConditionGoroutines    = "goroutines"
+	ConditionBlockedWrites = "blocked_writes"
+)
+
+// cgroupMemoryLimitFiles hold the container memory limit for cgroup v2 and v1
+var cgroupMemoryLimitFiles = []string{
+	"/sys/fs/cgroup/memory.max",
+	"/sys/fs/cgroup/memory/memory.limit_in_bytes",
+}
+
+var (
+	conditionLevel = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: "istio_test",
+		Name:      "watchdog_level",
+		Help:      "Level of each watchdog condition: 0 ok, 1 warning, 2 critical.",
+	}, []string{"condition"})
+
+	heapProfiles = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: "istio_test",
+		Name:      "watchdog_heap_profiles_total",
+		Help:      "Total number of heap profiles written by the watchdog.",
+	})
+
+	panics = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: "istio_test",
+		Name:      "handler_panics_total",
+		Help:      "Total number of panics recovered from HTTP handlers.",
+	})
+)
+
+func init() {
+	observability.MetricsRegistry().MustRegister(conditionLevel, heapProfiles, panics)
+}
+
+// Options configures the watchdog thresholds
+type Options struct {
+	Interval            time.Duration // Time between samples
+	MemoryLimit         uint64        // Bytes, zero detects the container limit
+	MemoryWarningRatio  float64       // Fraction of the memory limit that warns
+	MemoryCriticalRatio float64       // Fraction of the memory limit that is critical
+	HeapGrowthWarning   float64       // Heap growth in bytes per second that warns
+	GoroutineWarning    int
+	GoroutineCritical   int
+	BlockedWriteWarning time.Duration // Duration a response write may block before it warns; critical at four times
+	ProfileDir          string        // Directory heap profiles are written to, empty disables them
+	ProfileCooldown     time.Duration // Minimum time between heap profiles
+}
+
+// sample is a point-in-time view of the process
+type sample struct {
+	at             time.Time
+	memory         uint64 // Memory obtained from the OS and not released
+	heapInuse      uint64
+	goroutines     int
+	blockedWrites  int
+	oldestBlocking time.Duration
+}
+
+// Watchdog samples the process and reports escalating conditions
+type Watchdog struct {
+	options     Options
+	writes      sync.Map // *trackedWriter -> time.Time the pending write started
+	levels      map[string]Level
+	previous    *sample
+	lastProfile time.Time
+	hostname    string
+}
+
+// New creates a watchdog
+func New(options Options) *Watchdog {
+	if options.Interval <= 0 {
+		options.Interval = 5 * time.Second
+	}
+	if options.MemoryWarningRatio <= 0 {
+		options.MemoryWarningRatio = 0.8
+	}
+	if options.MemoryCriticalRatio <= 0 {
+		options.MemoryCriticalRatio = 0.9
+	}
+	if options.MemoryLimit == 0 {
+		options.MemoryLimit = detectMemoryLimit(cgroupMemoryLimitFiles)
+	}
+	hostname, _ := os.Hostname()
+	return &Watchdog{
+		options:  options,
+		levels:   make(map[string]Level),
+		hostname: hostname,
+	}
+}
+
+// MemoryLimit returns the memory limit the watchdog compares against, zero when unknown
+func (w *Watchdog) MemoryLimit() uint64 {
+	return w.options.MemoryLimit
+}
+
+// detectMemoryLimit returns the first limit found in files, falling back to
+// GOMEMLIMIT; zero means no limit is set
+func detectMemoryLimit(files []string) uint64 {
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			continue
+		}
+		limit, err := strconv.ParseUint(strings.TrimSpace(string(data)), 10, 64)
+		// cgroup v1 reports an unlimited container as a huge page-aligned number
+		if err == nil && limit < 1<<62 {
+			return limit
+		}
+	}
+	if limit := debug.SetMemoryLimit(-1); limit < math.MaxInt64 {
+		return uint64(limit)
+	}
+	return 0
+}
+
+// collect samples the process
+func (w *Watchdog) collect(now time.Time) sample {
+	var stats runtime.MemStats
+	runtime.ReadMemStats(&stats)
+
+	s := sample{
+		at:         now,
+		memory:     stats.Sys - stats.HeapReleased,
+		heapInuse:  stats.HeapInuse,
+		goroutines: runtime.NumGoroutine(),
+	}
+	w.writes.Range(func(_, started any) bool {
+		if blocked := now.Sub(started.(time.Time)); blocked >= w.options.BlockedWriteWarning {
+			s.blockedWrites++
+			s.oldestBlocking = max(s.oldestBlocking, blocked)
+		}
+		return true
+	})
+	return s
+}
+
+// rating is the level of a condition and the fields describing it
+type rating struct {
+	level  Level
+	fields map[string]any
+}
+
+// rate returns the rating of every enabled condition for s
+func (w *Watchdog) rate(s sample) map[string]rating {
+	ratings := make(map[string]rating, 4)
+
+	if limit := w.options.MemoryLimit; limit > 0 {
+		ratio := float64(s.memory) / float64(limit)
+		level := LevelOK
+		switch {
+		case ratio >= w.options.MemoryCriticalRatio:
+			level = LevelCritical
+		case ratio >= w.options.MemoryWarningRatio:
+			level = LevelWarning
+		}
+		ratings[ConditionMemory] = rating{level, map[string]any{"memory_bytes": s.memory, "limit_bytes": limit, "ratio": ratio}}
+	}
+
+	if w.previous != nil && s.at.After(w.previous.at) && w.options.HeapGrowthWarning > 0 {
+		elapsed := s.at.Sub(w.previous.at).Seconds()
+		growth := (float64(s.heapInuse) - float64(w.previous.heapInuse)) / elapsed
+		fields := map[string]any{"heap_inuse_bytes": s.heapInuse, "growth_bytes_per_second": growth}
+		level := LevelOK
+		if growth >= w.options.HeapGrowthWarning {
+			level = LevelWarning
+			// Critical when the limit would be reached within a minute at this rate
+			if limit := w.options.MemoryLimit; limit > 0 && s.memory < limit {
+				secondsToLimit := float64(limit-s.memory) / growth
+				fields["seconds_to_limit"] = secondsToLimit
+				if secondsToLimit < 60 {
+					level = LevelCritical
+				}
+			}
+		}
+		ratings[ConditionHeapGrowth] = rating{level, fields}
+	}
+
+	if w.options.GoroutineWarning > 0 {
+		level := LevelOK
+		switch {
+		case w.options.GoroutineCritical > 0 && s.goroutines >= w.options.GoroutineCritical:
+			level = LevelCritical
+		case s.goroutines >= w.options.GoroutineWarning:
+			level = LevelWarning
+		}
+		ratings[ConditionGoroutines] = rating{level, map[string]any{"goroutines": s.goroutines}}
+	}
+
+	if w.options.BlockedWriteWarning > 0 {
+		level := LevelOK
+		switch {
+		case s.oldestBlocking >= 4*w.options.BlockedWriteWarning:
+			level = LevelCritical
+		case s.blockedWrites > 0:
+			level = LevelWarning
+		}
+		ratings[ConditionBlockedWrites] = rating{level, map[string]any{"blocked_writes": s.blockedWrites, "oldest_blocked_ms": s.oldestBlocking.Milliseconds()}}
+	}
+
+	return ratings
+}
+
+// check samples the process once, logs level changes and writes a heap
+// profile when memory is critical
+func (w *Watchdog) check(ctx context.Context, now time.Time) {
+	s := w.collect(now)
+	for condition, r := range w.rate(s) {
+		conditionLevel.WithLabelValues(condition).Set(float64(r.level))
+
+		previous := w.levels[condition]
+		w.levels[condition] = r.level
+		if r.level == previous {
+			continue
+		}
+
+		r.fields["type"] = "watchdog"
+		r.fields["condition"] = condition
+		r.fields["condition_level"] = r.level.String()
+		r.fields["previous_condition_level"] = previous.String()
+		message := fmt.Sprintf("Watchdog condition %s is %s", condition, r.level)
+		switch r.level {
+		case LevelCritical:
+			observability.ErrorWithFields(ctx, message, r.fields)
+		case LevelWarning:
+			observability.WarnWithFields(ctx, message, r.fields)
+		default:
+			observability.InfoWithContext(ctx, fmt.Sprintf("Watchdog condition %s recovered", condition))
+		}
+	}
+	w.previous = &s
+
+	if w.levels[ConditionMemory] == LevelCritical || w.levels[ConditionHeapGrowth] == LevelCritical {
+		w.writeHeapProfile(ctx, now)
+	}
+}
+
+// writeHeapProfile writes a heap profile to the profile directory unless one
+// was written within the cooldown
+func (w *Watchdog) writeHeapProfile(ctx context.Context, now time.Time) {
+	if w.options.ProfileDir == "" || (!w.lastProfile.IsZero() && now.Sub(w.lastProfile) < w.options.ProfileCooldown) {
+		return
+	}
+	w.lastProfile = now
+
+	path := filepath.Join(w.options.ProfileDir, fmt.Sprintf("heap-%s-%s.pb.gz", w.hostname, now.UTC().Format("20060102T150405Z")))
+	file, err := os.Create(path)
+	if err != nil {
+		observability.ErrorWithContext(ctx, fmt.Sprintf("Watchdog failed to create heap profile: %v", err))
+		return
+	}
+	defer file.Close()
+
+	if err := pprof.Lookup("heap").WriteTo(file, 0); err != nil {
+		observability.ErrorWithContext(ctx, fmt.Sprintf("Watchdog failed to write heap profile: %v", err))
+		return
+	}
+	heapProfiles.Inc()
+	observability.WarnWithFields(ctx, "Watchdog wrote heap profile", map[string]any{"type": "watchdog", "path": path})
+}
+
+// Run samples the process every interval until ctx is done
+func (w *Watchdog) Run(ctx context.Context) {
+	ticker := time.NewTicker(w.options.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			w.check(ctx, now)
+		}
+	}
+}
+
+// trackedWriter records pending writes so blocked writers can be detected
+type trackedWriter struct {
+	http.ResponseWriter
+	watchdog *Watchdog
+}
+
+func (tw *trackedWriter) Write(b []byte) (int, error) {
+	tw.watchdog.writes.Store(tw, time.Now())
+	defer tw.watchdog.writes.Delete(tw)
+	return tw.ResponseWriter.Write(b)
+}
+
+// Unwrap allows http.ResponseController to reach the underlying writer
+func (tw *trackedWriter) Unwrap() http.ResponseWriter {
+	return tw.ResponseWriter
+}
+
+// Middleware tracks response writes for blocked writer detection and logs
+// handler panics with their stack before aborting the connection
+func (w *Watchdog) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		defer func() {
+			recovered := recover()
+			if recovered == nil {
+				return
+			}
+			// Deliberate aborts, e.g. /istio-test/fault/abort, are not failures
+			if recovered == http.ErrAbortHandler {
+				panic(recovered)
+			}
+			panics.Inc()
+			observability.ErrorWithFields(r.Context(), fmt.Sprintf("Panic serving %s %s: %v", r.Method, r.URL.Path, recovered), map[string]any{
+				"type":   "panic",
+				"method": r.Method,
+				"path":   r.URL.Path,
+				"panic":  fmt.Sprint(recovered),
+				"stack":  string(debug.Stack()),
+			})
+			// Already logged, abort the response without the net/http stack dump
+			panic(http.ErrAbortHandler)
+		}()
+		next.ServeHTTP(&trackedWriter{ResponseWriter: rw, watchdog: w}, r)
+	})
+}
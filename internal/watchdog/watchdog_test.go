@@ -0,0 +1,141 @@
+package watchdog
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDetectMemoryLimit(t *testing.T) {
+	dir := t.TempDir()
+	limited := filepath.Join(dir, "memory.max")
+	unlimitedV2 := filepath.Join(dir, "unlimited.max")
+	unlimitedV1 := filepath.Join(dir, "memory.limit_in_bytes")
+	require.NoError(t, os.WriteFile(limited, []byte("536870912\n"), 0o600))
+	require.NoError(t, os.WriteFile(unlimitedV2, []byte("max\n"), 0o600))
+	require.NoError(t, os.WriteFile(unlimitedV1, []byte("9223372036854771712\n"), 0o600))
+
+	assert.Equal(t, uint64(536870912), detectMemoryLimit([]string{filepath.Join(dir, "missing"), limited}))
+	assert.Equal(t, uint64(536870912), detectMemoryLimit([]string{unlimitedV2, unlimitedV1, limited}))
+	assert.Zero(t, detectMemoryLimit([]string{unlimitedV2, unlimitedV1}))
+}
+
+func TestRate(t *testing.T) {
+	w := New(Options{
+		MemoryLimit:         10000,
+		HeapGrowthWarning:   10,
+		GoroutineWarning:    100,
+		GoroutineCritical:   1000,
+		BlockedWriteWarning: time.Second,
+	})
+	now := time.Now()
+
+	ratings := w.rate(sample{at: now, memory: 5000, goroutines: 10})
+	assert.Equal(t, LevelOK, ratings[ConditionMemory].level)
+	assert.Equal(t, LevelOK, ratings[ConditionGoroutines].level)
+	assert.Equal(t, LevelOK, ratings[ConditionBlockedWrites].level)
+	assert.NotContains(t, ratings, ConditionHeapGrowth, "growth needs a previous sample")
+
+	w.previous = &sample{at: now.Add(-time.Second), heapInuse: 100}
+	ratings = w.rate(sample{at: now, memory: 8500, heapInuse: 120, goroutines: 200, blockedWrites: 1, oldestBlocking: 2 * time.Second})
+	assert.Equal(t, LevelWarning, ratings[ConditionMemory].level)
+	assert.Equal(t, LevelWarning, ratings[ConditionHeapGrowth].level)
+	assert.Equal(t, LevelWarning, ratings[ConditionGoroutines].level)
+	assert.Equal(t, LevelWarning, ratings[ConditionBlockedWrites].level)
+
+	// 20 B/s growth with 400 B left reaches the limit within a minute
+	ratings = w.rate(sample{at: now, memory: 9600, heapInuse: 120, goroutines: 1000, blockedWrites: 1, oldestBlocking: 5 * time.Second})
+	assert.Equal(t, LevelCritical, ratings[ConditionMemory].level)
+	assert.Equal(t, LevelCritical, ratings[ConditionHeapGrowth].level)
+	assert.Equal(t, LevelCritical, ratings[ConditionGoroutines].level)
+	assert.Equal(t, LevelCritical, ratings[ConditionBlockedWrites].level)
+}
+
+func TestCheckWritesHeapProfile(t *testing.T) {
+	dir := t.TempDir()
+	// A one byte limit keeps memory critical
+	w := New(Options{MemoryLimit: 1, ProfileDir: dir, ProfileCooldown: time.Minute})
+	now := time.Now()
+	before := testutil.ToFloat64(heapProfiles)
+
+	w.check(context.Background(), now)
+	assert.Equal(t, LevelCritical, w.levels[ConditionMemory])
+	assert.Equal(t, float64(LevelCritical), testutil.ToFloat64(conditionLevel.WithLabelValues(ConditionMemory)))
+
+	// The cooldown prevents a second profile
+	w.check(context.Background(), now.Add(time.Second))
+
+	profiles, err := filepath.Glob(filepath.Join(dir, "heap-*.pb.gz"))
+	require.NoError(t, err)
+	assert.Len(t, profiles, 1)
+	assert.Equal(t, before+1, testutil.ToFloat64(heapProfiles))
+}
+
+func TestMiddlewareTracksBlockedWrites(t *testing.T) {
+	w := New(Options{BlockedWriteWarning: time.Millisecond})
+	writing := make(chan struct{})
+	release := make(chan struct{})
+	handler := w.Middleware(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		_, _ = rw.Write([]byte("ok"))
+	}))
+
+	blocking := &blockingWriter{ResponseWriter: httptest.NewRecorder(), writing: writing, release: release}
+	done := make(chan struct{})
+	go func() {
+		handler.ServeHTTP(blocking, httptest.NewRequest(http.MethodGet, "/", nil))
+		close(done)
+	}()
+
+	<-writing
+	time.Sleep(5 * time.Millisecond)
+	s := w.collect(time.Now())
+	assert.Equal(t, 1, s.blockedWrites)
+	assert.GreaterOrEqual(t, s.oldestBlocking, time.Millisecond)
+
+	close(release)
+	<-done
+	assert.Zero(t, w.collect(time.Now()).blockedWrites)
+}
+
+// blockingWriter blocks writes until released, like a client that stopped reading
+type blockingWriter struct {
+	http.ResponseWriter
+	writing chan struct{}
+	release chan struct{}
+}
+
+func (bw *blockingWriter) Write(b []byte) (int, error) {
+	close(bw.writing)
+	<-bw.release
+	return bw.ResponseWriter.Write(b)
+}
+
+func TestMiddlewareRecoversPanics(t *testing.T) {
+	w := New(Options{})
+	before := testutil.ToFloat64(panics)
+
+	handler := w.Middleware(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		panic("boom")
+	}))
+	assert.PanicsWithValue(t, http.ErrAbortHandler, func() {
+		handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+	})
+	assert.Equal(t, before+1, testutil.ToFloat64(panics))
+
+	// Deliberate aborts pass through uncounted
+	abort := w.Middleware(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		panic(http.ErrAbortHandler)
+	}))
+	assert.PanicsWithValue(t, http.ErrAbortHandler, func() {
+		abort.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+	})
+	assert.Equal(t, before+1, testutil.ToFloat64(panics))
+}
@@ -0,0 +1,151 @@
+// Package whoami reports which pod, zone and version served a request.
+//
+// JSON is returned by default for automation. With ?format=html a full page
+// colored by zone and version is rendered instead, so traffic shifting
+// between zones or versions is visible at a glance in human demos when the
+// page is reloaded in a browser.
+package whoami
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"html/template"
+	"math"
+	"net/http"
+	"os"
+
+	"istio-test/internal/metadata"
+	"istio-test/internal/observability"
+	"istio-test/internal/version"
+)
+
+// FormatParam selects the response format, "json" (default) or "html"
+const FormatParam = "format"
+
+// contentSecurityPolicy of the HTML page, which only needs its inline stylesheet
+const contentSecurityPolicy = "default-src 'none'; style-src 'unsafe-inline'; frame-ancestors 'none'"
+
+// Response describes the pod that served the request
+type Response struct {
+	Hostname string `json:"hostname"`
+	Zone     string `json:"zone,omitempty"`
+	Cluster  string `json:"cluster,omitempty"`
+	Version  string `json:"version"`
+	Color    string `json:"color"` // CSS color derived from zone and version
+}
+
+// Color returns a CSS hex color that is stable for a zone and version, so
+// every pod of the same zone and version renders the same color. The hue is
+// taken from a hash; saturation and lightness are fixed so white text stays
+// readable on every color.
+func Color(zone, version string) string {
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(zone + "/" + version))
+	hue := float64(h.Sum32() % 360)
+
+	// HSL to RGB with saturation 0.65 and lightness 0.4
+	const saturation, lightness = 0.65, 0.4
+	chroma := (1 - math.Abs(2*lightness-1)) * saturation
+	x := chroma * (1 - math.Abs(math.Mod(hue/60, 2)-1))
+	var r, g, b float64
+	switch {
+	case hue < 60:
+		r, g = chroma, x
+	case hue < 120:
+		r, g = x, chroma
+	case hue < 180:
+		g, b = chroma, x
+	case hue < 240:
+		g, b = x, chroma
+	case hue < 300:
+		r, b = x, chroma
+	default:
+		r, b = chroma, x
+	}
+	m := lightness - chroma/2
+	return fmt.Sprintf("#%02x%02x%02x", int(math.Round((r+m)*255)), int(math.Round((g+m)*255)), int(math.Round((b+m)*255)))
+}
+
+var page = template.Must(template.New("whoami").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<title>istio-test {{.Zone}} {{.Version}}</title>
+<style>
+body { margin: 0; min-height: 100vh; display: flex; align-items: center; justify-content: center;
+  background: {{.Color}}; color: #fff; font-family: sans-serif; }
+main { text-align: center; }
+h1 { font-size: 4rem; margin: 0; }
+p { font-size: 1.5rem; margin: 0.5rem 0; }
+</style>
+</head>
+<body>
+<main>
+<h1>{{if .Zone}}{{.Zone}}{{else}}unknown zone{{end}}</h1>
+<p>version {{.Version}}</p>
+<p>{{.Hostname}}{{if .Cluster}} in {{.Cluster}}{{end}}</p>
+</main>
+</body>
+</html>
+`))
+
+// Handler returns the serving pod as JSON, or as a colored page when format=html.
+// Metadata that cannot be fetched is left empty rather than failing the request.
+func Handler(fetchMetadataFunc func(ctx context.Context, url string) (string, error)) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		format := r.URL.Query().Get(FormatParam)
+		if format != "" && format != "json" && format != "html" {
+			http.Error(w, fmt.Sprintf("Invalid %s %q: must be json or html", FormatParam, format), http.StatusBadRequest)
+			return
+		}
+
+		hostname, _ := os.Hostname()
+		response := Response{
+			Hostname: hostname,
+			Version:  version.Get().Version,
+		}
+		if zone, err := fetchMetadataFunc(r.Context(), metadata.InstanceZoneURL); err == nil {
+			response.Zone = metadata.FormatValue("instance-zone", zone)
+		} else {
+			observability.WarnWithFields(r.Context(), fmt.Sprintf("Zone unavailable for whoami: %v", err), map[string]any{
+				"type":  "whoami",
+				"url":   metadata.InstanceZoneURL,
+				"error": err.Error(),
+			})
+		}
+		if cluster, err := fetchMetadataFunc(r.Context(), metadata.ClusterNameURL); err == nil {
+			response.Cluster = cluster
+		} else {
+			observability.WarnWithFields(r.Context(), fmt.Sprintf("Cluster name unavailable for whoami: %v", err), map[string]any{
+				"type":  "whoami",
+				"url":   metadata.ClusterNameURL,
+				"error": err.Error(),
+			})
+		}
+		response.Color = Color(response.Zone, response.Version)
+
+		if format == "html" {
+			w.Header().Set("Content-Type", "text/html; charset=utf-8")
+			// The strict default policy would block the inline stylesheet
+			w.Header().Set("Content-Security-Policy", contentSecurityPolicy)
+			w.WriteHeader(http.StatusOK)
+			if err := page.Execute(w, response); err != nil {
+				observability.ErrorWithContext(r.Context(), fmt.Sprintf("Error rendering whoami page: %v", err))
+			}
+			return
+		}
+
+		jsonData, err := json.Marshal(response)
+		if err != nil {
+			observability.ErrorWithContext(r.Context(), fmt.Sprintf("Error encoding whoami response: %v", err))
+			http.Error(w, "Failed to encode whoami response", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		_, _ = w.Write(jsonData)
+	}
+}
@@ -0,0 +1,79 @@
+package whoami
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"istio-test/internal/metadata"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func mockFetch(ctx context.Context, url string) (string, error) {
+	switch url {
+	case metadata.InstanceZoneURL:
+		return "projects/123/zones/us-east1-b", nil
+	case metadata.ClusterNameURL:
+		return "test-cluster", nil
+	}
+	return "", errors.New("unknown URL")
+}
+
+func failingFetch(ctx context.Context, url string) (string, error) {
+	return "", errors.New("metadata server unreachable")
+}
+
+func TestColor(t *testing.T) {
+	assert.Equal(t, Color("us-east1-b", "v1"), Color("us-east1-b", "v1"))
+	assert.NotEqual(t, Color("us-east1-b", "v1"), Color("us-east1-c", "v1"))
+	assert.NotEqual(t, Color("us-east1-b", "v1"), Color("us-east1-b", "v2"))
+	assert.Regexp(t, `^#[0-9a-f]{6}$`, Color("us-east1-b", "v1"))
+}
+
+func TestHandlerJSON(t *testing.T) {
+	w := httptest.NewRecorder()
+	Handler(mockFetch)(w, httptest.NewRequest(http.MethodGet, "/istio-test/whoami", nil))
+
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "application/json", w.Header().Get("Content-Type"))
+	var response Response
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	assert.Equal(t, "us-east1-b", response.Zone)
+	assert.Equal(t, "test-cluster", response.Cluster)
+	assert.Equal(t, "dev", response.Version)
+	assert.NotEmpty(t, response.Hostname)
+	assert.Equal(t, Color("us-east1-b", "dev"), response.Color)
+}
+
+func TestHandlerHTML(t *testing.T) {
+	w := httptest.NewRecorder()
+	Handler(mockFetch)(w, httptest.NewRequest(http.MethodGet, "/istio-test/whoami?format=html", nil))
+
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "text/html; charset=utf-8", w.Header().Get("Content-Type"))
+	assert.Contains(t, w.Header().Get("Content-Security-Policy"), "style-src 'unsafe-inline'")
+	body := w.Body.String()
+	assert.Contains(t, body, "background: "+Color("us-east1-b", "dev"))
+	assert.Contains(t, body, "<h1>us-east1-b</h1>")
+	assert.Contains(t, body, "in test-cluster")
+}
+
+func TestHandlerWithoutMetadata(t *testing.T) {
+	w := httptest.NewRecorder()
+	Handler(failingFetch)(w, httptest.NewRequest(http.MethodGet, "/istio-test/whoami?format=html", nil))
+
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), "unknown zone")
+}
+
+func TestHandlerInvalidFormat(t *testing.T) {
+	w := httptest.NewRecorder()
+	Handler(mockFetch)(w, httptest.NewRequest(http.MethodGet, "/istio-test/whoami?format=xml", nil))
+
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
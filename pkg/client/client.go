@@ -0,0 +1,423 @@
+// Package client is a typed Go client for the istio-test endpoints, so test
+// harnesses do not hand-roll HTTP calls and JSON parsing.
+//
+// Idempotent calls are retried on transport errors and 502, 503 and 504 with
+// exponential backoff. Every call carries one X-Request-ID across its
+// retries, the test run ID when configured, and the W3C trace context of ctx
+// when an OpenTelemetry propagator is installed. Error responses are returned
+// as *Error, with the RFC 7807 problem details when the server sent them.
+package client
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+)
+
+// Headers set by the client
+const (
+	RequestIDHeader = "X-Request-ID"
+	TestRunHeader   = "X-Test-Run-Id"
+)
+
+const (
+	defaultTimeout     = 10 * time.Second
+	defaultMaxAttempts = 3
+	defaultBaseDelay   = 100 * time.Millisecond
+	maxDelay           = 2 * time.Second
+	maxResponseBytes   = 4 << 20
+)
+
+// Options configures a Client. Zero values use the defaults.
+type Options struct {
+	HTTPClient  *http.Client  // Client used for requests, e.g. with a tracing transport; defaults to a 10s timeout
+	MaxAttempts int           // Attempts per idempotent call including the first, defaults to 3
+	BaseDelay   time.Duration // Backoff before the first retry, doubled for each further retry; defaults to 100ms
+	TestRunID   string        // Sent as X-Test-Run-Id, so server logs and spans can be filtered by run
+	Header      http.Header   // Sent with every request
+}
+
+// Client calls one istio-test service
+type Client struct {
+	baseURL *url.URL
+	http    *http.Client
+	options Options
+}
+
+// New creates a client for the service at baseURL, e.g. "http://istio-test.istio-test:8080"
+func New(baseURL string, options Options) (*Client, error) {
+	u, err := url.Parse(baseURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, fmt.Errorf("base URL must be an absolute http or https URL: %q", baseURL)
+	}
+	u.Path = strings.TrimSuffix(u.Path, "/")
+
+	httpClient := options.HTTPClient
+	if httpClient == nil {
+		httpClient = &http.Client{Timeout: defaultTimeout}
+	}
+	if options.MaxAttempts < 1 {
+		options.MaxAttempts = defaultMaxAttempts
+	}
+	if options.BaseDelay <= 0 {
+		options.BaseDelay = defaultBaseDelay
+	}
+	return &Client{baseURL: u, http: httpClient, options: options}, nil
+}
+
+// Problem is an RFC 7807 problem detail returned by the service
+type Problem struct {
+	Type      string `json:"type"`
+	Title     string `json:"title"`
+	Status    int    `json:"status"`
+	Detail    string `json:"detail,omitempty"`
+	Instance  string `json:"instance,omitempty"`
+	RequestID string `json:"request_id,omitempty"`
+}
+
+// Error is returned when the service answers with an unexpected status
+type Error struct {
+	StatusCode int
+	RequestID  string   // X-Request-ID of the call
+	Problem    *Problem // Problem details, nil when the body was not application/problem+json
+	Body       string   // Body of responses without problem details
+}
+
+func (e *Error) Error() string {
+	switch {
+	case e.Problem != nil && e.Problem.Detail != "":
+		return fmt.Sprintf("istio-test responded %d: %s", e.StatusCode, e.Problem.Detail)
+	case e.Body != "":
+		return fmt.Sprintf("istio-test responded %d: %s", e.StatusCode, strings.TrimSpace(e.Body))
+	default:
+		return fmt.Sprintf("istio-test responded %d", e.StatusCode)
+	}
+}
+
+// StatusCode returns the status of an *Error in err's chain, or zero
+func StatusCode(err error) int {
+	var clientErr *Error
+	if errors.As(err, &clientErr) {
+		return clientErr.StatusCode
+	}
+	return 0
+}
+
+// call describes one logical request
+type call struct {
+	method string
+	path   string
+	query  url.Values
+	header http.Header
+	body   []byte
+	retry  bool // Retry transport errors and 502, 503 and 504
+}
+
+// response is a fully read response
+type response struct {
+	status    int
+	header    http.Header
+	body      []byte
+	requestID string
+}
+
+// retryableStatus reports whether a status is worth another attempt
+func retryableStatus(status int) bool {
+	return status == http.StatusBadGateway || status == http.StatusServiceUnavailable || status == http.StatusGatewayTimeout
+}
+
+// do sends the call, retrying as allowed, and returns the last response
+func (c *Client) do(ctx context.Context, call call) (*response, error) {
+	u := *c.baseURL
+	u.Path += call.path
+	u.RawQuery = call.query.Encode()
+	requestID := newRequestID()
+
+	attempts := 1
+	if call.retry {
+		attempts = c.options.MaxAttempts
+	}
+	delay := c.options.BaseDelay
+	for attempt := 1; ; attempt++ {
+		resp, err := c.send(ctx, call, u.String(), requestID)
+		last := attempt >= attempts || ctx.Err() != nil
+		if err == nil && (last || !retryableStatus(resp.status)) {
+			return resp, nil
+		}
+		if last {
+			return nil, fmt.Errorf("%s %s failed after %d attempts: %w", call.method, call.path, attempt, err)
+		}
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, ctx.Err()
+		case <-timer.C:
+		}
+		delay = min(2*delay, maxDelay)
+	}
+}
+
+// send performs one attempt and reads the whole response
+func (c *Client) send(ctx context.Context, call call, target, requestID string) (*response, error) {
+	req, err := http.NewRequestWithContext(ctx, call.method, target, bytes.NewReader(call.body))
+	if err != nil {
+		return nil, err
+	}
+	for name, values := range c.options.Header {
+		req.Header[name] = values
+	}
+	for name, values := range call.header {
+		req.Header[name] = values
+	}
+	req.Header.Set(RequestIDHeader, requestID)
+	if c.options.TestRunID != "" {
+		req.Header.Set(TestRunHeader, c.options.TestRunID)
+	}
+	otel.GetTextMapPropagator().Inject(ctx, propagation.HeaderCarrier(req.Header))
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxResponseBytes))
+	if err != nil {
+		return nil, fmt.Errorf("error reading response: %w", err)
+	}
+	return &response{status: resp.StatusCode, header: resp.Header, body: body, requestID: requestID}, nil
+}
+
+// errorFor builds the *Error of a response
+func errorFor(resp *response) *Error {
+	clientErr := &Error{StatusCode: resp.status, RequestID: resp.requestID}
+	mediaType, _, _ := mime.ParseMediaType(resp.header.Get("Content-Type"))
+	if mediaType == "application/problem+json" {
+		var problem Problem
+		if err := json.Unmarshal(resp.body, &problem); err == nil {
+			clientErr.Problem = &problem
+			return clientErr
+		}
+	}
+	clientErr.Body = string(resp.body)
+	return clientErr
+}
+
+// decode decodes a JSON response into v, returning an *Error for other
+// statuses than ok
+func decode(resp *response, v any, ok ...int) error {
+	expected := false
+	for _, status := range ok {
+		expected = expected || resp.status == status
+	}
+	if !expected {
+		return errorFor(resp)
+	}
+	if err := json.Unmarshal(resp.body, v); err != nil {
+		return fmt.Errorf("error decoding response: %w", err)
+	}
+	return nil
+}
+
+// newRequestID returns a random request ID
+func newRequestID() string {
+	var b [16]byte
+	_, _ = rand.Read(b[:])
+	return hex.EncodeToString(b[:])
+}
+
+// GetMetadata returns one metadata attribute of the node serving the
+// request, such as "instance-zone" or "cluster-name". With bypassCache the
+// service skips its metadata cache.
+func (c *Client) GetMetadata(ctx context.Context, metadataType string, bypassCache bool) (string, error) {
+	query := url.Values{}
+	if bypassCache {
+		query.Set("nocache", "true")
+	}
+	resp, err := c.do(ctx, call{method: http.MethodGet, path: "/istio-test/metadata/" + url.PathEscape(metadataType), query: query, retry: true})
+	if err != nil {
+		return "", err
+	}
+
+	var values map[string]string
+	if err := decode(resp, &values, http.StatusOK); err != nil {
+		return "", err
+	}
+	value, ok := values[metadataType]
+	if !ok {
+		return "", fmt.Errorf("response does not contain %s", metadataType)
+	}
+	return value, nil
+}
+
+// HealthStatus is the status of the service or one of its checks
+type HealthStatus string
+
+// Health statuses reported by the service
+const (
+	HealthStatusHealthy   HealthStatus = "healthy"
+	HealthStatusDegraded  HealthStatus = "degraded"
+	HealthStatusUnhealthy HealthStatus = "unhealthy"
+)
+
+// HealthCheck is the result of one dependency check
+type HealthCheck struct {
+	Status      HealthStatus `json:"status"`
+	Message     string       `json:"message,omitempty"`
+	Duration    string       `json:"duration"`
+	LastChecked time.Time    `json:"last_checked"`
+	Age         string       `json:"age,omitempty"`
+}
+
+// HealthResponse is returned by Health
+type HealthResponse struct {
+	Status    HealthStatus           `json:"status"`
+	Timestamp time.Time              `json:"timestamp"`
+	Uptime    string                 `json:"uptime"`
+	Version   string                 `json:"version"`
+	Checks    map[string]HealthCheck `json:"checks"`
+}
+
+// Health returns the health of the service and its dependencies. An
+// unhealthy service answers 503 with its checks, which are returned without
+// an error; the status is not retried so the report is not lost.
+func (c *Client) Health(ctx context.Context) (*HealthResponse, error) {
+	resp, err := c.do(ctx, call{method: http.MethodGet, path: "/istio-test/health"})
+	if err != nil {
+		return nil, err
+	}
+
+	var health HealthResponse
+	if err := decode(resp, &health, http.StatusOK, http.StatusServiceUnavailable); err != nil {
+		return nil, err
+	}
+	return &health, nil
+}
+
+// EchoResponse is the request as received by the service
+type EchoResponse struct {
+	Method     string              `json:"method"`
+	Path       string              `json:"path"`
+	RawQuery   string              `json:"raw_query,omitempty"`
+	Query      map[string][]string `json:"query"`
+	Host       string              `json:"host"`
+	Protocol   string              `json:"protocol"`
+	RemoteAddr string              `json:"remote_addr"`
+	Headers    map[string][]string `json:"headers"`
+	Body       string              `json:"body,omitempty"`
+	BodyBase64 string              `json:"body_base64,omitempty"`
+	Hostname   string              `json:"hostname"`
+}
+
+// EchoRequest is reflected by Echo
+type EchoRequest struct {
+	Method string      // GET, POST, PUT, PATCH or DELETE; defaults to GET
+	Header http.Header // Extra request headers
+	Body   []byte
+}
+
+// Echo sends the request and returns it as the service saw it, after every
+// proxy on the way. Only GET, PUT and DELETE are retried.
+func (c *Client) Echo(ctx context.Context, request EchoRequest) (*EchoResponse, error) {
+	method := request.Method
+	if method == "" {
+		method = http.MethodGet
+	}
+	idempotent := method == http.MethodGet || method == http.MethodPut || method == http.MethodDelete
+	resp, err := c.do(ctx, call{method: method, path: "/istio-test/echo", header: request.Header, body: request.Body, retry: idempotent})
+	if err != nil {
+		return nil, err
+	}
+
+	var echo EchoResponse
+	if err := decode(resp, &echo, http.StatusOK); err != nil {
+		return nil, err
+	}
+	return &echo, nil
+}
+
+// ChainResponse describes a call made by the service to another service
+type ChainResponse struct {
+	URL           string              `json:"url"`
+	Status        int                 `json:"status,omitempty"`
+	DurationMs    float64             `json:"duration_ms"`
+	Headers       map[string][]string `json:"headers,omitempty"`
+	Body          json.RawMessage     `json:"body,omitempty"` // Downstream JSON body
+	BodyText      string              `json:"body_text,omitempty"`
+	BodyTruncated bool                `json:"body_truncated,omitempty"`
+	Error         string              `json:"error,omitempty"`
+}
+
+// Next returns the next hop when the downstream service was itself an
+// istio-test proxy call, so chains can be walked hop by hop
+func (r *ChainResponse) Next() (*ChainResponse, bool) {
+	if len(r.Body) == 0 {
+		return nil, false
+	}
+	var next ChainResponse
+	if err := json.Unmarshal(r.Body, &next); err != nil || next.URL == "" {
+		return nil, false
+	}
+	return &next, true
+}
+
+// Chain asks the service to call target, an allowlisted in-mesh URL, and
+// returns the downstream response with its timing. Targets that are
+// themselves proxy URLs build multi-hop chains. The service mirrors the
+// downstream status, so a failing hop returns both the response and an *Error.
+func (c *Client) Chain(ctx context.Context, target string) (*ChainResponse, error) {
+	resp, err := c.do(ctx, call{method: http.MethodGet, path: "/istio-test/proxy", query: url.Values{"url": {target}}, retry: true})
+	if err != nil {
+		return nil, err
+	}
+
+	var chain ChainResponse
+	if json.Unmarshal(resp.body, &chain) != nil || chain.URL == "" {
+		// Rejected by the service itself, e.g. a host that is not allowlisted
+		return nil, errorFor(resp)
+	}
+	if resp.status < 200 || resp.status > 299 {
+		return &chain, errorFor(resp)
+	}
+	return &chain, nil
+}
+
+// FanoutResult is the outcome of one target of Fanout
+type FanoutResult struct {
+	Target   string
+	Response *ChainResponse // Nil when the call failed without a downstream response
+	Err      error
+}
+
+// Fanout calls every target through the service concurrently, like Chain,
+// and returns the results in the order of targets
+func (c *Client) Fanout(ctx context.Context, targets []string) []FanoutResult {
+	results := make([]FanoutResult, len(targets))
+	var wg sync.WaitGroup
+	for i, target := range targets {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			response, err := c.Chain(ctx, target)
+			results[i] = FanoutResult{Target: target, Response: response, Err: err}
+		}()
+	}
+	wg.Wait()
+	return results
+}
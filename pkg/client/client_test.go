@@ -0,0 +1,180 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"istio-test/internal/echo"
+	"istio-test/internal/httpclient"
+	"istio-test/internal/metadata"
+	"istio-test/internal/proxy"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newTestClient returns a client for server that retries without delay
+func newTestClient(t *testing.T, server *httptest.Server) *Client {
+	t.Helper()
+	c, err := New(server.URL+"/", Options{BaseDelay: time.Millisecond, TestRunID: "run-1"})
+	require.NoError(t, err)
+	return c
+}
+
+func TestNew(t *testing.T) {
+	for _, baseURL := range []string{"", "istio-test:8080", "ftp://istio-test", "http://"} {
+		_, err := New(baseURL, Options{})
+		assert.Error(t, err, baseURL)
+	}
+}
+
+func TestGetMetadata(t *testing.T) {
+	var calls atomic.Int32
+	fetch := func(ctx context.Context, url string) (string, error) {
+		if calls.Add(1) == 1 {
+			return "", errors.New("metadata server unavailable")
+		}
+		return "projects/123/zones/us-east1-b", nil
+	}
+	server := httptest.NewServer(metadata.MetadataHandler(fetch))
+	defer server.Close()
+	c := newTestClient(t, server)
+
+	// The first attempt answers 502 and is retried
+	zone, err := c.GetMetadata(context.Background(), "instance-zone", false)
+	require.NoError(t, err)
+	assert.Equal(t, "us-east1-b", zone)
+	assert.Equal(t, int32(2), calls.Load())
+
+	// Problem details are returned as *Error
+	_, err = c.GetMetadata(context.Background(), "unknown", false)
+	var clientErr *Error
+	require.ErrorAs(t, err, &clientErr)
+	assert.Equal(t, http.StatusBadRequest, clientErr.StatusCode)
+	require.NotNil(t, clientErr.Problem)
+	assert.Equal(t, "Unknown metadata type", clientErr.Problem.Detail)
+	assert.Equal(t, http.StatusBadRequest, StatusCode(err))
+}
+
+func TestRetriesKeepRequestID(t *testing.T) {
+	var requestIDs []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requestIDs = append(requestIDs, r.Header.Get(RequestIDHeader))
+		assert.Equal(t, "run-1", r.Header.Get(TestRunHeader))
+		http.Error(w, "upstream connect error", http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+	c := newTestClient(t, server)
+
+	_, err := c.Echo(context.Background(), EchoRequest{})
+	assert.Equal(t, http.StatusServiceUnavailable, StatusCode(err))
+	assert.Contains(t, err.Error(), "upstream connect error")
+	require.Len(t, requestIDs, defaultMaxAttempts)
+	assert.NotEmpty(t, requestIDs[0])
+	for _, id := range requestIDs {
+		assert.Equal(t, requestIDs[0], id)
+	}
+
+	// POST is not retried
+	requestIDs = nil
+	_, err = c.Echo(context.Background(), EchoRequest{Method: http.MethodPost})
+	assert.Error(t, err)
+	assert.Len(t, requestIDs, 1)
+}
+
+func TestEcho(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(echo.Handler))
+	defer server.Close()
+	c := newTestClient(t, server)
+
+	response, err := c.Echo(context.Background(), EchoRequest{
+		Method: http.MethodPost,
+		Header: http.Header{"X-Canary": {"true"}},
+		Body:   []byte(`{"hello":"mesh"}`),
+	})
+	require.NoError(t, err)
+	assert.Equal(t, http.MethodPost, response.Method)
+	assert.Equal(t, "/istio-test/echo", response.Path)
+	assert.Equal(t, `{"hello":"mesh"}`, response.Body)
+	assert.Equal(t, []string{"true"}, response.Headers["X-Canary"])
+	assert.Equal(t, []string{"run-1"}, response.Headers[TestRunHeader])
+}
+
+func TestHealth(t *testing.T) {
+	var calls atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusServiceUnavailable)
+		_, _ = w.Write([]byte(`{"status":"unhealthy","version":"1.2.3","checks":{"metadata":{"status":"unhealthy","message":"timeout"}}}`))
+	}))
+	defer server.Close()
+	c := newTestClient(t, server)
+
+	health, err := c.Health(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, HealthStatusUnhealthy, health.Status)
+	assert.Equal(t, "timeout", health.Checks["metadata"].Message)
+	assert.Equal(t, int32(1), calls.Load())
+}
+
+func TestChainAndFanout(t *testing.T) {
+	downstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/fail" {
+			http.Error(w, "boom", http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"zone":"us-east1-b"}`))
+	}))
+	defer downstream.Close()
+
+	proxyClient := &httpclient.Client{Name: "test", HTTP: downstream.Client()}
+	server := httptest.NewServer(proxy.Handler(proxyClient, httpclient.Allowlist{"127.0.0.1"}))
+	defer server.Close()
+	c := newTestClient(t, server)
+
+	chain, err := c.Chain(context.Background(), downstream.URL+"/ok")
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusOK, chain.Status)
+	assert.JSONEq(t, `{"zone":"us-east1-b"}`, string(chain.Body))
+	_, ok := chain.Next()
+	assert.False(t, ok)
+
+	// A failing hop returns the downstream response and the error
+	chain, err = c.Chain(context.Background(), downstream.URL+"/fail")
+	assert.Equal(t, http.StatusInternalServerError, StatusCode(err))
+	require.NotNil(t, chain)
+	assert.Equal(t, "boom\n", chain.BodyText)
+
+	// Hosts rejected by the service return no response
+	chain, err = c.Chain(context.Background(), "http://example.com/")
+	assert.Nil(t, chain)
+	assert.Equal(t, http.StatusForbidden, StatusCode(err))
+
+	results := c.Fanout(context.Background(), []string{downstream.URL + "/ok", downstream.URL + "/fail"})
+	require.Len(t, results, 2)
+	assert.NoError(t, results[0].Err)
+	assert.True(t, strings.HasSuffix(results[1].Target, "/fail"))
+	assert.Error(t, results[1].Err)
+}
+
+func TestContextCancelStopsRetries(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer server.Close()
+	c, err := New(server.URL, Options{BaseDelay: time.Hour})
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	_, err = c.Echo(ctx, EchoRequest{})
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+}